@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/signer"
+	"github.com/samoslab/samos/src/util/file"
+	"github.com/samoslab/samos/src/util/logging"
+)
+
+// samos-signer holds the keys of a validator and signs for a samos node started with
+// -remote-signer. It refuses to sign a block conflicting with a block it signed before.
+//
+//   samos-signer -gen-auth-key
+//   samos-signer -trust-secret-key-file trust.key -listen unix:/var/run/samos-signer.sock
+//
+// Copy the auth key file to the node and pass it with -remote-signer-auth-file. The key files
+// hold the hex secret keys, keep them and the sign state file readable by the signer only.
+
+var logger = logging.MustGetLogger("signer")
+
+func readSecKey(path string) (cipher.SecKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cipher.SecKey{}, err
+	}
+	return cipher.SecKeyFromHex(strings.TrimSpace(string(data)))
+}
+
+func main() {
+	dataDir := flag.String("data-dir", filepath.Join(file.UserHome(), ".samos-signer"), "directory of the signer files")
+	listen := flag.String("listen", "", "address to listen at, unix:/path or host:port (defaults to unix:<data-dir>/signer.sock)")
+	authKeyFile := flag.String("auth-key-file", "", "file of the hex key shared with the node (defaults to <data-dir>/signer_auth.key)")
+	genAuthKey := flag.Bool("gen-auth-key", false, "write a new key to -auth-key-file and exit")
+	trustKeyFile := flag.String("trust-secret-key-file", "", "file of the hex secret key of the trust node")
+	masterKeyFile := flag.String("master-secret-key-file", "", "file of the hex secret key of the master, set for the genesis node")
+	signStateFile := flag.String("sign-state-file", "", "file of the last block signed (defaults to <data-dir>/sign_state.json)")
+	flag.Parse()
+
+	if err := run(*dataDir, *listen, *authKeyFile, *genAuthKey, *trustKeyFile, *masterKeyFile, *signStateFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dataDir, listen, authKeyFile string, genAuthKey bool, trustKeyFile, masterKeyFile, signStateFile string) error {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return err
+	}
+	if listen == "" {
+		listen = "unix:" + filepath.Join(dataDir, "signer.sock")
+	}
+	if authKeyFile == "" {
+		authKeyFile = filepath.Join(dataDir, "signer_auth.key")
+	}
+	if signStateFile == "" {
+		signStateFile = filepath.Join(dataDir, "sign_state.json")
+	}
+
+	if genAuthKey {
+		if _, err := os.Stat(authKeyFile); err == nil {
+			return fmt.Errorf("%s exists", authKeyFile)
+		}
+		key, err := signer.NewAuthKey()
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(authKeyFile, []byte(key+"\n"), 0600); err != nil {
+			return err
+		}
+		fmt.Printf("auth key written to %s\n", authKeyFile)
+		return nil
+	}
+
+	authKey, err := signer.LoadAuthKey(authKeyFile)
+	if err != nil {
+		return err
+	}
+
+	if trustKeyFile == "" {
+		return fmt.Errorf("-trust-secret-key-file is required")
+	}
+	trustKey, err := readSecKey(trustKeyFile)
+	if err != nil {
+		return fmt.Errorf("invalid trust secret key: %v", err)
+	}
+	var masterKey cipher.SecKey
+	if masterKeyFile != "" {
+		if masterKey, err = readSecKey(masterKeyFile); err != nil {
+			return fmt.Errorf("invalid master secret key: %v", err)
+		}
+	}
+
+	guard, err := signer.LoadGuard(signStateFile)
+	if err != nil {
+		return err
+	}
+	s := signer.NewLocal(func() cipher.SecKey { return trustKey }, masterKey, guard)
+
+	l, err := signer.Listen(listen)
+	if err != nil {
+		return err
+	}
+	srv := signer.NewServer(s, authKey)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-quit
+		logger.Info("Shutting down")
+		srv.Close()
+	}()
+
+	last := guard.Last()
+	logger.Infof("Signing for trust key %s at %s, last signed block %d in slot %d",
+		s.PubKey().Hex(), listen, last.Height, last.Slot)
+	return srv.Serve(l)
+}
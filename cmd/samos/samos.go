@@ -21,7 +21,9 @@ import (
 	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/coin"
 	"github.com/samoslab/samos/src/daemon"
+	"github.com/samoslab/samos/src/daemon/gnet"
 	"github.com/samoslab/samos/src/gui"
+	"github.com/samoslab/samos/src/signer"
 	"github.com/samoslab/samos/src/util/browser"
 	"github.com/samoslab/samos/src/util/cert"
 	"github.com/samoslab/samos/src/util/file"
@@ -58,6 +60,8 @@ var (
 	TrustAddressStr          = "EX8omhDyjKtc8zHGp1KZwn7usCndaoJxSe"
 	BlockchainTrustPubkeyStr = "02aecd90febe163da3c4ac5bb711d9a87b2950d11413541acc9bda17fbda47954e"
 	BlockchainTrustSeckeyStr = ""
+	// secret key the trust node signs with after its key is rotated
+	BlockchainTrustNextSeckeyStr = ""
 
 	TrustPubkeyListStr = "02aecd90febe163da3c4ac5bb711d9a87b2950d11413541acc9bda17fbda47954e,02d15bf28c4ed2c39b35b2be2f8bcde1318e2b3b65fe2a676db39b520bee9bfe86,02e99a1338841e8b1f192337d2c6157045faa0cfe3b8a02210283aed7f5ad6880d"
 
@@ -69,6 +73,30 @@ var (
 	// GenesisCoinVolume represents the coin capacity
 	GenesisCoinVolume uint64 = 300e12
 
+	// BlockReward droplets issued to the producer of every block, 0 issues none
+	BlockReward uint64
+	// FeeRewardPercent percent of the block fee paid to its producer as coin hours
+	FeeRewardPercent int
+	// CosignerRewardPercent percent of the block reward shared by the co-signers of the previous block
+	CosignerRewardPercent int
+	// BlockRewardHeight height of the first block paying rewards
+	BlockRewardHeight uint64 = 1
+	// QuorumCertHeight height of the first block which must carry a quorum certificate, 0 does not require them
+	QuorumCertHeight uint64
+	// PendingBlockWindow number of blocks which may be pending at once, 1 waits for every block to be executed
+	PendingBlockWindow = 1
+	// ConsensusEngine consensus model of the chain: dpos-pbft, single-master or blockstat
+	ConsensusEngine = visor.ConsensusDposPbft
+	// VoteElection elects the validators by stake weighted vote transactions at every epoch boundary
+	VoteElection bool
+	// ElectedValidatorNum number of validators elected, 0 means the size of the trust pubkey list
+	ElectedValidatorNum int
+	// JailMissedPercent percent of missed slots in an epoch which jails a validator, 0 disables it
+	JailMissedPercent int
+	// GovernanceThreshold number of validator signatures a validator set or quorum transaction needs,
+	// 0 means more than two thirds of the validators
+	GovernanceThreshold int
+
 	// DefaultConnections the default trust node addresses
 	DefaultConnections = []string{
 		"47.52.211.167:8858",
@@ -108,10 +136,26 @@ type Config struct {
 	Port int
 	//max outgoing connections to maintain
 	MaxOutgoingConnections int
+	// Peers below the protocol version are disconnected, 0 for the default of the daemon
+	MinProtocolVersion int
 	// How often to make outgoing connections
 	OutgoingConnectionsRate time.Duration
 	// PeerlistSize represents the maximum number of peers that the pex would maintain
 	PeerlistSize int
+	// Misbehavior score the IP of a peer is banned at, 0 disables the bans
+	BanThreshold int
+	// How long the IP of a misbehaving peer is banned for
+	BanDuration time.Duration
+	// Encrypt the connections to the peers, the validators prove their trust keys in the handshake
+	Encrypt bool
+	// Send the prepare messages only over the encrypted connections to the validators
+	AuthenticatedPrepares bool
+	// Messages per second received from each peer, 0 is unlimited
+	MessageRateLimit float64
+	// Messages received from a peer at once over the rate limit
+	MessageBurst int
+	// Bytes per second read from all the peers, 0 is unlimited
+	InboundBandwidth int
 	// Wallet Address Version
 	//AddressVersion string
 	// Remote web interface
@@ -163,11 +207,17 @@ type Config struct {
 	BlockchainPubkey cipher.PubKey
 	BlockchainSeckey cipher.SecKey
 
-	BlockchainTrustPubkey cipher.PubKey
-	BlockchainTrustSeckey cipher.SecKey
-	TrustPubkeyList       []cipher.PubKey
+	BlockchainTrustPubkey     cipher.PubKey
+	BlockchainTrustSeckey     cipher.SecKey
+	BlockchainTrustNextSeckey cipher.SecKey
+	TrustPubkeyList           []cipher.PubKey
 
 	AgreeNum int
+
+	// Create empty heartbeat blocks in the slots of this node while no transactions are pending
+	EmptyBlocks bool
+	// Minimum seconds from the head block to an empty block, 0 creates one in every slot
+	EmptyBlockInterval uint64
 	/* Developer options */
 
 	// Enable cpu profiling
@@ -185,6 +235,14 @@ type Config struct {
 	Arbitrating  bool
 	RPCThreadNum uint // rpc number
 	LogToFile    bool
+
+	// File of the last block the trust node signed, share it with a standby node of the same trust key
+	SignStateFile string
+	// Address of the signer process holding the trust key, unix:/path or host:port
+	RemoteSigner string
+	// File of the hex key shared with the remote signer
+	RemoteSignerAuthFile string
+	RemoteSignerAuthKey  []byte
 }
 
 func (c *Config) register() {
@@ -218,6 +276,9 @@ func (c *Config) register() {
 	flag.StringVar(&c.DataDirectory, "data-dir", c.DataDirectory, "directory to store app data (defaults to ~/.samos)")
 	flag.StringVar(&c.DBPath, "db-path", c.DBPath, "path of database file (defaults to ~/.samos/data.db)")
 	flag.BoolVar(&c.DBReadOnly, "db-read-only", c.DBReadOnly, "open bolt db read-only")
+	flag.StringVar(&c.SignStateFile, "sign-state-file", c.SignStateFile, "file of the last block signed by the trust node, refuses conflicting signatures (defaults to ~/.samos/sign_state.json)")
+	flag.StringVar(&c.RemoteSigner, "remote-signer", c.RemoteSigner, "address of the signer holding the trust key, unix:/path or host:port, instead of -trust-secret-key")
+	flag.StringVar(&c.RemoteSignerAuthFile, "remote-signer-auth-file", c.RemoteSignerAuthFile, "file of the hex key shared with the remote signer")
 	flag.StringVar(&c.ConnectTo, "connect-to", c.ConnectTo, "connect to this ip only")
 	flag.BoolVar(&c.ProfileCPU, "profile-cpu", c.ProfileCPU, "enable cpu profiling")
 	flag.StringVar(&c.ProfileCPUFile, "profile-cpu-file", c.ProfileCPUFile, "where to write the cpu profile file")
@@ -241,13 +302,24 @@ func (c *Config) register() {
 
 	flag.StringVar(&BlockchainTrustPubkeyStr, "trust-public-key", BlockchainTrustPubkeyStr, "public key of the trust node")
 	flag.StringVar(&BlockchainTrustSeckeyStr, "trust-secret-key", BlockchainTrustSeckeyStr, "secret key, set for trust node")
+	flag.StringVar(&BlockchainTrustNextSeckeyStr, "trust-next-secret-key", BlockchainTrustNextSeckeyStr, "secret key the trust node signs with once its key is rotated to it")
 	flag.StringVar(&TrustAddressStr, "trust-address", TrustAddressStr, "trust node address")
 	flag.StringVar(&TrustPubkeyListStr, "trust-pubkey-list", TrustPubkeyListStr, "trust pubkey list")
 	flag.IntVar(&c.AgreeNum, "agreeNum", c.AgreeNum, "agree num for pbft")
+	flag.BoolVar(&c.EmptyBlocks, "empty-blocks", c.EmptyBlocks, "create empty heartbeat blocks in the slots of this node while no transactions are pending")
+	flag.Uint64Var(&c.EmptyBlockInterval, "empty-block-interval", c.EmptyBlockInterval, "minimum seconds from the head block to an empty heartbeat block, 0 creates one in every slot")
 
 	flag.StringVar(&c.WalletDirectory, "wallet-dir", c.WalletDirectory, "location of the wallet files. Defaults to ~/.samos/wallet/")
 	flag.IntVar(&c.MaxOutgoingConnections, "max-outgoing-connections", c.MaxOutgoingConnections, "The maximum outgoing connections allowed")
+	flag.IntVar(&c.MinProtocolVersion, "min-protocol-version", c.MinProtocolVersion, "disconnect the peers below the protocol version, 0 for the default")
 	flag.IntVar(&c.PeerlistSize, "peerlist-size", c.PeerlistSize, "The peer list size")
+	flag.IntVar(&c.BanThreshold, "ban-threshold", c.BanThreshold, "ban the IP of a peer once its misbehavior score reaches this value, 0 disables the bans")
+	flag.DurationVar(&c.BanDuration, "ban-duration", c.BanDuration, "how long the IP of a misbehaving peer is banned for")
+	flag.BoolVar(&c.Encrypt, "encrypt", c.Encrypt, "encrypt the connections to the peers and accept the encrypted connections, a validator proves its trust key to them")
+	flag.Float64Var(&c.MessageRateLimit, "message-rate-limit", c.MessageRateLimit, "messages per second received from each peer, the messages over the limit are dropped and scored as misbehavior, 0 is unlimited")
+	flag.IntVar(&c.MessageBurst, "message-burst", c.MessageBurst, "messages received from a peer at once over the message rate limit")
+	flag.IntVar(&c.InboundBandwidth, "inbound-bandwidth", c.InboundBandwidth, "bytes per second read from all the peers, 0 is unlimited")
+	flag.BoolVar(&c.AuthenticatedPrepares, "authenticated-prepares", c.AuthenticatedPrepares, "send the prepare messages only over the encrypted connections to the peers that proved the trust key of a validator")
 	flag.DurationVar(&c.OutgoingConnectionsRate, "connection-rate", c.OutgoingConnectionsRate, "How often to make an outgoing connection")
 	flag.BoolVar(&c.LocalhostOnly, "localhost-only", c.LocalhostOnly, "Run on localhost and only connect to localhost peers")
 	flag.BoolVar(&c.Arbitrating, "arbitrating", c.Arbitrating, "Run node in arbitrating mode")
@@ -285,6 +357,13 @@ var devConfig = Config{
 	// How often to make outgoing connections, in seconds
 	OutgoingConnectionsRate: time.Second * 5,
 	PeerlistSize:            65535,
+	BanThreshold:            100,
+	BanDuration:             time.Hour * 24,
+	Encrypt:                 false,
+	AuthenticatedPrepares:   false,
+	MessageRateLimit:        200,
+	MessageBurst:            1000,
+	InboundBandwidth:        0,
 	// Wallet Address Version
 	//AddressVersion: "test",
 	// Remote web interface
@@ -331,6 +410,8 @@ var devConfig = Config{
 	BlockchainTrustSeckey: cipher.SecKey{},
 	TrustPubkeyList:       []cipher.PubKey{},
 	AgreeNum:              0,
+	EmptyBlocks:           false,
+	EmptyBlockInterval:    0,
 
 	GenesisAddress:   cipher.Address{},
 	GenesisTimestamp: GenesisTimestamp,
@@ -446,6 +527,11 @@ func (c *Config) postProcess() {
 	if BlockchainTrustPubkeyStr != "" {
 		c.BlockchainTrustSeckey = cipher.SecKey{}
 	}
+	if BlockchainTrustNextSeckeyStr != "" {
+		c.BlockchainTrustNextSeckey, err = cipher.SecKeyFromHex(BlockchainTrustNextSeckeyStr)
+		panicIfError(err, "Invalid Seckey")
+		BlockchainTrustNextSeckeyStr = ""
+	}
 
 	if TrustPubkeyListStr != "" {
 		pubkeys := strings.Split(TrustPubkeyListStr, ",")
@@ -474,6 +560,18 @@ func (c *Config) postProcess() {
 		c.DBPath = filepath.Join(c.DataDirectory, "data.db")
 	}
 
+	if c.SignStateFile == "" {
+		c.SignStateFile = filepath.Join(c.DataDirectory, "sign_state.json")
+	}
+
+	if c.RemoteSigner != "" {
+		if c.RemoteSignerAuthFile == "" {
+			c.RemoteSignerAuthFile = filepath.Join(c.DataDirectory, "signer_auth.key")
+		}
+		c.RemoteSignerAuthKey, err = signer.LoadAuthKey(c.RemoteSignerAuthFile)
+		panicIfError(err, "Invalid remote signer auth key")
+	}
+
 	if c.RunMaster {
 		// Run in arbitrating mode if the node is master
 		c.Arbitrating = true
@@ -613,6 +711,12 @@ func configureDaemon(c *Config) daemon.Config {
 	dc.Pex.DataDirectory = c.DataDirectory
 	dc.Pex.Disabled = c.DisablePEX
 	dc.Pex.Max = c.PeerlistSize
+	dc.Pex.BanThreshold = c.BanThreshold
+	dc.Pex.BanDuration = c.BanDuration
+	dc.Pool.Encrypt = c.Encrypt
+	dc.Pool.ConnectionRateLimit = gnet.RateLimit{Rate: c.MessageRateLimit, Burst: c.MessageBurst}
+	dc.Pool.InboundBandwidth = gnet.RateLimit{Rate: float64(c.InboundBandwidth), Burst: c.InboundBandwidth}
+	dc.Daemon.AuthenticatedPrepares = c.AuthenticatedPrepares
 	dc.Pex.DownloadPeerList = c.DownloadPeerList
 	dc.Pex.PeerListURL = c.PeerListURL
 	dc.Daemon.DisableOutgoingConnections = c.DisableOutgoingConnections
@@ -624,6 +728,9 @@ func configureDaemon(c *Config) daemon.Config {
 	dc.Daemon.OutgoingMax = c.MaxOutgoingConnections
 	dc.Daemon.DataDirectory = c.DataDirectory
 	dc.Daemon.LogPings = !c.DisablePingPong
+	if c.MinProtocolVersion != 0 {
+		dc.Daemon.MinVersion = int32(c.MinProtocolVersion)
+	}
 
 	if c.OutgoingConnectionsRate == 0 {
 		c.OutgoingConnectionsRate = time.Millisecond
@@ -636,15 +743,32 @@ func configureDaemon(c *Config) daemon.Config {
 
 	dc.Visor.Config.BlockchainTrustPubkey = c.BlockchainTrustPubkey
 	dc.Visor.Config.BlockchainTrustSeckey = c.BlockchainTrustSeckey
+	dc.Visor.Config.BlockchainTrustNextSeckey = c.BlockchainTrustNextSeckey
 	dc.Visor.Config.TrustPubkeyList = c.TrustPubkeyList
 	dc.Visor.Config.AgreeNum = c.AgreeNum
+	dc.Visor.Config.EmptyBlocks = c.EmptyBlocks
+	dc.Visor.Config.EmptyBlockInterval = c.EmptyBlockInterval
 
 	dc.Visor.Config.GenesisAddress = c.GenesisAddress
 	dc.Visor.Config.GenesisSignature = c.GenesisSignature
 	dc.Visor.Config.GenesisTimestamp = c.GenesisTimestamp
 	dc.Visor.Config.GenesisCoinVolume = GenesisCoinVolume
+	dc.Visor.Config.BlockReward = BlockReward
+	dc.Visor.Config.FeeRewardPercent = FeeRewardPercent
+	dc.Visor.Config.CosignerRewardPercent = CosignerRewardPercent
+	dc.Visor.Config.BlockRewardHeight = BlockRewardHeight
+	dc.Visor.Config.QuorumCertHeight = QuorumCertHeight
+	dc.Visor.Config.PendingBlockWindow = PendingBlockWindow
+	dc.Visor.Config.ConsensusEngine = ConsensusEngine
+	dc.Visor.Config.VoteElection = VoteElection
+	dc.Visor.Config.ElectedValidatorNum = ElectedValidatorNum
+	dc.Visor.Config.JailMissedPercent = JailMissedPercent
+	dc.Visor.Config.GovernanceThreshold = GovernanceThreshold
 	dc.Visor.Config.DBPath = c.DBPath
 	dc.Visor.Config.DBReadOnly = c.DBReadOnly
+	dc.Visor.Config.SignStatePath = c.SignStateFile
+	dc.Visor.Config.RemoteSigner = c.RemoteSigner
+	dc.Visor.Config.RemoteSignerAuthKey = c.RemoteSignerAuthKey
 	dc.Visor.Config.Arbitrating = c.Arbitrating
 	dc.Visor.Config.EnableWalletAPI = c.EnableWalletAPI
 	dc.Visor.Config.WalletDirectory = c.WalletDirectory
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	gcli "github.com/urfave/cli"
+)
+
+func listBansCmd() gcli.Command {
+	name := "listBans"
+	return gcli.Command{
+		Name:  name,
+		Usage: "List the IPs banned by the node",
+		Description: `
+  Note: An IP is banned once the misbehavior score of its peers reaches the
+        ban threshold of the node. banned_at and until are unix times.`,
+		ArgsUsage:    " ",
+		OnUsageError: onCommandUsageError(name),
+		Action: func(c *gcli.Context) error {
+			rpcClient := RPCClientFromContext(c)
+			bans, err := rpcClient.GetBans()
+			if err != nil {
+				return err
+			}
+
+			return printJSON(bans)
+		},
+	}
+}
+
+func banPeerCmd() gcli.Command {
+	name := "banPeer"
+	return gcli.Command{
+		Name:  name,
+		Usage: "Ban the IP of a peer, the connections to the IP are closed",
+		Description: `
+  Note: The IP is banned for the ban duration of the node unless the duration
+        is specified. A longer ban of the IP is kept.`,
+		ArgsUsage: "[ip]",
+		Flags: []gcli.Flag{
+			gcli.DurationFlag{
+				Name:  "d",
+				Usage: "[duration] duration of the ban, e.g. 48h",
+			},
+			gcli.StringFlag{
+				Name:  "r",
+				Usage: "[reason] reason of the ban",
+			},
+		},
+		OnUsageError: onCommandUsageError(name),
+		Action: func(c *gcli.Context) error {
+			ip := c.Args().First()
+			if ip == "" {
+				errorWithHelp(c, errors.New("missing ip"))
+				return nil
+			}
+
+			d := c.Duration("d")
+			if d < 0 {
+				return fmt.Errorf("invalid duration %v", d)
+			}
+
+			rpcClient := RPCClientFromContext(c)
+			ban, err := rpcClient.BanPeer(ip, d, c.String("r"))
+			if err != nil {
+				return err
+			}
+
+			return printJSON(ban)
+		},
+	}
+}
+
+func unbanPeerCmd() gcli.Command {
+	name := "unbanPeer"
+	return gcli.Command{
+		Name:         name,
+		Usage:        "Remove the ban of the IP of a peer",
+		ArgsUsage:    "[ip]",
+		OnUsageError: onCommandUsageError(name),
+		Action: func(c *gcli.Context) error {
+			ip := c.Args().First()
+			if ip == "" {
+				errorWithHelp(c, errors.New("missing ip"))
+				return nil
+			}
+
+			rpcClient := RPCClientFromContext(c)
+			if err := rpcClient.UnbanPeer(ip); err != nil {
+				return err
+			}
+
+			fmt.Printf("Unbanned %s\n", ip)
+			return nil
+		},
+	}
+}
@@ -214,6 +214,7 @@ func NewApp(cfg Config) *App {
 		addressBalanceCmd(),
 		addressGenCmd(),
 		addressOutputsCmd(),
+		banPeerCmd(),
 		blocksCmd(),
 		broadcastTxCmd(),
 		checkdbCmd(),
@@ -223,12 +224,21 @@ func NewApp(cfg Config) *App {
 		generateWalletCmd(cfg),
 		lastBlocksCmd(),
 		listAddressesCmd(),
+		listBansCmd(),
 		listWalletsCmd(),
+		proposeQuorumCmd(cfg),
+		proposeValidatorsCmd(cfg),
+		rotateKeyCmd(cfg),
 		sendCmd(),
+		signProposalCmd(cfg),
 		statusCmd(),
 		transactionCmd(),
+		unbanPeerCmd(),
+		unjailCmd(cfg),
+		validatorStatsCmd(),
 		verifyAddressCmd(),
 		versionCmd(),
+		voteCmd(cfg),
 		walletBalanceCmd(cfg),
 		walletDirCmd(),
 		walletHisCmd(),
@@ -333,6 +333,11 @@ func CreateRawTxFromAddress(c *webrpc.Client, addr, walletFile, chgAddr string,
 
 // CreateRawTx creates a transaction from a set of addresses contained in a loaded *wallet.Wallet
 func CreateRawTx(c *webrpc.Client, wlt *wallet.Wallet, inAddrs []string, chgAddr string, toAddrs []SendAmount) (*coin.Transaction, error) {
+	return CreateTypedRawTx(c, coin.TxTypeTransfer, wlt, inAddrs, chgAddr, toAddrs)
+}
+
+// CreateTypedRawTx creates a transaction of the given type from a set of addresses contained in a loaded *wallet.Wallet
+func CreateTypedRawTx(c *webrpc.Client, txType uint8, wlt *wallet.Wallet, inAddrs []string, chgAddr string, toAddrs []SendAmount) (*coin.Transaction, error) {
 	if err := validateSendAmounts(toAddrs); err != nil {
 		return nil, err
 	}
@@ -348,7 +353,7 @@ func CreateRawTx(c *webrpc.Client, wlt *wallet.Wallet, inAddrs []string, chgAddr
 		return nil, err
 	}
 
-	txn, err := createRawTx(unspents.Outputs, wlt, inAddrs, chgAddr, toAddrs)
+	txn, err := createTypedRawTx(txType, unspents.Outputs, wlt, inAddrs, chgAddr, toAddrs)
 	if err != nil {
 		return nil, err
 	}
@@ -439,6 +444,10 @@ func verifyTransactionConstraints(txn *coin.Transaction, uxIn coin.UxArray, maxS
 }
 
 func createRawTx(uxouts visor.ReadableOutputSet, wlt *wallet.Wallet, inAddrs []string, chgAddr string, toAddrs []SendAmount) (*coin.Transaction, error) {
+	return createTypedRawTx(coin.TxTypeTransfer, uxouts, wlt, inAddrs, chgAddr, toAddrs)
+}
+
+func createTypedRawTx(txType uint8, uxouts visor.ReadableOutputSet, wlt *wallet.Wallet, inAddrs []string, chgAddr string, toAddrs []SendAmount) (*coin.Transaction, error) {
 	// Calculate total required coins
 	var totalCoins uint64
 	for _, arg := range toAddrs {
@@ -460,7 +469,7 @@ func createRawTx(uxouts visor.ReadableOutputSet, wlt *wallet.Wallet, inAddrs []s
 		return nil, err
 	}
 
-	tx := NewTransaction(spendOutputs, keys, txOuts)
+	tx := NewTypedTransaction(txType, spendOutputs, keys, txOuts)
 
 	return tx, nil
 }
@@ -586,7 +595,14 @@ func getKeys(wlt *wallet.Wallet, outs []wallet.UxBalance) ([]cipher.SecKey, erro
 
 // NewTransaction creates a transaction. The transaction should be validated against hard and soft constraints before transmission.
 func NewTransaction(utxos []wallet.UxBalance, keys []cipher.SecKey, outs []coin.TransactionOutput) *coin.Transaction {
-	tx := coin.Transaction{}
+	return NewTypedTransaction(coin.TxTypeTransfer, utxos, keys, outs)
+}
+
+// NewTypedTransaction creates a transaction of the given type, the type is committed to by the signatures.
+func NewTypedTransaction(txType uint8, utxos []wallet.UxBalance, keys []cipher.SecKey, outs []coin.TransactionOutput) *coin.Transaction {
+	tx := coin.Transaction{
+		Type: txType,
+	}
 	for _, u := range utxos {
 		tx.PushInput(u.Hash)
 	}
@@ -0,0 +1,417 @@
+package cli
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gcli "github.com/urfave/cli"
+
+	"github.com/samoslab/samos/src/api/webrpc"
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/util/droplet"
+	"github.com/samoslab/samos/src/util/fee"
+	"github.com/samoslab/samos/src/visor"
+	"github.com/samoslab/samos/src/wallet"
+)
+
+// newValidatorCoins is the coins the first signer sends to each proposed validator which does not sign
+const newValidatorCoins = "0.001"
+
+const governanceDescription = `
+  Note: The transaction spends one output of every signing validator address and
+        needs signatures from enough validators, see /validators/governance. The
+        inputs owned by the wallet are signed, the other signers add theirs with
+        signProposal, then the transaction is sent with broadcastTransaction.
+
+        The change takes effect at the next epoch boundary after the transaction
+        is in a block. The default wallet (%s) will be used if no wallet was specified.`
+
+func proposeValidatorsCmd(cfg Config) gcli.Command {
+	name := "proposeValidators"
+	return gcli.Command{
+		Name:      name,
+		Usage:     "Create a transaction proposing the validator set",
+		ArgsUsage: "[validator address]...",
+		Description: fmt.Sprintf(governanceDescription+`
+
+        The validators are in the order of the block producer schedule. Signers get
+        their coins back and have to be in the proposed set, a new validator makes
+        its pubkey known by signing too. Each validator which does not sign gets
+        %s coins from the first signer.`, cfg.FullWalletPath(), newValidatorCoins),
+		Flags:        governanceFlags(),
+		OnUsageError: onCommandUsageError(name),
+		Action: func(c *gcli.Context) error {
+			if c.NArg() < 1 {
+				errorWithHelp(c, errors.New("invalid argument"))
+				return nil
+			}
+
+			validators := []string(c.Args())
+			return governanceAction(c, func(rpcClient *webrpc.Client, wlt *wallet.Wallet, signers []string) (*coin.Transaction, error) {
+				return CreateValidatorSetTx(rpcClient, wlt, signers, validators)
+			})
+		},
+	}
+}
+
+func proposeQuorumCmd(cfg Config) gcli.Command {
+	name := "proposeQuorum"
+	return gcli.Command{
+		Name:      name,
+		Usage:     "Create a transaction proposing the quorum of validators which agree on a block",
+		ArgsUsage: "[quorum]",
+		Description: fmt.Sprintf(governanceDescription+`
+
+        Signers get their coins back, the quorum is carried by the hours of the first
+        output, the inputs need at least twice as many hours.`, cfg.FullWalletPath()),
+		Flags:        governanceFlags(),
+		OnUsageError: onCommandUsageError(name),
+		Action: func(c *gcli.Context) error {
+			quorum, err := strconv.ParseUint(c.Args().First(), 10, 64)
+			if err != nil || quorum == 0 {
+				errorWithHelp(c, errors.New("invalid quorum"))
+				return nil
+			}
+
+			return governanceAction(c, func(rpcClient *webrpc.Client, wlt *wallet.Wallet, signers []string) (*coin.Transaction, error) {
+				return CreateQuorumTx(rpcClient, wlt, signers, quorum)
+			})
+		},
+	}
+}
+
+func signProposalCmd(cfg Config) gcli.Command {
+	name := "signProposal"
+	return gcli.Command{
+		Name:      name,
+		Usage:     "Sign the inputs of a validator set, quorum or key rotation transaction owned by the wallet",
+		ArgsUsage: "[raw transaction]",
+		Description: fmt.Sprintf(`
+  Note: The transaction is printed with the added signatures, it can be sent with
+        broadcastTransaction once every input is signed. The default wallet (%s)
+        will be used if no wallet was specified.`, cfg.FullWalletPath()),
+		Flags: []gcli.Flag{
+			gcli.StringFlag{
+				Name:  "f",
+				Usage: "[wallet file or path], Signing wallet",
+			},
+			gcli.BoolFlag{
+				Name:  "json,j",
+				Usage: "Returns the results in JSON format.",
+			},
+		},
+		OnUsageError: onCommandUsageError(name),
+		Action: func(c *gcli.Context) error {
+			rpcClient := RPCClientFromContext(c)
+
+			b, err := hex.DecodeString(c.Args().First())
+			if err != nil {
+				errorWithHelp(c, fmt.Errorf("invalid raw transaction: %v", err))
+				return nil
+			}
+			txn, err := coin.TransactionDeserialize(b)
+			if err != nil {
+				return err
+			}
+
+			walletFile, err := resolveWalletPath(ConfigFromContext(c), c.String("f"))
+			if err != nil {
+				return err
+			}
+			wlt, err := wallet.Load(walletFile)
+			if err != nil {
+				return err
+			}
+
+			if err := SignGovernanceTx(rpcClient, wlt, &txn); err != nil {
+				return err
+			}
+
+			return printGovernanceTx(c, &txn)
+		},
+	}
+}
+
+func governanceFlags() []gcli.Flag {
+	return []gcli.Flag{
+		gcli.StringFlag{
+			Name:  "f",
+			Usage: "[wallet file or path], Wallet signing the inputs it owns",
+		},
+		gcli.StringFlag{
+			Name:  "s",
+			Usage: "[addresses] Comma separated addresses of the signing validators, the first one pays the fee",
+		},
+		gcli.BoolFlag{
+			Name:  "json,j",
+			Usage: "Returns the results in JSON format.",
+		},
+	}
+}
+
+func governanceAction(c *gcli.Context, create func(*webrpc.Client, *wallet.Wallet, []string) (*coin.Transaction, error)) error {
+	rpcClient := RPCClientFromContext(c)
+
+	signers := []string{}
+	for _, s := range strings.Split(c.String("s"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			signers = append(signers, s)
+		}
+	}
+	if len(signers) == 0 {
+		errorWithHelp(c, errors.New("signing validator addresses are required"))
+		return nil
+	}
+
+	walletFile, err := resolveWalletPath(ConfigFromContext(c), c.String("f"))
+	if err != nil {
+		return err
+	}
+	wlt, err := wallet.Load(walletFile)
+	if err != nil {
+		return err
+	}
+
+	txn, err := create(rpcClient, wlt, signers)
+	if err != nil {
+		return err
+	}
+
+	return printGovernanceTx(c, txn)
+}
+
+func printGovernanceTx(c *gcli.Context, txn *coin.Transaction) error {
+	rawTx := hex.EncodeToString(txn.Serialize())
+	unsigned := unsignedInputs(txn)
+
+	if c.Bool("json") {
+		return printJSON(struct {
+			RawTx    string `json:"rawtx"`
+			Unsigned int    `json:"unsigned_inputs"`
+		}{
+			RawTx:    rawTx,
+			Unsigned: unsigned,
+		})
+	}
+
+	fmt.Println(rawTx)
+	if unsigned > 0 {
+		fmt.Printf("%d inputs are not signed yet\n", unsigned)
+	}
+	return nil
+}
+
+// governanceSpends returns the spendable output with the most hours of every signer address
+func governanceSpends(c *webrpc.Client, signers []string) ([]wallet.UxBalance, error) {
+	outputs, err := c.GetUnspentOutputs(signers)
+	if err != nil {
+		return nil, err
+	}
+	uxbs, err := visor.ReadableOutputsToUxBalances(outputs.Outputs.SpendableOutputs())
+	if err != nil {
+		return nil, err
+	}
+
+	spends := make([]wallet.UxBalance, 0, len(signers))
+	seen := make(map[cipher.Address]struct{}, len(signers))
+	for _, s := range signers {
+		addr, err := cipher.DecodeBase58Address(s)
+		if err != nil {
+			return nil, ErrAddress
+		}
+		if _, ok := seen[addr]; ok {
+			continue
+		}
+		seen[addr] = struct{}{}
+		var best *wallet.UxBalance
+		for i := range uxbs {
+			if uxbs[i].Address == addr && (best == nil || uxbs[i].Hours > best.Hours) {
+				best = &uxbs[i]
+			}
+		}
+		if best == nil {
+			return nil, fmt.Errorf("%s has no spendable output", s)
+		}
+		spends = append(spends, *best)
+	}
+	return spends, nil
+}
+
+// CreateValidatorSetTx creates a transaction proposing the validators, signed by the inputs the wallet owns
+func CreateValidatorSetTx(c *webrpc.Client, wlt *wallet.Wallet, signers, validators []string) (*coin.Transaction, error) {
+	spends, err := governanceSpends(c, signers)
+	if err != nil {
+		return nil, err
+	}
+
+	newCoins, err := droplet.FromString(newValidatorCoins)
+	if err != nil {
+		return nil, err
+	}
+
+	coins := make(map[cipher.Address]uint64, len(spends))
+	var totalHours uint64
+	for _, s := range spends {
+		coins[s.Address] = s.Coins
+		totalHours += s.Hours
+	}
+
+	addrs := make([]cipher.Address, 0, len(validators))
+	seen := make(map[cipher.Address]struct{}, len(validators))
+	for _, v := range validators {
+		addr, err := cipher.DecodeBase58Address(v)
+		if err != nil {
+			return nil, ErrAddress
+		}
+		if _, ok := seen[addr]; ok {
+			return nil, fmt.Errorf("validator %s is proposed twice", v)
+		}
+		seen[addr] = struct{}{}
+		addrs = append(addrs, addr)
+	}
+	for addr := range coins {
+		if _, ok := seen[addr]; !ok {
+			return nil, fmt.Errorf("signer %s is not in the proposed validators", addr)
+		}
+	}
+
+	payer := spends[0].Address
+	for _, addr := range addrs {
+		if _, ok := coins[addr]; ok {
+			continue
+		}
+		if coins[payer] <= newCoins {
+			return nil, wallet.ErrInsufficientBalance
+		}
+		coins[payer] -= newCoins
+		coins[addr] = newCoins
+	}
+
+	// all hours are spent as fee
+	if err := fee.VerifyTransactionFeeForHours(0, totalHours); err != nil {
+		return nil, err
+	}
+
+	outs := make([]coin.TransactionOutput, 0, len(addrs))
+	for _, addr := range addrs {
+		outs = append(outs, coin.TransactionOutput{
+			Address: addr,
+			Coins:   coins[addr],
+		})
+	}
+
+	return newGovernanceTx(coin.TxTypeValidatorSet, wlt, spends, outs), nil
+}
+
+// CreateQuorumTx creates a transaction proposing the quorum, signed by the inputs the wallet owns
+func CreateQuorumTx(c *webrpc.Client, wlt *wallet.Wallet, signers []string, quorum uint64) (*coin.Transaction, error) {
+	spends, err := governanceSpends(c, signers)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalHours uint64
+	outs := make([]coin.TransactionOutput, 0, len(spends))
+	for _, s := range spends {
+		totalHours += s.Hours
+		outs = append(outs, coin.TransactionOutput{
+			Address: s.Address,
+			Coins:   s.Coins,
+		})
+	}
+
+	if totalHours < quorum {
+		return nil, fee.ErrTxnInsufficientCoinHours
+	}
+	if err := fee.VerifyTransactionFeeForHours(quorum, totalHours-quorum); err != nil {
+		return nil, err
+	}
+	outs[0].Hours = quorum
+
+	return newGovernanceTx(coin.TxTypeQuorum, wlt, spends, outs), nil
+}
+
+// newGovernanceTx creates the transaction, the inputs not owned by the wallet are left unsigned
+func newGovernanceTx(txType uint8, wlt *wallet.Wallet, spends []wallet.UxBalance, outs []coin.TransactionOutput) *coin.Transaction {
+	txn := coin.Transaction{
+		Type: txType,
+	}
+	for _, s := range spends {
+		txn.PushInput(s.Hash)
+	}
+	for _, o := range outs {
+		txn.PushOutput(o.Address, o.Coins, o.Hours)
+	}
+
+	txn.InnerHash = txn.HashInner()
+	txn.Sigs = make([]cipher.Sig, len(txn.In))
+	for i, s := range spends {
+		if entry, ok := wlt.GetEntry(s.Address); ok {
+			txn.Sigs[i] = cipher.SignHash(cipher.AddSHA256(txn.InnerHash, txn.In[i]), entry.Secret)
+		}
+	}
+	txn.UpdateHeader()
+	return &txn
+}
+
+// SignGovernanceTx signs the unsigned inputs of the transaction owned by the wallet
+func SignGovernanceTx(c *webrpc.Client, wlt *wallet.Wallet, txn *coin.Transaction) error {
+	switch txn.Type {
+	case coin.TxTypeValidatorSet, coin.TxTypeQuorum, coin.TxTypeKeyRotation:
+	default:
+		return errors.New("not a validator set, quorum or key rotation transaction")
+	}
+	if txn.InnerHash != txn.HashInner() || len(txn.Sigs) != len(txn.In) {
+		return errors.New("malformed transaction")
+	}
+
+	addrs := wlt.GetAddresses()
+	strAddrs := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		strAddrs = append(strAddrs, a.String())
+	}
+	outputs, err := c.GetUnspentOutputs(strAddrs)
+	if err != nil {
+		return err
+	}
+	uxbs, err := visor.ReadableOutputsToUxBalances(outputs.Outputs.HeadOutputs)
+	if err != nil {
+		return err
+	}
+	owners := make(map[cipher.SHA256]cipher.Address, len(uxbs))
+	for _, u := range uxbs {
+		owners[u.Hash] = u.Address
+	}
+
+	signed := 0
+	for i, h := range txn.In {
+		addr, ok := owners[h]
+		if !ok || txn.Sigs[i] != (cipher.Sig{}) {
+			continue
+		}
+		entry, ok := wlt.GetEntry(addr)
+		if !ok {
+			continue
+		}
+		txn.Sigs[i] = cipher.SignHash(cipher.AddSHA256(txn.InnerHash, h), entry.Secret)
+		signed++
+	}
+	if signed == 0 {
+		return errors.New("the wallet owns no unsigned input of the transaction")
+	}
+	return nil
+}
+
+func unsignedInputs(txn *coin.Transaction) int {
+	n := 0
+	for _, sig := range txn.Sigs {
+		if sig == (cipher.Sig{}) {
+			n++
+		}
+	}
+	return n
+}
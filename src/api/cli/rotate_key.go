@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	gcli "github.com/urfave/cli"
+
+	"github.com/samoslab/samos/src/api/webrpc"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/util/fee"
+	"github.com/samoslab/samos/src/wallet"
+)
+
+func rotateKeyCmd(cfg Config) gcli.Command {
+	name := "rotateKey"
+	return gcli.Command{
+		Name:      name,
+		Usage:     "Replace the signing key of a validator by a new key from a future epoch",
+		ArgsUsage: " ",
+		Description: fmt.Sprintf(`
+  Note: The transaction spends one output of the current validator address and
+        one of the new address, both get their coins back. The old key authorizes
+        the new one by signing the first input, the new key signs the second.
+        The delay in epochs is carried by the hours of the first output.
+
+        The transaction is sent if the wallet owns both addresses, otherwise it is
+        printed, the owner of the new key adds the signature with signProposal and
+        sends it with broadcastTransaction. Start the node with -trust-next-secret-key
+        before the rotation takes effect. The default wallet (%s) will be used if no
+        wallet was specified.`, cfg.FullWalletPath()),
+		Flags: []gcli.Flag{
+			gcli.StringFlag{
+				Name:  "f",
+				Usage: "[wallet file or path], Wallet signing the inputs it owns",
+			},
+			gcli.StringFlag{
+				Name:  "a",
+				Usage: "[address] Address of the current validator pubkey",
+			},
+			gcli.StringFlag{
+				Name:  "n",
+				Usage: "[address] Address of the new validator pubkey",
+			},
+			gcli.Uint64Flag{
+				Name:  "e",
+				Value: 1,
+				Usage: "[epochs] Epochs after the current one until the new key signs",
+			},
+			gcli.BoolFlag{
+				Name:  "json,j",
+				Usage: "Returns the results in JSON format.",
+			},
+		},
+		OnUsageError: onCommandUsageError(name),
+		Action: func(c *gcli.Context) error {
+			rpcClient := RPCClientFromContext(c)
+
+			oldAddr, newAddr := c.String("a"), c.String("n")
+			if oldAddr == "" || newAddr == "" {
+				errorWithHelp(c, errors.New("current and new validator addresses are required"))
+				return nil
+			}
+			if c.Uint64("e") == 0 {
+				errorWithHelp(c, errors.New("delay must be at least one epoch"))
+				return nil
+			}
+
+			walletFile, err := resolveWalletPath(ConfigFromContext(c), c.String("f"))
+			if err != nil {
+				return err
+			}
+			wlt, err := wallet.Load(walletFile)
+			if err != nil {
+				return err
+			}
+
+			txn, err := CreateKeyRotationTx(rpcClient, wlt, oldAddr, newAddr, c.Uint64("e"))
+			if err != nil {
+				return err
+			}
+			if unsignedInputs(txn) > 0 {
+				return printGovernanceTx(c, txn)
+			}
+
+			txid, err := rpcClient.InjectTransaction(txn)
+			if err != nil {
+				return err
+			}
+
+			if c.Bool("json") {
+				return printJSON(struct {
+					Txid string `json:"txid"`
+				}{
+					Txid: txid,
+				})
+			}
+
+			fmt.Printf("txid:%s\n", txid)
+			return nil
+		},
+	}
+}
+
+// CreateKeyRotationTx creates a transaction rotating the validator key of oldAddr to the key of newAddr
+// after the delay in epochs, signed by the inputs the wallet owns
+func CreateKeyRotationTx(c *webrpc.Client, wlt *wallet.Wallet, oldAddr, newAddr string, delay uint64) (*coin.Transaction, error) {
+	spends, err := governanceSpends(c, []string{oldAddr, newAddr})
+	if err != nil {
+		return nil, err
+	}
+	if len(spends) != 2 {
+		return nil, errors.New("the new key must differ from the current key")
+	}
+
+	var totalHours uint64
+	outs := make([]coin.TransactionOutput, 0, len(spends))
+	for _, s := range spends {
+		totalHours += s.Hours
+		outs = append(outs, coin.TransactionOutput{
+			Address: s.Address,
+			Coins:   s.Coins,
+		})
+	}
+
+	if totalHours < delay {
+		return nil, fee.ErrTxnInsufficientCoinHours
+	}
+	if err := fee.VerifyTransactionFeeForHours(delay, totalHours-delay); err != nil {
+		return nil, err
+	}
+	outs[0].Hours = delay
+
+	return newGovernanceTx(coin.TxTypeKeyRotation, wlt, spends, outs), nil
+}
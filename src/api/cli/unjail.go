@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	gcli "github.com/urfave/cli"
+
+	"github.com/samoslab/samos/src/api/webrpc"
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/util/droplet"
+	"github.com/samoslab/samos/src/wallet"
+)
+
+// unjailCoins is the coins the validator address sends to itself with an unjail request
+const unjailCoins = "0.001"
+
+func unjailCmd(cfg Config) gcli.Command {
+	name := "unjail"
+	return gcli.Command{
+		Name:      name,
+		Usage:     "Ask to release a jailed validator at the next epoch boundary",
+		ArgsUsage: " ",
+		Description: fmt.Sprintf(`
+  Note: The request is signed by the key of the validator, the address of the
+        validator pubkey must be in the wallet and hold some coins. The coins
+        are sent back to the same address.
+
+        The request is ignored before the release epoch of the validator, see
+        /validators/jail. The default wallet (%s) will be used if no wallet was specified.`, cfg.FullWalletPath()),
+		Flags: []gcli.Flag{
+			gcli.StringFlag{
+				Name:  "f",
+				Usage: "[wallet file or path], From wallet",
+			},
+			gcli.StringFlag{
+				Name:  "a",
+				Usage: "[address] Address of the validator pubkey, it must be in the wallet",
+			},
+			gcli.BoolFlag{
+				Name:  "json,j",
+				Usage: "Returns the results in JSON format.",
+			},
+		},
+		OnUsageError: onCommandUsageError(name),
+		Action: func(c *gcli.Context) error {
+			rpcClient := RPCClientFromContext(c)
+
+			addr := c.String("a")
+			if addr == "" {
+				errorWithHelp(c, errors.New("validator address is required"))
+				return nil
+			}
+
+			walletFile, err := resolveWalletPath(ConfigFromContext(c), c.String("f"))
+			if err != nil {
+				return err
+			}
+
+			txid, err := UnjailFromAddress(rpcClient, addr, walletFile)
+			if err != nil {
+				return err
+			}
+
+			if c.Bool("json") {
+				return printJSON(struct {
+					Txid string `json:"txid"`
+				}{
+					Txid: txid,
+				})
+			}
+
+			fmt.Printf("txid:%s\n", txid)
+			return nil
+		},
+	}
+}
+
+// UnjailFromAddress sends the unjail request of the validator owning the address in a wallet. Returns txid.
+func UnjailFromAddress(c *webrpc.Client, addr, walletFile string) (string, error) {
+	wlt, err := wallet.Load(walletFile)
+	if err != nil {
+		return "", err
+	}
+
+	validator, err := cipher.DecodeBase58Address(addr)
+	if err != nil {
+		return "", ErrAddress
+	}
+
+	if _, ok := wlt.GetEntry(validator); !ok {
+		return "", fmt.Errorf("%v address is not in wallet", addr)
+	}
+
+	coins, err := droplet.FromString(unjailCoins)
+	if err != nil {
+		return "", err
+	}
+
+	// all inputs are spent from the validator address, which makes its pubkey the owner of the first input
+	toAddrs := []SendAmount{{Addr: addr, Coins: coins}}
+	rawTx, err := CreateTypedRawTx(c, coin.TxTypeUnjail, wlt, []string{addr}, addr, toAddrs)
+	if err != nil {
+		return "", err
+	}
+
+	return c.InjectTransaction(rawTx)
+}
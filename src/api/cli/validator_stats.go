@@ -0,0 +1,28 @@
+package cli
+
+import (
+	gcli "github.com/urfave/cli"
+)
+
+func validatorStatsCmd() gcli.Command {
+	name := "validatorStats"
+	return gcli.Command{
+		Name:  name,
+		Usage: "Show the produced, missed and orphaned block slots of the validators",
+		Description: `
+  Note: The totals of every validator are listed first, followed by the
+        statistics of every epoch. A slot without a block counts as missed,
+        last_missed_slot is the unix time the last missed slot started.`,
+		ArgsUsage:    " ",
+		OnUsageError: onCommandUsageError(name),
+		Action: func(c *gcli.Context) error {
+			rpcClient := RPCClientFromContext(c)
+			stats, err := rpcClient.GetValidatorStats()
+			if err != nil {
+				return err
+			}
+
+			return printJSON(stats)
+		},
+	}
+}
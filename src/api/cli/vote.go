@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	gcli "github.com/urfave/cli"
+
+	"github.com/samoslab/samos/src/api/webrpc"
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/util/droplet"
+	"github.com/samoslab/samos/src/wallet"
+)
+
+// defaultBallot is the coins sent to the candidate with a vote
+const defaultBallot = "0.001"
+
+func voteCmd(cfg Config) gcli.Command {
+	name := "vote"
+	return gcli.Command{
+		Name:      name,
+		Usage:     "Vote for a validator candidate with the stake of an address",
+		ArgsUsage: "[candidate address]",
+		Description: fmt.Sprintf(`
+  Note: The vote is weighted by all the coins held by the voting address when
+        the validators are elected at the next epoch boundary. A later vote of
+        the same address replaces the earlier one.
+
+        Voting for the voting address itself registers the address as a candidate.
+
+        The ballot coins are sent to the candidate, the rest goes back to the
+        voting address. The default wallet (%s) will be used if no wallet was specified.`, cfg.FullWalletPath()),
+		Flags: []gcli.Flag{
+			gcli.StringFlag{
+				Name:  "f",
+				Usage: "[wallet file or path], From wallet",
+			},
+			gcli.StringFlag{
+				Name:  "a",
+				Usage: "[address] Voting address, it must be in the wallet",
+			},
+			gcli.StringFlag{
+				Name:  "b",
+				Value: defaultBallot,
+				Usage: "[ballot] Coins sent to the candidate with the vote",
+			},
+			gcli.BoolFlag{
+				Name:  "json,j",
+				Usage: "Returns the results in JSON format.",
+			},
+		},
+		OnUsageError: onCommandUsageError(name),
+		Action: func(c *gcli.Context) error {
+			rpcClient := RPCClientFromContext(c)
+
+			if c.NArg() < 1 {
+				errorWithHelp(c, errors.New("invalid argument"))
+				return nil
+			}
+
+			candidate := c.Args().First()
+			if _, err := cipher.DecodeBase58Address(candidate); err != nil {
+				errorWithHelp(c, fmt.Errorf("invalid candidate address: %s", candidate))
+				return nil
+			}
+
+			voter := c.String("a")
+			if voter == "" {
+				errorWithHelp(c, errors.New("voting address is required"))
+				return nil
+			}
+
+			ballot, err := droplet.FromString(c.String("b"))
+			if err != nil {
+				errorWithHelp(c, fmt.Errorf("invalid ballot: %v", err))
+				return nil
+			}
+
+			walletFile, err := resolveWalletPath(ConfigFromContext(c), c.String("f"))
+			if err != nil {
+				return err
+			}
+
+			txid, err := VoteFromAddress(rpcClient, voter, walletFile, candidate, ballot)
+			if err != nil {
+				return err
+			}
+
+			if c.Bool("json") {
+				return printJSON(struct {
+					Txid string `json:"txid"`
+				}{
+					Txid: txid,
+				})
+			}
+
+			fmt.Printf("txid:%s\n", txid)
+			return nil
+		},
+	}
+}
+
+// VoteFromAddress votes for the candidate with the stake of an address in a wallet. Returns txid.
+func VoteFromAddress(c *webrpc.Client, addr, walletFile, candidate string, ballot uint64) (string, error) {
+	wlt, err := wallet.Load(walletFile)
+	if err != nil {
+		return "", err
+	}
+
+	voter, err := cipher.DecodeBase58Address(addr)
+	if err != nil {
+		return "", ErrAddress
+	}
+
+	if _, ok := wlt.GetEntry(voter); !ok {
+		return "", fmt.Errorf("%v address is not in wallet", addr)
+	}
+
+	// all inputs are spent from the voting address, which makes it the owner of the first input
+	toAddrs := []SendAmount{{Addr: candidate, Coins: ballot}}
+	rawTx, err := CreateTypedRawTx(c, coin.TxTypeVote, wlt, []string{addr}, addr, toAddrs)
+	if err != nil {
+		return "", err
+	}
+
+	return c.InjectTransaction(rawTx)
+}
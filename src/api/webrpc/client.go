@@ -10,8 +10,10 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/daemon/pex"
 	"github.com/samoslab/samos/src/visor"
 )
 
@@ -177,3 +179,44 @@ func decodeJSON(data []byte, obj interface{}) error {
 	}
 	return nil
 }
+
+// GetBans returns the banned IPs
+func (c *Client) GetBans() ([]pex.Ban, error) {
+	var bans []pex.Ban
+	if err := c.Do(&bans, "get_bans", nil); err != nil {
+		return nil, err
+	}
+
+	return bans, nil
+}
+
+// BanPeer bans the IP of a peer for the duration, the default ban duration of the node if it is 0
+func (c *Client) BanPeer(ip string, d time.Duration, reason string) (*pex.Ban, error) {
+	params := []string{ip, "", reason}
+	if d != 0 {
+		params[1] = d.String()
+	}
+
+	ban := pex.Ban{}
+	if err := c.Do(&ban, "ban_peer", params); err != nil {
+		return nil, err
+	}
+
+	return &ban, nil
+}
+
+// UnbanPeer removes the ban of the IP of a peer
+func (c *Client) UnbanPeer(ip string) error {
+	rlt := IPJson{}
+	return c.Do(&rlt, "unban_peer", []string{ip})
+}
+
+// GetValidatorStats returns the produced, missed and orphaned slots of the validators
+func (c *Client) GetValidatorStats() (*visor.ReadableValidatorStats, error) {
+	stats := visor.ReadableValidatorStats{}
+	if err := c.Do(&stats, "get_validator_stats", nil); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
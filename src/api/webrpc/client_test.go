@@ -10,6 +10,7 @@ import (
 
 	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/daemon/pex"
 	"github.com/samoslab/samos/src/testutil"
 	"github.com/samoslab/samos/src/util/logging"
 	"github.com/samoslab/samos/src/visor"
@@ -53,6 +54,10 @@ func TestClient(t *testing.T) {
 		{"get blocks", testClientGetBlocks},
 		{"get blocks by seq", testClientGetBlocksBySeq},
 		{"get last block", testClientGetLastBlocks},
+		{"get validator stats", testClientGetValidatorStats},
+		{"get bans", testClientGetBans},
+		{"ban peer", testClientBanPeer},
+		{"unban peer", testClientUnbanPeer},
 	}
 
 	for _, f := range testFuncs {
@@ -223,3 +228,43 @@ func testClientGetLastBlocks(t *testing.T, c *Client, s *WebRPC, gw *fakeGateway
 	require.Len(t, blocks.Blocks, 1)
 	require.Equal(t, decodeBlock(blockString), blocks)
 }
+
+func testClientGetValidatorStats(t *testing.T, c *Client, s *WebRPC, gw *fakeGateway) {
+	stats, err := c.GetValidatorStats()
+	require.NoError(t, err)
+	expected, err := gw.GetValidatorStats()
+	require.NoError(t, err)
+	require.Equal(t, expected, stats)
+}
+
+func testClientGetBans(t *testing.T, c *Client, s *WebRPC, gw *fakeGateway) {
+	bans, err := c.GetBans()
+	require.NoError(t, err)
+	require.Equal(t, gw.GetBans(), bans)
+}
+
+func testClientBanPeer(t *testing.T, c *Client, s *WebRPC, gw *fakeGateway) {
+	ban, err := c.BanPeer("112.32.32.14", time.Hour*2, "spam")
+	require.NoError(t, err)
+	require.Equal(t, &pex.Ban{IP: "112.32.32.14", Reason: "spam", BannedAt: 1000, Until: 8200}, ban)
+
+	// the default ban duration
+	ban, err = c.BanPeer("112.32.32.14", 0, "")
+	require.NoError(t, err)
+	require.Equal(t, &pex.Ban{IP: "112.32.32.14", BannedAt: 1000, Until: 87400}, ban)
+}
+
+func testClientUnbanPeer(t *testing.T, c *Client, s *WebRPC, gw *fakeGateway) {
+	gatewayerMock := NewGatewayerMock()
+	s.Gateway = gatewayerMock
+	defer func() {
+		s.Gateway = gw
+	}()
+
+	gatewayerMock.On("UnbanPeer", "112.32.32.14").Return(nil)
+	gatewayerMock.On("UnbanPeer", "112.32.32.15").Return(pex.ErrNotBanned)
+
+	require.NoError(t, c.UnbanPeer("112.32.32.14"))
+	err := c.UnbanPeer("112.32.32.15")
+	require.Equal(t, &RPCError{Code: errCodeInvalidRequest, Message: "IP is not banned"}, err)
+}
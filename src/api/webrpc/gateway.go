@@ -1,9 +1,12 @@
 package webrpc
 
 import (
+	"time"
+
 	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/coin"
 	"github.com/samoslab/samos/src/daemon"
+	"github.com/samoslab/samos/src/daemon/pex"
 	"github.com/samoslab/samos/src/visor"
 	"github.com/samoslab/samos/src/visor/historydb"
 )
@@ -20,4 +23,8 @@ type Gatewayer interface {
 	InjectBroadcastTransaction(tx coin.Transaction) error
 	GetAddrUxOuts(addr []cipher.Address) ([]*historydb.UxOut, error)
 	GetTimeNow() uint64
+	GetValidatorStats() (*visor.ReadableValidatorStats, error)
+	GetBans() []pex.Ban
+	BanPeer(addr string, d time.Duration, reason string) (pex.Ban, error)
+	UnbanPeer(addr string) error
 }
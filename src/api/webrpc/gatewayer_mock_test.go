@@ -7,12 +7,14 @@ package webrpc
 
 import (
 	"fmt"
+	"time"
 
 	mock "github.com/stretchr/testify/mock"
 
 	cipher "github.com/samoslab/samos/src/cipher"
 	coin "github.com/samoslab/samos/src/coin"
 	daemon "github.com/samoslab/samos/src/daemon"
+	pex "github.com/samoslab/samos/src/daemon/pex"
 	visor "github.com/samoslab/samos/src/visor"
 	historydb "github.com/samoslab/samos/src/visor/historydb"
 )
@@ -26,6 +28,33 @@ func NewGatewayerMock() *GatewayerMock {
 	return &GatewayerMock{}
 }
 
+// BanPeer mocked method
+func (m *GatewayerMock) BanPeer(p0 string, p1 time.Duration, p2 string) (pex.Ban, error) {
+
+	ret := m.Called(p0, p1, p2)
+
+	var r0 pex.Ban
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case pex.Ban:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	var r1 error
+	switch res := ret.Get(1).(type) {
+	case nil:
+	case error:
+		r1 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0, r1
+
+}
+
 // GetAddrUxOuts mocked method
 func (m *GatewayerMock) GetAddrUxOuts(p0 []cipher.Address) ([]*historydb.UxOut, error) {
 
@@ -53,6 +82,24 @@ func (m *GatewayerMock) GetAddrUxOuts(p0 []cipher.Address) ([]*historydb.UxOut,
 
 }
 
+// GetBans mocked method
+func (m *GatewayerMock) GetBans() []pex.Ban {
+
+	ret := m.Called()
+
+	var r0 []pex.Ban
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case []pex.Ban:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0
+
+}
+
 // GetBlocks mocked method
 func (m *GatewayerMock) GetBlocks(p0 uint64, p1 uint64) (*visor.ReadableBlocks, error) {
 
@@ -206,6 +253,33 @@ func (m *GatewayerMock) GetUnspentOutputs(p0 ...daemon.OutputsFilter) (*visor.Re
 
 }
 
+// GetValidatorStats mocked method
+func (m *GatewayerMock) GetValidatorStats() (*visor.ReadableValidatorStats, error) {
+
+	ret := m.Called()
+
+	var r0 *visor.ReadableValidatorStats
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case *visor.ReadableValidatorStats:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	var r1 error
+	switch res := ret.Get(1).(type) {
+	case nil:
+	case error:
+		r1 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0, r1
+
+}
+
 // InjectBroadcastTransaction mocked method
 func (m *GatewayerMock) InjectBroadcastTransaction(p0 coin.Transaction) error {
 
@@ -223,3 +297,21 @@ func (m *GatewayerMock) InjectBroadcastTransaction(p0 coin.Transaction) error {
 	return r0
 
 }
+
+// UnbanPeer mocked method
+func (m *GatewayerMock) UnbanPeer(p0 string) error {
+
+	ret := m.Called(p0)
+
+	var r0 error
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case error:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0
+
+}
@@ -0,0 +1,87 @@
+package webrpc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/samoslab/samos/src/daemon/pex"
+)
+
+// IPJson wraps ip with json tags
+type IPJson struct {
+	IP string `json:"ip"`
+}
+
+func getBansHandler(req Request, gateway Gatewayer) Response {
+	if len(req.Params) > 0 {
+		return makeErrorResponse(errCodeInvalidParams, errMsgInvalidParams)
+	}
+
+	return makeSuccessResponse(req.ID, gateway.GetBans())
+}
+
+// banPeerHandler params are the IP, the optional ban duration, e.g. "48h", and the optional reason
+func banPeerHandler(req Request, gateway Gatewayer) Response {
+	var params []string
+	if err := req.DecodeParams(&params); err != nil {
+		logger.Critical().Errorf("decode params failed: %v", err)
+		return makeErrorResponse(errCodeInvalidParams, errMsgInvalidParams)
+	}
+
+	if len(params) == 0 || len(params) > 3 {
+		return makeErrorResponse(errCodeInvalidParams, errMsgInvalidParams)
+	}
+
+	var d time.Duration
+	if len(params) > 1 && params[1] != "" {
+		var err error
+		d, err = time.ParseDuration(params[1])
+		if err != nil {
+			return makeErrorResponse(errCodeInvalidParams, fmt.Sprintf("invalid duration: %v", err))
+		}
+	}
+
+	var reason string
+	if len(params) > 2 {
+		reason = params[2]
+	}
+
+	ban, err := gateway.BanPeer(params[0], d, reason)
+	if err != nil {
+		switch err {
+		case pex.ErrInvalidAddress, pex.ErrInvalidBanDuration:
+			return makeErrorResponse(errCodeInvalidParams, err.Error())
+		default:
+			logger.Error(err)
+			return makeErrorResponse(errCodeInternalError, errMsgInternalError)
+		}
+	}
+
+	return makeSuccessResponse(req.ID, ban)
+}
+
+func unbanPeerHandler(req Request, gateway Gatewayer) Response {
+	var params []string
+	if err := req.DecodeParams(&params); err != nil {
+		logger.Critical().Errorf("decode params failed: %v", err)
+		return makeErrorResponse(errCodeInvalidParams, errMsgInvalidParams)
+	}
+
+	if len(params) != 1 {
+		return makeErrorResponse(errCodeInvalidParams, errMsgInvalidParams)
+	}
+
+	if err := gateway.UnbanPeer(params[0]); err != nil {
+		switch err {
+		case pex.ErrInvalidAddress:
+			return makeErrorResponse(errCodeInvalidParams, err.Error())
+		case pex.ErrNotBanned:
+			return makeErrorResponse(errCodeInvalidRequest, err.Error())
+		default:
+			logger.Error(err)
+			return makeErrorResponse(errCodeInternalError, errMsgInternalError)
+		}
+	}
+
+	return makeSuccessResponse(req.ID, IPJson{params[0]})
+}
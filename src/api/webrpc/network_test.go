@@ -0,0 +1,186 @@
+package webrpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/daemon/pex"
+)
+
+func Test_getBansHandler(t *testing.T) {
+	bans := []pex.Ban{
+		{IP: "112.32.32.14", Reason: "invalid block", BannedAt: 1000, Until: 87400},
+	}
+
+	tests := []struct {
+		name string
+		req  Request
+		want Response
+	}{
+		{
+			"normal",
+			Request{
+				ID:      "1",
+				Method:  "get_bans",
+				Jsonrpc: jsonRPC,
+			},
+			makeSuccessResponse("1", bans),
+		},
+		{
+			"invalid params",
+			Request{
+				ID:      "1",
+				Method:  "get_bans",
+				Jsonrpc: jsonRPC,
+				Params:  []byte(`[1]`),
+			},
+			makeErrorResponse(errCodeInvalidParams, errMsgInvalidParams),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewGatewayerMock()
+			m.On("GetBans").Return(bans)
+			got := getBansHandler(tt.req, m)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_banPeerHandler(t *testing.T) {
+	ban := pex.Ban{IP: "112.32.32.14", Reason: "spam", BannedAt: 1000, Until: 8200}
+
+	type banArgs struct {
+		ip     string
+		d      time.Duration
+		reason string
+	}
+
+	tests := []struct {
+		name   string
+		params string
+		args   *banArgs
+		banErr error
+		want   Response
+	}{
+		{
+			"normal",
+			`["112.32.32.14", "2h", "spam"]`,
+			&banArgs{"112.32.32.14", time.Hour * 2, "spam"},
+			nil,
+			makeSuccessResponse("1", ban),
+		},
+		{
+			"default duration",
+			`["112.32.32.14"]`,
+			&banArgs{"112.32.32.14", 0, ""},
+			nil,
+			makeSuccessResponse("1", ban),
+		},
+		{
+			"no params",
+			`[]`,
+			nil,
+			nil,
+			makeErrorResponse(errCodeInvalidParams, errMsgInvalidParams),
+		},
+		{
+			"too many params",
+			`["112.32.32.14", "2h", "spam", "x"]`,
+			nil,
+			nil,
+			makeErrorResponse(errCodeInvalidParams, errMsgInvalidParams),
+		},
+		{
+			"invalid duration",
+			`["112.32.32.14", "x"]`,
+			nil,
+			nil,
+			makeErrorResponse(errCodeInvalidParams, `invalid duration: time: invalid duration "x"`),
+		},
+		{
+			"invalid address",
+			`["112.32.32"]`,
+			&banArgs{"112.32.32", 0, ""},
+			pex.ErrInvalidAddress,
+			makeErrorResponse(errCodeInvalidParams, "Invalid address"),
+		},
+		{
+			"gateway error",
+			`["112.32.32.14"]`,
+			&banArgs{"112.32.32.14", 0, ""},
+			errors.New("BanPeer failed"),
+			makeErrorResponse(errCodeInternalError, errMsgInternalError),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewGatewayerMock()
+			if tt.args != nil {
+				m.On("BanPeer", tt.args.ip, tt.args.d, tt.args.reason).Return(ban, tt.banErr)
+			}
+			req := Request{
+				ID:      "1",
+				Method:  "ban_peer",
+				Jsonrpc: jsonRPC,
+				Params:  []byte(tt.params),
+			}
+			got := banPeerHandler(req, m)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_unbanPeerHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   string
+		unbanErr error
+		want     Response
+	}{
+		{
+			"normal",
+			`["112.32.32.14"]`,
+			nil,
+			makeSuccessResponse("1", IPJson{"112.32.32.14"}),
+		},
+		{
+			"invalid params",
+			`["112.32.32.14", "112.32.32.15"]`,
+			nil,
+			makeErrorResponse(errCodeInvalidParams, errMsgInvalidParams),
+		},
+		{
+			"not banned",
+			`["112.32.32.14"]`,
+			pex.ErrNotBanned,
+			makeErrorResponse(errCodeInvalidRequest, "IP is not banned"),
+		},
+		{
+			"gateway error",
+			`["112.32.32.14"]`,
+			errors.New("UnbanPeer failed"),
+			makeErrorResponse(errCodeInternalError, errMsgInternalError),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewGatewayerMock()
+			m.On("UnbanPeer", "112.32.32.14").Return(tt.unbanErr)
+			req := Request{
+				ID:      "1",
+				Method:  "unban_peer",
+				Jsonrpc: jsonRPC,
+				Params:  []byte(tt.params),
+			}
+			got := unbanPeerHandler(req, m)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
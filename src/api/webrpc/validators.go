@@ -0,0 +1,14 @@
+package webrpc
+
+func getValidatorStatsHandler(req Request, gateway Gatewayer) Response {
+	if len(req.Params) > 0 {
+		return makeErrorResponse(errCodeInvalidParams, errMsgInvalidParams)
+	}
+
+	stats, err := gateway.GetValidatorStats()
+	if err != nil {
+		logger.Error(err)
+		return makeErrorResponse(errCodeInternalError, errMsgInternalError)
+	}
+	return makeSuccessResponse(req.ID, stats)
+}
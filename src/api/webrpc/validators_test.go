@@ -0,0 +1,77 @@
+package webrpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/visor"
+)
+
+func Test_getValidatorStatsHandler(t *testing.T) {
+	stats := &visor.ReadableValidatorStats{
+		Validators: []visor.ReadableSlotStats{
+			{
+				PubKey:         "03cec5e9f78524a4283868b79cf3a2b406bcd7956cd9b4be325e070a1cb1881563",
+				Address:        "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv",
+				Produced:       10,
+				Missed:         2,
+				LastMissedSlot: 1524129870,
+			},
+		},
+		Epochs: []visor.ReadableEpochStats{},
+	}
+
+	tests := []struct {
+		name   string
+		req    Request
+		getErr error
+		want   Response
+	}{
+		{
+			"normal",
+			Request{
+				ID:      "1",
+				Method:  "get_validator_stats",
+				Jsonrpc: jsonRPC,
+			},
+			nil,
+			makeSuccessResponse("1", stats),
+		},
+		{
+			"invalid params",
+			Request{
+				ID:      "1",
+				Method:  "get_validator_stats",
+				Jsonrpc: jsonRPC,
+				Params:  []byte(`[1]`),
+			},
+			nil,
+			makeErrorResponse(errCodeInvalidParams, errMsgInvalidParams),
+		},
+		{
+			"gateway error",
+			Request{
+				ID:      "1",
+				Method:  "get_validator_stats",
+				Jsonrpc: jsonRPC,
+			},
+			errors.New("GetValidatorStats failed"),
+			makeErrorResponse(errCodeInternalError, errMsgInternalError),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewGatewayerMock()
+			if tt.getErr != nil {
+				m.On("GetValidatorStats").Return(nil, tt.getErr)
+			} else {
+				m.On("GetValidatorStats").Return(stats, nil)
+			}
+			got := getValidatorStatsHandler(tt.req, m)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -204,6 +204,14 @@ func (rpc *WebRPC) initHandlers() error {
 		"inject_transaction": injectTransactionHandler,
 		// get address affected uxouts
 		"get_address_uxouts": getAddrUxOutsHandler,
+		// get produced, missed and orphaned slots of validators
+		"get_validator_stats": getValidatorStatsHandler,
+		// get banned IPs
+		"get_bans": getBansHandler,
+		// ban the IP of a peer
+		"ban_peer": banPeerHandler,
+		// remove the ban of the IP of a peer
+		"unban_peer": unbanPeerHandler,
 	}
 
 	// register handlers
@@ -16,6 +16,7 @@ import (
 	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/coin"
 	"github.com/samoslab/samos/src/daemon"
+	"github.com/samoslab/samos/src/daemon/pex"
 	"github.com/samoslab/samos/src/visor"
 	"github.com/samoslab/samos/src/visor/historydb"
 )
@@ -111,6 +112,36 @@ func (fg fakeGateway) GetTimeNow() uint64 {
 	return 0
 }
 
+func (fg fakeGateway) GetValidatorStats() (*visor.ReadableValidatorStats, error) {
+	return &visor.ReadableValidatorStats{
+		Validators: []visor.ReadableSlotStats{
+			{
+				PubKey:   "03cec5e9f78524a4283868b79cf3a2b406bcd7956cd9b4be325e070a1cb1881563",
+				Address:  "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv",
+				Produced: 10,
+			},
+		},
+		Epochs: []visor.ReadableEpochStats{},
+	}, nil
+}
+
+func (fg fakeGateway) GetBans() []pex.Ban {
+	return []pex.Ban{
+		{IP: "112.32.32.14", Reason: "invalid block", BannedAt: 1000, Until: 87400},
+	}
+}
+
+func (fg fakeGateway) BanPeer(addr string, d time.Duration, reason string) (pex.Ban, error) {
+	if d == 0 {
+		d = time.Hour * 24
+	}
+	return pex.Ban{IP: addr, Reason: reason, BannedAt: 1000, Until: 1000 + int64(d/time.Second)}, nil
+}
+
+func (fg fakeGateway) UnbanPeer(addr string) error {
+	return nil
+}
+
 func Test_rpcHandler_HandlerFunc(t *testing.T) {
 	rpc := setupWebRPC(t)
 	rpc.HandleFunc("get_status", getStatusHandler)
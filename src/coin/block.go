@@ -101,6 +101,16 @@ func NewBlock(prev Block, currentTime uint64, uxHash cipher.SHA256, txns Transac
 	}, nil
 }
 
+// NewEmptyBlock creates a heartbeat Block without transactions, it keeps the chain
+// moving while no transactions are pending
+func NewEmptyBlock(prev Block, currentTime uint64, uxHash cipher.SHA256) *Block {
+	body := BlockBody{Transactions: Transactions{}}
+	return &Block{
+		Head: NewBlockHeader(prev.Head, uxHash, currentTime, 0, body),
+		Body: body,
+	}
+}
+
 // NewGenesisBlock creates genesis block
 func NewGenesisBlock(genesisAddr cipher.Address, genesisCoins, timestamp uint64) (*Block, error) {
 	txn := Transaction{}
@@ -231,8 +241,13 @@ func (bb BlockBody) Bytes() []byte {
 	return encoder.Serialize(bb)
 }
 
-// CreateUnspents creates the expected outputs for a transaction.
+// CreateUnspents creates the expected outputs for a transaction. The outputs of an evidence
+// transaction carry its headers, they are not spendable.
 func CreateUnspents(bh BlockHeader, tx Transaction) UxArray {
+	if tx.Type == TxTypeEvidence {
+		return UxArray{}
+	}
+
 	var h cipher.SHA256
 	if bh.BkSeq != 0 {
 		// not genesis block
@@ -261,6 +276,9 @@ func CreateUnspent(bh BlockHeader, tx Transaction, outIndex int) (UxOut, error)
 	if len(tx.Out) <= outIndex {
 		return UxOut{}, fmt.Errorf("Transaction out index is overflow")
 	}
+	if tx.Type == TxTypeEvidence {
+		return UxOut{}, errors.New("evidence transaction outputs are not spendable")
+	}
 
 	var h cipher.SHA256
 	if bh.BkSeq != 0 {
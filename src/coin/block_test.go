@@ -73,6 +73,21 @@ func TestNewBlock(t *testing.T) {
 	assert.Equal(t, b.Head.UxHash, uxHash)
 }
 
+func TestNewEmptyBlock(t *testing.T) {
+	prev := Block{Head: BlockHeader{Version: 0x02, Time: 100, BkSeq: 98}}
+	uxHash := testutil.RandSHA256(t)
+
+	b := NewEmptyBlock(prev, 133, uxHash)
+	assert.Empty(t, b.Body.Transactions)
+	assert.Equal(t, b.Head.Fee, uint64(0))
+	assert.Equal(t, b.Head.BodyHash, b.Body.Hash())
+	assert.Equal(t, b.Head.PrevHash, prev.HashHeader())
+	assert.Equal(t, b.Head.Time, uint64(133))
+	assert.Equal(t, b.Head.BkSeq, prev.Head.BkSeq+1)
+	assert.Equal(t, b.Head.UxHash, uxHash)
+	assert.Equal(t, b.Head.Version, prev.Head.Version)
+}
+
 func TestBlockHashHeader(t *testing.T) {
 	uxHash := testutil.RandSHA256(t)
 	b, err := makeNewBlock(uxHash)
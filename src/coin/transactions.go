@@ -37,6 +37,47 @@ The inner hash is SHA256 hash of the serialization of Input and Output array
 The outer hash is the hash of the whole transaction serialization
 */
 
+const (
+	// TxTypeTransfer is a plain coin transfer
+	TxTypeTransfer uint8 = 0
+	// TxTypeVote is a validator election ballot, Out[0] names the candidate
+	TxTypeVote uint8 = 1
+	// TxTypeUnjail asks to release the validator owning the first input from jail
+	TxTypeUnjail uint8 = 2
+	// TxTypeValidatorSet proposes the validator set, the output addresses in order,
+	// the owners of the inputs approve it
+	TxTypeValidatorSet uint8 = 3
+	// TxTypeQuorum proposes the quorum, the hours of Out[0], the owners of the inputs approve it
+	TxTypeQuorum uint8 = 4
+	// TxTypeKeyRotation moves a validator from the key owning the first input to the key owning
+	// the second one, the hours of Out[0] are the epochs until it takes effect
+	TxTypeKeyRotation uint8 = 5
+	// TxTypeCoinbase credits the block rewards, it has no inputs, is the last transaction of
+	// a block and is signed by the block producer
+	TxTypeCoinbase uint8 = 6
+	// TxTypeEvidence reports a validator which signed two conflicting block headers, it has
+	// no inputs and precedes the coinbase of a block. The addresses of its outputs carry the
+	// encoded headers, the outputs have neither coins nor hours and are not spendable. Its
+	// signatures are the signatures of the headers.
+	TxTypeEvidence uint8 = 7
+)
+
+var (
+	// evidenceHeadersSize is the size of the two encoded headers of an evidence transaction
+	evidenceHeadersSize = len(encoder.Serialize([2]BlockHeader{}))
+	// evidenceChunkSize is the size of the headers an output address of an evidence transaction carries
+	evidenceChunkSize = 1 + len(cipher.Ripemd160{})
+)
+
+// IsValidTxType returns true if the transaction type is known
+func IsValidTxType(t uint8) bool {
+	switch t {
+	case TxTypeTransfer, TxTypeVote, TxTypeUnjail, TxTypeValidatorSet, TxTypeQuorum, TxTypeKeyRotation, TxTypeCoinbase, TxTypeEvidence:
+		return true
+	}
+	return false
+}
+
 // Transaction transaction struct
 type Transaction struct {
 	Length    uint32        //length prefix
@@ -66,6 +107,13 @@ func (txn *Transaction) Verify() error {
 		return errors.New("Invalid header hash")
 	}
 
+	if txn.Type == TxTypeCoinbase {
+		return errors.New("Coinbase transaction is only valid in a block")
+	}
+	if txn.Type == TxTypeEvidence {
+		return errors.New("Evidence transaction is only valid in a block")
+	}
+
 	if len(txn.In) == 0 {
 		return errors.New("No inputs")
 	}
@@ -90,7 +138,7 @@ func (txn *Transaction) Verify() error {
 		return errors.New("Duplicate spend")
 	}
 
-	if txn.Type != 0 {
+	if !IsValidTxType(txn.Type) {
 		return errors.New("transaction type invalid")
 	}
 
@@ -142,6 +190,74 @@ func (txn *Transaction) Verify() error {
 	return nil
 }
 
+// NewCoinbaseTransaction creates the coinbase transaction of the block following the block
+// of prevHash. The producer signs the inner hash with prevHash, which makes the outputs of
+// equal rewards in different blocks distinct.
+func NewCoinbaseTransaction(prevHash cipher.SHA256, outs []TransactionOutput, sec cipher.SecKey) Transaction {
+	return NewSignedCoinbaseTransaction(outs, cipher.SignHash(CoinbaseSignHash(prevHash, outs), sec))
+}
+
+// CoinbaseSignHash returns the hash the producer signs in the coinbase transaction of the outputs
+func CoinbaseSignHash(prevHash cipher.SHA256, outs []TransactionOutput) cipher.SHA256 {
+	txn := unsignedCoinbaseTransaction(outs)
+	return cipher.AddSHA256(txn.InnerHash, prevHash)
+}
+
+// NewSignedCoinbaseTransaction creates the coinbase transaction of the outputs with the signature of CoinbaseSignHash
+func NewSignedCoinbaseTransaction(outs []TransactionOutput, sig cipher.Sig) Transaction {
+	txn := unsignedCoinbaseTransaction(outs)
+	txn.Sigs = []cipher.Sig{sig}
+	txn.UpdateHeader()
+	return txn
+}
+
+func unsignedCoinbaseTransaction(outs []TransactionOutput) Transaction {
+	txn := Transaction{Type: TxTypeCoinbase}
+	for _, o := range outs {
+		txn.PushOutput(o.Address, o.Coins, o.Hours)
+	}
+	txn.InnerHash = txn.HashInner()
+	return txn
+}
+
+// VerifyCoinbase checks the coinbase transaction of the block following the block of prevHash
+// and returns the pubkey of the producer which signed it. The rewards are not checked.
+func (txn *Transaction) VerifyCoinbase(prevHash cipher.SHA256) (cipher.PubKey, error) {
+	if txn.Type != TxTypeCoinbase {
+		return cipher.PubKey{}, errors.New("not a coinbase transaction")
+	}
+	if txn.InnerHash != txn.HashInner() {
+		return cipher.PubKey{}, errors.New("Invalid header hash")
+	}
+	if txn.Length != uint32(txn.Size()) {
+		return cipher.PubKey{}, errors.New("transaction size prefix invalid")
+	}
+	if len(txn.In) != 0 || len(txn.Sigs) != 1 {
+		return cipher.PubKey{}, errors.New("malformed coinbase transaction")
+	}
+	if len(txn.Out) == 0 {
+		return cipher.PubKey{}, errors.New("No outputs")
+	}
+
+	addrs := make(map[cipher.Address]struct{}, len(txn.Out))
+	coins := uint64(0)
+	for _, o := range txn.Out {
+		if o.Coins == 0 && o.Hours == 0 {
+			return cipher.PubKey{}, errors.New("Zero coin output")
+		}
+		if _, ok := addrs[o.Address]; ok {
+			return cipher.PubKey{}, errors.New("Duplicate output in transaction")
+		}
+		addrs[o.Address] = struct{}{}
+		var err error
+		if coins, err = AddUint64(coins, o.Coins); err != nil {
+			return cipher.PubKey{}, errors.New("Output coins overflow")
+		}
+	}
+
+	return cipher.PubKeyFromSig(txn.Sigs[0], cipher.AddSHA256(txn.InnerHash, prevHash))
+}
+
 // VerifyInput verifies the input
 func (txn Transaction) VerifyInput(uxIn UxArray) error {
 	if DebugLevel2 {
@@ -261,20 +377,181 @@ func (txn *Transaction) TxIDHex() string {
 func (txn *Transaction) UpdateHeader() {
 	s := txn.Size()
 	txn.Length = uint32(s)
-	txn.Type = byte(0x00)
 	txn.InnerHash = txn.HashInner()
 }
 
 // HashInner hashes only the Transaction Inputs & Outputs
 // This is what is signed
 // Client hashes the inner hash with hash of output being spent and signs it with private key
+// Typed transactions also commit to their type, transfers hash as before
 func (txn *Transaction) HashInner() cipher.SHA256 {
 	b1 := encoder.Serialize(txn.In)
 	b2 := encoder.Serialize(txn.Out)
 	b3 := append(b1, b2...)
+	if txn.Type != TxTypeTransfer {
+		b3 = append(b3, txn.Type)
+	}
 	return cipher.SumSHA256(b3)
 }
 
+// NewEvidenceTransaction creates the evidence transaction of two conflicting headers and
+// the signatures of their producer
+func NewEvidenceTransaction(headers [2]BlockHeader, sigs [2]cipher.Sig) Transaction {
+	txn := Transaction{Type: TxTypeEvidence}
+	b := encoder.Serialize(headers)
+	for i := 0; i < len(b); i += evidenceChunkSize {
+		chunk := make([]byte, evidenceChunkSize)
+		copy(chunk, b[i:])
+		addr := cipher.Address{Version: chunk[0]}
+		copy(addr.Key[:], chunk[1:])
+		txn.PushOutput(addr, 0, 0)
+	}
+	txn.Sigs = append(txn.Sigs, sigs[:]...)
+	txn.UpdateHeader()
+	return txn
+}
+
+// EvidenceHeaders returns the headers of an evidence transaction and the signatures of their
+// producer, the signatures are not verified
+func (txn *Transaction) EvidenceHeaders() (headers [2]BlockHeader, sigs [2]cipher.Sig, err error) {
+	if txn.Type != TxTypeEvidence {
+		return headers, sigs, errors.New("not an evidence transaction")
+	}
+	if txn.InnerHash != txn.HashInner() {
+		return headers, sigs, errors.New("Invalid header hash")
+	}
+	if txn.Length != uint32(txn.Size()) {
+		return headers, sigs, errors.New("transaction size prefix invalid")
+	}
+
+	chunks := (evidenceHeadersSize + evidenceChunkSize - 1) / evidenceChunkSize
+	if len(txn.In) != 0 || len(txn.Out) != chunks || len(txn.Sigs) != 2 {
+		return headers, sigs, errors.New("malformed evidence transaction")
+	}
+	b := make([]byte, 0, chunks*evidenceChunkSize)
+	for _, o := range txn.Out {
+		if o.Coins != 0 || o.Hours != 0 {
+			return headers, sigs, errors.New("malformed evidence transaction")
+		}
+		b = append(b, o.Address.Version)
+		b = append(b, o.Address.Key[:]...)
+	}
+	// the padding is zero, the same evidence has a single encoding
+	for _, c := range b[evidenceHeadersSize:] {
+		if c != 0 {
+			return headers, sigs, errors.New("malformed evidence transaction")
+		}
+	}
+	if err := encoder.DeserializeRaw(b[:evidenceHeadersSize], &headers); err != nil {
+		return headers, sigs, err
+	}
+	copy(sigs[:], txn.Sigs)
+	return headers, sigs, nil
+}
+
+// VoteBallot returns the voter pubkey and the candidate address of a vote transaction.
+// The voter is the owner of the first input, the candidate is the first output address.
+func (txn *Transaction) VoteBallot() (cipher.PubKey, cipher.Address, error) {
+	if txn.Type != TxTypeVote {
+		return cipher.PubKey{}, cipher.Address{}, errors.New("not a vote transaction")
+	}
+	if len(txn.Out) == 0 {
+		return cipher.PubKey{}, cipher.Address{}, errors.New("malformed vote transaction")
+	}
+	pubkey, err := txn.firstSigner()
+	if err != nil {
+		return cipher.PubKey{}, cipher.Address{}, err
+	}
+	return pubkey, txn.Out[0].Address, nil
+}
+
+// UnjailRequest returns the pubkey of the validator which asks to be released from jail,
+// the owner of the first input
+func (txn *Transaction) UnjailRequest() (cipher.PubKey, error) {
+	if txn.Type != TxTypeUnjail {
+		return cipher.PubKey{}, errors.New("not an unjail transaction")
+	}
+	return txn.firstSigner()
+}
+
+// ValidatorSetProposal returns the validator addresses proposed by a validator set transaction,
+// the distinct output addresses in the order they first appear
+func (txn *Transaction) ValidatorSetProposal() ([]cipher.Address, error) {
+	if txn.Type != TxTypeValidatorSet {
+		return nil, errors.New("not a validator set transaction")
+	}
+	seen := make(map[cipher.Address]struct{}, len(txn.Out))
+	addrs := []cipher.Address{}
+	for _, o := range txn.Out {
+		if _, ok := seen[o.Address]; ok {
+			continue
+		}
+		seen[o.Address] = struct{}{}
+		addrs = append(addrs, o.Address)
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("malformed validator set transaction")
+	}
+	return addrs, nil
+}
+
+// QuorumProposal returns the quorum proposed by a quorum transaction, the hours of the first output
+func (txn *Transaction) QuorumProposal() (uint64, error) {
+	if txn.Type != TxTypeQuorum {
+		return 0, errors.New("not a quorum transaction")
+	}
+	if len(txn.Out) == 0 || txn.Out[0].Hours == 0 {
+		return 0, errors.New("malformed quorum transaction")
+	}
+	return txn.Out[0].Hours, nil
+}
+
+// KeyRotation returns the old and the new validator pubkey of a key rotation transaction and
+// the epochs until it takes effect. The old key owns the first input, the new key the second.
+func (txn *Transaction) KeyRotation() (oldKey, newKey cipher.PubKey, delay uint64, err error) {
+	if txn.Type != TxTypeKeyRotation {
+		return cipher.PubKey{}, cipher.PubKey{}, 0, errors.New("not a key rotation transaction")
+	}
+	signers, err := txn.InputSigners()
+	if err != nil {
+		return cipher.PubKey{}, cipher.PubKey{}, 0, err
+	}
+	if len(signers) != 2 || txn.Out[0].Hours == 0 {
+		return cipher.PubKey{}, cipher.PubKey{}, 0, errors.New("malformed key rotation transaction")
+	}
+	return signers[0], signers[1], txn.Out[0].Hours, nil
+}
+
+// InputSigners recovers the distinct pubkeys of the owners of the inputs from their signatures,
+// in the order of the inputs
+func (txn *Transaction) InputSigners() ([]cipher.PubKey, error) {
+	if len(txn.In) == 0 || len(txn.Sigs) != len(txn.In) {
+		return nil, errors.New("transaction has no signed input")
+	}
+	seen := make(map[cipher.PubKey]struct{}, len(txn.In))
+	pubkeys := []cipher.PubKey{}
+	for i := range txn.In {
+		pubkey, err := cipher.PubKeyFromSig(txn.Sigs[i], cipher.AddSHA256(txn.InnerHash, txn.In[i]))
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[pubkey]; ok {
+			continue
+		}
+		seen[pubkey] = struct{}{}
+		pubkeys = append(pubkeys, pubkey)
+	}
+	return pubkeys, nil
+}
+
+// firstSigner recovers the pubkey of the owner of the first input from its signature
+func (txn *Transaction) firstSigner() (cipher.PubKey, error) {
+	if len(txn.In) == 0 || len(txn.Sigs) == 0 {
+		return cipher.PubKey{}, errors.New("transaction has no signed input")
+	}
+	return cipher.PubKeyFromSig(txn.Sigs[0], cipher.AddSHA256(txn.InnerHash, txn.In[0]))
+}
+
 // Serialize serialize the transaction
 func (txn *Transaction) Serialize() []byte {
 	return encoder.Serialize(*txn)
@@ -318,6 +595,10 @@ type Transactions []Transaction
 func (txns Transactions) Fees(calc FeeCalculator) (uint64, error) {
 	total := uint64(0)
 	for i := range txns {
+		// the coinbase and the evidence spend nothing and pay no fee
+		if txns[i].Type == TxTypeCoinbase || txns[i].Type == TxTypeEvidence {
+			continue
+		}
 		fee, err := calc(&txns[i])
 		if err != nil {
 			return 0, err
@@ -309,6 +309,253 @@ func TestTransactionHashInner(t *testing.T) {
 	tx2 = copyTransaction(tx)
 	tx.Sigs = append(tx.Sigs, cipher.Sig{})
 	require.Equal(t, tx.HashInner(), tx2.HashInner())
+
+	// If tx.Type is changed, hash should change
+	tx2 = copyTransaction(tx)
+	tx2.Type = TxTypeVote
+	require.NotEqual(t, tx.HashInner(), tx2.HashInner())
+}
+
+func TestTransactionVerifyType(t *testing.T) {
+	tx := makeTransaction(t)
+	tx.Type = 0xff
+	tx.Sigs = nil
+	tx.SignInputs([]cipher.SecKey{genSecret})
+	tx.UpdateHeader()
+	testutil.RequireError(t, tx.Verify(), "transaction type invalid")
+
+	ux, s := makeUxOutWithSecret(t)
+	tx = makeTransactionFromUxOut(t, ux, s)
+	tx.Type = TxTypeVote
+	tx.Sigs = nil
+	tx.SignInputs([]cipher.SecKey{s})
+	tx.UpdateHeader()
+	require.Equal(t, TxTypeVote, tx.Type)
+	require.NoError(t, tx.Verify())
+}
+
+func TestTransactionVoteBallot(t *testing.T) {
+	ux, s := makeUxOutWithSecret(t)
+	tx := makeTransactionFromUxOut(t, ux, s)
+	_, _, err := tx.VoteBallot()
+	testutil.RequireError(t, err, "not a vote transaction")
+
+	tx.Type = TxTypeVote
+	tx.Sigs = nil
+	tx.SignInputs([]cipher.SecKey{s})
+	tx.UpdateHeader()
+
+	voter, candidate, err := tx.VoteBallot()
+	require.NoError(t, err)
+	require.Equal(t, cipher.PubKeyFromSecKey(s), voter)
+	require.Equal(t, tx.Out[0].Address, candidate)
+}
+
+func TestTransactionUnjailRequest(t *testing.T) {
+	ux, s := makeUxOutWithSecret(t)
+	tx := makeTransactionFromUxOut(t, ux, s)
+	_, err := tx.UnjailRequest()
+	testutil.RequireError(t, err, "not an unjail transaction")
+
+	tx.Type = TxTypeUnjail
+	tx.Sigs = nil
+	_, err = tx.UnjailRequest()
+	testutil.RequireError(t, err, "transaction has no signed input")
+
+	tx.SignInputs([]cipher.SecKey{s})
+	tx.UpdateHeader()
+
+	pubkey, err := tx.UnjailRequest()
+	require.NoError(t, err)
+	require.Equal(t, cipher.PubKeyFromSecKey(s), pubkey)
+}
+
+func TestTransactionGovernanceProposals(t *testing.T) {
+	ux1, s1 := makeUxOutWithSecret(t)
+	ux2, s2 := makeUxOutWithSecret(t)
+	addr1 := makeAddress()
+	addr2 := makeAddress()
+
+	tx := Transaction{Type: TxTypeValidatorSet}
+	tx.PushInput(ux1.Hash())
+	tx.PushInput(ux2.Hash())
+	tx.PushOutput(addr2, 1e6, 0)
+	tx.PushOutput(addr1, 1e6, 0)
+	tx.PushOutput(addr2, 2e6, 3)
+	tx.SignInputs([]cipher.SecKey{s1, s2})
+	tx.UpdateHeader()
+
+	addrs, err := tx.ValidatorSetProposal()
+	require.NoError(t, err)
+	require.Equal(t, []cipher.Address{addr2, addr1}, addrs)
+	_, err = tx.QuorumProposal()
+	testutil.RequireError(t, err, "not a quorum transaction")
+
+	signers, err := tx.InputSigners()
+	require.NoError(t, err)
+	require.Equal(t, []cipher.PubKey{cipher.PubKeyFromSecKey(s1), cipher.PubKeyFromSecKey(s2)}, signers)
+
+	tx.Type = TxTypeQuorum
+	_, err = tx.ValidatorSetProposal()
+	testutil.RequireError(t, err, "not a validator set transaction")
+	tx.Out[0].Hours = 0
+	_, err = tx.QuorumProposal()
+	testutil.RequireError(t, err, "malformed quorum transaction")
+	tx.Out[0].Hours = 3
+	quorum, err := tx.QuorumProposal()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), quorum)
+
+	tx.Sigs = tx.Sigs[:1]
+	_, err = tx.InputSigners()
+	testutil.RequireError(t, err, "transaction has no signed input")
+}
+
+func TestTransactionCoinbase(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	prev := cipher.SumSHA256([]byte("prev"))
+	outs := []TransactionOutput{
+		{Address: makeAddress(), Coins: 1e6, Hours: 10},
+		{Address: makeAddress(), Hours: 5},
+	}
+
+	tx := NewCoinbaseTransaction(prev, outs, sk)
+	require.Equal(t, TxTypeCoinbase, tx.Type)
+	signer, err := tx.VerifyCoinbase(prev)
+	require.NoError(t, err)
+	require.Equal(t, pk, signer)
+
+	// the same rewards in another block make a different transaction
+	next := NewCoinbaseTransaction(cipher.SumSHA256([]byte("next")), outs, sk)
+	require.NotEqual(t, tx.Hash(), next.Hash())
+
+	// signed for another block
+	signer, err = tx.VerifyCoinbase(cipher.SumSHA256([]byte("next")))
+	require.NoError(t, err)
+	require.NotEqual(t, pk, signer)
+
+	// not accepted outside of a block
+	testutil.RequireError(t, tx.Verify(), "Coinbase transaction is only valid in a block")
+
+	bad := NewCoinbaseTransaction(prev, []TransactionOutput{outs[0], outs[0]}, sk)
+	_, err = bad.VerifyCoinbase(prev)
+	testutil.RequireError(t, err, "Duplicate output in transaction")
+
+	bad = NewCoinbaseTransaction(prev, []TransactionOutput{{Address: makeAddress()}}, sk)
+	_, err = bad.VerifyCoinbase(prev)
+	testutil.RequireError(t, err, "Zero coin output")
+
+	bad = tx
+	bad.PushInput(cipher.SumSHA256([]byte("in")))
+	bad.UpdateHeader()
+	_, err = bad.VerifyCoinbase(prev)
+	testutil.RequireError(t, err, "malformed coinbase transaction")
+
+	// the coinbase pays no fee
+	fees, err := Transactions{tx}.Fees(func(*Transaction) (uint64, error) {
+		return 0, errors.New("no inputs")
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), fees)
+}
+
+func TestTransactionEvidence(t *testing.T) {
+	_, sk := cipher.GenerateKeyPair()
+	headers := [2]BlockHeader{
+		{BkSeq: 5, Time: 100, PrevHash: cipher.SumSHA256([]byte("prev"))},
+		{BkSeq: 5, Time: 105, PrevHash: cipher.SumSHA256([]byte("prev"))},
+	}
+	sigs := [2]cipher.Sig{
+		cipher.SignHash(headers[0].Hash(), sk),
+		cipher.SignHash(headers[1].Hash(), sk),
+	}
+
+	tx := NewEvidenceTransaction(headers, sigs)
+	require.Equal(t, TxTypeEvidence, tx.Type)
+	gotHeaders, gotSigs, err := tx.EvidenceHeaders()
+	require.NoError(t, err)
+	require.Equal(t, headers, gotHeaders)
+	require.Equal(t, sigs, gotSigs)
+
+	// it survives the encoding of the block
+	decoded, err := TransactionDeserialize(tx.Serialize())
+	require.NoError(t, err)
+	gotHeaders, _, err = decoded.EvidenceHeaders()
+	require.NoError(t, err)
+	require.Equal(t, headers, gotHeaders)
+
+	// not accepted outside of a block
+	testutil.RequireError(t, tx.Verify(), "Evidence transaction is only valid in a block")
+
+	// the headers are committed to by the inner hash
+	require.Equal(t, tx.HashInner(), tx.InnerHash)
+	bad := tx
+	bad.Out = append([]TransactionOutput{}, tx.Out...)
+	bad.Out[0].Address.Version++
+	_, _, err = bad.EvidenceHeaders()
+	testutil.RequireError(t, err, "Invalid header hash")
+
+	bad = tx
+	bad.Out = append([]TransactionOutput{}, tx.Out...)
+	bad.Out[len(bad.Out)-1].Address.Key[19] = 1
+	bad.UpdateHeader()
+	_, _, err = bad.EvidenceHeaders()
+	testutil.RequireError(t, err, "malformed evidence transaction")
+
+	bad = tx
+	bad.Out = append([]TransactionOutput{}, tx.Out...)
+	bad.Out[0].Coins = 1e6
+	bad.UpdateHeader()
+	_, _, err = bad.EvidenceHeaders()
+	testutil.RequireError(t, err, "malformed evidence transaction")
+
+	bad = tx
+	bad.Sigs = append([]cipher.Sig{}, tx.Sigs...)
+	bad.Sigs = append(bad.Sigs, cipher.Sig{})
+	bad.UpdateHeader()
+	_, _, err = bad.EvidenceHeaders()
+	testutil.RequireError(t, err, "malformed evidence transaction")
+
+	// its outputs are not spendable
+	require.Empty(t, CreateUnspents(BlockHeader{BkSeq: 6}, tx))
+	_, err = CreateUnspent(BlockHeader{BkSeq: 6}, tx, 0)
+	require.Error(t, err)
+
+	// the evidence pays no fee
+	fees, err := Transactions{tx}.Fees(func(*Transaction) (uint64, error) {
+		return 0, errors.New("no inputs")
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), fees)
+}
+
+func TestTransactionKeyRotation(t *testing.T) {
+	ux1, s1 := makeUxOutWithSecret(t)
+	ux2, s2 := makeUxOutWithSecret(t)
+
+	tx := Transaction{Type: TxTypeKeyRotation}
+	tx.PushInput(ux1.Hash())
+	tx.PushInput(ux2.Hash())
+	tx.PushOutput(ux1.Body.Address, ux1.Body.Coins, 2)
+	tx.PushOutput(ux2.Body.Address, ux2.Body.Coins, 0)
+	tx.SignInputs([]cipher.SecKey{s1, s2})
+	tx.UpdateHeader()
+
+	oldKey, newKey, delay, err := tx.KeyRotation()
+	require.NoError(t, err)
+	require.Equal(t, cipher.PubKeyFromSecKey(s1), oldKey)
+	require.Equal(t, cipher.PubKeyFromSecKey(s2), newKey)
+	require.Equal(t, uint64(2), delay)
+
+	// the new key has to sign
+	tx.Sigs = nil
+	tx.SignInputs([]cipher.SecKey{s1, s1})
+	_, _, _, err = tx.KeyRotation()
+	testutil.RequireError(t, err, "malformed key rotation transaction")
+
+	tx.Type = TxTypeTransfer
+	_, _, _, err = tx.KeyRotation()
+	testutil.RequireError(t, err, "not a key rotation transaction")
 }
 
 func TestTransactionSerialization(t *testing.T) {
@@ -103,6 +103,10 @@ type BlockStat struct {
 	// messages.
 	accept_count int
 
+	// Overrides 'Cfg_consensus_max_candidate_messages' when positive,
+	// see SetMaxCandidateMessages.
+	max_candidate_messages int
+
 	//
 	// BEG debugging/diagnostics
 	//
@@ -153,6 +157,13 @@ func (self *BlockStat) Init() {
 	self.debug_usage = 0
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// SetMaxCandidateMessages sets the number of signatures accepted before the
+// others are neglected, 0 restores 'Cfg_consensus_max_candidate_messages'.
+func (self *BlockStat) SetMaxCandidateMessages(n int) {
+	self.max_candidate_messages = n
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 func (self *BlockStat) GetSeqno() uint64 {
 	return self.seqno
@@ -182,6 +193,17 @@ func (self *BlockStat) try_add_hash_and_sig(
 	hash cipher.SHA256,
 	sig cipher.Sig) int {
 
+	return self.try_add_hash_and_signed(hash, hash, sig)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// try_add_hash_and_signed counts the signature of 'signed' as a signature of
+// the block hash, a vote signs a hash derived from the block hash.
+func (self *BlockStat) try_add_hash_and_signed(
+	hash cipher.SHA256,
+	signed cipher.SHA256,
+	sig cipher.Sig) int {
+
 	if self.frozen {
 		// To get a more accurate number of rejects, one would need to
 		// do as below, except insertion/updating. However, we do not
@@ -201,7 +223,11 @@ func (self *BlockStat) try_add_hash_and_sig(
 	// for the updates. Say, the breakdown is: hash H1 from 50
 	// signers, hash H2 from 10, hash H3 from 2 and hash H4 from 1.
 	// We make a local decision to choose H1.
-	if self.accept_count >= Cfg_consensus_max_candidate_messages {
+	max_candidate_messages := Cfg_consensus_max_candidate_messages
+	if self.max_candidate_messages > 0 {
+		max_candidate_messages = self.max_candidate_messages
+	}
+	if self.accept_count >= max_candidate_messages {
 		self.debug_neglect_count += 1
 		return 1 // same as skip
 	}
@@ -244,7 +270,7 @@ func (self *BlockStat) try_add_hash_and_sig(
 		}
 
 		// PERFORMANCE: This is an expensive call:
-		signer_pubkey, err := cipher.PubKeyFromSig(sig, hash)
+		signer_pubkey, err := cipher.PubKeyFromSig(sig, signed)
 		if err != nil {
 			return 4 // <<<<<<<<
 		}
@@ -372,6 +398,33 @@ func (self *BlockStat) GetBestHashPubkeySig() (
 	return best_h, best_p, best_s
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// ObserveHashAndSig counts the signature of the block hash, it returns 0 if the
+// signature was counted; see try_add_hash_and_sig() for the other results.
+func (self *BlockStat) ObserveHashAndSig(
+	hash cipher.SHA256,
+	sig cipher.Sig) int {
+
+	return self.try_add_hash_and_sig(hash, sig)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// ObserveHashAndVote counts the signature of the vote for the block hash, the
+// vote signs 'signed' instead of the block hash.
+func (self *BlockStat) ObserveHashAndVote(
+	hash cipher.SHA256,
+	signed cipher.SHA256,
+	sig cipher.Sig) int {
+
+	return self.try_add_hash_and_signed(hash, signed, sig)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// GetSignerCount returns the number of unique pubkeys which signed the hash.
+func (self *BlockStat) GetSignerCount(hash cipher.SHA256) int {
+	return len(self.hash2info[hash].pubkey2sig)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 func (self *BlockStat) Print() {
 
@@ -22,6 +22,14 @@ var (
 	ErrInvalidMintBlockTime  = errors.New("invalid time to mint the block")
 )
 
+// EpochSeedFunc returns the seed of the validator shuffle of the epoch on the branch of the
+// parent block, ok is false if the epoch can not be seeded, its validators keep the configured order
+type EpochSeedFunc func(parent cipher.SHA256, epoch int64) (seed cipher.SHA256, ok bool)
+
+// ValidatorSetFunc returns the validator set active at the block height,
+// ok is false if no versioned set is known, the current set is used then
+type ValidatorSetFunc func(height uint64) (validators []cipher.PubKey, ok bool)
+
 // Dpos consensus alg
 type Dpos struct {
 	signer      cipher.PubKey
@@ -29,6 +37,8 @@ type Dpos struct {
 	stop        chan bool
 	dposContext *DposContext
 	lastSlot    uint32
+	epochSeed   EpochSeedFunc
+	sets        ValidatorSetFunc
 }
 
 // NewDpos create dpos instance
@@ -45,6 +55,50 @@ func (d *Dpos) SetTrustNode(trusts []cipher.PubKey) error {
 	return d.dposContext.SetValidators(trusts)
 }
 
+// SetSigner set the key the node produces blocks with, it changes when the key is rotated
+func (d *Dpos) SetSigner(signer cipher.PubKey) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.signer = signer
+}
+
+// SetEpochSeed set the seed source of the per epoch validator shuffle
+func (d *Dpos) SetEpochSeed(f EpochSeedFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.epochSeed = f
+}
+
+// SetValidatorSetSource set the source of the validator sets keyed by block height
+func (d *Dpos) SetValidatorSetSource(f ValidatorSetFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sets = f
+}
+
+// epochContext returns the epoch context of the block extending parent at the height and timestamp
+func (d *Dpos) epochContext(parent cipher.SHA256, height uint64, timestamp int64) *EpochContext {
+	d.mu.RLock()
+	f := d.epochSeed
+	sets := d.sets
+	d.mu.RUnlock()
+
+	dc := *d.dposContext
+	if sets != nil {
+		if validators, ok := sets(height); ok {
+			dc = DposContext{candidate: validators}
+		}
+	}
+
+	epochContext := NewEpochFromDposContext(dc, timestamp)
+	if f != nil {
+		if seed, ok := f(parent, Epoch(timestamp)); ok {
+			epochContext.Seed = seed
+		}
+	}
+	return epochContext
+}
+
 func (d *Dpos) checkDeadline(lastBlock *coin.SignedBlock, now int64) error {
 	prevSlot := PrevSlot(now)
 	nextSlot := NextSlot(now)
@@ -66,12 +120,15 @@ func (d *Dpos) CheckValidator(lastBlock *coin.SignedBlock, now int64) error {
 	if err := d.checkDeadline(lastBlock, now); err != nil {
 		return err
 	}
-	epochContext := NewEpochFromDposContext(*d.dposContext, now)
+	epochContext := d.epochContext(lastBlock.HashHeader(), lastBlock.Seq()+1, PrevSlot(now))
 	validator, err := epochContext.LookupValidator(PrevSlot(now))
 	if err != nil {
 		return err
 	}
-	if (validator == cipher.PubKey{} || validator != d.signer) {
+	d.mu.RLock()
+	signer := d.signer
+	d.mu.RUnlock()
+	if (validator == cipher.PubKey{} || validator != signer) {
 		return ErrInvalidBlockValidator
 	}
 	return nil
@@ -87,8 +144,34 @@ func NextSlot(now int64) int64 {
 	return int64((now+blockInterval-1)/blockInterval) * blockInterval
 }
 
-// GetValidator returns validator in the timestamp
-func (d *Dpos) GetValidator(timestamp int64) (cipher.PubKey, error) {
-	epochContext := NewEpochFromDposContext(*d.dposContext, timestamp)
-	return epochContext.LookupValidator(PrevSlot(timestamp))
+// Epoch returns the epoch number the timestamp belongs to
+func Epoch(timestamp int64) int64 {
+	return timestamp / epochInterval
+}
+
+// EpochStart returns the first timestamp of the epoch
+func EpochStart(epoch int64) int64 {
+	return epoch * epochInterval
+}
+
+// GetValidators returns the current validator set
+func (d *Dpos) GetValidators() ([]cipher.PubKey, error) {
+	return d.dposContext.GetValidators()
+}
+
+// BlockInterval returns the length of a block slot in seconds
+func BlockInterval() int64 {
+	return blockInterval
+}
+
+// GetValidator returns validator of the block extending parent at the height and timestamp
+func (d *Dpos) GetValidator(parent cipher.SHA256, height uint64, timestamp int64) (cipher.PubKey, error) {
+	return d.SlotValidator(parent, height, PrevSlot(timestamp))
+}
+
+// SlotValidator returns validator of the block extending parent at the height made in the slot
+// starting at slot
+func (d *Dpos) SlotValidator(parent cipher.SHA256, height uint64, slot int64) (cipher.PubKey, error) {
+	epochContext := d.epochContext(parent, height, slot)
+	return epochContext.LookupValidator(slot)
 }
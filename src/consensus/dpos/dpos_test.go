@@ -114,7 +114,106 @@ func TestCheckValidator(t *testing.T) {
 	err = dpos.CheckValidator(block, now)
 	assert.NoError(t, err)
 
-	pubkeyValidator, err := dpos.GetValidator(int64(ts))
+	pubkeyValidator, err := dpos.GetValidator(block.Block.Head.PrevHash, block.Seq(), int64(ts))
 	assert.NoError(t, err)
 	assert.Equal(t, pubkeyValidator, trusts[1])
 }
+
+func TestGetValidatorEpochSeed(t *testing.T) {
+	pubkey := cipher.MustPubKeyFromHex("03cec5e9f78524a4283868b79cf3a2b406bcd7956cd9b4be325e070a1cb1881563")
+	dpos := NewDpos(pubkey)
+	trusts := []cipher.PubKey{}
+	for i := 0; i < 7; i++ {
+		pk, _ := cipher.GenerateKeyPair()
+		trusts = append(trusts, pk)
+	}
+	dpos.SetTrustNode(trusts)
+
+	seeds := map[int64]cipher.SHA256{
+		142: cipher.SumSHA256([]byte("142")),
+		143: cipher.SumSHA256([]byte("143")),
+	}
+	parent := cipher.SumSHA256([]byte("parent"))
+	dpos.SetEpochSeed(func(p cipher.SHA256, epoch int64) (cipher.SHA256, bool) {
+		if p != parent {
+			return cipher.SHA256{}, false
+		}
+		seed, ok := seeds[epoch]
+		return seed, ok
+	})
+
+	// every slot of an epoch resolves from the schedule seeded for that epoch
+	for _, epoch := range []int64{142, 143} {
+		schedule := ShuffleValidators(trusts, seeds[epoch])
+		for slot := int64(0); slot < 10; slot++ {
+			ts := epoch*epochInterval + slot*blockInterval + 5
+			v, err := dpos.GetValidator(parent, 10, ts)
+			assert.NoError(t, err)
+			assert.Equal(t, schedule[slot%int64(len(trusts))], v)
+		}
+	}
+
+	// epochs without seed keep the configured order
+	ts := int64(144*epochInterval + 3*blockInterval + 5)
+	v, err := dpos.GetValidator(parent, 10, ts)
+	assert.NoError(t, err)
+	assert.Equal(t, trusts[3], v)
+
+	// the seed is the one of the branch of the parent
+	ts = int64(142*epochInterval + 3*blockInterval + 5)
+	v, err = dpos.GetValidator(cipher.SumSHA256([]byte("other")), 10, ts)
+	assert.NoError(t, err)
+	assert.Equal(t, trusts[3], v)
+}
+
+func TestGetValidatorAtHeight(t *testing.T) {
+	pubkey := cipher.MustPubKeyFromHex("03cec5e9f78524a4283868b79cf3a2b406bcd7956cd9b4be325e070a1cb1881563")
+	dpos := NewDpos(pubkey)
+	current := []cipher.PubKey{}
+	old := []cipher.PubKey{}
+	for i := 0; i < 3; i++ {
+		pk, _ := cipher.GenerateKeyPair()
+		current = append(current, pk)
+		pk, _ = cipher.GenerateKeyPair()
+		old = append(old, pk)
+	}
+	dpos.SetTrustNode(current)
+	dpos.SetValidatorSetSource(func(height uint64) ([]cipher.PubKey, bool) {
+		if height < 100 {
+			return old, true
+		}
+		return nil, false
+	})
+
+	ts := int64(12345691)
+	v, err := dpos.GetValidator(cipher.SHA256{}, 99, ts)
+	assert.NoError(t, err)
+	assert.Equal(t, old[0], v)
+
+	v, err = dpos.GetValidator(cipher.SHA256{}, 100, ts)
+	assert.NoError(t, err)
+	assert.Equal(t, current[0], v)
+
+	// the slot of the block is the one before its timestamp
+	v, err = dpos.SlotValidator(cipher.SHA256{}, 99, PrevSlot(ts))
+	assert.NoError(t, err)
+	assert.Equal(t, old[0], v)
+	v, err = dpos.SlotValidator(cipher.SHA256{}, 99, PrevSlot(ts)+BlockInterval())
+	assert.NoError(t, err)
+	assert.Equal(t, old[1], v)
+
+	// the next block of the head at height 98 is scheduled from the old set
+	dpos = NewDpos(old[0])
+	dpos.SetTrustNode(current)
+	dpos.SetValidatorSetSource(func(height uint64) ([]cipher.PubKey, bool) {
+		if height < 100 {
+			return old, true
+		}
+		return nil, false
+	})
+	block := oneBlock(uint64(12345678))
+	block.Block.Head.BkSeq = 98
+	assert.NoError(t, dpos.CheckValidator(block, ts))
+	block.Block.Head.BkSeq = 99
+	assert.Equal(t, ErrInvalidBlockValidator, dpos.CheckValidator(block, ts))
+}
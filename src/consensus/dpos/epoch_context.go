@@ -1,6 +1,7 @@
 package dpos
 
 import (
+	"encoding/binary"
 	"errors"
 
 	"github.com/samoslab/samos/src/cipher"
@@ -10,6 +11,8 @@ import (
 type EpochContext struct {
 	DposContext DposContext
 	TimeStamp   int64
+	// Seed shuffles the validator order of the epoch, the zero seed keeps the configured order
+	Seed cipher.SHA256
 }
 
 // NewEpochFromDposContext new instance
@@ -45,6 +48,27 @@ func (ec *EpochContext) LookupValidator(now int64) (validator cipher.PubKey, err
 	if validatorSize == 0 {
 		return cipher.PubKey{}, errors.New("failed to lookup validator")
 	}
+	if ec.Seed != (cipher.SHA256{}) {
+		validators = ShuffleValidators(validators, ec.Seed)
+	}
 	offset %= int64(validatorSize)
 	return validators[offset], nil
 }
+
+// ShuffleValidators returns a copy of the validators in an order derived from the seed,
+// every node computes the same order from the same seed
+func ShuffleValidators(validators []cipher.PubKey, seed cipher.SHA256) []cipher.PubKey {
+	shuffled := make([]cipher.PubKey, len(validators))
+	copy(shuffled, validators)
+
+	// Fisher-Yates, the i-th swap index is taken from sha256(seed, i)
+	b := make([]byte, len(seed)+8)
+	copy(b, seed[:])
+	for i := len(shuffled) - 1; i > 0; i-- {
+		binary.LittleEndian.PutUint64(b[len(seed):], uint64(i))
+		h := cipher.SumSHA256(b)
+		j := binary.LittleEndian.Uint64(h[:8]) % uint64(i+1)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	return shuffled
+}
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/samoslab/samos/src/cipher"
 )
 
 func TestCalSlot(t *testing.T) {
@@ -46,3 +48,58 @@ func TestCalSlot(t *testing.T) {
 		assert.Equal(t, cs.slot, slot)
 	}
 }
+
+func TestShuffleValidators(t *testing.T) {
+	validators := []cipher.PubKey{}
+	for i := 0; i < 21; i++ {
+		pk, _ := cipher.GenerateKeyPair()
+		validators = append(validators, pk)
+	}
+	orig := make([]cipher.PubKey, len(validators))
+	copy(orig, validators)
+
+	seed := cipher.SumSHA256([]byte("seed"))
+	shuffled := ShuffleValidators(validators, seed)
+
+	// input is not modified, output is a permutation
+	assert.Equal(t, orig, validators)
+	assert.NotEqual(t, validators, shuffled)
+	seen := make(map[cipher.PubKey]struct{})
+	for _, pk := range shuffled {
+		seen[pk] = struct{}{}
+	}
+	assert.Len(t, seen, len(validators))
+	for _, pk := range validators {
+		assert.Contains(t, seen, pk)
+	}
+
+	// same seed, same order
+	assert.Equal(t, shuffled, ShuffleValidators(validators, seed))
+
+	// other seed, other order
+	assert.NotEqual(t, shuffled, ShuffleValidators(validators, cipher.SumSHA256([]byte("other"))))
+}
+
+func TestLookupValidatorSeed(t *testing.T) {
+	validators := []cipher.PubKey{}
+	for i := 0; i < 5; i++ {
+		pk, _ := cipher.GenerateKeyPair()
+		validators = append(validators, pk)
+	}
+	dc := NewDposContext()
+	dc.SetValidators(validators)
+
+	seed := cipher.SumSHA256([]byte("seed"))
+	shuffled := ShuffleValidators(validators, seed)
+
+	now := int64(86400*3 + 20)
+	ec := NewEpochFromDposContext(*dc, now)
+	v, err := ec.LookupValidator(now)
+	assert.NoError(t, err)
+	assert.Equal(t, validators[2], v)
+
+	ec.Seed = seed
+	v, err = ec.LookupValidator(now)
+	assert.NoError(t, err)
+	assert.Equal(t, shuffled[2], v)
+}
@@ -0,0 +1,101 @@
+package pbft
+
+import (
+	"errors"
+
+	"github.com/samoslab/samos/src/cipher"
+)
+
+var (
+	prepareTag = cipher.SumSHA256([]byte("pbft prepare"))
+	commitTag  = cipher.SumSHA256([]byte("pbft commit"))
+)
+
+// Quorum returns the number of votes of n validators a phase needs: 2f+1 of n = 3f+1
+// validators, which tolerates f faulty ones. Fewer than 4 validators tolerate none.
+func Quorum(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return n - (n-1)/3
+}
+
+// PrepareHash returns the hash a prepare vote for the block hash signs, the producer signs
+// the block hash itself, so a prepare vote is never taken for a produced block
+func PrepareHash(hash cipher.SHA256) cipher.SHA256 {
+	return cipher.AddSHA256(hash, prepareTag)
+}
+
+// CommitHash returns the hash a commit vote for the block hash signs
+func CommitHash(hash cipher.SHA256) cipher.SHA256 {
+	return cipher.AddSHA256(hash, commitTag)
+}
+
+func containsPubkey(pubkeys []cipher.PubKey, pubkey cipher.PubKey) bool {
+	for _, pk := range pubkeys {
+		if pk == pubkey {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrepared returns true if the block hash has prepare votes of the quorum
+func (p *PBFT) IsPrepared(hash cipher.SHA256, quorum int) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	validators, ok := p.PreparedInfos[hash]
+	return ok && quorum > 0 && len(validators) >= quorum
+}
+
+// AddCommit adds the commit vote of the pubkey for the block hash with its signature
+func (p *PBFT) AddCommit(hash cipher.SHA256, pubkey cipher.PubKey, sig cipher.Sig) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	commits, ok := p.Commits[hash]
+	if !ok {
+		return errors.New("this block hash not added into commits")
+	}
+	if containsPubkey(commits, pubkey) {
+		return errors.New("the pubkey already committed")
+	}
+	p.Commits[hash] = append(commits, pubkey)
+	p.CommitSigs[hash] = append(p.CommitSigs[hash], sig)
+	return nil
+}
+
+// HasCommitted returns true if the pubkey voted to commit the block hash
+func (p *PBFT) HasCommitted(hash cipher.SHA256, pubkey cipher.PubKey) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return containsPubkey(p.Commits[hash], pubkey)
+}
+
+// GetBlockCommitters returns the pubkeys which voted to commit the block hash
+func (p *PBFT) GetBlockCommitters(hash cipher.SHA256) ([]cipher.PubKey, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	commits, ok := p.Commits[hash]
+	if !ok {
+		return []cipher.PubKey{}, errors.New("not exists")
+	}
+	return commits, nil
+}
+
+// GetCommitSigs returns the signatures of the commit votes of the block hash,
+// in the order of GetBlockCommitters
+func (p *PBFT) GetCommitSigs(hash cipher.SHA256) []cipher.Sig {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	sigs := make([]cipher.Sig, len(p.CommitSigs[hash]))
+	copy(sigs, p.CommitSigs[hash])
+	return sigs
+}
+
+// IsCommitted returns true if the block hash has commit votes of the quorum
+func (p *PBFT) IsCommitted(hash cipher.SHA256, quorum int) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	commits, ok := p.Commits[hash]
+	return ok && quorum > 0 && len(commits) >= quorum
+}
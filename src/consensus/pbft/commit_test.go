@@ -0,0 +1,144 @@
+package pbft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+)
+
+func TestQuorum(t *testing.T) {
+	cases := []struct {
+		n      int
+		quorum int
+	}{
+		{0, 0},
+		{1, 1},
+		{2, 2},
+		{3, 3},
+		{4, 3},
+		{5, 4},
+		{7, 5},
+		{10, 7},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.quorum, Quorum(tc.n), "n=%d", tc.n)
+	}
+}
+
+func makeSignedBlock(t *testing.T, sk cipher.SecKey) coin.SignedBlock {
+	block, err := makeNewBlock(cipher.SumSHA256([]byte("abcd1234")))
+	require.NoError(t, err)
+	return coin.SignedBlock{
+		Block: *block,
+		Sig:   cipher.SignHash(block.HashHeader(), sk),
+	}
+}
+
+func TestPrepareCommit(t *testing.T) {
+	p := NewPBFT()
+	pk1, sk1 := cipher.GenerateKeyPair()
+	pk2, sk2 := cipher.GenerateKeyPair()
+	pk3, sk3 := cipher.GenerateKeyPair()
+
+	sb := makeSignedBlock(t, sk1)
+	hash := sb.HashHeader()
+
+	commit1 := cipher.SignHash(CommitHash(hash), sk1)
+	commit3 := cipher.SignHash(CommitHash(hash), sk3)
+	require.Error(t, p.AddCommit(hash, pk1, commit1))
+	require.NoError(t, p.AddSignedBlock(sb))
+	require.False(t, p.IsPrepared(hash, 3))
+	require.Empty(t, p.GetPrepareSigs(hash))
+
+	pk, err := p.AddPrepare(hash, cipher.SignHash(PrepareHash(hash), sk2))
+	require.NoError(t, err)
+	require.Equal(t, pk2, pk)
+	_, err = p.AddPrepare(hash, cipher.SignHash(PrepareHash(hash), sk2))
+	require.Error(t, err)
+	require.False(t, p.IsPrepared(hash, 3))
+	_, err = p.AddPrepare(hash, cipher.SignHash(PrepareHash(hash), sk3))
+	require.NoError(t, err)
+	require.True(t, p.IsPrepared(hash, 3))
+	require.Len(t, p.GetPrepareSigs(hash), 2)
+
+	require.False(t, p.IsCommitted(hash, 2))
+	require.NoError(t, p.AddCommit(hash, pk1, commit1))
+	require.Error(t, p.AddCommit(hash, pk1, commit1))
+	require.True(t, p.HasCommitted(hash, pk1))
+	require.False(t, p.HasCommitted(hash, pk2))
+	require.NoError(t, p.AddCommit(hash, pk3, commit3))
+	require.True(t, p.IsCommitted(hash, 2))
+	require.False(t, p.IsCommitted(hash, 3))
+
+	committers, err := p.GetBlockCommitters(hash)
+	require.NoError(t, err)
+	require.Equal(t, []cipher.PubKey{pk1, pk3}, committers)
+	require.Equal(t, []cipher.Sig{commit1, commit3}, p.GetCommitSigs(hash))
+
+	require.NotEqual(t, hash, PrepareHash(hash))
+	require.NotEqual(t, hash, CommitHash(hash))
+	require.NotEqual(t, PrepareHash(hash), CommitHash(hash))
+
+	require.NoError(t, p.DeleteHash(hash))
+	require.False(t, p.HasCommitted(hash, pk1))
+	require.Empty(t, p.GetPrepareSigs(hash))
+	require.Empty(t, p.GetCommitSigs(hash))
+}
+
+func TestViewChange(t *testing.T) {
+	p := NewPBFT()
+	pk1, sk1 := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	pk3, sk3 := cipher.GenerateKeyPair()
+
+	require.NotEqual(t, ViewChangeHash(1, 1), ViewChangeHash(1, 2))
+	require.NotEqual(t, ViewChangeHash(1, 1), ViewChangeHash(2, 1))
+
+	sb := makeSignedBlock(t, sk1)
+	hash := sb.HashHeader()
+	require.NoError(t, p.AddSignedBlock(sb))
+
+	now := p.BlockTime[hash]
+	require.False(t, p.ViewTimedOut(now+30, 30))
+	require.True(t, p.ViewTimedOut(now+31, 30))
+
+	_, err := p.AddViewChange(0, pk2)
+	require.Error(t, err)
+	votes, err := p.AddViewChange(1, pk2)
+	require.NoError(t, err)
+	require.Equal(t, 1, votes)
+	_, err = p.AddViewChange(1, pk2)
+	require.Error(t, err)
+	votes, err = p.AddViewChange(1, pk3)
+	require.NoError(t, err)
+	require.Equal(t, 2, votes)
+	require.True(t, p.HasViewChange(1, pk3))
+
+	// the block prepared by its producer only is dropped and its producer replaced
+	require.Equal(t, []coin.SignedBlock{sb}, p.StartView(1, 1, 2))
+	require.Equal(t, uint64(1), p.GetView())
+	require.False(t, p.HasViewChange(1, pk3))
+	require.Empty(t, p.WaitingConfirmedBlockHash())
+	require.Equal(t, 0, p.BlockNum)
+	require.True(t, p.IsExcluded(pk1))
+	require.Nil(t, p.StartView(1, 1, 2))
+	require.False(t, p.ViewTimedOut(now+31, 30))
+
+	require.Equal(t, ErrProducerExcluded, p.AddSignedBlock(sb))
+
+	// a block prepared in the earlier view comes back with its prepare votes
+	require.NoError(t, p.AddPreparedBlock(sb, []cipher.Sig{cipher.SignHash(PrepareHash(hash), sk3)}))
+	require.True(t, p.IsPrepared(hash, 2))
+
+	// a prepared block is kept
+	require.Empty(t, p.StartView(1, 2, 2))
+	require.Equal(t, []cipher.SHA256{hash}, p.WaitingConfirmedBlockHash())
+
+	p.ResetView()
+	require.Equal(t, uint64(0), p.GetView())
+	require.False(t, p.IsExcluded(pk1))
+}
@@ -10,14 +10,32 @@ import (
 	"github.com/samoslab/samos/src/util/utc"
 )
 
-// PBFT pending block data
+// PendingBlockTimeout is the seconds a pending block waits for confirmation before it is dropped
+const PendingBlockTimeout = 120
+
+// PBFT pending block data. A pending block goes through three phases: the producer
+// proposes it (pre-prepare), the validators vote to prepare it and once it is prepared
+// by a quorum they vote to commit it. A block committed by a quorum is executed.
 type PBFT struct {
 	Status        int
 	BlockNum      int
+	Window        int // number of heights which may be pending at once, see SetWindow
 	PendingBlocks map[cipher.SHA256]coin.SignedBlock
 	PreparedInfos map[cipher.SHA256][]cipher.PubKey
+	PrepareSigs   map[cipher.SHA256][]cipher.Sig // known signatures of the prepare votes
+	Commits       map[cipher.SHA256][]cipher.PubKey
+	CommitSigs    map[cipher.SHA256][]cipher.Sig // signatures of the commit votes, in the order of Commits
 	BlockTime     map[cipher.SHA256]int64
-	mutex         sync.Mutex
+
+	// view of the height after the head, it moves on when the validators vote
+	// the producer of the current view timed out
+	View        uint64
+	ViewChanges map[uint64][]cipher.PubKey // next views -> validators voting for them
+	Excluded    []cipher.PubKey            // producers replaced by view changes at the height
+	viewStart   int64
+
+	now   func() int64 // clock of the block times and views, see SetClock
+	mutex sync.Mutex
 }
 
 // NewPBFT new pbft
@@ -25,27 +43,60 @@ func NewPBFT() *PBFT {
 	return &PBFT{
 		Status:        0,
 		BlockNum:      0,
+		Window:        1,
 		PendingBlocks: make(map[cipher.SHA256]coin.SignedBlock, 1),
 		BlockTime:     make(map[cipher.SHA256]int64, 1),
 		PreparedInfos: make(map[cipher.SHA256][]cipher.PubKey, 1),
+		PrepareSigs:   make(map[cipher.SHA256][]cipher.Sig, 1),
+		Commits:       make(map[cipher.SHA256][]cipher.PubKey, 1),
+		CommitSigs:    make(map[cipher.SHA256][]cipher.Sig, 1),
+		ViewChanges:   make(map[uint64][]cipher.PubKey),
+		now:           utc.UnixNow,
 	}
 }
 
-// RemoveUnconfirmBlock remove pending block if it unconfirmed in 120 seconds
-func (p *PBFT) RemoveUnconfirmBlock() {
+// SetClock sets the function returning the unix time the pending blocks and views are timed by,
+// it is utc.UnixNow unless a simulation runs on a virtual clock
+func (p *PBFT) SetClock(now func() int64) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
-	now := utc.UnixNow()
-	for hash := range p.PendingBlocks {
+	p.now = now
+}
+
+// Now returns the unix time of the clock
+func (p *PBFT) Now() int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.now()
+}
+
+// deleteBlock removes the pending block and its votes
+func (p *PBFT) deleteBlock(hash cipher.SHA256) {
+	delete(p.PendingBlocks, hash)
+	delete(p.BlockTime, hash)
+	delete(p.PreparedInfos, hash)
+	delete(p.PrepareSigs, hash)
+	delete(p.Commits, hash)
+	delete(p.CommitSigs, hash)
+	p.BlockNum--
+}
+
+// RemoveUnconfirmBlock remove pending block if it unconfirmed in PendingBlockTimeout seconds, the blocks
+// extending it are removed too. Returns the removed blocks.
+func (p *PBFT) RemoveUnconfirmBlock() []coin.SignedBlock {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := p.now()
+	removed := []coin.SignedBlock{}
+	for hash, sb := range p.PendingBlocks {
 		createdTime, _ := p.BlockTime[hash]
-		if now-createdTime > 120 {
-			fmt.Printf("delete block hash %s because it is not confirmed in 120s\n", hash.Hex())
-			delete(p.PendingBlocks, hash)
-			delete(p.BlockTime, hash)
-			delete(p.PreparedInfos, hash)
-			p.BlockNum--
+		if now-createdTime > PendingBlockTimeout {
+			fmt.Printf("delete block hash %s because it is not confirmed in %ds\n", hash.Hex(), PendingBlockTimeout)
+			p.deleteBlock(hash)
+			removed = append(removed, sb)
 		}
 	}
+	return p.dropDescendants(removed)
 }
 
 // GetSignedBlock get SignedBlock for the hash
@@ -78,11 +129,7 @@ func (p *PBFT) DeleteHash(hash cipher.SHA256) error {
 		return errors.New("block hash not exists")
 	}
 
-	delete(p.PendingBlocks, hash)
-	delete(p.PreparedInfos, hash)
-	delete(p.BlockTime, hash)
-	p.BlockNum--
-
+	p.deleteBlock(hash)
 	return nil
 }
 
@@ -97,25 +144,63 @@ func (p *PBFT) WaitingConfirmedBlockHash() []cipher.SHA256 {
 	return watingHash
 }
 
-// AddSignedBlock add a signed block
+// AddSignedBlock add a signed block, the signature of the producer counts as its prepare vote
 func (p *PBFT) AddSignedBlock(sb coin.SignedBlock) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	return p.addBlock(sb, nil, true)
+}
+
+// AddPreparedBlock adds a block prepared in an earlier view with the prepare votes it collected,
+// it is added even if a view change replaced its producer
+func (p *PBFT) AddPreparedBlock(sb coin.SignedBlock, prepares []cipher.Sig) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.addBlock(sb, prepares, false)
+}
+
+func (p *PBFT) addBlock(sb coin.SignedBlock, prepares []cipher.Sig, checkExcluded bool) error {
 	bh := sb.Block.HashHeader()
+	producer, err := cipher.PubKeyFromSig(sb.Sig, bh)
+	if err != nil {
+		return errors.New("Invalid sig: PubKey recovery failed")
+	}
+	if checkExcluded && p.isExcluded(producer) {
+		return ErrProducerExcluded
+	}
 	if _, ok := p.PendingBlocks[bh]; ok {
 		return errors.New("the block has added")
 	}
 
-	if p.BlockNum >= 1 {
-		return errors.New("has unconfirmed block, this block cannot added")
+	if p.BlockNum >= p.Window {
+		return ErrWindowFull
 	}
-	pubkeyRec, err := cipher.PubKeyFromSig(sb.Sig, bh) //recovered pubkey
-	if err != nil {
-		return errors.New("Invalid sig: PubKey recovery failed")
+	for _, pending := range p.PendingBlocks {
+		if pending.Seq() == sb.Seq() {
+			return fmt.Errorf("block %s of height %d is pending", pending.HashHeader().Hex(), sb.Seq())
+		}
 	}
+
+	pubkeys := []cipher.PubKey{producer}
+	sigs := []cipher.Sig{}
+	for _, sig := range prepares {
+		pubkeyRec, err := cipher.PubKeyFromSig(sig, PrepareHash(bh))
+		if err != nil {
+			return errors.New("Invalid sig: PubKey recovery failed")
+		}
+		if containsPubkey(pubkeys, pubkeyRec) {
+			continue
+		}
+		pubkeys = append(pubkeys, pubkeyRec)
+		sigs = append(sigs, sig)
+	}
+
 	p.PendingBlocks[bh] = sb
-	p.PreparedInfos[bh] = []cipher.PubKey{pubkeyRec}
-	p.BlockTime[bh] = utc.UnixNow()
+	p.PreparedInfos[bh] = pubkeys
+	p.PrepareSigs[bh] = sigs
+	p.Commits[bh] = []cipher.PubKey{}
+	p.CommitSigs[bh] = []cipher.Sig{}
+	p.BlockTime[bh] = p.now()
 	p.BlockNum++
 	return nil
 }
@@ -165,6 +250,37 @@ func (p *PBFT) AddValidator(hash cipher.SHA256, pubkey cipher.PubKey) error {
 	return nil
 }
 
+// AddPrepare adds the prepare vote signed for the block hash, returns the pubkey which signed it
+func (p *PBFT) AddPrepare(hash cipher.SHA256, sig cipher.Sig) (cipher.PubKey, error) {
+	pubkey, err := cipher.PubKeyFromSig(sig, PrepareHash(hash))
+	if err != nil {
+		return cipher.PubKey{}, errors.New("Invalid sig: PubKey recovery failed")
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	validators, ok := p.PreparedInfos[hash]
+	if !ok {
+		return cipher.PubKey{}, errors.New("this block hash not added into prepared infos")
+	}
+	if containsPubkey(validators, pubkey) {
+		return cipher.PubKey{}, errors.New("the pubkey already exists")
+	}
+	p.PreparedInfos[hash] = append(validators, pubkey)
+	p.PrepareSigs[hash] = append(p.PrepareSigs[hash], sig)
+	return pubkey, nil
+}
+
+// GetPrepareSigs returns the known prepare signatures of the block hash, the producer is counted
+// by the signature of the block
+func (p *PBFT) GetPrepareSigs(hash cipher.SHA256) []cipher.Sig {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	sigs := make([]cipher.Sig, len(p.PrepareSigs[hash]))
+	copy(sigs, p.PrepareSigs[hash])
+	return sigs
+}
+
 // ValidatorNumber the nunber of validator for the block hash
 func (p *PBFT) ValidatorNumber(hash cipher.SHA256) (int, error) {
 	p.mutex.Lock()
@@ -107,3 +107,25 @@ func TestPbft(t *testing.T) {
 	err = pbft.DeleteHash(hash)
 	assert.Nil(t, err)
 }
+
+func TestRemoveUnconfirmBlock(t *testing.T) {
+	pbft := NewPBFT()
+	seckey := cipher.MustSecKeyFromHex("4f36d5784d96a5b0e29d6876dd4eba422a2d92a29e81c67487fff7c403fa105b")
+
+	block, err := makeNewBlock(cipher.SumSHA256([]byte("abcd1234")))
+	assert.NoError(t, err)
+	sb := coin.SignedBlock{
+		Block: *block,
+		Sig:   cipher.SignHash(block.HashHeader(), seckey),
+	}
+	assert.NoError(t, pbft.AddSignedBlock(sb))
+
+	assert.Empty(t, pbft.RemoveUnconfirmBlock())
+	assert.Equal(t, 1, pbft.BlockNum)
+
+	hash := sb.HashHeader()
+	pbft.BlockTime[hash] -= 121
+	assert.Equal(t, []coin.SignedBlock{sb}, pbft.RemoveUnconfirmBlock())
+	assert.Equal(t, 0, pbft.BlockNum)
+	assert.Empty(t, pbft.WaitingConfirmedBlockHash())
+}
@@ -0,0 +1,150 @@
+package pbft
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+)
+
+var (
+	// ErrWindowFull is returned when the pending block window has no room for another block
+	ErrWindowFull = errors.New("has unconfirmed block, this block cannot added")
+	// ErrUnknownParent is returned for a block which extends neither the head block nor a pending block
+	ErrUnknownParent = errors.New("the parent of the block is neither the head block nor a pending block")
+)
+
+// SetWindow sets the number of blocks which may be pending at once, one after another.
+// Height N+1 is proposed while N collects its votes if it is more than 1.
+func (p *PBFT) SetWindow(n int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if n < 1 {
+		n = 1
+	}
+	p.Window = n
+}
+
+// IsFull returns true if no other block may be pending
+func (p *PBFT) IsFull() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.BlockNum >= p.Window
+}
+
+// CheckParent checks the block extends the head block or the pending block before it,
+// within the window of pending heights after the head
+func (p *PBFT) CheckParent(b coin.SignedBlock, headSeq uint64, headHash cipher.SHA256) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	seq := b.Seq()
+	if seq <= headSeq {
+		return errors.New("pending block seq less than head")
+	}
+	if seq > headSeq+uint64(p.Window) {
+		return fmt.Errorf("block %d is beyond the window of %d pending blocks after head %d", seq, p.Window, headSeq)
+	}
+	if seq == headSeq+1 {
+		if b.Head.PrevHash != headHash {
+			return ErrUnknownParent
+		}
+		return nil
+	}
+	parent, ok := p.PendingBlocks[b.Head.PrevHash]
+	if !ok || parent.Seq()+1 != seq {
+		return ErrUnknownParent
+	}
+	return nil
+}
+
+// GetTip returns the highest pending block, a new block extends it
+func (p *PBFT) GetTip() (coin.SignedBlock, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var tip coin.SignedBlock
+	found := false
+	for _, sb := range p.PendingBlocks {
+		if !found || sb.Seq() > tip.Seq() {
+			tip = sb
+			found = true
+		}
+	}
+	return tip, found
+}
+
+// GetAncestors returns the pending blocks the block of the parent hash extends, the block of the
+// parent hash included, ordered by height. It is empty if the parent is not pending.
+func (p *PBFT) GetAncestors(parent cipher.SHA256) []coin.SignedBlock {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	chain := []coin.SignedBlock{}
+	for {
+		sb, ok := p.PendingBlocks[parent]
+		if !ok {
+			break
+		}
+		chain = append([]coin.SignedBlock{sb}, chain...)
+		parent = sb.Head.PrevHash
+	}
+	return chain
+}
+
+// GetChild returns the hash of the pending block which extends the block of the hash
+func (p *PBFT) GetChild(hash cipher.SHA256) (cipher.SHA256, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for h, sb := range p.PendingBlocks {
+		if sb.Head.PrevHash == hash {
+			return h, true
+		}
+	}
+	return cipher.SHA256{}, false
+}
+
+// PruneExecuted removes the executed block and the pending blocks its execution abandoned:
+// the other blocks at its height or below and the blocks extending them. The abandoned
+// blocks are returned ordered by height.
+func (p *PBFT) PruneExecuted(seq uint64, hash cipher.SHA256) []coin.SignedBlock {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, ok := p.PendingBlocks[hash]; ok {
+		p.deleteBlock(hash)
+	}
+
+	dropped := []coin.SignedBlock{}
+	for h, sb := range p.PendingBlocks {
+		if sb.Seq() <= seq || (sb.Seq() == seq+1 && sb.Head.PrevHash != hash) {
+			p.deleteBlock(h)
+			dropped = append(dropped, sb)
+		}
+	}
+	return p.dropDescendants(dropped)
+}
+
+// dropDescendants removes the pending blocks extending the removed blocks, returns the removed
+// blocks and their descendants ordered by height
+func (p *PBFT) dropDescendants(removed []coin.SignedBlock) []coin.SignedBlock {
+	gone := make(map[cipher.SHA256]struct{}, len(removed))
+	for _, sb := range removed {
+		gone[sb.HashHeader()] = struct{}{}
+	}
+
+	for found := true; found; {
+		found = false
+		for h, sb := range p.PendingBlocks {
+			if _, ok := gone[sb.Head.PrevHash]; ok {
+				p.deleteBlock(h)
+				gone[h] = struct{}{}
+				removed = append(removed, sb)
+				found = true
+			}
+		}
+	}
+
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].Seq() < removed[j].Seq()
+	})
+	return removed
+}
@@ -0,0 +1,122 @@
+package pbft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+)
+
+func makeChildBlock(parent coin.Block, dt uint64, sk cipher.SecKey) coin.SignedBlock {
+	b := coin.NewEmptyBlock(parent, parent.Time()+dt, cipher.SHA256{})
+	return coin.SignedBlock{Block: *b, Sig: cipher.SignHash(b.HashHeader(), sk)}
+}
+
+func TestPipelineWindow(t *testing.T) {
+	_, sk := cipher.GenerateKeyPair()
+	head := coin.Block{Head: coin.BlockHeader{Time: 100}}
+	headHash := head.HashHeader()
+
+	b1 := makeChildBlock(head, 10, sk)
+	b2 := makeChildBlock(b1.Block, 10, sk)
+	b3 := makeChildBlock(b2.Block, 10, sk)
+	other := makeChildBlock(head, 20, sk)
+
+	p := NewPBFT()
+	require.Equal(t, 1, p.Window)
+	require.NoError(t, p.CheckParent(b1, 0, headHash))
+	require.NoError(t, p.AddSignedBlock(b1))
+	require.True(t, p.IsFull())
+	requireError := func(err error, msg string) {
+		require.Error(t, err)
+		require.Equal(t, msg, err.Error())
+	}
+	requireError(p.CheckParent(b2, 0, headHash), "block 2 is beyond the window of 1 pending blocks after head 0")
+	require.Equal(t, ErrWindowFull, p.AddSignedBlock(b2))
+
+	p.SetWindow(3)
+	require.False(t, p.IsFull())
+	require.NoError(t, p.CheckParent(b2, 0, headHash))
+	require.Equal(t, ErrUnknownParent, p.CheckParent(b3, 0, headHash))
+	require.NoError(t, p.AddSignedBlock(b2))
+	require.NoError(t, p.CheckParent(b3, 0, headHash))
+	require.NoError(t, p.AddSignedBlock(b3))
+	require.True(t, p.IsFull())
+
+	requireError(p.CheckParent(b1, 1, b1.HashHeader()), "pending block seq less than head")
+	require.Equal(t, ErrUnknownParent, p.CheckParent(b1, 0, cipher.SumSHA256([]byte("other head"))))
+
+	// one block per height
+	p.SetWindow(4)
+	requireError(p.AddSignedBlock(other), "block "+b1.HashHeader().Hex()+" of height 1 is pending")
+
+	tip, ok := p.GetTip()
+	require.True(t, ok)
+	require.Equal(t, b3, tip)
+	require.Equal(t, []coin.SignedBlock{b1, b2, b3}, p.GetAncestors(b3.HashHeader()))
+	require.Equal(t, []coin.SignedBlock{b1}, p.GetAncestors(b1.HashHeader()))
+	require.Empty(t, p.GetAncestors(headHash))
+
+	child, ok := p.GetChild(b1.HashHeader())
+	require.True(t, ok)
+	require.Equal(t, b2.HashHeader(), child)
+	_, ok = p.GetChild(b3.HashHeader())
+	require.False(t, ok)
+
+	// executing the first block keeps the blocks extending it
+	require.Empty(t, p.PruneExecuted(1, b1.HashHeader()))
+	require.Equal(t, 2, p.BlockNum)
+	tip, ok = p.GetTip()
+	require.True(t, ok)
+	require.Equal(t, b3, tip)
+}
+
+func TestPipelinePrune(t *testing.T) {
+	_, sk := cipher.GenerateKeyPair()
+	head := coin.Block{Head: coin.BlockHeader{Time: 100}}
+
+	b1 := makeChildBlock(head, 10, sk)
+	b2 := makeChildBlock(b1.Block, 10, sk)
+	b3 := makeChildBlock(b2.Block, 10, sk)
+	other := makeChildBlock(head, 20, sk)
+
+	newPBFT := func() *PBFT {
+		p := NewPBFT()
+		p.SetWindow(3)
+		require.NoError(t, p.AddSignedBlock(b1))
+		require.NoError(t, p.AddSignedBlock(b2))
+		require.NoError(t, p.AddSignedBlock(b3))
+		return p
+	}
+
+	// another block of the height was executed, the pending chain is abandoned
+	p := newPBFT()
+	require.Equal(t, []coin.SignedBlock{b1, b2, b3}, p.PruneExecuted(1, other.HashHeader()))
+	require.Equal(t, 0, p.BlockNum)
+	_, ok := p.GetTip()
+	require.False(t, ok)
+
+	// the blocks extending a timed out block are removed with it
+	p = newPBFT()
+	p.BlockTime[b2.HashHeader()] -= PendingBlockTimeout + 1
+	require.Equal(t, []coin.SignedBlock{b2, b3}, p.RemoveUnconfirmBlock())
+	require.Equal(t, []cipher.SHA256{b1.HashHeader()}, p.WaitingConfirmedBlockHash())
+
+	// a view change drops the unprepared block of its height and the blocks extending it
+	p = newPBFT()
+	require.Equal(t, []coin.SignedBlock{b2, b3}, p.StartView(2, 1, 2))
+	require.Equal(t, []cipher.SHA256{b1.HashHeader()}, p.WaitingConfirmedBlockHash())
+	p = newPBFT()
+	require.Equal(t, []coin.SignedBlock{b1, b2, b3}, p.StartView(1, 1, 2))
+	require.Equal(t, 0, p.BlockNum)
+
+	// a prepared block is kept
+	_, sk2 := cipher.GenerateKeyPair()
+	p = newPBFT()
+	_, err := p.AddPrepare(b1.HashHeader(), cipher.SignHash(PrepareHash(b1.HashHeader()), sk2))
+	require.NoError(t, err)
+	require.Empty(t, p.StartView(1, 1, 2))
+	require.Equal(t, 3, p.BlockNum)
+}
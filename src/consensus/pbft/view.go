@@ -0,0 +1,125 @@
+package pbft
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+)
+
+// ErrProducerExcluded is returned for a block of a producer a view change replaced
+var ErrProducerExcluded = errors.New("the producer was replaced by a view change")
+
+// ViewChangeHash returns the hash a vote to move to the view at the block height signs
+func ViewChangeHash(seq, view uint64) cipher.SHA256 {
+	b := []byte("pbft view change")
+	var n [8]byte
+	binary.LittleEndian.PutUint64(n[:], seq)
+	b = append(b, n[:]...)
+	binary.LittleEndian.PutUint64(n[:], view)
+	b = append(b, n[:]...)
+	return cipher.SumSHA256(b)
+}
+
+// GetView returns the current view
+func (p *PBFT) GetView() uint64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.View
+}
+
+// ViewTimedOut returns true if a pending block waited more than timeout seconds
+// in the current view without being committed
+func (p *PBFT) ViewTimedOut(now, timeout int64) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for hash := range p.PendingBlocks {
+		start := p.BlockTime[hash]
+		if p.viewStart > start {
+			start = p.viewStart
+		}
+		if now-start > timeout {
+			return true
+		}
+	}
+	return false
+}
+
+// AddViewChange adds the vote of the pubkey to move to the view, returns the number of votes
+// for it. Only views after the current one are voted for.
+func (p *PBFT) AddViewChange(view uint64, pubkey cipher.PubKey) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if view <= p.View {
+		return 0, errors.New("the view is not after the current view")
+	}
+	votes := p.ViewChanges[view]
+	if containsPubkey(votes, pubkey) {
+		return len(votes), errors.New("the pubkey already voted for the view")
+	}
+	votes = append(votes, pubkey)
+	p.ViewChanges[view] = votes
+	return len(votes), nil
+}
+
+// HasViewChange returns true if the pubkey voted to move to the view
+func (p *PBFT) HasViewChange(view uint64, pubkey cipher.PubKey) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return containsPubkey(p.ViewChanges[view], pubkey)
+}
+
+// StartView moves to the view of the height seq. The pending block of the height not prepared by
+// the quorum is dropped with the blocks extending it, its producer may not propose another block
+// at the height. The dropped blocks are returned. A prepared block is kept, it may have been
+// committed by other validators.
+func (p *PBFT) StartView(seq, view uint64, quorum int) []coin.SignedBlock {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if view <= p.View {
+		return nil
+	}
+
+	p.View = view
+	p.viewStart = p.now()
+	for v := range p.ViewChanges {
+		if v <= view {
+			delete(p.ViewChanges, v)
+		}
+	}
+
+	dropped := []coin.SignedBlock{}
+	for hash, sb := range p.PendingBlocks {
+		if sb.Seq() != seq || len(p.PreparedInfos[hash]) >= quorum {
+			continue
+		}
+		if producer, err := cipher.PubKeyFromSig(sb.Sig, hash); err == nil && !containsPubkey(p.Excluded, producer) {
+			p.Excluded = append(p.Excluded, producer)
+		}
+		p.deleteBlock(hash)
+		dropped = append(dropped, sb)
+	}
+	return p.dropDescendants(dropped)
+}
+
+// ResetView starts the first view of the next height, called when the head block changed
+func (p *PBFT) ResetView() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.View = 0
+	p.ViewChanges = make(map[uint64][]cipher.PubKey)
+	p.Excluded = nil
+	p.viewStart = p.now()
+}
+
+// IsExcluded returns true if a view change replaced the producer at the height
+func (p *PBFT) IsExcluded(pubkey cipher.PubKey) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.isExcluded(pubkey)
+}
+
+func (p *PBFT) isExcluded(pubkey cipher.PubKey) bool {
+	return containsPubkey(p.Excluded, pubkey)
+}
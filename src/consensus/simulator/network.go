@@ -0,0 +1,225 @@
+package simulator
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+// The messages mirror the daemon messages of the consensus
+
+// prePrepareMsg is daemon.PrePrepareMessage, a pending block and the prepare votes it collected
+// in an earlier view
+type prePrepareMsg struct {
+	view     uint64
+	block    coin.SignedBlock
+	prepares []cipher.Sig
+}
+
+// prepareMsg is daemon.GivePrepareMessage
+type prepareMsg struct {
+	hash cipher.SHA256
+	sig  cipher.Sig
+}
+
+// commitMsg is daemon.CommitMessage
+type commitMsg struct {
+	hash cipher.SHA256
+	sig  cipher.Sig
+}
+
+// viewChangeMsg is daemon.ViewChangeMessage
+type viewChangeMsg struct {
+	seq  uint64
+	view uint64
+	sig  cipher.Sig
+}
+
+// giveBlocksMsg is daemon.GiveBlocksMessage, executed blocks with their quorum certificates
+type giveBlocksMsg struct {
+	blocks []coin.SignedBlock
+	certs  []blockdb.QuorumCert
+}
+
+// getBlocksMsg is daemon.GetBlocksMessage
+type getBlocksMsg struct {
+	lastBlock uint64
+}
+
+// envelope is a message on the way from a node to another
+type envelope struct {
+	from, to int
+	due      time.Duration
+	seq      uint64 // send order, it breaks the ties of due
+	msg      interface{}
+}
+
+// queue of the messages in the network ordered by due time, implements heap.Interface
+type queue []*envelope
+
+func (q queue) Len() int {
+	return len(q)
+}
+
+func (q queue) Less(i, j int) bool {
+	if q[i].due != q[j].due {
+		return q[i].due < q[j].due
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q queue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *queue) Push(x interface{}) {
+	*q = append(*q, x.(*envelope))
+}
+
+func (q *queue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	*q = old[:n-1]
+	return e
+}
+
+// Window is a span of the simulated time, the offsets are from the start of the simulation
+type Window struct {
+	From  time.Duration
+	Until time.Duration
+}
+
+// Forever is the window of the whole simulation
+var Forever = Window{From: 0, Until: time.Duration(1<<63 - 1)}
+
+func (w Window) contains(t time.Duration) bool {
+	return t >= w.From && t < w.Until
+}
+
+type faultKind int
+
+const (
+	faultCrash faultKind = iota
+	faultPartition
+	faultDrop
+	faultDelay
+	faultEquivocate
+)
+
+// fault is a scripted fault, from and to are -1 for any node
+type fault struct {
+	kind   faultKind
+	window Window
+	node   int
+	from   int
+	to     int
+	groups [][]int
+	rate   float64
+	delay  time.Duration
+}
+
+func matchNode(want, node int) bool {
+	return want < 0 || want == node
+}
+
+// group returns the index of the group of the partition the node is in, -1 if it is in none
+func (f fault) group(node int) int {
+	for i, g := range f.groups {
+		for _, n := range g {
+			if n == node {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Crash stops the node in the window, it neither produces blocks nor receives messages.
+// It keeps its database and pending blocks and catches up once the window is over.
+func (s *Simulator) Crash(node int, w Window) {
+	s.faults = append(s.faults, fault{kind: faultCrash, node: node, window: w})
+}
+
+// Partition splits the network into the groups in the window, the messages between
+// the groups are lost. Nodes in no group are cut off from every group.
+func (s *Simulator) Partition(w Window, groups ...[]int) {
+	s.faults = append(s.faults, fault{kind: faultPartition, groups: groups, window: w})
+}
+
+// Drop loses the messages sent from a node to another in the window at the rate between 0 and 1,
+// from and to are -1 for any node
+func (s *Simulator) Drop(from, to int, rate float64, w Window) {
+	s.faults = append(s.faults, fault{kind: faultDrop, from: from, to: to, rate: rate, window: w})
+}
+
+// Delay delays the messages sent from a node to another in the window,
+// from and to are -1 for any node
+func (s *Simulator) Delay(from, to int, delay time.Duration, w Window) {
+	s.faults = append(s.faults, fault{kind: faultDelay, from: from, to: to, delay: delay, window: w})
+}
+
+// Equivocate makes the node propose two conflicting blocks in its slots in the window,
+// the odd nodes receive the conflicting block before the one the producer keeps pending
+func (s *Simulator) Equivocate(node int, w Window) {
+	s.faults = append(s.faults, fault{kind: faultEquivocate, node: node, window: w})
+}
+
+// isFaulty returns true if a fault of the kind affects the node now
+func (s *Simulator) isFaulty(kind faultKind, node int) bool {
+	for _, f := range s.faults {
+		if f.kind == kind && f.node == node && f.window.contains(s.now) {
+			return true
+		}
+	}
+	return false
+}
+
+// send queues the message from a node to another unless a fault loses it
+func (s *Simulator) send(from, to int, msg interface{}) {
+	if from == to || s.isFaulty(faultCrash, from) {
+		return
+	}
+
+	delay := s.cfg.Latency
+	for _, f := range s.faults {
+		if !f.window.contains(s.now) {
+			continue
+		}
+		switch f.kind {
+		case faultPartition:
+			if g := f.group(from); g < 0 || g != f.group(to) {
+				s.stats.Dropped++
+				return
+			}
+		case faultDrop:
+			if matchNode(f.from, from) && matchNode(f.to, to) && s.rand.Float64() < f.rate {
+				s.stats.Dropped++
+				return
+			}
+		case faultDelay:
+			if matchNode(f.from, from) && matchNode(f.to, to) {
+				delay += f.delay
+			}
+		}
+	}
+
+	s.sent++
+	heap.Push(&s.queue, &envelope{
+		from: from,
+		to:   to,
+		due:  s.now + delay,
+		seq:  s.sent,
+		msg:  msg,
+	})
+}
+
+// broadcast sends the message to all other nodes
+func (s *Simulator) broadcast(from int, msg interface{}) {
+	for to := range s.nodes {
+		s.send(from, to, msg)
+	}
+}
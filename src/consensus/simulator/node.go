@@ -0,0 +1,172 @@
+package simulator
+
+import (
+	"fmt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/daemon"
+	"github.com/samoslab/samos/src/visor"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+// blocksResponseCount is the number of blocks a node sends for a getBlocksMsg
+const blocksResponseCount = 20
+
+// node is a validator of the simulation, it runs the consensus handlers of the daemon and
+// sends their messages over the network of the simulation
+type node struct {
+	index     int
+	sim       *Simulator
+	v         *visor.Visor
+	consensus *daemon.Consensus
+}
+
+// tick runs the block creation loop of the daemon once
+func (n *node) tick(now int64) {
+	n.v.RemoveUnconfirmBlock()
+	n.consensus.RequestViewChange(n.sim.cfg.ViewChangeTimeout)
+
+	should, err := n.v.InTurnTheNode(now)
+	if err != nil || !should || n.v.PendingWindowFull() {
+		return
+	}
+	n.propose(now)
+}
+
+// propose creates a block and sends it to the network, see daemon.Visor.CreateAndPublishBlock
+func (n *node) propose(now int64) {
+	sb, err := n.v.CreateBlock(uint64(now))
+	if err != nil {
+		return
+	}
+	b := sb.ToSignedBlock()
+
+	// the conflicting block is created before the first one is pending, so both extend the same parent
+	var conflict *coin.SignedBlock
+	if n.sim.isFaulty(faultEquivocate, n.index) {
+		if other, err := n.v.CreateBlock(uint64(now) + 1); err == nil {
+			ob := other.ToSignedBlock()
+			conflict = &ob
+		}
+	}
+
+	if err := n.v.AddPendingBlock(b); err != nil {
+		return
+	}
+	n.sim.stats.Proposed++
+
+	// the odd nodes get the conflicting block first, so they hold it pending and detect the equivocation
+	view := n.v.GetView()
+	for to := range n.sim.nodes {
+		if conflict != nil && to%2 == 1 {
+			n.sim.send(n.index, to, prePrepareMsg{view: view, block: *conflict})
+		}
+		n.sim.send(n.index, to, prePrepareMsg{view: view, block: b})
+	}
+
+	n.consensus.ExecuteCommittedBlock(b.HashHeader())
+}
+
+// receive processes a message from another node
+func (n *node) receive(from int, msg interface{}) {
+	switch m := msg.(type) {
+	case prePrepareMsg:
+		n.onPrePrepare(from, m)
+	case prepareMsg:
+		n.consensus.ProcessPrepare(m.hash, m.sig)
+	case commitMsg:
+		n.consensus.ProcessCommit(m.hash, m.sig)
+	case viewChangeMsg:
+		n.consensus.ProcessViewChange(m.seq, m.view, m.sig)
+	case giveBlocksMsg:
+		n.onGiveBlocks(from, m)
+	case getBlocksMsg:
+		n.onGetBlocks(from, m)
+	}
+}
+
+// onPrePrepare processes the pre-prepare as the daemon does, a node missing the parent
+// of the block requests the blocks it missed from the sender
+func (n *node) onPrePrepare(from int, m prePrepareMsg) {
+	head := n.v.HeadBkSeq()
+	err := n.consensus.ProcessPrePrepare(fmt.Sprintf("node %d", from), m.view, m.block, m.prepares)
+	if err != nil && m.block.Seq() > head+1 {
+		n.sim.send(n.index, from, getBlocksMsg{lastBlock: head})
+	}
+}
+
+// BroadcastPrePrepare implements daemon.ConsensusNetwork
+func (n *node) BroadcastPrePrepare(view uint64, b coin.SignedBlock, prepares []cipher.Sig) error {
+	n.sim.broadcast(n.index, prePrepareMsg{view: view, block: b, prepares: prepares})
+	return nil
+}
+
+// BroadcastPrepare implements daemon.ConsensusNetwork
+func (n *node) BroadcastPrepare(hash cipher.SHA256, sig cipher.Sig) error {
+	n.sim.broadcast(n.index, prepareMsg{hash: hash, sig: sig})
+	return nil
+}
+
+// BroadcastCommit implements daemon.ConsensusNetwork
+func (n *node) BroadcastCommit(hash cipher.SHA256, sig cipher.Sig) error {
+	n.sim.broadcast(n.index, commitMsg{hash: hash, sig: sig})
+	return nil
+}
+
+// BroadcastViewChange implements daemon.ConsensusNetwork
+func (n *node) BroadcastViewChange(seq, view uint64, sig cipher.Sig) error {
+	n.sim.broadcast(n.index, viewChangeMsg{seq: seq, view: view, sig: sig})
+	return nil
+}
+
+// BroadcastBlocks implements daemon.ConsensusNetwork
+func (n *node) BroadcastBlocks(blocks []coin.SignedBlock, certs []blockdb.QuorumCert) error {
+	n.sim.broadcast(n.index, giveBlocksMsg{blocks: blocks, certs: certs})
+	return nil
+}
+
+// BroadcastEvidences implements daemon.ConsensusNetwork, the evidences are only counted,
+// every node detects the equivocations it receives
+func (n *node) BroadcastEvidences(evidences []blockdb.Evidence) error {
+	n.sim.stats.Evidences += uint64(len(evidences))
+	return nil
+}
+
+// onGiveBlocks follows daemon.GiveBlocksMessage.Process, the sender is asked for more
+// blocks if some were executed or the first block is ahead of the head
+func (n *node) onGiveBlocks(from int, m giveBlocksMsg) {
+	certs := make(map[cipher.SHA256]*blockdb.QuorumCert, len(m.certs))
+	for i := range m.certs {
+		certs[m.certs[i].Hash] = &m.certs[i]
+	}
+
+	head := n.v.HeadBkSeq()
+	processed := 0
+	for _, b := range m.blocks {
+		if b.Seq() <= n.v.HeadBkSeq() {
+			continue
+		}
+		if err := n.v.ExecuteSignedBlock(b, certs[b.HashHeader()]); err != nil {
+			break
+		}
+		processed++
+	}
+
+	if processed > 0 || (len(m.blocks) > 0 && m.blocks[0].Seq() > head+1) {
+		n.sim.send(n.index, from, getBlocksMsg{lastBlock: n.v.HeadBkSeq()})
+	}
+}
+
+// onGetBlocks follows daemon.GetBlocksMessage.Process
+func (n *node) onGetBlocks(from int, m getBlocksMsg) {
+	blocks, err := n.v.GetSignedBlocksSince(m.lastBlock, blocksResponseCount)
+	if err != nil || len(blocks) == 0 {
+		return
+	}
+	certs, err := n.v.GetQuorumCerts(blocks)
+	if err != nil {
+		return
+	}
+	n.sim.send(n.index, from, giveBlocksMsg{blocks: blocks, certs: certs})
+}
@@ -0,0 +1,287 @@
+// Package simulator runs validators in process through the consensus handlers of the daemon and
+// the visor consensus paths, the DPOS schedule, the PBFT phases and the pending blocks, over a
+// virtual network on a virtual clock.
+// Crashes, lost and delayed messages, partitions and equivocating producers are scripted
+// to check a consensus change keeps the finalized blocks consistent and the chain growing.
+package simulator
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/daemon"
+	"github.com/samoslab/samos/src/visor"
+)
+
+const genesisCoinVolume = 300e12
+
+// Config configures a simulation
+type Config struct {
+	// Number of validators
+	Validators int
+	// Consensus engine of the validators, see visor.Config.ConsensusEngine
+	Engine string
+	// Number of blocks which may be pending at once, see visor.Config.PendingBlockWindow
+	PendingBlockWindow int
+	// Unix time of the genesis block, the simulation starts at it
+	Start int64
+	// Time a message takes from a node to another
+	Latency time.Duration
+	// Time a pending block waits to be committed before the validators vote for a view change
+	ViewChangeTimeout time.Duration
+	// Seed of the validator keys and of the lost messages
+	Seed int64
+}
+
+// NewConfig returns the configuration of a simulation of the validators
+func NewConfig(validators int) Config {
+	return Config{
+		Validators:         validators,
+		Engine:             visor.ConsensusDposPbft,
+		PendingBlockWindow: 1,
+		Start:              1500000000,
+		Latency:            100 * time.Millisecond,
+		ViewChangeTimeout:  30 * time.Second,
+		Seed:               1,
+	}
+}
+
+// Stats counts the events of a simulation
+type Stats struct {
+	Sent      uint64 // messages sent
+	Dropped   uint64 // messages lost by faults
+	Proposed  uint64 // blocks proposed by their producers
+	Evidences uint64 // equivocations detected by the nodes
+}
+
+// Simulator runs the validators
+type Simulator struct {
+	cfg    Config
+	dir    string
+	nodes  []*node
+	now    time.Duration // since Config.Start
+	queue  queue
+	sent   uint64
+	faults []fault
+	rand   *rand.Rand
+	stats  Stats
+}
+
+// NewSimulator creates the validators of the configuration with their databases in a temporary
+// directory, node 0 creates the genesis block. Close removes the directory.
+func NewSimulator(cfg Config) (*Simulator, error) {
+	if cfg.Validators < 1 {
+		return nil, errors.New("a simulation needs at least one validator")
+	}
+
+	dir, err := ioutil.TempDir("", "samos-simulator")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Simulator{
+		cfg:  cfg,
+		dir:  dir,
+		rand: rand.New(rand.NewSource(cfg.Seed)),
+	}
+
+	pks := make([]cipher.PubKey, cfg.Validators)
+	sks := make([]cipher.SecKey, cfg.Validators)
+	for i := range pks {
+		pks[i], sks[i] = cipher.GenerateDeterministicKeyPair([]byte(fmt.Sprintf("validator %d %d", cfg.Seed, i)))
+	}
+
+	genesis, err := coin.NewGenesisBlock(cipher.AddressFromPubKey(pks[0]), genesisCoinVolume, uint64(cfg.Start))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	genesisSig := cipher.SignHash(genesis.HashHeader(), sks[0])
+
+	for i := range pks {
+		if err := s.addNode(i, pks, sks, genesisSig); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// addNode creates the visor of the validator i
+func (s *Simulator) addNode(i int, pks []cipher.PubKey, sks []cipher.SecKey, genesisSig cipher.Sig) error {
+	c := visor.NewVisorConfig()
+	c.IsMaster = true
+	c.ConsensusEngine = s.cfg.Engine
+	c.PendingBlockWindow = s.cfg.PendingBlockWindow
+	c.BlockchainPubkey = pks[0]
+	c.BlockchainTrustPubkey = pks[i]
+	c.BlockchainTrustSeckey = sks[i]
+	c.TrustPubkeyList = pks
+	c.AgreeNum = pbft.Quorum(len(pks))
+	c.GenesisAddress = cipher.AddressFromPubKey(pks[0])
+	c.GenesisTimestamp = uint64(s.cfg.Start)
+	c.GenesisCoinVolume = genesisCoinVolume
+	c.GenesisSignature = genesisSig
+	c.EmptyBlocks = true
+	// SignStatePath is not set, an equivocating node signs conflicting blocks
+	c.DBPath = filepath.Join(s.dir, fmt.Sprintf("node%d.db", i))
+	if i == 0 {
+		c.BlockchainSeckey = sks[0]
+	}
+
+	db, err := visor.OpenDB(c.DBPath, false)
+	if err != nil {
+		return err
+	}
+	v, err := visor.NewVisor(c, db)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	v.SetClock(s.unixNow)
+
+	if err := v.Init(); err != nil {
+		db.Close()
+		return err
+	}
+	// the other nodes receive the trust nodes of the genesis node from the network
+	if !v.IsGenesisNode() {
+		if err := v.InsertTrustPubkeyList(pks); err != nil {
+			db.Close()
+			return err
+		}
+		if err := v.InsertAgreeNodeNum(c.AgreeNum); err != nil {
+			db.Close()
+			return err
+		}
+	}
+	go v.ParseBlocks()
+
+	n := &node{index: i, sim: s, v: v}
+	n.consensus = daemon.NewConsensus(v, n)
+	s.nodes = append(s.nodes, n)
+	return nil
+}
+
+// Close shuts the validators down and removes their databases
+func (s *Simulator) Close() {
+	for _, n := range s.nodes {
+		n.v.Shutdown()
+	}
+	os.RemoveAll(s.dir)
+}
+
+// unixNow is the virtual clock of the validators
+func (s *Simulator) unixNow() int64 {
+	return s.cfg.Start + int64(s.now/time.Second)
+}
+
+// Now returns the simulated time since the start
+func (s *Simulator) Now() time.Duration {
+	return s.now
+}
+
+// Stats returns the event counts
+func (s *Simulator) Stats() Stats {
+	s.stats.Sent = s.sent
+	return s.stats
+}
+
+// Visor returns the visor of the node, to inspect it or script a scenario
+func (s *Simulator) Visor(node int) *visor.Visor {
+	return s.nodes[node].v
+}
+
+// Run simulates the duration. The messages are delivered in the order they are due, every
+// second of the simulated time the nodes run their block creation loop in the order of
+// their index. A run is repeated exactly with the same configuration and faults.
+func (s *Simulator) Run(d time.Duration) {
+	end := s.now + d
+	for {
+		tick := (s.now/time.Second + 1) * time.Second
+		if tick > end {
+			break
+		}
+
+		for len(s.queue) > 0 && s.queue[0].due < tick {
+			e := heap.Pop(&s.queue).(*envelope)
+			s.now = e.due
+			if !s.isFaulty(faultCrash, e.to) {
+				s.nodes[e.to].receive(e.from, e.msg)
+			}
+		}
+
+		s.now = tick
+		for _, n := range s.nodes {
+			if !s.isFaulty(faultCrash, n.index) {
+				n.tick(s.unixNow())
+			}
+		}
+	}
+	s.now = end
+}
+
+// Heights returns the head block height of the nodes
+func (s *Simulator) Heights() []uint64 {
+	heights := make([]uint64, len(s.nodes))
+	for i, n := range s.nodes {
+		heights[i] = n.v.HeadBkSeq()
+	}
+	return heights
+}
+
+// CheckSafety returns an error if two nodes executed different blocks at a height
+func (s *Simulator) CheckSafety() error {
+	var maxHeight uint64
+	for _, h := range s.Heights() {
+		if h > maxHeight {
+			maxHeight = h
+		}
+	}
+
+	for seq := uint64(1); seq <= maxHeight; seq++ {
+		var first *coin.SignedBlock
+		firstNode := 0
+		for _, n := range s.nodes {
+			b, err := n.v.GetBlockBySeq(seq)
+			if err != nil {
+				return err
+			}
+			if b == nil {
+				continue
+			}
+			if first == nil {
+				first = b
+				firstNode = n.index
+				continue
+			}
+			if b.HashHeader() != first.HashHeader() {
+				return fmt.Errorf("nodes %d and %d executed blocks %s and %s at height %d",
+					firstNode, n.index, first.HashHeader().Hex(), b.HashHeader().Hex(), seq)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckLiveness returns an error if a node which is not crashed now is below the height
+func (s *Simulator) CheckLiveness(height uint64) error {
+	for _, n := range s.nodes {
+		if s.isFaulty(faultCrash, n.index) {
+			continue
+		}
+		if h := n.v.HeadBkSeq(); h < height {
+			return fmt.Errorf("node %d is at height %d, below %d", n.index, h, height)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/visor"
+)
+
+func newTestSimulator(t *testing.T, cfg Config) *Simulator {
+	s, err := NewSimulator(cfg)
+	require.NoError(t, err)
+	return s
+}
+
+// chainDigests returns a digest of the blocks of every node. The signatures are random, the
+// digest has the times and the transactions of the blocks but not the signatures evidence
+// transactions carry.
+func chainDigests(t *testing.T, s *Simulator) []cipher.SHA256 {
+	digests := make([]cipher.SHA256, len(s.nodes))
+	for i := range s.nodes {
+		head, err := s.Visor(i).GetHeadBlock()
+		require.NoError(t, err)
+		for seq := uint64(1); seq <= head.Seq(); seq++ {
+			b, err := s.Visor(i).GetBlockBySeq(seq)
+			require.NoError(t, err)
+			digests[i] = cipher.AddSHA256(digests[i], cipher.SumSHA256(encoder.SerializeAtomic(b.Time())))
+			for _, txn := range b.Body.Transactions {
+				h := txn.Hash()
+				if txn.Type == coin.TxTypeEvidence {
+					headers, _, err := txn.EvidenceHeaders()
+					require.NoError(t, err)
+					h = cipher.AddSHA256(headers[0].Hash(), headers[1].Hash())
+				}
+				digests[i] = cipher.AddSHA256(digests[i], h)
+			}
+		}
+	}
+	return digests
+}
+
+func TestSimulatorHonest(t *testing.T) {
+	s := newTestSimulator(t, NewConfig(4))
+	defer s.Close()
+
+	s.Run(5 * time.Minute)
+	require.NoError(t, s.CheckSafety())
+	require.NoError(t, s.CheckLiveness(25))
+	require.Zero(t, s.Stats().Dropped)
+	require.Zero(t, s.Stats().Evidences)
+}
+
+func TestSimulatorDeterministic(t *testing.T) {
+	cfg := NewConfig(4)
+	run := func() ([]uint64, []cipher.SHA256, Stats) {
+		s := newTestSimulator(t, cfg)
+		defer s.Close()
+		s.Drop(-1, -1, 0.2, Forever)
+		s.Crash(3, Window{From: time.Minute, Until: 2 * time.Minute})
+		s.Run(4 * time.Minute)
+		return s.Heights(), chainDigests(t, s), s.Stats()
+	}
+
+	heights, hashes, stats := run()
+	heights2, hashes2, stats2 := run()
+	require.Equal(t, heights, heights2)
+	require.Equal(t, hashes, hashes2)
+	require.Equal(t, stats, stats2)
+}
+
+func TestSimulatorCrash(t *testing.T) {
+	s := newTestSimulator(t, NewConfig(4))
+	defer s.Close()
+
+	// one of four validators is down, the quorum of three goes on
+	s.Crash(2, Window{From: time.Minute, Until: 4 * time.Minute})
+	s.Run(3 * time.Minute)
+	require.NoError(t, s.CheckSafety())
+	require.NoError(t, s.CheckLiveness(14))
+	heights := s.Heights()
+	require.True(t, heights[2] < heights[0])
+
+	// the validator catches up once it is back
+	s.Run(2 * time.Minute)
+	require.NoError(t, s.CheckSafety())
+	require.NoError(t, s.CheckLiveness(heights[0]+1))
+}
+
+func TestSimulatorNoQuorum(t *testing.T) {
+	s := newTestSimulator(t, NewConfig(4))
+	defer s.Close()
+
+	s.Run(time.Minute)
+	before := s.Heights()[0]
+
+	// two of four validators are down, no block is finalized without the quorum
+	s.Crash(0, Window{From: time.Minute, Until: 3 * time.Minute})
+	s.Crash(1, Window{From: time.Minute, Until: 3 * time.Minute})
+	s.Run(2 * time.Minute)
+	require.NoError(t, s.CheckSafety())
+	for _, h := range s.Heights() {
+		require.True(t, h <= before+1)
+	}
+
+	s.Run(2 * time.Minute)
+	require.NoError(t, s.CheckSafety())
+	require.NoError(t, s.CheckLiveness(before+5))
+}
+
+func TestSimulatorPartition(t *testing.T) {
+	s := newTestSimulator(t, NewConfig(4))
+	defer s.Close()
+
+	s.Run(time.Minute)
+	before := s.Heights()[0]
+
+	// neither half has the quorum
+	s.Partition(Window{From: time.Minute, Until: 3 * time.Minute}, []int{0, 1}, []int{2, 3})
+	s.Run(2 * time.Minute)
+	require.NoError(t, s.CheckSafety())
+	for _, h := range s.Heights() {
+		require.True(t, h <= before+1)
+	}
+	require.NotZero(t, s.Stats().Dropped)
+
+	s.Run(3 * time.Minute)
+	require.NoError(t, s.CheckSafety())
+	require.NoError(t, s.CheckLiveness(before+5))
+}
+
+func TestSimulatorLossyNetwork(t *testing.T) {
+	s := newTestSimulator(t, NewConfig(4))
+	defer s.Close()
+
+	s.Drop(-1, -1, 0.1, Forever)
+	s.Delay(0, -1, 2*time.Second, Forever)
+	s.Run(5 * time.Minute)
+	require.NoError(t, s.CheckSafety())
+	require.NoError(t, s.CheckLiveness(10))
+}
+
+func TestSimulatorEquivocation(t *testing.T) {
+	s := newTestSimulator(t, NewConfig(4))
+	defer s.Close()
+
+	s.Equivocate(1, Forever)
+	s.Run(5 * time.Minute)
+	require.NoError(t, s.CheckSafety())
+	require.NoError(t, s.CheckLiveness(10))
+	require.NotZero(t, s.Stats().Evidences)
+}
+
+func TestSimulatorEngines(t *testing.T) {
+	for _, engine := range []string{visor.ConsensusSingleMaster, visor.ConsensusBlockStat} {
+		t.Run(engine, func(t *testing.T) {
+			cfg := NewConfig(4)
+			cfg.Engine = engine
+			s := newTestSimulator(t, cfg)
+			defer s.Close()
+
+			s.Run(2 * time.Minute)
+			require.NoError(t, s.CheckSafety())
+			require.NoError(t, s.CheckLiveness(5))
+		})
+	}
+}
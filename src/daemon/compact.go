@@ -0,0 +1,359 @@
+package daemon
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/daemon/gnet"
+)
+
+// maxCompactBlocks is the number of compact blocks waiting for their transactions at most
+const maxCompactBlocks = 32
+
+// shortTxID returns the short id of the transaction in a compact block, the first 8 bytes of
+// the txid hashed with the block hash so the collisions can not be made before the block is
+func shortTxID(block, txid cipher.SHA256) uint64 {
+	h := cipher.AddSHA256(block, txid)
+	return binary.LittleEndian.Uint64(h[:8])
+}
+
+// errInvalidPrefilledTxn is returned if a prefilled transaction of a compact block is out of
+// the block or at the index of another one
+var errInvalidPrefilledTxn = errors.New("Invalid index of prefilled transaction")
+
+// isPrefilledTxn returns true if the transaction is sent in the compact blocks. The coinbase and
+// the evidences are made by the producer of the block, they are in no unconfirmed pool.
+func isPrefilledTxn(txn coin.Transaction) bool {
+	return txn.Type == coin.TxTypeCoinbase || txn.Type == coin.TxTypeEvidence
+}
+
+// reconstructTxns returns the transactions of the block, the prefilled ones at their indexes and
+// those of the short ids, in order at the other indexes, found in the known transactions. The
+// block indexes of the transactions not found are returned too. A short id matching several
+// known transactions is not found.
+func reconstructTxns(block cipher.SHA256, shortIDs []uint64, prefilled []PrefilledTxn, known coin.Transactions) (coin.Transactions, []uint64, error) {
+	txns := make(coin.Transactions, len(shortIDs)+len(prefilled))
+	isPrefilled := make([]bool, len(txns))
+	for _, p := range prefilled {
+		if p.Index >= uint64(len(txns)) || isPrefilled[p.Index] {
+			return nil, nil, errInvalidPrefilledTxn
+		}
+		txns[p.Index] = p.Txn
+		isPrefilled[p.Index] = true
+	}
+
+	byID := make(map[uint64]int, len(known))
+	for i, txn := range known {
+		id := shortTxID(block, txn.Hash())
+		if _, ok := byID[id]; ok {
+			byID[id] = -1
+			continue
+		}
+		byID[id] = i
+	}
+
+	missing := []uint64{}
+	n := 0
+	for i := range txns {
+		if isPrefilled[i] {
+			continue
+		}
+		j, ok := byID[shortIDs[n]]
+		n++
+		if !ok || j < 0 {
+			missing = append(missing, uint64(i))
+			continue
+		}
+		txns[i] = known[j]
+	}
+	return txns, missing, nil
+}
+
+// compactBlock is a compact block waiting for the transactions missing from the pool
+type compactBlock struct {
+	addr string
+	msg  *CompactBlockMessage
+	// transactions of the block, those missing are zero
+	txns    coin.Transactions
+	missing []uint64
+	// requestedAll is set once all the transactions were requested, a short id matched
+	// another transaction of the pool
+	requestedAll bool
+	received     time.Time
+}
+
+// block returns the block of the compact block
+func (cb *compactBlock) block() coin.SignedBlock {
+	return coin.SignedBlock{
+		Block: coin.Block{
+			Head: cb.msg.Header,
+			Body: coin.BlockBody{Transactions: cb.txns},
+		},
+		Sig: cb.msg.Sig,
+	}
+}
+
+// CompactBlocks are the compact blocks waiting for the transactions requested from their
+// sender, by block hash. CompactBlocks is used from the daemon loop only.
+type CompactBlocks struct {
+	timeout time.Duration
+	blocks  map[cipher.SHA256]*compactBlock
+}
+
+// NewCompactBlocks creates CompactBlocks, a block whose transactions are not received in
+// timeout is dropped
+func NewCompactBlocks(timeout time.Duration) *CompactBlocks {
+	return &CompactBlocks{
+		timeout: timeout,
+		blocks:  make(map[cipher.SHA256]*compactBlock),
+	}
+}
+
+// add adds the compact block, it returns false if too many blocks are waiting
+func (cbs *CompactBlocks) add(hash cipher.SHA256, cb *compactBlock, now time.Time) bool {
+	for h, b := range cbs.blocks {
+		if now.Sub(b.received) > cbs.timeout {
+			logger.Infof("Transactions of block %d requested from %s timed out", b.msg.Header.BkSeq, b.addr)
+			delete(cbs.blocks, h)
+		}
+	}
+
+	if _, ok := cbs.blocks[hash]; !ok && len(cbs.blocks) >= maxCompactBlocks {
+		return false
+	}
+	cbs.blocks[hash] = cb
+	return true
+}
+
+func (cbs *CompactBlocks) get(hash cipher.SHA256) (*compactBlock, bool) {
+	cb, ok := cbs.blocks[hash]
+	return cb, ok
+}
+
+func (cbs *CompactBlocks) remove(hash cipher.SHA256) {
+	delete(cbs.blocks, hash)
+}
+
+// completeCompactBlock processes the compact block as a pre-prepare once its transactions are
+// known, the missing transactions are requested from its sender
+func (dm *Daemon) completeCompactBlock(hash cipher.SHA256, cb *compactBlock) {
+	if len(cb.missing) == 0 {
+		b := cb.block()
+		if b.Body.Hash() == b.Head.BodyHash {
+			dm.compactBlocks.remove(hash)
+			if err := dm.consensus.ProcessPrePrepare(cb.addr, cb.msg.View, b, cb.msg.Prepares); err != nil {
+				logger.Errorf("Failed to add pending block %d: %v", b.Seq(), err)
+			}
+			return
+		}
+		if cb.requestedAll {
+			logger.Errorf("Transactions of block %d from %s do not match its header", b.Head.BkSeq, cb.addr)
+			dm.compactBlocks.remove(hash)
+			dm.misbehave(cb.addr, offenseInvalidBlock)
+			return
+		}
+
+		// a short id matched another transaction of the pool, all of them are requested
+		logger.Debugf("Short ids of block %d matched other transactions, requesting them all", b.Head.BkSeq)
+		prefilled := make(map[uint64]struct{}, len(cb.msg.Prefilled))
+		for _, p := range cb.msg.Prefilled {
+			prefilled[p.Index] = struct{}{}
+		}
+		for i := range cb.txns {
+			if _, ok := prefilled[uint64(i)]; !ok {
+				cb.missing = append(cb.missing, uint64(i))
+			}
+		}
+		cb.requestedAll = true
+	}
+
+	if !dm.compactBlocks.add(hash, cb, time.Now()) {
+		logger.Warningf("Too many compact blocks waiting for transactions, block %d from %s dropped", cb.msg.Header.BkSeq, cb.addr)
+		return
+	}
+	m := NewGetBlockTxnsMessage(hash, cb.missing)
+	if err := dm.Pool.Pool.SendMessage(cb.addr, m); err != nil {
+		logger.Errorf("Send GetBlockTxnsMessage to %s failed: %v", cb.addr, err)
+		dm.compactBlocks.remove(hash)
+	}
+}
+
+// PrefilledTxn is a transaction sent in a compact block, at its index in the block
+type PrefilledTxn struct {
+	Index uint64
+	Txn   coin.Transaction
+}
+
+// CompactBlockMessage is the pre-prepare of a pending block sent to the peers supporting compact
+// blocks. It has the short ids of the transactions instead of the transactions, the peers
+// rebuild the block from their unconfirmed pool and request the missing transactions. The
+// transactions the peers can not know are prefilled, the short ids are those of the others
+// in the block order.
+type CompactBlockMessage struct {
+	View      uint64
+	Header    coin.BlockHeader
+	Sig       cipher.Sig
+	Prepares  []cipher.Sig
+	ShortIDs  []uint64
+	Prefilled []PrefilledTxn
+	c         *gnet.MessageContext `enc:"-"`
+}
+
+// NewCompactBlockMessage creates CompactBlockMessage
+func NewCompactBlockMessage(view uint64, b coin.SignedBlock, prepares []cipher.Sig) *CompactBlockMessage {
+	hash := b.HashHeader()
+	ids := make([]uint64, 0, len(b.Body.Transactions))
+	prefilled := []PrefilledTxn{}
+	for i, txn := range b.Body.Transactions {
+		if isPrefilledTxn(txn) {
+			prefilled = append(prefilled, PrefilledTxn{
+				Index: uint64(i),
+				Txn:   txn,
+			})
+			continue
+		}
+		ids = append(ids, shortTxID(hash, txn.Hash()))
+	}
+	return &CompactBlockMessage{
+		View:      view,
+		Header:    b.Head,
+		Sig:       b.Sig,
+		Prepares:  prepares,
+		ShortIDs:  ids,
+		Prefilled: prefilled,
+	}
+}
+
+// Handle handles message
+func (cbm *CompactBlockMessage) Handle(mc *gnet.MessageContext, daemon interface{}) error {
+	cbm.c = mc
+	return daemon.(*Daemon).recordMessageEvent(cbm, mc)
+}
+
+// Process rebuilds the block from the unconfirmed pool and the pending blocks
+func (cbm *CompactBlockMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking || !d.Visor.v.Config.IsMaster {
+		return
+	}
+
+	hash := cbm.Header.Hash()
+	if _, ok := d.compactBlocks.get(hash); ok || d.Visor.v.CheckHashExists(hash) {
+		return
+	}
+	// the producer is checked before its transactions are requested
+	if err := d.Visor.VerifyHeader(cbm.Header, cbm.Sig); err != nil {
+		logger.Errorf("Invalid compact block %d from %s: %v", cbm.Header.BkSeq, cbm.c.Addr, err)
+		// the validators of the block following the head are known
+		if cbm.Header.BkSeq == d.Visor.HeadBkSeq()+1 {
+			d.misbehave(cbm.c.Addr, offenseInvalidSignature)
+		}
+		return
+	}
+
+	known, err := d.Visor.GetKnownTxns()
+	if err != nil {
+		logger.Errorf("Get known transactions failed: %v", err)
+		return
+	}
+	txns, missing, err := reconstructTxns(hash, cbm.ShortIDs, cbm.Prefilled, known)
+	if err != nil {
+		logger.Errorf("Invalid compact block %d from %s: %v", cbm.Header.BkSeq, cbm.c.Addr, err)
+		d.misbehave(cbm.c.Addr, offenseMalformedMessage)
+		return
+	}
+	d.completeCompactBlock(hash, &compactBlock{
+		addr:     cbm.c.Addr,
+		msg:      cbm,
+		txns:     txns,
+		missing:  missing,
+		received: time.Now(),
+	})
+}
+
+// GetBlockTxnsMessage requests the transactions of a pending or executed block by index
+type GetBlockTxnsMessage struct {
+	Hash    cipher.SHA256
+	Indexes []uint64
+	c       *gnet.MessageContext `enc:"-"`
+}
+
+// NewGetBlockTxnsMessage creates GetBlockTxnsMessage
+func NewGetBlockTxnsMessage(hash cipher.SHA256, indexes []uint64) *GetBlockTxnsMessage {
+	return &GetBlockTxnsMessage{
+		Hash:    hash,
+		Indexes: indexes,
+	}
+}
+
+// Handle handles message
+func (gbm *GetBlockTxnsMessage) Handle(mc *gnet.MessageContext, daemon interface{}) error {
+	gbm.c = mc
+	return daemon.(*Daemon).recordMessageEvent(gbm, mc)
+}
+
+// Process sends the transactions requested
+func (gbm *GetBlockTxnsMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking {
+		return
+	}
+
+	txns, err := d.Visor.GetBlockTxns(gbm.Hash, gbm.Indexes)
+	if err != nil {
+		logger.Debugf("Get transactions of block %s for %s failed: %v", gbm.Hash.Hex(), gbm.c.Addr, err)
+		return
+	}
+
+	m := NewGiveBlockTxnsMessage(gbm.Hash, txns)
+	if err := d.Pool.Pool.SendMessage(gbm.c.Addr, m); err != nil {
+		logger.Errorf("Send GiveBlockTxnsMessage to %s failed: %v", gbm.c.Addr, err)
+	}
+}
+
+// GiveBlockTxnsMessage sent in response to GetBlockTxnsMessage, the transactions are in the
+// order of the indexes requested
+type GiveBlockTxnsMessage struct {
+	Hash cipher.SHA256
+	Txns coin.Transactions
+	c    *gnet.MessageContext `enc:"-"`
+}
+
+// NewGiveBlockTxnsMessage creates GiveBlockTxnsMessage
+func NewGiveBlockTxnsMessage(hash cipher.SHA256, txns coin.Transactions) *GiveBlockTxnsMessage {
+	return &GiveBlockTxnsMessage{
+		Hash: hash,
+		Txns: txns,
+	}
+}
+
+// Handle handles message
+func (gbm *GiveBlockTxnsMessage) Handle(mc *gnet.MessageContext, daemon interface{}) error {
+	gbm.c = mc
+	return daemon.(*Daemon).recordMessageEvent(gbm, mc)
+}
+
+// Process fills the missing transactions of the compact block
+func (gbm *GiveBlockTxnsMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking {
+		return
+	}
+
+	cb, ok := d.compactBlocks.get(gbm.Hash)
+	if !ok || cb.addr != gbm.c.Addr {
+		return
+	}
+	if len(gbm.Txns) != len(cb.missing) {
+		logger.Errorf("%s sent %d transactions of block %d, %d were requested", gbm.c.Addr, len(gbm.Txns), cb.msg.Header.BkSeq, len(cb.missing))
+		d.compactBlocks.remove(gbm.Hash)
+		d.misbehave(gbm.c.Addr, offenseInvalidBlock)
+		return
+	}
+
+	for i, idx := range cb.missing {
+		cb.txns[idx] = gbm.Txns[i]
+	}
+	cb.missing = nil
+	d.completeCompactBlock(gbm.Hash, cb)
+}
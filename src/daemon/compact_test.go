@@ -0,0 +1,169 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
+	"github.com/samoslab/samos/src/coin"
+)
+
+func makeCompactTxns(n int) coin.Transactions {
+	txns := make(coin.Transactions, n)
+	for i := range txns {
+		txns[i] = coin.Transaction{
+			Length:    uint32(i),
+			InnerHash: cipher.SumSHA256([]byte{byte(i)}),
+		}
+	}
+	return txns
+}
+
+func makeCompactBlock(txns coin.Transactions) coin.SignedBlock {
+	body := coin.BlockBody{Transactions: txns}
+	return coin.SignedBlock{
+		Block: coin.Block{
+			Head: coin.BlockHeader{
+				BkSeq:    7,
+				BodyHash: body.Hash(),
+			},
+			Body: body,
+		},
+	}
+}
+
+func TestShortTxID(t *testing.T) {
+	txid := cipher.SumSHA256([]byte("txn"))
+	a := cipher.SumSHA256([]byte("a"))
+	b := cipher.SumSHA256([]byte("b"))
+
+	require.Equal(t, shortTxID(a, txid), shortTxID(a, txid))
+	// the ids are salted by the block
+	require.NotEqual(t, shortTxID(a, txid), shortTxID(b, txid))
+}
+
+// makeProducerTxns appends an evidence and a coinbase to the transactions
+func makeProducerTxns(txns coin.Transactions) coin.Transactions {
+	evidence := coin.Transaction{Type: coin.TxTypeEvidence, Sigs: []cipher.Sig{{1}, {2}}}
+	evidence.UpdateHeader()
+	coinbase := coin.Transaction{Type: coin.TxTypeCoinbase, Out: []coin.TransactionOutput{{Hours: 3}}}
+	coinbase.UpdateHeader()
+	return append(append(coin.Transactions{}, txns...), evidence, coinbase)
+}
+
+func TestCompactBlockMessage(t *testing.T) {
+	txns := makeProducerTxns(makeCompactTxns(3))
+	b := makeCompactBlock(txns)
+	prepares := []cipher.Sig{{1}}
+
+	m := NewCompactBlockMessage(2, b, prepares)
+	require.Equal(t, uint64(2), m.View)
+	require.Equal(t, b.Head, m.Header)
+	require.Equal(t, prepares, m.Prepares)
+	require.Len(t, m.ShortIDs, 3)
+	for i, txn := range txns[:3] {
+		require.Equal(t, shortTxID(b.HashHeader(), txn.Hash()), m.ShortIDs[i])
+	}
+	// the evidence and the coinbase are in no pool, they are sent
+	require.Equal(t, []PrefilledTxn{{Index: 3, Txn: txns[3]}, {Index: 4, Txn: txns[4]}}, m.Prefilled)
+
+	// the compact block is smaller than the block
+	require.True(t, len(encoder.Serialize(*m)) < len(encoder.Serialize(*NewPrePrepareMessage(2, b, prepares))))
+
+	var decoded CompactBlockMessage
+	require.NoError(t, encoder.DeserializeRaw(encoder.Serialize(*m), &decoded))
+	require.Equal(t, *m, decoded)
+}
+
+func TestReconstructTxns(t *testing.T) {
+	txns := makeCompactTxns(4)
+	b := makeCompactBlock(txns)
+	hash := b.HashHeader()
+	ids := NewCompactBlockMessage(0, b, nil).ShortIDs
+
+	// the transactions found are in the block order whatever the pool order
+	known := append(makeCompactTxns(10)[5:], txns[3], txns[0], txns[2])
+	found, missing, err := reconstructTxns(hash, ids, nil, known)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1}, missing)
+	require.Equal(t, coin.Transactions{txns[0], {}, txns[2], txns[3]}, found)
+
+	found, missing, err = reconstructTxns(hash, ids, nil, txns)
+	require.NoError(t, err)
+	require.Empty(t, missing)
+	require.Equal(t, txns, found)
+
+	// a short id matching several known transactions is requested
+	ids[2] = ids[0]
+	found, missing, err = reconstructTxns(hash, ids, nil, txns)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{}, missing)
+	require.Equal(t, coin.Transactions{txns[0], txns[1], txns[0], txns[3]}, found)
+
+	dup := append(coin.Transactions{}, txns...)
+	dup = append(dup, txns[0])
+	_, missing, err = reconstructTxns(hash, ids, nil, dup)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0, 2}, missing)
+}
+
+func TestReconstructPrefilledTxns(t *testing.T) {
+	txns := makeProducerTxns(makeCompactTxns(3))
+	b := makeCompactBlock(txns)
+	hash := b.HashHeader()
+	m := NewCompactBlockMessage(0, b, nil)
+
+	// the prefilled transactions are at their indexes, the missing indexes are those of the block
+	found, missing, err := reconstructTxns(hash, m.ShortIDs, m.Prefilled, txns[:1])
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2}, missing)
+	require.Equal(t, coin.Transactions{txns[0], {}, {}, txns[3], txns[4]}, found)
+
+	found, missing, err = reconstructTxns(hash, m.ShortIDs, m.Prefilled, txns[:3])
+	require.NoError(t, err)
+	require.Empty(t, missing)
+	require.Equal(t, txns, found)
+
+	_, _, err = reconstructTxns(hash, m.ShortIDs, []PrefilledTxn{{Index: 5}}, nil)
+	require.Equal(t, errInvalidPrefilledTxn, err)
+	_, _, err = reconstructTxns(hash, m.ShortIDs, []PrefilledTxn{{Index: 1}, {Index: 1}}, nil)
+	require.Equal(t, errInvalidPrefilledTxn, err)
+}
+
+func TestCompactBlocks(t *testing.T) {
+	cbs := NewCompactBlocks(time.Second * 5)
+	now := time.Now()
+	m := NewCompactBlockMessage(0, makeCompactBlock(nil), nil)
+
+	hashes := make([]cipher.SHA256, maxCompactBlocks+1)
+	for i := range hashes {
+		hashes[i] = cipher.SumSHA256([]byte{byte(i)})
+	}
+
+	for i, h := range hashes[:maxCompactBlocks] {
+		received := now
+		if i == 0 {
+			received = now.Add(-time.Second * 4)
+		}
+		require.True(t, cbs.add(h, &compactBlock{msg: m, received: received}, now))
+	}
+	_, ok := cbs.get(hashes[0])
+	require.True(t, ok)
+	require.False(t, cbs.add(hashes[maxCompactBlocks], &compactBlock{msg: m, received: now}, now))
+
+	// the blocks waiting too long are dropped to make room
+	now = now.Add(time.Second * 2)
+	require.True(t, cbs.add(hashes[maxCompactBlocks], &compactBlock{msg: m, received: now}, now))
+	_, ok = cbs.get(hashes[0])
+	require.False(t, ok)
+
+	require.False(t, cbs.add(hashes[0], &compactBlock{msg: m, received: now}, now))
+
+	cbs.remove(hashes[1])
+	_, ok = cbs.get(hashes[1])
+	require.False(t, ok)
+	require.True(t, cbs.add(hashes[0], &compactBlock{msg: m, received: now}, now))
+}
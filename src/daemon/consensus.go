@@ -0,0 +1,293 @@
+package daemon
+
+import (
+	"time"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/visor"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+// ConsensusNetwork sends the consensus messages of a validator to its peers. The daemon sends
+// them over the connection pool, the consensus simulator over its virtual network.
+type ConsensusNetwork interface {
+	// BroadcastPrePrepare sends the pending block proposed in the view, with the prepare
+	// votes it collected if it was prepared in an earlier view
+	BroadcastPrePrepare(view uint64, b coin.SignedBlock, prepares []cipher.Sig) error
+	// BroadcastPrepare sends the prepare vote for the pending block
+	BroadcastPrepare(hash cipher.SHA256, sig cipher.Sig) error
+	// BroadcastCommit sends the commit vote for the pending block
+	BroadcastCommit(hash cipher.SHA256, sig cipher.Sig) error
+	// BroadcastViewChange sends the vote to move to the view of the block height
+	BroadcastViewChange(seq, view uint64, sig cipher.Sig) error
+	// BroadcastBlocks sends the executed blocks with their quorum certificates
+	BroadcastBlocks(blocks []coin.SignedBlock, certs []blockdb.QuorumCert) error
+	// BroadcastEvidences sends the evidences of the validators which signed conflicting blocks
+	BroadcastEvidences(evidences []blockdb.Evidence) error
+}
+
+// Consensus runs the consensus message handlers of a validator on its visor. The handlers are
+// shared by the daemon and the consensus simulator, they must be called from one goroutine.
+type Consensus struct {
+	v       *visor.Visor
+	network ConsensusNetwork
+}
+
+// NewConsensus creates Consensus of the visor sending its messages over the network
+func NewConsensus(v *visor.Visor, network ConsensusNetwork) *Consensus {
+	return &Consensus{
+		v:       v,
+		network: network,
+	}
+}
+
+// DetectEquivocation broadcasts the evidence if the producer signed another block of the height,
+// blocks behind the head are checked too
+func (c *Consensus) DetectEquivocation(b coin.SignedBlock) {
+	evidence, err := c.v.DetectEquivocation(b)
+	if err != nil {
+		logger.Errorf("Detect equivocation of block %d failed: %v", b.Block.Head.BkSeq, err)
+	} else if evidence != nil {
+		if err := c.network.BroadcastEvidences([]blockdb.Evidence{*evidence}); err != nil {
+			logger.Errorf("Broadcast evidence failed: %v", err)
+		}
+	}
+}
+
+// ProcessPrePrepare adds the block proposed in the view by the peer, the blocks of an earlier
+// view are only checked for equivocation unless they come with their prepare votes
+func (c *Consensus) ProcessPrePrepare(addr string, view uint64, b coin.SignedBlock, prepares []cipher.Sig) error {
+	if len(prepares) == 0 && view < c.v.GetView() {
+		logger.Debugf("Ignore block %d of view %d from %s, the view changed", b.Seq(), view, addr)
+		c.DetectEquivocation(b)
+		return nil
+	}
+
+	return c.AcceptPendingBlock(b, prepares)
+}
+
+// AcceptPendingBlock adds the block proposed by its producer, or prepared in an earlier view
+// if it comes with the prepare votes, and votes to prepare it
+func (c *Consensus) AcceptPendingBlock(b coin.SignedBlock, prepares []cipher.Sig) error {
+	c.DetectEquivocation(b)
+
+	if b.Seq() <= c.v.HeadBkSeq() {
+		return nil
+	}
+
+	var err error
+	if len(prepares) > 0 {
+		err = c.v.AddPreparedBlock(b, prepares)
+	} else {
+		err = c.v.AddPendingBlock(b)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Critical().Infof("Added pending block %d", b.Block.Head.BkSeq)
+
+	hash := b.HashHeader()
+	if sig, err := c.v.SignPrepare(hash); err != nil {
+		logger.Debugf("Prepare block %s failed: %v", hash.Hex(), err)
+	} else if err := c.network.BroadcastPrepare(hash, sig); err != nil {
+		logger.Errorf("Broadcast GivePrepareMessage failed: %v", err)
+	}
+
+	c.ExecuteCommittedBlock(hash)
+	return nil
+}
+
+// ProcessPrepare adds the prepare vote of a validator for the pending block
+func (c *Consensus) ProcessPrepare(hash cipher.SHA256, sig cipher.Sig) {
+	pubkeyRec, err := cipher.PubKeyFromSig(sig, pbft.PrepareHash(hash)) //recovered pubkey
+	if err != nil {
+		logger.Errorf("Invalid sig: PubKey recovery failed: %v", err)
+		return
+	}
+	if !c.v.IsTrustPubkey(pubkeyRec) {
+		return
+	}
+
+	if _, err := c.v.GetBlockValidators(hash); err != nil {
+		logger.Errorf("Get block %s validator failed, waiting pending block added", hash.Hex())
+		return
+	}
+	if _, err := c.v.AddPrepare(hash, sig); err != nil {
+		logger.Errorf("AddPrepare %s for hash failed: %v", pubkeyRec.Hex(), err)
+	}
+	c.ExecuteCommittedBlock(hash)
+}
+
+// ProcessCommit adds the commit vote of a validator and executes the block once the quorum
+// committed it
+func (c *Consensus) ProcessCommit(hash cipher.SHA256, sig cipher.Sig) {
+	if !c.v.CheckHashExists(hash) {
+		return
+	}
+
+	pubkey, err := c.v.AddCommit(hash, sig)
+	if err != nil {
+		logger.Debugf("AddCommit %s for block %s failed: %v", pubkey.Hex(), hash.Hex(), err)
+		return
+	}
+	c.ExecuteCommittedBlock(hash)
+}
+
+// commit votes to commit the pending block once the quorum prepared it and executes it once
+// the quorum committed it, visor.ErrNotCommitted is returned until then and
+// visor.ErrParentPending while the block it extends is pending
+func (c *Consensus) commit(hash cipher.SHA256) error {
+	sig, ok, err := c.v.SignCommit(hash)
+	if err != nil {
+		logger.Errorf("Commit block %s failed: %v", hash.Hex(), err)
+		return err
+	}
+	if ok {
+		if err := c.network.BroadcastCommit(hash, sig); err != nil {
+			logger.Errorf("Broadcast CommitMessage failed: %v", err)
+		}
+	}
+
+	err = c.v.ExecuteCommittedBlock(hash)
+	switch err {
+	case nil:
+		return nil
+	case visor.ErrNotCommitted, visor.ErrParentPending:
+		return err
+	default:
+		logger.Errorf("Start Execute Block %s failed: %v", hash, err)
+		return err
+	}
+}
+
+// ExecuteCommittedBlock executes the pending block once the quorum committed it and broadcasts
+// it. The pending block extending it is executed next if it is committed already.
+func (c *Consensus) ExecuteCommittedBlock(hash cipher.SHA256) {
+	if err := c.commit(hash); err != nil {
+		return
+	}
+
+	sb, err := c.v.GetBlockByHash(hash)
+	if err != nil || sb == nil {
+		logger.Errorf("get block by hash %s failed", hash.Hex())
+		return
+	}
+	if err := c.broadcastBlock(*sb); err != nil {
+		logger.Errorf("broadcast block %s failed", sb.HashHeader())
+	}
+
+	if child, ok := c.v.PendingChild(hash); ok {
+		c.ExecuteCommittedBlock(child)
+	}
+}
+
+// broadcastBlock sends the executed block with its quorum certificate
+func (c *Consensus) broadcastBlock(sb coin.SignedBlock) error {
+	blocks := []coin.SignedBlock{sb}
+	certs, err := c.v.GetQuorumCerts(blocks)
+	if err != nil {
+		return err
+	}
+	return c.network.BroadcastBlocks(blocks, certs)
+}
+
+// ProcessViewChange adds the view change vote, joins the view change once f+1 validators voted
+// for it and proposes the prepared blocks again once the view started
+func (c *Consensus) ProcessViewChange(seq, view uint64, sig cipher.Sig) error {
+	current := c.v.GetView()
+	join, err := c.v.AddViewChange(seq, view, sig)
+	if err != nil {
+		return err
+	}
+
+	if join {
+		seq, sig, err := c.v.VoteViewChange(view)
+		if err != nil {
+			logger.Errorf("Vote view change to %d failed: %v", view, err)
+		} else if err := c.network.BroadcastViewChange(seq, view, sig); err != nil {
+			logger.Errorf("Broadcast ViewChangeMessage failed: %v", err)
+		}
+	}
+
+	if c.v.GetView() > current {
+		c.ProposePreparedBlocks()
+	}
+	return nil
+}
+
+// RequestViewChange votes to move to the next view if the pending block of the current view
+// was not committed in timeout
+func (c *Consensus) RequestViewChange(timeout time.Duration) error {
+	if !c.v.ViewTimedOut(timeout) {
+		return nil
+	}
+
+	view := c.v.GetView() + 1
+	seq, sig, err := c.v.VoteViewChange(view)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Pending block %d not committed in %v, vote to change to view %d", seq, timeout, view)
+
+	if err := c.network.BroadcastViewChange(seq, view, sig); err != nil {
+		return err
+	}
+
+	if c.v.GetView() >= view {
+		c.ProposePreparedBlocks()
+	}
+	return nil
+}
+
+// ProposePreparedBlocks sends the pending blocks kept by a view change in the pre-prepare
+// message of the new view
+func (c *Consensus) ProposePreparedBlocks() {
+	view := c.v.GetView()
+	for _, hash := range c.v.GetPendingHash() {
+		sb, err := c.v.GetPendingBlock(hash)
+		if err != nil {
+			continue
+		}
+		if err := c.network.BroadcastPrePrepare(view, sb, c.v.GetPrepareSigs(hash)); err != nil {
+			logger.Errorf("Broadcast PrePrepareMessage failed: %v", err)
+		}
+	}
+}
+
+// poolNetwork sends the consensus messages to all the connections of the pool
+type poolNetwork struct {
+	pool *Pool
+}
+
+// BroadcastPrePrepare sends the pre-prepare message of the block, or the compact block to the
+// peers supporting it
+func (pn poolNetwork) BroadcastPrePrepare(view uint64, b coin.SignedBlock, prepares []cipher.Sig) error {
+	return broadcastPrePrepare(pn.pool, view, b, prepares)
+}
+
+// BroadcastPrepare sends GivePrepareMessage
+func (pn poolNetwork) BroadcastPrepare(hash cipher.SHA256, sig cipher.Sig) error {
+	return pn.pool.Pool.BroadcastMessage(NewGivePrepareMessage(hash, sig))
+}
+
+// BroadcastCommit sends CommitMessage
+func (pn poolNetwork) BroadcastCommit(hash cipher.SHA256, sig cipher.Sig) error {
+	return pn.pool.Pool.BroadcastMessage(NewCommitMessage(hash, sig))
+}
+
+// BroadcastViewChange sends ViewChangeMessage
+func (pn poolNetwork) BroadcastViewChange(seq, view uint64, sig cipher.Sig) error {
+	return pn.pool.Pool.BroadcastMessage(NewViewChangeMessage(seq, view, sig))
+}
+
+// BroadcastBlocks sends GiveQuorumCertsMessage and GiveBlocksMessage
+func (pn poolNetwork) BroadcastBlocks(blocks []coin.SignedBlock, certs []blockdb.QuorumCert) error {
+	return broadcastBlocks(pn.pool, blocks, certs)
+}
+
+// BroadcastEvidences sends GiveEvidenceMessage
+func (pn poolNetwork) BroadcastEvidences(evidences []blockdb.Evidence) error {
+	return pn.pool.Pool.BroadcastMessage(NewGiveEvidenceMessage(evidences))
+}
@@ -30,6 +30,10 @@ Todo
 var (
 	// ErrDisconnectReasons invalid version
 	ErrDisconnectInvalidVersion gnet.DisconnectReason = errors.New("Invalid version")
+	// ErrDisconnectVersionTooLow the protocol version of the peer is below the minimum
+	ErrDisconnectVersionTooLow gnet.DisconnectReason = errors.New("Protocol version below the minimum")
+	// ErrDisconnectVersionNotSupported the minimum protocol version of the peer is above ours
+	ErrDisconnectVersionNotSupported gnet.DisconnectReason = errors.New("Protocol version not supported")
 	// ErrDisconnectIntroductionTimeout timeout
 	ErrDisconnectIntroductionTimeout gnet.DisconnectReason = errors.New("Version timeout")
 	// ErrDisconnectVersionSendFailed version send failed
@@ -98,6 +102,9 @@ func (cfg *Config) preprocess() Config {
 	}
 	config.Pool.port = config.Daemon.Port
 	config.Pool.address = config.Daemon.Address
+	if config.Daemon.AuthenticatedPrepares && !config.Pool.Encrypt {
+		logger.Warning("The prepare messages are sent only over the encrypted connections to the validators, but the connections are not encrypted")
+	}
 
 	if config.Daemon.DisableNetworking {
 		logger.Info("Networking is disabled")
@@ -121,8 +128,10 @@ func (cfg *Config) preprocess() Config {
 
 // DaemonConfig configuration for the Daemon
 type DaemonConfig struct { // nolint: golint
-	// Application version. TODO -- manage version better
+	// Protocol version of the node
 	Version int32
+	// Peers below the protocol version are disconnected
+	MinVersion int32
 	// IP Address to serve on. Leave empty for automatic assignment
 	Address string
 	// TCP/UDP port for connections
@@ -154,12 +163,20 @@ type DaemonConfig struct { // nolint: golint
 	LocalhostOnly bool
 	// Log ping and pong messages
 	LogPings bool
+	// Max offset of the median clock of the peers the local clock is adjusted by
+	MaxClockOffset time.Duration
+	// Warn when the local clock differs from the median clock of the peers by more
+	ClockDriftWarning time.Duration
+	// Send the prepare messages only over the encrypted connections to the peers that proved
+	// the trust key of a validator
+	AuthenticatedPrepares bool
 }
 
 // NewDaemonConfig creates daemon config
 func NewDaemonConfig() DaemonConfig {
 	return DaemonConfig{
-		Version:                    2,
+		Version:                    3,
+		MinVersion:                 3,
 		Address:                    "",
 		Port:                       6677,
 		OutgoingRate:               time.Second * 5,
@@ -174,6 +191,9 @@ func NewDaemonConfig() DaemonConfig {
 		DisableIncomingConnections: false,
 		LocalhostOnly:              false,
 		LogPings:                   true,
+		MaxClockOffset:             time.Minute,
+		ClockDriftWarning:          time.Second * 5,
+		AuthenticatedPrepares:      false,
 	}
 }
 
@@ -216,6 +236,22 @@ type Daemon struct {
 	// Tracking connections from the same base IP.  Multiple connections
 	// from the same base IP are allowed but limited.
 	ipCounts *IPCount
+	// Offset of the local clock to the clocks of the peers, consensus runs on the adjusted clock
+	networkTime *NetworkTime
+	// Protocol version and capabilities negotiated with the introduced peers
+	connectionFeatures *ConnectionFeatures
+	// Keys proved by the peers of the encrypted connections, by address
+	connectionIdentities *ConnectionIdentities
+	// Quorum certificates received for the next blocks of the peers, by address
+	connectionQuorumCerts *ConnectionQuorumCerts
+	// Headers first sync of the blocks from the peers supporting it
+	blockSync *BlockSync
+	// Consensus message handlers of the validator
+	consensus *Consensus
+	// Compact blocks waiting for the transactions missing from the pool
+	compactBlocks *CompactBlocks
+	// Time taken to process the messages, by prefix
+	handlerLatencies *HandlerLatencies
 	// Message handling queue
 	messageEvents chan MessageEvent
 	// quit channel
@@ -249,6 +285,13 @@ func NewDaemon(config Config, db *bolt.DB, defaultConns []string) (*Daemon, erro
 		connectionMirrors:      NewConnectionMirrors(),
 		mirrorConnections:      NewMirrorConnections(),
 		ipCounts:               NewIPCount(),
+		networkTime:            NewNetworkTime(config.Daemon.MaxClockOffset, config.Daemon.ClockDriftWarning),
+		connectionFeatures:     NewConnectionFeatures(),
+		connectionIdentities:   NewConnectionIdentities(),
+		connectionQuorumCerts:  NewConnectionQuorumCerts(),
+		blockSync:              NewBlockSync(config.Visor),
+		compactBlocks:          NewCompactBlocks(config.Visor.CompactBlockTimeout),
+		handlerLatencies:       NewHandlerLatencies(),
 		// TODO -- if there are performance problems from blocking chans,
 		// Its because we are connecting to more things than OutgoingMax
 		// if we have private peers
@@ -261,9 +304,12 @@ func NewDaemon(config Config, db *bolt.DB, defaultConns []string) (*Daemon, erro
 		quitC:               make(chan chan struct{}),
 	}
 
+	vs.v.SetClock(d.networkTime.UnixNow)
+
 	d.Gateway = NewGateway(config.Gateway, d)
 	d.Messages.Config.Register()
 	d.Pool = NewPool(config.Pool, d)
+	d.consensus = NewConsensus(vs.v, poolNetwork{pool: d.Pool})
 
 	return d, nil
 }
@@ -368,6 +414,7 @@ func (dm *Daemon) Run() error {
 	unconfirmedRefreshTicker := time.Tick(dm.Visor.Config.Config.UnconfirmedRefreshRate)
 	unconfirmedRemoveInvalidTicker := time.Tick(dm.Visor.Config.Config.UnconfirmedRemoveInvalidRate)
 	blocksRequestTicker := time.Tick(dm.Visor.Config.BlocksRequestRate)
+	blockSyncTicker := time.Tick(dm.Visor.Config.BlockSyncRate)
 	blocksAnnounceTicker := time.Tick(dm.Visor.Config.BlocksAnnounceRate)
 	TrustNodeRequestTicker := time.Tick(dm.Visor.Config.TrustNodeRequestRate)
 	TrustNodeAnnounceTicker := time.Tick(dm.Visor.Config.TrustNodeAnnounceRate)
@@ -513,12 +560,12 @@ loop:
 			elapser.Register("blockCreationTicker.C")
 			if dm.Visor.Config.Config.IsMaster {
 				dm.Visor.v.RemoveUnconfirmBlock()
-				should, err := dm.Visor.InTurnTheNode(utc.UnixNow())
+				should, err := dm.Visor.InTurnTheNode(dm.networkTime.UnixNow())
 				if err != nil || !should {
 					logger.Infof("slot not for this node: %v", err)
 					continue
 				}
-				if dm.Visor.HasUnconfirmedBlock() {
+				if dm.Visor.PendingWindowFull() {
 					logger.Infof("can not make block: %v", err)
 					continue
 				}
@@ -574,7 +621,11 @@ loop:
 
 		case <-blocksRequestTicker:
 			elapser.Register("blocksRequestTicker")
-			dm.Visor.RequestBlocks(dm.Pool)
+			dm.requestBlocks()
+
+		case <-blockSyncTicker:
+			elapser.Register("blockSyncTicker")
+			dm.stepBlockSync()
 
 		case <-blocksAnnounceTicker:
 			elapser.Register("blocksAnnounceTicker")
@@ -590,6 +641,7 @@ loop:
 		case <-PrepareRequestTicker:
 			elapser.Register("PrepareRequestTicker")
 			dm.Visor.RequestPrepare(dm.Pool)
+			dm.Visor.RequestViewChange(dm.Pool)
 
 		case <-AgressNodeNumRequestTicker:
 			elapser.Register("AgreeNodeNumRequestTicker")
@@ -643,6 +695,10 @@ func (dm *Daemon) connectToPeer(p pex.Peer) error {
 		return errors.New("Not localhost")
 	}
 
+	if dm.Pex.IsBanned(p.Addr) {
+		return errors.New("Peer is banned")
+	}
+
 	conned, err := dm.Pool.Pool.IsConnExist(p.Addr)
 	if err != nil {
 		return err
@@ -785,7 +841,19 @@ func (dm *Daemon) cullInvalidConnections() {
 	}
 }
 
+// isTrustedPeer returns true if the peer proved the trust key of a validator in the handshake
+// of the encrypted connection. The peers of the connections which are not encrypted are
+// trusted if they are trusted in the peer list.
 func (dm *Daemon) isTrustedPeer(addr string) bool {
+	c, err := dm.Pool.Pool.GetConnection(addr)
+	if err != nil {
+		logger.Error(err)
+		return false
+	}
+	if c != nil && c.Encrypted() {
+		return dm.isValidatorLink(addr)
+	}
+
 	peer, ok := dm.Pex.GetPeerByAddr(addr)
 	if !ok {
 		return false
@@ -809,19 +877,22 @@ func (dm *Daemon) needsIntro(addr string) bool {
 
 // Processes a queued AsyncMessage.
 func (dm *Daemon) processMessageEvent(e MessageEvent) {
-	// The first message received must be an Introduction
+	// The first messages received must be an Introduction and its Features
 	// We have to check at process time and not record time because
-	// Introduction message does not update ExpectingIntroductions until its
+	// Features message does not update ExpectingIntroductions until its
 	// Process() is called
 	// _, needsIntro := self.expectingIntroductions[e.Context.Addr]
 	// if needsIntro {
 	if dm.needsIntro(e.Context.Addr) {
-		_, isIntro := e.Message.(*IntroductionMessage)
-		if !isIntro {
+		switch e.Message.(type) {
+		case *IntroductionMessage, *FeaturesMessage:
+		default:
 			dm.Pool.Pool.Disconnect(e.Context.Addr, ErrDisconnectNoIntroduction)
 		}
 	}
+	start := time.Now()
 	e.Message.Process(dm)
+	dm.handlerLatencies.Record(messagePrefix(e.Message), time.Since(start))
 }
 
 // Called when a ConnectEvent is processed off the onConnectEvent channel
@@ -847,6 +918,12 @@ func (dm *Daemon) onConnect(e ConnectEvent) {
 		return
 	}
 
+	if dm.Pex.IsBanned(a) {
+		logger.Infof("%s is banned, disconnecting", a)
+		dm.Pool.Pool.Disconnect(a, ErrDisconnectIsBlacklisted)
+		return
+	}
+
 	if dm.ipCountMaxed(a) {
 		logger.Infof("Max connections for %s reached, disconnecting", a)
 		dm.Pool.Pool.Disconnect(a, ErrDisconnectIPLimitReached)
@@ -854,6 +931,7 @@ func (dm *Daemon) onConnect(e ConnectEvent) {
 	}
 
 	dm.recordIPCount(a)
+	dm.recordIdentity(a)
 
 	if e.Solicited {
 		dm.outgoingConnections.Add(a)
@@ -865,6 +943,10 @@ func (dm *Daemon) onConnect(e ConnectEvent) {
 	if err := dm.Pool.Pool.SendMessage(a, m); err != nil {
 		logger.Errorf("Send IntroductionMessage to %s failed: %v", a, err)
 	}
+	fm := NewFeaturesMessage(dm.Config.MinVersion, dm.Config.Version, SupportedCapabilities)
+	if err := dm.Pool.Pool.SendMessage(a, fm); err != nil {
+		logger.Errorf("Send FeaturesMessage to %s failed: %v", a, err)
+	}
 }
 
 func (dm *Daemon) onDisconnect(e DisconnectEvent) {
@@ -875,6 +957,16 @@ func (dm *Daemon) onDisconnect(e DisconnectEvent) {
 	dm.Visor.RemoveConnection(e.Addr)
 	dm.removeIPCount(e.Addr)
 	dm.removeConnectionMirror(e.Addr)
+	dm.networkTime.Remove(e.Addr)
+	dm.connectionFeatures.Remove(e.Addr)
+	dm.connectionIdentities.Remove(e.Addr)
+	dm.connectionQuorumCerts.Remove(e.Addr)
+	dm.blockSync.RemovePeer(e.Addr)
+
+	switch e.Reason {
+	case gnet.ErrDisconnectMalformedMessage, gnet.ErrDisconnectInvalidMessageLength:
+		dm.misbehave(e.Addr, offenseMalformedMessage)
+	}
 }
 
 // Triggered when an gnet.Connection terminates
@@ -5,6 +5,7 @@ import (
 
 	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/daemon/pex"
 	"github.com/samoslab/samos/src/daemon/strand"
 	"github.com/samoslab/samos/src/util/utc"
 	"github.com/samoslab/samos/src/visor"
@@ -82,6 +83,15 @@ func (gw *Gateway) GetConnections() *Connections {
 	return conns
 }
 
+// GetNetworkStats returns the traffic of all the connections and the latencies of the handlers
+func (gw *Gateway) GetNetworkStats() *NetworkStats {
+	var stats *NetworkStats
+	gw.strand("GetNetworkStats", func() {
+		stats = gw.drpc.GetNetworkStats(gw.d)
+	})
+	return stats
+}
+
 // GetDefaultConnections returns default connections
 func (gw *Gateway) GetDefaultConnections() []string {
 	var conns []string
@@ -120,13 +130,46 @@ func (gw *Gateway) GetExchgConnection() []string {
 	return conn
 }
 
+// GetBans returns the banned IPs
+func (gw *Gateway) GetBans() []pex.Ban {
+	var bans []pex.Ban
+	gw.strand("GetBans", func() {
+		bans = gw.d.Pex.Bans()
+	})
+	return bans
+}
+
+// BanPeer bans the IP of the address for the duration, the default ban duration if it is 0,
+// and closes the connections to the IP
+func (gw *Gateway) BanPeer(addr string, d time.Duration, reason string) (pex.Ban, error) {
+	var ban pex.Ban
+	var err error
+	gw.strand("BanPeer", func() {
+		ban, err = gw.d.Pex.Ban(addr, d, reason)
+		if err != nil {
+			return
+		}
+		gw.d.disconnectIP(ban.IP)
+	})
+	return ban, err
+}
+
+// UnbanPeer removes the ban of the IP of the address
+func (gw *Gateway) UnbanPeer(addr string) error {
+	var err error
+	gw.strand("UnbanPeer", func() {
+		err = gw.d.Pex.Unban(addr)
+	})
+	return err
+}
+
 /* Blockchain & Transaction status */
 
 // GetBlockchainProgress returns a *BlockchainProgress
 func (gw *Gateway) GetBlockchainProgress() *BlockchainProgress {
 	var bcp *BlockchainProgress
 	gw.strand("GetBlockchainProgress", func() {
-		bcp = gw.drpc.GetBlockchainProgress(gw.d.Visor)
+		bcp = gw.drpc.GetBlockchainProgress(gw.d.Visor, gw.d.blockSync.Progress(time.Now()))
 	})
 	return bcp
 }
@@ -193,6 +236,19 @@ func (gw *Gateway) GetBlockBySeq(seq uint64) (block coin.SignedBlock, ok bool) {
 	return
 }
 
+// GetQuorumCert returns the quorum certificate of the block, nil if it has none
+func (gw *Gateway) GetQuorumCert(hash cipher.SHA256) (*visor.ReadableQuorumCert, error) {
+	var qc *blockdb.QuorumCert
+	var err error
+	gw.strand("GetQuorumCert", func() {
+		qc, err = gw.v.GetQuorumCert(hash)
+	})
+	if err != nil || qc == nil {
+		return nil, err
+	}
+	return visor.NewReadableQuorumCert(qc), nil
+}
+
 // GetBlocks returns a *visor.ReadableBlocks
 func (gw *Gateway) GetBlocks(start, end uint64) (*visor.ReadableBlocks, error) {
 	var blocks []coin.SignedBlock
@@ -874,6 +930,7 @@ type Health struct {
 	Version            visor.BuildInfo
 	OpenConnections    int
 	Uptime             time.Duration
+	NetworkTime        NetworkTimeStatus
 }
 
 // GetHealth returns statistics about the running node
@@ -894,8 +951,99 @@ func (gw *Gateway) GetHealth() (*Health, error) {
 			Version:            gw.v.Config.BuildInfo,
 			OpenConnections:    len(conns.Connections),
 			Uptime:             time.Since(gw.v.StartedAt),
+			NetworkTime:        gw.d.networkTime.Status(),
 		}
 	})
 
 	return health, err
 }
+
+// GetValidatorElection returns the result of the last validator election
+func (gw *Gateway) GetValidatorElection() (*visor.ReadableValidatorElection, error) {
+	var election *visor.ReadableValidatorElection
+	var err error
+	gw.strand("GetValidatorElection", func() {
+		var e *visor.ValidatorElection
+		e, err = gw.v.GetValidatorElection()
+		if err != nil {
+			return
+		}
+		election, err = visor.NewReadableValidatorElection(gw.v.Config.VoteElection, e)
+	})
+	return election, err
+}
+
+// GetValidatorStats returns the produced, missed and orphaned slots of the validators
+func (gw *Gateway) GetValidatorStats() (*visor.ReadableValidatorStats, error) {
+	var stats *visor.ReadableValidatorStats
+	var err error
+	gw.strand("GetValidatorStats", func() {
+		var s []blockdb.SlotStats
+		s, err = gw.v.GetValidatorStats()
+		if err != nil {
+			return
+		}
+		stats = visor.NewReadableValidatorStats(s)
+	})
+	return stats, err
+}
+
+// GetValidatorEvidence returns the evidence of validators which signed conflicting blocks
+func (gw *Gateway) GetValidatorEvidence() ([]visor.ReadableEvidence, error) {
+	var evidences []visor.ReadableEvidence
+	var err error
+	gw.strand("GetValidatorEvidence", func() {
+		var es []blockdb.Evidence
+		es, err = gw.v.GetEvidences()
+		if err != nil {
+			return
+		}
+		evidences = visor.NewReadableEvidences(es)
+	})
+	return evidences, err
+}
+
+// GetJailedValidators returns the jailed validators
+func (gw *Gateway) GetJailedValidators() ([]visor.ReadableJailRecord, error) {
+	var jailed []visor.ReadableJailRecord
+	var err error
+	gw.strand("GetJailedValidators", func() {
+		var records []blockdb.JailRecord
+		records, err = gw.v.GetJailedValidators()
+		if err != nil {
+			return
+		}
+		jailed = visor.NewReadableJailRecords(records)
+	})
+	return jailed, err
+}
+
+// GetGovernance returns the pending and the active validator set and quorum changes
+func (gw *Gateway) GetGovernance() (*visor.ReadableGovernance, error) {
+	var governance *visor.ReadableGovernance
+	var err error
+	gw.strand("GetGovernance", func() {
+		var g *visor.Governance
+		g, err = gw.v.GetGovernance()
+		if err != nil {
+			return
+		}
+		governance = visor.NewReadableGovernance(g)
+	})
+	return governance, err
+}
+
+// GetKeyRotations returns the pending and the applied validator key rotations
+func (gw *Gateway) GetKeyRotations() ([]visor.ReadableKeyRotation, error) {
+	var rotations []visor.ReadableKeyRotation
+	var err error
+	gw.strand("GetKeyRotations", func() {
+		var rs []blockdb.KeyRotation
+		rs, err = gw.v.GetKeyRotations()
+		if err != nil {
+			return
+		}
+		rotations = visor.NewReadableKeyRotations(rs)
+	})
+	return rotations, err
+}
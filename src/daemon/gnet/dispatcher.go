@@ -25,10 +25,10 @@ func newSendResult(addr string, m Message, err error) SendResult {
 	}
 }
 
-// Serializes a Message over a net.Conn
-func sendMessage(conn net.Conn, msg Message, timeout time.Duration) error {
+// Serializes a Message over a net.Conn, it returns the bytes sent
+func sendMessage(conn net.Conn, msg Message, timeout time.Duration) ([]byte, error) {
 	m := EncodeMessage(msg)
-	return sendByteMessage(conn, m, timeout)
+	return m, sendByteMessage(conn, m, timeout)
 }
 
 // Event handler that is called after a Connection sends a complete message
@@ -166,8 +166,9 @@ func TestSendMessage(t *testing.T) {
 		assert.True(t, bytes.Equal(msg, expect))
 		return nil
 	}
-	err := sendMessage(nil, m, 0)
+	data, err := sendMessage(nil, m, 0)
 	assert.Nil(t, err)
+	assert.Len(t, data, 9)
 }
 
 /* Helpers */
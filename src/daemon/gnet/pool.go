@@ -12,6 +12,7 @@ import (
 
 	"io"
 
+	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/cipher/encoder"
 	"github.com/samoslab/samos/src/daemon/strand"
 
@@ -82,6 +83,24 @@ type Config struct {
 	DisconnectCallback DisconnectCallback
 	// Triggered on client connect
 	ConnectCallback ConnectCallback
+	// Filters the messages sent to the connections, nil sends every message
+	SendFilter SendFilter
+	// Encrypt the outgoing connections and accept the encrypted incoming connections,
+	// see secure.go
+	Encrypt bool
+	// Static key of the encrypted connections, a random key is used if empty
+	SecKey cipher.SecKey
+	// Proves the trust key of the validator to the peers of the encrypted connections,
+	// nil if this node is not a validator
+	Identity IdentityCallback
+	// Limit of the messages per second received from each connection
+	ConnectionRateLimit RateLimit
+	// Limits of the messages per second of a prefix received from each connection
+	MessageRateLimits map[MessagePrefix]RateLimit
+	// Limit of the bytes per second read from all the connections, the reads wait for it
+	InboundBandwidth RateLimit
+	// Triggered when a message over a rate limit is dropped
+	RateLimitCallback RateLimitCallback
 	// Print debug logs
 	DebugPrint bool
 }
@@ -100,6 +119,13 @@ func NewConfig() Config {
 		ConnectionWriteQueueSize: 64,
 		DisconnectCallback:       nil,
 		ConnectCallback:          nil,
+		SendFilter:               nil,
+		Encrypt:                  false,
+		Identity:                 nil,
+		ConnectionRateLimit:      RateLimit{},
+		MessageRateLimits:        nil,
+		InboundBandwidth:         RateLimit{},
+		RateLimitCallback:        nil,
 		DebugPrint:               false,
 	}
 }
@@ -126,11 +152,20 @@ type Connection struct {
 	// Message send queue.
 	WriteQueue chan Message
 	Solicited  bool
+	// Static key of the peer if the connection is encrypted
+	PubKey cipher.PubKey
+	// Trust key the peer proved in the handshake of the encrypted connection,
+	// empty if it is not a validator
+	Identity cipher.PubKey
+	// Rate limits of the messages received, nil if unlimited
+	limiter *rateLimiter
+	// Traffic received and sent
+	stats *trafficStats
 }
 
 // NewConnection creates a new Connection tied to a ConnectionPool
 func NewConnection(pool *ConnectionPool, id int, conn net.Conn, writeQueueSize int, solicited bool) *Connection {
-	return &Connection{
+	c := &Connection{
 		ID:             id,
 		Conn:           conn,
 		Buffer:         &bytes.Buffer{},
@@ -139,7 +174,13 @@ func NewConnection(pool *ConnectionPool, id int, conn net.Conn, writeQueueSize i
 		LastSent:       Now(),
 		WriteQueue:     make(chan Message, writeQueueSize),
 		Solicited:      solicited,
+		stats:          newTrafficStats(),
 	}
+	if sc, ok := conn.(*secureConn); ok {
+		c.PubKey = sc.remoteStatic
+		c.Identity = sc.identity
+	}
+	return c
 }
 
 // Addr returns remote address
@@ -147,6 +188,21 @@ func (conn *Connection) Addr() string {
 	return conn.Conn.RemoteAddr().String()
 }
 
+// Encrypted returns true if the connection is encrypted
+func (conn *Connection) Encrypted() bool {
+	return conn.PubKey != cipher.PubKey{}
+}
+
+// RateLimits returns the state of the rate limits of the messages received from the connection
+func (conn *Connection) RateLimits() []LimitStatus {
+	return conn.limiter.status(time.Now())
+}
+
+// Traffic returns the traffic received from and sent to the connection
+func (conn *Connection) Traffic() TrafficStats {
+	return conn.stats.stats(time.Now())
+}
+
 // String returns connection address
 func (conn *Connection) String() string {
 	return conn.Addr()
@@ -166,6 +222,9 @@ type DisconnectCallback func(addr string, reason DisconnectReason)
 // ConnectCallback triggered on client connect
 type ConnectCallback func(addr string, solicited bool)
 
+// SendFilter returns false if the message is not sent to the connection
+type SendFilter func(addr string, msg Message) bool
+
 // ConnectionPool connection pool
 type ConnectionPool struct {
 	// Configuration parameters
@@ -182,6 +241,10 @@ type ConnectionPool struct {
 	connID int
 	// Listening connection
 	listener net.Listener
+	// Limit of the bytes read from all the connections, nil if unlimited
+	inbound *bandwidth
+	// Traffic of all the connections
+	stats *trafficStats
 	// operations channel
 	reqC chan strand.Request
 	// quit channel
@@ -193,6 +256,10 @@ type ConnectionPool struct {
 // Config.Port upon StartListen. State is an application defined object that
 // will be passed to a Message's Handle().
 func NewConnectionPool(c Config, state interface{}) *ConnectionPool {
+	if c.Encrypt && c.SecKey == (cipher.SecKey{}) {
+		_, c.SecKey = cipher.GenerateKeyPair()
+	}
+
 	pool := &ConnectionPool{
 		Config:       c,
 		pool:         make(map[int]*Connection),
@@ -201,6 +268,10 @@ func NewConnectionPool(c Config, state interface{}) *ConnectionPool {
 		messageState: state,
 		quit:         make(chan struct{}),
 		reqC:         make(chan strand.Request),
+		stats:        newTrafficStats(),
+	}
+	if !c.InboundBandwidth.Unlimited() {
+		pool.inbound = &bandwidth{bucket: newTokenBucket(c.InboundBandwidth, time.Now())}
 	}
 
 	return pool
@@ -301,6 +372,7 @@ func (pool *ConnectionPool) NewConnection(conn net.Conn, solicited bool) (*Conne
 		}
 		pool.connID++
 		nc = NewConnection(pool, pool.connID, conn, pool.Config.ConnectionWriteQueueSize, solicited)
+		nc.limiter = newRateLimiter(pool.Config, time.Now())
 
 		pool.pool[nc.ID] = nc
 		pool.addresses[a] = nc
@@ -337,6 +409,16 @@ func (pool *ConnectionPool) handleConnection(conn net.Conn, solicited bool) {
 		return
 	}
 
+	if !solicited && pool.Config.Encrypt {
+		sc, err := pool.secureAccept(conn)
+		if err != nil {
+			logger.Infof("Secure handshake with %s failed: %v", addr, err)
+			conn.Close()
+			return
+		}
+		conn = sc
+	}
+
 	c, err := pool.NewConnection(conn, solicited)
 	if err != nil {
 		logger.Errorf("Create connection failed: %v", err)
@@ -431,6 +513,10 @@ func (pool *ConnectionPool) readLoop(conn *Connection, msgChan chan []byte, qc c
 			continue
 		}
 
+		if !pool.waitInbound(len(data), qc) {
+			return nil
+		}
+
 		// write data to buffer
 		if _, err := conn.Buffer.Write(data); err != nil {
 			return err
@@ -473,7 +559,10 @@ func (pool *ConnectionPool) sendLoop(conn *Connection, timeout time.Duration, qc
 			if m == nil {
 				continue
 			}
-			err := sendMessage(conn.Conn, m, timeout)
+			data, err := sendMessage(conn.Conn, m, timeout)
+			if err == nil {
+				pool.recordOut(conn, data)
+			}
 			sr := newSendResult(conn.Addr(), m, err)
 			select {
 			case <-qc:
@@ -494,6 +583,40 @@ func (pool *ConnectionPool) sendLoop(conn *Connection, timeout time.Duration, qc
 	}
 }
 
+// recordOut counts the encoded message sent to the connection
+func (pool *ConnectionPool) recordOut(c *Connection, data []byte) {
+	prefix := prefixOf(data[messageLengthSize:])
+	now := time.Now()
+	c.stats.recordOut(prefix, len(data), now)
+	pool.stats.recordOut(prefix, len(data), now)
+}
+
+// Traffic returns the traffic received from and sent to all the connections
+func (pool *ConnectionPool) Traffic() TrafficStats {
+	return pool.stats.stats(time.Now())
+}
+
+// waitInbound waits until the inbound bandwidth allows the n bytes read, it returns false if the
+// connection or the pool is closed meanwhile
+func (pool *ConnectionPool) waitInbound(n int, qc chan struct{}) bool {
+	if pool.inbound == nil {
+		return true
+	}
+	d := pool.inbound.wait(n, time.Now())
+	if d <= 0 {
+		return true
+	}
+
+	select {
+	case <-time.After(d):
+		return true
+	case <-qc:
+		return false
+	case <-pool.quit:
+		return false
+	}
+}
+
 func readData(reader io.Reader, buf []byte) ([]byte, error) {
 	c, err := reader.Read(buf)
 	if err != nil {
@@ -517,6 +640,9 @@ func decodeData(buf *bytes.Buffer, maxMsgLength int) ([][]byte, error) {
 	for buf.Len() > messageLengthSize {
 		//logger.Debug("There is data in the buffer, extracting")
 		prefix := buf.Bytes()[:messageLengthSize]
+		if bytes.Equal(prefix, handshakeMagic[:]) {
+			return [][]byte{}, ErrDisconnectEncrypted
+		}
 		// decode message length
 		tmpLength := uint32(0)
 		encoder.DeserializeAtomic(prefix, &tmpLength)
@@ -611,6 +737,15 @@ func (pool *ConnectionPool) Connect(address string) error {
 	if err != nil {
 		return err
 	}
+
+	if pool.Config.Encrypt {
+		sc, err := pool.secureDial(conn)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("secure handshake with %s failed: %v", address, err)
+		}
+		conn = sc
+	}
 	pool.wg.Add(1)
 	go func() {
 		defer pool.wg.Done()
@@ -674,6 +809,9 @@ func (pool *ConnectionPool) SendMessage(addr string, msg Message) error {
 
 	return pool.strand("SendMessage", func() error {
 		if conn, ok := pool.addresses[addr]; ok {
+			if !pool.canSend(addr, msg) {
+				return nil
+			}
 			select {
 			case conn.WriteQueue <- msg:
 			default:
@@ -698,6 +836,9 @@ func (pool *ConnectionPool) BroadcastMessage(msg Message) error {
 		}
 
 		for _, conn := range pool.pool {
+			if !pool.canSend(conn.Addr(), msg) {
+				continue
+			}
 			select {
 			case conn.WriteQueue <- msg:
 			default:
@@ -722,15 +863,36 @@ func (pool *ConnectionPool) BroadcastMessage(msg Message) error {
 	return nil
 }
 
-// Unpacks incoming bytes to a Message and calls the message handler.  If
-// the bytes cannot be converted to a Message, the error is returned as the
-// first return value.  Otherwise, error will be nil and DisconnectReason will
+// canSend returns true unless the SendFilter rejects the message
+func (pool *ConnectionPool) canSend(addr string, msg Message) bool {
+	return pool.Config.SendFilter == nil || pool.Config.SendFilter(addr, msg)
+}
+
+// Unpacks incoming bytes to a Message and calls the message handler.  The
+// messages over the rate limits of the connection are dropped.  If
+// the bytes cannot be converted to a Message, ErrDisconnectMalformedMessage
+// is returned.  Otherwise, error will be nil and DisconnectReason will
 // be the value returned from the message handler.
 func (pool *ConnectionPool) receiveMessage(c *Connection, msg []byte) error {
+	prefix := prefixOf(msg)
+	now := time.Now()
+	c.stats.recordIn(prefix, len(msg)+messageLengthSize, now)
+	pool.stats.recordIn(prefix, len(msg)+messageLengthSize, now)
+
+	if len(msg) >= messagePrefixLength {
+		if !c.limiter.allow(prefix, now) {
+			logger.Debugf("Dropped %s message from %s over the rate limit", string(prefix[:]), c.Addr())
+			if pool.Config.RateLimitCallback != nil {
+				pool.Config.RateLimitCallback(c.Addr(), prefix)
+			}
+			return nil
+		}
+	}
 
 	m, err := convertToMessage(c.ID, msg, pool.Config.DebugPrint)
 	if err != nil {
-		return err
+		logger.Errorf("Invalid message from %s: %v", c.Addr(), err)
+		return ErrDisconnectMalformedMessage
 	}
 	if err := pool.updateLastRecv(c.Addr(), Now()); err != nil {
 		return err
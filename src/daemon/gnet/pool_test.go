@@ -767,7 +767,7 @@ func TestPoolReceiveMessage(t *testing.T) {
 	// Invalid byte message received
 	b = []byte{1}
 	err = p.receiveMessage(c, b)
-	require.Error(t, err)
+	require.Equal(t, ErrDisconnectMalformedMessage, err)
 
 	// Valid message, but handler returns a DisconnectReason
 	b = make([]byte, 0)
@@ -943,3 +943,56 @@ func (c *ReadNothingConn) Close() error {
 func (c *ReadNothingConn) stop() {
 	c.stopReading = true
 }
+
+func TestPoolSendFilter(t *testing.T) {
+	resetHandler()
+	EraseMessages()
+	RegisterMessage(BytePrefix, ByteMessage{})
+	VerifyMessages()
+	cfg := newTestConfig()
+	p := NewConnectionPool(cfg, nil)
+
+	q := make(chan struct{})
+	go func() {
+		defer close(q)
+		p.Run()
+	}()
+	wait()
+
+	ready := make(chan struct{})
+	var i int
+	p.Config.ConnectCallback = func(addr string, solicited bool) {
+		i++
+		if i == 2 {
+			ready <- struct{}{}
+		}
+	}
+
+	filtered, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	sent, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	<-ready
+
+	p.Config.SendFilter = func(a string, msg Message) bool {
+		return a != filtered.LocalAddr().String()
+	}
+
+	m := NewByteMessage(88)
+	require.NoError(t, p.BroadcastMessage(m))
+	require.NoError(t, p.SendMessage(filtered.LocalAddr().String(), m))
+
+	buf := make([]byte, 16)
+	require.NoError(t, sent.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := sent.Read(buf)
+	require.NoError(t, err)
+	require.NotEqual(t, 0, n)
+
+	require.NoError(t, filtered.SetReadDeadline(time.Now().Add(time.Millisecond*200)))
+	_, err = filtered.Read(buf)
+	require.Error(t, err)
+	require.True(t, err.(net.Error).Timeout())
+
+	p.Shutdown()
+	<-q
+}
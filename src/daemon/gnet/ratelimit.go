@@ -0,0 +1,178 @@
+package gnet
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket, Rate tokens are added per second up to Burst tokens.
+// A zero Rate is unlimited.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited returns true if the limit does not limit anything
+func (l RateLimit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// burst returns the size of the bucket, it holds one token at least
+func (l RateLimit) burst() float64 {
+	return math.Max(float64(l.Burst), 1)
+}
+
+// RateLimitCallback triggered when a message over a rate limit of the connection is dropped
+type RateLimitCallback func(addr string, prefix MessagePrefix)
+
+// LimitStatus is the state of a rate limit of the messages received from a connection
+type LimitStatus struct {
+	// Prefix of the messages limited, empty for all the messages of the connection
+	Prefix string
+	RateLimit
+	// Tokens available, a message takes one
+	Tokens float64
+	// Messages dropped by the limit
+	Dropped uint64
+}
+
+// tokenBucket takes tokens refilled at the rate of its limit
+type tokenBucket struct {
+	limit   RateLimit
+	tokens  float64
+	updated time.Time
+	dropped uint64
+}
+
+func newTokenBucket(l RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		limit:   l,
+		tokens:  l.burst(),
+		updated: now,
+	}
+}
+
+// refill adds the tokens of the time elapsed since the last update
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(b.limit.burst(), b.tokens+elapsed.Seconds()*b.limit.Rate)
+		b.updated = now
+	}
+}
+
+// reserve takes n tokens, it returns how long to wait for the tokens taken in advance
+func (b *tokenBucket) reserve(n float64, now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+}
+
+// bandwidth limits the bytes read from all the connections of a pool
+type bandwidth struct {
+	sync.Mutex
+	bucket *tokenBucket
+}
+
+// wait returns how long to wait before reading more once n bytes were read
+func (bw *bandwidth) wait(n int, now time.Time) time.Duration {
+	bw.Lock()
+	defer bw.Unlock()
+	return bw.bucket.reserve(float64(n), now)
+}
+
+// rateLimiter limits the messages received from a connection, in all and by prefix
+type rateLimiter struct {
+	sync.Mutex
+	conn     *tokenBucket
+	messages map[MessagePrefix]*tokenBucket
+}
+
+// newRateLimiter returns the limiter of a connection, nil if nothing is limited
+func newRateLimiter(c Config, now time.Time) *rateLimiter {
+	rl := &rateLimiter{
+		messages: make(map[MessagePrefix]*tokenBucket),
+	}
+	if !c.ConnectionRateLimit.Unlimited() {
+		rl.conn = newTokenBucket(c.ConnectionRateLimit, now)
+	}
+	for prefix, l := range c.MessageRateLimits {
+		if !l.Unlimited() {
+			rl.messages[prefix] = newTokenBucket(l, now)
+		}
+	}
+	if rl.conn == nil && len(rl.messages) == 0 {
+		return nil
+	}
+	return rl
+}
+
+// allow takes a token of the connection and of the prefix, it returns false and counts the
+// message dropped if either has none
+func (rl *rateLimiter) allow(prefix MessagePrefix, now time.Time) bool {
+	if rl == nil {
+		return true
+	}
+	rl.Lock()
+	defer rl.Unlock()
+
+	buckets := []*tokenBucket{}
+	if b, ok := rl.messages[prefix]; ok {
+		buckets = append(buckets, b)
+	}
+	if rl.conn != nil {
+		buckets = append(buckets, rl.conn)
+	}
+
+	for _, b := range buckets {
+		b.refill(now)
+		if b.tokens < 1 {
+			b.dropped++
+			return false
+		}
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true
+}
+
+// status returns the state of the limit of the connection then of the limits of the prefixes
+func (rl *rateLimiter) status(now time.Time) []LimitStatus {
+	if rl == nil {
+		return nil
+	}
+	rl.Lock()
+	defer rl.Unlock()
+
+	status := func(prefix string, b *tokenBucket) LimitStatus {
+		b.refill(now)
+		return LimitStatus{
+			Prefix:    prefix,
+			RateLimit: b.limit,
+			Tokens:    b.tokens,
+			Dropped:   b.dropped,
+		}
+	}
+
+	s := []LimitStatus{}
+	if rl.conn != nil {
+		s = append(s, status("", rl.conn))
+	}
+	prefixes := make([]MessagePrefix, 0, len(rl.messages))
+	for prefix := range rl.messages {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return string(prefixes[i][:]) < string(prefixes[j][:])
+	})
+	for _, prefix := range prefixes {
+		s = append(s, status(strings.TrimRight(string(prefix[:]), "\x00"), rl.messages[prefix]))
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package gnet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(RateLimit{Rate: 100, Burst: 50}, now)
+
+	require.Equal(t, time.Duration(0), b.reserve(50, now))
+	// the tokens taken in advance are waited for
+	require.Equal(t, time.Millisecond*100, b.reserve(10, now))
+
+	// the bucket does not hold more than the burst
+	now = now.Add(time.Hour)
+	require.Equal(t, time.Duration(0), b.reserve(50, now))
+	require.Equal(t, time.Millisecond*10, b.reserve(1, now))
+}
+
+func TestRateLimiter(t *testing.T) {
+	require.Nil(t, newRateLimiter(NewConfig(), time.Now()))
+	var nilLimiter *rateLimiter
+	require.True(t, nilLimiter.allow(BytePrefix, time.Now()))
+	require.Nil(t, nilLimiter.status(time.Now()))
+
+	cfg := NewConfig()
+	cfg.ConnectionRateLimit = RateLimit{Rate: 10, Burst: 3}
+	cfg.MessageRateLimits = map[MessagePrefix]RateLimit{
+		BytePrefix:  {Rate: 1, Burst: 2},
+		DummyPrefix: {},
+	}
+	now := time.Now()
+	rl := newRateLimiter(cfg, now)
+	require.NotNil(t, rl)
+	// the unlimited prefixes have no bucket
+	require.Len(t, rl.messages, 1)
+
+	require.True(t, rl.allow(BytePrefix, now))
+	require.True(t, rl.allow(BytePrefix, now))
+	require.False(t, rl.allow(BytePrefix, now))
+	// the limit of the connection counts the messages of every prefix
+	require.True(t, rl.allow(DummyPrefix, now))
+	require.False(t, rl.allow(DummyPrefix, now))
+
+	require.Equal(t, []LimitStatus{
+		{Prefix: "", RateLimit: cfg.ConnectionRateLimit, Tokens: 0, Dropped: 1},
+		{Prefix: string(BytePrefix[:]), RateLimit: RateLimit{Rate: 1, Burst: 2}, Tokens: 0, Dropped: 1},
+	}, rl.status(now))
+
+	now = now.Add(time.Second)
+	require.True(t, rl.allow(BytePrefix, now))
+	require.False(t, rl.allow(BytePrefix, now))
+}
+
+func TestPoolReceiveMessageRateLimit(t *testing.T) {
+	resetHandler()
+	EraseMessages()
+	RegisterMessage(BytePrefix, ByteMessage{})
+	VerifyMessages()
+
+	cfg := newTestConfig()
+	cfg.MessageRateLimits = map[MessagePrefix]RateLimit{
+		BytePrefix: {Rate: 0.001, Burst: 1},
+	}
+	var dropped []MessagePrefix
+	cfg.RateLimitCallback = func(addr string, prefix MessagePrefix) {
+		dropped = append(dropped, prefix)
+	}
+	p := NewConnectionPool(cfg, nil)
+
+	q := make(chan struct{})
+	go func() {
+		defer close(q)
+		p.RunOffline()
+	}()
+	defer func() {
+		p.Shutdown()
+		<-q
+	}()
+
+	c := NewConnection(p, 1, NewDummyConn(addr), 10, true)
+	c.limiter = newRateLimiter(cfg, time.Now())
+
+	b := append([]byte{}, BytePrefix[:]...)
+	b = append(b, byte(7))
+	require.NoError(t, p.receiveMessage(c, b))
+	require.Empty(t, dropped)
+
+	// the message over the limit is dropped without disconnecting the peer
+	require.NoError(t, p.receiveMessage(c, b))
+	require.Equal(t, []MessagePrefix{BytePrefix}, dropped)
+	require.Equal(t, uint64(1), c.RateLimits()[0].Dropped)
+}
@@ -0,0 +1,380 @@
+package gnet
+
+import (
+	"bytes"
+	gocipher "crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/chacha20poly1305"
+)
+
+// The secure transport encrypts a connection with ChaCha20-Poly1305. The dialer sends the
+// handshake magic, then both ends send their ephemeral and static public keys. The keys of the
+// two directions are derived from the ECDH of the ephemeral keys and of each ephemeral key with
+// the static key of the other end, so only the owners of the static keys can read and write the
+// records of the session. In its first record each end sends the trust key of its validator and
+// a signature of the session with it, or nothing if it is not a validator.
+
+const (
+	secureVersion = 1
+	// helloSize is the magic, the version, the ephemeral and the static public keys
+	helloSize = len(handshakeMagic) + 1 + 2*len(cipher.PubKey{})
+	// identitySize is the trust key and its signature of the session
+	identitySize = len(cipher.PubKey{}) + len(cipher.Sig{})
+	// maxRecordSize is the limit of the plaintext of a record, a larger write is split
+	maxRecordSize = 64 * 1024
+	// recordLengthSize is the byte size of the length prefix of a record
+	recordLengthSize = 4
+	// handshakeTimeout is how long the handshake may take, the remote signer of a validator
+	// may be asked to sign the session
+	handshakeTimeout = 20 * time.Second
+	// identityDomain separates the signatures of the identities from the other signatures
+	// of the trust keys
+	identityDomain = "samos-gnet-identity"
+)
+
+var (
+	// handshakeMagic starts a secure connection. Read as a message length it is longer than
+	// any message, so a peer speaking plaintext rejects it.
+	handshakeMagic = [4]byte{'S', 'M', 'O', 'S'}
+
+	// ErrDisconnectEncrypted the peer asked for a secure connection this node does not accept
+	ErrDisconnectEncrypted DisconnectReason = errors.New("Encrypted connection not supported")
+	// ErrInvalidHandshake the handshake of a secure connection is malformed
+	ErrInvalidHandshake = errors.New("Invalid secure handshake")
+	// ErrInvalidIdentity the trust key of the peer is not proved by its signature of the session
+	ErrInvalidIdentity = errors.New("Invalid identity proof")
+	// ErrInvalidRecord a record of a secure connection is too long or was altered
+	ErrInvalidRecord = errors.New("Invalid secure record")
+)
+
+// IdentityCallback returns the trust key of the validator and its signature of
+// IdentityHash(session), or an empty key if this node is not a validator
+type IdentityCallback func(session cipher.SHA256) (cipher.PubKey, cipher.Sig, error)
+
+// IdentityHash returns the hash signed with a trust key to prove it in the session
+func IdentityHash(session cipher.SHA256) cipher.SHA256 {
+	return cipher.SumSHA256(append([]byte(identityDomain), session[:]...))
+}
+
+// secureConn encrypts the data written to and decrypts the data read from a connection.
+// Like the connection, it supports a reader and a writer at the same time but not two readers
+// or two writers.
+type secureConn struct {
+	net.Conn
+	send      gocipher.AEAD
+	recv      gocipher.AEAD
+	sendNonce uint64
+	recvNonce uint64
+	// plaintext of the last record not read yet
+	plain []byte
+	// static key of the peer
+	remoteStatic cipher.PubKey
+	// trust key proved by the peer, empty if it is not a validator
+	identity cipher.PubKey
+}
+
+// peekedConn is a connection whose first bytes were read to look for the handshake magic
+type peekedConn struct {
+	net.Conn
+	peeked []byte
+}
+
+// Read returns the peeked bytes before reading the connection
+func (c *peekedConn) Read(b []byte) (int, error) {
+	if len(c.peeked) > 0 {
+		n := copy(b, c.peeked)
+		c.peeked = c.peeked[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// hello is the handshake message of an end
+type hello struct {
+	ephemeral cipher.PubKey
+	static    cipher.PubKey
+}
+
+func (h hello) bytes() []byte {
+	b := make([]byte, 0, helloSize)
+	b = append(b, handshakeMagic[:]...)
+	b = append(b, secureVersion)
+	b = append(b, h.ephemeral[:]...)
+	return append(b, h.static[:]...)
+}
+
+// parseHello parses the hello b, its magic is checked by the caller
+func parseHello(b []byte) (hello, error) {
+	if len(b) != helloSize {
+		return hello{}, ErrInvalidHandshake
+	}
+	b = b[len(handshakeMagic):]
+	if b[0] != secureVersion {
+		return hello{}, fmt.Errorf("Secure transport version %d not supported", b[0])
+	}
+	b = b[1:]
+
+	var h hello
+	copy(h.ephemeral[:], b)
+	copy(h.static[:], b[len(h.ephemeral):])
+	if h.ephemeral.Verify() != nil || h.static.Verify() != nil {
+		return hello{}, ErrInvalidHandshake
+	}
+	return h, nil
+}
+
+// secureDial runs the handshake of the dialer on the connection
+func (pool *ConnectionPool) secureDial(conn net.Conn) (*secureConn, error) {
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return nil, err
+	}
+
+	local, ephSec := pool.newHello()
+	if _, err := conn.Write(local.bytes()); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, helloSize)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b[:len(handshakeMagic)], handshakeMagic[:]) {
+		return nil, ErrInvalidHandshake
+	}
+	remote, err := parseHello(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return pool.finishHandshake(conn, true, local, remote, ephSec)
+}
+
+// secureAccept runs the handshake of the listener if the peer starts with the handshake magic,
+// the connection is returned unchanged otherwise
+func (pool *ConnectionPool) secureAccept(conn net.Conn) (net.Conn, error) {
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, helloSize)
+	if _, err := io.ReadFull(conn, b[:len(handshakeMagic)]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b[:len(handshakeMagic)], handshakeMagic[:]) {
+		if err := conn.SetDeadline(time.Time{}); err != nil {
+			return nil, err
+		}
+		return &peekedConn{Conn: conn, peeked: b[:len(handshakeMagic)]}, nil
+	}
+
+	if _, err := io.ReadFull(conn, b[len(handshakeMagic):]); err != nil {
+		return nil, err
+	}
+	remote, err := parseHello(b)
+	if err != nil {
+		return nil, err
+	}
+
+	local, ephSec := pool.newHello()
+	if _, err := conn.Write(local.bytes()); err != nil {
+		return nil, err
+	}
+
+	return pool.finishHandshake(conn, false, local, remote, ephSec)
+}
+
+// newHello returns the hello of this node with a new ephemeral key and its secret key
+func (pool *ConnectionPool) newHello() (hello, cipher.SecKey) {
+	ephPub, ephSec := cipher.GenerateKeyPair()
+	return hello{
+		ephemeral: ephPub,
+		static:    cipher.PubKeyFromSecKey(pool.Config.SecKey),
+	}, ephSec
+}
+
+// finishHandshake derives the keys of the session and exchanges the identities of the validators
+func (pool *ConnectionPool) finishHandshake(conn net.Conn, initiator bool, local, remote hello, ephSec cipher.SecKey) (*secureConn, error) {
+	var ee, es, se []byte
+	var transcript cipher.SHA256
+	if initiator {
+		transcript = cipher.SumSHA256(append(local.bytes(), remote.bytes()...))
+		ee = cipher.ECDH(remote.ephemeral, ephSec)
+		es = cipher.ECDH(remote.static, ephSec)
+		se = cipher.ECDH(remote.ephemeral, pool.Config.SecKey)
+	} else {
+		transcript = cipher.SumSHA256(append(remote.bytes(), local.bytes()...))
+		ee = cipher.ECDH(remote.ephemeral, ephSec)
+		es = cipher.ECDH(remote.ephemeral, pool.Config.SecKey)
+		se = cipher.ECDH(remote.static, ephSec)
+	}
+
+	secret := append(transcript[:], ee...)
+	secret = append(secret, es...)
+	secret = append(secret, se...)
+	key := cipher.SumSHA256(secret)
+
+	initiatorAEAD, err := chacha20poly1305.New(directionKey(key, true))
+	if err != nil {
+		return nil, err
+	}
+	responderAEAD, err := chacha20poly1305.New(directionKey(key, false))
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &secureConn{
+		Conn:         conn,
+		send:         initiatorAEAD,
+		recv:         responderAEAD,
+		remoteStatic: remote.static,
+	}
+	if !initiator {
+		sc.send, sc.recv = responderAEAD, initiatorAEAD
+	}
+
+	if err := sc.writeRecord(pool.identity(sessionHash(transcript, initiator))); err != nil {
+		return nil, err
+	}
+
+	b, err := sc.readRecord()
+	if err != nil {
+		return nil, err
+	}
+	switch len(b) {
+	case 0:
+	case identitySize:
+		var pk cipher.PubKey
+		var sig cipher.Sig
+		copy(pk[:], b)
+		copy(sig[:], b[len(pk):])
+		if pk.Verify() != nil {
+			return nil, ErrInvalidIdentity
+		}
+		if err := cipher.VerifySignature(pk, sig, IdentityHash(sessionHash(transcript, !initiator))); err != nil {
+			return nil, ErrInvalidIdentity
+		}
+		sc.identity = pk
+	default:
+		return nil, ErrInvalidIdentity
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// identity returns the trust key and its signature of the session, or nothing if this node is
+// not a validator
+func (pool *ConnectionPool) identity(session cipher.SHA256) []byte {
+	if pool.Config.Identity == nil {
+		return nil
+	}
+	pk, sig, err := pool.Config.Identity(session)
+	if err != nil {
+		logger.Errorf("Prove identity failed: %v", err)
+		return nil
+	}
+	if pk == (cipher.PubKey{}) {
+		return nil
+	}
+	return append(pk[:], sig[:]...)
+}
+
+// directionKey returns the key of the records sent by the initiator or by the responder
+func directionKey(key cipher.SHA256, initiator bool) []byte {
+	dir := []byte("responder")
+	if initiator {
+		dir = []byte("initiator")
+	}
+	k := cipher.SumSHA256(append(key[:], dir...))
+	return k[:]
+}
+
+// sessionHash returns the session an end proves its identity in, it differs for each end
+// so a proof is not sent back to its signer
+func sessionHash(transcript cipher.SHA256, initiator bool) cipher.SHA256 {
+	role := byte(0)
+	if initiator {
+		role = 1
+	}
+	return cipher.SumSHA256(append(transcript[:], role))
+}
+
+// nonce returns the nonce of the record number n
+func nonce(n uint64) []byte {
+	b := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(b[chacha20poly1305.NonceSize-8:], n)
+	return b
+}
+
+// writeRecord encrypts the data into a record
+func (c *secureConn) writeRecord(data []byte) error {
+	b := make([]byte, recordLengthSize, recordLengthSize+len(data)+c.send.Overhead())
+	b = c.send.Seal(b, nonce(c.sendNonce), data, nil)
+	binary.LittleEndian.PutUint32(b, uint32(len(b)-recordLengthSize))
+	c.sendNonce++
+
+	_, err := c.Conn.Write(b)
+	return err
+}
+
+// readRecord reads and decrypts a record
+func (c *secureConn) readRecord() ([]byte, error) {
+	var prefix [recordLengthSize]byte
+	if _, err := io.ReadFull(c.Conn, prefix[:]); err != nil {
+		return nil, err
+	}
+	length := int(binary.LittleEndian.Uint32(prefix[:]))
+	if length < c.recv.Overhead() || length > maxRecordSize+c.recv.Overhead() {
+		return nil, ErrInvalidRecord
+	}
+
+	b := make([]byte, length)
+	if _, err := io.ReadFull(c.Conn, b); err != nil {
+		return nil, err
+	}
+	data, err := c.recv.Open(b[:0], nonce(c.recvNonce), b, nil)
+	if err != nil {
+		return nil, ErrInvalidRecord
+	}
+	c.recvNonce++
+	return data, nil
+}
+
+// Read reads the decrypted data
+func (c *secureConn) Read(b []byte) (int, error) {
+	for len(c.plain) == 0 {
+		data, err := c.readRecord()
+		if err != nil {
+			return 0, err
+		}
+		c.plain = data
+	}
+	n := copy(b, c.plain)
+	c.plain = c.plain[n:]
+	return n, nil
+}
+
+// Write encrypts the data into records of maxRecordSize at most
+func (c *secureConn) Write(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		end := n + maxRecordSize
+		if end > len(b) {
+			end = len(b)
+		}
+		if err := c.writeRecord(b[n:end]); err != nil {
+			return n, err
+		}
+		n = end
+	}
+	return n, nil
+}
@@ -0,0 +1,163 @@
+package gnet
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+)
+
+// tcpPair returns both ends of a local tcp connection
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		require.NoError(t, err)
+		accepted <- c
+	}()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	return c, <-accepted
+}
+
+func newSecurePool(identity IdentityCallback) *ConnectionPool {
+	cfg := newTestConfig()
+	cfg.Encrypt = true
+	cfg.Identity = identity
+	return NewConnectionPool(cfg, nil)
+}
+
+// validatorIdentity proves the trust key of the secret key
+func validatorIdentity(sk cipher.SecKey) IdentityCallback {
+	return func(session cipher.SHA256) (cipher.PubKey, cipher.Sig, error) {
+		return cipher.PubKeyFromSecKey(sk), cipher.SignHash(IdentityHash(session), sk), nil
+	}
+}
+
+// handshake runs the handshake of the dialer and of the listener, it returns the connections
+// of the dialer and the listener and the error of the listener
+func handshake(t *testing.T, dialer, listener *ConnectionPool) (*secureConn, net.Conn, error) {
+	c, s := tcpPair(t)
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		conn, err := listener.secureAccept(s)
+		if err != nil {
+			s.Close()
+		}
+		accepted <- result{conn, err}
+	}()
+
+	sc, err := dialer.secureDial(c)
+	r := <-accepted
+	if r.err == nil {
+		require.NoError(t, err)
+	}
+	return sc, r.conn, r.err
+}
+
+func TestSecureHandshake(t *testing.T) {
+	_, trustSec := cipher.GenerateKeyPair()
+	dialer := newSecurePool(nil)
+	listener := newSecurePool(validatorIdentity(trustSec))
+	require.NotEqual(t, cipher.SecKey{}, dialer.Config.SecKey)
+
+	c, conn, err := handshake(t, dialer, listener)
+	require.NoError(t, err)
+	s := conn.(*secureConn)
+	defer c.Close()
+	defer s.Close()
+
+	require.Equal(t, cipher.PubKeyFromSecKey(listener.Config.SecKey), c.remoteStatic)
+	require.Equal(t, cipher.PubKeyFromSecKey(dialer.Config.SecKey), s.remoteStatic)
+	// only the validator proves a trust key
+	require.Equal(t, cipher.PubKeyFromSecKey(trustSec), c.identity)
+	require.Equal(t, cipher.PubKey{}, s.identity)
+
+	nc := NewConnection(dialer, 1, c, 1, true)
+	require.True(t, nc.Encrypted())
+	require.Equal(t, c.remoteStatic, nc.PubKey)
+	require.Equal(t, c.identity, nc.Identity)
+
+	// the writes longer than a record are split
+	data := bytes.Repeat([]byte{1, 2, 3}, maxRecordSize)
+	go func() {
+		_, err := c.Write(data)
+		require.NoError(t, err)
+	}()
+	b := make([]byte, len(data))
+	_, err = io.ReadFull(s, b)
+	require.NoError(t, err)
+	require.Equal(t, data, b)
+
+	_, err = s.Write([]byte("pong"))
+	require.NoError(t, err)
+	b = make([]byte, 4)
+	_, err = io.ReadFull(c, b)
+	require.NoError(t, err)
+	require.Equal(t, []byte("pong"), b)
+
+	// the records are authenticated
+	_, err = c.Conn.Write([]byte{20, 0, 0, 0})
+	require.NoError(t, err)
+	_, err = c.Conn.Write(make([]byte, 20))
+	require.NoError(t, err)
+	_, err = s.Read(b)
+	require.Equal(t, ErrInvalidRecord, err)
+}
+
+func TestSecureHandshakeInvalidIdentity(t *testing.T) {
+	_, trustSec := cipher.GenerateKeyPair()
+	// the proof of another session is replayed
+	replayed := func(session cipher.SHA256) (cipher.PubKey, cipher.Sig, error) {
+		return validatorIdentity(trustSec)(cipher.SumSHA256([]byte("session")))
+	}
+
+	c, _, err := handshake(t, newSecurePool(replayed), newSecurePool(nil))
+	require.Equal(t, ErrInvalidIdentity, err)
+	if c != nil {
+		c.Close()
+	}
+}
+
+func TestSecureAcceptPlaintext(t *testing.T) {
+	c, s := tcpPair(t)
+	defer c.Close()
+	defer s.Close()
+
+	data := []byte{7, 0, 0, 0, 'P', 'I', 'N', 'G'}
+	_, err := c.Write(data)
+	require.NoError(t, err)
+
+	conn, err := newSecurePool(nil).secureAccept(s)
+	require.NoError(t, err)
+	_, ok := conn.(*peekedConn)
+	require.True(t, ok)
+
+	// the bytes read to look for the handshake magic are read again
+	b := make([]byte, len(data))
+	_, err = io.ReadFull(conn, b)
+	require.NoError(t, err)
+	require.Equal(t, data, b)
+	require.False(t, NewConnection(nil, 1, conn, 1, false).Encrypted())
+}
+
+func TestDecodeDataHandshakeMagic(t *testing.T) {
+	// a peer speaking plaintext rejects the secure handshake
+	buf := bytes.NewBuffer(hello{}.bytes())
+	_, err := decodeData(buf, 256*1024)
+	require.Equal(t, ErrDisconnectEncrypted, err)
+}
@@ -0,0 +1,176 @@
+package gnet
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrafficWindows are the recent windows the rates of the traffic are measured over
+var TrafficWindows = []time.Duration{10 * time.Second, time.Minute}
+
+// trafficSlots is the number of one second slots kept, it covers the longest window
+const trafficSlots = 60
+
+// Rate is the traffic per second over a recent window
+type Rate struct {
+	Window   time.Duration
+	Messages float64
+	Bytes    float64
+}
+
+// Traffic is the count of the messages and bytes in one direction, bytes include
+// the length prefix of the messages
+type Traffic struct {
+	Messages uint64
+	Bytes    uint64
+	// Rates over each of the TrafficWindows
+	Rates []Rate
+}
+
+// TrafficStats is the traffic received and sent, in all and by message prefix
+type TrafficStats struct {
+	In  Traffic
+	Out Traffic
+	// Traffic of each prefix received and sent, the NULs of the prefixes are trimmed
+	MessagesIn  map[string]Traffic
+	MessagesOut map[string]Traffic
+}
+
+// trafficSlot is the traffic of one second
+type trafficSlot struct {
+	second   int64
+	messages uint64
+	bytes    uint64
+}
+
+// counter counts the traffic since its creation and over the last trafficSlots seconds
+type counter struct {
+	messages uint64
+	bytes    uint64
+	slots    [trafficSlots]trafficSlot
+}
+
+// add counts a message of n bytes
+func (c *counter) add(n int, now time.Time) {
+	c.messages++
+	c.bytes += uint64(n)
+
+	sec := now.Unix()
+	s := &c.slots[sec%trafficSlots]
+	if s.second != sec {
+		*s = trafficSlot{second: sec}
+	}
+	s.messages++
+	s.bytes += uint64(n)
+}
+
+// traffic returns the totals and the rates over the windows ending at the current second
+func (c *counter) traffic(now time.Time) Traffic {
+	t := Traffic{
+		Messages: c.messages,
+		Bytes:    c.bytes,
+		Rates:    make([]Rate, 0, len(TrafficWindows)),
+	}
+
+	sec := now.Unix()
+	for _, w := range TrafficWindows {
+		n := int64(w / time.Second)
+		if n > trafficSlots {
+			n = trafficSlots
+		}
+		var messages, bytes uint64
+		for _, s := range c.slots {
+			if s.second > sec-n && s.second <= sec {
+				messages += s.messages
+				bytes += s.bytes
+			}
+		}
+		t.Rates = append(t.Rates, Rate{
+			Window:   w,
+			Messages: float64(messages) / float64(n),
+			Bytes:    float64(bytes) / float64(n),
+		})
+	}
+	return t
+}
+
+// trafficStats counts the traffic of a connection or of a pool
+type trafficStats struct {
+	sync.Mutex
+	in          counter
+	out         counter
+	messagesIn  map[MessagePrefix]*counter
+	messagesOut map[MessagePrefix]*counter
+}
+
+func newTrafficStats() *trafficStats {
+	return &trafficStats{
+		messagesIn:  make(map[MessagePrefix]*counter),
+		messagesOut: make(map[MessagePrefix]*counter),
+	}
+}
+
+// recordIn counts a message of the prefix and of n bytes received
+func (ts *trafficStats) recordIn(prefix MessagePrefix, n int, now time.Time) {
+	if ts == nil {
+		return
+	}
+	ts.Lock()
+	defer ts.Unlock()
+	ts.in.add(n, now)
+	record(ts.messagesIn, prefix, n, now)
+}
+
+// recordOut counts a message of the prefix and of n bytes sent
+func (ts *trafficStats) recordOut(prefix MessagePrefix, n int, now time.Time) {
+	if ts == nil {
+		return
+	}
+	ts.Lock()
+	defer ts.Unlock()
+	ts.out.add(n, now)
+	record(ts.messagesOut, prefix, n, now)
+}
+
+func record(counters map[MessagePrefix]*counter, prefix MessagePrefix, n int, now time.Time) {
+	c, ok := counters[prefix]
+	if !ok {
+		c = &counter{}
+		counters[prefix] = c
+	}
+	c.add(n, now)
+}
+
+// stats returns the traffic counted
+func (ts *trafficStats) stats(now time.Time) TrafficStats {
+	if ts == nil {
+		ts = newTrafficStats()
+	}
+	ts.Lock()
+	defer ts.Unlock()
+
+	byPrefix := func(counters map[MessagePrefix]*counter) map[string]Traffic {
+		m := make(map[string]Traffic, len(counters))
+		for prefix, c := range counters {
+			m[strings.TrimRight(string(prefix[:]), "\x00")] = c.traffic(now)
+		}
+		return m
+	}
+
+	return TrafficStats{
+		In:          ts.in.traffic(now),
+		Out:         ts.out.traffic(now),
+		MessagesIn:  byPrefix(ts.messagesIn),
+		MessagesOut: byPrefix(ts.messagesOut),
+	}
+}
+
+// prefixOf returns the prefix of the encoded message, it is empty if the data is too short
+func prefixOf(data []byte) MessagePrefix {
+	var prefix MessagePrefix
+	if len(data) >= messagePrefixLength {
+		copy(prefix[:], data)
+	}
+	return prefix
+}
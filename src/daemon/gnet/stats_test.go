@@ -0,0 +1,104 @@
+package gnet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterTraffic(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := &counter{}
+
+	// the traffic older than the longest window is only in the totals,
+	// its slot is reused by the current second
+	c.add(1000, now.Add(-2*time.Minute))
+	// 20 messages of 10 bytes a second for the last 20 seconds
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			c.add(10, now.Add(time.Duration(i-19)*time.Second))
+		}
+	}
+
+	tr := c.traffic(now)
+	require.Equal(t, uint64(401), tr.Messages)
+	require.Equal(t, uint64(5000), tr.Bytes)
+	require.Equal(t, []Rate{
+		{Window: 10 * time.Second, Messages: 20, Bytes: 200},
+		{Window: time.Minute, Messages: 400.0 / 60, Bytes: 4000.0 / 60},
+	}, tr.Rates)
+
+	// the rates fall once the traffic is out of the windows
+	tr = c.traffic(now.Add(time.Minute))
+	require.Equal(t, uint64(401), tr.Messages)
+	require.Equal(t, []Rate{
+		{Window: 10 * time.Second},
+		{Window: time.Minute},
+	}, tr.Rates)
+}
+
+func TestTrafficStats(t *testing.T) {
+	now := time.Now()
+	ts := newTrafficStats()
+	ts.recordIn(BytePrefix, 9, now)
+	ts.recordIn(BytePrefix, 9, now)
+	ts.recordIn(MessagePrefix{'P', 'I', 0, 0}, 8, now)
+	ts.recordOut(DummyPrefix, 12, now)
+
+	s := ts.stats(now)
+	require.Equal(t, uint64(3), s.In.Messages)
+	require.Equal(t, uint64(26), s.In.Bytes)
+	require.Equal(t, uint64(1), s.Out.Messages)
+	require.Len(t, s.MessagesIn, 2)
+	require.Equal(t, uint64(18), s.MessagesIn["BYTE"].Bytes)
+	require.Equal(t, uint64(1), s.MessagesIn["PI"].Messages)
+	require.Len(t, s.MessagesOut, 1)
+	require.Equal(t, uint64(12), s.MessagesOut[string(DummyPrefix[:])].Bytes)
+
+	// the connections made without a pool count nothing
+	var nilStats *trafficStats
+	nilStats.recordIn(BytePrefix, 9, now)
+	require.Equal(t, uint64(0), nilStats.stats(now).In.Messages)
+}
+
+func TestPoolTraffic(t *testing.T) {
+	resetHandler()
+	EraseMessages()
+	RegisterMessage(BytePrefix, ByteMessage{})
+	VerifyMessages()
+
+	cfg := newTestConfig()
+	cfg.MessageRateLimits = map[MessagePrefix]RateLimit{
+		BytePrefix: {Rate: 0.001, Burst: 1},
+	}
+	p := NewConnectionPool(cfg, nil)
+
+	q := make(chan struct{})
+	go func() {
+		defer close(q)
+		p.RunOffline()
+	}()
+	defer func() {
+		p.Shutdown()
+		<-q
+	}()
+
+	c := NewConnection(p, 1, NewDummyConn(addr), 10, true)
+	c.limiter = newRateLimiter(cfg, time.Now())
+
+	b := append([]byte{}, BytePrefix[:]...)
+	b = append(b, byte(7))
+	require.NoError(t, p.receiveMessage(c, b))
+	// the messages dropped by the rate limits are counted
+	require.NoError(t, p.receiveMessage(c, b))
+	p.recordOut(c, EncodeMessage(NewByteMessage(7)))
+
+	for _, s := range []TrafficStats{c.Traffic(), p.Traffic()} {
+		require.Equal(t, uint64(2), s.In.Messages)
+		require.Equal(t, uint64(18), s.In.Bytes)
+		require.Equal(t, uint64(2), s.MessagesIn["BYTE"].Messages)
+		require.Equal(t, uint64(1), s.Out.Messages)
+		require.Equal(t, uint64(9), s.MessagesOut["BYTE"].Bytes)
+	}
+}
@@ -0,0 +1,41 @@
+package daemon
+
+import (
+	"github.com/samoslab/samos/src/cipher"
+)
+
+// proveIdentity signs the session of an encrypted connection with the trust key, the key is
+// empty if this node is not a validator. It is called by the handshakes of the connection pool.
+func (dm *Daemon) proveIdentity(session cipher.SHA256) (cipher.PubKey, cipher.Sig, error) {
+	if !dm.Visor.v.Config.IsMaster {
+		return cipher.PubKey{}, cipher.Sig{}, nil
+	}
+	return dm.Visor.v.SignIdentity(session)
+}
+
+// recordIdentity records the key the peer proved in the handshake, the peer may become or cease
+// to be a validator while it is connected
+func (dm *Daemon) recordIdentity(addr string) {
+	c, err := dm.Pool.Pool.GetConnection(addr)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if c == nil || c.Identity == (cipher.PubKey{}) {
+		return
+	}
+
+	if dm.Visor.v.IsTrustPubkey(c.Identity) {
+		logger.Infof("%s proved the trust key %s", addr, c.Identity.Hex())
+	} else {
+		logger.Infof("%s proved the key %s, it is not a validator", addr, c.Identity.Hex())
+	}
+	dm.connectionIdentities.Add(addr, c.Identity)
+}
+
+// isValidatorLink returns true if the peer proved a key which is the trust key of a validator
+// now, the validators change at each epoch
+func (dm *Daemon) isValidatorLink(addr string) bool {
+	pk, ok := dm.connectionIdentities.Get(addr)
+	return ok && dm.Visor.v.IsTrustPubkey(pk)
+}
@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samoslab/samos/src/daemon/gnet"
+)
+
+// latencyBuckets are the upper bounds of the buckets of the handler latencies,
+// a last bucket counts the slower handlings
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// HandlerLatency is the histogram of the time the daemon took to process a message
+type HandlerLatency struct {
+	Message string `json:"message"`
+	Count   uint64 `json:"count"`
+	// Mean and max durations in milliseconds
+	Mean    float64         `json:"mean_ms"`
+	Max     float64         `json:"max_ms"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// LatencyBucket counts the messages processed within its bound, and slower than the bound of
+// the previous bucket
+type LatencyBucket struct {
+	// Upper bound of the bucket, "+Inf" for the last one
+	LE    string `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+// latencyHistogram counts the durations of the processing of a message
+type latencyHistogram struct {
+	count   uint64
+	total   time.Duration
+	max     time.Duration
+	buckets []uint64
+}
+
+func (h *latencyHistogram) add(d time.Duration) {
+	h.count++
+	h.total += d
+	if d > h.max {
+		h.max = d
+	}
+	i := sort.Search(len(latencyBuckets), func(i int) bool {
+		return d <= latencyBuckets[i]
+	})
+	h.buckets[i]++
+}
+
+// HandlerLatencies records the time the daemon takes to process the messages, by prefix
+type HandlerLatencies struct {
+	histograms map[string]*latencyHistogram
+	lk         sync.Mutex
+}
+
+// NewHandlerLatencies creates HandlerLatencies instance
+func NewHandlerLatencies() *HandlerLatencies {
+	return &HandlerLatencies{
+		histograms: make(map[string]*latencyHistogram),
+	}
+}
+
+// Record adds the duration of the processing of a message of the prefix
+func (hl *HandlerLatencies) Record(prefix string, d time.Duration) {
+	hl.lk.Lock()
+	defer hl.lk.Unlock()
+
+	h, ok := hl.histograms[prefix]
+	if !ok {
+		h = &latencyHistogram{
+			buckets: make([]uint64, len(latencyBuckets)+1),
+		}
+		hl.histograms[prefix] = h
+	}
+	h.add(d)
+}
+
+// Get returns the histograms of the messages processed, sorted by prefix
+func (hl *HandlerLatencies) Get() []HandlerLatency {
+	hl.lk.Lock()
+	defer hl.lk.Unlock()
+
+	latencies := make([]HandlerLatency, 0, len(hl.histograms))
+	for prefix, h := range hl.histograms {
+		buckets := make([]LatencyBucket, len(h.buckets))
+		for i, n := range h.buckets {
+			le := "+Inf"
+			if i < len(latencyBuckets) {
+				le = latencyBuckets[i].String()
+			}
+			buckets[i] = LatencyBucket{
+				LE:    le,
+				Count: n,
+			}
+		}
+
+		latencies = append(latencies, HandlerLatency{
+			Message: prefix,
+			Count:   h.count,
+			Mean:    milliseconds(h.total / time.Duration(h.count)),
+			Max:     milliseconds(h.max),
+			Buckets: buckets,
+		})
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i].Message < latencies[j].Message
+	})
+	return latencies
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// messagePrefix returns the prefix a message is registered with
+func messagePrefix(m interface{}) string {
+	prefix := gnet.MessageIDMap[reflect.Indirect(reflect.ValueOf(m)).Type()]
+	return strings.TrimRight(string(prefix[:]), "\x00")
+}
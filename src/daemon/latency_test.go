@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/daemon/gnet"
+)
+
+func TestHandlerLatencies(t *testing.T) {
+	hl := NewHandlerLatencies()
+	require.Empty(t, hl.Get())
+
+	hl.Record("GIVB", 3*time.Millisecond)
+	hl.Record("GIVB", 7*time.Millisecond)
+	hl.Record("GIVB", 10*time.Millisecond)
+	hl.Record("GIVB", time.Minute)
+	hl.Record("PING", time.Millisecond)
+
+	latencies := hl.Get()
+	require.Len(t, latencies, 2)
+
+	givb := latencies[0]
+	require.Equal(t, "GIVB", givb.Message)
+	require.Equal(t, uint64(4), givb.Count)
+	require.Equal(t, 15005.0, givb.Mean)
+	require.Equal(t, 60000.0, givb.Max)
+	require.Equal(t, []LatencyBucket{
+		{LE: "1ms", Count: 0},
+		{LE: "5ms", Count: 1},
+		{LE: "10ms", Count: 2},
+		{LE: "50ms", Count: 0},
+		{LE: "100ms", Count: 0},
+		{LE: "500ms", Count: 0},
+		{LE: "1s", Count: 0},
+		{LE: "5s", Count: 0},
+		{LE: "+Inf", Count: 1},
+	}, givb.Buckets)
+
+	ping := latencies[1]
+	require.Equal(t, "PING", ping.Message)
+	require.Equal(t, uint64(1), ping.Buckets[0].Count)
+}
+
+func TestMessagePrefix(t *testing.T) {
+	gnet.EraseMessages()
+	defer gnet.EraseMessages()
+	c := NewMessagesConfig()
+	c.Register()
+
+	require.Equal(t, "GIVB", messagePrefix(&GiveBlocksMessage{}))
+	require.Equal(t, "PING", messagePrefix(&PingMessage{}))
+	require.Equal(t, "", messagePrefix(&struct{}{}))
+}
+
+func TestNewTrafficStats(t *testing.T) {
+	rates := []gnet.Rate{
+		{Window: 10 * time.Second, Messages: 0.2, Bytes: 24},
+		{Window: time.Minute, Messages: 0.05, Bytes: 6},
+	}
+	s := newTrafficStats(gnet.TrafficStats{
+		In:          gnet.Traffic{Messages: 3, Bytes: 360, Rates: rates},
+		Out:         gnet.Traffic{Messages: 3, Bytes: 360, Rates: rates},
+		MessagesIn:  map[string]gnet.Traffic{"GIVB": {Messages: 3, Bytes: 360, Rates: rates}},
+		MessagesOut: map[string]gnet.Traffic{"GETB": {Messages: 3, Bytes: 360, Rates: rates}},
+	})
+
+	traffic := Traffic{
+		Messages: 3,
+		Bytes:    360,
+		Rates: []TrafficRate{
+			{Window: "10s", Messages: 0.2, Bytes: 24},
+			{Window: "1m0s", Messages: 0.05, Bytes: 6},
+		},
+	}
+	none := Traffic{
+		Rates: []TrafficRate{{Window: "10s"}, {Window: "1m0s"}},
+	}
+	require.Equal(t, traffic, s.In)
+	require.Equal(t, traffic, s.Out)
+	// the prefixes only received or only sent have no traffic in the other direction
+	require.Equal(t, map[string]MessageTraffic{
+		"GIVB": {In: traffic, Out: none},
+		"GETB": {In: none, Out: traffic},
+	}, s.Messages)
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/samoslab/samos/src/daemon/gnet"
 	"github.com/samoslab/samos/src/daemon/pex"
@@ -29,6 +31,13 @@ import (
 type MessageConfig struct {
 	Prefix  gnet.MessagePrefix
 	Message interface{}
+	// Capability the peers must support to be sent the message, 0 for every peer
+	Capability Capability
+	// ReplacedBy is the capability of the peers sent another form of the message instead, 0 if none
+	ReplacedBy Capability
+	// ValidatorsOnly messages are sent only over the links authenticated to validators
+	// if DaemonConfig.AuthenticatedPrepares is set
+	ValidatorsOnly bool
 }
 
 // NewMessageConfig creates message config
@@ -39,16 +48,36 @@ func NewMessageConfig(prefix string, m interface{}) MessageConfig {
 	}
 }
 
+// Requires returns the message config sent only to the peers supporting the capability
+func (mc MessageConfig) Requires(c Capability) MessageConfig {
+	mc.Capability = c
+	return mc
+}
+
+// Replaced returns the message config not sent to the peers supporting the capability
+func (mc MessageConfig) Replaced(c Capability) MessageConfig {
+	mc.ReplacedBy = c
+	return mc
+}
+
+// Validators returns the message config sent only over the links authenticated to validators
+func (mc MessageConfig) Validators() MessageConfig {
+	mc.ValidatorsOnly = true
+	return mc
+}
+
 // Creates and populates the message configs
 func getMessageConfigs() []MessageConfig {
 	return []MessageConfig{
 		NewMessageConfig("INTR", IntroductionMessage{}),
+		NewMessageConfig("FEAT", FeaturesMessage{}),
 		NewMessageConfig("GETP", GetPeersMessage{}),
 		NewMessageConfig("GIVP", GivePeersMessage{}),
-		NewMessageConfig("PING", PingMessage{}),
+		NewMessageConfig("PING", PingMessage{}).Replaced(CapNetworkTime),
 		NewMessageConfig("PONG", PongMessage{}),
 		NewMessageConfig("GETB", GetBlocksMessage{}),
 		NewMessageConfig("GIVB", GiveBlocksMessage{}),
+		NewMessageConfig("GIVQ", GiveQuorumCertsMessage{}).Requires(CapPbftCommit),
 		NewMessageConfig("ANNB", AnnounceBlocksMessage{}),
 		NewMessageConfig("GIPB", GivePendingBlockMessage{}),
 		NewMessageConfig("GETT", GetTxnsMessage{}),
@@ -57,11 +86,24 @@ func getMessageConfigs() []MessageConfig {
 		NewMessageConfig("GETM", GetTrustMessage{}),
 		NewMessageConfig("GIVM", GiveTrustMessage{}),
 		NewMessageConfig("ANNM", AnnounceTrustMessage{}),
-		NewMessageConfig("GETC", GetPrepareMessage{}),
-		NewMessageConfig("GIVC", GivePrepareMessage{}),
-		NewMessageConfig("ANNC", AnnouncePrepareMessage{}),
+		NewMessageConfig("GETC", GetPrepareMessage{}).Validators(),
+		NewMessageConfig("GIVC", GivePrepareMessage{}).Validators(),
+		NewMessageConfig("ANNC", AnnouncePrepareMessage{}).Validators(),
 		NewMessageConfig("GETA", GetAgreeNumMessage{}),
 		NewMessageConfig("GIVA", GiveAgreeNumMessage{}),
+		NewMessageConfig("EVID", GiveEvidenceMessage{}).Requires(CapEvidence),
+		NewMessageConfig("PPRE", PrePrepareMessage{}).Requires(CapPbftCommit).Replaced(CapPbftCommit | CapCompactBlocks),
+		NewMessageConfig("CMIT", CommitMessage{}).Requires(CapPbftCommit),
+		NewMessageConfig("VCHG", ViewChangeMessage{}).Requires(CapPbftCommit),
+		NewMessageConfig("GETH", GetHeadersMessage{}).Requires(CapHeadersSync),
+		NewMessageConfig("GIVH", GiveHeadersMessage{}).Requires(CapHeadersSync),
+		NewMessageConfig("GETD", GetBlockBodiesMessage{}).Requires(CapHeadersSync),
+		NewMessageConfig("GIVD", GiveBlockBodiesMessage{}).Requires(CapHeadersSync),
+		NewMessageConfig("CMPB", CompactBlockMessage{}).Requires(CapPbftCommit | CapCompactBlocks),
+		NewMessageConfig("GETX", GetBlockTxnsMessage{}).Requires(CapCompactBlocks),
+		NewMessageConfig("GIVX", GiveBlockTxnsMessage{}).Requires(CapCompactBlocks),
+		NewMessageConfig("TPIN", TimePingMessage{}).Requires(CapNetworkTime),
+		NewMessageConfig("TPON", TimePongMessage{}).Requires(CapNetworkTime),
 	}
 }
 
@@ -91,16 +133,53 @@ type Messages struct {
 	Config MessagesConfig
 	// Magic value for detecting self-connection
 	Mirror uint32
+
+	capabilities   map[reflect.Type]Capability
+	replacements   map[reflect.Type]Capability
+	validatorsOnly map[reflect.Type]bool
 }
 
 // NewMessages creates Messages
 func NewMessages(c MessagesConfig) *Messages {
+	capabilities := make(map[reflect.Type]Capability)
+	replacements := make(map[reflect.Type]Capability)
+	validatorsOnly := make(map[reflect.Type]bool)
+	for _, mc := range c.Messages {
+		if mc.Capability != 0 {
+			capabilities[reflect.TypeOf(mc.Message)] = mc.Capability
+		}
+		if mc.ReplacedBy != 0 {
+			replacements[reflect.TypeOf(mc.Message)] = mc.ReplacedBy
+		}
+		if mc.ValidatorsOnly {
+			validatorsOnly[reflect.TypeOf(mc.Message)] = true
+		}
+	}
+
 	return &Messages{
-		Config: c,
-		Mirror: rand.New(rand.NewSource(utc.Now().UnixNano())).Uint32(),
+		Config:         c,
+		Mirror:         rand.New(rand.NewSource(utc.Now().UnixNano())).Uint32(),
+		capabilities:   capabilities,
+		replacements:   replacements,
+		validatorsOnly: validatorsOnly,
 	}
 }
 
+// Capability returns the capability the peers must support to be sent the message
+func (msgs *Messages) Capability(m interface{}) Capability {
+	return msgs.capabilities[reflect.Indirect(reflect.ValueOf(m)).Type()]
+}
+
+// ReplacedBy returns the capability of the peers sent another form of the message instead
+func (msgs *Messages) ReplacedBy(m interface{}) Capability {
+	return msgs.replacements[reflect.Indirect(reflect.ValueOf(m)).Type()]
+}
+
+// ValidatorsOnly returns true if the message is sent only over the links authenticated to validators
+func (msgs *Messages) ValidatorsOnly(m interface{}) bool {
+	return msgs.validatorsOnly[reflect.Indirect(reflect.ValueOf(m)).Type()]
+}
+
 // IPAddr compact representation of IP:Port
 type IPAddr struct {
 	IP   uint32
@@ -223,6 +302,11 @@ func (gpm *GivePeersMessage) Process(d *Daemon) {
 		return
 	}
 	peers := gpm.GetPeers()
+	if len(peers) > d.Pex.Config.ReplyCount {
+		logger.Warningf("%s sent %d peers, at most %d are sent", gpm.c.Addr, len(peers), d.Pex.Config.ReplyCount)
+		d.misbehave(gpm.c.Addr, offenseSpam)
+		peers = peers[:d.Pex.Config.ReplyCount]
+	}
 	logger.Debugf("Got these peers via PEX: %s", strings.Join(peers, ", "))
 
 	d.Pex.AddPeers(peers)
@@ -235,7 +319,7 @@ type IntroductionMessage struct {
 	Mirror uint32
 	// Port is the port that this client is listening on
 	Port uint16
-	// Our client version
+	// Our client version, the highest protocol version we speak
 	Version int32
 
 	c *gnet.MessageContext `enc:"-"`
@@ -267,16 +351,15 @@ func (intro *IntroductionMessage) Handle(mc *gnet.MessageContext, daemon interfa
 
 		}
 
-		// Disconnect if not running the same version
-		if intro.Version != d.Config.Version {
-			logger.Infof("%s has different version %d. Disconnecting.",
-				mc.Addr, intro.Version)
-			d.Pool.Pool.Disconnect(mc.Addr, ErrDisconnectInvalidVersion)
-			return ErrDisconnectInvalidVersion
+		// Disconnect if the peer speaks only older protocol versions, the range of the versions
+		// it speaks follows in the FeaturesMessage
+		if intro.Version < d.Config.MinVersion {
+			logger.Infof("%s has version %d, we speak %d to %d. Disconnecting.",
+				mc.Addr, intro.Version, d.Config.MinVersion, d.Config.Version)
+			d.Pool.Pool.Disconnect(mc.Addr, ErrDisconnectVersionTooLow)
+			return ErrDisconnectVersionTooLow
 		}
 
-		logger.Infof("%s verified for version %d", mc.Addr, intro.Version)
-
 		// only solicited connection can be added to exchange peer list, cause accepted
 		// connection may not have incomming  port.
 		ip, port, err := iputil.SplitAddr(mc.Addr)
@@ -314,6 +397,7 @@ func (intro *IntroductionMessage) Handle(mc *gnet.MessageContext, daemon interfa
 	if err != nil {
 		d.Pex.IncreaseRetryTimes(mc.Addr)
 		d.expectingIntroductions.Remove(mc.Addr)
+		d.connectionFeatures.Remove(mc.Addr)
 		return err
 	}
 
@@ -324,8 +408,8 @@ func (intro *IntroductionMessage) Handle(mc *gnet.MessageContext, daemon interfa
 
 // Process an event queued by Handle()
 func (intro *IntroductionMessage) Process(d *Daemon) {
-	d.expectingIntroductions.Remove(intro.c.Addr)
 	if !intro.valid {
+		d.expectingIntroductions.Remove(intro.c.Addr)
 		return
 	}
 	// Add the remote peer with their chosen listening port
@@ -340,13 +424,82 @@ func (intro *IntroductionMessage) Process(d *Daemon) {
 		d.Pool.Pool.Disconnect(intro.c.Addr, ErrDisconnectOtherError)
 		return
 	}
+}
+
+// FeaturesMessage follows the IntroductionMessage, it tells the range of the protocol versions
+// and the capabilities of the sender. The peer is introduced once the features are negotiated.
+type FeaturesMessage struct {
+	// MinVersion is the lowest protocol version the sender speaks, Version the highest
+	MinVersion int32
+	Version    int32
+	// Capabilities of the sender
+	Capabilities Capability
+	// Time is the UTC time of the sender in unix nanoseconds
+	Time int64
+
+	c *gnet.MessageContext `enc:"-"`
+}
+
+// NewFeaturesMessage creates FeaturesMessage
+func NewFeaturesMessage(minVersion, version int32, caps Capability) *FeaturesMessage {
+	return &FeaturesMessage{
+		MinVersion:   minVersion,
+		Version:      version,
+		Capabilities: caps,
+		Time:         utc.Now().UnixNano(),
+	}
+}
+
+// Handle negotiates the protocol version and the capabilities of the connection, the peer is
+// disconnected if no protocol version is spoken by both
+func (fm *FeaturesMessage) Handle(mc *gnet.MessageContext, daemon interface{}) error {
+	d := daemon.(*Daemon)
+
+	features, err := d.negotiateFeatures(fm.MinVersion, fm.Version, fm.Capabilities)
+	if err != nil {
+		logger.Infof("%s speaks protocol versions %d to %d, we speak %d to %d: %v. Disconnecting.",
+			mc.Addr, fm.MinVersion, fm.Version, d.Config.MinVersion, d.Config.Version, err)
+		d.Pool.Pool.Disconnect(mc.Addr, err)
+		d.Pex.IncreaseRetryTimes(mc.Addr)
+		d.expectingIntroductions.Remove(mc.Addr)
+		return err
+	}
+
+	logger.Infof("%s verified for version %d with capabilities %v", mc.Addr, features.Version, features.Capabilities.Names())
+	d.connectionFeatures.Add(mc.Addr, features)
+
+	fm.c = mc
+	return d.recordMessageEvent(fm, mc)
+}
+
+// Process starts the sync with the introduced peer
+func (fm *FeaturesMessage) Process(d *Daemon) {
+	a := fm.c.Addr
+	d.expectingIntroductions.Remove(a)
 
-	// Request blocks immediately after they're confirmed
-	err = d.Visor.RequestBlocksFromAddr(d.Pool, intro.c.Addr)
-	if err == nil {
-		logger.Debugf("Successfully requested blocks from %s", intro.c.Addr)
+	// The features follow the introduction
+	if _, ok := d.connectionMirrors.Get(a); !ok {
+		d.Pool.Pool.Disconnect(a, ErrDisconnectNoIntroduction)
+		return
+	}
+
+	// The offset includes the latency of the message, the time pongs measure it
+	d.networkTime.Add(a, time.Duration(fm.Time-utc.Now().UnixNano()))
+
+	// Request blocks immediately after they're confirmed, the peers syncing headers first
+	// are sent our height so they announce theirs back
+	if d.peerSupports(a, CapHeadersSync) {
+		m := NewAnnounceBlocksMessage(d.Visor.HeadBkSeq())
+		if err := d.Pool.Pool.SendMessage(a, m); err != nil {
+			logger.Warning(err)
+		}
 	} else {
-		logger.Warning(err)
+		err := d.Visor.RequestBlocksFromAddr(d.Pool, a)
+		if err == nil {
+			logger.Debugf("Successfully requested blocks from %s", a)
+		} else {
+			logger.Warning(err)
+		}
 	}
 
 	// Anounce unconfirmed know txns
@@ -387,3 +540,70 @@ func (pong *PongMessage) Handle(mc *gnet.MessageContext, daemon interface{}) err
 	}
 	return nil
 }
+
+// TimePingMessage is the PingMessage sent to the peers exchanging their clocks, it carries the
+// time of the sender. A TimePongMessage is sent in reply.
+type TimePingMessage struct {
+	// Time is the UTC time of the sender in unix nanoseconds
+	Time int64
+
+	c *gnet.MessageContext `enc:"-"`
+}
+
+// NewTimePingMessage creates a time ping message with the current time
+func NewTimePingMessage() *TimePingMessage {
+	return &TimePingMessage{
+		Time: utc.Now().UnixNano(),
+	}
+}
+
+// Handle implements the Messager interface
+func (ping *TimePingMessage) Handle(mc *gnet.MessageContext, daemon interface{}) error {
+	ping.c = mc
+	return daemon.(*Daemon).recordMessageEvent(ping, mc)
+}
+
+// Process Sends a TimePongMessage to the sender of TimePingMessage
+func (ping *TimePingMessage) Process(d *Daemon) {
+	if d.Config.LogPings {
+		logger.Debugf("Reply to time ping from %s", ping.c.Addr)
+	}
+	if err := d.Pool.Pool.SendMessage(ping.c.Addr, NewTimePongMessage(ping.Time)); err != nil {
+		logger.Errorf("Send TimePongMessage to %s failed: %v", ping.c.Addr, err)
+	}
+}
+
+// TimePongMessage Sent in reply to a TimePingMessage. The time of the ping is returned with the
+// time of the sender, the offset of the clocks is measured by them.
+type TimePongMessage struct {
+	// PingTime is the time of the TimePingMessage
+	PingTime int64
+	// Time is the UTC time of the sender in unix nanoseconds
+	Time int64
+}
+
+// NewTimePongMessage creates a time pong message replying to the ping sent at pingTime
+func NewTimePongMessage(pingTime int64) *TimePongMessage {
+	return &TimePongMessage{
+		PingTime: pingTime,
+		Time:     utc.Now().UnixNano(),
+	}
+}
+
+// Handle handles message
+func (pong *TimePongMessage) Handle(mc *gnet.MessageContext, daemon interface{}) error {
+	// gnet updates Connection.LastMessage internally when this is received
+	d := daemon.(*Daemon)
+	if d.Config.LogPings {
+		logger.Debugf("Received time pong from %s", mc.Addr)
+	}
+
+	// The ping was sent by this node, the peer answered half way through the round trip
+	now := utc.Now().UnixNano()
+	rtt := now - pong.PingTime
+	if pong.PingTime <= 0 || rtt < 0 || time.Duration(rtt) > d.Pool.Config.IdleLimit {
+		return nil
+	}
+	d.networkTime.Add(mc.Addr, time.Duration(pong.Time-(pong.PingTime+rtt/2)))
+	return nil
+}
@@ -0,0 +1,67 @@
+package daemon
+
+import (
+	"github.com/samoslab/samos/src/daemon/gnet"
+	"github.com/samoslab/samos/src/util/iputil"
+)
+
+// offense is a misbehavior of a peer, its score is added to the ban score of the peer IP
+type offense struct {
+	reason string
+	score  int
+}
+
+var (
+	// offenseMalformedMessage a message could not be decoded
+	offenseMalformedMessage = offense{"malformed message", 50}
+	// offenseInvalidBlock a block failed to execute
+	offenseInvalidBlock = offense{"invalid block", 50}
+	// offenseInvalidSignature a block is not signed by a validator
+	offenseInvalidSignature = offense{"invalid block signature", 50}
+	// offenseInvalidSyncData headers or block bodies do not match the chain
+	offenseInvalidSyncData = offense{"invalid headers or block bodies", 50}
+	// offenseInvalidEvidence an evidence does not prove a double signing
+	offenseInvalidEvidence = offense{"invalid evidence", 20}
+	// offenseInvalidTxn a transaction violates the hard constraints
+	offenseInvalidTxn = offense{"invalid transaction", 10}
+	// offenseSpam more data than requested
+	offenseSpam = offense{"spam", 20}
+	// offenseRateLimit a message over the rate limits was dropped
+	offenseRateLimit = offense{"message over the rate limit", 2}
+)
+
+// misbehave records the offense of the peer, the connections to the IP of the peer are closed
+// once it is banned
+func (dm *Daemon) misbehave(addr string, o offense) {
+	if !dm.Pex.Misbehave(addr, o.score, o.reason) {
+		return
+	}
+	dm.disconnectIP(addr)
+}
+
+// onRateLimited scores the message over the rate limits the pool dropped, it is called by the
+// connection pool
+func (dm *Daemon) onRateLimited(addr string, prefix gnet.MessagePrefix) {
+	dm.misbehave(addr, offenseRateLimit)
+}
+
+// disconnectIP closes the connections to the IP of the address
+func (dm *Daemon) disconnectIP(addr string) {
+	// the address may be an IP without port
+	ip, _, _ := iputil.SplitAddr(addr)
+
+	conns, err := dm.Pool.Pool.GetConnections()
+	if err != nil {
+		logger.Errorf("Get connections failed: %v", err)
+		return
+	}
+	for _, c := range conns {
+		a, _, err := iputil.SplitAddr(c.Addr())
+		if err != nil || a != ip {
+			continue
+		}
+		if err := dm.Pool.Pool.Disconnect(c.Addr(), ErrDisconnectIsBlacklisted); err != nil {
+			logger.Errorf("Disconnect %s failed: %v", c.Addr(), err)
+		}
+	}
+}
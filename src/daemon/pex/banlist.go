@@ -0,0 +1,185 @@
+package pex
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/samoslab/samos/src/util/file"
+)
+
+// Ban is a banned IP, the connections from and to any port of the IP are refused
+type Ban struct {
+	IP     string `json:"ip"`
+	Reason string `json:"reason"`
+	// Unix timestamp of the ban
+	BannedAt int64 `json:"banned_at"`
+	// Unix timestamp the ban expires at
+	Until int64 `json:"until"`
+}
+
+// banScore is the misbehavior score of an IP, it halves every half life
+type banScore struct {
+	value   float64
+	updated time.Time
+}
+
+// banlist keeps the misbehavior scores and the bans by IP
+type banlist struct {
+	bans   map[string]*Ban
+	scores map[string]*banScore
+}
+
+func newBanlist() banlist {
+	return banlist{
+		bans:   make(map[string]*Ban),
+		scores: make(map[string]*banScore),
+	}
+}
+
+// banIP returns the IP of an address of the form ip:port or ip
+func banIP(addr string) (string, error) {
+	host := whitespaceFilter.ReplaceAllString(addr, "")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", ErrInvalidAddress
+	}
+	return ip.String(), nil
+}
+
+// loadBansFromFile loads the bans not expired at now, it returns nil if the file does not exist
+func loadBansFromFile(path string, now time.Time) (map[string]*Ban, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var bans []Ban
+	err := file.LoadJSON(path, &bans)
+	if err == io.EOF {
+		logger.WithField("path", path).Error("corrupt or empty file, rewriting file")
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]*Ban, len(bans))
+	for _, b := range bans {
+		ip, err := banIP(b.IP)
+		if err != nil {
+			logger.Errorf("Invalid IP in bans JSON file %s: %v", b.IP, err)
+			continue
+		}
+		if b.Until <= now.Unix() {
+			continue
+		}
+		nb := b
+		nb.IP = ip
+		m[ip] = &nb
+	}
+	return m, nil
+}
+
+// save saves the bans to disk as a JSON list
+func (bl *banlist) save(fn string) error {
+	if err := file.SaveJSON(fn, bl.list(), 0600); err != nil {
+		return fmt.Errorf("save ban list failed: %s", err)
+	}
+	return nil
+}
+
+// list returns the bans sorted by IP
+func (bl *banlist) list() []Ban {
+	bans := make([]Ban, 0, len(bl.bans))
+	for _, b := range bl.bans {
+		bans = append(bans, *b)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].IP < bans[j].IP
+	})
+	return bans
+}
+
+func (bl *banlist) isBanned(ip string, now time.Time) bool {
+	b, ok := bl.bans[ip]
+	return ok && b.Until > now.Unix()
+}
+
+// ban bans the IP until now+d, a longer ban of the IP is kept
+func (bl *banlist) ban(ip string, d time.Duration, reason string, now time.Time) Ban {
+	delete(bl.scores, ip)
+
+	until := now.Add(d).Unix()
+	if b, ok := bl.bans[ip]; ok && b.Until >= until {
+		return *b
+	}
+	b := &Ban{
+		IP:       ip,
+		Reason:   reason,
+		BannedAt: now.Unix(),
+		Until:    until,
+	}
+	bl.bans[ip] = b
+	return *b
+}
+
+func (bl *banlist) unban(ip string) bool {
+	if _, ok := bl.bans[ip]; !ok {
+		return false
+	}
+	delete(bl.bans, ip)
+	return true
+}
+
+// addScore adds to the score of the IP decayed by the half life, it returns the new score rounded
+func (bl *banlist) addScore(ip string, score int, halfLife time.Duration, now time.Time) int {
+	s, ok := bl.scores[ip]
+	if !ok {
+		s = &banScore{}
+		bl.scores[ip] = s
+	}
+	s.value = s.decayed(halfLife, now) + float64(score)
+	s.updated = now
+	return int(math.Round(s.value))
+}
+
+// score returns the score of the IP decayed by the half life, rounded
+func (bl *banlist) score(ip string, halfLife time.Duration, now time.Time) int {
+	s, ok := bl.scores[ip]
+	if !ok {
+		return 0
+	}
+	return int(math.Round(s.decayed(halfLife, now)))
+}
+
+func (s *banScore) decayed(halfLife time.Duration, now time.Time) float64 {
+	if halfLife <= 0 || s.updated.IsZero() {
+		return s.value
+	}
+	return s.value * math.Exp2(-float64(now.Sub(s.updated))/float64(halfLife))
+}
+
+// clearExpired removes the expired bans and the scores decayed below 1,
+// it returns the number of bans removed
+func (bl *banlist) clearExpired(halfLife time.Duration, now time.Time) int {
+	n := 0
+	for ip, b := range bl.bans {
+		if b.Until <= now.Unix() {
+			logger.Infof("Ban of %s expired", ip)
+			delete(bl.bans, ip)
+			n++
+		}
+	}
+	for ip, s := range bl.scores {
+		if s.decayed(halfLife, now) < 1 {
+			delete(bl.scores, ip)
+		}
+	}
+	return n
+}
@@ -0,0 +1,127 @@
+package pex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/util/utc"
+)
+
+func TestBanIP(t *testing.T) {
+	tt := []struct {
+		addr string
+		ip   string
+		err  error
+	}{
+		{"112.32.32.14:7200", "112.32.32.14", nil},
+		{"112.32.32.14", "112.32.32.14", nil},
+		{" 112.32.32.14 ", "112.32.32.14", nil},
+		{"[::1]:7200", "::1", nil},
+		{"112.32.32:7200", "", ErrInvalidAddress},
+		{"", "", ErrInvalidAddress},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.addr, func(t *testing.T) {
+			ip, err := banIP(tc.addr)
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.ip, ip)
+		})
+	}
+}
+
+func TestBanlistScore(t *testing.T) {
+	bl := newBanlist()
+	now := time.Now()
+	ip := "112.32.32.14"
+
+	require.Equal(t, 0, bl.score(ip, time.Hour, now))
+	require.Equal(t, 40, bl.addScore(ip, 40, time.Hour, now))
+	require.Equal(t, 80, bl.addScore(ip, 40, time.Hour, now))
+
+	// the score halves every half life
+	now = now.Add(time.Hour)
+	require.Equal(t, 40, bl.score(ip, time.Hour, now))
+	require.Equal(t, 90, bl.addScore(ip, 50, time.Hour, now))
+	require.Equal(t, 45, bl.score(ip, time.Hour, now.Add(time.Hour)))
+
+	// the scores decayed below 1 are removed
+	require.Equal(t, 0, bl.clearExpired(time.Hour, now.Add(time.Hour*6)))
+	require.Len(t, bl.scores, 1)
+	require.Equal(t, 0, bl.clearExpired(time.Hour, now.Add(time.Hour*7)))
+	require.Empty(t, bl.scores)
+}
+
+func TestBanlistBan(t *testing.T) {
+	bl := newBanlist()
+	now := time.Now()
+	ip := "112.32.32.14"
+
+	bl.addScore(ip, 60, time.Hour, now)
+	b := bl.ban(ip, time.Hour, "invalid block", now)
+	require.Equal(t, Ban{
+		IP:       ip,
+		Reason:   "invalid block",
+		BannedAt: now.Unix(),
+		Until:    now.Add(time.Hour).Unix(),
+	}, b)
+	require.True(t, bl.isBanned(ip, now))
+	require.False(t, bl.isBanned("112.32.32.15", now))
+	// the score is reset by the ban
+	require.Equal(t, 0, bl.score(ip, time.Hour, now))
+
+	// a longer ban is kept
+	require.Equal(t, b, bl.ban(ip, time.Minute, "spam", now))
+	b2 := bl.ban(ip, time.Hour*2, "spam", now)
+	require.Equal(t, now.Add(time.Hour*2).Unix(), b2.Until)
+	require.Equal(t, []Ban{b2}, bl.list())
+
+	// the ban expires
+	require.False(t, bl.isBanned(ip, now.Add(time.Hour*2)))
+	require.Equal(t, 0, bl.clearExpired(time.Hour, now.Add(time.Hour)))
+	require.Equal(t, 1, bl.clearExpired(time.Hour, now.Add(time.Hour*2)))
+	require.Empty(t, bl.list())
+
+	bl.ban(ip, time.Hour, "spam", now)
+	require.True(t, bl.unban(ip))
+	require.False(t, bl.unban(ip))
+	require.False(t, bl.isBanned(ip, now))
+}
+
+func TestBanlistSaveLoad(t *testing.T) {
+	dir, removeDir := preparePeerlistDir(t)
+	defer removeDir()
+	fn := filepath.Join(dir, BanListFilename)
+	defer os.Remove(fn)
+
+	now := utc.Now()
+
+	// no file
+	bans, err := loadBansFromFile(fn, now)
+	require.NoError(t, err)
+	require.Nil(t, bans)
+
+	bl := newBanlist()
+	b1 := bl.ban("112.32.32.15", time.Hour, "spam", now)
+	b2 := bl.ban("112.32.32.14", time.Hour*2, "invalid block", now)
+	require.NoError(t, bl.save(fn))
+	require.Equal(t, []Ban{b2, b1}, bl.list())
+
+	bans, err = loadBansFromFile(fn, now)
+	require.NoError(t, err)
+	require.Equal(t, map[string]*Ban{
+		b1.IP: &b1,
+		b2.IP: &b2,
+	}, bans)
+
+	// the expired bans are not loaded
+	bans, err = loadBansFromFile(fn, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, map[string]*Ban{
+		b2.IP: &b2,
+	}, bans)
+}
@@ -176,6 +176,25 @@ func (pl *peerlist) removePeer(addr string) {
 }
 
 // SetPrivate sets specific peer as private
+// removeIP removes the peers of any port of the IP
+func (pl *peerlist) removeIP(ip string) {
+	for addr := range pl.peers {
+		if a, err := banIP(addr); err == nil && a == ip {
+			delete(pl.peers, addr)
+		}
+	}
+}
+
+// hasTrustedIP returns true if a trusted peer has the IP
+func (pl *peerlist) hasTrustedIP(ip string) bool {
+	for addr, p := range pl.peers {
+		if a, err := banIP(addr); err == nil && a == ip && p.Trusted {
+			return true
+		}
+	}
+	return false
+}
+
 func (pl *peerlist) setPrivate(addr string, private bool) error {
 	if p, ok := pl.peers[addr]; ok {
 		p.Private = private
@@ -33,6 +33,8 @@ const (
 	DefaultPeerListURL = "https://downloads.samos.io/blockchain/peers.txt"
 	// PeerDatabaseFilename filename for disk-cached peers
 	PeerDatabaseFilename = "peers.txt"
+	// BanListFilename filename for the banned IPs, saved next to the peers
+	BanListFilename = "bans.json"
 	// MaxPeerRetryTimes is the maximum number of times to retry a peer
 	MaxPeerRetryTimes = 10
 )
@@ -50,6 +52,10 @@ var (
 	ErrPortTooLow = errors.New("Port must be >= 1024")
 	// ErrBlacklistedAddress returned when attempting to add a blacklisted peer
 	ErrBlacklistedAddress = errors.New("Blacklisted address")
+	// ErrNotBanned is returned when unbanning an IP which is not banned
+	ErrNotBanned = errors.New("IP is not banned")
+	// ErrInvalidBanDuration is returned when banning an IP for a negative duration
+	ErrInvalidBanDuration = errors.New("Ban duration must be positive")
 
 	// Logging. See http://godoc.org/github.com/op/go-logging for
 	// instructions on how to include this log's output
@@ -162,6 +168,12 @@ type Config struct {
 	ClearOldRate time.Duration
 	// How often to clear expired blacklist entries
 	UpdateBlacklistRate time.Duration
+	// Misbehavior score an IP is banned at
+	BanThreshold int
+	// How long an IP is banned for when its score reaches the threshold
+	BanDuration time.Duration
+	// How long the misbehavior score of an IP takes to halve
+	BanScoreHalfLife time.Duration
 	// How often to request peers via PEX
 	RequestRate time.Duration
 	// How many peers to send back in response to a peers request
@@ -187,6 +199,9 @@ func NewConfig() Config {
 		CullRate:            time.Minute * 10,
 		ClearOldRate:        time.Minute * 10,
 		UpdateBlacklistRate: time.Minute,
+		BanThreshold:        100,
+		BanDuration:         time.Hour * 24,
+		BanScoreHalfLife:    time.Hour,
 		RequestRate:         time.Minute,
 		ReplyCount:          30,
 		AllowLocalhost:      false,
@@ -202,9 +217,11 @@ type Pex struct {
 	sync.RWMutex
 	// All known peers
 	peerlist peerlist
-	Config   Config
-	quit     chan struct{}
-	done     chan struct{}
+	// Misbehavior scores and bans by IP
+	banlist banlist
+	Config  Config
+	quit    chan struct{}
+	done    chan struct{}
 }
 
 // New creates pex
@@ -212,14 +229,18 @@ func New(cfg Config, defaultConns []string) (*Pex, error) {
 	pex := &Pex{
 		Config:   cfg,
 		peerlist: newPeerlist(),
+		banlist:  newBanlist(),
 		quit:     make(chan struct{}),
 		done:     make(chan struct{}),
 	}
 
-	// Load peers from disk
+	// Load peers and bans from disk
 	if err := pex.load(); err != nil {
 		return nil, err
 	}
+	if err := pex.loadBans(); err != nil {
+		return nil, err
+	}
 
 	// Load default hardcoded peers
 	for _, addr := range defaultConns {
@@ -265,6 +286,7 @@ func (px *Pex) Run() error {
 	}()
 
 	clearOldTicker := time.NewTicker(px.Config.ClearOldRate)
+	updateBlacklistTicker := time.NewTicker(px.Config.UpdateBlacklistRate)
 
 	for {
 		select {
@@ -275,6 +297,9 @@ func (px *Pex) Run() error {
 				px.peerlist.clearOld(px.Config.Expiration)
 				px.Unlock()
 			}
+		case <-updateBlacklistTicker.C:
+			// Remove the expired bans
+			px.clearExpiredBans()
 		case <-px.quit:
 			return nil
 		}
@@ -359,6 +384,10 @@ func (px *Pex) AddPeer(addr string) error {
 		return ErrInvalidAddress
 	}
 
+	if px.isBanned(cleanAddr) {
+		return ErrBlacklistedAddress
+	}
+
 	if px.Config.Max > 0 && px.peerlist.len() >= px.Config.Max {
 		return ErrPeerlistFull
 	}
@@ -387,6 +416,9 @@ func (px *Pex) AddPeers(addrs []string) int {
 			logger.Infof("Add peers sees an invalid address %s: %v", addr, err)
 			continue
 		}
+		if px.isBanned(a) {
+			continue
+		}
 		validAddrs = append(validAddrs, a)
 	}
 	addrs = validAddrs
@@ -527,6 +559,150 @@ func (px *Pex) IsFull() bool {
 	return px.Config.Max > 0 && px.peerlist.len() >= px.Config.Max
 }
 
+func (px *Pex) loadBans() error {
+	px.Lock()
+	defer px.Unlock()
+
+	fp := filepath.Join(px.Config.DataDirectory, BanListFilename)
+	bans, err := loadBansFromFile(fp, utc.Now())
+	if err != nil {
+		return err
+	}
+	if bans != nil {
+		px.banlist.bans = bans
+	}
+	return nil
+}
+
+// saveBans persists the bans, the lock must be held
+func (px *Pex) saveBans() {
+	fn := filepath.Join(px.Config.DataDirectory, BanListFilename)
+	if err := px.banlist.save(fn); err != nil {
+		logger.Error(err)
+	}
+}
+
+// isBanned returns true if the IP of the address is banned, the lock must be held
+func (px *Pex) isBanned(addr string) bool {
+	ip, err := banIP(addr)
+	if err != nil {
+		return false
+	}
+	return px.banlist.isBanned(ip, utc.Now())
+}
+
+// ban bans the IP and removes its peers, the lock must be held
+func (px *Pex) ban(ip string, d time.Duration, reason string) Ban {
+	b := px.banlist.ban(ip, d, reason, utc.Now())
+	px.peerlist.removeIP(ip)
+	px.saveBans()
+	return b
+}
+
+// IsBanned returns true if the IP of the address is banned
+func (px *Pex) IsBanned(addr string) bool {
+	px.RLock()
+	defer px.RUnlock()
+	return px.isBanned(addr)
+}
+
+// Misbehave adds the score of an offense of the peer to the score of its IP, the IP is banned for
+// BanDuration once its score reaches BanThreshold. The score halves every BanScoreHalfLife, the
+// trusted peers are not banned. Returns true if the IP is banned.
+func (px *Pex) Misbehave(addr string, score int, reason string) bool {
+	px.Lock()
+	defer px.Unlock()
+
+	ip, err := banIP(addr)
+	if err != nil {
+		logger.Errorf("Invalid address %s: %v", addr, err)
+		return false
+	}
+	if px.banlist.isBanned(ip, utc.Now()) {
+		return true
+	}
+
+	total := px.banlist.addScore(ip, score, px.Config.BanScoreHalfLife, utc.Now())
+	logger.Infof("%s misbehaved: %s, ban score %d", addr, reason, total)
+	if px.Config.BanThreshold <= 0 || total < px.Config.BanThreshold {
+		return false
+	}
+	if px.peerlist.hasTrustedIP(ip) {
+		logger.Warningf("Trusted peer %s reached the ban score %d, it is not banned", addr, total)
+		return false
+	}
+
+	logger.Infof("Banning %s for %v: %s", ip, px.Config.BanDuration, reason)
+	px.ban(ip, px.Config.BanDuration, reason)
+	return true
+}
+
+// Score returns the misbehavior score of the IP of the address
+func (px *Pex) Score(addr string) int {
+	px.RLock()
+	defer px.RUnlock()
+
+	ip, err := banIP(addr)
+	if err != nil {
+		return 0
+	}
+	return px.banlist.score(ip, px.Config.BanScoreHalfLife, utc.Now())
+}
+
+// Ban bans the IP of the address for the duration, BanDuration if it is 0
+func (px *Pex) Ban(addr string, d time.Duration, reason string) (Ban, error) {
+	px.Lock()
+	defer px.Unlock()
+
+	ip, err := banIP(addr)
+	if err != nil {
+		return Ban{}, err
+	}
+	if d < 0 {
+		return Ban{}, ErrInvalidBanDuration
+	}
+	if d == 0 {
+		d = px.Config.BanDuration
+	}
+
+	logger.Infof("Banning %s for %v: %s", ip, d, reason)
+	return px.ban(ip, d, reason), nil
+}
+
+// Unban removes the ban of the IP of the address
+func (px *Pex) Unban(addr string) error {
+	px.Lock()
+	defer px.Unlock()
+
+	ip, err := banIP(addr)
+	if err != nil {
+		return err
+	}
+	if !px.banlist.unban(ip) {
+		return ErrNotBanned
+	}
+
+	logger.Infof("Unbanned %s", ip)
+	px.saveBans()
+	return nil
+}
+
+// Bans returns the banned IPs
+func (px *Pex) Bans() []Ban {
+	px.RLock()
+	defer px.RUnlock()
+	return px.banlist.list()
+}
+
+// clearExpiredBans removes the expired bans and the decayed scores
+func (px *Pex) clearExpiredBans() {
+	px.Lock()
+	defer px.Unlock()
+	if px.banlist.clearExpired(px.Config.BanScoreHalfLife, utc.Now()) != 0 {
+		px.saveBans()
+	}
+}
+
 // downloadText downloads a text format file from url.
 // Returns the raw response body as a string.
 // TODO -- move to util, add backoff options
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -1332,6 +1333,87 @@ func TestPexIsFull(t *testing.T) {
 	require.True(t, pex.IsFull())
 }
 
+func TestPexMisbehave(t *testing.T) {
+	dir, removeDir := preparePeerlistDir(t)
+	defer removeDir()
+	defer os.Remove(filepath.Join(dir, BanListFilename))
+
+	cfg := NewConfig()
+	cfg.DataDirectory = dir
+	cfg.BanThreshold = 100
+	cfg.BanDuration = time.Hour
+
+	px, err := New(cfg, testPeers[:1])
+	require.NoError(t, err)
+	require.Equal(t, 2, px.AddPeers(testPeers[1:3]))
+
+	// the score is kept by IP
+	require.False(t, px.Misbehave(testPeers[1], 50, "invalid block"))
+	require.Equal(t, 50, px.Score("112.32.32.15:7201"))
+	require.False(t, px.IsBanned(testPeers[1]))
+
+	require.True(t, px.Misbehave("112.32.32.15:7201", 50, "invalid block"))
+	require.True(t, px.IsBanned(testPeers[1]))
+	require.True(t, px.Misbehave(testPeers[1], 10, "spam"))
+	_, ok := px.peerlist.peers[testPeers[1]]
+	require.False(t, ok)
+	require.Equal(t, ErrBlacklistedAddress, px.AddPeer(testPeers[1]))
+	require.Equal(t, 0, px.AddPeers(testPeers[1:2]))
+
+	// the trusted peers are not banned
+	require.False(t, px.Misbehave(testPeers[0], 200, "invalid block"))
+	require.False(t, px.IsBanned(testPeers[0]))
+
+	// the bans are loaded from disk
+	px2, err := New(cfg, nil)
+	require.NoError(t, err)
+	require.True(t, px2.IsBanned(testPeers[1]))
+	bans := px2.Bans()
+	require.Len(t, bans, 1)
+	require.Equal(t, "112.32.32.15", bans[0].IP)
+	require.Equal(t, "invalid block", bans[0].Reason)
+	require.Equal(t, bans[0].BannedAt+3600, bans[0].Until)
+}
+
+func TestPexBan(t *testing.T) {
+	dir, removeDir := preparePeerlistDir(t)
+	defer removeDir()
+	defer os.Remove(filepath.Join(dir, BanListFilename))
+
+	cfg := NewConfig()
+	cfg.DataDirectory = dir
+	cfg.BanDuration = time.Hour
+
+	px, err := New(cfg, testPeers[:1])
+	require.NoError(t, err)
+
+	_, err = px.Ban("112.32.32", 0, "")
+	require.Equal(t, ErrInvalidAddress, err)
+	_, err = px.Ban(testPeers[1], -time.Second, "")
+	require.Equal(t, ErrInvalidBanDuration, err)
+
+	// the trusted peers can be banned manually
+	b, err := px.Ban(testPeers[0], 0, "manual")
+	require.NoError(t, err)
+	require.Equal(t, "112.32.32.14", b.IP)
+	require.Equal(t, b.BannedAt+3600, b.Until)
+	require.True(t, px.IsBanned(testPeers[0]))
+
+	b, err = px.Ban("112.32.32.15", time.Minute, "manual")
+	require.NoError(t, err)
+	require.Equal(t, b.BannedAt+60, b.Until)
+	require.Len(t, px.Bans(), 2)
+
+	require.NoError(t, px.Unban(testPeers[0]))
+	require.Equal(t, ErrNotBanned, px.Unban(testPeers[0]))
+	require.False(t, px.IsBanned(testPeers[0]))
+	require.NoError(t, px.AddPeer(testPeers[0]))
+
+	px2, err := New(cfg, nil)
+	require.NoError(t, err)
+	require.Equal(t, []Ban{b}, px2.Bans())
+}
+
 func TestParseRemotePeerList(t *testing.T) {
 	body := `11.22.33.44:5555
 66.55.44.33:2020
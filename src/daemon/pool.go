@@ -23,6 +23,16 @@ type PoolConfig struct {
 	ClearStaleRate time.Duration
 	// Buffer size for gnet.ConnectionPool's network Read events
 	EventChannelSize int
+	// Encrypt the connections to the peers and accept the encrypted connections, the validators
+	// prove their trust keys in the handshake
+	Encrypt bool
+	// Limit of the messages per second received from each peer, the messages over the limits
+	// are dropped and scored as misbehavior
+	ConnectionRateLimit gnet.RateLimit
+	// Limits of the messages per second of a prefix received from each peer
+	MessageRateLimits map[string]gnet.RateLimit
+	// Limit of the bytes per second read from all the peers, zero is unlimited
+	InboundBandwidth gnet.RateLimit
 	// These should be assigned by the controlling daemon
 	address string
 	port    int
@@ -41,6 +51,14 @@ func NewPoolConfig() PoolConfig {
 		IdleCheckRate:       1 * time.Second,
 		ClearStaleRate:      1 * time.Second,
 		EventChannelSize:    4096,
+		Encrypt:             false,
+		ConnectionRateLimit: gnet.RateLimit{Rate: 200, Burst: 1000},
+		MessageRateLimits: map[string]gnet.RateLimit{
+			"ANNT": {Rate: 20, Burst: 200},
+			"GETB": {Rate: 5, Burst: 50},
+			"GETC": {Rate: 20, Burst: 200},
+		},
+		InboundBandwidth: gnet.RateLimit{},
 	}
 }
 
@@ -63,6 +81,16 @@ func NewPool(c PoolConfig, d *Daemon) *Pool {
 	cfg.Address = pool.Config.address
 	cfg.ConnectCallback = d.onGnetConnect
 	cfg.DisconnectCallback = d.onGnetDisconnect
+	cfg.SendFilter = d.filterMessage
+	cfg.Encrypt = pool.Config.Encrypt
+	cfg.Identity = d.proveIdentity
+	cfg.ConnectionRateLimit = pool.Config.ConnectionRateLimit
+	cfg.MessageRateLimits = make(map[gnet.MessagePrefix]gnet.RateLimit, len(pool.Config.MessageRateLimits))
+	for prefix, l := range pool.Config.MessageRateLimits {
+		cfg.MessageRateLimits[gnet.MessagePrefixFromString(prefix)] = l
+	}
+	cfg.InboundBandwidth = pool.Config.InboundBandwidth
+	cfg.RateLimitCallback = d.onRateLimited
 
 	pool.Pool = gnet.NewConnectionPool(cfg, d)
 
@@ -87,9 +115,11 @@ func (pool *Pool) RunOffline() error {
 	return pool.Pool.RunOffline()
 }
 
-// Send a ping if our last message sent was over pingRate ago
+// Send a ping if our last message sent was over pingRate ago, the peers exchanging their clocks
+// are sent a time ping instead
 func (pool *Pool) sendPings() {
 	pool.Pool.SendPings(pool.Config.PingRate, &PingMessage{})
+	pool.Pool.SendPings(pool.Config.PingRate, NewTimePingMessage())
 }
 
 // Removes connections that have not sent a message in too long
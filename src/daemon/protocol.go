@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"reflect"
+
+	"github.com/samoslab/samos/src/daemon/gnet"
+)
+
+// Capability is a bitset of the optional message families a peer supports.
+// The messages without a capability are supported by every protocol version.
+type Capability uint64
+
+const (
+	// CapEvidence is the gossip of the evidence of double signed blocks
+	CapEvidence Capability = 1 << iota
+	// CapPbftCommit is the pre-prepare, commit and view change phases of PBFT
+	CapPbftCommit
+	// CapHeadersSync is the headers first sync with the bodies downloaded from several peers
+	CapHeadersSync
+	// CapCompactBlocks is the relay of the pending blocks with the short ids of their transactions
+	CapCompactBlocks
+	// CapNetworkTime is the exchange of the clocks in the pings and pongs
+	CapNetworkTime
+)
+
+// SupportedCapabilities are the capabilities of this node
+const SupportedCapabilities = CapEvidence | CapPbftCommit | CapHeadersSync | CapCompactBlocks | CapNetworkTime
+
+var capabilityNames = []struct {
+	c    Capability
+	name string
+}{
+	{CapEvidence, "evidence"},
+	{CapPbftCommit, "pbft_commit"},
+	{CapHeadersSync, "headers_sync"},
+	{CapCompactBlocks, "compact_blocks"},
+	{CapNetworkTime, "network_time"},
+}
+
+// Has returns true if all of the capabilities c are set
+func (caps Capability) Has(c Capability) bool {
+	return caps&c == c
+}
+
+// Names returns the names of the capabilities set
+func (caps Capability) Names() []string {
+	names := []string{}
+	for _, n := range capabilityNames {
+		if caps.Has(n.c) {
+			names = append(names, n.name)
+		}
+	}
+	return names
+}
+
+// Features are the protocol version and capabilities negotiated with a peer
+type Features struct {
+	// Version is the highest protocol version both ends speak
+	Version int32
+	// Capabilities both ends support
+	Capabilities Capability
+}
+
+// negotiateFeatures returns the features of a connection to a peer speaking the protocol
+// versions minVersion to version with the capabilities caps
+func (dm *Daemon) negotiateFeatures(minVersion, version int32, caps Capability) (Features, error) {
+	switch {
+	case minVersion > version:
+		return Features{}, ErrDisconnectInvalidVersion
+	case version < dm.Config.MinVersion:
+		return Features{}, ErrDisconnectVersionTooLow
+	case minVersion > dm.Config.Version:
+		return Features{}, ErrDisconnectVersionNotSupported
+	}
+
+	f := Features{
+		Version:      version,
+		Capabilities: caps & SupportedCapabilities,
+	}
+	if dm.Config.Version < f.Version {
+		f.Version = dm.Config.Version
+	}
+	return f, nil
+}
+
+// peerSupports returns true if the peer negotiated the capabilities c
+func (dm *Daemon) peerSupports(addr string, c Capability) bool {
+	f, ok := dm.connectionFeatures.Get(addr)
+	return ok && f.Capabilities.Has(c)
+}
+
+// filterMessage returns false if the message requires a capability the peer did not negotiate,
+// if the peer is sent another form of the message, or if the message is sent only to the validators
+// and the peer did not prove it is one. The messages without a capability are sent
+// to the peers not introduced yet.
+func (dm *Daemon) filterMessage(addr string, msg gnet.Message) bool {
+	if dm.Config.AuthenticatedPrepares && dm.Messages.ValidatorsOnly(msg) && !dm.isValidatorLink(addr) {
+		return false
+	}
+	if r := dm.Messages.ReplacedBy(msg); r != 0 && dm.peerSupports(addr, r) {
+		return false
+	}
+	c := dm.Messages.Capability(msg)
+	if c == 0 || dm.peerSupports(addr, c) {
+		return true
+	}
+	logger.Debugf("%s is not sent to %s, it does not support %v", reflect.TypeOf(msg), addr, c.Names())
+	return false
+}
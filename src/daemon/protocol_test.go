@@ -0,0 +1,209 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
+	"github.com/samoslab/samos/src/testutil"
+	"github.com/samoslab/samos/src/visor"
+)
+
+func TestCapability(t *testing.T) {
+	caps := CapEvidence | CapPbftCommit
+	require.True(t, caps.Has(CapEvidence))
+	require.True(t, caps.Has(CapEvidence|CapPbftCommit))
+	require.False(t, CapEvidence.Has(CapEvidence|CapPbftCommit))
+	require.True(t, Capability(0).Has(0))
+
+	require.Equal(t, []string{"evidence", "pbft_commit"}, caps.Names())
+	require.Equal(t, []string{"pbft_commit"}, CapPbftCommit.Names())
+	require.Equal(t, []string{"evidence", "pbft_commit", "headers_sync", "compact_blocks", "network_time"}, SupportedCapabilities.Names())
+	require.Equal(t, []string{}, Capability(0).Names())
+}
+
+func TestIntroductionMessageLayout(t *testing.T) {
+	// the introduction of the peers of protocol version 2 decodes, its version is checked
+	old := struct {
+		Mirror  uint32
+		Port    uint16
+		Version int32
+	}{Mirror: 7, Port: 8858, Version: 2}
+
+	var intro IntroductionMessage
+	require.NoError(t, encoder.DeserializeRaw(encoder.Serialize(old), &intro))
+	require.Equal(t, *NewIntroductionMessage(7, 2, 8858), intro)
+	require.Equal(t, encoder.Serialize(old), encoder.Serialize(*NewIntroductionMessage(7, 2, 8858)))
+}
+
+func TestNegotiateFeatures(t *testing.T) {
+	d := &Daemon{
+		Config: DaemonConfig{
+			MinVersion: 3,
+			Version:    5,
+		},
+	}
+
+	cases := []struct {
+		name       string
+		minVersion int32
+		version    int32
+		caps       Capability
+		features   Features
+		err        error
+	}{
+		{
+			name:       "same range",
+			minVersion: 3,
+			version:    5,
+			caps:       SupportedCapabilities,
+			features:   Features{Version: 5, Capabilities: SupportedCapabilities},
+		},
+		{
+			name:       "older peer",
+			minVersion: 2,
+			version:    3,
+			caps:       CapEvidence,
+			features:   Features{Version: 3, Capabilities: CapEvidence},
+		},
+		{
+			name:       "newer peer with unknown capabilities",
+			minVersion: 4,
+			version:    7,
+			caps:       CapPbftCommit | 1<<40,
+			features:   Features{Version: 5, Capabilities: CapPbftCommit},
+		},
+		{
+			name:       "below the minimum",
+			minVersion: 1,
+			version:    2,
+			err:        ErrDisconnectVersionTooLow,
+		},
+		{
+			name:       "above the maximum",
+			minVersion: 6,
+			version:    7,
+			err:        ErrDisconnectVersionNotSupported,
+		},
+		{
+			name:       "invalid range",
+			minVersion: 5,
+			version:    4,
+			err:        ErrDisconnectInvalidVersion,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := d.negotiateFeatures(tc.minVersion, tc.version, tc.caps)
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.features, f)
+		})
+	}
+}
+
+func TestFilterMessage(t *testing.T) {
+	d := &Daemon{
+		Messages:           NewMessages(NewMessagesConfig()),
+		connectionFeatures: NewConnectionFeatures(),
+	}
+
+	require.Equal(t, Capability(0), d.Messages.Capability(&PingMessage{}))
+	require.Equal(t, CapEvidence, d.Messages.Capability(&GiveEvidenceMessage{}))
+	require.Equal(t, CapPbftCommit, d.Messages.Capability(CommitMessage{}))
+	require.Equal(t, CapHeadersSync, d.Messages.Capability(&GetHeadersMessage{}))
+
+	addr := "1.2.3.4:6677"
+	d.connectionFeatures.Add(addr, Features{Version: 3, Capabilities: CapEvidence})
+
+	// the messages without a capability are sent before the introduction too
+	require.True(t, d.filterMessage(addr, &PingMessage{}))
+	require.True(t, d.filterMessage("5.6.7.8:6677", &PingMessage{}))
+	require.False(t, d.filterMessage("5.6.7.8:6677", &GiveEvidenceMessage{}))
+
+	require.True(t, d.filterMessage(addr, &GiveEvidenceMessage{}))
+	require.False(t, d.filterMessage(addr, &CommitMessage{}))
+	require.False(t, d.filterMessage(addr, &ViewChangeMessage{}))
+	require.False(t, d.filterMessage(addr, &GiveQuorumCertsMessage{}))
+	require.True(t, d.filterMessage(addr, &GiveBlocksMessage{}))
+
+	d.connectionFeatures.Remove(addr)
+	require.False(t, d.filterMessage(addr, &GiveEvidenceMessage{}))
+
+	// the peers supporting compact blocks are sent them instead of the pre-prepares
+	d.connectionFeatures.Add(addr, Features{Version: 3, Capabilities: CapPbftCommit})
+	require.True(t, d.filterMessage(addr, &PrePrepareMessage{}))
+	require.False(t, d.filterMessage(addr, &CompactBlockMessage{}))
+
+	d.connectionFeatures.Add(addr, Features{Version: 3, Capabilities: CapPbftCommit | CapCompactBlocks})
+	require.False(t, d.filterMessage(addr, &PrePrepareMessage{}))
+	require.True(t, d.filterMessage(addr, &CompactBlockMessage{}))
+	require.True(t, d.filterMessage(addr, &GetBlockTxnsMessage{}))
+
+	// the peers exchanging their clocks are sent the time pings instead of the pings
+	require.True(t, d.filterMessage(addr, &PingMessage{}))
+	require.False(t, d.filterMessage(addr, &TimePingMessage{}))
+	require.False(t, d.filterMessage(addr, &TimePongMessage{}))
+
+	d.connectionFeatures.Add(addr, Features{Version: 3, Capabilities: CapNetworkTime})
+	require.False(t, d.filterMessage(addr, &PingMessage{}))
+	require.True(t, d.filterMessage(addr, &TimePingMessage{}))
+	require.True(t, d.filterMessage(addr, &TimePongMessage{}))
+	require.True(t, d.filterMessage(addr, &PongMessage{}))
+}
+
+func TestFilterMessageValidatorsOnly(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	pk, _ := cipher.GenerateKeyPair()
+	vc := visor.NewVisorConfig()
+	vc.TrustPubkeyList = []cipher.PubKey{pk}
+	d := &Daemon{
+		Messages:             NewMessages(NewMessagesConfig()),
+		Visor:                &Visor{v: &visor.Visor{Config: vc, Blockchain: MakeBlockchain(t, db, GenesisSecret)}},
+		connectionFeatures:   NewConnectionFeatures(),
+		connectionIdentities: NewConnectionIdentities(),
+	}
+
+	require.True(t, d.Messages.ValidatorsOnly(&GivePrepareMessage{}))
+	require.True(t, d.Messages.ValidatorsOnly(&AnnouncePrepareMessage{}))
+	require.True(t, d.Messages.ValidatorsOnly(&GetPrepareMessage{}))
+	require.False(t, d.Messages.ValidatorsOnly(&CommitMessage{}))
+
+	validator := "1.2.3.4:6677"
+	peer := "5.6.7.8:6677"
+	d.connectionIdentities.Add(validator, pk)
+
+	// the prepare messages are sent to every peer unless they are sent only over the validator links
+	require.True(t, d.filterMessage(peer, &GivePrepareMessage{}))
+
+	d.Config.AuthenticatedPrepares = true
+	require.True(t, d.filterMessage(validator, &GivePrepareMessage{}))
+	require.False(t, d.filterMessage(peer, &GivePrepareMessage{}))
+	require.False(t, d.filterMessage(peer, &AnnouncePrepareMessage{}))
+	require.True(t, d.filterMessage(peer, &PingMessage{}))
+
+	// the key is checked on each send, the peer is no validator once its key is not trusted
+	d.Visor.v.Config.TrustPubkeyList = nil
+	require.False(t, d.filterMessage(validator, &GivePrepareMessage{}))
+	d.Visor.v.Config.TrustPubkeyList = []cipher.PubKey{pk}
+
+	d.connectionIdentities.Remove(validator)
+	require.False(t, d.filterMessage(validator, &GivePrepareMessage{}))
+}
+
+func TestPoolConfigMessageRateLimits(t *testing.T) {
+	prefixes := make(map[string]bool)
+	for _, mc := range getMessageConfigs() {
+		prefixes[string(mc.Prefix[:])] = true
+	}
+
+	// the messages limited by default are messages of the protocol
+	for prefix, l := range NewPoolConfig().MessageRateLimits {
+		require.True(t, prefixes[prefix], prefix)
+		require.False(t, l.Unlimited())
+	}
+}
@@ -1,10 +1,12 @@
 package daemon
 
 import (
+	"math"
 	"sort"
 	"strings"
 
 	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/daemon/gnet"
 )
 
 // Connection a connection's state within the daemon
@@ -20,6 +22,118 @@ type Connection struct {
 	Introduced bool   `json:"introduced"`
 	Mirror     uint32 `json:"mirror"`
 	ListenPort uint16 `json:"listen_port"`
+	// Protocol version and capabilities negotiated with the peer
+	ProtocolVersion int32    `json:"protocol_version"`
+	Capabilities    []string `json:"capabilities"`
+	// Whether the connection is encrypted
+	Encrypted bool `json:"encrypted"`
+	// Trust key of the validator the peer proved in the handshake, empty if it is not a validator
+	Validator string `json:"validator,omitempty"`
+	// Rate limits of the messages received from the peer
+	RateLimits []MessageLimit `json:"rate_limits"`
+	// Messages and bytes received from and sent to the peer
+	Traffic TrafficStats `json:"traffic"`
+}
+
+// MessageLimit is a rate limit of the messages received from a connection
+type MessageLimit struct {
+	// Prefix of the messages limited, empty for all the messages of the connection
+	Message string `json:"message,omitempty"`
+	// Messages per second
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+	// Messages accepted before the limit is reached
+	Available float64 `json:"available"`
+	// Messages dropped by the limit
+	Dropped uint64 `json:"dropped"`
+}
+
+// TrafficStats is the traffic of a connection or of all the connections
+type TrafficStats struct {
+	In  Traffic `json:"in"`
+	Out Traffic `json:"out"`
+	// Traffic of each message prefix
+	Messages map[string]MessageTraffic `json:"messages"`
+}
+
+// MessageTraffic is the traffic of a message prefix
+type MessageTraffic struct {
+	In  Traffic `json:"in"`
+	Out Traffic `json:"out"`
+}
+
+// Traffic is the count of the messages and bytes in one direction, with their recent rates
+type Traffic struct {
+	Messages uint64        `json:"messages"`
+	Bytes    uint64        `json:"bytes"`
+	Rates    []TrafficRate `json:"rates"`
+}
+
+// TrafficRate is the traffic per second over a recent window
+type TrafficRate struct {
+	Window   string  `json:"window"`
+	Messages float64 `json:"messages_per_second"`
+	Bytes    float64 `json:"bytes_per_second"`
+}
+
+// NetworkStats is the traffic of all the connections and the time taken to process the messages
+type NetworkStats struct {
+	Traffic  TrafficStats     `json:"traffic"`
+	Handlers []HandlerLatency `json:"handlers"`
+}
+
+func newTraffic(t gnet.Traffic) Traffic {
+	rates := make([]TrafficRate, 0, len(t.Rates))
+	for _, r := range t.Rates {
+		rates = append(rates, TrafficRate{
+			Window:   r.Window.String(),
+			Messages: r.Messages,
+			Bytes:    r.Bytes,
+		})
+	}
+	return Traffic{
+		Messages: t.Messages,
+		Bytes:    t.Bytes,
+		Rates:    rates,
+	}
+}
+
+// newTrafficStats converts the traffic counted by gnet, a prefix only sent or only received has
+// no traffic in the other direction
+func newTrafficStats(s gnet.TrafficStats) TrafficStats {
+	messages := make(map[string]MessageTraffic)
+	get := func(prefix string) MessageTraffic {
+		if mt, ok := messages[prefix]; ok {
+			return mt
+		}
+		none := newTraffic(gnet.Traffic{Rates: zeroRates()})
+		return MessageTraffic{In: none, Out: none}
+	}
+	for prefix, t := range s.MessagesIn {
+		mt := get(prefix)
+		mt.In = newTraffic(t)
+		messages[prefix] = mt
+	}
+	for prefix, t := range s.MessagesOut {
+		mt := get(prefix)
+		mt.Out = newTraffic(t)
+		messages[prefix] = mt
+	}
+
+	return TrafficStats{
+		In:       newTraffic(s.In),
+		Out:      newTraffic(s.Out),
+		Messages: messages,
+	}
+}
+
+// zeroRates returns the rates of the windows of no traffic
+func zeroRates() []gnet.Rate {
+	rates := make([]gnet.Rate, 0, len(gnet.TrafficWindows))
+	for _, w := range gnet.TrafficWindows {
+		rates = append(rates, gnet.Rate{Window: w})
+	}
+	return rates
 }
 
 // Connections an array of connections
@@ -38,6 +152,12 @@ type BlockchainProgress struct {
 		Address string `json:"address"`
 		Height  uint64 `json:"height"`
 	} `json:"peers"`
+	// Seq of the last validated header, 0 if the headers are synced
+	Headers uint64 `json:"headers"`
+	// Number of blocks downloaded and waiting for the blocks before them
+	Downloaded int `json:"downloaded"`
+	// Windows of blocks being downloaded from the peers
+	Downloads []BlockDownload `json:"downloads"`
 }
 
 // ResendResult rebroadcast tx result
@@ -69,15 +189,39 @@ func (rpc RPC) GetConnection(d *Daemon, addr string) *Connection {
 		return nil
 	}
 
+	features, _ := d.connectionFeatures.Get(addr)
+
+	var validator string
+	if pk, ok := d.connectionIdentities.Get(addr); ok && d.isValidatorLink(addr) {
+		validator = pk.Hex()
+	}
+
+	limits := []MessageLimit{}
+	for _, l := range c.RateLimits() {
+		limits = append(limits, MessageLimit{
+			Message:   l.Prefix,
+			Rate:      l.Rate,
+			Burst:     l.Burst,
+			Available: math.Floor(l.Tokens),
+			Dropped:   l.Dropped,
+		})
+	}
+
 	return &Connection{
-		ID:           c.ID,
-		Addr:         addr,
-		LastSent:     c.LastSent.Unix(),
-		LastReceived: c.LastReceived.Unix(),
-		Outgoing:     !d.outgoingConnections.Get(addr),
-		Introduced:   !d.needsIntro(addr),
-		Mirror:       mirror,
-		ListenPort:   d.GetListenPort(addr),
+		ID:              c.ID,
+		Addr:            addr,
+		LastSent:        c.LastSent.Unix(),
+		LastReceived:    c.LastReceived.Unix(),
+		Outgoing:        !d.outgoingConnections.Get(addr),
+		Introduced:      !d.needsIntro(addr),
+		Mirror:          mirror,
+		ListenPort:      d.GetListenPort(addr),
+		ProtocolVersion: features.Version,
+		Capabilities:    features.Capabilities.Names(),
+		Encrypted:       c.Encrypted(),
+		Validator:       validator,
+		RateLimits:      limits,
+		Traffic:         newTrafficStats(c.Traffic()),
 	}
 }
 
@@ -117,6 +261,18 @@ func (rpc RPC) GetConnections(d *Daemon) *Connections {
 	return &Connections{Connections: conns}
 }
 
+// GetNetworkStats returns the traffic of all the connections and the latencies of the handlers
+func (rpc RPC) GetNetworkStats(d *Daemon) *NetworkStats {
+	if d.Pool.Pool == nil {
+		return nil
+	}
+
+	return &NetworkStats{
+		Traffic:  newTrafficStats(d.Pool.Pool.Traffic()),
+		Handlers: d.handlerLatencies.Get(),
+	}
+}
+
 // GetDefaultConnections gets default connections
 func (rpc RPC) GetDefaultConnections(d *Daemon) []string {
 	return d.DefaultConnections
@@ -133,14 +289,20 @@ func (rpc RPC) GetAllExchgConnections(d *Daemon) []string {
 }
 
 // GetBlockchainProgress gets the blockchain progress
-func (rpc RPC) GetBlockchainProgress(v *Visor) *BlockchainProgress {
+func (rpc RPC) GetBlockchainProgress(v *Visor, sp BlockSyncProgress) *BlockchainProgress {
 	if v.v == nil {
 		return nil
 	}
 
 	bp := &BlockchainProgress{
-		Current: v.HeadBkSeq(),
-		Highest: v.EstimateBlockchainHeight(),
+		Current:    v.HeadBkSeq(),
+		Highest:    v.EstimateBlockchainHeight(),
+		Headers:    sp.Headers,
+		Downloaded: sp.Downloaded,
+		Downloads:  sp.Downloads,
+	}
+	if bp.Highest < sp.Headers {
+		bp.Highest = sp.Headers
 	}
 
 	peerHeights := v.GetPeerBlockchainHeights()
@@ -4,7 +4,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/daemon/pex"
+	"github.com/samoslab/samos/src/visor/blockdb"
 )
 
 // base storage struct
@@ -140,6 +142,107 @@ func (cm *ConnectionMirrors) Remove(addr string) {
 	cm.remove(addr)
 }
 
+// ConnectionFeatures records the protocol features negotiated with the connections
+type ConnectionFeatures struct {
+	store
+}
+
+// NewConnectionFeatures creates ConnectionFeatures instance
+func NewConnectionFeatures() *ConnectionFeatures {
+	return &ConnectionFeatures{
+		store: store{
+			value: make(map[interface{}]interface{}),
+		},
+	}
+}
+
+// Add adds the features of the connection
+func (cf *ConnectionFeatures) Add(addr string, f Features) {
+	cf.setValue(addr, f)
+}
+
+// Get returns the features of the connection
+func (cf *ConnectionFeatures) Get(addr string) (Features, bool) {
+	v, ok := cf.getValue(addr)
+	if ok {
+		return v.(Features), ok
+	}
+	return Features{}, false
+}
+
+// Remove removes the features of the connection
+func (cf *ConnectionFeatures) Remove(addr string) {
+	cf.remove(addr)
+}
+
+// ConnectionIdentities records the keys the peers proved in the handshakes of the encrypted
+// connections
+type ConnectionIdentities struct {
+	store
+}
+
+// NewConnectionIdentities creates ConnectionIdentities instance
+func NewConnectionIdentities() *ConnectionIdentities {
+	return &ConnectionIdentities{
+		store: store{
+			value: make(map[interface{}]interface{}),
+		},
+	}
+}
+
+// Add adds the key of the connection
+func (ci *ConnectionIdentities) Add(addr string, pk cipher.PubKey) {
+	ci.setValue(addr, pk)
+}
+
+// Get returns the key of the connection
+func (ci *ConnectionIdentities) Get(addr string) (cipher.PubKey, bool) {
+	v, ok := ci.getValue(addr)
+	if ok {
+		return v.(cipher.PubKey), ok
+	}
+	return cipher.PubKey{}, false
+}
+
+// Remove removes the key of the connection
+func (ci *ConnectionIdentities) Remove(addr string) {
+	ci.remove(addr)
+}
+
+// ConnectionQuorumCerts records the quorum certificates the peers sent for their next blocks
+type ConnectionQuorumCerts struct {
+	store
+}
+
+// NewConnectionQuorumCerts creates ConnectionQuorumCerts instance
+func NewConnectionQuorumCerts() *ConnectionQuorumCerts {
+	return &ConnectionQuorumCerts{
+		store: store{
+			value: make(map[interface{}]interface{}),
+		},
+	}
+}
+
+// Add records the quorum certificates of the connection
+func (cq *ConnectionQuorumCerts) Add(addr string, certs []blockdb.QuorumCert) {
+	cq.setValue(addr, certs)
+}
+
+// Take returns and removes the quorum certificates of the connection
+func (cq *ConnectionQuorumCerts) Take(addr string) []blockdb.QuorumCert {
+	v, ok := cq.getValue(addr)
+	if !ok {
+		return nil
+	}
+	cq.remove(addr)
+	return v.([]blockdb.QuorumCert)
+}
+
+// Remove removes the quorum certificates of the connection
+func (cq *ConnectionQuorumCerts) Remove(addr string) {
+	cq.remove(addr)
+}
+
 // OutgoingConnections records the outgoing connections
 type OutgoingConnections struct {
 	store
@@ -7,8 +7,10 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/daemon/pex"
 	"github.com/samoslab/samos/src/util/utc"
+	"github.com/samoslab/samos/src/visor/blockdb"
 )
 
 func TestStoreAdd(t *testing.T) {
@@ -225,6 +227,20 @@ func TestConnMirrorsRemove(t *testing.T) {
 	assert.True(t, ok)
 }
 
+func TestConnQuorumCertsTake(t *testing.T) {
+	cq := NewConnectionQuorumCerts()
+	certs := []blockdb.QuorumCert{{Hash: cipher.SumSHA256([]byte("a"))}}
+	cq.Add("a", certs)
+	assert.Nil(t, cq.Take("b"))
+	assert.Equal(t, certs, cq.Take("a"))
+	// the certificates are only given to the next blocks of the connection
+	assert.Nil(t, cq.Take("a"))
+
+	cq.Add("a", certs)
+	cq.Remove("a")
+	assert.Nil(t, cq.Take("a"))
+}
+
 func TestNewOutgoingConnections(t *testing.T) {
 	oc := NewOutgoingConnections(3)
 	assert.NotNil(t, oc)
@@ -0,0 +1,705 @@
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/daemon/gnet"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+// SignedHeader is a block header with the signature of its producer
+type SignedHeader struct {
+	Header coin.BlockHeader
+	Sig    cipher.Sig
+}
+
+// syncNode is the node the blocks are synced to
+type syncNode interface {
+	HeadBlock() (*coin.SignedBlock, error)
+	VerifyHeader(h coin.BlockHeader, sig cipher.Sig) error
+	ExecuteSignedBlock(b coin.SignedBlock, qc *blockdb.QuorumCert) error
+	SendMessage(addr string, m gnet.Message) error
+}
+
+// blockDownload is a window of block bodies requested from a peer
+type blockDownload struct {
+	addr      string
+	start     uint64
+	hashes    []cipher.SHA256
+	requested time.Time
+}
+
+// syncedBlock is a downloaded block waiting for the blocks before it
+type syncedBlock struct {
+	block coin.SignedBlock
+	qc    *blockdb.QuorumCert
+}
+
+// errInvalidSyncData is the error of headers or block bodies received from a peer which do not
+// match the chain, the peer misbehaved
+type errInvalidSyncData struct {
+	error
+}
+
+// BlockSync downloads the blocks headers first. The headers after the head block are requested
+// from a peer and their chain and producer signatures are validated. The block bodies are then
+// requested in windows from several peers in parallel, a window not received in time is
+// requested again from another peer. The blocks are executed in order as they arrive.
+// BlockSync is used from the daemon loop only.
+type BlockSync struct {
+	config VisorConfig
+
+	// validated headers after the head block, in order
+	headers []SignedHeader
+	// pending request of headers
+	headersAddr      string
+	headersRequested time.Time
+	// body downloads by the address of the peer, a peer downloads one window at a time
+	downloads map[string]*blockDownload
+	// downloaded blocks by seq
+	blocks map[uint64]syncedBlock
+	// how many times the window starting at the seq was requested again
+	retries map[uint64]int
+	// how many requests the peer did not answer in time or answered wrongly since its last answer
+	stalls map[string]int
+}
+
+// NewBlockSync creates a BlockSync
+func NewBlockSync(c VisorConfig) *BlockSync {
+	return &BlockSync{
+		config:    c,
+		downloads: make(map[string]*blockDownload),
+		blocks:    make(map[uint64]syncedBlock),
+		retries:   make(map[uint64]int),
+		stalls:    make(map[string]int),
+	}
+}
+
+// reset drops the headers and the downloads
+func (bs *BlockSync) reset() {
+	bs.headers = nil
+	bs.headersAddr = ""
+	bs.downloads = make(map[string]*blockDownload)
+	bs.blocks = make(map[uint64]syncedBlock)
+	bs.retries = make(map[uint64]int)
+}
+
+// header returns the header of the seq
+func (bs *BlockSync) header(seq uint64) (SignedHeader, bool) {
+	if len(bs.headers) == 0 {
+		return SignedHeader{}, false
+	}
+	first := bs.headers[0].Header.BkSeq
+	if seq < first || seq-first >= uint64(len(bs.headers)) {
+		return SignedHeader{}, false
+	}
+	return bs.headers[seq-first], true
+}
+
+// tip returns the seq and hash of the last header, or of the head block if there is none
+func (bs *BlockSync) tip(head *coin.SignedBlock) (uint64, cipher.SHA256) {
+	if len(bs.headers) == 0 {
+		return head.Seq(), head.HashHeader()
+	}
+	h := bs.headers[len(bs.headers)-1].Header
+	return h.BkSeq, h.Hash()
+}
+
+// prune drops the headers and downloads of the blocks the head block includes, everything is
+// dropped if the head is not on the chain of the headers
+func (bs *BlockSync) prune(head *coin.SignedBlock) {
+	seq := head.Seq()
+	if h, ok := bs.header(seq); ok && h.Header.Hash() != head.HashHeader() {
+		logger.Infof("Block %d is not on the synced header chain, dropping the headers", seq)
+		bs.reset()
+		return
+	}
+
+	i := 0
+	for i < len(bs.headers) && bs.headers[i].Header.BkSeq <= seq {
+		i++
+	}
+	bs.headers = bs.headers[i:]
+	if len(bs.headers) != 0 && bs.headers[0].Header.PrevHash != head.HashHeader() {
+		logger.Infof("Header %d does not extend the head block, dropping the headers", bs.headers[0].Header.BkSeq)
+		bs.reset()
+		return
+	}
+
+	for s := range bs.blocks {
+		if s <= seq {
+			delete(bs.blocks, s)
+		}
+	}
+	for s := range bs.retries {
+		if s <= seq {
+			delete(bs.retries, s)
+		}
+	}
+	for addr, dl := range bs.downloads {
+		if dl.start+uint64(len(dl.hashes)) <= seq+1 {
+			delete(bs.downloads, addr)
+		}
+	}
+}
+
+// Step expires the requests not answered in time and requests more headers and bodies from
+// the peers, which are the peers syncing headers first with their blockchain height
+func (bs *BlockSync) Step(n syncNode, peers map[string]uint64, now time.Time) {
+	head, err := n.HeadBlock()
+	if err != nil {
+		logger.Errorf("Get head block failed: %v", err)
+		return
+	}
+	bs.prune(head)
+	bs.expire(now)
+	bs.requestHeaders(n, head, peers, now)
+	bs.requestBodies(n, peers, now)
+}
+
+// expire drops the requests not answered in time
+func (bs *BlockSync) expire(now time.Time) {
+	timeout := bs.config.BlockDownloadTimeout
+	if bs.headersAddr != "" && now.Sub(bs.headersRequested) > timeout {
+		logger.Infof("Headers request to %s timed out", bs.headersAddr)
+		bs.stalls[bs.headersAddr]++
+		bs.headersAddr = ""
+	}
+
+	for addr, dl := range bs.downloads {
+		if now.Sub(dl.requested) <= timeout {
+			continue
+		}
+		logger.Infof("Blocks %d to %d requested from %s timed out", dl.start, dl.start+uint64(len(dl.hashes))-1, addr)
+		bs.stalls[addr]++
+		delete(bs.downloads, addr)
+		bs.retries[dl.start]++
+		if bs.retries[dl.start] > bs.config.MaxBlockDownloadRetries {
+			logger.Infof("Blocks from %d were not received in %d requests, dropping the headers", dl.start, bs.retries[dl.start])
+			bs.reset()
+			return
+		}
+	}
+}
+
+// bestPeers returns the peers with a height of at least seq, those which stalled the least first
+// and the highest of them first
+func (bs *BlockSync) bestPeers(peers map[string]uint64, seq uint64) []string {
+	addrs := make([]string, 0, len(peers))
+	for addr, height := range peers {
+		if height >= seq {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		a, b := addrs[i], addrs[j]
+		if bs.stalls[a] != bs.stalls[b] {
+			return bs.stalls[a] < bs.stalls[b]
+		}
+		if peers[a] != peers[b] {
+			return peers[a] > peers[b]
+		}
+		return a < b
+	})
+	return addrs
+}
+
+// requestHeaders requests the headers after the tip from the best peer higher than it
+func (bs *BlockSync) requestHeaders(n syncNode, head *coin.SignedBlock, peers map[string]uint64, now time.Time) {
+	if bs.headersAddr != "" || len(bs.headers) >= bs.config.MaxSyncHeaders {
+		return
+	}
+
+	seq, _ := bs.tip(head)
+	addrs := bs.bestPeers(peers, seq+1)
+	if len(addrs) == 0 {
+		return
+	}
+
+	m := NewGetHeadersMessage(seq, bs.config.HeadersResponseCount)
+	if err := n.SendMessage(addrs[0], m); err != nil {
+		logger.Errorf("Send GetHeadersMessage to %s failed: %v", addrs[0], err)
+		return
+	}
+	bs.headersAddr = addrs[0]
+	bs.headersRequested = now
+}
+
+// requestBodies requests the bodies of the headers not downloaded yet, in windows from the peers
+// not downloading one
+func (bs *BlockSync) requestBodies(n syncNode, peers map[string]uint64, now time.Time) {
+	downloading := make(map[uint64]bool)
+	for _, dl := range bs.downloads {
+		for i := range dl.hashes {
+			downloading[dl.start+uint64(i)] = true
+		}
+	}
+
+	i := 0
+	for i < len(bs.headers) && len(bs.downloads) < bs.config.MaxBlockDownloads {
+		// the next window is the headers neither downloaded nor downloading
+		start := bs.headers[i].Header.BkSeq
+		if _, ok := bs.blocks[start]; ok || downloading[start] {
+			i++
+			continue
+		}
+		var hashes []cipher.SHA256
+		for ; i < len(bs.headers) && uint64(len(hashes)) < bs.config.BlockDownloadWindow; i++ {
+			seq := bs.headers[i].Header.BkSeq
+			if _, ok := bs.blocks[seq]; ok || downloading[seq] {
+				break
+			}
+			hashes = append(hashes, bs.headers[i].Header.Hash())
+		}
+
+		end := start + uint64(len(hashes)) - 1
+		var addr string
+		for _, a := range bs.bestPeers(peers, end) {
+			if _, ok := bs.downloads[a]; !ok {
+				addr = a
+				break
+			}
+		}
+		if addr == "" {
+			return
+		}
+
+		if err := n.SendMessage(addr, NewGetBlockBodiesMessage(hashes)); err != nil {
+			logger.Errorf("Send GetBlockBodiesMessage to %s failed: %v", addr, err)
+			return
+		}
+		bs.downloads[addr] = &blockDownload{
+			addr:      addr,
+			start:     start,
+			hashes:    hashes,
+			requested: now,
+		}
+	}
+}
+
+// AddHeaders validates the headers received from the peer and appends those extending the tip
+// to the header chain. It returns the number of headers appended.
+func (bs *BlockSync) AddHeaders(n syncNode, addr string, headers []SignedHeader) (int, error) {
+	if addr == bs.headersAddr {
+		bs.headersAddr = ""
+	}
+
+	head, err := n.HeadBlock()
+	if err != nil {
+		return 0, err
+	}
+	bs.prune(head)
+
+	seq, hash := bs.tip(head)
+	i := 0
+	for i < len(headers) && headers[i].Header.BkSeq <= seq {
+		i++
+	}
+
+	added := 0
+	for ; i < len(headers) && len(bs.headers) < bs.config.MaxSyncHeaders; i++ {
+		h := headers[i]
+		if h.Header.BkSeq != seq+1 || h.Header.PrevHash != hash {
+			if added == 0 {
+				// the headers of another chain, or a reply to an older request
+				return 0, nil
+			}
+			bs.stalls[addr]++
+			return added, errInvalidSyncData{fmt.Errorf("header %d does not extend header %d", h.Header.BkSeq, seq)}
+		}
+		if err := n.VerifyHeader(h.Header, h.Sig); err != nil {
+			bs.stalls[addr]++
+			err = fmt.Errorf("header %d: %v", h.Header.BkSeq, err)
+			// the validators of the blocks after the next one may be elected in the blocks between
+			if h.Header.BkSeq == head.Seq()+1 {
+				err = errInvalidSyncData{err}
+			}
+			return added, err
+		}
+
+		bs.headers = append(bs.headers, h)
+		seq, hash = h.Header.BkSeq, h.Header.Hash()
+		added++
+	}
+
+	if added != 0 {
+		bs.stalls[addr] = 0
+	}
+	return added, nil
+}
+
+// AddBodies adds the block bodies received from the peer for the window it downloads and executes
+// the blocks following the head. It returns the number of blocks executed.
+func (bs *BlockSync) AddBodies(n syncNode, addr string, bodies []coin.BlockBody, certs []blockdb.QuorumCert) (int, error) {
+	dl, ok := bs.downloads[addr]
+	if !ok {
+		return 0, nil
+	}
+	delete(bs.downloads, addr)
+
+	qcs := make(map[cipher.SHA256]*blockdb.QuorumCert, len(certs))
+	for i := range certs {
+		qcs[certs[i].Hash] = &certs[i]
+	}
+
+	var err error
+	received := 0
+	for i, body := range bodies {
+		if i >= len(dl.hashes) {
+			break
+		}
+		seq := dl.start + uint64(i)
+		h, ok := bs.header(seq)
+		if !ok {
+			// the block was executed meanwhile
+			continue
+		}
+		if body.Hash() != h.Header.BodyHash {
+			bs.stalls[addr]++
+			err = errInvalidSyncData{fmt.Errorf("body of block %d does not match its header", seq)}
+			break
+		}
+		bs.blocks[seq] = syncedBlock{
+			block: coin.SignedBlock{
+				Block: coin.Block{Head: h.Header, Body: body},
+				Sig:   h.Sig,
+			},
+			qc: qcs[h.Header.Hash()],
+		}
+		received++
+	}
+
+	if received < len(dl.hashes) {
+		bs.retries[dl.start]++
+	}
+	if received != 0 && err == nil {
+		bs.stalls[addr] = 0
+	}
+
+	executed, execErr := bs.execute(n)
+	if err == nil {
+		err = execErr
+	}
+	return executed, err
+}
+
+// execute executes the downloaded blocks following the head
+func (bs *BlockSync) execute(n syncNode) (int, error) {
+	head, err := n.HeadBlock()
+	if err != nil {
+		return 0, err
+	}
+	bs.prune(head)
+
+	executed := 0
+	for {
+		b, ok := bs.blocks[head.Seq()+1]
+		if !ok {
+			break
+		}
+		if err := n.ExecuteSignedBlock(b.block, b.qc); err != nil {
+			bs.reset()
+			return executed, fmt.Errorf("execute block %d failed: %v", b.block.Seq(), err)
+		}
+		executed++
+		head = &b.block
+		bs.prune(head)
+	}
+
+	return executed, nil
+}
+
+// RemovePeer drops the requests to the peer
+func (bs *BlockSync) RemovePeer(addr string) {
+	if bs.headersAddr == addr {
+		bs.headersAddr = ""
+	}
+	delete(bs.downloads, addr)
+	delete(bs.stalls, addr)
+}
+
+// BlockDownload is a window of blocks being downloaded from a peer
+type BlockDownload struct {
+	Address string `json:"address"`
+	From    uint64 `json:"from"`
+	To      uint64 `json:"to"`
+	// Retries is how many times the window was requested before
+	Retries int `json:"retries"`
+	// Elapsed is the time since the window was requested
+	Elapsed string `json:"elapsed"`
+}
+
+// BlockSyncProgress is the state of the headers first sync
+type BlockSyncProgress struct {
+	// Headers is the seq of the last validated header, 0 if the headers are synced
+	Headers uint64
+	// Downloaded is the number of blocks downloaded and waiting for the blocks before them
+	Downloaded int
+	// Downloads are the windows being downloaded, by seq
+	Downloads []BlockDownload
+}
+
+// Progress returns the state of the sync
+func (bs *BlockSync) Progress(now time.Time) BlockSyncProgress {
+	p := BlockSyncProgress{
+		Downloaded: len(bs.blocks),
+		Downloads:  make([]BlockDownload, 0, len(bs.downloads)),
+	}
+	if len(bs.headers) != 0 {
+		p.Headers = bs.headers[len(bs.headers)-1].Header.BkSeq
+	}
+
+	for _, dl := range bs.downloads {
+		p.Downloads = append(p.Downloads, BlockDownload{
+			Address: dl.addr,
+			From:    dl.start,
+			To:      dl.start + uint64(len(dl.hashes)) - 1,
+			Retries: bs.retries[dl.start],
+			Elapsed: now.Sub(dl.requested).Round(time.Millisecond).String(),
+		})
+	}
+	sort.Slice(p.Downloads, func(i, j int) bool {
+		return p.Downloads[i].From < p.Downloads[j].From
+	})
+	return p
+}
+
+// daemonSyncNode syncs the blocks to the visor of the daemon
+type daemonSyncNode struct {
+	d *Daemon
+}
+
+func (n daemonSyncNode) HeadBlock() (*coin.SignedBlock, error) {
+	return n.d.Visor.GetHeadBlock()
+}
+
+func (n daemonSyncNode) VerifyHeader(h coin.BlockHeader, sig cipher.Sig) error {
+	return n.d.Visor.VerifyHeader(h, sig)
+}
+
+func (n daemonSyncNode) ExecuteSignedBlock(b coin.SignedBlock, qc *blockdb.QuorumCert) error {
+	if err := n.d.Visor.ExecuteSignedBlock(b, qc); err != nil {
+		return err
+	}
+	logger.Critical().Infof("Added new block %d", b.Seq())
+	return nil
+}
+
+func (n daemonSyncNode) SendMessage(addr string, m gnet.Message) error {
+	return n.d.Pool.Pool.SendMessage(addr, m)
+}
+
+// syncPeers returns the heights of the peers syncing headers first
+func (dm *Daemon) syncPeers() map[string]uint64 {
+	peers := make(map[string]uint64)
+	for _, p := range dm.Visor.GetPeerBlockchainHeights() {
+		if dm.peerSupports(p.Address, CapHeadersSync) {
+			peers[p.Address] = p.Height
+		}
+	}
+	return peers
+}
+
+// stepBlockSync requests the headers and block bodies due
+func (dm *Daemon) stepBlockSync() {
+	if dm.Visor.Config.DisableNetworking {
+		return
+	}
+	dm.blockSync.Step(daemonSyncNode{dm}, dm.syncPeers(), time.Now())
+}
+
+// requestBlocks requests the blocks after the head from the peers which do not sync headers
+// first, the block sync requests them from the others
+func (dm *Daemon) requestBlocks() {
+	if dm.Visor.Config.DisableNetworking {
+		return
+	}
+
+	conns, err := dm.Pool.Pool.GetConnections()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	for _, c := range conns {
+		addr := c.Addr()
+		if dm.needsIntro(addr) || dm.peerSupports(addr, CapHeadersSync) {
+			continue
+		}
+		if err := dm.Visor.RequestBlocksFromAddr(dm.Pool, addr); err != nil {
+			logger.Debugf("Request blocks from %s failed: %v", addr, err)
+		}
+	}
+
+	dm.stepBlockSync()
+}
+
+// GetHeadersMessage requests the headers of the blocks after LastBlock
+type GetHeadersMessage struct {
+	LastBlock        uint64
+	RequestedHeaders uint64
+	c                *gnet.MessageContext `enc:"-"`
+}
+
+// NewGetHeadersMessage creates GetHeadersMessage
+func NewGetHeadersMessage(lastBlock, requestedHeaders uint64) *GetHeadersMessage {
+	return &GetHeadersMessage{
+		LastBlock:        lastBlock,
+		RequestedHeaders: requestedHeaders,
+	}
+}
+
+// Handle handles message
+func (ghm *GetHeadersMessage) Handle(mc *gnet.MessageContext, daemon interface{}) error {
+	ghm.c = mc
+	return daemon.(*Daemon).recordMessageEvent(ghm, mc)
+}
+
+// Process sends the headers requested
+func (ghm *GetHeadersMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking {
+		return
+	}
+
+	ct := ghm.RequestedHeaders
+	if ct > d.Visor.Config.HeadersResponseCount {
+		ct = d.Visor.Config.HeadersResponseCount
+	}
+	headers, err := d.Visor.GetSignedHeadersSince(ghm.LastBlock, ct)
+	if err != nil {
+		logger.Infof("Get signed headers failed: %v", err)
+		return
+	}
+	if len(headers) == 0 {
+		return
+	}
+
+	if err := d.Pool.Pool.SendMessage(ghm.c.Addr, NewGiveHeadersMessage(headers)); err != nil {
+		logger.Errorf("Send GiveHeadersMessage to %s failed: %v", ghm.c.Addr, err)
+	}
+}
+
+// GiveHeadersMessage sent in response to GetHeadersMessage
+type GiveHeadersMessage struct {
+	Headers []SignedHeader
+	c       *gnet.MessageContext `enc:"-"`
+}
+
+// NewGiveHeadersMessage creates GiveHeadersMessage
+func NewGiveHeadersMessage(headers []SignedHeader) *GiveHeadersMessage {
+	return &GiveHeadersMessage{
+		Headers: headers,
+	}
+}
+
+// Handle handles message
+func (ghm *GiveHeadersMessage) Handle(mc *gnet.MessageContext, daemon interface{}) error {
+	ghm.c = mc
+	return daemon.(*Daemon).recordMessageEvent(ghm, mc)
+}
+
+// Process adds the headers to the header chain and requests their bodies
+func (ghm *GiveHeadersMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking || len(ghm.Headers) == 0 {
+		return
+	}
+
+	// The peer has the blocks of the headers
+	d.Visor.RecordBlockchainHeight(ghm.c.Addr, ghm.Headers[len(ghm.Headers)-1].Header.BkSeq)
+
+	added, err := d.blockSync.AddHeaders(daemonSyncNode{d}, ghm.c.Addr, ghm.Headers)
+	if err != nil {
+		logger.Errorf("Invalid headers from %s: %v", ghm.c.Addr, err)
+		if _, ok := err.(errInvalidSyncData); ok {
+			d.misbehave(ghm.c.Addr, offenseInvalidSyncData)
+		}
+	}
+	if added != 0 {
+		logger.Debugf("Added %d headers from %s", added, ghm.c.Addr)
+	}
+	d.stepBlockSync()
+}
+
+// GetBlockBodiesMessage requests the bodies of the blocks
+type GetBlockBodiesMessage struct {
+	Hashes []cipher.SHA256
+	c      *gnet.MessageContext `enc:"-"`
+}
+
+// NewGetBlockBodiesMessage creates GetBlockBodiesMessage
+func NewGetBlockBodiesMessage(hashes []cipher.SHA256) *GetBlockBodiesMessage {
+	return &GetBlockBodiesMessage{
+		Hashes: hashes,
+	}
+}
+
+// Handle handles message
+func (gbm *GetBlockBodiesMessage) Handle(mc *gnet.MessageContext, daemon interface{}) error {
+	gbm.c = mc
+	return daemon.(*Daemon).recordMessageEvent(gbm, mc)
+}
+
+// Process sends the bodies of the blocks known, up to the first unknown block
+func (gbm *GetBlockBodiesMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking {
+		return
+	}
+
+	hashes := gbm.Hashes
+	if uint64(len(hashes)) > d.Visor.Config.BlockDownloadWindow {
+		hashes = hashes[:d.Visor.Config.BlockDownloadWindow]
+	}
+	bodies, certs, err := d.Visor.GetBlockBodies(hashes)
+	if err != nil {
+		logger.Errorf("Get block bodies failed: %v", err)
+		return
+	}
+
+	if err := d.Pool.Pool.SendMessage(gbm.c.Addr, NewGiveBlockBodiesMessage(bodies, certs)); err != nil {
+		logger.Errorf("Send GiveBlockBodiesMessage to %s failed: %v", gbm.c.Addr, err)
+	}
+}
+
+// GiveBlockBodiesMessage sent in response to GetBlockBodiesMessage.
+// Certs are the quorum certificates of the blocks which have one.
+type GiveBlockBodiesMessage struct {
+	Bodies []coin.BlockBody
+	Certs  []blockdb.QuorumCert
+	c      *gnet.MessageContext `enc:"-"`
+}
+
+// NewGiveBlockBodiesMessage creates GiveBlockBodiesMessage
+func NewGiveBlockBodiesMessage(bodies []coin.BlockBody, certs []blockdb.QuorumCert) *GiveBlockBodiesMessage {
+	return &GiveBlockBodiesMessage{
+		Bodies: bodies,
+		Certs:  certs,
+	}
+}
+
+// Handle handles message
+func (gbm *GiveBlockBodiesMessage) Handle(mc *gnet.MessageContext, daemon interface{}) error {
+	gbm.c = mc
+	return daemon.(*Daemon).recordMessageEvent(gbm, mc)
+}
+
+// Process executes the blocks and requests more
+func (gbm *GiveBlockBodiesMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking {
+		return
+	}
+
+	executed, err := d.blockSync.AddBodies(daemonSyncNode{d}, gbm.c.Addr, gbm.Bodies, gbm.Certs)
+	if err != nil {
+		logger.Errorf("Invalid blocks from %s: %v", gbm.c.Addr, err)
+		if _, ok := err.(errInvalidSyncData); ok {
+			d.misbehave(gbm.c.Addr, offenseInvalidSyncData)
+		}
+	}
+	if executed != 0 {
+		d.Pool.Pool.BroadcastMessage(NewAnnounceBlocksMessage(d.Visor.HeadBkSeq()))
+	}
+	d.stepBlockSync()
+}
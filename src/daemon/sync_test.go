@@ -0,0 +1,342 @@
+package daemon
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/daemon/gnet"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+// fakeSyncNode keeps the executed blocks and the messages sent
+type fakeSyncNode struct {
+	chain []coin.SignedBlock
+	certs []*blockdb.QuorumCert
+	// seqs of the headers with an invalid signature
+	badSigs map[uint64]bool
+	sent    []sentMessage
+}
+
+type sentMessage struct {
+	addr string
+	msg  gnet.Message
+}
+
+func newFakeSyncNode(genesis coin.SignedBlock) *fakeSyncNode {
+	return &fakeSyncNode{
+		chain:   []coin.SignedBlock{genesis},
+		certs:   []*blockdb.QuorumCert{nil},
+		badSigs: make(map[uint64]bool),
+	}
+}
+
+func (n *fakeSyncNode) HeadBlock() (*coin.SignedBlock, error) {
+	return &n.chain[len(n.chain)-1], nil
+}
+
+func (n *fakeSyncNode) VerifyHeader(h coin.BlockHeader, sig cipher.Sig) error {
+	if n.badSigs[h.BkSeq] {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func (n *fakeSyncNode) ExecuteSignedBlock(b coin.SignedBlock, qc *blockdb.QuorumCert) error {
+	head := n.chain[len(n.chain)-1]
+	if b.Seq() != head.Seq()+1 || b.Head.PrevHash != head.HashHeader() {
+		return errors.New("block does not extend the head")
+	}
+	n.chain = append(n.chain, b)
+	n.certs = append(n.certs, qc)
+	return nil
+}
+
+func (n *fakeSyncNode) SendMessage(addr string, m gnet.Message) error {
+	n.sent = append(n.sent, sentMessage{addr, m})
+	return nil
+}
+
+// takeSent returns and clears the messages sent
+func (n *fakeSyncNode) takeSent() []sentMessage {
+	sent := n.sent
+	n.sent = nil
+	return sent
+}
+
+// makeSyncChain makes a chain of blocks with distinct bodies, starting with the genesis block,
+// the blocks after the genesis block have the time t so the chains of different times fork
+func makeSyncChain(n int, t uint64) []coin.SignedBlock {
+	chain := make([]coin.SignedBlock, n)
+	var prevHash cipher.SHA256
+	for i := range chain {
+		body := coin.BlockBody{
+			Transactions: coin.Transactions{
+				{Length: uint32(i)},
+			},
+		}
+		chain[i] = coin.SignedBlock{
+			Block: coin.Block{
+				Head: coin.BlockHeader{
+					BkSeq:    uint64(i),
+					PrevHash: prevHash,
+					BodyHash: body.Hash(),
+				},
+				Body: body,
+			},
+		}
+		if i != 0 {
+			chain[i].Head.Time = t
+		}
+		prevHash = chain[i].HashHeader()
+	}
+	return chain
+}
+
+func syncHeaders(blocks []coin.SignedBlock) []SignedHeader {
+	headers := make([]SignedHeader, len(blocks))
+	for i, b := range blocks {
+		headers[i] = SignedHeader{Header: b.Head, Sig: b.Sig}
+	}
+	return headers
+}
+
+func syncBodies(blocks []coin.SignedBlock) []coin.BlockBody {
+	bodies := make([]coin.BlockBody, len(blocks))
+	for i, b := range blocks {
+		bodies[i] = b.Body
+	}
+	return bodies
+}
+
+func testBlockSyncConfig() VisorConfig {
+	c := NewVisorConfig()
+	c.HeadersResponseCount = 100
+	c.BlockDownloadWindow = 3
+	c.MaxBlockDownloads = 2
+	c.BlockDownloadTimeout = time.Second * 10
+	c.MaxBlockDownloadRetries = 2
+	c.MaxSyncHeaders = 100
+	return c
+}
+
+func TestBlockSyncHeaders(t *testing.T) {
+	chain := makeSyncChain(8, 0)
+	n := newFakeSyncNode(chain[0])
+	bs := NewBlockSync(testBlockSyncConfig())
+	now := time.Now()
+
+	// the headers are requested from the highest peer above the head
+	bs.Step(n, map[string]uint64{"a": 0, "b": 5, "c": 7}, now)
+	sent := n.takeSent()
+	require.Len(t, sent, 1)
+	require.Equal(t, "c", sent[0].addr)
+	require.Equal(t, NewGetHeadersMessage(0, 100), sent[0].msg)
+
+	// one request of headers is pending at a time
+	bs.Step(n, map[string]uint64{"c": 7}, now)
+	require.Empty(t, n.takeSent())
+
+	// the headers already known are skipped
+	added, err := bs.AddHeaders(n, "c", syncHeaders(chain[:4]))
+	require.NoError(t, err)
+	require.Equal(t, 3, added)
+	require.Equal(t, uint64(3), bs.Progress(now).Headers)
+
+	// the headers of another chain are ignored
+	other := makeSyncChain(6, 1)
+	added, err = bs.AddHeaders(n, "b", syncHeaders(other[4:]))
+	require.NoError(t, err)
+	require.Equal(t, 0, added)
+
+	// a header with an invalid signature stops the headers
+	n.badSigs[6] = true
+	added, err = bs.AddHeaders(n, "c", syncHeaders(chain[4:]))
+	require.EqualError(t, err, "header 6: invalid signature")
+	// the validators of the header 6 may not be known yet
+	_, ok := err.(errInvalidSyncData)
+	require.False(t, ok)
+	require.Equal(t, 2, added)
+	require.Equal(t, 1, bs.stalls["c"])
+	require.Equal(t, uint64(5), bs.Progress(now).Headers)
+
+	// a header not extending the chain stops the headers
+	broken := syncHeaders(chain[6:])
+	broken[1].Header.PrevHash = cipher.SHA256{}
+	delete(n.badSigs, 6)
+	added, err = bs.AddHeaders(n, "b", broken)
+	require.EqualError(t, err, "header 7 does not extend header 6")
+	require.IsType(t, errInvalidSyncData{}, err)
+	require.Equal(t, 1, added)
+	require.Equal(t, 1, bs.stalls["b"])
+	require.Equal(t, uint64(6), bs.Progress(now).Headers)
+
+	// the validators of the header following the head are known
+	n = newFakeSyncNode(chain[0])
+	n.badSigs[1] = true
+	bs = NewBlockSync(testBlockSyncConfig())
+	added, err = bs.AddHeaders(n, "a", syncHeaders(chain[1:]))
+	require.EqualError(t, err, "header 1: invalid signature")
+	require.IsType(t, errInvalidSyncData{}, err)
+	require.Equal(t, 0, added)
+}
+
+func TestBlockSyncParallelDownloads(t *testing.T) {
+	chain := makeSyncChain(11, 0)
+	n := newFakeSyncNode(chain[0])
+	bs := NewBlockSync(testBlockSyncConfig())
+	now := time.Now()
+	peers := map[string]uint64{"a": 10, "b": 10, "c": 4}
+
+	added, err := bs.AddHeaders(n, "a", syncHeaders(chain[1:]))
+	require.NoError(t, err)
+	require.Equal(t, 10, added)
+
+	// the windows are downloaded from the peers having them, at most MaxBlockDownloads at once
+	bs.Step(n, peers, now)
+	sent := n.takeSent()
+	require.Len(t, sent, 2)
+	require.Equal(t, "a", sent[0].addr)
+	require.Equal(t, NewGetBlockBodiesMessage(syncHashes(chain[1:4])), sent[0].msg)
+	require.Equal(t, "b", sent[1].addr)
+	require.Equal(t, NewGetBlockBodiesMessage(syncHashes(chain[4:7])), sent[1].msg)
+
+	require.Equal(t, BlockSyncProgress{
+		Headers: 10,
+		Downloads: []BlockDownload{
+			{Address: "a", From: 1, To: 3, Elapsed: "0s"},
+			{Address: "b", From: 4, To: 6, Elapsed: "0s"},
+		},
+	}, bs.Progress(now))
+
+	// the blocks received out of order wait for the blocks before them
+	executed, err := bs.AddBodies(n, "b", syncBodies(chain[4:7]), nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, executed)
+	require.Equal(t, 3, bs.Progress(now).Downloaded)
+
+	// the bodies of another window from the peer are ignored
+	executed, err = bs.AddBodies(n, "b", syncBodies(chain[1:4]), nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, executed)
+
+	qc := blockdb.QuorumCert{Hash: chain[2].HashHeader()}
+	executed, err = bs.AddBodies(n, "a", syncBodies(chain[1:4]), []blockdb.QuorumCert{qc})
+	require.NoError(t, err)
+	require.Equal(t, 6, executed)
+	require.Equal(t, chain[:7], n.chain)
+	require.Equal(t, BlockSyncProgress{
+		Headers:   10,
+		Downloads: []BlockDownload{},
+	}, bs.Progress(now))
+
+	require.Equal(t, []*blockdb.QuorumCert{nil, nil, &qc, nil, nil, nil, nil}, n.certs)
+
+	// the next windows are requested from the free peers
+	bs.Step(n, peers, now)
+	sent = n.takeSent()
+	require.Len(t, sent, 2)
+	require.Equal(t, "a", sent[0].addr)
+	require.Equal(t, NewGetBlockBodiesMessage(syncHashes(chain[7:10])), sent[0].msg)
+	require.Equal(t, "b", sent[1].addr)
+	require.Equal(t, NewGetBlockBodiesMessage(syncHashes(chain[10:])), sent[1].msg)
+
+	// the bodies before a body not matching its header are executed
+	bodies := syncBodies(chain[7:10])
+	bodies[1] = chain[10].Body
+	executed, err = bs.AddBodies(n, "a", bodies, nil)
+	require.EqualError(t, err, "body of block 8 does not match its header")
+	require.IsType(t, errInvalidSyncData{}, err)
+	require.Equal(t, 1, executed)
+	require.Equal(t, chain[:8], n.chain)
+	require.Equal(t, 1, bs.stalls["a"])
+}
+
+func TestBlockSyncRetries(t *testing.T) {
+	chain := makeSyncChain(5, 0)
+	n := newFakeSyncNode(chain[0])
+	c := testBlockSyncConfig()
+	c.MaxBlockDownloads = 1
+	bs := NewBlockSync(c)
+	now := time.Now()
+	peers := map[string]uint64{"a": 4, "b": 4}
+
+	_, err := bs.AddHeaders(n, "a", syncHeaders(chain[1:]))
+	require.NoError(t, err)
+	bs.Step(n, peers, now)
+	sent := n.takeSent()
+	require.Len(t, sent, 1)
+	require.Equal(t, "a", sent[0].addr)
+
+	// a body not matching its header is requested again from another peer
+	bodies := syncBodies(chain[1:4])
+	bodies[0] = chain[4].Body
+	_, err = bs.AddBodies(n, "a", bodies, nil)
+	require.EqualError(t, err, "body of block 1 does not match its header")
+	require.Equal(t, 1, bs.stalls["a"])
+
+	bs.Step(n, peers, now)
+	sent = n.takeSent()
+	require.Len(t, sent, 1)
+	require.Equal(t, "b", sent[0].addr)
+	require.Equal(t, NewGetBlockBodiesMessage(syncHashes(chain[1:4])), sent[0].msg)
+
+	// a window not received in time is requested again
+	now = now.Add(c.BlockDownloadTimeout + time.Second)
+	bs.Step(n, peers, now)
+	sent = n.takeSent()
+	require.Len(t, sent, 1)
+	require.Equal(t, "a", sent[0].addr)
+	require.Equal(t, 1, bs.stalls["b"])
+	require.Equal(t, 2, bs.Progress(now).Downloads[0].Retries)
+
+	// the headers are dropped after MaxBlockDownloadRetries
+	now = now.Add(c.BlockDownloadTimeout + time.Second)
+	bs.Step(n, peers, now)
+	require.Equal(t, BlockSyncProgress{Downloads: []BlockDownload{}}, bs.Progress(now))
+
+	// a disconnected peer is not waited for
+	_, err = bs.AddHeaders(n, "a", syncHeaders(chain[1:]))
+	require.NoError(t, err)
+	n.takeSent()
+	bs.Step(n, peers, now)
+	require.Len(t, bs.Progress(now).Downloads, 1)
+	bs.RemovePeer(bs.Progress(now).Downloads[0].Address)
+	require.Empty(t, bs.Progress(now).Downloads)
+}
+
+func TestBlockSyncPrune(t *testing.T) {
+	chain := makeSyncChain(6, 0)
+	n := newFakeSyncNode(chain[0])
+	bs := NewBlockSync(testBlockSyncConfig())
+	now := time.Now()
+
+	_, err := bs.AddHeaders(n, "a", syncHeaders(chain[1:]))
+	require.NoError(t, err)
+
+	// the blocks executed meanwhile are dropped
+	require.NoError(t, n.ExecuteSignedBlock(chain[1], nil))
+	require.NoError(t, n.ExecuteSignedBlock(chain[2], nil))
+	bs.Step(n, map[string]uint64{"a": 5}, now)
+	sent := n.takeSent()
+	require.Len(t, sent, 1)
+	require.Equal(t, NewGetBlockBodiesMessage(syncHashes(chain[3:6])), sent[0].msg)
+
+	// the headers are dropped when the head leaves their chain
+	n.chain = makeSyncChain(4, 1)
+	n.certs = make([]*blockdb.QuorumCert, 4)
+	bs.Step(n, map[string]uint64{}, now)
+	require.Equal(t, BlockSyncProgress{Downloads: []BlockDownload{}}, bs.Progress(now))
+}
+
+func syncHashes(blocks []coin.SignedBlock) []cipher.SHA256 {
+	hashes := make([]cipher.SHA256, len(blocks))
+	for i, b := range blocks {
+		hashes[i] = b.HashHeader()
+	}
+	return hashes
+}
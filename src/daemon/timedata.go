@@ -0,0 +1,163 @@
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/samoslab/samos/src/util/utc"
+)
+
+const (
+	// minTimeSamples is the number of peers the local clock is adjusted by at least
+	minTimeSamples = 3
+	// maxTimeSamples is the number of peers the offsets are kept of at most
+	maxTimeSamples = 200
+)
+
+// NetworkTime keeps the offset of the local clock to the median clock of the peers.
+// The peers send their time in the introduction, ping and pong messages. Only the last
+// offset of a peer is kept so a peer does not move the median by sending many messages,
+// and a median beyond the max offset is not followed.
+type NetworkTime struct {
+	maxOffset time.Duration
+	warnDrift time.Duration
+
+	offsets map[string]time.Duration
+	median  time.Duration
+	offset  time.Duration
+	warned  bool
+	mutex   sync.Mutex
+}
+
+// NewNetworkTime creates a NetworkTime which follows the median of the peers up to maxOffset,
+// and warns when the local clock differs from it by more than warnDrift
+func NewNetworkTime(maxOffset, warnDrift time.Duration) *NetworkTime {
+	return &NetworkTime{
+		maxOffset: maxOffset,
+		warnDrift: warnDrift,
+		offsets:   make(map[string]time.Duration),
+	}
+}
+
+// Add records the offset of the clock of the peer to the local clock
+func (nt *NetworkTime) Add(addr string, offset time.Duration) {
+	nt.mutex.Lock()
+	defer nt.mutex.Unlock()
+
+	if _, ok := nt.offsets[addr]; !ok && len(nt.offsets) >= maxTimeSamples {
+		return
+	}
+	nt.offsets[addr] = offset
+	nt.update()
+}
+
+// Remove removes the offset of the peer
+func (nt *NetworkTime) Remove(addr string) {
+	nt.mutex.Lock()
+	defer nt.mutex.Unlock()
+
+	if _, ok := nt.offsets[addr]; !ok {
+		return
+	}
+	delete(nt.offsets, addr)
+	nt.update()
+}
+
+// update recomputes the median and the offset of the local clock, the mutex must be held
+func (nt *NetworkTime) update() {
+	if len(nt.offsets) < minTimeSamples {
+		nt.median = 0
+		nt.offset = 0
+		nt.warned = false
+		return
+	}
+
+	offsets := make([]time.Duration, 0, len(nt.offsets))
+	for _, o := range nt.offsets {
+		offsets = append(offsets, o)
+	}
+	sort.Slice(offsets, func(i, j int) bool {
+		return offsets[i] < offsets[j]
+	})
+
+	n := len(offsets)
+	nt.median = offsets[n/2]
+	if n%2 == 0 {
+		nt.median = (offsets[n/2-1] + offsets[n/2]) / 2
+	}
+
+	if abs(nt.median) <= nt.maxOffset {
+		nt.offset = nt.median
+	} else {
+		nt.offset = 0
+	}
+
+	drifts := abs(nt.median) > nt.warnDrift
+	if drifts && !nt.warned {
+		logger.Warning(nt.warning())
+	}
+	nt.warned = drifts
+}
+
+func (nt *NetworkTime) warning() string {
+	if abs(nt.median) > nt.maxOffset {
+		return fmt.Sprintf("The local clock differs from the median of %d peers by %v, more than %v, it is not adjusted. Check the clock",
+			len(nt.offsets), nt.median, nt.maxOffset)
+	}
+	return fmt.Sprintf("The local clock differs from the median of %d peers by %v. Check the clock",
+		len(nt.offsets), nt.median)
+}
+
+// Offset returns the offset added to the local clock
+func (nt *NetworkTime) Offset() time.Duration {
+	nt.mutex.Lock()
+	defer nt.mutex.Unlock()
+	return nt.offset
+}
+
+// Now returns the adjusted UTC time
+func (nt *NetworkTime) Now() time.Time {
+	return utc.Now().Add(nt.Offset())
+}
+
+// UnixNow returns the adjusted UTC time as unix timestamp
+func (nt *NetworkTime) UnixNow() int64 {
+	return nt.Now().Unix()
+}
+
+// NetworkTimeStatus is the offset of the local clock to the clocks of the peers
+type NetworkTimeStatus struct {
+	// Offset added to the local clock
+	Offset time.Duration
+	// Median of the offsets of the peers to the local clock
+	Median time.Duration
+	// Peers is the number of peers the median is of
+	Peers int
+	// Warning is set when the median is beyond the drift warning threshold
+	Warning string
+}
+
+// Status returns the offset of the local clock to the peers
+func (nt *NetworkTime) Status() NetworkTimeStatus {
+	nt.mutex.Lock()
+	defer nt.mutex.Unlock()
+
+	s := NetworkTimeStatus{
+		Offset: nt.offset,
+		Median: nt.median,
+		Peers:  len(nt.offsets),
+	}
+	if nt.warned {
+		s.Warning = nt.warning()
+	}
+	return s
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
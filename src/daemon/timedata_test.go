@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkTime(t *testing.T) {
+	nt := NewNetworkTime(time.Minute, time.Second*5)
+	require.Equal(t, NetworkTimeStatus{}, nt.Status())
+
+	// the clock is not adjusted by less than minTimeSamples peers
+	nt.Add("1.1.1.1:6677", time.Second*2)
+	nt.Add("2.2.2.2:6677", time.Second*3)
+	require.Equal(t, time.Duration(0), nt.Offset())
+
+	// a peer is counted once
+	nt.Add("2.2.2.2:6677", time.Second*4)
+	require.Equal(t, time.Duration(0), nt.Offset())
+
+	// an outlier does not move the median
+	nt.Add("3.3.3.3:6677", time.Hour)
+	require.Equal(t, time.Second*4, nt.Offset())
+	nt.Add("4.4.4.4:6677", -time.Hour)
+	require.Equal(t, time.Second*3, nt.Offset())
+	require.Empty(t, nt.Status().Warning)
+
+	now := time.Now().UTC().Add(time.Second * 3)
+	require.True(t, nt.Now().Sub(now) < time.Second)
+	require.True(t, nt.UnixNow()-now.Unix() <= 1)
+
+	nt.Remove("4.4.4.4:6677")
+	nt.Remove("5.5.5.5:6677")
+	require.Equal(t, time.Second*4, nt.Offset())
+
+	// the drift is reported
+	nt.Add("1.1.1.1:6677", time.Second*10)
+	require.Equal(t, NetworkTimeStatus{
+		Offset:  time.Second * 10,
+		Median:  time.Second * 10,
+		Peers:   3,
+		Warning: "The local clock differs from the median of 3 peers by 10s. Check the clock",
+	}, nt.Status())
+
+	// the clock is not adjusted beyond the max offset
+	nt.Add("2.2.2.2:6677", time.Minute*2)
+	require.Equal(t, NetworkTimeStatus{
+		Offset:  0,
+		Median:  time.Minute * 2,
+		Peers:   3,
+		Warning: "The local clock differs from the median of 3 peers by 2m0s, more than 1m0s, it is not adjusted. Check the clock",
+	}, nt.Status())
+
+	nt.Remove("3.3.3.3:6677")
+	require.Equal(t, NetworkTimeStatus{Peers: 2}, nt.Status())
+}
+
+func TestNetworkTimeMaxSamples(t *testing.T) {
+	nt := NewNetworkTime(time.Minute, time.Second*5)
+	for i := 0; i < maxTimeSamples; i++ {
+		nt.Add(fmt.Sprintf("10.0.%d.%d:6677", i/256, i%256), time.Second)
+	}
+	require.Equal(t, time.Second, nt.Offset())
+
+	// new peers are ignored, the known peers are updated
+	for i := 0; i < maxTimeSamples; i++ {
+		nt.Add(fmt.Sprintf("10.1.%d.%d:6677", i/256, i%256), -time.Second*30)
+	}
+	require.Equal(t, time.Second, nt.Offset())
+	for i := 0; i < maxTimeSamples/2+1; i++ {
+		nt.Add(fmt.Sprintf("10.0.%d.%d:6677", i/256, i%256), time.Second*2)
+	}
+	require.Equal(t, time.Second*2, nt.Offset())
+	require.Equal(t, maxTimeSamples, nt.Status().Peers)
+}
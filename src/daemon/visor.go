@@ -10,16 +10,15 @@ import (
 
 	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/pbft"
 	"github.com/samoslab/samos/src/daemon/gnet"
 	"github.com/samoslab/samos/src/daemon/strand"
+	"github.com/samoslab/samos/src/signer"
 	"github.com/samoslab/samos/src/util/utc"
 	"github.com/samoslab/samos/src/visor"
+	"github.com/samoslab/samos/src/visor/blockdb"
 )
 
-//TODO
-//- download block headers
-//- request blocks individually across multiple peers
-
 //TODO
 //- use CXO for blocksync
 
@@ -54,6 +53,24 @@ type VisorConfig struct {
 	TrustNodeRequestRate  time.Duration
 	PrepareRequestRate    time.Duration
 	AgreeNumRequestRate   time.Duration
+	// How long a pending block waits to be committed before the validators vote to change the view
+	ViewChangeTimeout time.Duration
+	// How many headers to respond with to a GetHeadersMessage
+	HeadersResponseCount uint64
+	// How many block bodies to request from a peer at once
+	BlockDownloadWindow uint64
+	// How many windows of blocks to download from the peers at once
+	MaxBlockDownloads int
+	// How long to wait for the headers or the bodies requested from a peer
+	BlockDownloadTimeout time.Duration
+	// How many times a window of blocks is requested before the headers are dropped
+	MaxBlockDownloadRetries int
+	// How many validated headers to keep ahead of the head block
+	MaxSyncHeaders int
+	// How often to check the block downloads
+	BlockSyncRate time.Duration
+	// How long a compact block waits for the transactions requested from its sender
+	CompactBlockTimeout time.Duration
 }
 
 // NewVisorConfig creates default visor config
@@ -73,6 +90,16 @@ func NewVisorConfig() VisorConfig {
 		TrustNodeRequestRate:  time.Second * 60,
 		PrepareRequestRate:    time.Second * 2,
 		AgreeNumRequestRate:   time.Second * 60,
+		ViewChangeTimeout:     time.Second * 30,
+
+		HeadersResponseCount:    500,
+		BlockDownloadWindow:     20,
+		MaxBlockDownloads:       8,
+		BlockDownloadTimeout:    time.Second * 20,
+		MaxBlockDownloadRetries: 5,
+		MaxSyncHeaders:          5000,
+		BlockSyncRate:           time.Second,
+		CompactBlockTimeout:     time.Second * 5,
 	}
 }
 
@@ -393,29 +420,42 @@ func (vs *Visor) broadcastBlock(sb coin.SignedBlock, pool *Pool) error {
 		return nil
 	}
 
-	m := NewGiveBlocksMessage([]coin.SignedBlock{sb})
-	return pool.Pool.BroadcastMessage(m)
+	blocks := []coin.SignedBlock{sb}
+	certs, err := vs.v.GetQuorumCerts(blocks)
+	if err != nil {
+		return err
+	}
+	return broadcastBlocks(pool, blocks, certs)
 }
 
-// Sends a signed block to all connections.
-// TODO: deprecate, should only send to clients that request by hash
+// Sends the pre-prepare message of a new pending block to all connections,
+// the peers supporting compact blocks are sent the compact block instead
 func (vs *Visor) broadcastPendingBlock(sb coin.PendingSignedBlock, pool *Pool) error {
 	if vs.Config.DisableNetworking {
 		return nil
 	}
 
-	m := NewGivePendingBlockMessage([]coin.PendingSignedBlock{sb})
-	return pool.Pool.BroadcastMessage(m)
+	return broadcastPrePrepare(pool, vs.v.GetView(), sb.ToSignedBlock(), nil)
 }
 
-// Sends a prepare message to all connections
-func (vs *Visor) broadcastPrepareMsg(sb coin.PendingSignedBlock, pool *Pool) error {
-	if vs.Config.DisableNetworking {
-		return nil
+// broadcastPrePrepare sends the pre-prepare message of the block, or the compact block to the
+// peers supporting it
+func broadcastPrePrepare(pool *Pool, view uint64, b coin.SignedBlock, prepares []cipher.Sig) error {
+	if err := pool.Pool.BroadcastMessage(NewPrePrepareMessage(view, b, prepares)); err != nil {
+		return err
 	}
+	return pool.Pool.BroadcastMessage(NewCompactBlockMessage(view, b, prepares))
+}
 
-	m := NewGivePrepareMessage(sb.HashHeader(), vs.v.Config.BlockchainTrustSeckey)
-	return pool.Pool.BroadcastMessage(m)
+// broadcastBlocks sends the blocks to all connections, the peers supporting the pbft commits are
+// sent the quorum certificates of the blocks before them
+func broadcastBlocks(pool *Pool, blocks []coin.SignedBlock, certs []blockdb.QuorumCert) error {
+	if len(certs) > 0 {
+		if err := pool.Pool.BroadcastMessage(NewGiveQuorumCertsMessage(certs)); err != nil {
+			return err
+		}
+	}
+	return pool.Pool.BroadcastMessage(NewGiveBlocksMessage(blocks))
 }
 
 // BroadcastMessage message to all connections
@@ -427,14 +467,26 @@ func (vs *Visor) BroadcastMessage(pool *Pool) error {
 	if vs.v.IsGenesisNode() {
 		// Locate all txns from the unconfirmed pool
 		trustNodes := vs.TrustNodes()
-		m := NewGiveTrustMessage(trustNodes, vs.v.Config.BlockchainSeckey)
-		if err := pool.Pool.BroadcastMessage(m); err != nil {
-			logger.Errorf("Broadcast GiveTrustMessage failed: %v", err)
-			return err
+		if !vs.v.IsGoverned(coin.TxTypeValidatorSet) {
+			sig, err := vs.v.SignTrustList(trustNodes)
+			if err != nil {
+				logger.Errorf("Sign trust list failed: %v", err)
+				return err
+			}
+			m := NewGiveTrustMessage(trustNodes, sig)
+			if err := pool.Pool.BroadcastMessage(m); err != nil {
+				logger.Errorf("Broadcast GiveTrustMessage failed: %v", err)
+				return err
+			}
 		}
 		num := vs.v.GetAgreeNodeNum()
-		if num > 0 && num <= len(trustNodes) {
-			m := NewGiveAgreeNumMessage(num, vs.v.Config.BlockchainSeckey)
+		if num > 0 && num <= len(trustNodes) && !vs.v.IsGoverned(coin.TxTypeQuorum) {
+			sig, err := vs.v.SignAgreeNum(num)
+			if err != nil {
+				logger.Errorf("Sign agree number failed: %v", err)
+				return err
+			}
+			m := NewGiveAgreeNumMessage(num, sig)
 			return pool.Pool.BroadcastMessage(m)
 		}
 	}
@@ -504,9 +556,9 @@ func (vs *Visor) InTurnTheNode(when int64) (bool, error) {
 	return vs.v.InTurnTheNode(when)
 }
 
-// HasUnconfirmedBlock check is there unconfimed block
-func (vs *Visor) HasUnconfirmedBlock() bool {
-	return len(vs.v.GetPendingHash()) > 0
+// PendingWindowFull returns true if no other block may be pending until a pending block is executed
+func (vs *Visor) PendingWindowFull() bool {
+	return vs.v.PendingWindowFull()
 }
 
 // CreateAndPublishBlock creates a block from unconfirmed transactions and sends it to the network.
@@ -525,11 +577,7 @@ func (vs *Visor) CreateAndPublishBlock(pool *Pool) (coin.PendingSignedBlock, err
 			return err
 		}
 
-		err = vs.broadcastPendingBlock(sb, pool)
-		if err != nil {
-			return err
-		}
-		return vs.broadcastPrepareMsg(sb, pool)
+		return vs.broadcastPendingBlock(sb, pool)
 	})
 
 	return sb, err
@@ -611,10 +659,125 @@ func (vs *Visor) HeadBkSeq() uint64 {
 	return seq
 }
 
-// ExecuteSignedBlock executes signed block
-func (vs *Visor) ExecuteSignedBlock(b coin.SignedBlock) error {
+// GetHeadBlock returns the head block
+func (vs *Visor) GetHeadBlock() (*coin.SignedBlock, error) {
+	var sb *coin.SignedBlock
+	err := vs.strand("GetHeadBlock", func() error {
+		var err error
+		sb, err = vs.v.GetHeadBlock()
+		return err
+	})
+	return sb, err
+}
+
+// VerifyHeader verifies the header is signed by a validator of its height
+func (vs *Visor) VerifyHeader(h coin.BlockHeader, sig cipher.Sig) error {
+	return vs.strand("VerifyHeader", func() error {
+		return vs.v.VerifyHeader(h, sig)
+	})
+}
+
+// GetSignedHeadersSince returns the signed headers in an inclusive range of [seq+1, seq+ct]
+func (vs *Visor) GetSignedHeadersSince(seq, ct uint64) ([]SignedHeader, error) {
+	var headers []SignedHeader
+	err := vs.strand("GetSignedHeadersSince", func() error {
+		sbs, err := vs.v.GetSignedBlocksSince(seq, ct)
+		if err != nil {
+			return err
+		}
+		headers = make([]SignedHeader, len(sbs))
+		for i, sb := range sbs {
+			headers[i] = SignedHeader{
+				Header: sb.Head,
+				Sig:    sb.Sig,
+			}
+		}
+		return nil
+	})
+	return headers, err
+}
+
+// GetBlockBodies returns the bodies of the blocks up to the first unknown one,
+// with the quorum certificates of the blocks which have one
+func (vs *Visor) GetBlockBodies(hashes []cipher.SHA256) ([]coin.BlockBody, []blockdb.QuorumCert, error) {
+	var bodies []coin.BlockBody
+	var certs []blockdb.QuorumCert
+	err := vs.strand("GetBlockBodies", func() error {
+		blocks := make([]coin.SignedBlock, 0, len(hashes))
+		for _, hash := range hashes {
+			sb, err := vs.v.GetBlockByHash(hash)
+			if err != nil {
+				return err
+			}
+			if sb == nil {
+				break
+			}
+			blocks = append(blocks, *sb)
+		}
+
+		var err error
+		certs, err = vs.v.GetQuorumCerts(blocks)
+		if err != nil {
+			return err
+		}
+		bodies = make([]coin.BlockBody, len(blocks))
+		for i, sb := range blocks {
+			bodies[i] = sb.Body
+		}
+		return nil
+	})
+	return bodies, certs, err
+}
+
+// GetKnownTxns returns the transactions of the unconfirmed pool and of the pending blocks
+func (vs *Visor) GetKnownTxns() (coin.Transactions, error) {
+	var txns coin.Transactions
+	err := vs.strand("GetKnownTxns", func() error {
+		txns = vs.v.Unconfirmed.RawTxns()
+		for _, hash := range vs.v.GetPendingHash() {
+			sb, err := vs.v.GetPendingBlock(hash)
+			if err != nil {
+				continue
+			}
+			txns = append(txns, sb.Body.Transactions...)
+		}
+		return nil
+	})
+	return txns, err
+}
+
+// GetBlockTxns returns the transactions of the pending or executed block at the indexes
+func (vs *Visor) GetBlockTxns(hash cipher.SHA256, indexes []uint64) (coin.Transactions, error) {
+	var txns coin.Transactions
+	err := vs.strand("GetBlockTxns", func() error {
+		sb, err := vs.v.GetPendingBlock(hash)
+		if err != nil {
+			b, err := vs.v.GetBlockByHash(hash)
+			if err != nil {
+				return err
+			}
+			if b == nil {
+				return fmt.Errorf("block %s not found", hash.Hex())
+			}
+			sb = *b
+		}
+
+		txns = make(coin.Transactions, len(indexes))
+		for i, idx := range indexes {
+			if idx >= uint64(len(sb.Body.Transactions)) {
+				return fmt.Errorf("block %d has no transaction %d", sb.Seq(), idx)
+			}
+			txns[i] = sb.Body.Transactions[idx]
+		}
+		return nil
+	})
+	return txns, err
+}
+
+// ExecuteSignedBlock executes signed block with its quorum certificate, qc is nil if it has none
+func (vs *Visor) ExecuteSignedBlock(b coin.SignedBlock, qc *blockdb.QuorumCert) error {
 	return vs.strand("ExecuteSignedBlock", func() error {
-		return vs.v.ExecuteSignedBlock(b)
+		return vs.v.ExecuteSignedBlock(b, qc)
 	})
 }
 
@@ -641,6 +804,17 @@ func (vs *Visor) GetSignedBlocksSince(seq uint64, ct uint64) ([]coin.SignedBlock
 	return sbs, err
 }
 
+// GetQuorumCerts returns the quorum certificates of the blocks which have one
+func (vs *Visor) GetQuorumCerts(blocks []coin.SignedBlock) ([]blockdb.QuorumCert, error) {
+	var certs []blockdb.QuorumCert
+	err := vs.strand("GetQuorumCerts", func() error {
+		var err error
+		certs, err = vs.v.GetQuorumCerts(blocks)
+		return err
+	})
+	return certs, err
+}
+
 // UnConfirmFilterKnown returns all unknown transaction hashes
 func (vs *Visor) UnConfirmFilterKnown(txns []cipher.SHA256) []cipher.SHA256 {
 	var ts []cipher.SHA256
@@ -671,25 +845,11 @@ func (vs *Visor) AddPendingBlock(block coin.SignedBlock) error {
 	return vs.v.AddPendingBlock(block)
 }
 
+// CanMakeBlock votes to commit the pending block once the quorum prepared it and executes
+// it once the quorum committed it, visor.ErrNotCommitted is returned until then and
+// visor.ErrParentPending while the block it extends is pending
 func CanMakeBlock(dm *Daemon, hash cipher.SHA256) error {
-	creatorNum := len(dm.Visor.V.TrustNodes())
-	currentNum, err := dm.Visor.V.GetValidatorNumber(hash)
-	if err != nil {
-		logger.Errorf("Get Validator Number failed: %v", err)
-		return err
-	}
-	agreeNum := dm.Visor.V.GetAgreeNodeNum()
-	if agreeNum <= 0 || agreeNum > creatorNum {
-		agreeNum = creatorNum
-	}
-	if currentNum >= agreeNum {
-		err := dm.Visor.V.StartExecuteSignedBlock(hash)
-		if err != nil {
-			logger.Errorf("Start Execute Block %s failed: %v", hash, err)
-			return err
-		}
-	}
-	return nil
+	return dm.consensus.commit(hash)
 }
 
 // Communication layer for the coin pkg
@@ -739,6 +899,18 @@ func (gbm *GetBlocksMessage) Process(d *Daemon) {
 
 	logger.Debugf("Got %d blocks since %d", len(blocks), gbm.LastBlock)
 
+	certs, err := d.Visor.GetQuorumCerts(blocks)
+	if err != nil {
+		logger.Errorf("Get quorum certificates failed: %v", err)
+		return
+	}
+
+	if len(certs) > 0 {
+		if err := d.Pool.Pool.SendMessage(gbm.c.Addr, NewGiveQuorumCertsMessage(certs)); err != nil {
+			logger.Errorf("Send GiveQuorumCertsMessage to %s failed: %v", gbm.c.Addr, err)
+		}
+	}
+
 	m := NewGiveBlocksMessage(blocks)
 	if err := d.Pool.Pool.SendMessage(gbm.c.Addr, m); err != nil {
 		logger.Errorf("Send GiveBlocksMessage to %s failed: %v", gbm.c.Addr, err)
@@ -765,6 +937,19 @@ func (gbm *GiveBlocksMessage) Handle(mc *gnet.MessageContext,
 	return daemon.(*Daemon).recordMessageEvent(gbm, mc)
 }
 
+// blockOffense returns the offense of the sender of the block following the head which failed
+// to execute. Only the faults the sender could have checked are scored, a block failing on
+// the state of this node does not prove the sender wrong.
+func (dm *Daemon) blockOffense(b coin.SignedBlock) (offense, bool) {
+	if err := dm.Visor.VerifyHeader(b.Block.Head, b.Sig); err != nil {
+		return offenseInvalidSignature, true
+	}
+	if b.Block.Body.Hash() != b.Block.Head.BodyHash {
+		return offenseInvalidBlock, true
+	}
+	return offense{}, false
+}
+
 // Process process message
 func (gbm *GiveBlocksMessage) Process(d *Daemon) {
 	if d.Visor.Config.DisableNetworking {
@@ -772,6 +957,13 @@ func (gbm *GiveBlocksMessage) Process(d *Daemon) {
 		return
 	}
 
+	// The quorum certificates of the blocks are sent before them
+	received := d.connectionQuorumCerts.Take(gbm.c.Addr)
+	certs := make(map[cipher.SHA256]*blockdb.QuorumCert, len(received))
+	for i := range received {
+		certs[received[i].Hash] = &received[i]
+	}
+
 	processed := 0
 	maxSeq := d.Visor.HeadBkSeq()
 	for _, b := range gbm.Blocks {
@@ -785,12 +977,18 @@ func (gbm *GiveBlocksMessage) Process(d *Daemon) {
 			continue
 		}
 
-		err := d.Visor.ExecuteSignedBlock(b)
+		err := d.Visor.ExecuteSignedBlock(b, certs[b.HashHeader()])
 		if err == nil {
 			logger.Critical().Infof("Added new block %d", b.Block.Head.BkSeq)
 			processed++
 		} else {
 			logger.Critical().Errorf("Failed to execute received block %d: %v", b.Block.Head.BkSeq, err)
+			// the block following the head is verified against the known validators
+			if b.Seq() == d.Visor.HeadBkSeq()+1 {
+				if o, ok := d.blockOffense(b); ok {
+					d.misbehave(gbm.c.Addr, o)
+				}
+			}
 			// Blocks must be received in order, so if one fails its assumed
 			// the rest are failing
 			break
@@ -805,8 +1003,36 @@ func (gbm *GiveBlocksMessage) Process(d *Daemon) {
 	m1 := NewAnnounceBlocksMessage(headBkSeq)
 	d.Pool.Pool.BroadcastMessage(m1)
 	//request more blocks.
-	m2 := NewGetBlocksMessage(headBkSeq, d.Visor.Config.BlocksResponseCount)
-	d.Pool.Pool.BroadcastMessage(m2)
+	d.requestBlocks()
+}
+
+// GiveQuorumCertsMessage is sent before a GiveBlocksMessage to the peers supporting the pbft
+// commits, Certs are the quorum certificates of the blocks of the GiveBlocksMessage which have one
+type GiveQuorumCertsMessage struct {
+	Certs []blockdb.QuorumCert
+	c     *gnet.MessageContext `enc:"-"`
+}
+
+// NewGiveQuorumCertsMessage creates GiveQuorumCertsMessage
+func NewGiveQuorumCertsMessage(certs []blockdb.QuorumCert) *GiveQuorumCertsMessage {
+	return &GiveQuorumCertsMessage{
+		Certs: certs,
+	}
+}
+
+// Handle handle message
+func (gqm *GiveQuorumCertsMessage) Handle(mc *gnet.MessageContext,
+	daemon interface{}) error {
+	gqm.c = mc
+	return daemon.(*Daemon).recordMessageEvent(gqm, mc)
+}
+
+// Process records the quorum certificates for the following GiveBlocksMessage of the peer
+func (gqm *GiveQuorumCertsMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking {
+		return
+	}
+	d.connectionQuorumCerts.Add(gqm.c.Addr, gqm.Certs)
 }
 
 // AnnounceBlocksMessage tells a peer our highest known BkSeq. The receiving peer can choose
@@ -841,6 +1067,13 @@ func (abm *AnnounceBlocksMessage) Process(d *Daemon) {
 		return
 	}
 
+	// The block sync requests the blocks from the peers syncing headers first
+	if d.peerSupports(abm.c.Addr, CapHeadersSync) {
+		d.Visor.RecordBlockchainHeight(abm.c.Addr, abm.MaxBkSeq)
+		d.stepBlockSync()
+		return
+	}
+
 	// TODO: Should this be block get request for current sequence?
 	// If client is not caught up, won't attempt to get block
 	m := NewGetBlocksMessage(headBkSeq, d.Visor.Config.BlocksResponseCount)
@@ -972,6 +1205,10 @@ func (gtm *GiveTxnsMessage) Process(d *Daemon) {
 		known, softErr, err := d.Visor.InjectTransaction(txn)
 		if err != nil {
 			logger.Warningf("Failed to record transaction %s: %v", txn.Hash().Hex(), err)
+			// a transaction spending confirmed outputs may be relayed before the block
+			if txn.Verify() != nil {
+				d.misbehave(gtm.c.Addr, offenseInvalidTxn)
+			}
 			continue
 		} else if softErr != nil {
 			logger.Warningf("Transaction soft violation: %v", err)
@@ -1014,11 +1251,16 @@ func (gtm *GetTrustMessage) Process(d *Daemon) {
 		return
 	}
 
-	// Reply to sender with GiveTrustMessage
-	if d.Visor.v.IsGenesisNode() {
+	// Reply to sender with GiveTrustMessage, a governed trust list comes with the blocks
+	if d.Visor.v.IsGenesisNode() && !d.Visor.v.IsGoverned(coin.TxTypeValidatorSet) {
 		// Locate all txns from the unconfirmed pool
 		trustNodes := d.Visor.TrustNodes()
-		m := NewGiveTrustMessage(trustNodes, d.Visor.v.Config.BlockchainSeckey)
+		sig, err := d.Visor.v.SignTrustList(trustNodes)
+		if err != nil {
+			logger.Errorf("Sign trust list failed: %v", err)
+			return
+		}
+		m := NewGiveTrustMessage(trustNodes, sig)
 		if err := d.Pool.Pool.SendMessage(gtm.c.Addr, m); err != nil {
 			logger.Errorf("Send GiveTrustMessage to %s failed: %v", gtm.c.Addr, err)
 		}
@@ -1033,17 +1275,11 @@ type GiveTrustMessage struct {
 }
 
 func pubkeysArrHash(pubkeys []cipher.PubKey) cipher.SHA256 {
-	trustKey := []byte{}
-	for _, pk := range pubkeys {
-		trustKey = append(trustKey, pk[:]...)
-	}
-	return cipher.SumSHA256(trustKey)
+	return signer.TrustListHash(pubkeys)
 }
 
-// NewGiveTrustMessage creates GiveTrustMessage
-func NewGiveTrustMessage(trust []cipher.PubKey, secKey cipher.SecKey) *GiveTrustMessage {
-	trustHash := pubkeysArrHash(trust)
-	sig := cipher.SignHash(trustHash, secKey)
+// NewGiveTrustMessage creates GiveTrustMessage of the trust list signed by the master key
+func NewGiveTrustMessage(trust []cipher.PubKey, sig cipher.Sig) *GiveTrustMessage {
 	return &GiveTrustMessage{
 		Trust: trust,
 		Sig:   sig,
@@ -1145,11 +1381,10 @@ func (gpm *GetPrepareMessage) Process(d *Daemon) {
 		return
 	}
 
-	// Reply to sender with GivePrepareMessage
+	// Reply to sender with the GivePrepareMessage of the vote of this node
 	if d.Visor.v.Config.IsMaster {
-		// todo: should check hash exists or not
-		if d.Visor.v.CheckHashExists(gpm.Hash) || d.Visor.v.CheckHashExistsInChain(gpm.Hash) {
-			m := NewGivePrepareMessage(gpm.Hash, d.Visor.v.Config.BlockchainTrustSeckey)
+		if sig, ok := d.Visor.v.PrepareSig(gpm.Hash); ok {
+			m := NewGivePrepareMessage(gpm.Hash, sig)
 			if err := d.Pool.Pool.SendMessage(gpm.c.Addr, m); err != nil {
 				logger.Errorf("Send GivePrepareMessage to %s failed: %v", gpm.c.Addr, err)
 			}
@@ -1164,9 +1399,8 @@ type GivePrepareMessage struct {
 	c    *gnet.MessageContext `enc:"-"`
 }
 
-// NewGivePrepareMessage creates GivePrepareMessage
-func NewGivePrepareMessage(hash cipher.SHA256, secKey cipher.SecKey) *GivePrepareMessage {
-	sig := cipher.SignHash(hash, secKey)
+// NewGivePrepareMessage creates GivePrepareMessage of the prepare vote for the pending block
+func NewGivePrepareMessage(hash cipher.SHA256, sig cipher.Sig) *GivePrepareMessage {
 	return &GivePrepareMessage{
 		Hash: hash,
 		Sig:  sig,
@@ -1186,46 +1420,14 @@ func (gpm *GivePrepareMessage) Process(d *Daemon) {
 		return
 	}
 
-	// verify signature
-	pubkeyRec, err := cipher.PubKeyFromSig(gpm.Sig, gpm.Hash) //recovered pubkey
-	if err != nil {
-		logger.Errorf("Invalid sig: PubKey recovery failed: %v", err)
-		return
-	}
-	if d.Visor.v.IsTrustPubkey(pubkeyRec) {
-		pubkeys, err := d.Visor.v.GetBlockValidators(gpm.Hash)
-		if err != nil {
-			logger.Errorf("Get block %s validator failed, waiting pending block added", gpm.Hash.Hex())
-			return
-		}
-		err = d.Visor.v.AddValidator(gpm.Hash, pubkeyRec)
-		if err != nil {
-			logger.Errorf("AddValidator %s for hash failed: %v", pubkeyRec.Hex(), err)
-		}
-		for _, v := range pubkeys {
-			logger.Debugf("pubkey %s", v.Hex())
-		}
-		err = CanMakeBlock(d, gpm.Hash)
-		if err != nil {
-			return
-		}
-
-		sb, err := d.Visor.v.GetBlockByHash(gpm.Hash)
-		if err != nil {
-			logger.Errorf("get block by hash %s failed", gpm.Hash.Hex())
-			return
-		}
-		err = d.Visor.broadcastBlock(*sb, d.Pool)
-		if err != nil {
-			logger.Errorf("broadcast block %s failed", sb.HashHeader())
-			return
-		}
-	}
+	d.consensus.ProcessPrepare(gpm.Hash, gpm.Sig)
 
+	// announce the vote of this node, the peers missing it request it
 	if d.Visor.v.Config.IsMaster {
-		// todo handle prepare msg
-		m := NewAnnouncePrepareMessage(gpm.Hash, d.Visor.v.Config.BlockchainTrustSeckey)
-		d.Pool.Pool.BroadcastMessage(m)
+		if sig, ok := d.Visor.v.PrepareSig(gpm.Hash); ok {
+			m := NewAnnouncePrepareMessage(gpm.Hash, sig)
+			d.Pool.Pool.BroadcastMessage(m)
+		}
 	}
 }
 
@@ -1236,9 +1438,8 @@ type AnnouncePrepareMessage struct {
 	c    *gnet.MessageContext `enc:"-"`
 }
 
-// NewAnnouncePrepareMessage creates announce trust message
-func NewAnnouncePrepareMessage(hash cipher.SHA256, secKey cipher.SecKey) *AnnouncePrepareMessage {
-	sig := cipher.SignHash(hash, secKey)
+// NewAnnouncePrepareMessage creates announce prepare message of the prepare vote for the pending block
+func NewAnnouncePrepareMessage(hash cipher.SHA256, sig cipher.Sig) *AnnouncePrepareMessage {
 	return &AnnouncePrepareMessage{
 		Hash: hash,
 		Sig:  sig,
@@ -1257,7 +1458,7 @@ func (apm *AnnouncePrepareMessage) Process(d *Daemon) {
 	if d.Visor.Config.DisableNetworking {
 		return
 	}
-	pubkeyRec, err := cipher.PubKeyFromSig(apm.Sig, apm.Hash) //recovered pubkey
+	pubkeyRec, err := cipher.PubKeyFromSig(apm.Sig, pbft.PrepareHash(apm.Hash)) //recovered pubkey
 	if err != nil {
 		logger.Errorf("Invalid sig: PubKey recovery failed: %v", err)
 		return
@@ -1287,6 +1488,13 @@ func (vs *Visor) RequestPrepare(pool *Pool) error {
 			if err != nil {
 				return err
 			}
+
+			// commit votes are not requested, they are sent again until the block is executed
+			if sig, ok := vs.v.CommitSig(hash); ok {
+				if err := pool.Pool.BroadcastMessage(NewCommitMessage(hash, sig)); err != nil {
+					return err
+				}
+			}
 		}
 		return nil
 	})
@@ -1338,11 +1546,16 @@ func (gtm *GetAgreeNumMessage) Process(d *Daemon) {
 		return
 	}
 
-	// Reply to sender with GiveAgreeNumMessage
-	if d.Visor.v.IsGenesisNode() {
+	// Reply to sender with GiveAgreeNumMessage, a governed quorum comes with the blocks
+	if d.Visor.v.IsGenesisNode() && !d.Visor.v.IsGoverned(coin.TxTypeQuorum) {
 		// Locate all txns from the unconfirmed pool
 		agreeNumNodes := d.Visor.v.GetAgreeNodeNum()
-		m := NewGiveAgreeNumMessage(agreeNumNodes, d.Visor.v.Config.BlockchainSeckey)
+		sig, err := d.Visor.v.SignAgreeNum(agreeNumNodes)
+		if err != nil {
+			logger.Errorf("Sign agree number failed: %v", err)
+			return
+		}
+		m := NewGiveAgreeNumMessage(agreeNumNodes, sig)
 		if err := d.Pool.Pool.SendMessage(gtm.c.Addr, m); err != nil {
 			logger.Errorf("Send GiveAgreeNumMessage to %s failed: %v", gtm.c.Addr, err)
 		}
@@ -1357,12 +1570,11 @@ type GiveAgreeNumMessage struct {
 }
 
 func intHash(num int) cipher.SHA256 {
-	return cipher.SumSHA256([]byte(strconv.Itoa(num)))
+	return signer.AgreeNumHash(num)
 }
 
-// NewGiveAgreeNumMessage creates GiveAgreeNumMessage
-func NewGiveAgreeNumMessage(agreeNum int, secKey cipher.SecKey) *GiveAgreeNumMessage {
-	sig := cipher.SignHash(intHash(agreeNum), secKey)
+// NewGiveAgreeNumMessage creates GiveAgreeNumMessage of the agree number signed by the master key
+func NewGiveAgreeNumMessage(agreeNum int, sig cipher.Sig) *GiveAgreeNumMessage {
 	return &GiveAgreeNumMessage{
 		AgreeNum: strconv.Itoa(agreeNum),
 		Sig:      sig,
@@ -1430,29 +1642,185 @@ func (gbm *GivePendingBlockMessage) Process(d *Daemon) {
 		return
 	}
 
-	maxSeq := d.Visor.HeadBkSeq()
 	for _, b := range gbm.PendingBlock {
-		if b.Seq() <= maxSeq {
+		if !b.Pending {
+			d.consensus.DetectEquivocation(b.ToSignedBlock())
 			continue
 		}
 
-		if b.Pending {
-			err := d.Visor.AddPendingBlock(b.ToSignedBlock())
-			if err == nil {
-				logger.Critical().Infof("Added pending block %d", b.Block.Head.BkSeq)
-				if d.Visor.v.Config.IsMaster {
-					err := d.Visor.v.AddValidator(b.HashHeader(), d.Visor.v.Config.BlockchainTrustPubkey)
-					if err != nil {
-						logger.Critical().Infof("AddValidator failed %v", err)
-					}
-					m := NewGivePrepareMessage(b.HashHeader(), d.Visor.v.Config.BlockchainTrustSeckey)
-					d.Pool.Pool.BroadcastMessage(m)
-				}
-			} else {
-				logger.Critical().Errorf("Failed to add pending block %d: %v", b.Block.Head.BkSeq, err)
-				break
-			}
+		if err := d.consensus.AcceptPendingBlock(b.ToSignedBlock(), nil); err != nil {
+			logger.Critical().Errorf("Failed to add pending block %d: %v", b.Block.Head.BkSeq, err)
+			break
+		}
+	}
+
+}
+
+// GiveEvidenceMessage sends the evidence of validators which signed conflicting blocks
+type GiveEvidenceMessage struct {
+	Evidences []blockdb.Evidence
+	c         *gnet.MessageContext `enc:"-"`
+}
+
+// NewGiveEvidenceMessage creates GiveEvidenceMessage
+func NewGiveEvidenceMessage(evidences []blockdb.Evidence) *GiveEvidenceMessage {
+	return &GiveEvidenceMessage{
+		Evidences: evidences,
+	}
+}
+
+// Handle handle message
+func (gem *GiveEvidenceMessage) Handle(mc *gnet.MessageContext,
+	daemon interface{}) error {
+	gem.c = mc
+	return daemon.(*Daemon).recordMessageEvent(gem, mc)
+}
+
+// Process stores the new evidence and relays it to the other peers
+func (gem *GiveEvidenceMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking {
+		return
+	}
+
+	relay := []blockdb.Evidence{}
+	for _, e := range gem.Evidences {
+		added, err := d.Visor.v.AddEvidence(e)
+		if err != nil {
+			logger.Errorf("Invalid evidence against %s from %s: %v", e.PubKey.Hex(), gem.c.Addr, err)
+			d.misbehave(gem.c.Addr, offenseInvalidEvidence)
+			continue
 		}
+		if added {
+			relay = append(relay, e)
+		}
+	}
+
+	if len(relay) == 0 {
+		return
 	}
 
+	m := NewGiveEvidenceMessage(relay)
+	d.Pool.Pool.BroadcastMessage(m)
+}
+
+// PrePrepareMessage proposes a pending block in a view. A block prepared in an earlier view
+// is proposed again with the prepare votes it collected, by any validator which kept it.
+type PrePrepareMessage struct {
+	View     uint64
+	Block    coin.SignedBlock
+	Prepares []cipher.Sig
+	c        *gnet.MessageContext `enc:"-"`
+}
+
+// NewPrePrepareMessage creates PrePrepareMessage
+func NewPrePrepareMessage(view uint64, b coin.SignedBlock, prepares []cipher.Sig) *PrePrepareMessage {
+	return &PrePrepareMessage{
+		View:     view,
+		Block:    b,
+		Prepares: prepares,
+	}
+}
+
+// Handle handle message
+func (ppm *PrePrepareMessage) Handle(mc *gnet.MessageContext,
+	daemon interface{}) error {
+	ppm.c = mc
+	return daemon.(*Daemon).recordMessageEvent(ppm, mc)
+}
+
+// Process adds the pending block and votes to prepare it
+func (ppm *PrePrepareMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking || !d.Visor.v.Config.IsMaster {
+		return
+	}
+
+	if err := d.consensus.ProcessPrePrepare(ppm.c.Addr, ppm.View, ppm.Block, ppm.Prepares); err != nil {
+		logger.Errorf("Failed to add pending block %d: %v", ppm.Block.Seq(), err)
+	}
+}
+
+// CommitMessage votes to commit a pending block, sent once the block is prepared
+type CommitMessage struct {
+	Hash cipher.SHA256
+	Sig  cipher.Sig
+	c    *gnet.MessageContext `enc:"-"`
+}
+
+// NewCommitMessage creates CommitMessage, sig signs pbft.CommitHash(hash)
+func NewCommitMessage(hash cipher.SHA256, sig cipher.Sig) *CommitMessage {
+	return &CommitMessage{
+		Hash: hash,
+		Sig:  sig,
+	}
+}
+
+// Handle handle message
+func (cm *CommitMessage) Handle(mc *gnet.MessageContext,
+	daemon interface{}) error {
+	cm.c = mc
+	return daemon.(*Daemon).recordMessageEvent(cm, mc)
+}
+
+// Process adds the commit vote and executes the block once the quorum committed it
+func (cm *CommitMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking {
+		return
+	}
+
+	d.consensus.ProcessCommit(cm.Hash, cm.Sig)
+}
+
+// ViewChangeMessage votes to move to the next view of a block height,
+// sent when the pending block of the current view was not committed in time
+type ViewChangeMessage struct {
+	Seq  uint64
+	View uint64
+	Sig  cipher.Sig
+	c    *gnet.MessageContext `enc:"-"`
+}
+
+// NewViewChangeMessage creates ViewChangeMessage, sig signs pbft.ViewChangeHash(seq, view)
+func NewViewChangeMessage(seq, view uint64, sig cipher.Sig) *ViewChangeMessage {
+	return &ViewChangeMessage{
+		Seq:  seq,
+		View: view,
+		Sig:  sig,
+	}
+}
+
+// Handle handle message
+func (vcm *ViewChangeMessage) Handle(mc *gnet.MessageContext,
+	daemon interface{}) error {
+	vcm.c = mc
+	return daemon.(*Daemon).recordMessageEvent(vcm, mc)
+}
+
+// Process adds the view change vote, joins the view change once f+1 validators voted for it
+// and proposes the prepared blocks again once the view started
+func (vcm *ViewChangeMessage) Process(d *Daemon) {
+	if d.Visor.Config.DisableNetworking || !d.Visor.v.Config.IsMaster {
+		return
+	}
+
+	if err := d.consensus.ProcessViewChange(vcm.Seq, vcm.View, vcm.Sig); err != nil {
+		logger.Debugf("View change to %d of block %d from %s: %v", vcm.View, vcm.Seq, vcm.c.Addr, err)
+	}
+}
+
+// RequestViewChange votes to move to the next view if the pending block
+// of the current view was not committed in time
+func (vs *Visor) RequestViewChange(pool *Pool) error {
+	if vs.Config.DisableNetworking || !vs.v.Config.IsMaster {
+		return nil
+	}
+
+	err := vs.strand("RequestViewChange", func() error {
+		return NewConsensus(vs.v, poolNetwork{pool: pool}).RequestViewChange(vs.Config.ViewChangeTimeout)
+	})
+
+	if err != nil {
+		logger.Debugf("Broadcast ViewChangeMessage failed: %v", err)
+	}
+
+	return err
 }
@@ -84,6 +84,13 @@ func getBlock(gate Gatewayer) http.HandlerFunc {
 			return
 		}
 
+		rb.QuorumCert, err = gate.GetQuorumCert(b.HashHeader())
+		if err != nil {
+			logger.WithError(err).Error("gateway.GetQuorumCert failed")
+			wh.Error500(w)
+			return
+		}
+
 		wh.SendJSONOr500(logger, w, rb)
 	}
 }
@@ -11,6 +11,7 @@ import (
 
 	"math"
 
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
 	"errors"
@@ -59,6 +60,8 @@ func TestGetBlock(t *testing.T) {
 		gatewayGetBlockByHashExists bool
 		gatewayGetBlockBySeqResult  coin.SignedBlock
 		gatewayGetBlockBySeqExists  bool
+		gatewayGetQuorumCertResult  *visor.ReadableQuorumCert
+		gatewayGetQuorumCertErr     error
 		response                    *visor.ReadableBlock
 	}{
 		{
@@ -181,6 +184,46 @@ func TestGetBlock(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:   "500 - GetQuorumCert error",
+			method: http.MethodGet,
+			status: http.StatusInternalServerError,
+			err:    "500 Internal Server Error",
+			seqStr: "1",
+			seq:    1,
+			gatewayGetBlockBySeqExists: true,
+			gatewayGetQuorumCertErr:    errors.New("GetQuorumCert failed"),
+		},
+		{
+			name:   "200 - got block by seq with quorum certificate",
+			method: http.MethodGet,
+			status: http.StatusOK,
+			seqStr: "1",
+			seq:    1,
+			gatewayGetBlockBySeqExists: true,
+			gatewayGetQuorumCertResult: &visor.ReadableQuorumCert{
+				Signers:    []string{"pubkey"},
+				Signatures: []string{"sig"},
+			},
+			response: &visor.ReadableBlock{
+				Head: visor.ReadableBlockHeader{
+					BkSeq:             0x0,
+					BlockHash:         "7b8ec8dd836b564f0c85ad088fc744de820345204e154bc1503e04e9d6fdd9f1",
+					PreviousBlockHash: "0000000000000000000000000000000000000000000000000000000000000000",
+					Time:              0x0,
+					Fee:               0x0,
+					Version:           0x0,
+					BodyHash:          "0000000000000000000000000000000000000000000000000000000000000000",
+				},
+				Body: visor.ReadableBlockBody{
+					Transactions: []visor.ReadableTransaction{},
+				},
+				QuorumCert: &visor.ReadableQuorumCert{
+					Signers:    []string{"pubkey"},
+					Signatures: []string{"sig"},
+				},
+			},
+		},
 	}
 
 	for _, tc := range tt {
@@ -189,6 +232,7 @@ func TestGetBlock(t *testing.T) {
 
 			gateway.On("GetBlockByHash", tc.sha256).Return(tc.gatewayGetBlockByHashResult, tc.gatewayGetBlockByHashExists)
 			gateway.On("GetBlockBySeq", tc.seq).Return(tc.gatewayGetBlockBySeqResult, tc.gatewayGetBlockBySeqExists)
+			gateway.On("GetQuorumCert", mock.Anything).Return(tc.gatewayGetQuorumCertResult, tc.gatewayGetQuorumCertErr)
 
 			endpoint := "/block"
 
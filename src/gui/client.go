@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/samoslab/samos/src/daemon"
+	"github.com/samoslab/samos/src/daemon/pex"
 	"github.com/samoslab/samos/src/visor"
 	"github.com/samoslab/samos/src/visor/historydb"
 	"github.com/samoslab/samos/src/wallet"
@@ -635,6 +636,50 @@ func (c *Client) NetworkExchangeableConnections() ([]string, error) {
 	return dc, nil
 }
 
+// NetworkStats makes a request to /network/stats
+func (c *Client) NetworkStats() (*daemon.NetworkStats, error) {
+	var stats daemon.NetworkStats
+	if err := c.Get("/network/stats", &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// NetworkBans makes a request to /network/bans
+func (c *Client) NetworkBans() ([]pex.Ban, error) {
+	var bans []pex.Ban
+	if err := c.Get("/network/bans", &bans); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// BanPeer makes a request to /network/bans/add, the default ban duration of the node is used
+// if the duration is 0
+func (c *Client) BanPeer(ip string, d time.Duration, reason string) (*pex.Ban, error) {
+	v := url.Values{}
+	v.Add("ip", ip)
+	if d != 0 {
+		v.Add("duration", d.String())
+	}
+	if reason != "" {
+		v.Add("reason", reason)
+	}
+
+	var ban pex.Ban
+	if err := c.PostForm("/network/bans/add", strings.NewReader(v.Encode()), &ban); err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+// UnbanPeer makes a request to /network/bans/remove
+func (c *Client) UnbanPeer(ip string) error {
+	v := url.Values{}
+	v.Add("ip", ip)
+	return c.PostForm("/network/bans/remove", strings.NewReader(v.Encode()), nil)
+}
+
 // PendingTransactions makes a request to /pendingTxs
 func (c *Client) PendingTransactions() ([]*visor.ReadableUnconfirmedTxn, error) {
 	var v []*visor.ReadableUnconfirmedTxn
@@ -801,6 +846,66 @@ func (c *Client) Health() (*HealthResponse, error) {
 	return &r, nil
 }
 
+// ValidatorVotes makes a request to /validators/votes
+func (c *Client) ValidatorVotes() (*visor.ReadableValidatorElection, error) {
+	var r visor.ReadableValidatorElection
+	if err := c.Get("/validators/votes", &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// ValidatorStats makes a request to /validators/stats
+func (c *Client) ValidatorStats() (*visor.ReadableValidatorStats, error) {
+	var r visor.ReadableValidatorStats
+	if err := c.Get("/validators/stats", &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// ValidatorEvidence makes a request to /validators/evidence
+func (c *Client) ValidatorEvidence() ([]visor.ReadableEvidence, error) {
+	var r []visor.ReadableEvidence
+	if err := c.Get("/validators/evidence", &r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// ValidatorJail makes a request to /validators/jail
+func (c *Client) ValidatorJail() ([]visor.ReadableJailRecord, error) {
+	var r []visor.ReadableJailRecord
+	if err := c.Get("/validators/jail", &r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// ValidatorGovernance makes a request to /validators/governance
+func (c *Client) ValidatorGovernance() (*visor.ReadableGovernance, error) {
+	var r visor.ReadableGovernance
+	if err := c.Get("/validators/governance", &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// ValidatorKeyRotations makes a request to /validators/rotations
+func (c *Client) ValidatorKeyRotations() ([]visor.ReadableKeyRotation, error) {
+	var r []visor.ReadableKeyRotation
+	if err := c.Get("/validators/rotations", &r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
 // EncryptWallet encrypts specific wallet with given password
 func (c *Client) EncryptWallet(id string, password string) (*WalletResponse, error) {
 	v := url.Values{}
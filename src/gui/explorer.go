@@ -56,17 +56,19 @@ func coinSupply(gateway Gatewayer, w http.ResponseWriter, r *http.Request) *Coin
 	// used to filter unspents
 	unlockedAddrMap := daemon.MakeSearchMap(unlockedAddrs)
 
-	var unlockedSupply uint64
+	var unlockedSupply, allSupply uint64
 	// check confirmed unspents only
 	for _, u := range allUnspents.HeadOutputs {
+		coins, err := droplet.FromString(u.Coins)
+		if err != nil {
+			logger.Errorf("Invalid output balance string %s: %v", u.Coins, err)
+			wh.Error500(w)
+			return nil
+		}
+		allSupply += coins
+
 		// check if address is an unlocked distribution address
 		if _, ok := unlockedAddrMap[u.Address]; ok {
-			coins, err := droplet.FromString(u.Coins)
-			if err != nil {
-				logger.Errorf("Invalid unlocked output balance string %s: %v", u.Coins, err)
-				wh.Error500(w)
-				return nil
-			}
 			unlockedSupply += coins
 		}
 	}
@@ -76,6 +78,11 @@ func coinSupply(gateway Gatewayer, w http.ResponseWriter, r *http.Request) *Coin
 	totalSupply := uint64(len(unlockedAddrs)) * visor.DistributionAddressInitialBalance
 	totalSupply *= droplet.Multiplier
 
+	// coins issued by block rewards are in circulation on top of the genesis coins
+	if genesisSupply := visor.MaxCoinSupply * droplet.Multiplier; allSupply > genesisSupply {
+		totalSupply += allSupply - genesisSupply
+	}
+
 	// "current supply" is the number of coins distributed from the unlocked pool
 	currentSupply := totalSupply - unlockedSupply
 
@@ -1,9 +1,12 @@
 package gui
 
 import (
+	"time"
+
 	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/coin"
 	"github.com/samoslab/samos/src/daemon"
+	"github.com/samoslab/samos/src/daemon/pex"
 	"github.com/samoslab/samos/src/visor"
 	"github.com/samoslab/samos/src/visor/historydb"
 	"github.com/samoslab/samos/src/wallet"
@@ -30,6 +33,7 @@ type Gatewayer interface {
 	GetWalletSeed(wltID string, password []byte) (string, error)
 	GetBlockByHash(hash cipher.SHA256) (block coin.SignedBlock, ok bool)
 	GetBlockBySeq(seq uint64) (block coin.SignedBlock, ok bool)
+	GetQuorumCert(hash cipher.SHA256) (*visor.ReadableQuorumCert, error)
 	GetBlocks(start, end uint64) (*visor.ReadableBlocks, error)
 	GetLastBlocks(num uint64) (*visor.ReadableBlocks, error)
 	GetBuildInfo() visor.BuildInfo
@@ -42,6 +46,10 @@ type Gatewayer interface {
 	GetDefaultConnections() []string
 	GetTrustConnections() []string
 	GetExchgConnection() []string
+	GetNetworkStats() *daemon.NetworkStats
+	GetBans() []pex.Ban
+	BanPeer(addr string, d time.Duration, reason string) (pex.Ban, error)
+	UnbanPeer(addr string) error
 	GetAllUnconfirmedTxns() []visor.UnconfirmedTxn
 	GetTransaction(txid cipher.SHA256) (*visor.Transaction, error)
 	GetTransactions(flts ...visor.TxFilter) ([]visor.Transaction, error)
@@ -54,4 +62,10 @@ type Gatewayer interface {
 	GetAddressCount() (uint64, error)
 	GetHealth() (*daemon.Health, error)
 	UnloadWallet(id string) error
+	GetValidatorElection() (*visor.ReadableValidatorElection, error)
+	GetValidatorStats() (*visor.ReadableValidatorStats, error)
+	GetValidatorEvidence() ([]visor.ReadableEvidence, error)
+	GetJailedValidators() ([]visor.ReadableJailRecord, error)
+	GetGovernance() (*visor.ReadableGovernance, error)
+	GetKeyRotations() ([]visor.ReadableKeyRotation, error)
 }
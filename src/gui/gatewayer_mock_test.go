@@ -7,12 +7,14 @@ package gui
 
 import (
 	"fmt"
+	"time"
 
 	mock "github.com/stretchr/testify/mock"
 
 	cipher "github.com/samoslab/samos/src/cipher"
 	coin "github.com/samoslab/samos/src/coin"
 	daemon "github.com/samoslab/samos/src/daemon"
+	pex "github.com/samoslab/samos/src/daemon/pex"
 	visor "github.com/samoslab/samos/src/visor"
 	historydb "github.com/samoslab/samos/src/visor/historydb"
 	wallet "github.com/samoslab/samos/src/wallet"
@@ -27,6 +29,33 @@ func NewGatewayerMock() *GatewayerMock {
 	return &GatewayerMock{}
 }
 
+// BanPeer mocked method
+func (m *GatewayerMock) BanPeer(p0 string, p1 time.Duration, p2 string) (pex.Ban, error) {
+
+	ret := m.Called(p0, p1, p2)
+
+	var r0 pex.Ban
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case pex.Ban:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	var r1 error
+	switch res := ret.Get(1).(type) {
+	case nil:
+	case error:
+		r1 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0, r1
+
+}
+
 // CreateTransaction mocked method
 func (m *GatewayerMock) CreateTransaction(p0 wallet.CreateTransactionParams) (*coin.Transaction, []wallet.UxBalance, error) {
 
@@ -270,6 +299,24 @@ func (m *GatewayerMock) GetBalanceOfAddrs(p0 []cipher.Address) ([]wallet.Balance
 
 }
 
+// GetBans mocked method
+func (m *GatewayerMock) GetBans() []pex.Ban {
+
+	ret := m.Called()
+
+	var r0 []pex.Ban
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case []pex.Ban:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0
+
+}
+
 // GetBlockByHash mocked method
 func (m *GatewayerMock) GetBlockByHash(p0 cipher.SHA256) (coin.SignedBlock, bool) {
 
@@ -486,6 +533,33 @@ func (m *GatewayerMock) GetExchgConnection() []string {
 
 }
 
+// GetGovernance mocked method
+func (m *GatewayerMock) GetGovernance() (*visor.ReadableGovernance, error) {
+
+	ret := m.Called()
+
+	var r0 *visor.ReadableGovernance
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case *visor.ReadableGovernance:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	var r1 error
+	switch res := ret.Get(1).(type) {
+	case nil:
+	case error:
+		r1 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0, r1
+
+}
+
 // GetHealth mocked method
 func (m *GatewayerMock) GetHealth() (*daemon.Health, error) {
 
@@ -513,6 +587,60 @@ func (m *GatewayerMock) GetHealth() (*daemon.Health, error) {
 
 }
 
+// GetJailedValidators mocked method
+func (m *GatewayerMock) GetJailedValidators() ([]visor.ReadableJailRecord, error) {
+
+	ret := m.Called()
+
+	var r0 []visor.ReadableJailRecord
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case []visor.ReadableJailRecord:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	var r1 error
+	switch res := ret.Get(1).(type) {
+	case nil:
+	case error:
+		r1 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0, r1
+
+}
+
+// GetKeyRotations mocked method
+func (m *GatewayerMock) GetKeyRotations() ([]visor.ReadableKeyRotation, error) {
+
+	ret := m.Called()
+
+	var r0 []visor.ReadableKeyRotation
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case []visor.ReadableKeyRotation:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	var r1 error
+	switch res := ret.Get(1).(type) {
+	case nil:
+	case error:
+		r1 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0, r1
+
+}
+
 // GetLastBlocks mocked method
 func (m *GatewayerMock) GetLastBlocks(p0 uint64) (*visor.ReadableBlocks, error) {
 
@@ -540,6 +668,51 @@ func (m *GatewayerMock) GetLastBlocks(p0 uint64) (*visor.ReadableBlocks, error)
 
 }
 
+// GetNetworkStats mocked method
+func (m *GatewayerMock) GetNetworkStats() *daemon.NetworkStats {
+
+	ret := m.Called()
+
+	var r0 *daemon.NetworkStats
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case *daemon.NetworkStats:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0
+
+}
+
+// GetQuorumCert mocked method
+func (m *GatewayerMock) GetQuorumCert(p0 cipher.SHA256) (*visor.ReadableQuorumCert, error) {
+
+	ret := m.Called(p0)
+
+	var r0 *visor.ReadableQuorumCert
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case *visor.ReadableQuorumCert:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	var r1 error
+	switch res := ret.Get(1).(type) {
+	case nil:
+	case error:
+		r1 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0, r1
+
+}
+
 // GetRichlist mocked method
 func (m *GatewayerMock) GetRichlist(p0 bool) (visor.Richlist, error) {
 
@@ -693,6 +866,87 @@ func (m *GatewayerMock) GetUxOutByID(p0 cipher.SHA256) (*historydb.UxOut, error)
 
 }
 
+// GetValidatorElection mocked method
+func (m *GatewayerMock) GetValidatorElection() (*visor.ReadableValidatorElection, error) {
+
+	ret := m.Called()
+
+	var r0 *visor.ReadableValidatorElection
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case *visor.ReadableValidatorElection:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	var r1 error
+	switch res := ret.Get(1).(type) {
+	case nil:
+	case error:
+		r1 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0, r1
+
+}
+
+// GetValidatorEvidence mocked method
+func (m *GatewayerMock) GetValidatorEvidence() ([]visor.ReadableEvidence, error) {
+
+	ret := m.Called()
+
+	var r0 []visor.ReadableEvidence
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case []visor.ReadableEvidence:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	var r1 error
+	switch res := ret.Get(1).(type) {
+	case nil:
+	case error:
+		r1 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0, r1
+
+}
+
+// GetValidatorStats mocked method
+func (m *GatewayerMock) GetValidatorStats() (*visor.ReadableValidatorStats, error) {
+
+	ret := m.Called()
+
+	var r0 *visor.ReadableValidatorStats
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case *visor.ReadableValidatorStats:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	var r1 error
+	switch res := ret.Get(1).(type) {
+	case nil:
+	case error:
+		r1 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0, r1
+
+}
+
 // GetWallet mocked method
 func (m *GatewayerMock) GetWallet(p0 string) (*wallet.Wallet, error) {
 
@@ -963,6 +1217,24 @@ func (m *GatewayerMock) Spend(p0 string, p1 []byte, p2 uint64, p3 cipher.Address
 
 }
 
+// UnbanPeer mocked method
+func (m *GatewayerMock) UnbanPeer(p0 string) error {
+
+	ret := m.Called(p0)
+
+	var r0 error
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case error:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0
+
+}
+
 // UnloadWallet mocked method
 func (m *GatewayerMock) UnloadWallet(p0 string) error {
 
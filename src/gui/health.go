@@ -14,12 +14,21 @@ type BlockchainMetadata struct {
 	TimeSinceLastBlock wh.Duration `json:"time_since_last_block"`
 }
 
+// NetworkTime is the offset of the local clock to the clocks of the peers
+type NetworkTime struct {
+	Offset  wh.Duration `json:"offset"`
+	Median  wh.Duration `json:"median"`
+	Peers   int         `json:"peers"`
+	Warning string      `json:"warning,omitempty"`
+}
+
 // HealthResponse is returned by the /health endpoint
 type HealthResponse struct {
 	BlockchainMetadata BlockchainMetadata `json:"blockchain"`
 	Version            visor.BuildInfo    `json:"version"`
 	OpenConnections    int                `json:"open_connections"`
 	Uptime             wh.Duration        `json:"uptime"`
+	NetworkTime        NetworkTime        `json:"network_time"`
 }
 
 // Returns node health data.
@@ -50,6 +59,12 @@ func healthCheck(gateway Gatewayer) http.HandlerFunc {
 			Version:         health.Version,
 			OpenConnections: health.OpenConnections,
 			Uptime:          wh.FromDuration(health.Uptime),
+			NetworkTime: NetworkTime{
+				Offset:  wh.FromDuration(health.NetworkTime.Offset),
+				Median:  wh.FromDuration(health.NetworkTime.Median),
+				Peers:   health.NetworkTime.Peers,
+				Warning: health.NetworkTime.Warning,
+			},
 		})
 	}
 }
@@ -12,6 +12,7 @@ import (
 	"net/http/httptest"
 
 	"github.com/samoslab/samos/src/daemon"
+	wh "github.com/samoslab/samos/src/util/http"
 	"github.com/samoslab/samos/src/visor"
 )
 
@@ -71,6 +72,12 @@ func TestHealthCheckHandler(t *testing.T) {
 				OpenConnections:    3,
 				Version:            buildInfo,
 				Uptime:             time.Second * 4,
+				NetworkTime: daemon.NetworkTimeStatus{
+					Offset:  time.Second * 2,
+					Median:  time.Second * 2,
+					Peers:   4,
+					Warning: "clock drift",
+				},
 			}
 
 			gateway := NewGatewayerMock()
@@ -109,6 +116,12 @@ func TestHealthCheckHandler(t *testing.T) {
 			require.Equal(t, health.Uptime, r.Uptime.Duration)
 
 			require.Equal(t, health.OpenConnections, r.OpenConnections)
+			require.Equal(t, NetworkTime{
+				Offset:  wh.FromDuration(time.Second * 2),
+				Median:  wh.FromDuration(time.Second * 2),
+				Peers:   4,
+				Warning: "clock drift",
+			}, r.NetworkTime)
 
 			require.Equal(t, unconfirmed, r.BlockchainMetadata.Unconfirmed)
 			require.Equal(t, unspents, r.BlockchainMetadata.Unspents)
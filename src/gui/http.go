@@ -313,6 +313,10 @@ func newServerMux(c muxConfig, gateway Gatewayer, csrfStore *CSRFStore) *http.Se
 	webHandler("/network/defaultConnections", defaultConnectionsHandler(gateway))
 	webHandler("/network/connections/trust", trustConnectionsHandler(gateway))
 	webHandler("/network/connections/exchange", exchgConnectionsHandler(gateway))
+	webHandler("/network/stats", networkStatsHandler(gateway))
+	webHandler("/network/bans", bansHandler(gateway))
+	webHandler("/network/bans/add", banHandler(gateway))
+	webHandler("/network/bans/remove", unbanHandler(gateway))
 
 	// Transaction handler
 
@@ -354,6 +358,20 @@ func newServerMux(c muxConfig, gateway Gatewayer, csrfStore *CSRFStore) *http.Se
 
 	webHandler("/addresscount", getAddressCount(gateway))
 
+	// Validator election interface
+
+	// get the vote tally and validators of the last election
+	webHandler("/validators/votes", validatorVotesHandler(gateway))
+	// get the produced, missed and orphaned slots of the validators
+	webHandler("/validators/stats", validatorStatsHandler(gateway))
+	// get the evidence of validators which signed conflicting blocks
+	webHandler("/validators/evidence", validatorEvidenceHandler(gateway))
+	// get the jailed validators, the reason and the epoch of release
+	webHandler("/validators/jail", validatorJailHandler(gateway))
+	// get the validator set and quorum changes waiting for the next epoch and the ones in effect
+	webHandler("/validators/governance", validatorGovernanceHandler(gateway))
+	webHandler("/validators/rotations", validatorKeyRotationsHandler(gateway))
+
 	return mux
 }
 
@@ -2,9 +2,12 @@ package gui
 
 // Network-related information for the GUI
 import (
+	"fmt"
 	"net/http"
 	"sort"
+	"time"
 
+	"github.com/samoslab/samos/src/daemon/pex"
 	wh "github.com/samoslab/samos/src/util/http" //http,json helpers
 )
 
@@ -83,3 +86,108 @@ func exchgConnectionsHandler(gateway Gatewayer) http.HandlerFunc {
 		wh.SendJSONOr500(logger, w, conns)
 	}
 }
+
+// Returns the traffic of all the connections, in all and by message prefix, and the histograms
+// of the time taken to process each message
+// URI: /network/stats
+// Method: GET
+func networkStatsHandler(gateway Gatewayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			wh.Error405(w)
+			return
+		}
+
+		wh.SendJSONOr500(logger, w, gateway.GetNetworkStats())
+	}
+}
+
+// Returns the banned IPs
+// URI: /network/bans
+// Method: GET
+func bansHandler(gateway Gatewayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			wh.Error405(w)
+			return
+		}
+
+		wh.SendJSONOr500(logger, w, gateway.GetBans())
+	}
+}
+
+// Bans the IP of a peer, the connections to the IP are closed
+// URI: /network/bans/add
+// Method: POST
+// Args:
+//     ip: IP or address of the peer [required]
+//     duration: duration of the ban, e.g. "48h" [optional, the ban duration of the node by default]
+//     reason: reason of the ban [optional]
+func banHandler(gateway Gatewayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			wh.Error405(w)
+			return
+		}
+
+		ip := r.FormValue("ip")
+		if ip == "" {
+			wh.Error400(w, "ip is required")
+			return
+		}
+
+		var d time.Duration
+		if s := r.FormValue("duration"); s != "" {
+			var err error
+			d, err = time.ParseDuration(s)
+			if err != nil {
+				wh.Error400(w, fmt.Sprintf("invalid duration: %v", err))
+				return
+			}
+		}
+
+		ban, err := gateway.BanPeer(ip, d, r.FormValue("reason"))
+		if err != nil {
+			switch err {
+			case pex.ErrInvalidAddress, pex.ErrInvalidBanDuration:
+				wh.Error400(w, err.Error())
+			default:
+				wh.Error500Msg(w, err.Error())
+			}
+			return
+		}
+
+		wh.SendJSONOr500(logger, w, ban)
+	}
+}
+
+// Removes the ban of the IP of a peer
+// URI: /network/bans/remove
+// Method: POST
+// Args:
+//     ip: IP or address of the peer [required]
+func unbanHandler(gateway Gatewayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			wh.Error405(w)
+			return
+		}
+
+		ip := r.FormValue("ip")
+		if ip == "" {
+			wh.Error400(w, "ip is required")
+			return
+		}
+
+		if err := gateway.UnbanPeer(ip); err != nil {
+			switch err {
+			case pex.ErrInvalidAddress:
+				wh.Error400(w, err.Error())
+			case pex.ErrNotBanned:
+				wh.Error404(w)
+			default:
+				wh.Error500Msg(w, err.Error())
+			}
+		}
+	}
+}
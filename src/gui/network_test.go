@@ -7,10 +7,12 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/samoslab/samos/src/daemon"
+	"github.com/samoslab/samos/src/daemon/pex"
 )
 
 func TestConnection(t *testing.T) {
@@ -334,3 +336,322 @@ func TestGetExchgConnection(t *testing.T) {
 		})
 	}
 }
+
+func TestNetworkStats(t *testing.T) {
+	none := daemon.Traffic{
+		Rates: []daemon.TrafficRate{{Window: "10s"}, {Window: "1m0s"}},
+	}
+	stats := &daemon.NetworkStats{
+		Traffic: daemon.TrafficStats{
+			In: daemon.Traffic{
+				Messages: 2,
+				Bytes:    240,
+				Rates: []daemon.TrafficRate{
+					{Window: "10s", Messages: 0.2, Bytes: 24},
+					{Window: "1m0s", Messages: 0.03, Bytes: 4},
+				},
+			},
+			Out: none,
+			Messages: map[string]daemon.MessageTraffic{
+				"GIVB": {
+					In: daemon.Traffic{
+						Messages: 2,
+						Bytes:    240,
+						Rates: []daemon.TrafficRate{
+							{Window: "10s", Messages: 0.2, Bytes: 24},
+							{Window: "1m0s", Messages: 0.03, Bytes: 4},
+						},
+					},
+					Out: none,
+				},
+			},
+		},
+		Handlers: []daemon.HandlerLatency{
+			{
+				Message: "GIVB",
+				Count:   2,
+				Mean:    12.5,
+				Max:     20,
+				Buckets: []daemon.LatencyBucket{
+					{LE: "5ms", Count: 0},
+					{LE: "50ms", Count: 2},
+					{LE: "+Inf", Count: 0},
+				},
+			},
+		},
+	}
+
+	tt := []struct {
+		name   string
+		method string
+		status int
+		err    string
+		result *daemon.NetworkStats
+	}{
+		{
+			name:   "405",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+			err:    "405 Method Not Allowed",
+		},
+		{
+			name:   "200",
+			method: http.MethodGet,
+			status: http.StatusOK,
+			result: stats,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := NewGatewayerMock()
+			gateway.On("GetNetworkStats").Return(stats)
+
+			req, err := http.NewRequest(tc.method, "/network/stats", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			handler := newServerMux(mxConfig, gateway, &CSRFStore{})
+			handler.ServeHTTP(rr, req)
+
+			status := rr.Code
+			require.Equal(t, tc.status, status, "case: %s, handler returned wrong status code: got `%v` want `%v`", tc.name, status, tc.status)
+
+			if status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+			} else {
+				var msg *daemon.NetworkStats
+				err = json.Unmarshal(rr.Body.Bytes(), &msg)
+				require.NoError(t, err)
+				require.Equal(t, tc.result, msg)
+			}
+		})
+	}
+}
+
+func TestBans(t *testing.T) {
+	bans := []pex.Ban{
+		{IP: "112.32.32.14", Reason: "invalid block", BannedAt: 1000, Until: 87400},
+	}
+	tt := []struct {
+		name   string
+		method string
+		status int
+		err    string
+		result []pex.Ban
+	}{
+		{
+			name:   "405",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+			err:    "405 Method Not Allowed",
+		},
+		{
+			name:   "200",
+			method: http.MethodGet,
+			status: http.StatusOK,
+			result: bans,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := NewGatewayerMock()
+			gateway.On("GetBans").Return(bans)
+
+			req, err := http.NewRequest(tc.method, "/network/bans", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			handler := newServerMux(mxConfig, gateway, &CSRFStore{})
+			handler.ServeHTTP(rr, req)
+
+			status := rr.Code
+			require.Equal(t, tc.status, status, "case: %s, handler returned wrong status code: got `%v` want `%v`", tc.name, status, tc.status)
+
+			if status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+			} else {
+				var msg []pex.Ban
+				err = json.Unmarshal(rr.Body.Bytes(), &msg)
+				require.NoError(t, err)
+				require.Equal(t, tc.result, msg)
+			}
+		})
+	}
+}
+
+func TestBanPeer(t *testing.T) {
+	ban := pex.Ban{IP: "112.32.32.14", Reason: "spam", BannedAt: 1000, Until: 8200}
+	tt := []struct {
+		name     string
+		method   string
+		status   int
+		err      string
+		ip       string
+		duration string
+		reason   string
+		d        time.Duration
+		banErr   error
+		result   pex.Ban
+	}{
+		{
+			name:   "405",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+			err:    "405 Method Not Allowed",
+		},
+		{
+			name:   "400 - missing ip",
+			method: http.MethodPost,
+			status: http.StatusBadRequest,
+			err:    "400 Bad Request - ip is required",
+		},
+		{
+			name:     "400 - invalid duration",
+			method:   http.MethodPost,
+			status:   http.StatusBadRequest,
+			err:      "400 Bad Request - invalid duration: time: invalid duration \"x\"",
+			ip:       "112.32.32.14",
+			duration: "x",
+		},
+		{
+			name:   "400 - invalid ip",
+			method: http.MethodPost,
+			status: http.StatusBadRequest,
+			err:    "400 Bad Request - Invalid address",
+			ip:     "112.32.32",
+			banErr: pex.ErrInvalidAddress,
+		},
+		{
+			name:     "400 - negative duration",
+			method:   http.MethodPost,
+			status:   http.StatusBadRequest,
+			err:      "400 Bad Request - Ban duration must be positive",
+			ip:       "112.32.32.14",
+			duration: "-2h",
+			d:        -time.Hour * 2,
+			banErr:   pex.ErrInvalidBanDuration,
+		},
+		{
+			name:     "200",
+			method:   http.MethodPost,
+			status:   http.StatusOK,
+			ip:       "112.32.32.14",
+			duration: "2h",
+			reason:   "spam",
+			d:        time.Hour * 2,
+			result:   ban,
+		},
+		{
+			name:   "200 - default duration",
+			method: http.MethodPost,
+			status: http.StatusOK,
+			ip:     "112.32.32.14",
+			result: ban,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := NewGatewayerMock()
+			gateway.On("BanPeer", tc.ip, tc.d, tc.reason).Return(tc.result, tc.banErr)
+
+			v := url.Values{}
+			v.Add("ip", tc.ip)
+			v.Add("duration", tc.duration)
+			v.Add("reason", tc.reason)
+
+			req, err := http.NewRequest(tc.method, "/network/bans/add", strings.NewReader(v.Encode()))
+			require.NoError(t, err)
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+			rr := httptest.NewRecorder()
+			handler := newServerMux(mxConfig, gateway, &CSRFStore{})
+			handler.ServeHTTP(rr, req)
+
+			status := rr.Code
+			require.Equal(t, tc.status, status, "case: %s, handler returned wrong status code: got `%v` want `%v`", tc.name, status, tc.status)
+
+			if status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+			} else {
+				var msg pex.Ban
+				err = json.Unmarshal(rr.Body.Bytes(), &msg)
+				require.NoError(t, err)
+				require.Equal(t, tc.result, msg)
+			}
+		})
+	}
+}
+
+func TestUnbanPeer(t *testing.T) {
+	tt := []struct {
+		name     string
+		method   string
+		status   int
+		err      string
+		ip       string
+		unbanErr error
+	}{
+		{
+			name:   "405",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+			err:    "405 Method Not Allowed",
+		},
+		{
+			name:   "400 - missing ip",
+			method: http.MethodPost,
+			status: http.StatusBadRequest,
+			err:    "400 Bad Request - ip is required",
+		},
+		{
+			name:     "400 - invalid ip",
+			method:   http.MethodPost,
+			status:   http.StatusBadRequest,
+			err:      "400 Bad Request - Invalid address",
+			ip:       "112.32.32",
+			unbanErr: pex.ErrInvalidAddress,
+		},
+		{
+			name:     "404 - not banned",
+			method:   http.MethodPost,
+			status:   http.StatusNotFound,
+			err:      "404 Not Found",
+			ip:       "112.32.32.14",
+			unbanErr: pex.ErrNotBanned,
+		},
+		{
+			name:   "200",
+			method: http.MethodPost,
+			status: http.StatusOK,
+			ip:     "112.32.32.14",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := NewGatewayerMock()
+			gateway.On("UnbanPeer", tc.ip).Return(tc.unbanErr)
+
+			v := url.Values{}
+			v.Add("ip", tc.ip)
+
+			req, err := http.NewRequest(tc.method, "/network/bans/remove", strings.NewReader(v.Encode()))
+			require.NoError(t, err)
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+			rr := httptest.NewRecorder()
+			handler := newServerMux(mxConfig, gateway, &CSRFStore{})
+			handler.ServeHTTP(rr, req)
+
+			status := rr.Code
+			require.Equal(t, tc.status, status, "case: %s, handler returned wrong status code: got `%v` want `%v`", tc.name, status, tc.status)
+
+			if status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+			}
+		})
+	}
+}
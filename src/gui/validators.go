@@ -0,0 +1,138 @@
+package gui
+
+// Validator election related information for the GUI
+import (
+	"net/http"
+
+	wh "github.com/samoslab/samos/src/util/http" //http,json helpers
+)
+
+// Returns the vote tally and the validators of the last election
+// URI: /validators/votes
+// Method: GET
+func validatorVotesHandler(gateway Gatewayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			wh.Error405(w)
+			return
+		}
+
+		election, err := gateway.GetValidatorElection()
+		if err != nil {
+			logger.WithError(err).Error("gateway.GetValidatorElection failed")
+			wh.Error500Msg(w, err.Error())
+			return
+		}
+
+		wh.SendJSONOr500(logger, w, election)
+	}
+}
+
+// Returns the produced, missed and orphaned slots of the validators, the totals
+// of all epochs and the statistics of every epoch
+// URI: /validators/stats
+// Method: GET
+func validatorStatsHandler(gateway Gatewayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			wh.Error405(w)
+			return
+		}
+
+		stats, err := gateway.GetValidatorStats()
+		if err != nil {
+			logger.WithError(err).Error("gateway.GetValidatorStats failed")
+			wh.Error500Msg(w, err.Error())
+			return
+		}
+
+		wh.SendJSONOr500(logger, w, stats)
+	}
+}
+
+// Returns the evidence of validators which signed two conflicting block headers
+// URI: /validators/evidence
+// Method: GET
+func validatorEvidenceHandler(gateway Gatewayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			wh.Error405(w)
+			return
+		}
+
+		evidences, err := gateway.GetValidatorEvidence()
+		if err != nil {
+			logger.WithError(err).Error("gateway.GetValidatorEvidence failed")
+			wh.Error500Msg(w, err.Error())
+			return
+		}
+
+		wh.SendJSONOr500(logger, w, evidences)
+	}
+}
+
+// Returns the jailed validators, the reason and the epoch from which an unjail
+// transaction is accepted
+// URI: /validators/jail
+// Method: GET
+func validatorJailHandler(gateway Gatewayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			wh.Error405(w)
+			return
+		}
+
+		jailed, err := gateway.GetJailedValidators()
+		if err != nil {
+			logger.WithError(err).Error("gateway.GetJailedValidators failed")
+			wh.Error500Msg(w, err.Error())
+			return
+		}
+
+		wh.SendJSONOr500(logger, w, jailed)
+	}
+}
+
+// Returns the validator set and quorum changes approved by governance transactions,
+// the pending ones take effect at the next epoch boundary
+// URI: /validators/governance
+// Method: GET
+func validatorGovernanceHandler(gateway Gatewayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			wh.Error405(w)
+			return
+		}
+
+		governance, err := gateway.GetGovernance()
+		if err != nil {
+			logger.WithError(err).Error("gateway.GetGovernance failed")
+			wh.Error500Msg(w, err.Error())
+			return
+		}
+
+		wh.SendJSONOr500(logger, w, governance)
+	}
+}
+
+// Returns the validator key rotations, a pending rotation takes effect at the start
+// of its active epoch
+// URI: /validators/rotations
+// Method: GET
+func validatorKeyRotationsHandler(gateway Gatewayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			wh.Error405(w)
+			return
+		}
+
+		rotations, err := gateway.GetKeyRotations()
+		if err != nil {
+			logger.WithError(err).Error("gateway.GetKeyRotations failed")
+			wh.Error500Msg(w, err.Error())
+			return
+		}
+
+		wh.SendJSONOr500(logger, w, rotations)
+	}
+}
@@ -0,0 +1,464 @@
+package gui
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/visor"
+)
+
+func TestValidatorVotesHandler(t *testing.T) {
+	election := &visor.ReadableValidatorElection{
+		Enabled:    true,
+		Epoch:      17640,
+		Validators: []string{"03cec5e9f78524a4283868b79cf3a2b406bcd7956cd9b4be325e070a1cb1881563"},
+		Tallies: []visor.ReadableVoteTally{
+			{
+				Address: "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv",
+				PubKey:  "03cec5e9f78524a4283868b79cf3a2b406bcd7956cd9b4be325e070a1cb1881563",
+				Weight:  "100.000000",
+				Voters:  2,
+				Elected: true,
+			},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		method   string
+		code     int
+		getErr   error
+		expected *visor.ReadableValidatorElection
+	}{
+		{
+			name:     "valid response",
+			method:   http.MethodGet,
+			code:     http.StatusOK,
+			expected: election,
+		},
+		{
+			name:   "405 method not allowed",
+			method: http.MethodPost,
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "gateway.GetValidatorElection error",
+			method: http.MethodGet,
+			code:   http.StatusInternalServerError,
+			getErr: errors.New("GetValidatorElection failed"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := NewGatewayerMock()
+			if tc.getErr != nil {
+				gateway.On("GetValidatorElection").Return(nil, tc.getErr)
+			} else {
+				gateway.On("GetValidatorElection").Return(election, nil)
+			}
+
+			req, err := http.NewRequest(tc.method, "/validators/votes", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			cfg := muxConfig{
+				host:   configuredHost,
+				appLoc: ".",
+			}
+			handler := newServerMux(cfg, gateway, &CSRFStore{})
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code)
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var r visor.ReadableValidatorElection
+			err = json.Unmarshal(rr.Body.Bytes(), &r)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, &r)
+		})
+	}
+}
+
+func TestValidatorStatsHandler(t *testing.T) {
+	validator := visor.ReadableSlotStats{
+		PubKey:         "03cec5e9f78524a4283868b79cf3a2b406bcd7956cd9b4be325e070a1cb1881563",
+		Address:        "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv",
+		Produced:       8000,
+		Missed:         12,
+		Orphaned:       1,
+		LastMissedSlot: 1524129870,
+	}
+	stats := &visor.ReadableValidatorStats{
+		Validators: []visor.ReadableSlotStats{validator},
+		Epochs: []visor.ReadableEpochStats{
+			{
+				Epoch:      17640,
+				Produced:   8000,
+				Missed:     12,
+				Orphaned:   1,
+				Validators: []visor.ReadableSlotStats{validator},
+			},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		method   string
+		code     int
+		getErr   error
+		expected *visor.ReadableValidatorStats
+	}{
+		{
+			name:     "valid response",
+			method:   http.MethodGet,
+			code:     http.StatusOK,
+			expected: stats,
+		},
+		{
+			name:   "405 method not allowed",
+			method: http.MethodPost,
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "gateway.GetValidatorStats error",
+			method: http.MethodGet,
+			code:   http.StatusInternalServerError,
+			getErr: errors.New("GetValidatorStats failed"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := NewGatewayerMock()
+			if tc.getErr != nil {
+				gateway.On("GetValidatorStats").Return(nil, tc.getErr)
+			} else {
+				gateway.On("GetValidatorStats").Return(stats, nil)
+			}
+
+			req, err := http.NewRequest(tc.method, "/validators/stats", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			cfg := muxConfig{
+				host:   configuredHost,
+				appLoc: ".",
+			}
+			handler := newServerMux(cfg, gateway, &CSRFStore{})
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code)
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var r visor.ReadableValidatorStats
+			err = json.Unmarshal(rr.Body.Bytes(), &r)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, &r)
+		})
+	}
+}
+
+func TestValidatorEvidenceHandler(t *testing.T) {
+	evidences := []visor.ReadableEvidence{
+		{
+			PubKey:     "03cec5e9f78524a4283868b79cf3a2b406bcd7956cd9b4be325e070a1cb1881563",
+			Address:    "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv",
+			ReportedAt: 1524129875,
+			Headers: []visor.ReadableSignedHeader{
+				{
+					Header: visor.ReadableBlockHeader{BkSeq: 10, Time: 1524129870},
+					Sig:    "ab",
+				},
+				{
+					Header: visor.ReadableBlockHeader{BkSeq: 10, Time: 1524129872},
+					Sig:    "cd",
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		method   string
+		code     int
+		getErr   error
+		expected []visor.ReadableEvidence
+	}{
+		{
+			name:     "valid response",
+			method:   http.MethodGet,
+			code:     http.StatusOK,
+			expected: evidences,
+		},
+		{
+			name:   "405 method not allowed",
+			method: http.MethodPost,
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "gateway.GetValidatorEvidence error",
+			method: http.MethodGet,
+			code:   http.StatusInternalServerError,
+			getErr: errors.New("GetValidatorEvidence failed"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := NewGatewayerMock()
+			if tc.getErr != nil {
+				gateway.On("GetValidatorEvidence").Return(nil, tc.getErr)
+			} else {
+				gateway.On("GetValidatorEvidence").Return(evidences, nil)
+			}
+
+			req, err := http.NewRequest(tc.method, "/validators/evidence", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			cfg := muxConfig{
+				host:   configuredHost,
+				appLoc: ".",
+			}
+			handler := newServerMux(cfg, gateway, &CSRFStore{})
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code)
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var r []visor.ReadableEvidence
+			err = json.Unmarshal(rr.Body.Bytes(), &r)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, r)
+		})
+	}
+}
+
+func TestValidatorJailHandler(t *testing.T) {
+	jailed := []visor.ReadableJailRecord{
+		{
+			PubKey:       "03cec5e9f78524a4283868b79cf3a2b406bcd7956cd9b4be325e070a1cb1881563",
+			Address:      "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv",
+			Reason:       "double_sign",
+			JailedEpoch:  17640,
+			ReleaseEpoch: 17670,
+		},
+	}
+
+	cases := []struct {
+		name     string
+		method   string
+		code     int
+		getErr   error
+		expected []visor.ReadableJailRecord
+	}{
+		{
+			name:     "valid response",
+			method:   http.MethodGet,
+			code:     http.StatusOK,
+			expected: jailed,
+		},
+		{
+			name:   "405 method not allowed",
+			method: http.MethodPost,
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "gateway.GetJailedValidators error",
+			method: http.MethodGet,
+			code:   http.StatusInternalServerError,
+			getErr: errors.New("GetJailedValidators failed"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := NewGatewayerMock()
+			if tc.getErr != nil {
+				gateway.On("GetJailedValidators").Return(nil, tc.getErr)
+			} else {
+				gateway.On("GetJailedValidators").Return(jailed, nil)
+			}
+
+			req, err := http.NewRequest(tc.method, "/validators/jail", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			cfg := muxConfig{
+				host:   configuredHost,
+				appLoc: ".",
+			}
+			handler := newServerMux(cfg, gateway, &CSRFStore{})
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code)
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var r []visor.ReadableJailRecord
+			err = json.Unmarshal(rr.Body.Bytes(), &r)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, r)
+		})
+	}
+}
+
+func TestValidatorGovernanceHandler(t *testing.T) {
+	governance := &visor.ReadableGovernance{
+		Threshold: 3,
+		Pending: []visor.ReadableGovernanceProposal{
+			{
+				Type:      "quorum",
+				Txid:      "a8558b814926ed0062cd720a572bd67367aa0d01c0769ea4800adcc89cdee524",
+				Height:    1022,
+				Epoch:     17641,
+				Quorum:    3,
+				Approvals: []string{"03cec5e9f78524a4283868b79cf3a2b406bcd7956cd9b4be325e070a1cb1881563"},
+			},
+		},
+		Active: []visor.ReadableGovernanceProposal{},
+	}
+
+	cases := []struct {
+		name     string
+		method   string
+		code     int
+		getErr   error
+		expected *visor.ReadableGovernance
+	}{
+		{
+			name:     "valid response",
+			method:   http.MethodGet,
+			code:     http.StatusOK,
+			expected: governance,
+		},
+		{
+			name:   "405 method not allowed",
+			method: http.MethodPost,
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "gateway.GetGovernance error",
+			method: http.MethodGet,
+			code:   http.StatusInternalServerError,
+			getErr: errors.New("GetGovernance failed"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := NewGatewayerMock()
+			if tc.getErr != nil {
+				gateway.On("GetGovernance").Return(nil, tc.getErr)
+			} else {
+				gateway.On("GetGovernance").Return(governance, nil)
+			}
+
+			req, err := http.NewRequest(tc.method, "/validators/governance", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			cfg := muxConfig{
+				host:   configuredHost,
+				appLoc: ".",
+			}
+			handler := newServerMux(cfg, gateway, &CSRFStore{})
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code)
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var r visor.ReadableGovernance
+			err = json.Unmarshal(rr.Body.Bytes(), &r)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, &r)
+		})
+	}
+}
+
+func TestValidatorKeyRotationsHandler(t *testing.T) {
+	rotations := []visor.ReadableKeyRotation{
+		{
+			OldPubKey:   "03cec5e9f78524a4283868b79cf3a2b406bcd7956cd9b4be325e070a1cb1881563",
+			OldAddress:  "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv",
+			NewPubKey:   "02aecd90febe163da3c4ac5bb711d9a87b2950d11413541acc9bda17fbda47954e",
+			NewAddress:  "2PzndHacXbmM8GNjMsA5dDTiyQFiKzjpFzX",
+			Txid:        "a8558b814926ed0062cd720a572bd67367aa0d01c0769ea4800adcc89cdee524",
+			Height:      1022,
+			ActiveEpoch: 17642,
+		},
+	}
+
+	cases := []struct {
+		name     string
+		method   string
+		code     int
+		getErr   error
+		expected []visor.ReadableKeyRotation
+	}{
+		{
+			name:     "valid response",
+			method:   http.MethodGet,
+			code:     http.StatusOK,
+			expected: rotations,
+		},
+		{
+			name:   "405 method not allowed",
+			method: http.MethodPost,
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "gateway.GetKeyRotations error",
+			method: http.MethodGet,
+			code:   http.StatusInternalServerError,
+			getErr: errors.New("GetKeyRotations failed"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := NewGatewayerMock()
+			if tc.getErr != nil {
+				gateway.On("GetKeyRotations").Return(nil, tc.getErr)
+			} else {
+				gateway.On("GetKeyRotations").Return(rotations, nil)
+			}
+
+			req, err := http.NewRequest(tc.method, "/validators/rotations", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			cfg := muxConfig{
+				host:   configuredHost,
+				appLoc: ".",
+			}
+			handler := newServerMux(cfg, gateway, &CSRFStore{})
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code)
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var r []visor.ReadableKeyRotation
+			err = json.Unmarshal(rr.Body.Bytes(), &r)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, r)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
+)
+
+// Client signs with the keys of a signer process, it implements Signer
+type Client struct {
+	addr    string
+	authKey []byte
+	timeout time.Duration
+
+	pubkey    cipher.PubKey
+	master    cipher.PubKey
+	hasMaster bool
+
+	sess  *session
+	mutex sync.Mutex
+}
+
+// Dial connects to the signer at the address, unix:/path for a unix socket or host:port,
+// and fetches its public keys
+func Dial(addr string, authKey []byte) (*Client, error) {
+	if len(authKey) < MinAuthKeySize {
+		return nil, fmt.Errorf("auth key is shorter than %d bytes", MinAuthKeySize)
+	}
+
+	c := &Client{
+		addr:    addr,
+		authKey: authKey,
+		timeout: DefaultTimeout,
+	}
+	resp, err := c.request(Request{Kind: KindPubKeys})
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.pubkey = resp.PubKey
+	c.master = resp.MasterPubKey
+	c.hasMaster = resp.MasterPubKey != (cipher.PubKey{})
+	return c, nil
+}
+
+// PubKey returns the trust key of the signer
+func (c *Client) PubKey() cipher.PubKey {
+	return c.pubkey
+}
+
+// MasterPubKey returns the master key of the signer
+func (c *Client) MasterPubKey() (cipher.PubKey, bool) {
+	return c.master, c.hasMaster
+}
+
+// Sign asks the signer to sign the request, the signature is checked against its key
+func (c *Client) Sign(r Request) (cipher.Sig, error) {
+	hash, err := r.SignHash()
+	if err != nil {
+		return cipher.Sig{}, err
+	}
+
+	resp, err := c.request(r)
+	if err != nil {
+		return cipher.Sig{}, err
+	}
+
+	pubkey := c.pubkey
+	if r.isMaster() {
+		pubkey = c.master
+	}
+	if err := cipher.VerifySignature(pubkey, resp.Sig, hash); err != nil {
+		return cipher.Sig{}, fmt.Errorf("invalid %v signature of the signer: %v", r.Kind, err)
+	}
+	return resp.Sig, nil
+}
+
+// Close closes the connection to the signer, it is opened again by the next request
+func (c *Client) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closeSession()
+}
+
+func (c *Client) closeSession() {
+	if c.sess != nil {
+		c.sess.conn.Close()
+		c.sess = nil
+	}
+}
+
+// request sends the request and reads the response. The connection is opened again once
+// if it was lost, a request refused by the signer is not repeated.
+func (c *Client) request(r Request) (Response, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	reconnected := false
+	for {
+		if c.sess == nil {
+			if err := c.connect(); err != nil {
+				return Response{}, err
+			}
+			reconnected = true
+		}
+
+		resp, err := c.roundTrip(r)
+		if err == nil {
+			if resp.Error != "" {
+				return Response{}, errors.New(resp.Error)
+			}
+			return resp, nil
+		}
+
+		c.closeSession()
+		if reconnected || err == ErrAuthFailed {
+			return Response{}, err
+		}
+	}
+}
+
+func (c *Client) connect() error {
+	network, address := parseAddr(c.addr)
+	conn, err := net.DialTimeout(network, address, c.timeout)
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	sess, err := clientHandshake(conn, c.authKey)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	c.sess = sess
+	return nil
+}
+
+func (c *Client) roundTrip(r Request) (Response, error) {
+	c.sess.conn.SetDeadline(time.Now().Add(c.timeout))
+	if err := c.sess.send(encoder.Serialize(r)); err != nil {
+		return Response{}, err
+	}
+	body, err := c.sess.recv()
+	if err != nil {
+		return Response{}, err
+	}
+
+	var resp Response
+	if err := encoder.DeserializeRaw(body, &resp); err != nil {
+		return Response{}, err
+	}
+	return resp, nil
+}
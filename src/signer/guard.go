@@ -0,0 +1,126 @@
+package signer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/consensus/dpos"
+)
+
+// State is the last block signed, by its producer or with a prepare vote
+type State struct {
+	Height uint64 `json:"height"`
+	Slot   int64  `json:"slot"`
+	Hash   string `json:"hash"`
+}
+
+// Guard refuses to sign a block which conflicts with the blocks signed before, also across
+// restarts. The blocks are ordered by their slot and height, a block is signed if it is after the
+// last one or is the last one signed again, so a height signed already is signed again in a later
+// slot only, after a view change. The file is read again before every signature, a standby node
+// sharing the file with the active one does not sign what the active one signed.
+type Guard struct {
+	path  string
+	last  State
+	mutex sync.Mutex
+}
+
+// LoadGuard reads the last signed block from the file, the file is created by the first signature
+func LoadGuard(path string) (*Guard, error) {
+	g := &Guard{path: path}
+	if err := g.load(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// load reads the last signed block from the file if it exists
+func (g *Guard) load() error {
+	data, err := ioutil.ReadFile(g.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &g.last); err != nil {
+		return fmt.Errorf("invalid sign state file %s: %v", g.path, err)
+	}
+	return nil
+}
+
+// Slot returns the slot of the block time
+func Slot(time uint64) int64 {
+	return int64(time) / dpos.BlockInterval()
+}
+
+// Last returns the last block signed
+func (g *Guard) Last() State {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.last
+}
+
+// Sign records the block about to be signed, the file is synced to disk before it returns.
+// Returns an error if the block conflicts with the last one signed.
+func (g *Guard) Sign(height uint64, slot int64, hash cipher.SHA256) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if err := g.load(); err != nil {
+		return err
+	}
+	next := State{Height: height, Slot: slot, Hash: hash.Hex()}
+	if next == g.last {
+		return nil
+	}
+	if slot < g.last.Slot || (slot == g.last.Slot && height <= g.last.Height) {
+		return fmt.Errorf("refusing to sign block %s at height %d slot %d, block %s at height %d slot %d was signed",
+			next.Hash, height, slot, g.last.Hash, g.last.Height, g.last.Slot)
+	}
+
+	if err := writeFileSync(g.path, next); err != nil {
+		return fmt.Errorf("save sign state failed: %v", err)
+	}
+	g.last = next
+	return nil
+}
+
+// writeFileSync replaces the file by the json of the value, the data and the rename are synced to disk
+func writeFileSync(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,62 @@
+package signer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+func TestGuard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signstate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sign_state.json")
+
+	g, err := LoadGuard(path)
+	require.NoError(t, err)
+	require.Equal(t, State{}, g.Last())
+
+	a := testutil.RandSHA256(t)
+	b := testutil.RandSHA256(t)
+	conflict := func(hash cipher.SHA256, height uint64, slot int64) string {
+		return fmt.Sprintf("refusing to sign block %s at height %d slot %d, block %s at height 5 slot 10 was signed",
+			hash.Hex(), height, slot, a.Hex())
+	}
+
+	require.NoError(t, g.Sign(5, 10, a))
+	// the same block is signed again
+	require.NoError(t, g.Sign(5, 10, a))
+	// another block of the height and slot, and the blocks before it, are not signed
+	testutil.RequireError(t, g.Sign(5, 10, b), conflict(b, 5, 10))
+	testutil.RequireError(t, g.Sign(4, 10, b), conflict(b, 4, 10))
+	testutil.RequireError(t, g.Sign(6, 9, b), conflict(b, 6, 9))
+
+	// the state survives a restart
+	g, err = LoadGuard(path)
+	require.NoError(t, err)
+	require.Equal(t, State{Height: 5, Slot: 10, Hash: a.Hex()}, g.Last())
+	testutil.RequireError(t, g.Sign(5, 10, b), conflict(b, 5, 10))
+
+	// a standby sharing the file sees the blocks the active node signed
+	standby, err := LoadGuard(path)
+	require.NoError(t, err)
+	require.NoError(t, g.Sign(6, 11, b))
+	err = standby.Sign(6, 11, a)
+	require.Error(t, err)
+	require.Equal(t, State{Height: 6, Slot: 11, Hash: b.Hex()}, standby.Last())
+
+	// the height is signed again in a later slot after a view change
+	require.NoError(t, standby.Sign(6, 12, a))
+	require.NoError(t, g.Sign(7, 12, b))
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("{"), 0600))
+	_, err = LoadGuard(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,231 @@
+package signer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/samoslab/samos/src/cipher"
+)
+
+// The protocol authenticates both ends with a key shared by the node and the signer. On a new
+// connection the server sends a nonce, the client answers with its nonce and a MAC of both, the
+// server proves it knows the key with a MAC of both too. Each frame that follows is the encoded
+// Request or Response and a MAC of it, its direction and its sequence number with the session
+// key derived from the nonces, so frames are neither forged nor replayed.
+
+const (
+	nonceSize = 32
+	macSize   = sha256.Size
+	// maxFrameSize is the limit of a frame, a request carries a block header or a trust list
+	maxFrameSize = 1 << 20
+	// MinAuthKeySize is the shortest key shared by the node and the signer
+	MinAuthKeySize = 16
+	// DefaultTimeout is how long a request or the handshake may take
+	DefaultTimeout = 5 * time.Second
+)
+
+var (
+	// ErrAuthFailed is returned if the other end does not know the shared key or a frame was altered
+	ErrAuthFailed = errors.New("signer authentication failed")
+)
+
+// Response is the answer of a Server to a Request
+type Response struct {
+	Sig          cipher.Sig
+	PubKey       cipher.PubKey // KindPubKeys
+	MasterPubKey cipher.PubKey // KindPubKeys, empty if the signer has no master key
+	Error        string
+}
+
+// LoadAuthKey reads the hex encoded key shared by the node and the signer from the file
+func LoadAuthKey(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth key file %s: %v", path, err)
+	}
+	if len(key) < MinAuthKeySize {
+		return nil, fmt.Errorf("auth key of %s is shorter than %d bytes", path, MinAuthKeySize)
+	}
+	return key, nil
+}
+
+// NewAuthKey returns a random hex encoded key to share by the node and the signer
+func NewAuthKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// parseAddr splits the address into the network and the address to dial,
+// unix:/path is a unix socket, any other address is a tcp host:port
+func parseAddr(addr string) (network, address string) {
+	if strings.HasPrefix(addr, "unix:") {
+		return "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	return "tcp", addr
+}
+
+func mac(key []byte, parts ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+func writeFrame(w io.Writer, data []byte) error {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+	if _, err := w.Write(append(size[:], data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds %d", n, maxFrameSize)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// session is an authenticated connection
+type session struct {
+	conn    net.Conn
+	key     []byte
+	out, in byte // direction tags of the frames sent and received
+	sendSeq uint64
+	recvSeq uint64
+}
+
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// clientHandshake authenticates the connection to a server
+func clientHandshake(conn net.Conn, authKey []byte) (*session, error) {
+	serverNonce, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(serverNonce) != nonceSize {
+		return nil, ErrAuthFailed
+	}
+	clientNonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	proof := mac(authKey, []byte("client"), serverNonce, clientNonce)
+	if err := writeFrame(conn, append(clientNonce, proof...)); err != nil {
+		return nil, err
+	}
+
+	serverProof, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(serverProof, mac(authKey, []byte("server"), serverNonce, clientNonce)) {
+		return nil, ErrAuthFailed
+	}
+
+	return &session{
+		conn: conn,
+		key:  mac(authKey, []byte("session"), serverNonce, clientNonce),
+		out:  'c',
+		in:   's',
+	}, nil
+}
+
+// serverHandshake authenticates the connection of a client
+func serverHandshake(conn net.Conn, authKey []byte) (*session, error) {
+	serverNonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFrame(conn, serverNonce); err != nil {
+		return nil, err
+	}
+
+	data, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != nonceSize+macSize {
+		return nil, ErrAuthFailed
+	}
+	clientNonce, proof := data[:nonceSize], data[nonceSize:]
+	if !hmac.Equal(proof, mac(authKey, []byte("client"), serverNonce, clientNonce)) {
+		return nil, ErrAuthFailed
+	}
+
+	if err := writeFrame(conn, mac(authKey, []byte("server"), serverNonce, clientNonce)); err != nil {
+		return nil, err
+	}
+
+	return &session{
+		conn: conn,
+		key:  mac(authKey, []byte("session"), serverNonce, clientNonce),
+		out:  's',
+		in:   'c',
+	}, nil
+}
+
+func seqBytes(seq uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], seq)
+	return b[:]
+}
+
+// send writes the frame of the body
+func (s *session) send(body []byte) error {
+	m := mac(s.key, []byte{s.out}, seqBytes(s.sendSeq), body)
+	s.sendSeq++
+	return writeFrame(s.conn, append(body, m...))
+}
+
+// recv reads the body of the next frame
+func (s *session) recv() ([]byte, error) {
+	data, err := readFrame(s.conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < macSize {
+		return nil, ErrAuthFailed
+	}
+	body, m := data[:len(data)-macSize], data[len(data)-macSize:]
+	if !hmac.Equal(m, mac(s.key, []byte{s.in}, seqBytes(s.recvSeq), body)) {
+		return nil, ErrAuthFailed
+	}
+	s.recvSeq++
+	return body, nil
+}
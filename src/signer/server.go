@@ -0,0 +1,160 @@
+package signer
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/samoslab/samos/src/cipher/encoder"
+	"github.com/samoslab/samos/src/util/logging"
+)
+
+var logger = logging.MustGetLogger("signer")
+
+// Server serves the signature requests of the nodes knowing the shared key
+type Server struct {
+	signer   Signer
+	authKey  []byte
+	timeout  time.Duration
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	mutex    sync.Mutex
+}
+
+// NewServer creates a server of the signer, the clients authenticate with the key
+func NewServer(s Signer, authKey []byte) *Server {
+	return &Server{
+		signer:  s,
+		authKey: authKey,
+		timeout: DefaultTimeout,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen listens at the address, unix:/path for a unix socket or host:port. A unix socket
+// left by a previous signer is replaced, only its owner may connect.
+func Listen(addr string) (net.Listener, error) {
+	network, address := parseAddr(addr)
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+
+	if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(address, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve accepts the connections of the listener until Close is called
+func (s *Server) Serve(l net.Listener) error {
+	s.mutex.Lock()
+	s.listener = l
+	s.mutex.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			closed := s.listener == nil
+			s.mutex.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mutex.Lock()
+		s.conns[conn] = struct{}{}
+		s.mutex.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// Close stops accepting connections, closes the open ones and waits for their requests
+func (s *Server) Close() {
+	s.mutex.Lock()
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+
+	conn.SetDeadline(time.Now().Add(s.timeout))
+	sess, err := serverHandshake(conn, s.authKey)
+	if err != nil {
+		logger.Warningf("Signer client %s failed to authenticate: %v", conn.RemoteAddr(), err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	for {
+		body, err := sess.recv()
+		if err != nil {
+			if err == ErrAuthFailed {
+				logger.Warningf("Signer client %s sent an invalid request", conn.RemoteAddr())
+			}
+			return
+		}
+
+		var req Request
+		var resp Response
+		if err := encoder.DeserializeRaw(body, &req); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp = s.handle(req)
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(s.timeout))
+		if err := sess.send(encoder.Serialize(resp)); err != nil {
+			return
+		}
+	}
+}
+
+// handle signs the request
+func (s *Server) handle(req Request) Response {
+	if req.Kind == KindPubKeys {
+		resp := Response{PubKey: s.signer.PubKey()}
+		if master, ok := s.signer.MasterPubKey(); ok {
+			resp.MasterPubKey = master
+		}
+		return resp
+	}
+
+	sig, err := s.signer.Sign(req)
+	if err != nil {
+		logger.Warningf("Refused to sign %v request: %v", req.Kind, err)
+		return Response{Error: err.Error()}
+	}
+	logger.Debugf("Signed %v request", req.Kind)
+	return Response{Sig: sig}
+}
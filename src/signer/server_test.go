@@ -0,0 +1,115 @@
+package signer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+func startTestServer(t *testing.T, addr string, s Signer, authKey []byte) *Server {
+	l, err := Listen(addr)
+	require.NoError(t, err)
+	srv := NewServer(s, authKey)
+	go srv.Serve(l)
+	return srv
+}
+
+func TestClientServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	addr := "unix:" + filepath.Join(dir, "signer.sock")
+
+	guard, err := LoadGuard(filepath.Join(dir, "sign_state.json"))
+	require.NoError(t, err)
+	pk, sk := cipher.GenerateKeyPair()
+	authKey := testutil.RandBytes(t, 32)
+
+	srv := startTestServer(t, addr, NewLocal(func() cipher.SecKey { return sk }, cipher.SecKey{}, guard), authKey)
+
+	// a client without the key is refused
+	_, err = Dial(addr, testutil.RandBytes(t, 32))
+	require.Error(t, err)
+	_, err = Dial(addr, authKey[:8])
+	testutil.RequireError(t, err, "auth key is shorter than 16 bytes")
+
+	c, err := Dial(addr, authKey)
+	require.NoError(t, err)
+	defer c.Close()
+	require.Equal(t, pk, c.PubKey())
+	_, ok := c.MasterPubKey()
+	require.False(t, ok)
+
+	h := coin.BlockHeader{BkSeq: 3, Time: 120}
+	sig, err := c.Sign(BlockRequest(h))
+	require.NoError(t, err)
+	require.NoError(t, cipher.VerifySignature(pk, sig, h.Hash()))
+
+	// the signer enforces the double sign rules and the master key
+	_, err = c.Sign(BlockRequest(coin.BlockHeader{BkSeq: 3, Time: 121}))
+	require.Error(t, err)
+	_, err = c.Sign(AgreeNumRequest(3))
+	testutil.RequireError(t, err, "no master key")
+
+	hash := testutil.RandSHA256(t)
+	seq, view := uint64(4), uint64(1)
+	sig, err = c.Sign(ViewChangeRequest(seq, view))
+	require.NoError(t, err)
+	_, err = c.Sign(CommitRequest(hash))
+	require.NoError(t, err)
+
+	// the client connects again to a restarted signer
+	srv.Close()
+	_, err = c.Sign(CommitRequest(hash))
+	require.Error(t, err)
+	srv = startTestServer(t, addr, NewLocal(func() cipher.SecKey { return sk }, cipher.SecKey{}, guard), authKey)
+	defer srv.Close()
+	_, err = c.Sign(CommitRequest(hash))
+	require.NoError(t, err)
+	_, err = c.Sign(PrepareRequest(h))
+	require.NoError(t, err)
+}
+
+func TestSessionRejectsAlteredFrames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	addr := "unix:" + filepath.Join(dir, "signer.sock")
+
+	_, sk := cipher.GenerateKeyPair()
+	authKey := testutil.RandBytes(t, 32)
+	srv := startTestServer(t, addr, NewLocal(func() cipher.SecKey { return sk }, cipher.SecKey{}, nil), authKey)
+	defer srv.Close()
+
+	c, err := Dial(addr, authKey)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Sign(CommitRequest(testutil.RandSHA256(t)))
+	require.NoError(t, err)
+
+	// a frame with an old sequence number is refused and the connection closed,
+	// the client sends the request again in a new session
+	c.mutex.Lock()
+	sess := c.sess
+	sess.sendSeq = 0
+	c.mutex.Unlock()
+	_, err = c.Sign(CommitRequest(testutil.RandSHA256(t)))
+	require.NoError(t, err)
+	require.True(t, sess != c.sess)
+	require.Equal(t, uint64(1), c.sess.sendSeq)
+
+	// a frame altered on the way is refused
+	c.mutex.Lock()
+	c.sess.key = testutil.RandBytes(t, 32)
+	c.mutex.Unlock()
+	_, err = c.roundTrip(CommitRequest(testutil.RandSHA256(t)))
+	require.Error(t, err)
+}
@@ -0,0 +1,233 @@
+// Package signer signs the blocks and the votes of a validator. The keys are kept in process
+// by Local, or by a signer process on a separate host which a Client reaches over a socket.
+// A signer is asked to sign the blocks and the messages, not their hashes, so it checks
+// what it signs and refuses to sign two conflicting blocks, see Guard.
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/daemon/gnet"
+)
+
+// Kind is the kind of a signature request
+type Kind uint8
+
+const (
+	// KindPubKeys asks the public keys of the signer, it is answered by a Server without a signature
+	KindPubKeys Kind = iota
+	// KindBlock signs the header of a block produced by the validator
+	KindBlock
+	// KindPrepare signs the prepare vote for the header of a pending block
+	KindPrepare
+	// KindCommit signs the commit vote for the hash of a pending block
+	KindCommit
+	// KindViewChange signs the vote to move to a view of a height
+	KindViewChange
+	// KindCoinbase signs the coinbase transaction of the outputs in the block after a hash
+	KindCoinbase
+	// KindTrustList signs the trust list with the master key
+	KindTrustList
+	// KindAgreeNum signs the agree number with the master key
+	KindAgreeNum
+	// KindIdentity proves the trust key of the validator to a peer in the handshake of a connection
+	KindIdentity
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindPubKeys:
+		return "pubkeys"
+	case KindBlock:
+		return "block"
+	case KindPrepare:
+		return "prepare"
+	case KindCommit:
+		return "commit"
+	case KindViewChange:
+		return "view-change"
+	case KindCoinbase:
+		return "coinbase"
+	case KindTrustList:
+		return "trust-list"
+	case KindAgreeNum:
+		return "agree-num"
+	case KindIdentity:
+		return "identity"
+	default:
+		return fmt.Sprintf("kind %d", uint8(k))
+	}
+}
+
+// Request is what a signer is asked to sign, the fields of its kind are set
+type Request struct {
+	Kind     Kind
+	Header   coin.BlockHeader         // KindBlock, KindPrepare
+	Hash     cipher.SHA256            // KindCommit, the previous block of KindCoinbase, the session of KindIdentity
+	Seq      uint64                   // KindViewChange
+	View     uint64                   // KindViewChange
+	Outputs  []coin.TransactionOutput // KindCoinbase
+	Trust    []cipher.PubKey          // KindTrustList
+	AgreeNum uint64                   // KindAgreeNum
+}
+
+// BlockRequest asks to sign the block header as its producer
+func BlockRequest(h coin.BlockHeader) Request {
+	return Request{Kind: KindBlock, Header: h}
+}
+
+// PrepareRequest asks to prepare the pending block of the header
+func PrepareRequest(h coin.BlockHeader) Request {
+	return Request{Kind: KindPrepare, Header: h}
+}
+
+// CommitRequest asks to commit the pending block of the hash
+func CommitRequest(hash cipher.SHA256) Request {
+	return Request{Kind: KindCommit, Hash: hash}
+}
+
+// ViewChangeRequest asks to vote for the view of the height
+func ViewChangeRequest(seq, view uint64) Request {
+	return Request{Kind: KindViewChange, Seq: seq, View: view}
+}
+
+// CoinbaseRequest asks to sign the coinbase transaction of the outputs in the block after prevHash
+func CoinbaseRequest(prevHash cipher.SHA256, outs []coin.TransactionOutput) Request {
+	return Request{Kind: KindCoinbase, Hash: prevHash, Outputs: outs}
+}
+
+// TrustListRequest asks the master to sign the trust list
+func TrustListRequest(trust []cipher.PubKey) Request {
+	return Request{Kind: KindTrustList, Trust: trust}
+}
+
+// AgreeNumRequest asks the master to sign the agree number
+func AgreeNumRequest(num int) Request {
+	return Request{Kind: KindAgreeNum, AgreeNum: uint64(num)}
+}
+
+// IdentityRequest asks to prove the trust key to the peer of the handshake session
+func IdentityRequest(session cipher.SHA256) Request {
+	return Request{Kind: KindIdentity, Hash: session}
+}
+
+// TrustListHash returns the hash the master signs for the trust list
+func TrustListHash(trust []cipher.PubKey) cipher.SHA256 {
+	data := []byte{}
+	for _, pk := range trust {
+		data = append(data, pk[:]...)
+	}
+	return cipher.SumSHA256(data)
+}
+
+// AgreeNumHash returns the hash the master signs for the agree number
+func AgreeNumHash(num int) cipher.SHA256 {
+	return cipher.SumSHA256([]byte(strconv.Itoa(num)))
+}
+
+// SignHash returns the hash signed for the request
+func (r Request) SignHash() (cipher.SHA256, error) {
+	switch r.Kind {
+	case KindBlock:
+		return r.Header.Hash(), nil
+	case KindPrepare:
+		return pbft.PrepareHash(r.Header.Hash()), nil
+	case KindCommit:
+		return pbft.CommitHash(r.Hash), nil
+	case KindViewChange:
+		return pbft.ViewChangeHash(r.Seq, r.View), nil
+	case KindCoinbase:
+		if len(r.Outputs) == 0 {
+			return cipher.SHA256{}, errors.New("coinbase transaction without outputs")
+		}
+		return coin.CoinbaseSignHash(r.Hash, r.Outputs), nil
+	case KindTrustList:
+		return TrustListHash(r.Trust), nil
+	case KindAgreeNum:
+		return AgreeNumHash(int(r.AgreeNum)), nil
+	case KindIdentity:
+		return gnet.IdentityHash(r.Hash), nil
+	default:
+		return cipher.SHA256{}, fmt.Errorf("%v is not signed", r.Kind)
+	}
+}
+
+// isMaster returns true if the request is signed by the master key
+func (r Request) isMaster() bool {
+	return r.Kind == KindTrustList || r.Kind == KindAgreeNum
+}
+
+// Signer signs the requests of a validator with its trust key, and of the genesis node with its master key
+type Signer interface {
+	// PubKey returns the trust key
+	PubKey() cipher.PubKey
+	// MasterPubKey returns the master key, ok is false if the signer has none
+	MasterPubKey() (pubkey cipher.PubKey, ok bool)
+	// Sign signs the request
+	Sign(r Request) (cipher.Sig, error)
+}
+
+// Local signs with the keys in process
+type Local struct {
+	trust  func() cipher.SecKey
+	master cipher.SecKey
+	guard  *Guard
+}
+
+// NewLocal creates a signer of the keys, trust returns the current trust key. The blocks are
+// checked against the guard unless it is nil, master is empty unless this is the genesis node.
+func NewLocal(trust func() cipher.SecKey, master cipher.SecKey, guard *Guard) *Local {
+	return &Local{
+		trust:  trust,
+		master: master,
+		guard:  guard,
+	}
+}
+
+// PubKey returns the trust key
+func (l *Local) PubKey() cipher.PubKey {
+	sk := l.trust()
+	if sk == (cipher.SecKey{}) {
+		return cipher.PubKey{}
+	}
+	return cipher.PubKeyFromSecKey(sk)
+}
+
+// MasterPubKey returns the master key
+func (l *Local) MasterPubKey() (cipher.PubKey, bool) {
+	if l.master == (cipher.SecKey{}) {
+		return cipher.PubKey{}, false
+	}
+	return cipher.PubKeyFromSecKey(l.master), true
+}
+
+// Sign signs the request, a block or a prepare vote is recorded by the guard first
+func (l *Local) Sign(r Request) (cipher.Sig, error) {
+	hash, err := r.SignHash()
+	if err != nil {
+		return cipher.Sig{}, err
+	}
+
+	if r.isMaster() {
+		if l.master == (cipher.SecKey{}) {
+			return cipher.Sig{}, errors.New("no master key")
+		}
+		return cipher.SignHash(hash, l.master), nil
+	}
+
+	sk := l.trust()
+	if sk == (cipher.SecKey{}) {
+		return cipher.Sig{}, errors.New("no trust key")
+	}
+	if l.guard != nil && (r.Kind == KindBlock || r.Kind == KindPrepare) {
+		if err := l.guard.Sign(r.Header.BkSeq, Slot(r.Header.Time), r.Header.Hash()); err != nil {
+			return cipher.Sig{}, err
+		}
+	}
+	return cipher.SignHash(hash, sk), nil
+}
@@ -0,0 +1,94 @@
+package signer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/daemon/gnet"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+func TestRequestSignHash(t *testing.T) {
+	h := coin.BlockHeader{BkSeq: 3, Time: 120}
+	hash := testutil.RandSHA256(t)
+	pk, _ := cipher.GenerateKeyPair()
+	outs := []coin.TransactionOutput{{Address: testutil.MakeAddress(), Coins: 1e6}}
+
+	cases := []struct {
+		req  Request
+		hash cipher.SHA256
+	}{
+		{BlockRequest(h), h.Hash()},
+		{PrepareRequest(h), pbft.PrepareHash(h.Hash())},
+		{CommitRequest(hash), pbft.CommitHash(hash)},
+		{ViewChangeRequest(3, 2), pbft.ViewChangeHash(3, 2)},
+		{CoinbaseRequest(hash, outs), coin.CoinbaseSignHash(hash, outs)},
+		{TrustListRequest([]cipher.PubKey{pk}), cipher.SumSHA256(pk[:])},
+		{AgreeNumRequest(3), cipher.SumSHA256([]byte("3"))},
+		{IdentityRequest(hash), gnet.IdentityHash(hash)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.req.Kind.String(), func(t *testing.T) {
+			h, err := tc.req.SignHash()
+			require.NoError(t, err)
+			require.Equal(t, tc.hash, h)
+		})
+	}
+
+	_, err := Request{Kind: KindPubKeys}.SignHash()
+	testutil.RequireError(t, err, "pubkeys is not signed")
+	_, err = CoinbaseRequest(hash, nil).SignHash()
+	testutil.RequireError(t, err, "coinbase transaction without outputs")
+}
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	guard, err := LoadGuard(filepath.Join(dir, "sign_state.json"))
+	require.NoError(t, err)
+
+	pk, sk := cipher.GenerateKeyPair()
+	masterPk, masterSk := cipher.GenerateKeyPair()
+
+	l := NewLocal(func() cipher.SecKey { return sk }, cipher.SecKey{}, guard)
+	require.Equal(t, pk, l.PubKey())
+	_, ok := l.MasterPubKey()
+	require.False(t, ok)
+	_, err = l.Sign(TrustListRequest([]cipher.PubKey{pk}))
+	testutil.RequireError(t, err, "no master key")
+
+	// the blocks are checked by the guard
+	h := coin.BlockHeader{BkSeq: 3, Time: 120}
+	sig, err := l.Sign(BlockRequest(h))
+	require.NoError(t, err)
+	require.NoError(t, cipher.VerifySignature(pk, sig, h.Hash()))
+	_, err = l.Sign(PrepareRequest(h))
+	require.NoError(t, err)
+	_, err = l.Sign(PrepareRequest(coin.BlockHeader{BkSeq: 3, Time: 121}))
+	require.Error(t, err)
+	require.Equal(t, State{Height: 3, Slot: 12, Hash: h.Hash().Hex()}, guard.Last())
+
+	// the votes are not
+	hash := testutil.RandSHA256(t)
+	sig, err = l.Sign(CommitRequest(hash))
+	require.NoError(t, err)
+	require.NoError(t, cipher.VerifySignature(pk, sig, pbft.CommitHash(hash)))
+
+	l = NewLocal(func() cipher.SecKey { return cipher.SecKey{} }, masterSk, nil)
+	master, ok := l.MasterPubKey()
+	require.True(t, ok)
+	require.Equal(t, masterPk, master)
+	sig, err = l.Sign(AgreeNumRequest(3))
+	require.NoError(t, err)
+	require.NoError(t, cipher.VerifySignature(masterPk, sig, AgreeNumHash(3)))
+	_, err = l.Sign(BlockRequest(h))
+	testutil.RequireError(t, err, "no trust key")
+}
@@ -51,6 +51,7 @@ type chainStore interface {
 	GetBlockBySeq(seq uint64) (*coin.SignedBlock, error)
 	UnspentPool() blockdb.UnspentPool
 	GetGenesisBlock() *coin.SignedBlock
+	SyncCache() error
 }
 
 // BlockListener notify the register when new block is appended to the chain
@@ -67,6 +68,13 @@ type Blockchain struct {
 	// node will throw the error and return.
 	arbitrating bool
 	store       chainStore
+	// versioned validator sets, blocks are verified against the set active at their height
+	sets ValidatorSetGetter
+}
+
+// ValidatorSetGetter returns the validator set active at a block height
+type ValidatorSetGetter interface {
+	GetValidatorSet(height uint64) (blockdb.ValidatorSet, bool, error)
 }
 
 // Option represents the option when creating the blockchain
@@ -109,6 +117,13 @@ func Arbitrating(enable bool) Option {
 	}
 }
 
+// ValidatorSets option to verify block signatures against the validator set active at the block height
+func ValidatorSets(sets ValidatorSetGetter) Option {
+	return func(bc *Blockchain) {
+		bc.sets = sets
+	}
+}
+
 // GetGenesisBlock returns genesis block
 func (bc *Blockchain) GetGenesisBlock() *coin.SignedBlock {
 	return bc.store.GetGenesisBlock()
@@ -131,11 +146,14 @@ func (bc *Blockchain) processBlock(b coin.SignedBlock) (coin.SignedBlock, error)
 				return coin.SignedBlock{}, err
 			}
 
-			txns, err := bc.processTransactions(b.Body.Transactions)
-			if err != nil {
-				return coin.SignedBlock{}, err
+			// an empty heartbeat block spends nothing
+			if len(b.Body.Transactions) > 0 {
+				txns, err := bc.processTransactions(b.Body.Transactions)
+				if err != nil {
+					return coin.SignedBlock{}, err
+				}
+				b.Body.Transactions = txns
 			}
-			b.Body.Transactions = txns
 
 			if err := bc.verifyUxHash(b.Block); err != nil {
 				return coin.SignedBlock{}, err
@@ -221,6 +239,20 @@ func (bc Blockchain) NewBlock(txns coin.Transactions, currentTime uint64) (*coin
 	return b, nil
 }
 
+// NewEmptyBlock creates a heartbeat Block without transactions
+func (bc Blockchain) NewEmptyBlock(currentTime uint64) (*coin.Block, error) {
+	if currentTime <= bc.Time() {
+		return nil, errors.New("Time can only move forward")
+	}
+
+	head, err := bc.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	return coin.NewEmptyBlock(head.Block, currentTime, bc.Unspent().GetUxHash()), nil
+}
+
 // ExecuteBlockWithTx attempts to append block to blockchain with *bolt.Tx
 func (bc *Blockchain) ExecuteBlockWithTx(tx *bolt.Tx, sb *coin.SignedBlock) error {
 	if bc.Len() > 0 {
@@ -423,6 +455,62 @@ func (bc Blockchain) GetLastBlocks(num uint64) []coin.SignedBlock {
 
 /* Private */
 
+// processTransactions validates the transactions of a block, see processSpends. The evidence
+// transactions and a coinbase transaction at the end of the block are kept there, their form
+// is checked here, the evidence and the rewards the coinbase pays by the visor.
+func (bc Blockchain) processTransactions(txs coin.Transactions) (coin.Transactions, error) {
+	n := len(txs)
+	hasCoinbase := n > 0 && txs[n-1].Type == coin.TxTypeCoinbase
+	if hasCoinbase {
+		n--
+	}
+	spends := n
+	for spends > 0 && txs[spends-1].Type == coin.TxTypeEvidence {
+		spends--
+	}
+	if spends == len(txs) {
+		return bc.processSpends(txs)
+	}
+
+	// a heartbeat block may have no spends
+	txns := coin.Transactions{}
+	if spends > 0 {
+		var err error
+		txns, err = bc.processSpends(txs[:spends])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, txn := range txs[spends:n] {
+		if _, _, err := txn.EvidenceHeaders(); err != nil {
+			return nil, NewErrTxnViolatesHardConstraint(err)
+		}
+		txns = append(txns, txn)
+	}
+	if !hasCoinbase {
+		return txns, nil
+	}
+
+	coinbase := txs[n]
+	head, err := bc.Head()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := coinbase.VerifyCoinbase(head.HashHeader()); err != nil {
+		return nil, NewErrTxnViolatesHardConstraint(err)
+	}
+	if DebugLevel1 {
+		for _, ux := range coin.CreateUnspents(head.Head, coinbase) {
+			if bc.Unspent().Contains(ux.Hash()) {
+				return nil, errors.New("Output hash is in the UnspentPool")
+			}
+		}
+	}
+
+	return append(txns, coinbase), nil
+}
+
 // Validates a set of Transactions, individually, against each other and
 // against the Blockchain.  If firstFail is true, it will return an error
 // as soon as it encounters one.  Else, it will return an array of
@@ -433,7 +521,7 @@ func (bc Blockchain) GetLastBlocks(num uint64) []coin.SignedBlock {
 // TODO:
 //  - move arbitration to visor
 //  - blockchain should have strict checking
-func (bc Blockchain) processTransactions(txs coin.Transactions) (coin.Transactions, error) {
+func (bc Blockchain) processSpends(txs coin.Transactions) (coin.Transactions, error) {
 	// copy txs so that the following code won't modify the origianl txs
 	txns := make(coin.Transactions, len(txs))
 	copy(txns, txs)
@@ -645,7 +733,18 @@ func (bc *Blockchain) verifyBlockSig(seq uint64) error {
 		return err
 	}
 
-	return sb.VerifySignature(bc.pubkey)
+	pubkeys := bc.pubkey
+	if bc.sets != nil {
+		set, ok, err := bc.sets.GetValidatorSet(seq)
+		if err != nil {
+			return err
+		}
+		if ok {
+			pubkeys = set.Pubkeys
+		}
+	}
+
+	return sb.VerifySignature(pubkeys)
 }
 
 // VerifyBlockHeader Returns error if the BlockHeader is not valid
@@ -689,3 +788,8 @@ func (bc *Blockchain) Notify(b coin.Block) {
 func (bc *Blockchain) UpdateDB(f func(t *bolt.Tx) error) error {
 	return bc.db.Update(f)
 }
+
+// SyncCache reloads the caches of the chain from the db after a block was rolled back
+func (bc *Blockchain) SyncCache() error {
+	return bc.store.SyncCache()
+}
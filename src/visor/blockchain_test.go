@@ -127,6 +127,10 @@ func (fcs fakeChainStore) GetBlockBySeq(seq uint64) (*coin.SignedBlock, error) {
 	return &fcs.blocks[seq], nil
 }
 
+func (fcs fakeChainStore) SyncCache() error {
+	return nil
+}
+
 func (fcs fakeChainStore) UnspentPool() blockdb.UnspentPool {
 	return nil
 }
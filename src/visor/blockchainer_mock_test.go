@@ -249,6 +249,33 @@ func (m *BlockchainerMock) NewBlock(p0 coin.Transactions, p1 uint64) (*coin.Bloc
 
 }
 
+// NewEmptyBlock mocked method
+func (m *BlockchainerMock) NewEmptyBlock(p0 uint64) (*coin.Block, error) {
+
+	ret := m.Called(p0)
+
+	var r0 *coin.Block
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case *coin.Block:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	var r1 error
+	switch res := ret.Get(1).(type) {
+	case nil:
+	case error:
+		r1 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0, r1
+
+}
+
 // Notify mocked method
 func (m *BlockchainerMock) Notify(p0 coin.Block) {
 
@@ -256,6 +283,24 @@ func (m *BlockchainerMock) Notify(p0 coin.Block) {
 
 }
 
+// SyncCache mocked method
+func (m *BlockchainerMock) SyncCache() error {
+
+	ret := m.Called()
+
+	var r0 error
+	switch res := ret.Get(0).(type) {
+	case nil:
+	case error:
+		r0 = res
+	default:
+		panic(fmt.Sprintf("unexpected type: %v", res))
+	}
+
+	return r0
+
+}
+
 // Time mocked method
 func (m *BlockchainerMock) Time() uint64 {
 
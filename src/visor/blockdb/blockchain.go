@@ -75,6 +75,7 @@ type UnspentPool interface {
 	GetUnspentsOfAddrs(addrs []cipher.Address) coin.AddressUxOuts
 	ProcessBlock(*coin.SignedBlock) bucket.TxHandler
 	Contains(cipher.SHA256) bool
+	SyncCache() error // reloads the cache from the db
 }
 
 // Walker function for go through blockchain
@@ -283,6 +284,20 @@ func (bc *Blockchain) syncCache() error {
 	return nil
 }
 
+// SyncCache reloads the caches of the head seq, the genesis block and the unspent outputs
+// from the db. The caches are ahead of the db when the transaction adding a block is rolled
+// back after the block was processed.
+func (bc *Blockchain) SyncCache() error {
+	bc.Lock()
+	bc.cache.genesisBlock = nil
+	bc.Unlock()
+
+	if err := bc.syncCache(); err != nil {
+		return err
+	}
+	return bc.unspent.SyncCache()
+}
+
 func (bc *Blockchain) getHeadSeqFromDB() uint64 {
 	if v := bc.meta.Get(headSeqKey); v != nil {
 		return bucket.Btoi(v)
@@ -165,6 +165,10 @@ func (fup fakeUnspentPool) ProcessBlock(b *coin.SignedBlock) bucket.TxHandler {
 	}
 }
 
+func (fup fakeUnspentPool) SyncCache() error {
+	return nil
+}
+
 func (fup fakeUnspentPool) Contains(h cipher.SHA256) bool {
 	_, ok := fup.outs[h]
 	return ok
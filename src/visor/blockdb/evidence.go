@@ -0,0 +1,148 @@
+package blockdb
+
+import (
+	"bytes"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/visor/bucket"
+)
+
+var evidenceBkt = []byte("validator_evidence")
+
+// SignedHeader is a block header with the signature of its producer
+type SignedHeader struct {
+	Header coin.BlockHeader
+	Sig    cipher.Sig
+}
+
+// Evidence proves that a validator signed two conflicting block headers
+type Evidence struct {
+	PubKey     cipher.PubKey
+	First      SignedHeader
+	Second     SignedHeader
+	ReportedAt uint64 // unix time the evidence was stored locally
+	// Height and epoch of the block which included the evidence, Height is 0 until a block includes it
+	Height uint64
+	Epoch  uint64
+}
+
+// NewEvidence creates Evidence, the headers are ordered by hash so that
+// the same pair of headers always makes the same evidence
+func NewEvidence(pubkey cipher.PubKey, a, b SignedHeader) Evidence {
+	ha := a.Header.Hash()
+	hb := b.Header.Hash()
+	if bytes.Compare(ha[:], hb[:]) > 0 {
+		a, b = b, a
+	}
+	return Evidence{
+		PubKey: pubkey,
+		First:  a,
+		Second: b,
+	}
+}
+
+// Key returns the key of the evidence, the hash of both header hashes
+func (e Evidence) Key() cipher.SHA256 {
+	return cipher.AddSHA256(e.First.Header.Hash(), e.Second.Header.Hash())
+}
+
+// Evidences stores the evidence of double signing validators
+type Evidences struct {
+	db        *bolt.DB
+	evidences *bucket.Bucket // evidence key -> Evidence
+}
+
+// NewEvidences create evidence bucket in blockdb if does not exist.
+func NewEvidences(db *bolt.DB) (*Evidences, error) {
+	evidences, err := bucket.New(evidenceBkt, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Evidences{
+		db:        db,
+		evidences: evidences,
+	}, nil
+}
+
+// Add stores the evidence, returns false if it is already stored
+func (ev *Evidences) Add(e Evidence) (bool, error) {
+	key := e.Key()
+	added := false
+	err := ev.db.Update(func(tx *bolt.Tx) error {
+		if ev.evidences.GetWithTx(tx, key[:]) != nil {
+			return nil
+		}
+		added = true
+		return ev.evidences.PutWithTx(tx, key[:], encoder.Serialize(e))
+	})
+	return added, err
+}
+
+// Has returns true if the evidence is stored
+func (ev *Evidences) Has(e Evidence) bool {
+	key := e.Key()
+	return ev.evidences.IsExist(key[:])
+}
+
+// IncludeWithTx records the evidence as included by the block of the height and the epoch,
+// returns false if a block included it already
+func (ev *Evidences) IncludeWithTx(tx *bolt.Tx, e Evidence, height, epoch uint64) (bool, error) {
+	key := e.Key()
+	if v := ev.evidences.GetWithTx(tx, key[:]); v != nil {
+		var stored Evidence
+		if err := encoder.DeserializeRaw(v, &stored); err != nil {
+			return false, err
+		}
+		if stored.Height != 0 {
+			return false, nil
+		}
+		e.ReportedAt = stored.ReportedAt
+	}
+	e.Height = height
+	e.Epoch = epoch
+	return true, ev.evidences.PutWithTx(tx, key[:], encoder.Serialize(e))
+}
+
+// IsIncluded returns true if a block included the evidence
+func (ev *Evidences) IsIncluded(e Evidence) (bool, error) {
+	key := e.Key()
+	v := ev.evidences.Get(key[:])
+	if v == nil {
+		return false, nil
+	}
+	var stored Evidence
+	if err := encoder.DeserializeRaw(v, &stored); err != nil {
+		return false, err
+	}
+	return stored.Height != 0, nil
+}
+
+// GetAll returns all stored evidence
+func (ev *Evidences) GetAll() (evidences []Evidence, err error) {
+	err = ev.db.View(func(tx *bolt.Tx) error {
+		evidences, err = ev.GetAllWithTx(tx)
+		return err
+	})
+	return
+}
+
+// GetAllWithTx returns all stored evidence with *bolt.Tx
+func (ev *Evidences) GetAllWithTx(tx *bolt.Tx) ([]Evidence, error) {
+	evidences := []Evidence{}
+	if err := ev.evidences.ForEachWithTx(tx, func(k, v []byte) error {
+		var e Evidence
+		if err := encoder.DeserializeRaw(v, &e); err != nil {
+			return err
+		}
+		evidences = append(evidences, e)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return evidences, nil
+}
@@ -0,0 +1,73 @@
+package blockdb
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+func TestEvidences(t *testing.T) {
+	db, close := testutil.PrepareDB(t)
+	defer close()
+	ev, err := NewEvidences(db)
+	require.NoError(t, err)
+
+	pk, sk := cipher.GenerateKeyPair()
+	a := coin.BlockHeader{BkSeq: 5, Time: 100}
+	b := coin.BlockHeader{BkSeq: 5, Time: 105}
+	sa := SignedHeader{Header: a, Sig: cipher.SignHash(a.Hash(), sk)}
+	sb := SignedHeader{Header: b, Sig: cipher.SignHash(b.Hash(), sk)}
+
+	// the order of the headers does not matter
+	e := NewEvidence(pk, sa, sb)
+	assert.Equal(t, e, NewEvidence(pk, sb, sa))
+	assert.Equal(t, e.Key(), NewEvidence(pk, sb, sa).Key())
+
+	assert.False(t, ev.Has(e))
+	added, err := ev.Add(e)
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.True(t, ev.Has(e))
+
+	e2 := e
+	e2.ReportedAt = 10
+	added, err = ev.Add(e2)
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	evidences, err := ev.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, []Evidence{e}, evidences)
+
+	// a block includes the evidence once
+	included, err := ev.IsIncluded(e)
+	require.NoError(t, err)
+	assert.False(t, included)
+	err = db.Update(func(tx *bolt.Tx) error {
+		ok, err := ev.IncludeWithTx(tx, e, 7, 2)
+		require.True(t, ok)
+		return err
+	})
+	require.NoError(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		ok, err := ev.IncludeWithTx(tx, e, 8, 2)
+		require.False(t, ok)
+		return err
+	})
+	require.NoError(t, err)
+
+	included, err = ev.IsIncluded(e)
+	require.NoError(t, err)
+	assert.True(t, included)
+	evidences, err = ev.GetAll()
+	require.NoError(t, err)
+	require.Len(t, evidences, 1)
+	assert.Equal(t, uint64(7), evidences[0].Height)
+	assert.Equal(t, uint64(2), evidences[0].Epoch)
+}
@@ -0,0 +1,142 @@
+package blockdb
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
+	"github.com/samoslab/samos/src/visor/bucket"
+)
+
+var (
+	governancePendingBkt = []byte("validator_governance_pending")
+	governanceActiveBkt  = []byte("validator_governance_active")
+)
+
+// GovernanceProposal is an approved validator set or quorum change
+type GovernanceProposal struct {
+	Type        uint8 // transaction type, coin.TxTypeValidatorSet or coin.TxTypeQuorum
+	Txid        cipher.SHA256
+	Height      uint64 // height of the block with the transaction
+	Epoch       uint64 // epoch of the block with the transaction
+	ActiveEpoch uint64 // epoch the change took effect, 0 while it is pending
+	Validators  []cipher.PubKey
+	Quorum      uint64
+	Approvals   []cipher.PubKey // validators which signed the transaction
+}
+
+// Governance stores the pending and the active governance changes, one of each transaction type
+type Governance struct {
+	db      *bolt.DB
+	pending *bucket.Bucket // type -> GovernanceProposal waiting for the next epoch
+	active  *bucket.Bucket // type -> GovernanceProposal in effect
+}
+
+// NewGovernance create governance buckets in blockdb if does not exist.
+func NewGovernance(db *bolt.DB) (*Governance, error) {
+	pending, err := bucket.New(governancePendingBkt, db)
+	if err != nil {
+		return nil, err
+	}
+	active, err := bucket.New(governanceActiveBkt, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Governance{
+		db:      db,
+		pending: pending,
+		active:  active,
+	}, nil
+}
+
+// ProposeWithTx records an approved change, it replaces the pending change of the same type
+func (gv *Governance) ProposeWithTx(tx *bolt.Tx, p GovernanceProposal) error {
+	p.ActiveEpoch = 0
+	return gv.pending.PutWithTx(tx, []byte{p.Type}, encoder.Serialize(p))
+}
+
+// ActivateWithTx puts the pending changes proposed before the epoch into effect,
+// returns the activated changes
+func (gv *Governance) ActivateWithTx(tx *bolt.Tx, epoch uint64) ([]GovernanceProposal, error) {
+	pending, err := proposalsWithTx(tx, gv.pending)
+	if err != nil {
+		return nil, err
+	}
+
+	activated := []GovernanceProposal{}
+	for _, p := range pending {
+		if p.Epoch >= epoch {
+			continue
+		}
+		if err := gv.pending.DeleteWithTx(tx, []byte{p.Type}); err != nil {
+			return nil, err
+		}
+		p.ActiveEpoch = epoch
+		if err := gv.active.PutWithTx(tx, []byte{p.Type}, encoder.Serialize(p)); err != nil {
+			return nil, err
+		}
+		activated = append(activated, p)
+	}
+	return activated, nil
+}
+
+// GetActive returns the change of the type in effect, ok is false if there is none
+func (gv *Governance) GetActive(txType uint8) (p GovernanceProposal, ok bool, err error) {
+	err = gv.db.View(func(tx *bolt.Tx) error {
+		p, ok, err = gv.GetActiveWithTx(tx, txType)
+		return err
+	})
+	return
+}
+
+// GetActiveWithTx returns the change of the type in effect with *bolt.Tx, ok is false if there is none
+func (gv *Governance) GetActiveWithTx(tx *bolt.Tx, txType uint8) (p GovernanceProposal, ok bool, err error) {
+	v := gv.active.GetWithTx(tx, []byte{txType})
+	if v == nil {
+		return GovernanceProposal{}, false, nil
+	}
+	if err := encoder.DeserializeRaw(v, &p); err != nil {
+		return GovernanceProposal{}, false, err
+	}
+	return p, true, nil
+}
+
+// GetPending returns the changes waiting for the next epoch, ordered by type
+func (gv *Governance) GetPending() (ps []GovernanceProposal, err error) {
+	err = gv.db.View(func(tx *bolt.Tx) error {
+		ps, err = proposalsWithTx(tx, gv.pending)
+		return err
+	})
+	return
+}
+
+// GetAllActive returns the changes in effect, ordered by type
+func (gv *Governance) GetAllActive() (ps []GovernanceProposal, err error) {
+	err = gv.db.View(func(tx *bolt.Tx) error {
+		ps, err = proposalsWithTx(tx, gv.active)
+		return err
+	})
+	return
+}
+
+func proposalsWithTx(tx *bolt.Tx, bkt *bucket.Bucket) ([]GovernanceProposal, error) {
+	b := tx.Bucket(bkt.Name)
+	if b == nil {
+		return nil, fmt.Errorf("bucket %s doesn't exist", bkt.Name)
+	}
+	ps := []GovernanceProposal{}
+	if err := b.ForEach(func(k, v []byte) error {
+		var p GovernanceProposal
+		if err := encoder.DeserializeRaw(v, &p); err != nil {
+			return err
+		}
+		ps = append(ps, p)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
@@ -0,0 +1,102 @@
+package blockdb
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+func TestGovernance(t *testing.T) {
+	db, close := testutil.PrepareDB(t)
+	defer close()
+	gv, err := NewGovernance(db)
+	require.NoError(t, err)
+
+	const (
+		setType    uint8 = 3
+		quorumType uint8 = 4
+	)
+
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+
+	set1 := GovernanceProposal{
+		Type:       setType,
+		Txid:       cipher.SumSHA256([]byte("set1")),
+		Height:     10,
+		Epoch:      2,
+		Validators: []cipher.PubKey{pk1},
+		Approvals:  []cipher.PubKey{pk1},
+	}
+	set2 := set1
+	set2.Txid = cipher.SumSHA256([]byte("set2"))
+	set2.Validators = []cipher.PubKey{pk2, pk1}
+	quorum := GovernanceProposal{
+		Type:      quorumType,
+		Txid:      cipher.SumSHA256([]byte("quorum")),
+		Height:    12,
+		Epoch:     3,
+		Quorum:    2,
+		Approvals: []cipher.PubKey{pk1, pk2},
+	}
+
+	// a later proposal replaces the pending one of the same type
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		for _, p := range []GovernanceProposal{set1, set2, quorum} {
+			if err := gv.ProposeWithTx(tx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	pending, err := gv.GetPending()
+	require.NoError(t, err)
+	require.Equal(t, []GovernanceProposal{set2, quorum}, pending)
+
+	_, ok, err := gv.GetActive(setType)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	activate := func(epoch uint64) []GovernanceProposal {
+		var activated []GovernanceProposal
+		require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+			var err error
+			activated, err = gv.ActivateWithTx(tx, epoch)
+			return err
+		}))
+		return activated
+	}
+
+	// nothing proposed before epoch 2 takes effect at its start
+	require.Empty(t, activate(2))
+
+	activated := activate(3)
+	set2.ActiveEpoch = 3
+	require.Equal(t, []GovernanceProposal{set2}, activated)
+
+	active, ok, err := gv.GetActive(setType)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, set2, active)
+
+	pending, err = gv.GetPending()
+	require.NoError(t, err)
+	require.Equal(t, []GovernanceProposal{quorum}, pending)
+
+	activated = activate(4)
+	quorum.ActiveEpoch = 4
+	require.Equal(t, []GovernanceProposal{quorum}, activated)
+
+	all, err := gv.GetAllActive()
+	require.NoError(t, err)
+	require.Equal(t, []GovernanceProposal{set2, quorum}, all)
+
+	pending, err = gv.GetPending()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
@@ -0,0 +1,172 @@
+package blockdb
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
+	"github.com/samoslab/samos/src/visor/bucket"
+)
+
+var (
+	jailBkt     = []byte("validator_jail")
+	jailMetaBkt = []byte("validator_jail_meta")
+
+	jailEpochKey = []byte("epoch")
+)
+
+const (
+	// JailReasonDoubleSign the validator signed conflicting blocks
+	JailReasonDoubleSign uint8 = 1
+	// JailReasonDowntime the validator missed too many of its slots in an epoch
+	JailReasonDowntime uint8 = 2
+)
+
+// JailRecord is a validator removed from the validator set
+type JailRecord struct {
+	PubKey          cipher.PubKey
+	Reason          uint8
+	JailedEpoch     uint64 // first epoch without the validator
+	ReleaseEpoch    uint64 // first epoch an unjail transaction is accepted
+	UnjailRequested bool   // the validator is released at the next epoch boundary
+}
+
+// Jails stores the jailed validators
+type Jails struct {
+	db     *bolt.DB
+	jailed *bucket.Bucket // pubkey -> JailRecord
+	meta   *bucket.Bucket // "epoch" -> the last epoch the jail was updated for
+}
+
+// NewJails create jail buckets in blockdb if does not exist.
+func NewJails(db *bolt.DB) (*Jails, error) {
+	jailed, err := bucket.New(jailBkt, db)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := bucket.New(jailMetaBkt, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Jails{
+		db:     db,
+		jailed: jailed,
+		meta:   meta,
+	}, nil
+}
+
+func (jl *Jails) getWithTx(tx *bolt.Tx, pubkey cipher.PubKey) (JailRecord, bool, error) {
+	v := jl.jailed.GetWithTx(tx, pubkey[:])
+	if v == nil {
+		return JailRecord{}, false, nil
+	}
+	var r JailRecord
+	if err := encoder.DeserializeRaw(v, &r); err != nil {
+		return JailRecord{}, false, err
+	}
+	return r, true, nil
+}
+
+// Get returns the jail record of the validator, ok is false if it is not jailed
+func (jl *Jails) Get(pubkey cipher.PubKey) (r JailRecord, ok bool, err error) {
+	err = jl.db.View(func(tx *bolt.Tx) error {
+		r, ok, err = jl.getWithTx(tx, pubkey)
+		return err
+	})
+	return
+}
+
+// JailWithTx jails the validator, a validator in jail keeps the later release epoch
+// and has to request the release again
+func (jl *Jails) JailWithTx(tx *bolt.Tx, r JailRecord) error {
+	old, ok, err := jl.getWithTx(tx, r.PubKey)
+	if err != nil {
+		return err
+	}
+	if ok && old.ReleaseEpoch > r.ReleaseEpoch {
+		r.ReleaseEpoch = old.ReleaseEpoch
+	}
+	r.UnjailRequested = false
+	return jl.jailed.PutWithTx(tx, r.PubKey[:], encoder.Serialize(r))
+}
+
+// RequestUnjailWithTx marks the validator to be released at the next epoch boundary.
+// Returns false if the validator is not jailed or the release epoch is not reached.
+func (jl *Jails) RequestUnjailWithTx(tx *bolt.Tx, pubkey cipher.PubKey, epoch uint64) (bool, error) {
+	r, ok, err := jl.getWithTx(tx, pubkey)
+	if err != nil || !ok {
+		return false, err
+	}
+	if epoch < r.ReleaseEpoch {
+		return false, nil
+	}
+	r.UnjailRequested = true
+	return true, jl.jailed.PutWithTx(tx, pubkey[:], encoder.Serialize(r))
+}
+
+// ReleaseWithTx removes the validator from jail
+func (jl *Jails) ReleaseWithTx(tx *bolt.Tx, pubkey cipher.PubKey) error {
+	return jl.jailed.DeleteWithTx(tx, pubkey[:])
+}
+
+// MoveWithTx moves the jail record of the validator to its new pubkey
+func (jl *Jails) MoveWithTx(tx *bolt.Tx, oldPubkey, newPubkey cipher.PubKey) error {
+	r, ok, err := jl.getWithTx(tx, oldPubkey)
+	if err != nil || !ok {
+		return err
+	}
+	if err := jl.jailed.DeleteWithTx(tx, oldPubkey[:]); err != nil {
+		return err
+	}
+	r.PubKey = newPubkey
+	return jl.jailed.PutWithTx(tx, newPubkey[:], encoder.Serialize(r))
+}
+
+// GetAll returns all jailed validators
+func (jl *Jails) GetAll() (records []JailRecord, err error) {
+	err = jl.db.View(func(tx *bolt.Tx) error {
+		records, err = jl.GetAllWithTx(tx)
+		return err
+	})
+	return
+}
+
+// GetAllWithTx returns all jailed validators with *bolt.Tx
+func (jl *Jails) GetAllWithTx(tx *bolt.Tx) ([]JailRecord, error) {
+	records := []JailRecord{}
+	if err := jl.jailed.ForEachWithTx(tx, func(k, v []byte) error {
+		var r JailRecord
+		if err := encoder.DeserializeRaw(v, &r); err != nil {
+			return err
+		}
+		records = append(records, r)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// GetEpoch returns the last epoch the jail was updated for, ok is false if it was never updated
+func (jl *Jails) GetEpoch() (epoch uint64, ok bool) {
+	jl.db.View(func(tx *bolt.Tx) error {
+		epoch, ok = jl.GetEpochWithTx(tx)
+		return nil
+	})
+	return
+}
+
+// GetEpochWithTx returns the last epoch the jail was updated for with *bolt.Tx
+func (jl *Jails) GetEpochWithTx(tx *bolt.Tx) (epoch uint64, ok bool) {
+	v := jl.meta.GetWithTx(tx, jailEpochKey)
+	if v == nil {
+		return 0, false
+	}
+	return bucket.Btoi(v), true
+}
+
+// SetEpochWithTx records the last epoch the jail was updated for
+func (jl *Jails) SetEpochWithTx(tx *bolt.Tx, epoch uint64) error {
+	return jl.meta.PutWithTx(tx, jailEpochKey, bucket.Itob(epoch))
+}
@@ -0,0 +1,76 @@
+package blockdb
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+func TestJails(t *testing.T) {
+	db, close := testutil.PrepareDB(t)
+	defer close()
+	jl, err := NewJails(db)
+	require.NoError(t, err)
+
+	_, ok := jl.GetEpoch()
+	assert.False(t, ok)
+
+	pk, _ := cipher.GenerateKeyPair()
+	_, ok, err = jl.Get(pk)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		// nothing to release
+		if ok, err := jl.RequestUnjailWithTx(tx, pk, 5); err != nil || ok {
+			return err
+		}
+		if err := jl.JailWithTx(tx, JailRecord{PubKey: pk, Reason: JailReasonDoubleSign, JailedEpoch: 5, ReleaseEpoch: 35}); err != nil {
+			return err
+		}
+		// jailing again keeps the later release epoch
+		if err := jl.JailWithTx(tx, JailRecord{PubKey: pk, Reason: JailReasonDowntime, JailedEpoch: 6, ReleaseEpoch: 7}); err != nil {
+			return err
+		}
+		return jl.SetEpochWithTx(tx, 6)
+	})
+	require.NoError(t, err)
+
+	epoch, ok := jl.GetEpoch()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(6), epoch)
+
+	r, ok, err := jl.Get(pk)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, JailRecord{PubKey: pk, Reason: JailReasonDowntime, JailedEpoch: 6, ReleaseEpoch: 35}, r)
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		ok, err := jl.RequestUnjailWithTx(tx, pk, 34)
+		require.False(t, ok)
+		if err != nil {
+			return err
+		}
+		ok, err = jl.RequestUnjailWithTx(tx, pk, 35)
+		require.True(t, ok)
+		return err
+	})
+	require.NoError(t, err)
+
+	records, err := jl.GetAll()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.True(t, records[0].UnjailRequested)
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return jl.ReleaseWithTx(tx, pk)
+	}))
+	records, err = jl.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
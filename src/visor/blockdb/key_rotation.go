@@ -0,0 +1,99 @@
+package blockdb
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
+	"github.com/samoslab/samos/src/visor/bucket"
+)
+
+var keyRotationBkt = []byte("validator_key_rotations")
+
+// KeyRotation is a validator signing key replaced by a new one
+type KeyRotation struct {
+	OldPubKey   cipher.PubKey
+	NewPubKey   cipher.PubKey
+	Txid        cipher.SHA256
+	Height      uint64 // height of the block with the transaction
+	ActiveEpoch uint64 // first epoch the new key signs for the validator
+	Applied     bool   // the rotation took effect
+}
+
+// KeyRotations stores the validator key rotations
+type KeyRotations struct {
+	db        *bolt.DB
+	rotations *bucket.Bucket // old pubkey -> KeyRotation
+}
+
+// NewKeyRotations create key rotation bucket in blockdb if does not exist.
+func NewKeyRotations(db *bolt.DB) (*KeyRotations, error) {
+	rotations, err := bucket.New(keyRotationBkt, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyRotations{
+		db:        db,
+		rotations: rotations,
+	}, nil
+}
+
+// AddWithTx records a rotation to take effect at its active epoch
+func (kr *KeyRotations) AddWithTx(tx *bolt.Tx, r KeyRotation) error {
+	r.Applied = false
+	return kr.rotations.PutWithTx(tx, r.OldPubKey[:], encoder.Serialize(r))
+}
+
+// ApplyWithTx puts the rotations active at the epoch into effect,
+// returns the applied rotations
+func (kr *KeyRotations) ApplyWithTx(tx *bolt.Tx, epoch uint64) ([]KeyRotation, error) {
+	all, err := kr.GetAllWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []KeyRotation{}
+	for _, r := range all {
+		if r.Applied || r.ActiveEpoch > epoch {
+			continue
+		}
+		r.Applied = true
+		if err := kr.rotations.PutWithTx(tx, r.OldPubKey[:], encoder.Serialize(r)); err != nil {
+			return nil, err
+		}
+		applied = append(applied, r)
+	}
+	return applied, nil
+}
+
+// GetAllWithTx returns all key rotations, pending and applied
+func (kr *KeyRotations) GetAllWithTx(tx *bolt.Tx) ([]KeyRotation, error) {
+	b := tx.Bucket(kr.rotations.Name)
+	if b == nil {
+		return nil, fmt.Errorf("bucket %s doesn't exist", kr.rotations.Name)
+	}
+	rotations := []KeyRotation{}
+	if err := b.ForEach(func(k, v []byte) error {
+		var r KeyRotation
+		if err := encoder.DeserializeRaw(v, &r); err != nil {
+			return err
+		}
+		rotations = append(rotations, r)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return rotations, nil
+}
+
+// GetAll returns all key rotations, pending and applied
+func (kr *KeyRotations) GetAll() (rotations []KeyRotation, err error) {
+	err = kr.db.View(func(tx *bolt.Tx) error {
+		rotations, err = kr.GetAllWithTx(tx)
+		return err
+	})
+	return
+}
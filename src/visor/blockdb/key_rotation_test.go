@@ -0,0 +1,72 @@
+package blockdb
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+func TestKeyRotations(t *testing.T) {
+	db, close := testutil.PrepareDB(t)
+	defer close()
+	kr, err := NewKeyRotations(db)
+	require.NoError(t, err)
+
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	pk3, _ := cipher.GenerateKeyPair()
+	pk4, _ := cipher.GenerateKeyPair()
+
+	r1 := KeyRotation{
+		OldPubKey:   pk1,
+		NewPubKey:   pk2,
+		Txid:        cipher.SumSHA256([]byte("r1")),
+		Height:      10,
+		ActiveEpoch: 3,
+	}
+	r2 := KeyRotation{
+		OldPubKey:   pk3,
+		NewPubKey:   pk4,
+		Txid:        cipher.SumSHA256([]byte("r2")),
+		Height:      11,
+		ActiveEpoch: 4,
+	}
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		if err := kr.AddWithTx(tx, r1); err != nil {
+			return err
+		}
+		return kr.AddWithTx(tx, r2)
+	}))
+
+	apply := func(epoch uint64) []KeyRotation {
+		var applied []KeyRotation
+		require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+			var err error
+			applied, err = kr.ApplyWithTx(tx, epoch)
+			return err
+		}))
+		return applied
+	}
+
+	require.Empty(t, apply(2))
+
+	r1.Applied = true
+	require.Equal(t, []KeyRotation{r1}, apply(3))
+
+	// an applied rotation is not applied again
+	r2.Applied = true
+	require.Equal(t, []KeyRotation{r2}, apply(5))
+	require.Empty(t, apply(6))
+
+	all, err := kr.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	for _, r := range all {
+		require.True(t, r.Applied)
+	}
+}
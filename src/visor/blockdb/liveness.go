@@ -0,0 +1,132 @@
+package blockdb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
+	"github.com/samoslab/samos/src/visor/bucket"
+)
+
+var livenessBkt = []byte("validator_liveness")
+
+// SlotStats counts the block slots of a validator in an epoch
+type SlotStats struct {
+	Epoch          uint64
+	PubKey         cipher.PubKey
+	Produced       uint64 // slots with a block of the validator in the chain
+	Missed         uint64 // slots of the validator without any block
+	Orphaned       uint64 // blocks of the validator dropped before they were confirmed
+	LastMissedSlot int64  // start time of the last missed slot, 0 if none was missed
+}
+
+// Liveness stores the slot statistics of the validators, keyed by epoch and pubkey
+type Liveness struct {
+	db    *bolt.DB
+	stats *bucket.Bucket // epoch + pubkey -> SlotStats
+}
+
+// NewLiveness create validator liveness bucket in blockdb if does not exist.
+func NewLiveness(db *bolt.DB) (*Liveness, error) {
+	stats, err := bucket.New(livenessBkt, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Liveness{
+		db:    db,
+		stats: stats,
+	}, nil
+}
+
+func livenessKey(epoch uint64, pubkey cipher.PubKey) []byte {
+	return append(bucket.Itob(epoch), pubkey[:]...)
+}
+
+func (lv *Liveness) updateWithTx(tx *bolt.Tx, epoch uint64, pubkey cipher.PubKey, f func(*SlotStats)) error {
+	key := livenessKey(epoch, pubkey)
+	s := SlotStats{
+		Epoch:  epoch,
+		PubKey: pubkey,
+	}
+	if v := lv.stats.GetWithTx(tx, key); v != nil {
+		if err := encoder.DeserializeRaw(v, &s); err != nil {
+			return err
+		}
+	}
+	f(&s)
+	return lv.stats.PutWithTx(tx, key, encoder.Serialize(s))
+}
+
+// AddProducedWithTx counts a slot in which the validator produced a block
+func (lv *Liveness) AddProducedWithTx(tx *bolt.Tx, epoch uint64, pubkey cipher.PubKey) error {
+	return lv.updateWithTx(tx, epoch, pubkey, func(s *SlotStats) {
+		s.Produced++
+	})
+}
+
+// AddMissedWithTx counts a slot of the validator which has no block
+func (lv *Liveness) AddMissedWithTx(tx *bolt.Tx, epoch uint64, pubkey cipher.PubKey, slot int64) error {
+	return lv.updateWithTx(tx, epoch, pubkey, func(s *SlotStats) {
+		s.Missed++
+		if slot > s.LastMissedSlot {
+			s.LastMissedSlot = slot
+		}
+	})
+}
+
+// AddOrphaned counts a block of the validator which was dropped before it was confirmed
+func (lv *Liveness) AddOrphaned(epoch uint64, pubkey cipher.PubKey) error {
+	return lv.db.Update(func(tx *bolt.Tx) error {
+		return lv.updateWithTx(tx, epoch, pubkey, func(s *SlotStats) {
+			s.Orphaned++
+		})
+	})
+}
+
+// GetAll returns the slot statistics of all epochs, ordered by epoch then pubkey
+func (lv *Liveness) GetAll() ([]SlotStats, error) {
+	stats := []SlotStats{}
+	if err := lv.stats.ForEach(func(k, v []byte) error {
+		var s SlotStats
+		if err := encoder.DeserializeRaw(v, &s); err != nil {
+			return err
+		}
+		stats = append(stats, s)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetEpoch returns the slot statistics of the validators in the epoch, ordered by pubkey
+func (lv *Liveness) GetEpoch(epoch uint64) (stats []SlotStats, err error) {
+	err = lv.db.View(func(tx *bolt.Tx) error {
+		stats, err = lv.GetEpochWithTx(tx, epoch)
+		return err
+	})
+	return
+}
+
+// GetEpochWithTx returns the slot statistics of the validators in the epoch with *bolt.Tx
+func (lv *Liveness) GetEpochWithTx(tx *bolt.Tx, epoch uint64) ([]SlotStats, error) {
+	bkt := tx.Bucket(lv.stats.Name)
+	if bkt == nil {
+		return nil, fmt.Errorf("bucket %s doesn't exist", lv.stats.Name)
+	}
+	stats := []SlotStats{}
+	prefix := bucket.Itob(epoch)
+	c := bkt.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		var s SlotStats
+		if err := encoder.DeserializeRaw(v, &s); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
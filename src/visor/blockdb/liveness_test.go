@@ -0,0 +1,66 @@
+package blockdb
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+func TestLiveness(t *testing.T) {
+	db, close := testutil.PrepareDB(t)
+	defer close()
+	lv, err := NewLiveness(db)
+	require.NoError(t, err)
+
+	stats, err := lv.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, stats)
+
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if err := lv.AddProducedWithTx(tx, 2, pk1); err != nil {
+			return err
+		}
+		if err := lv.AddProducedWithTx(tx, 2, pk1); err != nil {
+			return err
+		}
+		if err := lv.AddMissedWithTx(tx, 2, pk2, 200); err != nil {
+			return err
+		}
+		// an older slot does not replace the last missed one
+		if err := lv.AddMissedWithTx(tx, 2, pk2, 190); err != nil {
+			return err
+		}
+		return lv.AddMissedWithTx(tx, 1, pk1, 100)
+	})
+	require.NoError(t, err)
+	require.NoError(t, lv.AddOrphaned(2, pk2))
+
+	stats, err = lv.GetAll()
+	require.NoError(t, err)
+	require.Len(t, stats, 3)
+
+	assert.Equal(t, SlotStats{Epoch: 1, PubKey: pk1, Missed: 1, LastMissedSlot: 100}, stats[0])
+
+	byPubkey := map[cipher.PubKey]SlotStats{}
+	for _, s := range stats[1:] {
+		assert.Equal(t, uint64(2), s.Epoch)
+		byPubkey[s.PubKey] = s
+	}
+	assert.Equal(t, SlotStats{Epoch: 2, PubKey: pk1, Produced: 2}, byPubkey[pk1])
+	assert.Equal(t, SlotStats{Epoch: 2, PubKey: pk2, Missed: 2, Orphaned: 1, LastMissedSlot: 200}, byPubkey[pk2])
+
+	epochStats, err := lv.GetEpoch(2)
+	require.NoError(t, err)
+	assert.Equal(t, stats[1:], epochStats)
+	epochStats, err = lv.GetEpoch(3)
+	require.NoError(t, err)
+	assert.Empty(t, epochStats)
+}
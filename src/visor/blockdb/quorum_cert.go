@@ -0,0 +1,54 @@
+package blockdb
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
+	"github.com/samoslab/samos/src/visor/bucket"
+)
+
+var quorumCertsBkt = []byte("quorum_certs")
+
+// QuorumCert proves that a quorum of validators committed a block,
+// Sigs[i] is the commit vote of Signers[i]
+type QuorumCert struct {
+	Hash    cipher.SHA256
+	Signers []cipher.PubKey
+	Sigs    []cipher.Sig
+}
+
+// QuorumCerts stores the quorum certificates of the executed blocks
+type QuorumCerts struct {
+	certs *bucket.Bucket // block hash -> QuorumCert
+}
+
+// NewQuorumCerts create quorum certificate bucket in blockdb if does not exist.
+func NewQuorumCerts(db *bolt.DB) (*QuorumCerts, error) {
+	certs, err := bucket.New(quorumCertsBkt, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuorumCerts{
+		certs: certs,
+	}, nil
+}
+
+// Get returns the quorum certificate of the block, nil if the block has none
+func (qc *QuorumCerts) Get(hash cipher.SHA256) (*QuorumCert, error) {
+	bin := qc.certs.Get(hash[:])
+	if bin == nil {
+		return nil, nil
+	}
+	var cert QuorumCert
+	if err := encoder.DeserializeRaw(bin, &cert); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// AddWithTx stores the quorum certificate of a block with bolt.Tx
+func (qc *QuorumCerts) AddWithTx(tx *bolt.Tx, cert QuorumCert) error {
+	return qc.certs.PutWithTx(tx, cert.Hash[:], encoder.Serialize(cert))
+}
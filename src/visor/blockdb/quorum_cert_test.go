@@ -0,0 +1,43 @@
+package blockdb
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+func TestQuorumCerts(t *testing.T) {
+	db, close := testutil.PrepareDB(t)
+	defer close()
+	qcs, err := NewQuorumCerts(db)
+	require.NoError(t, err)
+
+	pk1, sk1 := cipher.GenerateKeyPair()
+	pk2, sk2 := cipher.GenerateKeyPair()
+	hash := cipher.SumSHA256([]byte("block"))
+
+	cert, err := qcs.Get(hash)
+	require.NoError(t, err)
+	require.Nil(t, cert)
+
+	qc := QuorumCert{
+		Hash:    hash,
+		Signers: []cipher.PubKey{pk1, pk2},
+		Sigs:    []cipher.Sig{cipher.SignHash(hash, sk1), cipher.SignHash(hash, sk2)},
+	}
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return qcs.AddWithTx(tx, qc)
+	}))
+
+	cert, err = qcs.Get(hash)
+	require.NoError(t, err)
+	require.Equal(t, &qc, cert)
+
+	cert, err = qcs.Get(cipher.SumSHA256([]byte("other")))
+	require.NoError(t, err)
+	require.Nil(t, cert)
+}
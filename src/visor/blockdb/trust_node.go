@@ -9,24 +9,51 @@ import (
 	"github.com/boltdb/bolt"
 
 	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
 	"github.com/samoslab/samos/src/visor/bucket"
 )
 
+// ValidatorSet is a version of the validator set, it is active from the block
+// of Height until the next version
+type ValidatorSet struct {
+	Height  uint64
+	Epoch   uint64
+	Pubkeys []cipher.PubKey
+	Quorum  uint64 // governed votes a block needs, 0 means 2f+1 of the validators
+}
+
+// Contains returns true if the pubkey is in the set
+func (vs ValidatorSet) Contains(pubkey cipher.PubKey) bool {
+	for _, pk := range vs.Pubkeys {
+		if pk == pubkey {
+			return true
+		}
+	}
+	return false
+}
+
 // TrustNode use the trustnode store all trust node info
 type TrustNode struct {
 	db   *bolt.DB
 	node *bucket.Bucket
+	sets *bucket.Bucket // activation height -> ValidatorSet
 }
 
-// NewBlockTree create buckets in blockdb if does not exist.
+// NewTrustNode create buckets in blockdb if does not exist.
 func NewTrustNode(db *bolt.DB) (*TrustNode, error) {
 	node, err := bucket.New([]byte("trust_node"), db)
 	if err != nil {
 		return nil, err
 	}
 
+	sets, err := bucket.New([]byte("trust_node_sets"), db)
+	if err != nil {
+		return nil, err
+	}
+
 	return &TrustNode{
 		node: node,
+		sets: sets,
 		db:   db,
 	}, nil
 }
@@ -115,12 +142,16 @@ func (tn *TrustNode) AddAgressNodeNum(tx *bolt.Tx, num int) error {
 
 // GetPubkeys get all trust nodes
 func (tn *TrustNode) GetPubkeys() []cipher.PubKey {
-	return tn.getPubkeys()
+	return tn.getPubkeys(tn.node.Get([]byte("pubkey")))
+}
+
+// GetPubkeysWithTx get all trust nodes with *bolt.Tx
+func (tn *TrustNode) GetPubkeysWithTx(tx *bolt.Tx) []cipher.PubKey {
+	return tn.getPubkeys(tn.node.GetWithTx(tx, []byte("pubkey")))
 }
 
-func (tn *TrustNode) getPubkeys() []cipher.PubKey {
+func (tn *TrustNode) getPubkeys(bin []byte) []cipher.PubKey {
 	pubkeys := []cipher.PubKey{}
-	bin := tn.node.Get([]byte("pubkey"))
 	if bin == nil {
 		return pubkeys
 	}
@@ -142,3 +173,83 @@ func (tn *TrustNode) GetAgreeNodeNum() int {
 	}
 	return num
 }
+
+// SetConsensusEngine stores the name of the consensus engine of the chain
+func (tn *TrustNode) SetConsensusEngine(name string) error {
+	return tn.node.Put([]byte("consensusEngine"), []byte(name))
+}
+
+// GetConsensusEngine returns the name of the consensus engine of the chain,
+// ok is false if none is stored
+func (tn *TrustNode) GetConsensusEngine() (name string, ok bool) {
+	bin := tn.node.Get([]byte("consensusEngine"))
+	if bin == nil {
+		return "", false
+	}
+	return string(bin), true
+}
+
+// AddValidatorSet stores a validator set version
+func (tn *TrustNode) AddValidatorSet(set ValidatorSet) error {
+	return tn.db.Update(func(tx *bolt.Tx) error {
+		return tn.AddValidatorSetWithTx(tx, set)
+	})
+}
+
+// AddValidatorSetWithTx stores a validator set version with *bolt.Tx,
+// a version activated at the same height is replaced
+func (tn *TrustNode) AddValidatorSetWithTx(tx *bolt.Tx, set ValidatorSet) error {
+	if len(set.Pubkeys) == 0 {
+		return fmt.Errorf("empty validator set at height %d", set.Height)
+	}
+	return tn.sets.PutWithTx(tx, bucket.Itob(set.Height), encoder.Serialize(set))
+}
+
+// GetValidatorSet returns the validator set active at the height,
+// ok is false if no version was active at that height
+func (tn *TrustNode) GetValidatorSet(height uint64) (set ValidatorSet, ok bool, err error) {
+	err = tn.db.View(func(tx *bolt.Tx) error {
+		set, ok, err = tn.GetValidatorSetWithTx(tx, height)
+		return err
+	})
+	return
+}
+
+// GetValidatorSetWithTx returns the validator set active at the height with *bolt.Tx
+func (tn *TrustNode) GetValidatorSetWithTx(tx *bolt.Tx, height uint64) (set ValidatorSet, ok bool, err error) {
+	bkt := tx.Bucket(tn.sets.Name)
+	if bkt == nil {
+		return ValidatorSet{}, false, fmt.Errorf("bucket %s doesn't exist", tn.sets.Name)
+	}
+
+	c := bkt.Cursor()
+	k, v := c.Seek(bucket.Itob(height))
+	if k == nil || bucket.Btoi(k) != height {
+		// no version starts at the height, the active one is the previous version
+		k, v = c.Prev()
+	}
+	if k == nil {
+		return ValidatorSet{}, false, nil
+	}
+
+	if err := encoder.DeserializeRaw(v, &set); err != nil {
+		return ValidatorSet{}, false, err
+	}
+	return set, true, nil
+}
+
+// GetValidatorSets returns all validator set versions ordered by activation height
+func (tn *TrustNode) GetValidatorSets() ([]ValidatorSet, error) {
+	sets := []ValidatorSet{}
+	if err := tn.sets.ForEach(func(k, v []byte) error {
+		var set ValidatorSet
+		if err := encoder.DeserializeRaw(v, &set); err != nil {
+			return err
+		}
+		sets = append(sets, set)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
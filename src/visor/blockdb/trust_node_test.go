@@ -49,3 +49,68 @@ func TestAddPubkey(t *testing.T) {
 	trustPks := trustNode.GetPubkeys()
 	assert.Equal(t, pks, trustPks)
 }
+
+func TestConsensusEngine(t *testing.T) {
+	db, close := testutil.PrepareDB(t)
+	defer close()
+	trustNode, err := NewTrustNode(db)
+	assert.Nil(t, err)
+
+	_, ok := trustNode.GetConsensusEngine()
+	assert.False(t, ok)
+
+	assert.Nil(t, trustNode.SetConsensusEngine("blockstat"))
+	name, ok := trustNode.GetConsensusEngine()
+	assert.True(t, ok)
+	assert.Equal(t, "blockstat", name)
+}
+
+func TestValidatorSets(t *testing.T) {
+	db, close := testutil.PrepareDB(t)
+	defer close()
+	trustNode, err := NewTrustNode(db)
+	assert.Nil(t, err)
+
+	_, ok, err := trustNode.GetValidatorSet(10)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	pk3, _ := cipher.GenerateKeyPair()
+	sets := []ValidatorSet{
+		{Height: 0, Epoch: 0, Pubkeys: []cipher.PubKey{pk1, pk2}},
+		{Height: 300, Epoch: 2, Pubkeys: []cipher.PubKey{pk2, pk3}},
+		{Height: 1000, Epoch: 5, Pubkeys: []cipher.PubKey{pk3}},
+	}
+	for _, s := range sets {
+		assert.NoError(t, trustNode.AddValidatorSet(s))
+	}
+	assert.Error(t, trustNode.AddValidatorSet(ValidatorSet{Height: 2000}))
+
+	testCases := []struct {
+		height uint64
+		set    ValidatorSet
+	}{
+		{0, sets[0]},
+		{1, sets[0]},
+		{299, sets[0]},
+		{300, sets[1]},
+		{999, sets[1]},
+		{1000, sets[2]},
+		{1 << 40, sets[2]},
+	}
+	for _, tc := range testCases {
+		set, ok, err := trustNode.GetValidatorSet(tc.height)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, tc.set, set)
+	}
+
+	assert.True(t, sets[1].Contains(pk3))
+	assert.False(t, sets[1].Contains(pk1))
+
+	all, err := trustNode.GetValidatorSets()
+	assert.NoError(t, err)
+	assert.Equal(t, sets, all)
+}
@@ -173,6 +173,14 @@ func (up *Unspents) syncCache() error {
 	return nil
 }
 
+// SyncCache reloads the unspent outputs cache from the db
+func (up *Unspents) SyncCache() error {
+	up.Lock()
+	defer up.Unlock()
+	up.cache.pool = make(map[string]coin.UxOut)
+	return up.syncCache()
+}
+
 // ProcessBlock updates the unspent pool based upon the published block
 func (up *Unspents) ProcessBlock(b *coin.SignedBlock) bucket.TxHandler {
 	return func(tx *bolt.Tx) (bucket.Rollback, error) {
@@ -0,0 +1,295 @@
+package blockdb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/cipher/encoder"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/visor/bucket"
+)
+
+var (
+	voteBallotsBkt    = []byte("vote_ballots")
+	voteCandidatesBkt = []byte("vote_candidates")
+	voteTallyBkt      = []byte("vote_tally")
+	voteElectionBkt   = []byte("vote_election")
+)
+
+// VoteTally is the stake weight behind a validator candidate
+type VoteTally struct {
+	Address cipher.Address
+	PubKey  cipher.PubKey
+	Weight  uint64
+	Voters  uint64
+}
+
+// Votes stores validator election ballots, candidates and elected validator sets
+type Votes struct {
+	db         *bolt.DB
+	ballots    *bucket.Bucket // voter address -> candidate address
+	candidates *bucket.Bucket // candidate address -> candidate pubkey
+	tally      *bucket.Bucket // candidate address -> VoteTally of the last election
+	election   *bucket.Bucket // epoch -> elected validators
+}
+
+// NewVotes create vote buckets in blockdb if does not exist.
+func NewVotes(db *bolt.DB) (*Votes, error) {
+	ballots, err := bucket.New(voteBallotsBkt, db)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := bucket.New(voteCandidatesBkt, db)
+	if err != nil {
+		return nil, err
+	}
+	tally, err := bucket.New(voteTallyBkt, db)
+	if err != nil {
+		return nil, err
+	}
+	election, err := bucket.New(voteElectionBkt, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Votes{
+		db:         db,
+		ballots:    ballots,
+		candidates: candidates,
+		tally:      tally,
+		election:   election,
+	}, nil
+}
+
+// AddBallotWithTx records the ballot of the voter, a later ballot replaces the earlier one.
+// A voter voting for its own address registers its pubkey as a candidate.
+func (vt *Votes) AddBallotWithTx(tx *bolt.Tx, voter cipher.PubKey, candidate cipher.Address) error {
+	voterAddr := cipher.AddressFromPubKey(voter)
+	if err := vt.ballots.PutWithTx(tx, []byte(voterAddr.String()), []byte(candidate.String())); err != nil {
+		return err
+	}
+
+	if voterAddr == candidate {
+		return vt.candidates.PutWithTx(tx, []byte(candidate.String()), []byte(voter.Hex()))
+	}
+	return nil
+}
+
+// GetBallots returns all ballots, voter address -> candidate address
+func (vt *Votes) GetBallots() (ballots map[cipher.Address]cipher.Address, err error) {
+	err = vt.db.View(func(tx *bolt.Tx) error {
+		ballots, err = vt.GetBallotsWithTx(tx)
+		return err
+	})
+	return
+}
+
+// GetBallotsWithTx returns all ballots with *bolt.Tx, voter address -> candidate address
+func (vt *Votes) GetBallotsWithTx(tx *bolt.Tx) (map[cipher.Address]cipher.Address, error) {
+	ballots := make(map[cipher.Address]cipher.Address)
+	if err := vt.ballots.ForEachWithTx(tx, func(k, v []byte) error {
+		voter, err := cipher.DecodeBase58Address(string(k))
+		if err != nil {
+			return err
+		}
+		candidate, err := cipher.DecodeBase58Address(string(v))
+		if err != nil {
+			return err
+		}
+		ballots[voter] = candidate
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ballots, nil
+}
+
+// GetCandidates returns all registered candidates, address -> pubkey
+func (vt *Votes) GetCandidates() (candidates map[cipher.Address]cipher.PubKey, err error) {
+	err = vt.db.View(func(tx *bolt.Tx) error {
+		candidates, err = vt.GetCandidatesWithTx(tx)
+		return err
+	})
+	return
+}
+
+// GetCandidatesWithTx returns all registered candidates with *bolt.Tx, address -> pubkey
+func (vt *Votes) GetCandidatesWithTx(tx *bolt.Tx) (map[cipher.Address]cipher.PubKey, error) {
+	candidates := make(map[cipher.Address]cipher.PubKey)
+	if err := vt.candidates.ForEachWithTx(tx, func(k, v []byte) error {
+		addr, err := cipher.DecodeBase58Address(string(k))
+		if err != nil {
+			return err
+		}
+		pk, err := cipher.PubKeyFromHex(string(v))
+		if err != nil {
+			return err
+		}
+		candidates[addr] = pk
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// Tally counts the stake of every ballot for the candidates, the stake of a voter is
+// the coins of its unspent outputs. implicit candidates are eligible without registering.
+// The result is sorted by weight descending, ties are broken by address.
+func (vt *Votes) Tally(unspent UnspentGetter, implicit []cipher.PubKey) (tallies []VoteTally, err error) {
+	err = vt.db.View(func(tx *bolt.Tx) error {
+		tallies, err = vt.TallyWithTx(tx, unspent, implicit)
+		return err
+	})
+	return
+}
+
+// TallyWithTx counts the stake of every ballot for the candidates with *bolt.Tx
+func (vt *Votes) TallyWithTx(tx *bolt.Tx, unspent UnspentGetter, implicit []cipher.PubKey) ([]VoteTally, error) {
+	candidates, err := vt.GetCandidatesWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, pk := range implicit {
+		candidates[cipher.AddressFromPubKey(pk)] = pk
+	}
+
+	ballots, err := vt.GetBallotsWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	voters := make([]cipher.Address, 0, len(ballots))
+	for voter := range ballots {
+		voters = append(voters, voter)
+	}
+	uxs := unspent.GetUnspentsOfAddrs(voters)
+
+	tallies := make(map[cipher.Address]*VoteTally, len(candidates))
+	for addr, pk := range candidates {
+		tallies[addr] = &VoteTally{
+			Address: addr,
+			PubKey:  pk,
+		}
+	}
+
+	for voter, candidate := range ballots {
+		t, ok := tallies[candidate]
+		if !ok {
+			continue
+		}
+
+		coins, err := coin.UxArray(uxs[voter]).Coins()
+		if err != nil {
+			return nil, err
+		}
+		t.Weight, err = coin.AddUint64(t.Weight, coins)
+		if err != nil {
+			return nil, err
+		}
+		t.Voters++
+	}
+
+	result := make([]VoteTally, 0, len(tallies))
+	for _, t := range tallies {
+		result = append(result, *t)
+	}
+	sortTallies(result)
+	return result, nil
+}
+
+// sortTallies sorts by weight descending, ties are broken by address
+func sortTallies(tallies []VoteTally) {
+	sort.Slice(tallies, func(i, j int) bool {
+		if tallies[i].Weight != tallies[j].Weight {
+			return tallies[i].Weight > tallies[j].Weight
+		}
+		return bytes.Compare(tallies[i].Address.Bytes(), tallies[j].Address.Bytes()) < 0
+	})
+}
+
+// Elect returns the pubkeys of the top n candidates which have stake behind them
+func Elect(tallies []VoteTally, n int) []cipher.PubKey {
+	validators := []cipher.PubKey{}
+	for _, t := range tallies {
+		if len(validators) >= n {
+			break
+		}
+		if t.Weight == 0 {
+			break
+		}
+		validators = append(validators, t.PubKey)
+	}
+	return validators
+}
+
+// SetElection stores the tally and the validators elected for the epoch
+func (vt *Votes) SetElection(epoch uint64, tallies []VoteTally, validators []cipher.PubKey) error {
+	return vt.db.Update(func(tx *bolt.Tx) error {
+		return vt.SetElectionWithTx(tx, epoch, tallies, validators)
+	})
+}
+
+// SetElectionWithTx stores the tally and the validators elected for the epoch with *bolt.Tx
+func (vt *Votes) SetElectionWithTx(tx *bolt.Tx, epoch uint64, tallies []VoteTally, validators []cipher.PubKey) error {
+	if err := tx.DeleteBucket(vt.tally.Name); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucket(vt.tally.Name); err != nil {
+		return err
+	}
+	for _, t := range tallies {
+		if err := vt.tally.PutWithTx(tx, []byte(t.Address.String()), encoder.Serialize(t)); err != nil {
+			return err
+		}
+	}
+
+	return vt.election.PutWithTx(tx, bucket.Itob(epoch), encoder.Serialize(validators))
+}
+
+// GetTally returns the tally of the last election
+func (vt *Votes) GetTally() ([]VoteTally, error) {
+	tallies := []VoteTally{}
+	if err := vt.tally.ForEach(func(k, v []byte) error {
+		var t VoteTally
+		if err := encoder.DeserializeRaw(v, &t); err != nil {
+			return err
+		}
+		tallies = append(tallies, t)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sortTallies(tallies)
+	return tallies, nil
+}
+
+// GetElected returns the epoch of the last election and the validators it elected,
+// ok is false if no election has been held
+func (vt *Votes) GetElected() (epoch uint64, validators []cipher.PubKey, ok bool, err error) {
+	err = vt.db.View(func(tx *bolt.Tx) error {
+		epoch, validators, ok, err = vt.GetElectedWithTx(tx)
+		return err
+	})
+	return
+}
+
+// GetElectedWithTx returns the last election with *bolt.Tx, ok is false if no election has been held
+func (vt *Votes) GetElectedWithTx(tx *bolt.Tx) (epoch uint64, validators []cipher.PubKey, ok bool, err error) {
+	bkt := tx.Bucket(vt.election.Name)
+	if bkt == nil {
+		return 0, nil, false, fmt.Errorf("bucket %s doesn't exist", vt.election.Name)
+	}
+	k, v := bkt.Cursor().Last()
+	if k == nil {
+		return 0, nil, false, nil
+	}
+	if err := encoder.DeserializeRaw(v, &validators); err != nil {
+		return 0, nil, false, err
+	}
+	return bucket.Btoi(k), validators, true, nil
+}
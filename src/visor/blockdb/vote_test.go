@@ -0,0 +1,130 @@
+package blockdb
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+type fakeUnspentGetter map[cipher.Address]uint64
+
+func (f fakeUnspentGetter) GetUnspentsOfAddrs(addrs []cipher.Address) coin.AddressUxOuts {
+	uxs := coin.AddressUxOuts{}
+	for _, a := range addrs {
+		if coins, ok := f[a]; ok {
+			uxs[a] = coin.UxArray{{Body: coin.UxBody{Address: a, Coins: coins}}}
+		}
+	}
+	return uxs
+}
+
+func (f fakeUnspentGetter) Get(cipher.SHA256) (coin.UxOut, bool) {
+	return coin.UxOut{}, false
+}
+
+func TestVotesTally(t *testing.T) {
+	db, close := testutil.PrepareDB(t)
+	defer close()
+	votes, err := NewVotes(db)
+	require.NoError(t, err)
+
+	candA, _ := cipher.GenerateKeyPair()
+	candB, _ := cipher.GenerateKeyPair()
+	trust, _ := cipher.GenerateKeyPair()
+	voter1, _ := cipher.GenerateKeyPair()
+	voter2, _ := cipher.GenerateKeyPair()
+	addrA := cipher.AddressFromPubKey(candA)
+	addrB := cipher.AddressFromPubKey(candB)
+	addrTrust := cipher.AddressFromPubKey(trust)
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		// candidates register by voting for themselves
+		if err := votes.AddBallotWithTx(tx, candA, addrA); err != nil {
+			return err
+		}
+		if err := votes.AddBallotWithTx(tx, candB, addrB); err != nil {
+			return err
+		}
+		if err := votes.AddBallotWithTx(tx, voter1, addrB); err != nil {
+			return err
+		}
+		// the later ballot replaces the earlier one
+		if err := votes.AddBallotWithTx(tx, voter2, addrB); err != nil {
+			return err
+		}
+		return votes.AddBallotWithTx(tx, voter2, addrTrust)
+	})
+	require.NoError(t, err)
+
+	candidates, err := votes.GetCandidates()
+	require.NoError(t, err)
+	assert.Equal(t, map[cipher.Address]cipher.PubKey{addrA: candA, addrB: candB}, candidates)
+
+	ballots, err := votes.GetBallots()
+	require.NoError(t, err)
+	assert.Len(t, ballots, 4)
+	assert.Equal(t, addrTrust, ballots[cipher.AddressFromPubKey(voter2)])
+
+	stake := fakeUnspentGetter{
+		addrA:                            10e6,
+		addrB:                            1e6,
+		cipher.AddressFromPubKey(voter1): 5e6,
+		cipher.AddressFromPubKey(voter2): 20e6,
+	}
+
+	// votes for the trust node are ignored unless it is an implicit candidate
+	tallies, err := votes.Tally(stake, nil)
+	require.NoError(t, err)
+	require.Len(t, tallies, 2)
+	assert.Equal(t, addrA, tallies[0].Address)
+	assert.Equal(t, uint64(10e6), tallies[0].Weight)
+	assert.Equal(t, addrB, tallies[1].Address)
+	assert.Equal(t, uint64(6e6), tallies[1].Weight)
+	assert.Equal(t, uint64(2), tallies[1].Voters)
+
+	tallies, err = votes.Tally(stake, []cipher.PubKey{trust})
+	require.NoError(t, err)
+	require.Len(t, tallies, 3)
+	assert.Equal(t, addrTrust, tallies[0].Address)
+	assert.Equal(t, uint64(20e6), tallies[0].Weight)
+
+	assert.Equal(t, []cipher.PubKey{trust, candA}, Elect(tallies, 2))
+	assert.Equal(t, []cipher.PubKey{trust, candA, candB}, Elect(tallies, 5))
+	assert.Empty(t, Elect(nil, 5))
+}
+
+func TestVotesElection(t *testing.T) {
+	db, close := testutil.PrepareDB(t)
+	defer close()
+	votes, err := NewVotes(db)
+	require.NoError(t, err)
+
+	_, _, ok, err := votes.GetElected()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	tallies := []VoteTally{
+		{Address: cipher.AddressFromPubKey(pk1), PubKey: pk1, Weight: 3, Voters: 1},
+		{Address: cipher.AddressFromPubKey(pk2), PubKey: pk2, Weight: 2, Voters: 1},
+	}
+	require.NoError(t, votes.SetElection(3, tallies, []cipher.PubKey{pk1, pk2}))
+	require.NoError(t, votes.SetElection(4, tallies[1:], []cipher.PubKey{pk2}))
+
+	epoch, validators, ok, err := votes.GetElected()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(4), epoch)
+	assert.Equal(t, []cipher.PubKey{pk2}, validators)
+
+	got, err := votes.GetTally()
+	require.NoError(t, err)
+	assert.Equal(t, tallies[1:], got)
+}
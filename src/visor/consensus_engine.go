@@ -0,0 +1,310 @@
+package visor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus"
+	"github.com/samoslab/samos/src/consensus/pbft"
+)
+
+// Consensus engines of Config.ConsensusEngine
+const (
+	// ConsensusDposPbft schedules the producers in DPOS slots, a block is final once
+	// the quorum of validators committed it in the PBFT phases
+	ConsensusDposPbft = "dpos-pbft"
+	// ConsensusSingleMaster lets the master chain key produce every block, its signature makes the block final
+	ConsensusSingleMaster = "single-master"
+	// ConsensusBlockStat lets every validator produce blocks, the block of a height signed by
+	// the most validators is final once the quorum signed it
+	ConsensusBlockStat = "blockstat"
+)
+
+// ConsensusEngine is the consensus model of the chain. It selects the producers of the blocks,
+// accepts the pending blocks, counts the votes of the validators and decides when a pending
+// block is final. The pending blocks are kept by the visor whatever the engine.
+type ConsensusEngine interface {
+	// Name returns the name of the engine in the chain parameters
+	Name() string
+	// InTurn returns nil if this node produces the block extending prev at the time
+	InTurn(prev *coin.SignedBlock, when int64) error
+	// AcceptBlock returns nil if the producer of the pending block may propose it
+	AcceptBlock(b coin.SignedBlock) error
+	// CheckProducer returns nil if the pubkey may produce the block of the header
+	CheckProducer(pubkey cipher.PubKey, h coin.BlockHeader) error
+	// AddVote counts the vote of a validator for the pending block, returns the pubkey which signed it
+	AddVote(hash cipher.SHA256, sig cipher.Sig) (cipher.PubKey, error)
+	// IsFinal returns true if the pending block may be executed
+	IsFinal(hash cipher.SHA256) bool
+}
+
+// newConsensusEngine creates the engine of the name for the visor
+func newConsensusEngine(name string, vs *Visor) (ConsensusEngine, error) {
+	switch name {
+	case ConsensusDposPbft:
+		return dposPbftEngine{vs: vs}, nil
+	case ConsensusSingleMaster:
+		return singleMasterEngine{vs: vs}, nil
+	case ConsensusBlockStat:
+		return newBlockStatEngine(vs), nil
+	default:
+		return nil, fmt.Errorf("unknown consensus engine %q", name)
+	}
+}
+
+// initConsensusEngine stores the consensus engine of the chain parameters on the first start,
+// the chain can not be run by another engine later
+func (vs *Visor) initConsensusEngine() error {
+	if vs.trustNode == nil {
+		return nil
+	}
+
+	name, ok := vs.trustNode.GetConsensusEngine()
+	if !ok {
+		return vs.trustNode.SetConsensusEngine(vs.Config.ConsensusEngine)
+	}
+	if name != vs.Config.ConsensusEngine {
+		return fmt.Errorf("the chain runs the %q consensus engine, not %q", name, vs.Config.ConsensusEngine)
+	}
+	return nil
+}
+
+// blockProducer returns the pubkey which signed the block
+func blockProducer(b coin.SignedBlock) (cipher.PubKey, error) {
+	return cipher.PubKeyFromSig(b.Sig, b.HashHeader())
+}
+
+// checkBlockInterval returns an error until BlockCreationInterval seconds passed since the previous block
+func (vs *Visor) checkBlockInterval(prev *coin.SignedBlock, when int64) error {
+	if when < 0 || uint64(when) < prev.Time()+vs.Config.BlockCreationInterval {
+		return errors.New("block creation interval has not passed")
+	}
+	return nil
+}
+
+// dposPbftEngine is the default engine, see ConsensusDposPbft
+type dposPbftEngine struct {
+	vs *Visor
+}
+
+func (e dposPbftEngine) Name() string {
+	return ConsensusDposPbft
+}
+
+// InTurn returns nil in the DPOS slots of this node, unless a view change replaced it at the height
+func (e dposPbftEngine) InTurn(prev *coin.SignedBlock, when int64) error {
+	if e.vs.pbft.IsExcluded(e.vs.TrustPubkey()) {
+		return pbft.ErrProducerExcluded
+	}
+	return e.vs.dpos.CheckValidator(prev, when)
+}
+
+// AcceptBlock checks the block was produced by the validator of the slot of its time
+func (e dposPbftEngine) AcceptBlock(b coin.SignedBlock) error {
+	producer, err := blockProducer(b)
+	if err != nil {
+		return err
+	}
+	return e.CheckProducer(producer, b.Block.Head)
+}
+
+// CheckProducer checks the pubkey is the validator of the slot of the header time
+func (e dposPbftEngine) CheckProducer(pubkey cipher.PubKey, h coin.BlockHeader) error {
+	validator, err := e.vs.dpos.GetValidator(h.PrevHash, h.BkSeq, int64(h.Time))
+	if err != nil {
+		return err
+	}
+	if pubkey != validator {
+		return errors.New("block create time is not satified")
+	}
+	return nil
+}
+
+// AddVote counts the prepare vote, the commit votes follow once the quorum prepared the block
+func (e dposPbftEngine) AddVote(hash cipher.SHA256, sig cipher.Sig) (cipher.PubKey, error) {
+	return e.vs.addPrepare(hash, sig)
+}
+
+// IsFinal returns true once the quorum committed the block
+func (e dposPbftEngine) IsFinal(hash cipher.SHA256) bool {
+	return e.vs.IsCommitted(hash)
+}
+
+// singleMasterEngine is the engine of ConsensusSingleMaster, the master is Config.BlockchainPubkey
+type singleMasterEngine struct {
+	vs *Visor
+}
+
+func (e singleMasterEngine) Name() string {
+	return ConsensusSingleMaster
+}
+
+// InTurn returns nil on the master once BlockCreationInterval passed since the previous block
+func (e singleMasterEngine) InTurn(prev *coin.SignedBlock, when int64) error {
+	if e.vs.TrustPubkey() != e.vs.Config.BlockchainPubkey {
+		return errors.New("only the master produces blocks")
+	}
+	return e.vs.checkBlockInterval(prev, when)
+}
+
+// AcceptBlock checks the block was produced by the master
+func (e singleMasterEngine) AcceptBlock(b coin.SignedBlock) error {
+	producer, err := blockProducer(b)
+	if err != nil {
+		return err
+	}
+	return e.CheckProducer(producer, b.Block.Head)
+}
+
+// CheckProducer checks the pubkey is the master
+func (e singleMasterEngine) CheckProducer(pubkey cipher.PubKey, h coin.BlockHeader) error {
+	if pubkey != e.vs.Config.BlockchainPubkey {
+		return fmt.Errorf("block %d is not produced by the master", h.BkSeq)
+	}
+	return nil
+}
+
+// AddVote records the prepare vote, it does not decide finality but pays the co-signer reward
+func (e singleMasterEngine) AddVote(hash cipher.SHA256, sig cipher.Sig) (cipher.PubKey, error) {
+	return e.vs.addPrepare(hash, sig)
+}
+
+// IsFinal returns true for every pending block, the signature of the master was checked when it was accepted
+func (e singleMasterEngine) IsFinal(hash cipher.SHA256) bool {
+	return e.vs.CheckHashExists(hash)
+}
+
+// blockStatEngine is the engine of ConsensusBlockStat. The signatures of the blocks of a height,
+// the ones of their producers and the votes, are counted by a consensus.BlockStat which selects
+// the block signed by the most validators. A node keeps one pending block per height, the block
+// of another producer is counted but not added; the pending block which is not selected times out.
+type blockStatEngine struct {
+	vs    *Visor
+	stats map[uint64]*consensus.BlockStat // heights after the head -> signatures of their blocks
+	mutex sync.Mutex
+}
+
+func newBlockStatEngine(vs *Visor) *blockStatEngine {
+	return &blockStatEngine{
+		vs:    vs,
+		stats: make(map[uint64]*consensus.BlockStat),
+	}
+}
+
+func (e *blockStatEngine) Name() string {
+	return ConsensusBlockStat
+}
+
+// InTurn returns nil on any validator once BlockCreationInterval passed since the previous block
+// for itself and for each validator ranked before it. The ranks are drawn from the hash of the
+// previous block, so the validators do not all propose at once and the next one proposes when
+// the ones before it are late.
+func (e *blockStatEngine) InTurn(prev *coin.SignedBlock, when int64) error {
+	pubkey := e.vs.TrustPubkey()
+	if !e.vs.IsTrustPubkey(pubkey) {
+		return errors.New("only validators produce blocks")
+	}
+
+	rank := uint64(0)
+	prevHash := prev.HashHeader()
+	key := producerRankKey(prevHash, pubkey)
+	for _, pk := range e.vs.validatorsAt(prev.Seq() + 1) {
+		if pk != pubkey && producerRankKey(prevHash, pk).Hex() < key.Hex() {
+			rank++
+		}
+	}
+
+	if when < 0 || uint64(when) < prev.Time()+(rank+1)*e.vs.Config.BlockCreationInterval {
+		return errors.New("block creation interval has not passed")
+	}
+	return nil
+}
+
+// producerRankKey orders the validators for the block after prevHash
+func producerRankKey(prevHash cipher.SHA256, pubkey cipher.PubKey) cipher.SHA256 {
+	return cipher.SumSHA256(append(prevHash[:], pubkey[:]...))
+}
+
+// AcceptBlock checks the block was produced by a validator and counts the signature of its producer
+func (e *blockStatEngine) AcceptBlock(b coin.SignedBlock) error {
+	producer, err := blockProducer(b)
+	if err != nil {
+		return err
+	}
+	if err := e.CheckProducer(producer, b.Block.Head); err != nil {
+		return err
+	}
+	hash := b.HashHeader()
+	e.observe(b.Seq(), hash, hash, b.Sig)
+	return nil
+}
+
+// CheckProducer checks the pubkey is a validator of the height, every validator produces blocks
+func (e *blockStatEngine) CheckProducer(pubkey cipher.PubKey, h coin.BlockHeader) error {
+	if !e.vs.isValidatorAt(pubkey, h.BkSeq) {
+		return fmt.Errorf("%s is not a validator", pubkey.Hex())
+	}
+	return nil
+}
+
+// AddVote records the prepare vote for the pending block and counts it for its height
+func (e *blockStatEngine) AddVote(hash cipher.SHA256, sig cipher.Sig) (cipher.PubKey, error) {
+	pubkey, err := e.vs.addPrepare(hash, sig)
+	if err != nil {
+		return pubkey, err
+	}
+	if sb, err := e.vs.pbft.GetSignedBlock(hash); err == nil {
+		e.observe(sb.Seq(), hash, pbft.PrepareHash(hash), sig)
+	}
+	return pubkey, nil
+}
+
+// IsFinal returns true if the pending block is the block of its height signed by the most
+// validators and the quorum signed it
+func (e *blockStatEngine) IsFinal(hash cipher.SHA256) bool {
+	sb, err := e.vs.pbft.GetSignedBlock(hash)
+	if err != nil {
+		return false
+	}
+	quorum := e.vs.Quorum(sb.Seq())
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	stat, ok := e.stats[sb.Seq()]
+	if !ok {
+		return false
+	}
+	best, _, _ := stat.GetBestHashPubkeySig()
+	return best == hash && stat.GetSignerCount(hash) >= quorum
+}
+
+// observe counts the signature of signed as a signature of the block hash at the height, signed is
+// the block hash for its producer and the prepare hash for a vote. The heights executed already are dropped.
+func (e *blockStatEngine) observe(seq uint64, hash, signed cipher.SHA256, sig cipher.Sig) {
+	head := e.vs.HeadBkSeq()
+	// every validator of the height may sign the block of every validator
+	n := len(e.vs.blockValidators(seq))
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for s := range e.stats {
+		if s <= head {
+			delete(e.stats, s)
+		}
+	}
+	if seq <= head {
+		return
+	}
+
+	stat, ok := e.stats[seq]
+	if !ok {
+		stat = &consensus.BlockStat{}
+		stat.Init()
+		stat.SetMaxCandidateMessages(n * n)
+		e.stats[seq] = stat
+	}
+	stat.ObserveHashAndVote(hash, signed, sig)
+}
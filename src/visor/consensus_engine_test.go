@@ -0,0 +1,159 @@
+package visor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+func makeTestBlock(sk cipher.SecKey, seq, tm uint64) coin.SignedBlock {
+	b := coin.Block{Head: coin.BlockHeader{BkSeq: seq, Time: tm}}
+	return coin.SignedBlock{Block: b, Sig: cipher.SignHash(b.HashHeader(), sk)}
+}
+
+func TestNewConsensusEngine(t *testing.T) {
+	for _, name := range []string{ConsensusDposPbft, ConsensusSingleMaster, ConsensusBlockStat} {
+		e, err := newConsensusEngine(name, &Visor{})
+		require.NoError(t, err)
+		require.Equal(t, name, e.Name())
+	}
+
+	_, err := newConsensusEngine("pow", &Visor{})
+	testutil.RequireError(t, err, `unknown consensus engine "pow"`)
+
+	c := NewVisorConfig()
+	require.Equal(t, ConsensusDposPbft, c.ConsensusEngine)
+	require.NoError(t, c.Verify())
+	c.ConsensusEngine = "pow"
+	testutil.RequireError(t, c.Verify(), `unknown consensus engine "pow"`)
+}
+
+func TestInitConsensusEngine(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	v, _, _ := newPbftTestVisor(t, db)
+	v.Config.ConsensusEngine = ConsensusBlockStat
+
+	// the engine of the first start is kept with the chain
+	require.NoError(t, v.initConsensusEngine())
+	require.NoError(t, v.initConsensusEngine())
+	name, ok := v.trustNode.GetConsensusEngine()
+	require.True(t, ok)
+	require.Equal(t, ConsensusBlockStat, name)
+
+	v.Config.ConsensusEngine = ConsensusDposPbft
+	testutil.RequireError(t, v.initConsensusEngine(), `the chain runs the "blockstat" consensus engine, not "dpos-pbft"`)
+}
+
+func TestSingleMasterEngine(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	v, pks, sks := newPbftTestVisor(t, db)
+	v.Config.BlockchainPubkey = pks[0]
+	v.Config.BlockCreationInterval = 10
+	v.engine = singleMasterEngine{vs: v}
+
+	head, err := v.GetHeadBlock()
+	require.NoError(t, err)
+
+	// this node is not the master
+	testutil.RequireError(t, v.engine.InTurn(head, 200), "only the master produces blocks")
+	v.Config.BlockchainPubkey = pks[1]
+	testutil.RequireError(t, v.engine.InTurn(head, 105), "block creation interval has not passed")
+	require.NoError(t, v.engine.InTurn(head, 110))
+	v.Config.BlockchainPubkey = pks[0]
+
+	testutil.RequireError(t, v.engine.AcceptBlock(makeTestBlock(sks[1], 1, 110)), "block 1 is not produced by the master")
+	sb := makeTestBlock(sks[0], 1, 110)
+	require.NoError(t, v.engine.AcceptBlock(sb))
+
+	// the block of the master is final without votes
+	require.False(t, v.engine.IsFinal(sb.HashHeader()))
+	require.NoError(t, v.pbft.AddSignedBlock(sb))
+	require.True(t, v.engine.IsFinal(sb.HashHeader()))
+	require.False(t, v.IsCommitted(sb.HashHeader()))
+
+	// votes are recorded but no view change replaces the master
+	_, err = v.AddPrepare(sb.HashHeader(), cipher.SignHash(pbft.PrepareHash(sb.HashHeader()), sks[2]))
+	require.NoError(t, err)
+	require.Len(t, v.GetPrepareSigs(sb.HashHeader()), 1)
+	require.False(t, v.ViewTimedOut(-time.Minute))
+}
+
+func TestBlockStatEngine(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	v, pks, sks := newPbftTestVisor(t, db)
+	v.Config.BlockCreationInterval = 10
+	e := newBlockStatEngine(v)
+	v.engine = e
+
+	head, err := v.GetHeadBlock()
+	require.NoError(t, err)
+
+	// every validator produces blocks, one more validator is in turn after each interval
+	for i, when := range []int64{105, 110, 120, 130, 140} {
+		inTurn := 0
+		for _, pk := range pks {
+			v.Config.BlockchainTrustPubkey = pk
+			if v.engine.InTurn(head, when) == nil {
+				inTurn++
+			}
+		}
+		require.Equal(t, i, inTurn)
+	}
+	v.Config.BlockchainTrustPubkey = pks[1]
+	otherPk, otherSk := cipher.GenerateKeyPair()
+	v.Config.BlockchainTrustPubkey = otherPk
+	testutil.RequireError(t, v.engine.InTurn(head, 110), "only validators produce blocks")
+	testutil.RequireError(t, v.engine.AcceptBlock(makeTestBlock(otherSk, 1, 110)), otherPk.Hex()+" is not a validator")
+
+	// two validators proposed a block of the height, the first one is pending here
+	b := makeTestBlock(sks[0], 1, 110)
+	c := makeTestBlock(sks[2], 1, 112)
+	require.NoError(t, v.engine.AcceptBlock(b))
+	require.NoError(t, v.engine.AcceptBlock(c))
+	require.NoError(t, v.pbft.AddSignedBlock(b))
+	hash := b.HashHeader()
+
+	// the votes are counted, the block is final once the quorum signed it
+	pk, err := v.AddPrepare(hash, cipher.SignHash(pbft.PrepareHash(hash), sks[1]))
+	require.NoError(t, err)
+	require.Equal(t, pks[1], pk)
+	require.False(t, v.engine.IsFinal(hash))
+	_, err = v.AddPrepare(hash, cipher.SignHash(pbft.PrepareHash(hash), sks[1]))
+	require.Error(t, err)
+	_, err = v.AddPrepare(hash, cipher.SignHash(pbft.PrepareHash(hash), sks[3]))
+	require.NoError(t, err)
+	require.True(t, v.engine.IsFinal(hash))
+	require.False(t, v.engine.IsFinal(c.HashHeader()))
+
+	// the block signed by the most validators is selected
+	e.observe(1, c.HashHeader(), pbft.PrepareHash(c.HashHeader()), cipher.SignHash(pbft.PrepareHash(c.HashHeader()), sks[0]))
+	e.observe(1, c.HashHeader(), pbft.PrepareHash(c.HashHeader()), cipher.SignHash(pbft.PrepareHash(c.HashHeader()), sks[1]))
+	e.observe(1, c.HashHeader(), pbft.PrepareHash(c.HashHeader()), cipher.SignHash(pbft.PrepareHash(c.HashHeader()), sks[3]))
+	require.False(t, v.engine.IsFinal(hash))
+
+	// the signatures of every validator for every block of the height are counted
+	d := makeTestBlock(sks[3], 1, 114)
+	for _, sk := range sks {
+		e.observe(1, d.HashHeader(), pbft.PrepareHash(d.HashHeader()), cipher.SignHash(pbft.PrepareHash(d.HashHeader()), sk))
+	}
+	require.Equal(t, len(sks), e.stats[1].GetSignerCount(d.HashHeader()))
+
+	// the heights executed already are dropped
+	store := v.Blockchain.(*Blockchain).store.(*fakeChainStore)
+	store.blocks = append(store.blocks, c)
+	e.observe(2, hash, hash, b.Sig)
+	require.Len(t, e.stats, 1)
+	require.NotNil(t, e.stats[2])
+}
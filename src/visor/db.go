@@ -20,7 +20,7 @@ import (
 func loadBlockchain(db *bolt.DB, pubkey []cipher.PubKey, arbitrating bool) (*bolt.DB, *Blockchain, error) {
 	logger.Info("Loading blockchain")
 
-	bc, err := NewBlockchain(db, pubkey, Arbitrating(arbitrating))
+	bc, err := newBlockchain(db, pubkey, arbitrating)
 	if err == nil {
 		return db, bc, nil
 	}
@@ -52,7 +52,7 @@ func loadBlockchain(db *bolt.DB, pubkey []cipher.PubKey, arbitrating bool) (*bol
 		return nil, nil, err
 	}
 
-	bc, err = NewBlockchain(db, pubkey, Arbitrating(arbitrating))
+	bc, err = newBlockchain(db, pubkey, arbitrating)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -60,6 +60,17 @@ func loadBlockchain(db *bolt.DB, pubkey []cipher.PubKey, arbitrating bool) (*bol
 	return db, bc, nil
 }
 
+// newBlockchain creates the blockchain, block signatures are verified against
+// the validator set versions stored in the db
+func newBlockchain(db *bolt.DB, pubkey []cipher.PubKey, arbitrating bool) (*Blockchain, error) {
+	tn, err := blockdb.NewTrustNode(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBlockchain(db, pubkey, Arbitrating(arbitrating), ValidatorSets(tn))
+}
+
 // OpenDB opens the blockdb
 func OpenDB(dbFile string, readOnly bool) (*bolt.DB, error) {
 	db, err := bolt.Open(dbFile, 0600, &bolt.Options{
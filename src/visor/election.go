@@ -0,0 +1,175 @@
+package visor
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/util/droplet"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+// ValidatorElection is the result of the last validator election
+type ValidatorElection struct {
+	Epoch      uint64
+	Validators []cipher.PubKey
+	Tallies    []blockdb.VoteTally
+}
+
+// ReadableVoteTally stake weight behind a candidate
+type ReadableVoteTally struct {
+	Address string `json:"address"`
+	PubKey  string `json:"pubkey"`
+	Weight  string `json:"weight"`
+	Voters  uint64 `json:"voters"`
+	Elected bool   `json:"elected"`
+}
+
+// ReadableValidatorElection readable result of the last validator election
+type ReadableValidatorElection struct {
+	Enabled    bool                `json:"enabled"`
+	Epoch      uint64              `json:"epoch"`
+	Validators []string            `json:"validators"`
+	Tallies    []ReadableVoteTally `json:"tallies"`
+}
+
+// NewReadableValidatorElection creates ReadableValidatorElection
+func NewReadableValidatorElection(enabled bool, e *ValidatorElection) (*ReadableValidatorElection, error) {
+	elected := make(map[cipher.PubKey]struct{}, len(e.Validators))
+	validators := make([]string, 0, len(e.Validators))
+	for _, pk := range e.Validators {
+		elected[pk] = struct{}{}
+		validators = append(validators, pk.Hex())
+	}
+
+	tallies := make([]ReadableVoteTally, 0, len(e.Tallies))
+	for _, t := range e.Tallies {
+		weight, err := droplet.ToString(t.Weight)
+		if err != nil {
+			return nil, err
+		}
+		_, ok := elected[t.PubKey]
+		tallies = append(tallies, ReadableVoteTally{
+			Address: t.Address.String(),
+			PubKey:  t.PubKey.Hex(),
+			Weight:  weight,
+			Voters:  t.Voters,
+			Elected: ok,
+		})
+	}
+
+	return &ReadableValidatorElection{
+		Enabled:    enabled,
+		Epoch:      e.Epoch,
+		Validators: validators,
+		Tallies:    tallies,
+	}, nil
+}
+
+// applyVotesWithTx records the ballots of the vote transactions in the block
+func (vs *Visor) applyVotesWithTx(tx *bolt.Tx, txns coin.Transactions) error {
+	if vs.votes == nil {
+		return nil
+	}
+	for i := range txns {
+		if txns[i].Type != coin.TxTypeVote {
+			continue
+		}
+		voter, candidate, err := txns[i].VoteBallot()
+		if err != nil {
+			return err
+		}
+		if err := vs.votes.AddBallotWithTx(tx, voter, candidate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maybeElectValidatorsWithTx elects the validators of a new epoch when the block is the first
+// one of the epoch, elected is false if no election was held. The stake is counted after
+// the block is executed, so every node elects the same set at the same height.
+func (vs *Visor) maybeElectValidatorsWithTx(tx *bolt.Tx, b coin.Block) (validators []cipher.PubKey, elected bool, err error) {
+	if !vs.Config.VoteElection || vs.votes == nil {
+		return nil, false, nil
+	}
+
+	epoch := uint64(dpos.Epoch(int64(b.Time())))
+	last, _, ok, err := vs.votes.GetElectedWithTx(tx)
+	if err != nil {
+		return nil, false, err
+	}
+	if ok && epoch <= last {
+		return nil, false, nil
+	}
+
+	// ballots name the keys the candidates had when they were cast
+	candidates, err := vs.configuredValidatorsWithTx(tx)
+	if err != nil {
+		return nil, false, err
+	}
+	tallies, err := vs.votes.TallyWithTx(tx, vs.Blockchain.Unspent(), candidates)
+	if err != nil {
+		return nil, false, err
+	}
+
+	n := vs.Config.ElectedValidatorNum
+	if n <= 0 {
+		n = len(candidates)
+	}
+	validators = blockdb.Elect(tallies, n)
+	if len(validators) == 0 {
+		validators = candidates
+	}
+	rotations, err := vs.keyRotationsWithTx(tx)
+	if err != nil {
+		return nil, false, err
+	}
+	validators = rotateAllWith(rotations, validators)
+
+	if err := vs.votes.SetElectionWithTx(tx, epoch, tallies, validators); err != nil {
+		return nil, false, err
+	}
+
+	logger.Infof("Elected %d validators for epoch %d", len(validators), epoch)
+	return validators, true, nil
+}
+
+// GetValidatorElection returns the result of the last validator election
+func (vs *Visor) GetValidatorElection() (*ValidatorElection, error) {
+	epoch, validators, ok, err := vs.votes.GetElected()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		validators = vs.trustList()
+	}
+
+	tallies, err := vs.votes.GetTally()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ValidatorElection{
+		Epoch:      epoch,
+		Validators: validators,
+		Tallies:    tallies,
+	}, nil
+}
+
+// mergePubkeys returns the union of the pubkey lists, keeping the order of first appearance
+func mergePubkeys(lists ...[]cipher.PubKey) []cipher.PubKey {
+	seen := make(map[cipher.PubKey]struct{})
+	merged := []cipher.PubKey{}
+	for _, list := range lists {
+		for _, pk := range list {
+			if _, ok := seen[pk]; ok {
+				continue
+			}
+			seen[pk] = struct{}{}
+			merged = append(merged, pk)
+		}
+	}
+	return merged
+}
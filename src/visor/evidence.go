@@ -0,0 +1,371 @@
+package visor
+
+import (
+	"errors"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/util/utc"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+const (
+	// maxRecentHeaders bounds the pending block headers kept per validator for equivocation checks
+	maxRecentHeaders = 32
+	// maxBlockEvidences bounds the evidence transactions a new block includes
+	maxBlockEvidences = 4
+)
+
+var (
+	// ErrEvidenceSigner is returned when a header of the evidence is not signed by its pubkey
+	ErrEvidenceSigner = errors.New("evidence header is not signed by the pubkey")
+	// ErrEvidenceNoConflict is returned when the headers of the evidence do not conflict
+	ErrEvidenceNoConflict = errors.New("evidence headers do not conflict")
+	// ErrEvidenceNotValidator is returned when the pubkey of the evidence is not a validator
+	ErrEvidenceNotValidator = errors.New("evidence pubkey is not a validator")
+	// ErrEvidenceNotProducer is returned when the pubkey of the evidence was not scheduled to
+	// produce a header of the evidence
+	ErrEvidenceNotProducer = errors.New("evidence pubkey is not the producer of the header")
+	// ErrEvidenceAboveBlock is returned when a block includes evidence of a height above its own
+	ErrEvidenceAboveBlock = errors.New("evidence header is above the block including it")
+	// ErrEvidenceIncluded is returned when a block includes evidence which a block included already
+	ErrEvidenceIncluded = errors.New("evidence is included by a block already")
+)
+
+// ReadableSignedHeader readable block header with the signature of its producer
+type ReadableSignedHeader struct {
+	Header ReadableBlockHeader `json:"header"`
+	Sig    string              `json:"sig"`
+}
+
+// ReadableEvidence readable evidence of a double signing validator
+type ReadableEvidence struct {
+	PubKey     string                 `json:"pubkey"`
+	Address    string                 `json:"address"`
+	ReportedAt uint64                 `json:"reported_at"`
+	Headers    []ReadableSignedHeader `json:"headers"`
+}
+
+// NewReadableEvidence creates ReadableEvidence
+func NewReadableEvidence(e blockdb.Evidence) ReadableEvidence {
+	headers := make([]ReadableSignedHeader, 0, 2)
+	for _, sh := range []blockdb.SignedHeader{e.First, e.Second} {
+		headers = append(headers, ReadableSignedHeader{
+			Header: NewReadableBlockHeader(&sh.Header),
+			Sig:    sh.Sig.Hex(),
+		})
+	}
+
+	return ReadableEvidence{
+		PubKey:     e.PubKey.Hex(),
+		Address:    cipher.AddressFromPubKey(e.PubKey).String(),
+		ReportedAt: e.ReportedAt,
+		Headers:    headers,
+	}
+}
+
+// NewReadableEvidences creates []ReadableEvidence
+func NewReadableEvidences(evidences []blockdb.Evidence) []ReadableEvidence {
+	rs := make([]ReadableEvidence, 0, len(evidences))
+	for _, e := range evidences {
+		rs = append(rs, NewReadableEvidence(e))
+	}
+	return rs
+}
+
+// conflictingHeaders returns true if one producer must not sign both headers.
+// Two blocks of the same slot always conflict. An honest validator proposes a
+// height on the same parent again only after its earlier block was dropped,
+// which takes pbft.PendingBlockTimeout.
+func conflictingHeaders(a, b coin.BlockHeader) bool {
+	if a.Hash() == b.Hash() {
+		return false
+	}
+	if dpos.PrevSlot(int64(a.Time)) == dpos.PrevSlot(int64(b.Time)) {
+		return true
+	}
+	if a.BkSeq != b.BkSeq || a.PrevHash != b.PrevHash {
+		return false
+	}
+	if a.Time > b.Time {
+		a, b = b, a
+	}
+	return b.Time-a.Time <= pbft.PendingBlockTimeout
+}
+
+// isValidatorAt returns true if the pubkey is in the validator set of the height
+func (vs *Visor) isValidatorAt(pubkey cipher.PubKey, height uint64) bool {
+	return containsPubkey(vs.blockValidators(height), pubkey)
+}
+
+// VerifyEvidence checks that both headers of the evidence are signed as produced blocks by the
+// validator the consensus engine scheduled for them, and that they conflict
+func (vs *Visor) VerifyEvidence(e blockdb.Evidence) error {
+	for _, sh := range []blockdb.SignedHeader{e.First, e.Second} {
+		pubkey, err := cipher.PubKeyFromSig(sh.Sig, sh.Header.Hash())
+		if err != nil {
+			return err
+		}
+		if pubkey != e.PubKey {
+			return ErrEvidenceSigner
+		}
+	}
+
+	if !conflictingHeaders(e.First.Header, e.Second.Header) {
+		return ErrEvidenceNoConflict
+	}
+
+	if !vs.isValidatorAt(e.PubKey, e.First.Header.BkSeq) && !vs.isValidatorAt(e.PubKey, e.Second.Header.BkSeq) {
+		return ErrEvidenceNotValidator
+	}
+
+	for _, sh := range []blockdb.SignedHeader{e.First, e.Second} {
+		if err := vs.engine.CheckProducer(e.PubKey, sh.Header); err != nil {
+			return ErrEvidenceNotProducer
+		}
+	}
+	return nil
+}
+
+// AddEvidence verifies and stores evidence received from a peer, returns false if it is known already
+func (vs *Visor) AddEvidence(e blockdb.Evidence) (bool, error) {
+	e = blockdb.NewEvidence(e.PubKey, e.First, e.Second)
+	if vs.evidences.Has(e) {
+		return false, nil
+	}
+	if err := vs.VerifyEvidence(e); err != nil {
+		return false, err
+	}
+	return vs.storeEvidence(e)
+}
+
+func (vs *Visor) storeEvidence(e blockdb.Evidence) (bool, error) {
+	e.ReportedAt = uint64(utc.UnixNow())
+	added, err := vs.evidences.Add(e)
+	if err != nil {
+		return false, err
+	}
+	if added {
+		logger.Warningf("Validator %s signed conflicting blocks %d and %d", e.PubKey.Hex(), e.First.Header.BkSeq, e.Second.Header.BkSeq)
+	}
+	return added, nil
+}
+
+// evidenceTxn returns the transaction which includes the evidence in a block
+func evidenceTxn(e blockdb.Evidence) coin.Transaction {
+	return coin.NewEvidenceTransaction(
+		[2]coin.BlockHeader{e.First.Header, e.Second.Header},
+		[2]cipher.Sig{e.First.Sig, e.Second.Sig})
+}
+
+// evidenceOfTxn returns the evidence of an evidence transaction, its pubkey is the signer of
+// the first header. The evidence is not verified.
+func evidenceOfTxn(txn coin.Transaction) (blockdb.Evidence, error) {
+	headers, sigs, err := txn.EvidenceHeaders()
+	if err != nil {
+		return blockdb.Evidence{}, err
+	}
+	pubkey, err := cipher.PubKeyFromSig(sigs[0], headers[0].Hash())
+	if err != nil {
+		return blockdb.Evidence{}, err
+	}
+	return blockdb.NewEvidence(pubkey,
+		blockdb.SignedHeader{Header: headers[0], Sig: sigs[0]},
+		blockdb.SignedHeader{Header: headers[1], Sig: sigs[1]}), nil
+}
+
+// verifyEvidences checks every evidence transaction of the block proves that a validator of a
+// height not above the block signed conflicting headers, and that no block included it before
+func (vs *Visor) verifyEvidences(b coin.SignedBlock) error {
+	keys := make(map[cipher.SHA256]struct{})
+	for _, txn := range b.Body.Transactions {
+		if txn.Type != coin.TxTypeEvidence {
+			continue
+		}
+		e, err := evidenceOfTxn(txn)
+		if err != nil {
+			return err
+		}
+		if e.First.Header.BkSeq > b.Seq() || e.Second.Header.BkSeq > b.Seq() {
+			return ErrEvidenceAboveBlock
+		}
+		if err := vs.VerifyEvidence(e); err != nil {
+			return err
+		}
+
+		if _, ok := keys[e.Key()]; ok {
+			return ErrEvidenceIncluded
+		}
+		keys[e.Key()] = struct{}{}
+		if vs.evidences != nil {
+			included, err := vs.evidences.IsIncluded(e)
+			if err != nil {
+				return err
+			}
+			if included {
+				return ErrEvidenceIncluded
+			}
+		}
+	}
+	return nil
+}
+
+// applyEvidencesWithTx records the evidence included by the block, the validators it proves
+// double signing are jailed at the next epoch boundary
+func (vs *Visor) applyEvidencesWithTx(tx *bolt.Tx, b coin.Block) error {
+	if vs.evidences == nil {
+		return nil
+	}
+	epoch := uint64(dpos.Epoch(int64(b.Time())))
+	for _, txn := range b.Body.Transactions {
+		if txn.Type != coin.TxTypeEvidence {
+			continue
+		}
+		e, err := evidenceOfTxn(txn)
+		if err != nil {
+			return err
+		}
+		ok, err := vs.evidences.IncludeWithTx(tx, e, b.Seq(), epoch)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrEvidenceIncluded
+		}
+		logger.Warningf("Block %d includes the evidence of validator %s signing conflicting blocks", b.Seq(), e.PubKey.Hex())
+	}
+	return nil
+}
+
+// addEvidences appends to the new block the transactions of the stored evidence which neither
+// a block nor the pending blocks it extends included yet, at most maxBlockEvidences
+func (vs *Visor) addEvidences(b *coin.Block, st pendingState) error {
+	if vs.evidences == nil {
+		return nil
+	}
+	evidences, err := vs.evidences.GetAll()
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for _, e := range evidences {
+		if n == maxBlockEvidences {
+			break
+		}
+		if e.Height != 0 || e.First.Header.BkSeq > b.Seq() || e.Second.Header.BkSeq > b.Seq() {
+			continue
+		}
+		if _, ok := st.evidences[e.Key()]; ok {
+			continue
+		}
+		if err := vs.VerifyEvidence(e); err != nil {
+			continue
+		}
+		b.Body.Transactions = append(b.Body.Transactions, evidenceTxn(e))
+		n++
+	}
+	if n > 0 {
+		b.Head.BodyHash = b.HashBody()
+	}
+	return nil
+}
+
+// signedHeadersOf returns the known block headers signed by the pubkey which may conflict with
+// a block at the height: the block of the height and the head block in the chain, the pending
+// blocks and the recently seen pending block headers.
+func (vs *Visor) signedHeadersOf(pubkey cipher.PubKey, height uint64) []blockdb.SignedHeader {
+	blocks := []coin.SignedBlock{}
+	if b, err := vs.Blockchain.GetBlockBySeq(height); err == nil && b != nil {
+		blocks = append(blocks, *b)
+	}
+	if head, err := vs.Blockchain.Head(); err == nil && head.Seq() != height {
+		blocks = append(blocks, *head)
+	}
+	if vs.pbft != nil {
+		for _, hash := range vs.pbft.WaitingConfirmedBlockHash() {
+			if b, err := vs.pbft.GetSignedBlock(hash); err == nil {
+				blocks = append(blocks, b)
+			}
+		}
+	}
+
+	headers := []blockdb.SignedHeader{}
+	for _, b := range blocks {
+		if b.Seq() == 0 {
+			continue
+		}
+		signer, err := cipher.PubKeyFromSig(b.Sig, b.HashHeader())
+		if err != nil || signer != pubkey {
+			continue
+		}
+		headers = append(headers, blockdb.SignedHeader{Header: b.Block.Head, Sig: b.Sig})
+	}
+
+	vs.headersMutex.Lock()
+	headers = append(headers, vs.recentHeaders[pubkey]...)
+	vs.headersMutex.Unlock()
+	return headers
+}
+
+// rememberHeader keeps the header for later equivocation checks
+func (vs *Visor) rememberHeader(pubkey cipher.PubKey, sh blockdb.SignedHeader) {
+	vs.headersMutex.Lock()
+	defer vs.headersMutex.Unlock()
+	if vs.recentHeaders == nil {
+		vs.recentHeaders = make(map[cipher.PubKey][]blockdb.SignedHeader)
+	}
+	hash := sh.Header.Hash()
+	for _, h := range vs.recentHeaders[pubkey] {
+		if h.Header.Hash() == hash {
+			return
+		}
+	}
+	headers := append(vs.recentHeaders[pubkey], sh)
+	if len(headers) > maxRecentHeaders {
+		headers = headers[len(headers)-maxRecentHeaders:]
+	}
+	vs.recentHeaders[pubkey] = headers
+}
+
+// DetectEquivocation checks a pending block against the blocks its producer signed before.
+// If it conflicts with one of them the evidence is stored and returned, nil is returned if
+// the evidence was known already.
+func (vs *Visor) DetectEquivocation(b coin.SignedBlock) (*blockdb.Evidence, error) {
+	if vs.evidences == nil || b.Seq() == 0 {
+		return nil, nil
+	}
+
+	signer, err := cipher.PubKeyFromSig(b.Sig, b.HashHeader())
+	if err != nil {
+		return nil, err
+	}
+	if !vs.isValidatorAt(signer, b.Seq()) {
+		return nil, nil
+	}
+
+	sh := blockdb.SignedHeader{Header: b.Block.Head, Sig: b.Sig}
+	for _, known := range vs.signedHeadersOf(signer, b.Seq()) {
+		if !conflictingHeaders(known.Header, sh.Header) {
+			continue
+		}
+		e := blockdb.NewEvidence(signer, known, sh)
+		added, err := vs.storeEvidence(e)
+		if err != nil || !added {
+			return nil, err
+		}
+		return &e, nil
+	}
+
+	vs.rememberHeader(signer, sh)
+	return nil, nil
+}
+
+// GetEvidences returns the stored evidence of double signing validators
+func (vs *Visor) GetEvidences() ([]blockdb.Evidence, error) {
+	return vs.evidences.GetAll()
+}
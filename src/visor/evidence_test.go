@@ -0,0 +1,270 @@
+package visor
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/testutil"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+func TestConflictingHeaders(t *testing.T) {
+	parent := cipher.SHA256{1}
+	cases := []struct {
+		name     string
+		a, b     coin.BlockHeader
+		conflict bool
+	}{
+		{
+			name: "same header",
+			a:    coin.BlockHeader{BkSeq: 2, Time: 1141, PrevHash: parent},
+			b:    coin.BlockHeader{BkSeq: 2, Time: 1141, PrevHash: parent},
+		},
+		{
+			name:     "same slot",
+			a:        coin.BlockHeader{BkSeq: 2, Time: 1141, PrevHash: parent},
+			b:        coin.BlockHeader{BkSeq: 3, Time: 1145},
+			conflict: true,
+		},
+		{
+			name:     "same height and parent",
+			a:        coin.BlockHeader{BkSeq: 2, Time: 1141, PrevHash: parent},
+			b:        coin.BlockHeader{BkSeq: 2, Time: 1171, PrevHash: parent},
+			conflict: true,
+		},
+		{
+			name: "same height after the pending block timeout",
+			a:    coin.BlockHeader{BkSeq: 2, Time: 1141, PrevHash: parent},
+			b:    coin.BlockHeader{BkSeq: 2, Time: 1141 + pbft.PendingBlockTimeout + 10, PrevHash: parent},
+		},
+		{
+			name: "same height on another parent",
+			a:    coin.BlockHeader{BkSeq: 2, Time: 1141, PrevHash: parent},
+			b:    coin.BlockHeader{BkSeq: 2, Time: 1171, PrevHash: cipher.SHA256{2}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.conflict, conflictingHeaders(tc.a, tc.b))
+			require.Equal(t, tc.conflict, conflictingHeaders(tc.b, tc.a))
+		})
+	}
+}
+
+// newTestDpos returns a schedule of the single validator, it produces every block
+func newTestDpos(t *testing.T, pk cipher.PubKey) *dpos.Dpos {
+	d := dpos.NewDpos(pk)
+	require.NoError(t, d.SetTrustNode([]cipher.PubKey{pk}))
+	return d
+}
+
+func TestDetectEquivocation(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	tn, err := blockdb.NewTrustNode(db)
+	require.NoError(t, err)
+	evidences, err := blockdb.NewEvidences(db)
+	require.NoError(t, err)
+
+	pk, sk := cipher.GenerateKeyPair()
+	_, otherSk := cipher.GenerateKeyPair()
+	require.NoError(t, tn.AddValidatorSet(blockdb.ValidatorSet{Pubkeys: []cipher.PubKey{pk}}))
+
+	bs := makeBlocksAt(t, []uint64{1100})
+	v := &Visor{
+		Blockchain: &Blockchain{
+			store: &fakeChainStore{blocks: bs},
+		},
+		pbft:      pbft.NewPBFT(),
+		trustNode: tn,
+		evidences: evidences,
+		dpos:      newTestDpos(t, pk),
+	}
+	v.engine = dposPbftEngine{vs: v}
+
+	sign := func(b *coin.Block, sk cipher.SecKey) coin.SignedBlock {
+		return coin.SignedBlock{
+			Block: *b,
+			Sig:   cipher.SignHash(b.HashHeader(), sk),
+		}
+	}
+
+	first := sign(makeBlock(t, bs[1].Block, 1145), sk)
+	e, err := v.DetectEquivocation(first)
+	require.NoError(t, err)
+	require.Nil(t, e)
+	require.NoError(t, v.pbft.AddSignedBlock(first))
+
+	// a block of another producer is not compared
+	e, err = v.DetectEquivocation(sign(makeBlock(t, bs[1].Block, 1145), otherSk))
+	require.NoError(t, err)
+	require.Nil(t, e)
+
+	// the validator proposes the height again after its block was dropped
+	later := sign(makeBlock(t, bs[1].Block, 1145+pbft.PendingBlockTimeout+10), sk)
+	e, err = v.DetectEquivocation(later)
+	require.NoError(t, err)
+	require.Nil(t, e)
+
+	second := sign(makeBlock(t, bs[1].Block, 1146), sk)
+	e, err = v.DetectEquivocation(second)
+	require.NoError(t, err)
+	require.NotNil(t, e)
+	require.Equal(t, pk, e.PubKey)
+	require.NoError(t, v.VerifyEvidence(*e))
+
+	// known evidence is reported once
+	e, err = v.DetectEquivocation(second)
+	require.NoError(t, err)
+	require.Nil(t, e)
+
+	// pending blocks which were dropped are still remembered
+	v.pbft = pbft.NewPBFT()
+	third := sign(makeBlock(t, bs[1].Block, 1147), sk)
+	e, err = v.DetectEquivocation(third)
+	require.NoError(t, err)
+	require.NotNil(t, e)
+
+	stored, err := v.GetEvidences()
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	for _, s := range stored {
+		require.NotZero(t, s.ReportedAt)
+	}
+}
+
+func TestAddEvidence(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	tn, err := blockdb.NewTrustNode(db)
+	require.NoError(t, err)
+	evidences, err := blockdb.NewEvidences(db)
+	require.NoError(t, err)
+
+	pk, sk := cipher.GenerateKeyPair()
+	otherPk, otherSk := cipher.GenerateKeyPair()
+	require.NoError(t, tn.AddValidatorSet(blockdb.ValidatorSet{Pubkeys: []cipher.PubKey{pk}}))
+
+	v := &Visor{
+		trustNode: tn,
+		evidences: evidences,
+		dpos:      newTestDpos(t, pk),
+	}
+	v.engine = dposPbftEngine{vs: v}
+
+	signed := func(h coin.BlockHeader, sk cipher.SecKey) blockdb.SignedHeader {
+		return blockdb.SignedHeader{Header: h, Sig: cipher.SignHash(h.Hash(), sk)}
+	}
+	a := coin.BlockHeader{BkSeq: 2, Time: 1141}
+	b := coin.BlockHeader{BkSeq: 2, Time: 1142}
+	c := coin.BlockHeader{BkSeq: 3, Time: 1151}
+
+	// the prepare votes of a validator do not sign the headers of produced blocks
+	prepared := func(h coin.BlockHeader) blockdb.SignedHeader {
+		return blockdb.SignedHeader{Header: h, Sig: cipher.SignHash(pbft.PrepareHash(h.Hash()), sk)}
+	}
+	_, err = v.AddEvidence(blockdb.Evidence{PubKey: pk, First: prepared(a), Second: prepared(b)})
+	require.Equal(t, ErrEvidenceSigner, err)
+
+	// a validator is accused only of the blocks of its slots
+	v.dpos = newTestDpos(t, otherPk)
+	_, err = v.AddEvidence(blockdb.Evidence{PubKey: pk, First: signed(a, sk), Second: signed(b, sk)})
+	require.Equal(t, ErrEvidenceNotProducer, err)
+	v.dpos = newTestDpos(t, pk)
+
+	_, err = v.AddEvidence(blockdb.Evidence{PubKey: pk, First: signed(a, sk), Second: signed(b, otherSk)})
+	require.Equal(t, ErrEvidenceSigner, err)
+
+	_, err = v.AddEvidence(blockdb.Evidence{PubKey: pk, First: signed(a, sk), Second: signed(c, sk)})
+	require.Equal(t, ErrEvidenceNoConflict, err)
+
+	_, err = v.AddEvidence(blockdb.Evidence{PubKey: otherPk, First: signed(a, otherSk), Second: signed(b, otherSk)})
+	require.Equal(t, ErrEvidenceNotValidator, err)
+
+	e := blockdb.Evidence{PubKey: pk, First: signed(a, sk), Second: signed(b, sk)}
+	added, err := v.AddEvidence(e)
+	require.NoError(t, err)
+	require.True(t, added)
+
+	// the same evidence with the headers swapped is known
+	added, err = v.AddEvidence(blockdb.Evidence{PubKey: pk, First: e.Second, Second: e.First})
+	require.NoError(t, err)
+	require.False(t, added)
+}
+
+func TestEvidenceTransactions(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	tn, err := blockdb.NewTrustNode(db)
+	require.NoError(t, err)
+	evidences, err := blockdb.NewEvidences(db)
+	require.NoError(t, err)
+
+	pk, sk := cipher.GenerateKeyPair()
+	require.NoError(t, tn.AddValidatorSet(blockdb.ValidatorSet{Pubkeys: []cipher.PubKey{pk}}))
+
+	v := &Visor{
+		db:        db,
+		trustNode: tn,
+		evidences: evidences,
+		dpos:      newTestDpos(t, pk),
+	}
+	v.engine = dposPbftEngine{vs: v}
+
+	signed := func(h coin.BlockHeader) blockdb.SignedHeader {
+		return blockdb.SignedHeader{Header: h, Sig: cipher.SignHash(h.Hash(), sk)}
+	}
+	e := blockdb.NewEvidence(pk, signed(coin.BlockHeader{BkSeq: 2, Time: 1141}), signed(coin.BlockHeader{BkSeq: 2, Time: 1142}))
+	added, err := v.AddEvidence(e)
+	require.NoError(t, err)
+	require.True(t, added)
+
+	// a block below the headers does not include the evidence
+	b := coin.Block{Head: coin.BlockHeader{BkSeq: 1, Time: 1150}}
+	require.NoError(t, v.addEvidences(&b, pendingState{}))
+	require.Empty(t, b.Body.Transactions)
+	b.Body.Transactions = coin.Transactions{evidenceTxn(e)}
+	require.Equal(t, ErrEvidenceAboveBlock, v.verifyEvidences(coin.SignedBlock{Block: b}))
+
+	// nor does a block extending a pending block which includes it
+	b = coin.Block{Head: coin.BlockHeader{BkSeq: 3, Time: 1150}}
+	require.NoError(t, v.addEvidences(&b, pendingState{evidences: map[cipher.SHA256]struct{}{e.Key(): {}}}))
+	require.Empty(t, b.Body.Transactions)
+
+	require.NoError(t, v.addEvidences(&b, pendingState{}))
+	require.Len(t, b.Body.Transactions, 1)
+	require.Equal(t, b.HashBody(), b.Head.BodyHash)
+	got, err := evidenceOfTxn(b.Body.Transactions[0])
+	require.NoError(t, err)
+	require.Equal(t, e.Key(), got.Key())
+	require.Equal(t, pk, got.PubKey)
+	require.NoError(t, v.verifyEvidences(coin.SignedBlock{Block: b}))
+
+	twice := b
+	twice.Body.Transactions = append(coin.Transactions{evidenceTxn(e)}, b.Body.Transactions...)
+	require.Equal(t, ErrEvidenceIncluded, v.verifyEvidences(coin.SignedBlock{Block: twice}))
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return v.applyEvidencesWithTx(tx, b)
+	}))
+	stored, err := v.GetEvidences()
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	require.Equal(t, uint64(3), stored[0].Height)
+
+	// a block includes the evidence once
+	require.Equal(t, ErrEvidenceIncluded, v.verifyEvidences(coin.SignedBlock{Block: b}))
+	next := coin.Block{Head: coin.BlockHeader{BkSeq: 4, Time: 1160}}
+	require.NoError(t, v.addEvidences(&next, pendingState{}))
+	require.Empty(t, next.Body.Transactions)
+}
@@ -0,0 +1,315 @@
+package visor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+var (
+	// ErrGoverned is returned when the trust list or the quorum is set
+	// outside of the chain after a governance transaction took effect
+	ErrGoverned = errors.New("validator set and quorum are governed by transactions")
+	// ErrGovernanceApprovals is returned when too few validators signed a governance transaction
+	ErrGovernanceApprovals = errors.New("governance transaction is not approved by enough validators")
+)
+
+// ReadableGovernanceProposal readable validator set or quorum change
+type ReadableGovernanceProposal struct {
+	Type        string   `json:"type"`
+	Txid        string   `json:"txid"`
+	Height      uint64   `json:"height"`
+	Epoch       uint64   `json:"epoch"`
+	ActiveEpoch uint64   `json:"active_epoch"`
+	Validators  []string `json:"validators,omitempty"`
+	Quorum      uint64   `json:"quorum,omitempty"`
+	Approvals   []string `json:"approvals"`
+}
+
+// ReadableGovernance readable governance changes
+type ReadableGovernance struct {
+	Threshold int                          `json:"threshold"`
+	Pending   []ReadableGovernanceProposal `json:"pending"`
+	Active    []ReadableGovernanceProposal `json:"active"`
+}
+
+// Governance the governance changes waiting for the next epoch and the ones in effect
+type Governance struct {
+	Threshold int
+	Pending   []blockdb.GovernanceProposal
+	Active    []blockdb.GovernanceProposal
+}
+
+func governanceTypeString(txType uint8) string {
+	switch txType {
+	case coin.TxTypeValidatorSet:
+		return "validator_set"
+	case coin.TxTypeQuorum:
+		return "quorum"
+	}
+	return "unknown"
+}
+
+func pubkeysHex(pubkeys []cipher.PubKey) []string {
+	hexes := make([]string, 0, len(pubkeys))
+	for _, pk := range pubkeys {
+		hexes = append(hexes, pk.Hex())
+	}
+	return hexes
+}
+
+func newReadableGovernanceProposals(ps []blockdb.GovernanceProposal) []ReadableGovernanceProposal {
+	rps := make([]ReadableGovernanceProposal, 0, len(ps))
+	for _, p := range ps {
+		rps = append(rps, ReadableGovernanceProposal{
+			Type:        governanceTypeString(p.Type),
+			Txid:        p.Txid.Hex(),
+			Height:      p.Height,
+			Epoch:       p.Epoch,
+			ActiveEpoch: p.ActiveEpoch,
+			Validators:  pubkeysHex(p.Validators),
+			Quorum:      p.Quorum,
+			Approvals:   pubkeysHex(p.Approvals),
+		})
+	}
+	return rps
+}
+
+// NewReadableGovernance creates ReadableGovernance
+func NewReadableGovernance(g *Governance) *ReadableGovernance {
+	return &ReadableGovernance{
+		Threshold: g.Threshold,
+		Pending:   newReadableGovernanceProposals(g.Pending),
+		Active:    newReadableGovernanceProposals(g.Active),
+	}
+}
+
+// governanceThreshold returns the approvals a governance transaction needs from the validators,
+// Config.GovernanceThreshold or more than two thirds of them
+func (vs *Visor) governanceThreshold(validators []cipher.PubKey) int {
+	n := vs.Config.GovernanceThreshold
+	if n <= 0 || n > len(validators) {
+		n = len(validators)*2/3 + 1
+	}
+	return n
+}
+
+// validatorsAt returns the validators of the block height recorded in the chain,
+// nil if no validator set is recorded for it
+func (vs *Visor) validatorsAt(height uint64) []cipher.PubKey {
+	validators, _ := vs.validatorSetAt(height)
+	return validators
+}
+
+// validatorsAtWithTx is validatorsAt with *bolt.Tx
+func (vs *Visor) validatorsAtWithTx(tx *bolt.Tx, height uint64) ([]cipher.PubKey, error) {
+	if vs.trustNode == nil {
+		return nil, nil
+	}
+	set, ok, err := vs.trustNode.GetValidatorSetWithTx(tx, height)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return set.Pubkeys, nil
+}
+
+// verifyGovernance checks the governance transaction of the block at the height is signed
+// by enough of the validators of that height and returns the change it proposes. The pubkeys
+// of the proposed validators must be known, they are the validators, the trust list recorded
+// in the chain, or a new validator makes its pubkey known by signing one of the inputs.
+func (vs *Visor) verifyGovernance(txn *coin.Transaction, height uint64, validators, trusted []cipher.PubKey) (blockdb.GovernanceProposal, error) {
+	signers, err := txn.InputSigners()
+	if err != nil {
+		return blockdb.GovernanceProposal{}, err
+	}
+
+	approvals := []cipher.PubKey{}
+	for _, pk := range signers {
+		if containsPubkey(validators, pk) {
+			approvals = append(approvals, pk)
+		}
+	}
+	if len(approvals) < vs.governanceThreshold(validators) {
+		return blockdb.GovernanceProposal{}, ErrGovernanceApprovals
+	}
+
+	p := blockdb.GovernanceProposal{
+		Type:      txn.Type,
+		Txid:      txn.Hash(),
+		Height:    height,
+		Approvals: approvals,
+	}
+
+	switch txn.Type {
+	case coin.TxTypeValidatorSet:
+		addrs, err := txn.ValidatorSetProposal()
+		if err != nil {
+			return blockdb.GovernanceProposal{}, err
+		}
+		known := make(map[cipher.Address]cipher.PubKey)
+		for _, pk := range mergePubkeys(validators, trusted, signers) {
+			known[cipher.AddressFromPubKey(pk)] = pk
+		}
+		for _, addr := range addrs {
+			pk, ok := known[addr]
+			if !ok {
+				return blockdb.GovernanceProposal{}, fmt.Errorf("pubkey of proposed validator %s is unknown", addr)
+			}
+			p.Validators = append(p.Validators, pk)
+		}
+	case coin.TxTypeQuorum:
+		if p.Quorum, err = txn.QuorumProposal(); err != nil {
+			return blockdb.GovernanceProposal{}, err
+		}
+	default:
+		return blockdb.GovernanceProposal{}, errors.New("not a governance transaction")
+	}
+
+	return p, nil
+}
+
+// applyGovernanceWithTx records the governance transactions of the block as pending changes,
+// a transaction without enough approvals is ignored
+func (vs *Visor) applyGovernanceWithTx(tx *bolt.Tx, b coin.Block) error {
+	if vs.governance == nil {
+		return nil
+	}
+	epoch := uint64(dpos.Epoch(int64(b.Time())))
+	for i := range b.Body.Transactions {
+		txn := &b.Body.Transactions[i]
+		if txn.Type != coin.TxTypeValidatorSet && txn.Type != coin.TxTypeQuorum {
+			continue
+		}
+		validators, err := vs.validatorsAtWithTx(tx, b.Seq())
+		if err != nil {
+			return err
+		}
+		trusted, err := vs.trustListWithTx(tx)
+		if err != nil {
+			return err
+		}
+		p, err := vs.verifyGovernance(txn, b.Seq(), validators, trusted)
+		if err != nil {
+			logger.Warningf("Ignore governance transaction %s: %v", txn.Hash().Hex(), err)
+			continue
+		}
+		p.Epoch = epoch
+		if err := vs.governance.ProposeWithTx(tx, p); err != nil {
+			return err
+		}
+		logger.Infof("The %s change of transaction %s takes effect at the next epoch", governanceTypeString(p.Type), p.Txid.Hex())
+	}
+	return nil
+}
+
+// updateGovernanceWithTx puts the changes proposed before the epoch into effect,
+// changed is false if none was pending
+func (vs *Visor) updateGovernanceWithTx(tx *bolt.Tx, epoch uint64) (changed bool, err error) {
+	if vs.governance == nil {
+		return false, nil
+	}
+	activated, err := vs.governance.ActivateWithTx(tx, epoch)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range activated {
+		switch p.Type {
+		case coin.TxTypeValidatorSet:
+			if err := vs.trustNode.AddNodePubkeyWithTx(tx, p.Validators); err != nil {
+				return false, err
+			}
+			logger.Infof("Governed validator set of %d validators takes effect at epoch %d", len(p.Validators), epoch)
+		case coin.TxTypeQuorum:
+			if err := vs.trustNode.AddAgressNodeNum(tx, int(p.Quorum)); err != nil {
+				return false, err
+			}
+			logger.Infof("Governed quorum %d takes effect at epoch %d", p.Quorum, epoch)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// IsGoverned returns true if a governance change of the type is in effect, the trust list
+// or the quorum is no longer set by the genesis node then
+func (vs *Visor) IsGoverned(txType uint8) bool {
+	if vs.governance == nil {
+		return false
+	}
+	_, ok, err := vs.governance.GetActive(txType)
+	if err != nil {
+		logger.Errorf("Get active governance change failed: %v", err)
+		return false
+	}
+	return ok
+}
+
+// governedValidators returns the validator set in effect by governance, ok is false if there is none
+func (vs *Visor) governedValidators() ([]cipher.PubKey, bool) {
+	if vs.governance == nil {
+		return nil, false
+	}
+	p, ok, err := vs.governance.GetActive(coin.TxTypeValidatorSet)
+	if err != nil {
+		logger.Errorf("Get governed validator set failed: %v", err)
+		return nil, false
+	}
+	if !ok || len(p.Validators) == 0 {
+		return nil, false
+	}
+	return p.Validators, true
+}
+
+// governedValidatorsWithTx returns the validator set in effect by governance with *bolt.Tx,
+// ok is false if there is none
+func (vs *Visor) governedValidatorsWithTx(tx *bolt.Tx) ([]cipher.PubKey, bool, error) {
+	if vs.governance == nil {
+		return nil, false, nil
+	}
+	p, ok, err := vs.governance.GetActiveWithTx(tx, coin.TxTypeValidatorSet)
+	if err != nil || !ok || len(p.Validators) == 0 {
+		return nil, false, err
+	}
+	return p.Validators, true, nil
+}
+
+// governedQuorumWithTx returns the quorum in effect by governance with *bolt.Tx, 0 if there is none
+func (vs *Visor) governedQuorumWithTx(tx *bolt.Tx) (uint64, error) {
+	if vs.governance == nil {
+		return 0, nil
+	}
+	p, _, err := vs.governance.GetActiveWithTx(tx, coin.TxTypeQuorum)
+	return p.Quorum, err
+}
+
+// GetGovernance returns the pending governance changes and the ones in effect
+func (vs *Visor) GetGovernance() (*Governance, error) {
+	pending, err := vs.governance.GetPending()
+	if err != nil {
+		return nil, err
+	}
+	active, err := vs.governance.GetAllActive()
+	if err != nil {
+		return nil, err
+	}
+	return &Governance{
+		Threshold: vs.governanceThreshold(vs.validatorsAt(vs.HeadBkSeq() + 1)),
+		Pending:   pending,
+		Active:    active,
+	}, nil
+}
+
+func containsPubkey(pubkeys []cipher.PubKey, pubkey cipher.PubKey) bool {
+	for _, pk := range pubkeys {
+		if pk == pubkey {
+			return true
+		}
+	}
+	return false
+}
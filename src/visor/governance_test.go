@@ -0,0 +1,137 @@
+package visor
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/testutil"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+func makeGovernanceTx(t *testing.T, txType uint8, keys []cipher.SecKey, outs []coin.TransactionOutput) coin.Transaction {
+	txn := coin.Transaction{Type: txType}
+	for _, k := range keys {
+		txn.PushInput(cipher.SumSHA256(k[:]))
+	}
+	for _, o := range outs {
+		txn.PushOutput(o.Address, o.Coins, o.Hours)
+	}
+	txn.SignInputs(keys)
+	txn.UpdateHeader()
+	return txn
+}
+
+func TestGovernance(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	pk1, sk1 := cipher.GenerateKeyPair()
+	pk2, sk2 := cipher.GenerateKeyPair()
+	pk3, sk3 := cipher.GenerateKeyPair()
+	pk4, sk4 := cipher.GenerateKeyPair()
+	pk5, _ := cipher.GenerateKeyPair()
+
+	v := newJailTestVisor(t, db, []cipher.PubKey{pk1, pk2, pk3})
+	governance, err := blockdb.NewGovernance(db)
+	require.NoError(t, err)
+	v.governance = governance
+
+	out := func(pk cipher.PubKey, hours uint64) coin.TransactionOutput {
+		return coin.TransactionOutput{Address: cipher.AddressFromPubKey(pk), Coins: 1e6, Hours: hours}
+	}
+
+	// pk4 joins by signing, pk1 and pk2 approve
+	setTx := makeGovernanceTx(t, coin.TxTypeValidatorSet, []cipher.SecKey{sk1, sk4, sk2},
+		[]coin.TransactionOutput{out(pk4, 0), out(pk2, 0), out(pk1, 0)})
+	// the pubkey of pk5 is unknown
+	unknownTx := makeGovernanceTx(t, coin.TxTypeValidatorSet, []cipher.SecKey{sk1, sk2},
+		[]coin.TransactionOutput{out(pk5, 0), out(pk1, 0)})
+	quorumTx := makeGovernanceTx(t, coin.TxTypeQuorum, []cipher.SecKey{sk1, sk3},
+		[]coin.TransactionOutput{out(pk1, 2), out(pk3, 0)})
+
+	applyBlock := func(seq uint64, epoch int64, txns ...coin.Transaction) coin.Block {
+		b := coin.Block{
+			Head: coin.BlockHeader{BkSeq: seq, Time: uint64(dpos.EpochStart(epoch) + 5)},
+			Body: coin.BlockBody{Transactions: txns},
+		}
+		require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+			return v.applyGovernanceWithTx(tx, b)
+		}))
+		return b
+	}
+
+	// two of three validators are not more than two thirds
+	applyBlock(30, 5, setTx)
+	g, err := v.GetGovernance()
+	require.NoError(t, err)
+	require.Equal(t, 3, g.Threshold)
+	require.Empty(t, g.Pending)
+
+	v.Config.GovernanceThreshold = 2
+	// the pubkeys are only known from the chain, not from the trust list of this node
+	trusted := v.Config.TrustPubkeyList
+	v.Config.TrustPubkeyList = append([]cipher.PubKey{pk5}, trusted...)
+	b := applyBlock(31, 5, setTx, unknownTx, quorumTx)
+	v.Config.TrustPubkeyList = trusted
+
+	g, err = v.GetGovernance()
+	require.NoError(t, err)
+	require.Equal(t, 2, g.Threshold)
+	require.Empty(t, g.Active)
+	require.Equal(t, []blockdb.GovernanceProposal{
+		{
+			Type:       coin.TxTypeValidatorSet,
+			Txid:       setTx.Hash(),
+			Height:     31,
+			Epoch:      5,
+			Validators: []cipher.PubKey{pk4, pk2, pk1},
+			Approvals:  []cipher.PubKey{pk1, pk2},
+		},
+		{
+			Type:      coin.TxTypeQuorum,
+			Txid:      quorumTx.Hash(),
+			Height:    31,
+			Epoch:     5,
+			Quorum:    2,
+			Approvals: []cipher.PubKey{pk1, pk3},
+		},
+	}, g.Pending)
+
+	// nothing changes within the epoch
+	startEpoch(t, v, b)
+	validators, ok := v.validatorSetAt(32)
+	require.True(t, ok)
+	require.Equal(t, []cipher.PubKey{pk1, pk2, pk3}, validators)
+	require.False(t, v.IsGoverned(coin.TxTypeValidatorSet))
+
+	b.Head.BkSeq = 40
+	b.Head.Time = uint64(dpos.EpochStart(6) + 5)
+	startEpoch(t, v, b)
+
+	validators, ok = v.validatorSetAt(41)
+	require.True(t, ok)
+	require.Equal(t, []cipher.PubKey{pk4, pk2, pk1}, validators)
+	require.Equal(t, []cipher.PubKey{pk4, pk2, pk1}, v.trustList())
+	require.Equal(t, 2, v.GetAgreeNodeNum())
+	set, ok := v.validatorSet(41)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), set.Quorum)
+	// pk4 validates from the height the set is active at
+	require.False(t, v.IsTrustPubkey(pk4))
+	require.True(t, containsPubkey(v.blockValidators(41), pk4))
+
+	// the genesis node can not override the governed values
+	require.Equal(t, ErrGoverned, v.InsertTrustPubkeyList([]cipher.PubKey{pk1}))
+	require.Equal(t, ErrGoverned, v.InsertAgreeNodeNum(3))
+
+	g, err = v.GetGovernance()
+	require.NoError(t, err)
+	require.Empty(t, g.Pending)
+	require.Len(t, g.Active, 2)
+	require.Equal(t, uint64(6), g.Active[0].ActiveEpoch)
+}
@@ -0,0 +1,49 @@
+package visor
+
+import (
+	"github.com/samoslab/samos/src/coin"
+)
+
+// emptyBlockDue returns true if an empty heartbeat block is to be created at the time,
+// Config.EmptyBlockInterval seconds after the block it extends
+func (vs *Visor) emptyBlockDue(when uint64) bool {
+	if !vs.Config.EmptyBlocks {
+		return false
+	}
+	prev := vs.tipTime()
+	return when > prev && when-prev >= vs.Config.EmptyBlockInterval
+}
+
+// createEmptyBlock creates a signed heartbeat block without transactions,
+// it pays the block rewards if they are on
+func (vs *Visor) createEmptyBlock(when uint64) (coin.PendingSignedBlock, error) {
+	b, err := vs.Blockchain.NewEmptyBlock(when)
+	if err != nil {
+		logger.Warningf("Blockchain.NewEmptyBlock failed: %v", err)
+		return coin.PendingSignedBlock{}, err
+	}
+
+	tip, st, pending, err := vs.pendingTip()
+	if err != nil {
+		return coin.PendingSignedBlock{}, err
+	}
+	if pending {
+		if b, err = vs.extendTip(b, tip, st, when); err != nil {
+			logger.Warningf("Extend pending block %d failed: %v", tip.Seq(), err)
+			return coin.PendingSignedBlock{}, err
+		}
+	}
+
+	if err := vs.addEvidences(b, st); err != nil {
+		logger.Warningf("Add evidence transactions failed: %v", err)
+		return coin.PendingSignedBlock{}, err
+	}
+
+	if err := vs.addCoinbase(b); err != nil {
+		logger.Warningf("Add coinbase transaction failed: %v", err)
+		return coin.PendingSignedBlock{}, err
+	}
+
+	logger.Infof("Creating empty heartbeat block, head time %d", when)
+	return vs.SignBlock(*b)
+}
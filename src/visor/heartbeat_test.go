@@ -0,0 +1,89 @@
+package visor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/signer"
+	"github.com/samoslab/samos/src/testutil"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+func TestVisorCreateEmptyBlock(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	db, bc, err := loadBlockchain(db, []cipher.PubKey{genPublic}, false)
+	require.NoError(t, err)
+
+	cfg := NewVisorConfig()
+	cfg.DBPath = db.Path()
+	cfg.IsMaster = true
+	cfg.BlockchainPubkey = genPublic
+	cfg.BlockchainSeckey = genSecret
+	cfg.BlockchainTrustPubkey = genPublic
+	cfg.BlockchainTrustSeckey = genSecret
+	cfg.GenesisAddress = genAddress
+	cfg.TrustPubkeyList = []cipher.PubKey{genPublic}
+	d := dpos.NewDpos(genPublic)
+	require.NoError(t, d.SetTrustNode(cfg.TrustPubkeyList))
+	tn, err := blockdb.NewTrustNode(db)
+	require.NoError(t, err)
+
+	v := &Visor{
+		Config:      cfg,
+		Unconfirmed: NewUnconfirmedTxnPool(db),
+		Blockchain:  bc,
+		db:          db,
+		pbft:        pbft.NewPBFT(),
+		dpos:        d,
+		trustNode:   tn,
+	}
+	v.engine = dposPbftEngine{vs: v}
+	v.signer = signer.NewLocal(v.TrustSeckey, v.Config.BlockchainSeckey, nil)
+
+	gb := addGenesisBlock(t, v.Blockchain)
+
+	// no empty blocks unless they are on
+	_, err = v.CreateBlock(gb.Time() + 10)
+	testutil.RequireError(t, err, "No transactions")
+
+	// no empty block before the interval passed
+	v.Config.EmptyBlocks = true
+	v.Config.EmptyBlockInterval = 60
+	_, err = v.CreateBlock(gb.Time() + 10)
+	testutil.RequireError(t, err, "No transactions")
+
+	execute := func(when uint64) coin.SignedBlock {
+		sb, err := v.CreateBlock(when)
+		require.NoError(t, err)
+		require.NoError(t, v.AddPendingBlock(sb.ToSignedBlock()))
+		require.NoError(t, v.StartExecuteSignedBlock(sb.HashHeader()))
+		return sb.ToSignedBlock()
+	}
+
+	b := execute(gb.Time() + 60)
+	require.Equal(t, uint64(1), b.Seq())
+	require.Empty(t, b.Body.Transactions)
+	require.Equal(t, uint64(0), b.Head.Fee)
+	require.Equal(t, gb.HashHeader(), b.Head.PrevHash)
+	require.Equal(t, uint64(1), v.HeadBkSeq())
+
+	// every slot without interval, the empty block pays the block reward
+	v.Config.EmptyBlockInterval = 0
+	v.Config.BlockReward = 1e6
+	b = execute(b.Time() + 1)
+	require.Equal(t, uint64(2), v.HeadBkSeq())
+	require.Len(t, b.Body.Transactions, 1)
+	require.Equal(t, coin.TxTypeCoinbase, b.Body.Transactions[0].Type)
+
+	uxs := coin.CreateUnspents(b.Head, b.Body.Transactions[0])
+	require.Len(t, uxs, 1)
+	require.True(t, v.Blockchain.Unspent().Contains(uxs[0].Hash()))
+	require.Equal(t, genAddress, uxs[0].Body.Address)
+}
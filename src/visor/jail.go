@@ -0,0 +1,253 @@
+package visor
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+const (
+	// doubleSignJailEpochs is the epochs a double signing validator stays in jail at least
+	doubleSignJailEpochs = 30
+	// downtimeJailEpochs is the epochs a validator missing its slots stays in jail at least
+	downtimeJailEpochs = 1
+	// minDowntimeSlots is the least slots of a validator in an epoch to jail it for downtime
+	minDowntimeSlots = 100
+)
+
+// ReadableJailRecord readable jailed validator
+type ReadableJailRecord struct {
+	PubKey          string `json:"pubkey"`
+	Address         string `json:"address"`
+	Reason          string `json:"reason"`
+	JailedEpoch     uint64 `json:"jailed_epoch"`
+	ReleaseEpoch    uint64 `json:"release_epoch"`
+	UnjailRequested bool   `json:"unjail_requested"`
+}
+
+// jailReasonString returns the readable reason of a jail record
+func jailReasonString(reason uint8) string {
+	switch reason {
+	case blockdb.JailReasonDoubleSign:
+		return "double_sign"
+	case blockdb.JailReasonDowntime:
+		return "downtime"
+	}
+	return "unknown"
+}
+
+// NewReadableJailRecords creates []ReadableJailRecord
+func NewReadableJailRecords(records []blockdb.JailRecord) []ReadableJailRecord {
+	rs := make([]ReadableJailRecord, 0, len(records))
+	for _, r := range records {
+		rs = append(rs, ReadableJailRecord{
+			PubKey:          r.PubKey.Hex(),
+			Address:         cipher.AddressFromPubKey(r.PubKey).String(),
+			Reason:          jailReasonString(r.Reason),
+			JailedEpoch:     r.JailedEpoch,
+			ReleaseEpoch:    r.ReleaseEpoch,
+			UnjailRequested: r.UnjailRequested,
+		})
+	}
+	return rs
+}
+
+// isJailed returns true if the validator is in jail
+func (vs *Visor) isJailed(pubkey cipher.PubKey) bool {
+	if vs.jails == nil {
+		return false
+	}
+	_, ok, err := vs.jails.Get(pubkey)
+	if err != nil {
+		logger.Errorf("Get jail record of %s failed: %v", pubkey.Hex(), err)
+		return false
+	}
+	return ok
+}
+
+// applyUnjailsWithTx records the unjail requests of the transactions in the block,
+// a request is ignored if the validator is not jailed or its release epoch is not reached
+func (vs *Visor) applyUnjailsWithTx(tx *bolt.Tx, b coin.Block) error {
+	if vs.jails == nil {
+		return nil
+	}
+	epoch := uint64(dpos.Epoch(int64(b.Time())))
+	for i := range b.Body.Transactions {
+		txn := &b.Body.Transactions[i]
+		if txn.Type != coin.TxTypeUnjail {
+			continue
+		}
+		pubkey, err := txn.UnjailRequest()
+		if err != nil {
+			return err
+		}
+		ok, err := vs.jails.RequestUnjailWithTx(tx, pubkey, epoch)
+		if err != nil {
+			return err
+		}
+		if ok {
+			logger.Infof("Validator %s is released from jail at the next epoch", pubkey.Hex())
+		}
+	}
+	return nil
+}
+
+// doubleSignJailsWithTx returns the validators to jail for the evidence of double signing included
+// by the blocks of the epochs since the last update. The evidence included by the block starting
+// the new epoch jails at the following boundary.
+func (vs *Visor) doubleSignJailsWithTx(tx *bolt.Tx, last uint64, updated bool, epoch uint64) ([]blockdb.JailRecord, error) {
+	if vs.evidences == nil {
+		return nil, nil
+	}
+	evidences, err := vs.evidences.GetAllWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []blockdb.JailRecord{}
+	for _, e := range evidences {
+		if e.Height == 0 || e.Epoch >= epoch || (updated && e.Epoch < last) {
+			continue
+		}
+		records = append(records, blockdb.JailRecord{
+			PubKey:       e.PubKey,
+			Reason:       blockdb.JailReasonDoubleSign,
+			JailedEpoch:  epoch,
+			ReleaseEpoch: epoch + doubleSignJailEpochs,
+		})
+	}
+	return records, nil
+}
+
+// downtimeJailsWithTx returns the validators which missed at least Config.JailMissedPercent
+// of their slots in the epoch before the new one. Nobody is jailed if no validator
+// stayed below the limit, the chain was idle then.
+func (vs *Visor) downtimeJailsWithTx(tx *bolt.Tx, epoch uint64) ([]blockdb.JailRecord, error) {
+	if vs.Config.JailMissedPercent <= 0 || vs.liveness == nil || epoch == 0 {
+		return nil, nil
+	}
+	stats, err := vs.liveness.GetEpochWithTx(tx, epoch-1)
+	if err != nil {
+		return nil, err
+	}
+
+	percent := uint64(vs.Config.JailMissedPercent)
+	online := false
+	records := []blockdb.JailRecord{}
+	for _, s := range stats {
+		slots := s.Produced + s.Missed
+		if s.Missed*100 < percent*slots {
+			online = true
+			continue
+		}
+		if slots < minDowntimeSlots {
+			continue
+		}
+		records = append(records, blockdb.JailRecord{
+			PubKey:       s.PubKey,
+			Reason:       blockdb.JailReasonDowntime,
+			JailedEpoch:  epoch,
+			ReleaseEpoch: epoch + downtimeJailEpochs,
+		})
+	}
+	if !online {
+		return nil, nil
+	}
+	return records, nil
+}
+
+// updateJailWithTx jails the validators which misbehaved since the last update and releases
+// the validators which requested it, changed is false if the jail is unchanged.
+// Every node makes the same update at the first block of the epoch.
+func (vs *Visor) updateJailWithTx(tx *bolt.Tx, epoch uint64) (changed bool, err error) {
+	if vs.jails == nil {
+		return false, nil
+	}
+	last, updated := vs.jails.GetEpochWithTx(tx)
+	if updated && epoch <= last {
+		return false, nil
+	}
+
+	records, err := vs.doubleSignJailsWithTx(tx, last, updated, epoch)
+	if err != nil {
+		return false, err
+	}
+	downtime, err := vs.downtimeJailsWithTx(tx, epoch)
+	if err != nil {
+		return false, err
+	}
+	records = append(records, downtime...)
+	// misbehavior before a key rotation jails the validator under its new key
+	rotations, err := vs.keyRotationsWithTx(tx)
+	if err != nil {
+		return false, err
+	}
+	for i := range records {
+		records[i].PubKey = rotateWith(rotations, records[i].PubKey)
+	}
+
+	jailed, err := vs.jails.GetAllWithTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, r := range jailed {
+		if !r.UnjailRequested {
+			continue
+		}
+		if err := vs.jails.ReleaseWithTx(tx, r.PubKey); err != nil {
+			return false, err
+		}
+		logger.Infof("Validator %s is released from jail at epoch %d", r.PubKey.Hex(), epoch)
+		changed = true
+	}
+
+	for _, r := range records {
+		if err := vs.jails.JailWithTx(tx, r); err != nil {
+			return false, err
+		}
+		logger.Warningf("Validator %s is jailed at epoch %d for %s", r.PubKey.Hex(), epoch, jailReasonString(r.Reason))
+		changed = true
+	}
+
+	if err := vs.jails.SetEpochWithTx(tx, epoch); err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+// activeValidatorsWithTx removes the jailed validators from the validators,
+// all of them are kept if every one is jailed
+func (vs *Visor) activeValidatorsWithTx(tx *bolt.Tx, validators []cipher.PubKey) ([]cipher.PubKey, error) {
+	if vs.jails == nil {
+		return validators, nil
+	}
+	jailed, err := vs.jails.GetAllWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	inJail := make(map[cipher.PubKey]struct{}, len(jailed))
+	for _, r := range jailed {
+		inJail[r.PubKey] = struct{}{}
+	}
+
+	active := []cipher.PubKey{}
+	for _, pk := range validators {
+		if _, ok := inJail[pk]; !ok {
+			active = append(active, pk)
+		}
+	}
+	if len(active) == 0 {
+		logger.Warning("Every validator is jailed, keeping the validator set")
+		return validators, nil
+	}
+	return active, nil
+}
+
+// GetJailedValidators returns the jailed validators
+func (vs *Visor) GetJailedValidators() ([]blockdb.JailRecord, error) {
+	return vs.jails.GetAll()
+}
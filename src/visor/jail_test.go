@@ -0,0 +1,256 @@
+package visor
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/signer"
+	"github.com/samoslab/samos/src/testutil"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+func newJailTestVisor(t *testing.T, db *bolt.DB, trust []cipher.PubKey) *Visor {
+	tn, err := blockdb.NewTrustNode(db)
+	require.NoError(t, err)
+	evidences, err := blockdb.NewEvidences(db)
+	require.NoError(t, err)
+	liveness, err := blockdb.NewLiveness(db)
+	require.NoError(t, err)
+	jails, err := blockdb.NewJails(db)
+	require.NoError(t, err)
+
+	cfg := NewVisorConfig()
+	cfg.TrustPubkeyList = trust
+	cfg.JailMissedPercent = 50
+	d := dpos.NewDpos(trust[0])
+	require.NoError(t, d.SetTrustNode(trust))
+	require.NoError(t, tn.AddValidatorSet(blockdb.ValidatorSet{Pubkeys: trust}))
+
+	v := &Visor{
+		Config:     cfg,
+		db:         db,
+		Blockchain: &Blockchain{db: db, store: &fakeChainStore{}},
+		dpos:       d,
+		trustNode:  tn,
+		evidences:  evidences,
+		liveness:   liveness,
+		jails:      jails,
+	}
+	v.engine = dposPbftEngine{vs: v}
+	v.signer = signer.NewLocal(v.TrustSeckey, v.Config.BlockchainSeckey, nil)
+	return v
+}
+
+// updateJail updates the jail at the epoch in its own transaction
+func updateJail(t *testing.T, v *Visor, epoch uint64) bool {
+	var changed bool
+	require.NoError(t, v.db.Update(func(tx *bolt.Tx) (err error) {
+		changed, err = v.updateJailWithTx(tx, epoch)
+		return err
+	}))
+	return changed
+}
+
+// activeValidators removes the jailed validators in its own transaction
+func activeValidators(t *testing.T, v *Visor, validators []cipher.PubKey) []cipher.PubKey {
+	var active []cipher.PubKey
+	require.NoError(t, v.db.View(func(tx *bolt.Tx) (err error) {
+		active, err = v.activeValidatorsWithTx(tx, validators)
+		return err
+	}))
+	return active
+}
+
+// startEpoch runs the epoch transition of the block as its execution does
+func startEpoch(t *testing.T, v *Visor, b coin.Block) {
+	var active []cipher.PubKey
+	var changed bool
+	require.NoError(t, v.db.Update(func(tx *bolt.Tx) (err error) {
+		active, changed, err = v.startEpochWithTx(tx, b)
+		return err
+	}))
+	if changed {
+		require.NoError(t, v.applyEpoch(active))
+	}
+}
+
+func makeEvidenceAt(pubkey cipher.PubKey, tm uint64) blockdb.Evidence {
+	return blockdb.NewEvidence(pubkey,
+		blockdb.SignedHeader{Header: coin.BlockHeader{BkSeq: 9, Time: tm}},
+		blockdb.SignedHeader{Header: coin.BlockHeader{BkSeq: 9, Time: tm + 1}})
+}
+
+// includeEvidence records the evidence as included by a block of the epoch
+func includeEvidence(t *testing.T, v *Visor, e blockdb.Evidence, epoch uint64) {
+	require.NoError(t, v.db.Update(func(tx *bolt.Tx) error {
+		_, err := v.evidences.IncludeWithTx(tx, e, 10, epoch)
+		return err
+	}))
+}
+
+func TestUpdateJailDoubleSign(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	pk1, sk1 := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	pk3, _ := cipher.GenerateKeyPair()
+	v := newJailTestVisor(t, db, []cipher.PubKey{pk1, pk2, pk3})
+
+	// the evidence against pk2 is included by the block starting epoch 2, it jails at the
+	// next boundary. The evidence against pk3 no block included jails nobody.
+	includeEvidence(t, v, makeEvidenceAt(pk1, uint64(dpos.EpochStart(1))), 1)
+	includeEvidence(t, v, makeEvidenceAt(pk2, uint64(dpos.EpochStart(1)+10)), 2)
+	_, err := v.evidences.Add(makeEvidenceAt(pk3, uint64(dpos.EpochStart(1)+20)))
+	require.NoError(t, err)
+
+	changed := updateJail(t, v, 2)
+	require.True(t, changed)
+	require.True(t, v.isJailed(pk1))
+	require.False(t, v.isJailed(pk2))
+
+	records, err := v.GetJailedValidators()
+	require.NoError(t, err)
+	require.Equal(t, []blockdb.JailRecord{{
+		PubKey:       pk1,
+		Reason:       blockdb.JailReasonDoubleSign,
+		JailedEpoch:  2,
+		ReleaseEpoch: 2 + doubleSignJailEpochs,
+	}}, records)
+
+	// the jail is updated once per epoch
+	changed = updateJail(t, v, 2)
+	require.False(t, changed)
+
+	changed = updateJail(t, v, 3)
+	require.True(t, changed)
+	require.True(t, v.isJailed(pk2))
+	require.False(t, v.isJailed(pk3))
+
+	active := activeValidators(t, v, []cipher.PubKey{pk1, pk2, pk3})
+	require.Equal(t, []cipher.PubKey{pk3}, active)
+	require.False(t, v.IsTrustPubkey(pk1))
+
+	// the set is kept if every validator is jailed
+	active = activeValidators(t, v, []cipher.PubKey{pk1, pk2})
+	require.Equal(t, []cipher.PubKey{pk1, pk2}, active)
+
+	// an unjail request before the release epoch is ignored
+	unjail := coin.Transaction{Type: coin.TxTypeUnjail}
+	unjail.PushInput(cipher.SumSHA256([]byte("input")))
+	unjail.PushOutput(cipher.AddressFromPubKey(pk1), 1e3, 0)
+	unjail.SignInputs([]cipher.SecKey{sk1})
+	unjail.UpdateHeader()
+
+	applyUnjail := func(epoch int64) {
+		b := coin.Block{
+			Head: coin.BlockHeader{Time: uint64(dpos.EpochStart(epoch))},
+			Body: coin.BlockBody{Transactions: coin.Transactions{unjail}},
+		}
+		require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+			return v.applyUnjailsWithTx(tx, b)
+		}))
+	}
+
+	applyUnjail(2 + doubleSignJailEpochs - 1)
+	changed = updateJail(t, v, 2+doubleSignJailEpochs)
+	require.False(t, changed)
+	require.True(t, v.isJailed(pk1))
+
+	applyUnjail(2 + doubleSignJailEpochs)
+	changed = updateJail(t, v, 2+doubleSignJailEpochs+1)
+	require.True(t, changed)
+	require.False(t, v.isJailed(pk1))
+	require.True(t, v.isJailed(pk2))
+}
+
+func TestUpdateJailDowntime(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	pk3, _ := cipher.GenerateKeyPair()
+	v := newJailTestVisor(t, db, []cipher.PubKey{pk1, pk2, pk3})
+
+	addSlots := func(epoch uint64, pubkey cipher.PubKey, produced, missed int) {
+		require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+			for i := 0; i < produced; i++ {
+				if err := v.liveness.AddProducedWithTx(tx, epoch, pubkey); err != nil {
+					return err
+				}
+			}
+			for i := 0; i < missed; i++ {
+				if err := v.liveness.AddMissedWithTx(tx, epoch, pubkey, int64(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+
+	// pk3 had too few slots to judge
+	addSlots(4, pk1, 50, 150)
+	addSlots(4, pk2, 190, 10)
+	addSlots(4, pk3, 0, 50)
+
+	changed := updateJail(t, v, 5)
+	require.True(t, changed)
+
+	records, err := v.GetJailedValidators()
+	require.NoError(t, err)
+	require.Equal(t, []blockdb.JailRecord{{
+		PubKey:       pk1,
+		Reason:       blockdb.JailReasonDowntime,
+		JailedEpoch:  5,
+		ReleaseEpoch: 5 + downtimeJailEpochs,
+	}}, records)
+
+	// nobody produced blocks, the chain was idle
+	addSlots(5, pk2, 0, 200)
+	addSlots(5, pk3, 0, 200)
+	changed = updateJail(t, v, 6)
+	require.False(t, changed)
+
+	// downtime jailing is disabled
+	addSlots(6, pk1, 200, 0)
+	addSlots(6, pk2, 0, 200)
+	v.Config.JailMissedPercent = 0
+	changed = updateJail(t, v, 7)
+	require.False(t, changed)
+}
+
+func TestMaybeStartEpoch(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	v := newJailTestVisor(t, db, []cipher.PubKey{pk1, pk2})
+
+	b := coin.Block{Head: coin.BlockHeader{BkSeq: 10, Time: uint64(dpos.EpochStart(3) + 5)}}
+
+	// nothing changed, no set is recorded
+	startEpoch(t, v, b)
+	sets, err := v.GetValidatorSets()
+	require.NoError(t, err)
+	require.Len(t, sets, 1)
+
+	includeEvidence(t, v, makeEvidenceAt(pk2, uint64(dpos.EpochStart(3))), 3)
+
+	b.Head.BkSeq = 20
+	b.Head.Time = uint64(dpos.EpochStart(4) + 5)
+	startEpoch(t, v, b)
+
+	validators, ok := v.validatorSetAt(21)
+	require.True(t, ok)
+	require.Equal(t, []cipher.PubKey{pk1}, validators)
+	validators, err = v.dpos.GetValidators()
+	require.NoError(t, err)
+	require.Equal(t, []cipher.PubKey{pk1}, validators)
+}
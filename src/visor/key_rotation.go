@@ -0,0 +1,261 @@
+package visor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+// ReadableKeyRotation readable validator key rotation
+type ReadableKeyRotation struct {
+	OldPubKey   string `json:"old_pubkey"`
+	OldAddress  string `json:"old_address"`
+	NewPubKey   string `json:"new_pubkey"`
+	NewAddress  string `json:"new_address"`
+	Txid        string `json:"txid"`
+	Height      uint64 `json:"height"`
+	ActiveEpoch uint64 `json:"active_epoch"`
+	Applied     bool   `json:"applied"`
+}
+
+// NewReadableKeyRotations creates []ReadableKeyRotation
+func NewReadableKeyRotations(rotations []blockdb.KeyRotation) []ReadableKeyRotation {
+	rs := make([]ReadableKeyRotation, 0, len(rotations))
+	for _, r := range rotations {
+		rs = append(rs, ReadableKeyRotation{
+			OldPubKey:   r.OldPubKey.Hex(),
+			OldAddress:  cipher.AddressFromPubKey(r.OldPubKey).String(),
+			NewPubKey:   r.NewPubKey.Hex(),
+			NewAddress:  cipher.AddressFromPubKey(r.NewPubKey).String(),
+			Txid:        r.Txid.Hex(),
+			Height:      r.Height,
+			ActiveEpoch: r.ActiveEpoch,
+			Applied:     r.Applied,
+		})
+	}
+	return rs
+}
+
+// keyRotationMap returns the new pubkey of every validator key an applied rotation retired
+func keyRotationMap(rotations []blockdb.KeyRotation) map[cipher.PubKey]cipher.PubKey {
+	m := make(map[cipher.PubKey]cipher.PubKey)
+	for _, r := range rotations {
+		if r.Applied {
+			m[r.OldPubKey] = r.NewPubKey
+		}
+	}
+	return m
+}
+
+// rotateWith follows the rotations of the pubkey to its current key
+func rotateWith(m map[cipher.PubKey]cipher.PubKey, pubkey cipher.PubKey) cipher.PubKey {
+	// a key is never rotated to a retired key, the bound only guards against a corrupted db
+	for i := 0; i < len(m); i++ {
+		next, ok := m[pubkey]
+		if !ok {
+			break
+		}
+		pubkey = next
+	}
+	return pubkey
+}
+
+// rotateAllWith replaces the retired keys of the pubkeys by their current keys
+func rotateAllWith(m map[cipher.PubKey]cipher.PubKey, pubkeys []cipher.PubKey) []cipher.PubKey {
+	if len(m) == 0 {
+		return pubkeys
+	}
+	rotated := make([]cipher.PubKey, 0, len(pubkeys))
+	for _, pk := range pubkeys {
+		rotated = append(rotated, rotateWith(m, pk))
+	}
+	return mergePubkeys(rotated)
+}
+
+// keyRotations returns the applied rotations by retired key
+func (vs *Visor) keyRotations() map[cipher.PubKey]cipher.PubKey {
+	if vs.keyRotation == nil {
+		return nil
+	}
+	rotations, err := vs.keyRotation.GetAll()
+	if err != nil {
+		logger.Errorf("Get key rotations failed: %v", err)
+		return nil
+	}
+	return keyRotationMap(rotations)
+}
+
+// keyRotationsWithTx returns the applied rotations by retired key with *bolt.Tx
+func (vs *Visor) keyRotationsWithTx(tx *bolt.Tx) (map[cipher.PubKey]cipher.PubKey, error) {
+	if vs.keyRotation == nil {
+		return nil, nil
+	}
+	rotations, err := vs.keyRotation.GetAllWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	return keyRotationMap(rotations), nil
+}
+
+// rotatePubkey returns the current key of the validator
+func (vs *Visor) rotatePubkey(pubkey cipher.PubKey) cipher.PubKey {
+	return rotateWith(vs.keyRotations(), pubkey)
+}
+
+// rotatePubkeys replaces the retired keys of the validators by their current keys
+func (vs *Visor) rotatePubkeys(pubkeys []cipher.PubKey) []cipher.PubKey {
+	return rotateAllWith(vs.keyRotations(), pubkeys)
+}
+
+// isRetired returns true if the key was rotated away, it signs nothing any more
+func (vs *Visor) isRetired(pubkey cipher.PubKey) bool {
+	_, ok := vs.keyRotations()[pubkey]
+	return ok
+}
+
+// verifyKeyRotation checks the key rotation transaction of the block at the height, the old
+// key must be one of the validators of that height and the new key must not have been used
+// before, by the validators, the trust list recorded in the chain, or the rotations
+func (vs *Visor) verifyKeyRotation(txn *coin.Transaction, height uint64, validators, trusted []cipher.PubKey, rotations []blockdb.KeyRotation) (blockdb.KeyRotation, error) {
+	oldKey, newKey, delay, err := txn.KeyRotation()
+	if err != nil {
+		return blockdb.KeyRotation{}, err
+	}
+
+	if !containsPubkey(validators, oldKey) {
+		return blockdb.KeyRotation{}, fmt.Errorf("%s is not a validator", oldKey.Hex())
+	}
+	if containsPubkey(mergePubkeys(validators, trusted), newKey) {
+		return blockdb.KeyRotation{}, fmt.Errorf("%s is a validator already", newKey.Hex())
+	}
+	for _, r := range rotations {
+		switch {
+		case r.OldPubKey == oldKey && !r.Applied:
+			return blockdb.KeyRotation{}, errors.New("a rotation of the key is pending")
+		case r.OldPubKey == newKey || r.NewPubKey == newKey:
+			return blockdb.KeyRotation{}, fmt.Errorf("%s was used before", newKey.Hex())
+		}
+	}
+
+	return blockdb.KeyRotation{
+		OldPubKey:   oldKey,
+		NewPubKey:   newKey,
+		Txid:        txn.Hash(),
+		Height:      height,
+		ActiveEpoch: delay,
+	}, nil
+}
+
+// applyKeyRotationsWithTx records the key rotations of the block, they take effect at the
+// start of the epoch their delay after the epoch of the block. Invalid rotations are ignored.
+func (vs *Visor) applyKeyRotationsWithTx(tx *bolt.Tx, b coin.Block) error {
+	if vs.keyRotation == nil {
+		return nil
+	}
+	epoch := uint64(dpos.Epoch(int64(b.Time())))
+	for i := range b.Body.Transactions {
+		txn := &b.Body.Transactions[i]
+		if txn.Type != coin.TxTypeKeyRotation {
+			continue
+		}
+		validators, err := vs.validatorsAtWithTx(tx, b.Seq())
+		if err != nil {
+			return err
+		}
+		trusted, err := vs.trustListWithTx(tx)
+		if err != nil {
+			return err
+		}
+		rotations, err := vs.keyRotation.GetAllWithTx(tx)
+		if err != nil {
+			return err
+		}
+		r, err := vs.verifyKeyRotation(txn, b.Seq(), validators, trusted, rotations)
+		if err != nil {
+			logger.Warningf("Ignore key rotation transaction %s: %v", txn.Hash().Hex(), err)
+			continue
+		}
+		r.ActiveEpoch += epoch
+		if err := vs.keyRotation.AddWithTx(tx, r); err != nil {
+			return err
+		}
+		logger.Infof("Validator %s signs with %s from epoch %d", r.OldPubKey.Hex(), r.NewPubKey.Hex(), r.ActiveEpoch)
+	}
+	return nil
+}
+
+// updateKeyRotationsWithTx puts the key rotations active at the epoch into effect: the trust nodes
+// and the jail record of a validator move to its new key. changed is false if none took effect.
+func (vs *Visor) updateKeyRotationsWithTx(tx *bolt.Tx, epoch uint64) (changed bool, err error) {
+	if vs.keyRotation == nil {
+		return false, nil
+	}
+	applied, err := vs.keyRotation.ApplyWithTx(tx, epoch)
+	if err != nil || len(applied) == 0 {
+		return false, err
+	}
+	m, err := vs.keyRotationsWithTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	if trust := vs.trustNode.GetPubkeysWithTx(tx); len(trust) > 0 {
+		if err := vs.trustNode.AddNodePubkeyWithTx(tx, rotateAllWith(m, trust)); err != nil {
+			return false, err
+		}
+	}
+	for _, r := range applied {
+		if vs.jails != nil {
+			if err := vs.jails.MoveWithTx(tx, r.OldPubKey, r.NewPubKey); err != nil {
+				return false, err
+			}
+		}
+		logger.Infof("Validator %s signs with %s from epoch %d on", r.OldPubKey.Hex(), r.NewPubKey.Hex(), epoch)
+	}
+	return true, nil
+}
+
+// usesNextKey returns true once the configured key of this node rotated to the key
+// of Config.BlockchainTrustNextSeckey
+func (vs *Visor) usesNextKey() bool {
+	if vs.Config.BlockchainTrustNextSeckey == (cipher.SecKey{}) {
+		return false
+	}
+	current := vs.rotatePubkey(vs.Config.BlockchainTrustPubkey)
+	if current == vs.Config.BlockchainTrustPubkey {
+		return false
+	}
+	if current != cipher.PubKeyFromSecKey(vs.Config.BlockchainTrustNextSeckey) {
+		logger.Errorf("Validator key rotated to %s, the next secret key does not match", current.Hex())
+		return false
+	}
+	return true
+}
+
+// TrustPubkey returns the key this node signs blocks and prepare messages with,
+// the next key once the configured key rotated to it
+func (vs *Visor) TrustPubkey() cipher.PubKey {
+	if vs.usesNextKey() {
+		return cipher.PubKeyFromSecKey(vs.Config.BlockchainTrustNextSeckey)
+	}
+	return vs.Config.BlockchainTrustPubkey
+}
+
+// TrustSeckey returns the secret key of TrustPubkey
+func (vs *Visor) TrustSeckey() cipher.SecKey {
+	if vs.usesNextKey() {
+		return vs.Config.BlockchainTrustNextSeckey
+	}
+	return vs.Config.BlockchainTrustSeckey
+}
+
+// GetKeyRotations returns the pending and the applied validator key rotations
+func (vs *Visor) GetKeyRotations() ([]blockdb.KeyRotation, error) {
+	return vs.keyRotation.GetAll()
+}
@@ -0,0 +1,147 @@
+package visor
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/testutil"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+func TestKeyRotation(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	pk1, sk1 := cipher.GenerateKeyPair()
+	pk2, sk2 := cipher.GenerateKeyPair()
+	pk3, sk3 := cipher.GenerateKeyPair()
+	pk4, sk4 := cipher.GenerateKeyPair()
+	_, sk5 := cipher.GenerateKeyPair()
+	_, sk6 := cipher.GenerateKeyPair()
+
+	v := newJailTestVisor(t, db, []cipher.PubKey{pk1, pk2, pk3})
+	keyRotation, err := blockdb.NewKeyRotations(db)
+	require.NoError(t, err)
+	v.keyRotation = keyRotation
+	v.Config.BlockchainTrustPubkey = pk1
+	v.Config.BlockchainTrustSeckey = sk1
+	v.Config.BlockchainTrustNextSeckey = sk4
+	require.NoError(t, v.trustNode.AddNodePubkey([]cipher.PubKey{pk1, pk2, pk3}))
+
+	out := func(pk cipher.PubKey, hours uint64) coin.TransactionOutput {
+		return coin.TransactionOutput{Address: cipher.AddressFromPubKey(pk), Coins: 1e6, Hours: hours}
+	}
+	rotateTx := func(oldKey, newKey cipher.SecKey, delay uint64) coin.Transaction {
+		return makeGovernanceTx(t, coin.TxTypeKeyRotation, []cipher.SecKey{oldKey, newKey},
+			[]coin.TransactionOutput{
+				out(cipher.PubKeyFromSecKey(oldKey), delay),
+				out(cipher.PubKeyFromSecKey(newKey), 0),
+			})
+	}
+
+	// pk1 moves to pk4 two epochs later, pk5 is no validator, pk1 is rotating already
+	// and pk2 is a validator
+	tx14 := rotateTx(sk1, sk4, 2)
+	b := coin.Block{
+		Head: coin.BlockHeader{BkSeq: 30, Time: uint64(dpos.EpochStart(5) + 5)},
+		Body: coin.BlockBody{Transactions: coin.Transactions{
+			tx14,
+			rotateTx(sk5, sk6, 1),
+			rotateTx(sk1, sk6, 1),
+			rotateTx(sk3, sk2, 1),
+		}},
+	}
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return v.applyKeyRotationsWithTx(tx, b)
+	}))
+
+	rotations, err := v.GetKeyRotations()
+	require.NoError(t, err)
+	require.Equal(t, []blockdb.KeyRotation{
+		{
+			OldPubKey:   pk1,
+			NewPubKey:   pk4,
+			Txid:        tx14.Hash(),
+			Height:      30,
+			ActiveEpoch: 7,
+		},
+	}, rotations)
+
+	// the jail record moves with the key
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return v.jails.JailWithTx(tx, blockdb.JailRecord{
+			PubKey:       pk1,
+			Reason:       blockdb.JailReasonDowntime,
+			JailedEpoch:  5,
+			ReleaseEpoch: 9,
+		})
+	}))
+
+	b.Body.Transactions = nil
+	b.Head.BkSeq = 40
+	b.Head.Time = uint64(dpos.EpochStart(6) + 5)
+	startEpoch(t, v, b)
+	require.Equal(t, pk1, v.TrustPubkey())
+	require.Equal(t, []cipher.PubKey{pk1, pk2, pk3}, v.trustList())
+
+	b.Head.BkSeq = 50
+	b.Head.Time = uint64(dpos.EpochStart(7) + 5)
+	startEpoch(t, v, b)
+
+	require.Equal(t, []cipher.PubKey{pk4, pk2, pk3}, v.trustList())
+	// trust nodes are stored sorted
+	trustNodes := v.TrustNodes()
+	require.Len(t, trustNodes, 3)
+	require.True(t, containsPubkey(trustNodes, pk4))
+	require.False(t, containsPubkey(trustNodes, pk1))
+	validators, ok := v.validatorSetAt(51)
+	require.True(t, ok)
+	require.Equal(t, []cipher.PubKey{pk2, pk3}, validators)
+
+	_, ok, err = v.jails.Get(pk1)
+	require.NoError(t, err)
+	require.False(t, ok)
+	r, ok, err := v.jails.Get(pk4)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(9), r.ReleaseEpoch)
+
+	require.False(t, v.IsTrustPubkey(pk1))
+	require.Equal(t, pk4, v.TrustPubkey())
+	require.Equal(t, sk4, v.TrustSeckey())
+
+	// the genesis node still announcing the old key does not bring it back
+	require.NoError(t, v.InsertTrustPubkeyList([]cipher.PubKey{pk1, pk2, pk3}))
+	require.Equal(t, trustNodes, v.TrustNodes())
+
+	// a retired key can not be used again
+	b.Body.Transactions = coin.Transactions{rotateTx(sk2, sk1, 1)}
+	b.Head.BkSeq = 51
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return v.applyKeyRotationsWithTx(tx, b)
+	}))
+	rotations, err = v.GetKeyRotations()
+	require.NoError(t, err)
+	require.Len(t, rotations, 1)
+	require.True(t, rotations[0].Applied)
+
+	// the validators are read in the transaction of the block
+	pk5 := cipher.PubKeyFromSecKey(sk5)
+	b.Body.Transactions = coin.Transactions{rotateTx(sk5, sk6, 1)}
+	b.Head.BkSeq = 52
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		if err := v.addValidatorSetWithTx(tx, 52, 7, []cipher.PubKey{pk2, pk3, pk5}, 0); err != nil {
+			return err
+		}
+		return v.applyKeyRotationsWithTx(tx, b)
+	}))
+	rotations, err = v.GetKeyRotations()
+	require.NoError(t, err)
+	require.Len(t, rotations, 2)
+	require.True(t, rotations[0].OldPubKey == pk5 || rotations[1].OldPubKey == pk5)
+}
@@ -0,0 +1,189 @@
+package visor
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+// slotRecord is a slot of a validator which is produced or missed
+type slotRecord struct {
+	pubkey   cipher.PubKey
+	slot     int64
+	produced bool
+}
+
+// ReadableSlotStats slot statistics of a validator
+type ReadableSlotStats struct {
+	PubKey         string `json:"pubkey"`
+	Address        string `json:"address"`
+	Produced       uint64 `json:"produced"`
+	Missed         uint64 `json:"missed"`
+	Orphaned       uint64 `json:"orphaned"`
+	LastMissedSlot int64  `json:"last_missed_slot"`
+}
+
+// ReadableEpochStats slot statistics of the validators in an epoch
+type ReadableEpochStats struct {
+	Epoch      uint64              `json:"epoch"`
+	Produced   uint64              `json:"produced"`
+	Missed     uint64              `json:"missed"`
+	Orphaned   uint64              `json:"orphaned"`
+	Validators []ReadableSlotStats `json:"validators"`
+}
+
+// ReadableValidatorStats slot statistics of the validators, the totals of all epochs
+// and the statistics of every epoch
+type ReadableValidatorStats struct {
+	Validators []ReadableSlotStats  `json:"validators"`
+	Epochs     []ReadableEpochStats `json:"epochs"`
+}
+
+func newReadableSlotStats(s blockdb.SlotStats) ReadableSlotStats {
+	return ReadableSlotStats{
+		PubKey:         s.PubKey.Hex(),
+		Address:        cipher.AddressFromPubKey(s.PubKey).String(),
+		Produced:       s.Produced,
+		Missed:         s.Missed,
+		Orphaned:       s.Orphaned,
+		LastMissedSlot: s.LastMissedSlot,
+	}
+}
+
+// NewReadableValidatorStats creates ReadableValidatorStats, stats must be ordered by epoch
+func NewReadableValidatorStats(stats []blockdb.SlotStats) *ReadableValidatorStats {
+	totals := make(map[cipher.PubKey]*blockdb.SlotStats)
+	epochs := []ReadableEpochStats{}
+	for _, s := range stats {
+		if len(epochs) == 0 || epochs[len(epochs)-1].Epoch != s.Epoch {
+			epochs = append(epochs, ReadableEpochStats{
+				Epoch:      s.Epoch,
+				Validators: []ReadableSlotStats{},
+			})
+		}
+		e := &epochs[len(epochs)-1]
+		e.Produced += s.Produced
+		e.Missed += s.Missed
+		e.Orphaned += s.Orphaned
+		e.Validators = append(e.Validators, newReadableSlotStats(s))
+
+		t, ok := totals[s.PubKey]
+		if !ok {
+			t = &blockdb.SlotStats{PubKey: s.PubKey}
+			totals[s.PubKey] = t
+		}
+		t.Produced += s.Produced
+		t.Missed += s.Missed
+		t.Orphaned += s.Orphaned
+		if s.LastMissedSlot > t.LastMissedSlot {
+			t.LastMissedSlot = s.LastMissedSlot
+		}
+	}
+
+	pubkeys := make([]cipher.PubKey, 0, len(totals))
+	for pk := range totals {
+		pubkeys = append(pubkeys, pk)
+	}
+	sort.Slice(pubkeys, func(i, j int) bool {
+		return bytes.Compare(pubkeys[i][:], pubkeys[j][:]) < 0
+	})
+
+	validators := make([]ReadableSlotStats, 0, len(pubkeys))
+	for _, pk := range pubkeys {
+		validators = append(validators, newReadableSlotStats(*totals[pk]))
+	}
+
+	return &ReadableValidatorStats{
+		Validators: validators,
+		Epochs:     epochs,
+	}
+}
+
+// livenessSlots returns the slot of the block and the empty slots since its parent block,
+// with the validators scheduled for them. A slot without a block counts as missed, whether
+// the validator was down or had no transactions to pack. Only the last round of the validators
+// before the block is counted: while the others produce, a gap is never longer, and a chain
+// which was idle misses each slot once. Only the DPOS engine schedules slots.
+func (vs *Visor) livenessSlots(b coin.SignedBlock) ([]slotRecord, error) {
+	if _, ok := vs.engine.(dposPbftEngine); !ok || vs.liveness == nil || vs.dpos == nil || b.Seq() == 0 {
+		return nil, nil
+	}
+
+	head, err := vs.Blockchain.Head()
+	if err != nil {
+		return nil, err
+	}
+	if head.Seq()+1 != b.Seq() {
+		return nil, nil
+	}
+
+	signer, err := cipher.PubKeyFromSig(b.Sig, b.HashHeader())
+	if err != nil {
+		return nil, err
+	}
+
+	slot := dpos.PrevSlot(int64(b.Time()))
+	records := []slotRecord{{pubkey: signer, slot: slot, produced: true}}
+
+	interval := dpos.BlockInterval()
+	start := dpos.PrevSlot(int64(head.Time())) + interval
+	round := int64(len(vs.blockValidators(b.Seq())))
+	if first := slot - round*interval; start < first {
+		start = first
+	}
+	for s := start; s < slot; s += interval {
+		pk, err := vs.dpos.SlotValidator(b.Block.Head.PrevHash, b.Seq(), s)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, slotRecord{pubkey: pk, slot: s})
+	}
+
+	return records, nil
+}
+
+// recordLivenessWithTx counts the produced and missed slots
+func (vs *Visor) recordLivenessWithTx(tx *bolt.Tx, records []slotRecord) error {
+	for _, r := range records {
+		epoch := uint64(dpos.Epoch(r.slot))
+		if r.produced {
+			if err := vs.liveness.AddProducedWithTx(tx, epoch, r.pubkey); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := vs.liveness.AddMissedWithTx(tx, epoch, r.pubkey, r.slot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordOrphaned counts the pending blocks which were dropped before they were confirmed
+func (vs *Visor) recordOrphaned(blocks []coin.SignedBlock) error {
+	if vs.liveness == nil {
+		return nil
+	}
+	for _, b := range blocks {
+		signer, err := cipher.PubKeyFromSig(b.Sig, b.HashHeader())
+		if err != nil {
+			return err
+		}
+		epoch := uint64(dpos.Epoch(dpos.PrevSlot(int64(b.Time()))))
+		if err := vs.liveness.AddOrphaned(epoch, signer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetValidatorStats returns the slot statistics of the validators of all epochs
+func (vs *Visor) GetValidatorStats() ([]blockdb.SlotStats, error) {
+	return vs.liveness.GetAll()
+}
@@ -0,0 +1,149 @@
+package visor
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/signer"
+	"github.com/samoslab/samos/src/testutil"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+func TestLivenessSlots(t *testing.T) {
+	db, close := testutil.PrepareDB(t)
+	defer close()
+	liveness, err := blockdb.NewLiveness(db)
+	require.NoError(t, err)
+
+	pk1, sk1 := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	pk3, _ := cipher.GenerateKeyPair()
+	pk4, _ := cipher.GenerateKeyPair()
+	validators := []cipher.PubKey{pk1, pk2, pk3, pk4}
+	d := dpos.NewDpos(pk1)
+	require.NoError(t, d.SetTrustNode(validators))
+
+	// the head is made in the slot 1090, the block in the slot 1140
+	bs := makeBlocksAt(t, []uint64{1100})
+	b := makeBlock(t, bs[1].Block, 1145)
+	sb := coin.SignedBlock{
+		Block: *b,
+		Sig:   cipher.SignHash(b.HashHeader(), sk1),
+	}
+
+	v := &Visor{
+		Config: Config{TrustPubkeyList: validators},
+		Blockchain: &Blockchain{
+			store: &fakeChainStore{blocks: bs},
+		},
+		dpos:     d,
+		liveness: liveness,
+	}
+	v.engine = dposPbftEngine{vs: v}
+	v.signer = signer.NewLocal(v.TrustSeckey, v.Config.BlockchainSeckey, nil)
+
+	slots, err := v.livenessSlots(sb)
+	require.NoError(t, err)
+	require.Len(t, slots, 5)
+	require.Equal(t, slotRecord{pubkey: pk1, slot: 1140, produced: true}, slots[0])
+	for i, s := range slots[1:] {
+		slot := int64(1100 + i*10)
+		expected, err := d.SlotValidator(sb.Block.Head.PrevHash, sb.Seq(), slot)
+		require.NoError(t, err)
+		require.Equal(t, slotRecord{pubkey: expected, slot: slot}, s)
+	}
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return v.recordLivenessWithTx(tx, slots)
+	}))
+	require.NoError(t, v.recordOrphaned([]coin.SignedBlock{sb}))
+
+	stats, err := v.GetValidatorStats()
+	require.NoError(t, err)
+	rs := NewReadableValidatorStats(stats)
+	require.Len(t, rs.Epochs, 1)
+	require.Equal(t, uint64(0), rs.Epochs[0].Epoch)
+	require.Equal(t, uint64(1), rs.Epochs[0].Produced)
+	require.Equal(t, uint64(4), rs.Epochs[0].Missed)
+	require.Equal(t, uint64(1), rs.Epochs[0].Orphaned)
+
+	byPubkey := map[string]ReadableSlotStats{}
+	for _, s := range rs.Validators {
+		byPubkey[s.PubKey] = s
+	}
+	s1 := byPubkey[pk1.Hex()]
+	require.Equal(t, cipher.AddressFromPubKey(pk1).String(), s1.Address)
+	require.Equal(t, uint64(1), s1.Produced)
+	require.Equal(t, uint64(1), s1.Orphaned)
+	missed := uint64(0)
+	lastMissed := int64(0)
+	for _, s := range byPubkey {
+		missed += s.Missed
+		if s.LastMissedSlot > lastMissed {
+			lastMissed = s.LastMissedSlot
+		}
+	}
+	require.Equal(t, uint64(4), missed)
+	require.Equal(t, int64(1130), lastMissed)
+
+	// after an idle chain only the last round of the validators is missed
+	idle := makeBlock(t, bs[1].Block, 1345)
+	slots, err = v.livenessSlots(coin.SignedBlock{
+		Block: *idle,
+		Sig:   cipher.SignHash(idle.HashHeader(), sk1),
+	})
+	require.NoError(t, err)
+	require.Len(t, slots, 1+len(validators))
+	require.Equal(t, int64(1300), slots[1].slot)
+	require.Equal(t, int64(1330), slots[len(slots)-1].slot)
+
+	// a block not following the head is not counted
+	sb.Block.Head.BkSeq++
+	slots, err = v.livenessSlots(sb)
+	require.NoError(t, err)
+	require.Empty(t, slots)
+}
+
+func TestNewReadableValidatorStats(t *testing.T) {
+	pk1 := cipher.MustPubKeyFromHex("025d8360bc9439aa94044df96605f7693f50bb35386b37ae5003787d840a98bf43")
+	pk2 := cipher.MustPubKeyFromHex("02d15bf28c4ed2c39b35b2be2f8bcde1318e2b3b65fe2a676db39b520bee9bfe86")
+
+	rs := NewReadableValidatorStats([]blockdb.SlotStats{
+		{Epoch: 1, PubKey: pk2, Produced: 5, Missed: 1, LastMissedSlot: 86500},
+		{Epoch: 2, PubKey: pk1, Produced: 3, Orphaned: 2},
+		{Epoch: 2, PubKey: pk2, Produced: 4, Missed: 2, LastMissedSlot: 172900},
+	})
+
+	require.Len(t, rs.Epochs, 2)
+	require.Equal(t, ReadableEpochStats{
+		Epoch:      1,
+		Produced:   5,
+		Missed:     1,
+		Validators: []ReadableSlotStats{newReadableSlotStats(blockdb.SlotStats{Epoch: 1, PubKey: pk2, Produced: 5, Missed: 1, LastMissedSlot: 86500})},
+	}, rs.Epochs[0])
+	require.Equal(t, uint64(7), rs.Epochs[1].Produced)
+	require.Equal(t, uint64(2), rs.Epochs[1].Missed)
+	require.Equal(t, uint64(2), rs.Epochs[1].Orphaned)
+	require.Len(t, rs.Epochs[1].Validators, 2)
+
+	require.Equal(t, []ReadableSlotStats{
+		{
+			PubKey:   pk1.Hex(),
+			Address:  cipher.AddressFromPubKey(pk1).String(),
+			Produced: 3,
+			Orphaned: 2,
+		},
+		{
+			PubKey:         pk2.Hex(),
+			Address:        cipher.AddressFromPubKey(pk2).String(),
+			Produced:       9,
+			Missed:         3,
+			LastMissedSlot: 172900,
+		},
+	}, rs.Validators)
+}
@@ -0,0 +1,374 @@
+package visor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/signer"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+var (
+	// ErrNotCommitted is returned when a pending block is executed before it is final,
+	// with the PBFT engine before the quorum committed it
+	ErrNotCommitted = errors.New("block is not committed by the quorum")
+	// ErrMissingQuorumCert is returned when a block which must be certified comes without quorum certificate
+	ErrMissingQuorumCert = errors.New("block has no quorum certificate")
+)
+
+// validatorNum returns the number of validators voting on the block at the height
+func (vs *Visor) validatorNum(height uint64) int {
+	return len(vs.blockValidators(height))
+}
+
+// Quorum returns the number of prepare and commit votes the block at the height needs,
+// 2f+1 of its validators. A larger quorum governed when the validator set of the height
+// was recorded is kept.
+func (vs *Visor) Quorum(height uint64) int {
+	n := vs.validatorNum(height)
+	q := pbft.Quorum(n)
+	if set, ok := vs.validatorSet(height); ok && int(set.Quorum) > q && int(set.Quorum) <= n {
+		q = int(set.Quorum)
+	}
+	return q
+}
+
+// pendingQuorum returns the quorum of the pending block
+func (vs *Visor) pendingQuorum(hash cipher.SHA256) (int, error) {
+	sb, err := vs.pbft.GetSignedBlock(hash)
+	if err != nil {
+		return 0, err
+	}
+	return vs.Quorum(sb.Seq()), nil
+}
+
+// AddPrepare adds the prepare vote of a validator signed for the pending block, it is counted
+// by the consensus engine
+func (vs *Visor) AddPrepare(hash cipher.SHA256, sig cipher.Sig) (cipher.PubKey, error) {
+	return vs.engine.AddVote(hash, sig)
+}
+
+// checkVoter returns an error if the pubkey is not a validator of the height of the pending
+// block, the votes count toward the quorum of that height
+func (vs *Visor) checkVoter(hash cipher.SHA256, pubkey cipher.PubKey) error {
+	sb, err := vs.pbft.GetSignedBlock(hash)
+	if err != nil {
+		return err
+	}
+	if !vs.isValidatorAt(pubkey, sb.Seq()) {
+		return fmt.Errorf("%s is not a validator of block %d", pubkey.Hex(), sb.Seq())
+	}
+	return nil
+}
+
+// addPrepare records the prepare vote of a validator for the pending block
+func (vs *Visor) addPrepare(hash cipher.SHA256, sig cipher.Sig) (cipher.PubKey, error) {
+	pubkey, err := cipher.PubKeyFromSig(sig, pbft.PrepareHash(hash))
+	if err != nil {
+		return cipher.PubKey{}, err
+	}
+	if err := vs.checkVoter(hash, pubkey); err != nil {
+		return cipher.PubKey{}, err
+	}
+	return vs.pbft.AddPrepare(hash, sig)
+}
+
+// SignPrepare votes this node to prepare the pending block, returns the signature of the vote
+func (vs *Visor) SignPrepare(hash cipher.SHA256) (cipher.Sig, error) {
+	if err := vs.checkVoter(hash, vs.TrustPubkey()); err != nil {
+		return cipher.Sig{}, err
+	}
+	sb, err := vs.pbft.GetSignedBlock(hash)
+	if err != nil {
+		return cipher.Sig{}, err
+	}
+	sig, err := vs.signer.Sign(signer.PrepareRequest(sb.Head))
+	if err != nil {
+		return cipher.Sig{}, err
+	}
+	if _, err := vs.pbft.AddPrepare(hash, sig); err != nil {
+		return cipher.Sig{}, err
+	}
+	return sig, nil
+}
+
+// IsPrepared returns true if the quorum voted to prepare the pending block
+func (vs *Visor) IsPrepared(hash cipher.SHA256) bool {
+	quorum, err := vs.pendingQuorum(hash)
+	if err != nil {
+		return false
+	}
+	return vs.pbft.IsPrepared(hash, quorum)
+}
+
+// GetPrepareSigs returns the known prepare votes of the pending block
+func (vs *Visor) GetPrepareSigs(hash cipher.SHA256) []cipher.Sig {
+	return vs.pbft.GetPrepareSigs(hash)
+}
+
+// AddCommit adds the commit vote of a validator signed for the pending block
+func (vs *Visor) AddCommit(hash cipher.SHA256, sig cipher.Sig) (cipher.PubKey, error) {
+	pubkey, err := cipher.PubKeyFromSig(sig, pbft.CommitHash(hash))
+	if err != nil {
+		return cipher.PubKey{}, err
+	}
+	if err := vs.checkVoter(hash, pubkey); err != nil {
+		return cipher.PubKey{}, err
+	}
+	return pubkey, vs.pbft.AddCommit(hash, pubkey, sig)
+}
+
+// SignCommit votes this node to commit the pending block once it is prepared,
+// ok is false if it is not prepared yet, this node voted already or is not a validator
+func (vs *Visor) SignCommit(hash cipher.SHA256) (sig cipher.Sig, ok bool, err error) {
+	if !vs.IsPrepared(hash) || vs.pbft.HasCommitted(hash, vs.TrustPubkey()) || vs.checkVoter(hash, vs.TrustPubkey()) != nil {
+		return cipher.Sig{}, false, nil
+	}
+	sig, err = vs.signer.Sign(signer.CommitRequest(hash))
+	if err != nil {
+		return cipher.Sig{}, false, err
+	}
+	if err := vs.pbft.AddCommit(hash, vs.TrustPubkey(), sig); err != nil {
+		return cipher.Sig{}, false, err
+	}
+	return sig, true, nil
+}
+
+// CommitSig returns the commit vote of this node for the pending block, ok is false if it did not vote
+func (vs *Visor) CommitSig(hash cipher.SHA256) (sig cipher.Sig, ok bool) {
+	if !vs.pbft.HasCommitted(hash, vs.TrustPubkey()) {
+		return cipher.Sig{}, false
+	}
+	sig, err := vs.signer.Sign(signer.CommitRequest(hash))
+	if err != nil {
+		logger.Errorf("Sign commit of %s failed: %v", hash.Hex(), err)
+		return cipher.Sig{}, false
+	}
+	return sig, true
+}
+
+// IsCommitted returns true if the quorum voted to commit the pending block
+func (vs *Visor) IsCommitted(hash cipher.SHA256) bool {
+	quorum, err := vs.pendingQuorum(hash)
+	if err != nil {
+		return false
+	}
+	return vs.pbft.IsCommitted(hash, quorum)
+}
+
+// ExecuteCommittedBlock executes the pending block once the consensus engine finalized it and its
+// parent block is executed, ErrParentPending is returned while the parent block is pending
+func (vs *Visor) ExecuteCommittedBlock(hash cipher.SHA256) error {
+	if !vs.engine.IsFinal(hash) {
+		return ErrNotCommitted
+	}
+	sb, err := vs.pbft.GetSignedBlock(hash)
+	if err != nil {
+		return err
+	}
+	if sb.Seq() > vs.HeadBkSeq()+1 {
+		return ErrParentPending
+	}
+	return vs.StartExecuteSignedBlock(hash)
+}
+
+// quorumCert returns the quorum certificate of the pending block, nil if the quorum did not commit it
+func (vs *Visor) quorumCert(hash cipher.SHA256) *blockdb.QuorumCert {
+	if !vs.IsCommitted(hash) {
+		return nil
+	}
+	signers, err := vs.pbft.GetBlockCommitters(hash)
+	if err != nil {
+		return nil
+	}
+	return &blockdb.QuorumCert{
+		Hash:    hash,
+		Signers: append([]cipher.PubKey{}, signers...),
+		Sigs:    vs.pbft.GetCommitSigs(hash),
+	}
+}
+
+// verifyQuorumCert checks the quorum certificate of the block has commit votes of the quorum of
+// the validators, blocks from Config.QuorumCertHeight on must have one. A block of a lower height
+// may come with a certificate, it is checked too.
+func (vs *Visor) verifyQuorumCert(b coin.SignedBlock, qc *blockdb.QuorumCert, validators []cipher.PubKey) error {
+	if qc == nil {
+		if vs.Config.QuorumCertHeight > 0 && b.Seq() >= vs.Config.QuorumCertHeight {
+			return ErrMissingQuorumCert
+		}
+		return nil
+	}
+
+	hash := b.HashHeader()
+	if qc.Hash != hash {
+		return fmt.Errorf("quorum certificate of block %s is for block %s", hash.Hex(), qc.Hash.Hex())
+	}
+	if len(qc.Signers) != len(qc.Sigs) {
+		return errors.New("quorum certificate has not one signature per signer")
+	}
+
+	commitHash := pbft.CommitHash(hash)
+	signers := make([]cipher.PubKey, 0, len(qc.Signers))
+	for i, pubkey := range qc.Signers {
+		if !containsPubkey(validators, pubkey) {
+			return fmt.Errorf("quorum certificate signer %s is not a validator", pubkey.Hex())
+		}
+		if containsPubkey(signers, pubkey) {
+			return fmt.Errorf("quorum certificate signer %s is duplicated", pubkey.Hex())
+		}
+		if err := cipher.VerifySignature(pubkey, qc.Sigs[i], commitHash); err != nil {
+			return fmt.Errorf("quorum certificate signature of %s is invalid: %v", pubkey.Hex(), err)
+		}
+		signers = append(signers, pubkey)
+	}
+
+	if quorum := vs.Quorum(b.Seq()); len(signers) < quorum {
+		return fmt.Errorf("quorum certificate has %d signers, the quorum is %d", len(signers), quorum)
+	}
+	return nil
+}
+
+// GetQuorumCert returns the quorum certificate of the executed block, nil if it has none
+func (vs *Visor) GetQuorumCert(hash cipher.SHA256) (*blockdb.QuorumCert, error) {
+	return vs.quorumCerts.Get(hash)
+}
+
+// GetQuorumCerts returns the quorum certificates of the executed blocks which have one
+func (vs *Visor) GetQuorumCerts(blocks []coin.SignedBlock) ([]blockdb.QuorumCert, error) {
+	certs := []blockdb.QuorumCert{}
+	for _, b := range blocks {
+		qc, err := vs.quorumCerts.Get(b.HashHeader())
+		if err != nil {
+			return nil, err
+		}
+		if qc != nil {
+			certs = append(certs, *qc)
+		}
+	}
+	return certs, nil
+}
+
+// AddPreparedBlock adds a block a quorum prepared in an earlier view, it is proposed again by
+// any validator which kept it. The prepare votes of a block already pending are added to it.
+func (vs *Visor) AddPreparedBlock(block coin.SignedBlock, prepares []cipher.Sig) error {
+	hash := block.HashHeader()
+	if vs.CheckHashExists(hash) {
+		for _, sig := range prepares {
+			if _, err := vs.AddPrepare(hash, sig); err != nil {
+				logger.Debugf("AddPrepare for block %s failed: %v", hash.Hex(), err)
+			}
+		}
+		return nil
+	}
+
+	if err := vs.CheckBlockMakerConstraint(block); err != nil {
+		return err
+	}
+	if err := vs.VerifyBlockTransactions(block); err != nil {
+		return err
+	}
+	if err := vs.verifyPendingParent(block); err != nil {
+		return err
+	}
+
+	// the producer votes by the signature of the block
+	producer, err := blockProducer(block)
+	if err != nil {
+		return err
+	}
+	voters := []cipher.PubKey{}
+	if vs.isValidatorAt(producer, block.Seq()) {
+		voters = append(voters, producer)
+	}
+	for _, sig := range prepares {
+		pubkey, err := cipher.PubKeyFromSig(sig, pbft.PrepareHash(hash))
+		if err != nil {
+			return err
+		}
+		if vs.isValidatorAt(pubkey, block.Seq()) && !containsPubkey(voters, pubkey) {
+			voters = append(voters, pubkey)
+		}
+	}
+	if len(voters) < vs.Quorum(block.Seq()) {
+		return errors.New("block is not prepared by the quorum")
+	}
+
+	return vs.pbft.AddPreparedBlock(block, prepares)
+}
+
+// GetPendingBlock returns the pending block of the hash
+func (vs *Visor) GetPendingBlock(hash cipher.SHA256) (coin.SignedBlock, error) {
+	return vs.pbft.GetSignedBlock(hash)
+}
+
+// GetView returns the view of the next block
+func (vs *Visor) GetView() uint64 {
+	return vs.pbft.GetView()
+}
+
+// ViewTimedOut returns true if the pending block of the current view was not committed in time,
+// only the PBFT engine replaces a producer by a view change
+func (vs *Visor) ViewTimedOut(timeout time.Duration) bool {
+	if _, ok := vs.engine.(dposPbftEngine); !ok {
+		return false
+	}
+	return vs.pbft.ViewTimedOut(vs.pbft.Now(), int64(timeout/time.Second))
+}
+
+// AddViewChange adds the vote of a validator signed for moving to the view at the height of the
+// next block, the view starts once the quorum voted for it. join is true if f+1 validators voted
+// for the view, at least one of them is correct, and this node has not voted for it yet.
+func (vs *Visor) AddViewChange(seq, view uint64, sig cipher.Sig) (join bool, err error) {
+	if seq != vs.HeadBkSeq()+1 {
+		return false, fmt.Errorf("view change of block %d is not for the next block", seq)
+	}
+	pubkey, err := cipher.PubKeyFromSig(sig, pbft.ViewChangeHash(seq, view))
+	if err != nil {
+		return false, err
+	}
+	if !vs.IsTrustPubkey(pubkey) {
+		return false, fmt.Errorf("%s is not a validator", pubkey.Hex())
+	}
+
+	votes, err := vs.pbft.AddViewChange(view, pubkey)
+	if err != nil {
+		return false, err
+	}
+
+	quorum := vs.Quorum(seq)
+	if votes >= quorum {
+		return false, vs.StartView(view)
+	}
+	faulty := vs.validatorNum(seq) - quorum
+	return votes > faulty && !vs.pbft.HasViewChange(view, vs.TrustPubkey()), nil
+}
+
+// VoteViewChange votes this node to move to the next view of the next block,
+// returns the signature of the vote to broadcast. A vote cast already is signed again.
+func (vs *Visor) VoteViewChange(view uint64) (seq uint64, sig cipher.Sig, err error) {
+	seq = vs.HeadBkSeq() + 1
+	sig, err = vs.signer.Sign(signer.ViewChangeRequest(seq, view))
+	if err != nil {
+		return 0, cipher.Sig{}, err
+	}
+	if vs.pbft.HasViewChange(view, vs.TrustPubkey()) {
+		return seq, sig, nil
+	}
+	if _, err := vs.AddViewChange(seq, view, sig); err != nil {
+		return 0, cipher.Sig{}, err
+	}
+	return seq, sig, nil
+}
+
+// StartView moves to the view, the pending block which is not prepared is dropped with the blocks
+// extending it and counted as orphaned, the next scheduled producer proposes the block of the height
+func (vs *Visor) StartView(view uint64) error {
+	seq := vs.HeadBkSeq() + 1
+	dropped := vs.pbft.StartView(seq, view, vs.Quorum(seq))
+	logger.Infof("Start view %d of block %d, dropped %d pending blocks", view, seq, len(dropped))
+	return vs.recordOrphaned(dropped)
+}
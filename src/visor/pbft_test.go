@@ -0,0 +1,277 @@
+package visor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/signer"
+	"github.com/samoslab/samos/src/testutil"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+// newPbftTestVisor returns a visor with four validators running as the second of them
+func newPbftTestVisor(t *testing.T, db *bolt.DB) (*Visor, []cipher.PubKey, []cipher.SecKey) {
+	pks := make([]cipher.PubKey, 4)
+	sks := make([]cipher.SecKey, 4)
+	for i := range pks {
+		pks[i], sks[i] = cipher.GenerateKeyPair()
+	}
+
+	qcs, err := blockdb.NewQuorumCerts(db)
+	require.NoError(t, err)
+
+	v := newJailTestVisor(t, db, pks)
+	require.NoError(t, v.trustNode.AddNodePubkey(pks))
+	v.pbft = pbft.NewPBFT()
+	v.quorumCerts = qcs
+	v.Config.BlockchainTrustPubkey = pks[1]
+	v.Config.BlockchainTrustSeckey = sks[1]
+
+	genesis := coin.Block{Head: coin.BlockHeader{Time: 100}}
+	v.Blockchain = &Blockchain{db: db, store: &fakeChainStore{blocks: []coin.SignedBlock{
+		{Block: genesis, Sig: cipher.SignHash(genesis.HashHeader(), sks[0])},
+	}}}
+	return v, pks, sks
+}
+
+func addTestPendingBlock(t *testing.T, v *Visor, sk cipher.SecKey, tm uint64) cipher.SHA256 {
+	b := coin.Block{Head: coin.BlockHeader{BkSeq: 1, Time: tm}}
+	sb := coin.SignedBlock{Block: b, Sig: cipher.SignHash(b.HashHeader(), sk)}
+	require.NoError(t, v.pbft.AddSignedBlock(sb))
+	return sb.HashHeader()
+}
+
+func TestVisorPrepareCommit(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	v, pks, sks := newPbftTestVisor(t, db)
+	require.Equal(t, 3, v.Quorum(1))
+
+	// the agree number announced by the genesis node does not change the quorum
+	require.NoError(t, v.trustNode.InsertAgreeNodeNum(4))
+	require.Equal(t, 3, v.Quorum(1))
+
+	// a larger governed quorum is kept from the height of its validator set on
+	require.NoError(t, v.addValidatorSet(5, 1, pks, 4))
+	require.Equal(t, 3, v.Quorum(4))
+	require.Equal(t, 4, v.Quorum(5))
+	require.NoError(t, v.addValidatorSet(6, 1, pks, 1))
+	require.Equal(t, 3, v.Quorum(6))
+
+	hash := addTestPendingBlock(t, v, sks[0], 110)
+	require.False(t, v.IsPrepared(hash))
+
+	sig, err := v.SignPrepare(hash)
+	require.NoError(t, err)
+	require.NoError(t, cipher.VerifySignature(pks[1], sig, pbft.PrepareHash(hash)))
+
+	// no commit before the block is prepared
+	_, ok, err := v.SignCommit(hash)
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, ok = v.CommitSig(hash)
+	require.False(t, ok)
+
+	otherPk, otherSk := cipher.GenerateKeyPair()
+	_, err = v.AddPrepare(hash, cipher.SignHash(pbft.PrepareHash(hash), otherSk))
+	testutil.RequireError(t, err, otherPk.Hex()+" is not a validator of block 1")
+
+	pk, err := v.AddPrepare(hash, cipher.SignHash(pbft.PrepareHash(hash), sks[2]))
+	require.NoError(t, err)
+	require.Equal(t, pks[2], pk)
+	require.True(t, v.IsPrepared(hash))
+	require.Len(t, v.GetPrepareSigs(hash), 2)
+
+	sig, ok, err = v.SignCommit(hash)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, cipher.VerifySignature(pks[1], sig, pbft.CommitHash(hash)))
+	sig, ok = v.CommitSig(hash)
+	require.True(t, ok)
+	require.NoError(t, cipher.VerifySignature(pks[1], sig, pbft.CommitHash(hash)))
+	_, ok, err = v.SignCommit(hash)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.False(t, v.IsCommitted(hash))
+	require.Equal(t, ErrNotCommitted, v.ExecuteCommittedBlock(hash))
+
+	// a prepare vote does not count as commit vote
+	_, err = v.AddCommit(hash, cipher.SignHash(hash, sks[0]))
+	require.Error(t, err)
+
+	pk, err = v.AddCommit(hash, cipher.SignHash(pbft.CommitHash(hash), sks[0]))
+	require.NoError(t, err)
+	require.Equal(t, pks[0], pk)
+	require.False(t, v.IsCommitted(hash))
+	require.Nil(t, v.quorumCert(hash))
+	_, err = v.AddCommit(hash, cipher.SignHash(pbft.CommitHash(hash), sks[3]))
+	require.NoError(t, err)
+	require.True(t, v.IsCommitted(hash))
+
+	qc := v.quorumCert(hash)
+	require.NotNil(t, qc)
+	require.Equal(t, hash, qc.Hash)
+	require.Equal(t, []cipher.PubKey{pks[1], pks[0], pks[3]}, qc.Signers)
+	sb, err := v.GetPendingBlock(hash)
+	require.NoError(t, err)
+	require.NoError(t, v.verifyQuorumCert(sb, qc, pks))
+}
+
+func TestVisorSignPrepareGuard(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	dir, err := ioutil.TempDir("", "signstate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sign_state.json")
+
+	v, _, sks := newPbftTestVisor(t, db)
+	guard, err := signer.LoadGuard(path)
+	require.NoError(t, err)
+	v.signer = signer.NewLocal(v.TrustSeckey, cipher.SecKey{}, guard)
+
+	// this node prepares one of two blocks of a slot
+	hash := addTestPendingBlock(t, v, sks[0], 110)
+	_, err = v.SignPrepare(hash)
+	require.NoError(t, err)
+
+	// the pending blocks are lost by a restart, the other block is not prepared
+	v.pbft = pbft.NewPBFT()
+	guard, err = signer.LoadGuard(path)
+	require.NoError(t, err)
+	v.signer = signer.NewLocal(v.TrustSeckey, cipher.SecKey{}, guard)
+
+	b := coin.Block{Head: coin.BlockHeader{BkSeq: 1, Time: 111}}
+	sb := coin.SignedBlock{Block: b, Sig: cipher.SignHash(b.HashHeader(), sks[2])}
+	require.NoError(t, v.pbft.AddSignedBlock(sb))
+	_, err = v.SignPrepare(sb.HashHeader())
+	testutil.RequireError(t, err, fmt.Sprintf("refusing to sign block %s at height 1 slot 11, block %s at height 1 slot 11 was signed",
+		sb.HashHeader().Hex(), hash.Hex()))
+}
+
+func TestVerifyQuorumCert(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	v, pks, sks := newPbftTestVisor(t, db)
+
+	b := coin.Block{Head: coin.BlockHeader{BkSeq: 1, Time: 110}}
+	sb := coin.SignedBlock{Block: b, Sig: cipher.SignHash(b.HashHeader(), sks[0])}
+	hash := sb.HashHeader()
+	commitHash := pbft.CommitHash(hash)
+
+	makeCert := func(keys ...int) *blockdb.QuorumCert {
+		qc := &blockdb.QuorumCert{Hash: hash}
+		for _, i := range keys {
+			qc.Signers = append(qc.Signers, pks[i])
+			qc.Sigs = append(qc.Sigs, cipher.SignHash(commitHash, sks[i]))
+		}
+		return qc
+	}
+
+	require.NoError(t, v.verifyQuorumCert(sb, nil, pks))
+	require.NoError(t, v.verifyQuorumCert(sb, makeCert(0, 1, 2), pks))
+	require.NoError(t, v.verifyQuorumCert(sb, makeCert(3, 2, 1, 0), pks))
+
+	v.Config.QuorumCertHeight = 2
+	require.NoError(t, v.verifyQuorumCert(sb, nil, pks))
+	v.Config.QuorumCertHeight = 1
+	require.Equal(t, ErrMissingQuorumCert, v.verifyQuorumCert(sb, nil, pks))
+
+	qc := makeCert(0, 1)
+	testutil.RequireError(t, v.verifyQuorumCert(sb, qc, pks), "quorum certificate has 2 signers, the quorum is 3")
+
+	qc = makeCert(0, 1, 2)
+	qc.Hash = cipher.SumSHA256([]byte("other"))
+	require.Error(t, v.verifyQuorumCert(sb, qc, pks))
+
+	qc = makeCert(0, 1, 2)
+	qc.Sigs = qc.Sigs[:2]
+	testutil.RequireError(t, v.verifyQuorumCert(sb, qc, pks), "quorum certificate has not one signature per signer")
+
+	qc = makeCert(0, 1, 1)
+	testutil.RequireError(t, v.verifyQuorumCert(sb, qc, pks), "quorum certificate signer "+pks[1].Hex()+" is duplicated")
+
+	qc = makeCert(0, 1, 2)
+	testutil.RequireError(t, v.verifyQuorumCert(sb, qc, pks[:2]), "quorum certificate signer "+pks[2].Hex()+" is not a validator")
+
+	// prepare votes do not certify the block
+	qc = makeCert(0, 1, 2)
+	qc.Sigs[2] = cipher.SignHash(pbft.PrepareHash(hash), sks[2])
+	require.Error(t, v.verifyQuorumCert(sb, qc, pks))
+
+	// the certificate is stored with the executed block
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return v.quorumCerts.AddWithTx(tx, *makeCert(0, 1, 2))
+	}))
+	stored, err := v.GetQuorumCert(hash)
+	require.NoError(t, err)
+	require.Equal(t, makeCert(0, 1, 2).Signers, stored.Signers)
+	certs, err := v.GetQuorumCerts([]coin.SignedBlock{sb, {Block: coin.Block{Head: coin.BlockHeader{BkSeq: 2}}}})
+	require.NoError(t, err)
+	require.Len(t, certs, 1)
+	require.Equal(t, hash, certs[0].Hash)
+}
+
+func TestVisorViewChange(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	v, pks, sks := newPbftTestVisor(t, db)
+
+	hash := addTestPendingBlock(t, v, sks[0], uint64(time.Now().Unix()))
+	require.False(t, v.ViewTimedOut(time.Minute))
+	require.True(t, v.ViewTimedOut(-time.Minute))
+
+	vote := func(sk cipher.SecKey, seq, view uint64) (bool, error) {
+		return v.AddViewChange(seq, view, cipher.SignHash(pbft.ViewChangeHash(seq, view), sk))
+	}
+
+	_, err := vote(sks[2], 2, 1)
+	testutil.RequireError(t, err, "view change of block 2 is not for the next block")
+	otherPk, otherSk := cipher.GenerateKeyPair()
+	_, err = vote(otherSk, 1, 1)
+	testutil.RequireError(t, err, otherPk.Hex()+" is not a validator")
+
+	// one vote may come from a faulty validator, two are joined
+	join, err := vote(sks[2], 1, 1)
+	require.NoError(t, err)
+	require.False(t, join)
+	join, err = vote(sks[3], 1, 1)
+	require.NoError(t, err)
+	require.True(t, join)
+
+	seq, sig, err := v.VoteViewChange(1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), seq)
+	require.NoError(t, cipher.VerifySignature(pks[1], sig, pbft.ViewChangeHash(1, 1)))
+
+	// the quorum voted, the block which is not prepared is dropped
+	require.Equal(t, uint64(1), v.GetView())
+	require.False(t, v.CheckHashExists(hash))
+	_, err = v.GetPendingBlock(hash)
+	require.Error(t, err)
+	require.True(t, v.pbft.IsExcluded(pks[0]))
+
+	// the producer replaced in this view proposes no other block
+	b := coin.Block{Head: coin.BlockHeader{BkSeq: 1, Time: 120}}
+	sb := coin.SignedBlock{Block: b, Sig: cipher.SignHash(b.HashHeader(), sks[0])}
+	require.Equal(t, pbft.ErrProducerExcluded, v.pbft.AddSignedBlock(sb))
+
+	// a vote of an earlier view is refused
+	_, err = vote(sks[2], 1, 1)
+	require.Error(t, err)
+}
@@ -0,0 +1,178 @@
+package visor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+)
+
+// ErrParentPending is returned when a committed block waits for its parent block to be executed
+var ErrParentPending = errors.New("parent block is not executed yet")
+
+// pendingState is the unspent outputs after the pending blocks a new block extends
+type pendingState struct {
+	uxHash    cipher.SHA256
+	spent     map[cipher.SHA256]struct{} // outputs spent by the pending blocks
+	evidences map[cipher.SHA256]struct{} // keys of the evidence included by the pending blocks
+}
+
+// spends returns the output of the transaction which is spent by the pending blocks
+func (st pendingState) spends(txn coin.Transaction) (cipher.SHA256, bool) {
+	for _, in := range txn.In {
+		if _, ok := st.spent[in]; ok {
+			return in, true
+		}
+	}
+	return cipher.SHA256{}, false
+}
+
+// pendingStateOf applies the pending blocks, ordered by height, to the unspent outputs of the head
+// block. Only the outputs hash is updated, the unspent pool is not changed. The pending blocks
+// spend confirmed outputs only.
+func (vs *Visor) pendingStateOf(chain []coin.SignedBlock) (pendingState, error) {
+	unspent := vs.Blockchain.Unspent()
+	st := pendingState{
+		uxHash:    unspent.GetUxHash(),
+		spent:     make(map[cipher.SHA256]struct{}),
+		evidences: make(map[cipher.SHA256]struct{}),
+	}
+
+	for _, b := range chain {
+		for _, txn := range b.Body.Transactions {
+			if txn.Type == coin.TxTypeEvidence {
+				e, err := evidenceOfTxn(txn)
+				if err != nil {
+					return pendingState{}, err
+				}
+				st.evidences[e.Key()] = struct{}{}
+				continue
+			}
+			for _, in := range txn.In {
+				if _, ok := st.spent[in]; ok {
+					return pendingState{}, fmt.Errorf("pending block %d spends output %s twice", b.Seq(), in.Hex())
+				}
+				ux, ok := unspent.Get(in)
+				if !ok {
+					return pendingState{}, fmt.Errorf("pending block %d spends unknown output %s", b.Seq(), in.Hex())
+				}
+				st.uxHash = st.uxHash.Xor(ux.SnapshotHash())
+				st.spent[in] = struct{}{}
+			}
+			for _, ux := range coin.CreateUnspents(b.Head, txn) {
+				st.uxHash = st.uxHash.Xor(ux.SnapshotHash())
+			}
+		}
+	}
+	return st, nil
+}
+
+// pendingTip returns the pending block a new block extends and the state after it,
+// ok is false if no block is pending and a new block extends the head block
+func (vs *Visor) pendingTip() (tip coin.SignedBlock, st pendingState, ok bool, err error) {
+	tip, ok = vs.pbft.GetTip()
+	if !ok {
+		return coin.SignedBlock{}, pendingState{}, false, nil
+	}
+	st, err = vs.pendingStateOf(vs.pbft.GetAncestors(tip.HashHeader()))
+	if err != nil {
+		return coin.SignedBlock{}, pendingState{}, false, err
+	}
+	return tip, st, true, nil
+}
+
+// tipTime returns the time of the block a new block extends
+func (vs *Visor) tipTime() uint64 {
+	if tip, ok := vs.pbft.GetTip(); ok {
+		return tip.Time()
+	}
+	return vs.Blockchain.Time()
+}
+
+// extendTip makes the block created on the head block extend the pending tip instead
+func (vs *Visor) extendTip(b *coin.Block, tip coin.SignedBlock, st pendingState, when uint64) (*coin.Block, error) {
+	if when <= tip.Time() {
+		return nil, errors.New("Time can only move forward")
+	}
+	if len(b.Body.Transactions) == 0 {
+		return coin.NewEmptyBlock(tip.Block, when, st.uxHash), nil
+	}
+	return coin.NewBlock(tip.Block, when, st.uxHash, b.Body.Transactions, vs.Blockchain.TransactionFee)
+}
+
+// parentBlock returns the block the block extends, executed or pending
+func (vs *Visor) parentBlock(b coin.Block) (*coin.SignedBlock, error) {
+	if vs.pbft != nil {
+		if sb, err := vs.pbft.GetSignedBlock(b.Head.PrevHash); err == nil {
+			return &sb, nil
+		}
+	}
+	prev, err := vs.Blockchain.GetBlockBySeq(b.Seq() - 1)
+	if err != nil {
+		return nil, err
+	}
+	if prev == nil {
+		return nil, fmt.Errorf("block %d before block %d is not found", b.Seq()-1, b.Seq())
+	}
+	return prev, nil
+}
+
+// verifyPendingParent checks a block extending a pending block spends no output its pending
+// ancestors spend and its UxHash is the hash of the unspent outputs after them
+func (vs *Visor) verifyPendingParent(b coin.SignedBlock) error {
+	ancestors := vs.pbft.GetAncestors(b.Head.PrevHash)
+	if len(ancestors) == 0 {
+		return nil
+	}
+
+	st, err := vs.pendingStateOf(ancestors)
+	if err != nil {
+		return err
+	}
+	if b.Head.UxHash != st.uxHash {
+		return errors.New("UxHash does not match the pending blocks")
+	}
+	for _, txn := range b.Body.Transactions {
+		if in, ok := st.spends(txn); ok {
+			return fmt.Errorf("transaction %s spends output %s spent by a pending block", txn.TxIDHex(), in.Hex())
+		}
+		if txn.Type != coin.TxTypeEvidence {
+			continue
+		}
+		e, err := evidenceOfTxn(txn)
+		if err != nil {
+			return err
+		}
+		if _, ok := st.evidences[e.Key()]; ok {
+			return fmt.Errorf("transaction %s includes evidence a pending block included", txn.TxIDHex())
+		}
+	}
+	return nil
+}
+
+// PendingWindowFull returns true if no other block may be pending until a pending block is executed
+func (vs *Visor) PendingWindowFull() bool {
+	return vs.pbft.IsFull()
+}
+
+// PendingChild returns the hash of the pending block extending the block of the hash
+func (vs *Visor) PendingChild(hash cipher.SHA256) (cipher.SHA256, bool) {
+	return vs.pbft.GetChild(hash)
+}
+
+// pruneExecuted drops the pending blocks abandoned by executing the block,
+// they are counted as orphaned
+func (vs *Visor) pruneExecuted(b coin.SignedBlock) {
+	if vs.pbft == nil {
+		return
+	}
+	dropped := vs.pbft.PruneExecuted(b.Seq(), b.HashHeader())
+	if len(dropped) == 0 {
+		return
+	}
+	logger.Infof("Block %d executed, dropped %d abandoned pending blocks", b.Seq(), len(dropped))
+	if err := vs.recordOrphaned(dropped); err != nil {
+		logger.Errorf("Record orphaned blocks failed: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package visor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/signer"
+	"github.com/samoslab/samos/src/testutil"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+func TestVisorPipeline(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	db, bc, err := loadBlockchain(db, []cipher.PubKey{genPublic}, false)
+	require.NoError(t, err)
+
+	cfg := NewVisorConfig()
+	cfg.DBPath = db.Path()
+	cfg.IsMaster = true
+	cfg.BlockchainPubkey = genPublic
+	cfg.BlockchainSeckey = genSecret
+	cfg.BlockchainTrustPubkey = genPublic
+	cfg.BlockchainTrustSeckey = genSecret
+	cfg.GenesisAddress = genAddress
+	cfg.TrustPubkeyList = []cipher.PubKey{genPublic}
+	cfg.EmptyBlocks = true
+	cfg.BlockReward = 1e6
+	d := dpos.NewDpos(genPublic)
+	require.NoError(t, d.SetTrustNode(cfg.TrustPubkeyList))
+	tn, err := blockdb.NewTrustNode(db)
+	require.NoError(t, err)
+	require.NoError(t, tn.AddNodePubkey(cfg.TrustPubkeyList))
+	qcs, err := blockdb.NewQuorumCerts(db)
+	require.NoError(t, err)
+
+	v := &Visor{
+		Config:      cfg,
+		Unconfirmed: NewUnconfirmedTxnPool(db),
+		Blockchain:  bc,
+		db:          db,
+		pbft:        pbft.NewPBFT(),
+		dpos:        d,
+		trustNode:   tn,
+		quorumCerts: qcs,
+	}
+	v.engine = dposPbftEngine{vs: v}
+	v.signer = signer.NewLocal(v.TrustSeckey, v.Config.BlockchainSeckey, nil)
+	v.pbft.SetWindow(2)
+
+	gb := addGenesisBlock(t, v.Blockchain)
+
+	propose := func(when uint64) coin.SignedBlock {
+		sb, err := v.CreateBlock(when)
+		require.NoError(t, err)
+		require.NoError(t, v.AddPendingBlock(sb.ToSignedBlock()))
+		return sb.ToSignedBlock()
+	}
+	commit := func(b coin.SignedBlock) {
+		_, ok, err := v.SignCommit(b.HashHeader())
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	// the second block extends the pending first block
+	b1 := propose(gb.Time() + 10)
+	require.False(t, v.PendingWindowFull())
+	b2 := propose(gb.Time() + 20)
+	require.True(t, v.PendingWindowFull())
+	require.Equal(t, uint64(2), b2.Seq())
+	require.Equal(t, b1.HashHeader(), b2.Head.PrevHash)
+	require.NotEqual(t, b1.Head.UxHash, b2.Head.UxHash)
+	child, ok := v.PendingChild(b1.HashHeader())
+	require.True(t, ok)
+	require.Equal(t, b2.HashHeader(), child)
+
+	sb, err := v.CreateBlock(gb.Time() + 30)
+	require.NoError(t, err)
+	testutil.RequireError(t, v.AddPendingBlock(sb.ToSignedBlock()), "block 3 is beyond the window of 2 pending blocks after head 0")
+
+	// the UxHash of a block extending a pending block covers the outputs of the pending blocks
+	bad := coin.NewEmptyBlock(b1.Block, b1.Time()+5, gb.Head.UxHash)
+	err = v.verifyPendingParent(coin.SignedBlock{Block: *bad, Sig: cipher.SignHash(bad.HashHeader(), genSecret)})
+	testutil.RequireError(t, err, "UxHash does not match the pending blocks")
+
+	// the blocks are executed in order
+	commit(b2)
+	require.Equal(t, ErrParentPending, v.ExecuteCommittedBlock(b2.HashHeader()))
+	commit(b1)
+	require.NoError(t, v.ExecuteCommittedBlock(b1.HashHeader()))
+	require.Equal(t, uint64(1), v.HeadBkSeq())
+	require.False(t, v.PendingWindowFull())
+	require.Equal(t, b2.Head.UxHash, v.Blockchain.Unspent().GetUxHash())
+	require.NoError(t, v.ExecuteCommittedBlock(b2.HashHeader()))
+	require.Equal(t, uint64(2), v.HeadBkSeq())
+
+	// executing another block of the height drops the pending blocks
+	b3 := propose(b2.Time() + 10)
+	propose(b2.Time() + 20)
+	require.True(t, v.PendingWindowFull())
+
+	other, err := v.Blockchain.NewEmptyBlock(b2.Time() + 5)
+	require.NoError(t, err)
+	require.NoError(t, v.addCoinbase(other))
+	osb := coin.SignedBlock{Block: *other, Sig: cipher.SignHash(other.HashHeader(), genSecret)}
+	require.NotEqual(t, b3.HashHeader(), osb.HashHeader())
+	require.NoError(t, v.ExecuteSignedBlock(osb, nil))
+	require.Equal(t, uint64(3), v.HeadBkSeq())
+	require.Empty(t, v.pbft.WaitingConfirmedBlockHash())
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/coin"
 	"github.com/samoslab/samos/src/util/droplet"
+	"github.com/samoslab/samos/src/visor/blockdb"
 	"github.com/samoslab/samos/src/wallet"
 )
 
@@ -543,9 +544,10 @@ func NewReadableBlockBody(b *coin.Block) (*ReadableBlockBody, error) {
 
 // ReadableBlock represents readable block
 type ReadableBlock struct {
-	Head ReadableBlockHeader `json:"header"`
-	Body ReadableBlockBody   `json:"body"`
-	Size int                 `json:"size"`
+	Head       ReadableBlockHeader `json:"header"`
+	Body       ReadableBlockBody   `json:"body"`
+	Size       int                 `json:"size"`
+	QuorumCert *ReadableQuorumCert `json:"quorum_cert,omitempty"`
 }
 
 // NewReadableBlock creates readable block
@@ -561,6 +563,27 @@ func NewReadableBlock(b *coin.Block) (*ReadableBlock, error) {
 	}, nil
 }
 
+// ReadableQuorumCert represents the readable quorum certificate of a block
+type ReadableQuorumCert struct {
+	Signers    []string `json:"signers"`
+	Signatures []string `json:"signatures"`
+}
+
+// NewReadableQuorumCert creates readable quorum certificate
+func NewReadableQuorumCert(qc *blockdb.QuorumCert) *ReadableQuorumCert {
+	rqc := ReadableQuorumCert{
+		Signers:    make([]string, len(qc.Signers)),
+		Signatures: make([]string, len(qc.Sigs)),
+	}
+	for i, pk := range qc.Signers {
+		rqc.Signers[i] = pk.Hex()
+	}
+	for i, sig := range qc.Sigs {
+		rqc.Signatures[i] = sig.Hex()
+	}
+	return &rqc
+}
+
 // ReadableBlocks an array of readable blocks.
 type ReadableBlocks struct {
 	Blocks []ReadableBlock `json:"blocks"`
@@ -0,0 +1,205 @@
+package visor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/signer"
+)
+
+var (
+	// ErrCoinbaseRewards is returned when the coinbase transaction of a block does not pay
+	// the rewards of the chain parameters
+	ErrCoinbaseRewards = errors.New("coinbase transaction does not pay the block rewards")
+	// ErrUnexpectedCoinbase is returned when a block without rewards has a coinbase transaction
+	ErrUnexpectedCoinbase = errors.New("block pays no rewards but has a coinbase transaction")
+)
+
+// percentOf returns pct percent of v rounded down, without overflowing
+func percentOf(v uint64, pct int) uint64 {
+	p := uint64(pct)
+	return v/100*p + v%100*p/100
+}
+
+// rewardsEnabled returns true if the block at the height pays rewards
+func (vs *Visor) rewardsEnabled(height uint64) bool {
+	if height == 0 || height < vs.Config.BlockRewardHeight {
+		return false
+	}
+	return vs.Config.BlockReward > 0 || vs.Config.FeeRewardPercent > 0
+}
+
+// coinbaseOutputs returns the rewards of a block with the fee, the first output pays the
+// producer and the others the co-signers. Co-signers get equal shares of
+// Config.CosignerRewardPercent of the reward, the coins rounded down to the droplet
+// precision, the producer gets the rest. Outputs without coins and hours are left out.
+func (vs *Visor) coinbaseOutputs(producer cipher.Address, cosigners []cipher.Address, fee uint64) []coin.TransactionOutput {
+	coins := vs.Config.BlockReward
+	hours := percentOf(fee, vs.Config.FeeRewardPercent)
+
+	var cosignerCoins, cosignerHours uint64
+	if n := uint64(len(cosigners)); n > 0 {
+		cosignerCoins = percentOf(coins, vs.Config.CosignerRewardPercent) / n
+		cosignerCoins -= cosignerCoins % maxDropletDivisor
+		cosignerHours = percentOf(hours, vs.Config.CosignerRewardPercent) / n
+		coins -= cosignerCoins * n
+		hours -= cosignerHours * n
+	}
+
+	outs := []coin.TransactionOutput{}
+	if coins > 0 || hours > 0 {
+		outs = append(outs, coin.TransactionOutput{Address: producer, Coins: coins, Hours: hours})
+	}
+	if cosignerCoins > 0 || cosignerHours > 0 {
+		for _, addr := range cosigners {
+			outs = append(outs, coin.TransactionOutput{Address: addr, Coins: cosignerCoins, Hours: cosignerHours})
+		}
+	}
+	return outs
+}
+
+// recordCosigners remembers the validators which prepared the block before it was executed,
+// the producer of the next block rewards them
+func (vs *Visor) recordCosigners(hash cipher.SHA256, pubkeys []cipher.PubKey) {
+	vs.cosignersMutex.Lock()
+	defer vs.cosignersMutex.Unlock()
+	vs.cosignersHash = hash
+	vs.cosigners = pubkeys
+}
+
+// rewardCosigners returns the addresses of the validators which co-signed the executed head block,
+// the producer of the head block is not one of them. A pending block has none yet.
+func (vs *Visor) rewardCosigners(head *coin.SignedBlock) []cipher.Address {
+	if vs.Config.CosignerRewardPercent == 0 {
+		return nil
+	}
+
+	vs.cosignersMutex.Lock()
+	hash, pubkeys := vs.cosignersHash, vs.cosigners
+	vs.cosignersMutex.Unlock()
+
+	if hash != head.HashHeader() {
+		return nil
+	}
+
+	producer, err := cipher.PubKeyFromSig(head.Sig, hash)
+	if err != nil {
+		return nil
+	}
+	validators := vs.validatorsAt(head.Seq())
+	addrs := []cipher.Address{}
+	for _, pk := range mergePubkeys(pubkeys) {
+		if pk != producer && containsPubkey(validators, pk) {
+			addrs = append(addrs, cipher.AddressFromPubKey(pk))
+		}
+	}
+	return addrs
+}
+
+// addCoinbase appends the coinbase transaction paying the rewards of this node to the new block
+func (vs *Visor) addCoinbase(b *coin.Block) error {
+	if !vs.rewardsEnabled(b.Seq()) {
+		return nil
+	}
+
+	prev, err := vs.parentBlock(*b)
+	if err != nil {
+		return err
+	}
+
+	outs := vs.coinbaseOutputs(cipher.AddressFromPubKey(vs.TrustPubkey()), vs.rewardCosigners(prev), b.Head.Fee)
+	if len(outs) == 0 {
+		return nil
+	}
+
+	sig, err := vs.signer.Sign(signer.CoinbaseRequest(prev.HashHeader(), outs))
+	if err != nil {
+		return err
+	}
+	b.Body.Transactions = append(b.Body.Transactions, coin.NewSignedCoinbaseTransaction(outs, sig))
+	b.Head.BodyHash = b.HashBody()
+	return nil
+}
+
+// verifyCoinbase checks the coinbase transaction of the block is signed by its producer and pays
+// the rewards of the chain parameters. The co-signers it pays must be validators of the previous
+// block other than its producer; that they prepared the block is trusted to the producer.
+func (vs *Visor) verifyCoinbase(b coin.SignedBlock) error {
+	var coinbase *coin.Transaction
+	if n := len(b.Body.Transactions); n > 0 && b.Body.Transactions[n-1].Type == coin.TxTypeCoinbase {
+		coinbase = &b.Body.Transactions[n-1]
+	}
+
+	if !vs.rewardsEnabled(b.Seq()) {
+		if coinbase != nil {
+			return ErrUnexpectedCoinbase
+		}
+		return nil
+	}
+
+	producer, err := cipher.PubKeyFromSig(b.Sig, b.HashHeader())
+	if err != nil {
+		return err
+	}
+	producerAddr := cipher.AddressFromPubKey(producer)
+
+	if vs.Config.FeeRewardPercent > 0 {
+		// the fee share is paid from the header, it must be the fee of the transactions
+		fee, err := b.Body.Transactions.Fees(vs.Blockchain.TransactionFee)
+		if err != nil {
+			return err
+		}
+		if fee != b.Head.Fee {
+			return fmt.Errorf("block fee %d is not the fee %d of its transactions", b.Head.Fee, fee)
+		}
+	}
+
+	if coinbase == nil {
+		if len(vs.coinbaseOutputs(producerAddr, nil, b.Head.Fee)) > 0 {
+			return ErrCoinbaseRewards
+		}
+		return nil
+	}
+
+	prev, err := vs.parentBlock(b.Block)
+	if err != nil {
+		return err
+	}
+
+	signer, err := coinbase.VerifyCoinbase(prev.HashHeader())
+	if err != nil {
+		return err
+	}
+	if signer != producer {
+		return errors.New("coinbase transaction is not signed by the block producer")
+	}
+
+	prevProducer, _ := cipher.PubKeyFromSig(prev.Sig, prev.HashHeader())
+	cosignerAddrs := make(map[cipher.Address]struct{})
+	for _, pk := range vs.validatorsAt(prev.Seq()) {
+		if pk != prevProducer {
+			cosignerAddrs[cipher.AddressFromPubKey(pk)] = struct{}{}
+		}
+	}
+
+	cosigners := make([]cipher.Address, 0, len(coinbase.Out))
+	for _, o := range coinbase.Out[1:] {
+		if _, ok := cosignerAddrs[o.Address]; !ok {
+			return fmt.Errorf("coinbase transaction pays %s, which is no co-signer of block %d", o.Address, prev.Seq())
+		}
+		cosigners = append(cosigners, o.Address)
+	}
+
+	expected := vs.coinbaseOutputs(producerAddr, cosigners, b.Head.Fee)
+	if len(expected) != len(coinbase.Out) {
+		return ErrCoinbaseRewards
+	}
+	for i := range expected {
+		if expected[i] != coinbase.Out[i] {
+			return ErrCoinbaseRewards
+		}
+	}
+	return nil
+}
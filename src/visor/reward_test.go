@@ -0,0 +1,172 @@
+package visor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/testutil"
+)
+
+func TestCoinbaseOutputs(t *testing.T) {
+	producer := testutil.MakeAddress()
+	cosigners := []cipher.Address{testutil.MakeAddress(), testutil.MakeAddress(), testutil.MakeAddress()}
+
+	cases := []struct {
+		name            string
+		reward          uint64
+		feePercent      int
+		cosignerPercent int
+		cosigners       []cipher.Address
+		fee             uint64
+		outs            []coin.TransactionOutput
+	}{
+		{
+			name: "no rewards",
+			fee:  100,
+			outs: []coin.TransactionOutput{},
+		},
+		{
+			name:       "fee share without fee",
+			feePercent: 50,
+			outs:       []coin.TransactionOutput{},
+		},
+		{
+			name:       "producer only",
+			reward:     10e6,
+			feePercent: 50,
+			cosigners:  cosigners,
+			fee:        101,
+			outs: []coin.TransactionOutput{
+				{Address: producer, Coins: 10e6, Hours: 50},
+			},
+		},
+		{
+			name:            "shared with the co-signers",
+			reward:          10e6,
+			feePercent:      50,
+			cosignerPercent: 30,
+			cosigners:       cosigners,
+			fee:             100,
+			outs: []coin.TransactionOutput{
+				{Address: producer, Coins: 7e6, Hours: 35},
+				{Address: cosigners[0], Coins: 1e6, Hours: 5},
+				{Address: cosigners[1], Coins: 1e6, Hours: 5},
+				{Address: cosigners[2], Coins: 1e6, Hours: 5},
+			},
+		},
+		{
+			name:            "co-signer shares too small",
+			reward:          2e3,
+			cosignerPercent: 10,
+			cosigners:       cosigners,
+			outs: []coin.TransactionOutput{
+				{Address: producer, Coins: 2e3},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := &Visor{Config: NewVisorConfig()}
+			v.Config.BlockReward = tc.reward
+			v.Config.FeeRewardPercent = tc.feePercent
+			v.Config.CosignerRewardPercent = tc.cosignerPercent
+			require.Equal(t, tc.outs, v.coinbaseOutputs(producer, tc.cosigners, tc.fee))
+		})
+	}
+}
+
+func TestVerifyCoinbase(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	pk0, sk0 := cipher.GenerateKeyPair()
+	pk1, sk1 := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	pk3, _ := cipher.GenerateKeyPair()
+	pk4, _ := cipher.GenerateKeyPair()
+
+	v := newJailTestVisor(t, db, []cipher.PubKey{pk1, pk2, pk3})
+	v.Config.BlockchainTrustPubkey = pk1
+	v.Config.BlockchainTrustSeckey = sk1
+	v.Config.BlockReward = 10e6
+	v.Config.FeeRewardPercent = 50
+	v.Config.CosignerRewardPercent = 20
+	v.Config.BlockRewardHeight = 1
+
+	genesis := coin.Block{Head: coin.BlockHeader{Time: 100}}
+	prev := coin.SignedBlock{Block: genesis, Sig: cipher.SignHash(genesis.HashHeader(), sk0)}
+	v.Blockchain = &Blockchain{db: db, store: &fakeChainStore{blocks: []coin.SignedBlock{prev}}}
+
+	// pk0 made the head block, pk4 is no validator
+	v.recordCosigners(prev.HashHeader(), []cipher.PubKey{pk0, pk2, pk3, pk4})
+	require.Len(t, v.rewardCosigners(&prev), 2)
+
+	newBlock := func() coin.Block {
+		return coin.Block{
+			Head: coin.BlockHeader{BkSeq: 1, Time: 110, PrevHash: prev.HashHeader()},
+			Body: coin.BlockBody{Transactions: coin.Transactions{}},
+		}
+	}
+	sign := func(b coin.Block, sk cipher.SecKey) coin.SignedBlock {
+		b.Head.BodyHash = b.HashBody()
+		return coin.SignedBlock{Block: b, Sig: cipher.SignHash(b.HashHeader(), sk)}
+	}
+	withCoinbase := func(outs []coin.TransactionOutput, sk cipher.SecKey) coin.SignedBlock {
+		b := newBlock()
+		b.Body.Transactions = append(b.Body.Transactions, coin.NewCoinbaseTransaction(prev.HashHeader(), outs, sk))
+		return sign(b, sk1)
+	}
+
+	// the block made by this node pays the producer and the co-signers
+	b := newBlock()
+	require.NoError(t, v.addCoinbase(&b))
+	require.Len(t, b.Body.Transactions, 1)
+	coinbase := b.Body.Transactions[0]
+	require.Equal(t, coin.TxTypeCoinbase, coinbase.Type)
+	require.Equal(t, []coin.TransactionOutput{
+		{Address: cipher.AddressFromPubKey(pk1), Coins: 8e6},
+		{Address: cipher.AddressFromPubKey(pk2), Coins: 1e6},
+		{Address: cipher.AddressFromPubKey(pk3), Coins: 1e6},
+	}, coinbase.Out)
+	require.Equal(t, b.HashBody(), b.Head.BodyHash)
+	require.NoError(t, v.verifyCoinbase(sign(b, sk1)))
+	require.NoError(t, v.VerifyBlockTransactions(sign(b, sk1)))
+
+	// the producer alone
+	outs := []coin.TransactionOutput{{Address: cipher.AddressFromPubKey(pk1), Coins: 10e6}}
+	require.NoError(t, v.verifyCoinbase(withCoinbase(outs, sk1)))
+
+	// fee not paid by the transactions
+	b = newBlock()
+	b.Head.Fee = 100
+	require.NoError(t, v.addCoinbase(&b))
+	require.Error(t, v.verifyCoinbase(sign(b, sk1)))
+
+	// missing coinbase
+	require.Equal(t, ErrCoinbaseRewards, v.verifyCoinbase(sign(newBlock(), sk1)))
+
+	// wrong rewards
+	outs = []coin.TransactionOutput{{Address: cipher.AddressFromPubKey(pk1), Coins: 11e6}}
+	require.Equal(t, ErrCoinbaseRewards, v.verifyCoinbase(withCoinbase(outs, sk1)))
+
+	// signed by another key than the producer
+	outs = []coin.TransactionOutput{{Address: cipher.AddressFromPubKey(pk1), Coins: 10e6}}
+	require.Error(t, v.verifyCoinbase(withCoinbase(outs, sk0)))
+
+	// pays a co-signer which is no validator
+	outs = []coin.TransactionOutput{
+		{Address: cipher.AddressFromPubKey(pk1), Coins: 9e6},
+		{Address: cipher.AddressFromPubKey(pk4), Coins: 1e6},
+	}
+	require.Error(t, v.verifyCoinbase(withCoinbase(outs, sk1)))
+
+	// no rewards before BlockRewardHeight
+	v.Config.BlockRewardHeight = 2
+	outs = []coin.TransactionOutput{{Address: cipher.AddressFromPubKey(pk1), Coins: 10e6}}
+	require.Equal(t, ErrUnexpectedCoinbase, v.verifyCoinbase(withCoinbase(outs, sk1)))
+	require.NoError(t, v.verifyCoinbase(sign(newBlock(), sk1)))
+}
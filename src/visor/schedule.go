@@ -0,0 +1,101 @@
+package visor
+
+import (
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+)
+
+// epochSeed returns the hash of the last block before the epoch start on the branch of the
+// parent block, it seeds the validator shuffle of the epoch. Epochs that start before the
+// genesis block are not seeded. The pending blocks of the branch are walked back to the chain,
+// the seed is only cached once a block of the epoch follows it in the chain.
+func (vs *Visor) epochSeed(parent cipher.SHA256, epoch int64) (cipher.SHA256, bool) {
+	start := uint64(dpos.EpochStart(epoch))
+
+	genesis := vs.Blockchain.GetGenesisBlock()
+	if genesis == nil || genesis.Time() >= start {
+		return cipher.SHA256{}, false
+	}
+
+	hash := parent
+	for {
+		b, err := vs.Blockchain.GetBlockByHash(hash)
+		if err != nil {
+			logger.Errorf("epochSeed: get block %s failed: %v", hash.Hex(), err)
+			return cipher.SHA256{}, false
+		}
+		if b != nil {
+			return vs.chainEpochSeed(epoch, start, *b)
+		}
+
+		if vs.pbft == nil {
+			logger.Errorf("epochSeed: block %s not found", hash.Hex())
+			return cipher.SHA256{}, false
+		}
+		pb, err := vs.pbft.GetSignedBlock(hash)
+		if err != nil {
+			logger.Errorf("epochSeed: get pending block %s failed: %v", hash.Hex(), err)
+			return cipher.SHA256{}, false
+		}
+		if pb.Time() < start {
+			return pb.HashHeader(), true
+		}
+		hash = pb.Block.Head.PrevHash
+	}
+}
+
+// chainEpochSeed returns the seed of the epoch starting at start on the chain up to the block b
+func (vs *Visor) chainEpochSeed(epoch int64, start uint64, b coin.SignedBlock) (cipher.SHA256, bool) {
+	if b.Time() < start {
+		// b is the last block before the epoch on the branch, the chain may follow it into the epoch
+		next, err := vs.Blockchain.GetBlockBySeq(b.Seq() + 1)
+		if err == nil && next != nil && next.Time() >= start {
+			vs.cacheEpochSeed(epoch, b.HashHeader())
+		}
+		return b.HashHeader(), true
+	}
+
+	vs.seedsMutex.Lock()
+	seed, ok := vs.epochSeeds[epoch]
+	vs.seedsMutex.Unlock()
+	if ok {
+		return seed, true
+	}
+
+	// binary search the last block before the epoch start, block time grows with the seq
+	genesis := vs.Blockchain.GetGenesisBlock()
+	lo, hi := genesis.Seq(), b.Seq()
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+		mb, err := vs.Blockchain.GetBlockBySeq(mid)
+		if err != nil || mb == nil {
+			logger.Errorf("epochSeed: get block %d failed: %v", mid, err)
+			return cipher.SHA256{}, false
+		}
+		if mb.Time() < start {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	sb, err := vs.Blockchain.GetBlockBySeq(lo)
+	if err != nil || sb == nil {
+		logger.Errorf("epochSeed: get block %d failed: %v", lo, err)
+		return cipher.SHA256{}, false
+	}
+	seed = sb.HashHeader()
+	vs.cacheEpochSeed(epoch, seed)
+
+	return seed, true
+}
+
+func (vs *Visor) cacheEpochSeed(epoch int64, seed cipher.SHA256) {
+	vs.seedsMutex.Lock()
+	defer vs.seedsMutex.Unlock()
+	if vs.epochSeeds == nil {
+		vs.epochSeeds = make(map[int64]cipher.SHA256)
+	}
+	vs.epochSeeds[epoch] = seed
+}
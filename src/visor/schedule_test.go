@@ -0,0 +1,107 @@
+package visor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/pbft"
+)
+
+func makeBlocksAt(t *testing.T, times []uint64) []coin.SignedBlock {
+	preBlock, err := coin.NewGenesisBlock(genAddress, genCoins, genTime)
+	require.NoError(t, err)
+	bs := []coin.SignedBlock{{Block: *preBlock}}
+	for _, tm := range times {
+		b := makeBlock(t, *preBlock, tm)
+		bs = append(bs, coin.SignedBlock{Block: *b})
+		preBlock = b
+	}
+	return bs
+}
+
+// hashChainStore finds the blocks of the chain by hash
+type hashChainStore struct {
+	fakeChainStore
+}
+
+func (hcs hashChainStore) GetBlockByHash(hash cipher.SHA256) (*coin.SignedBlock, error) {
+	for i := range hcs.blocks {
+		if hcs.blocks[i].HashHeader() == hash {
+			return &hcs.blocks[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func TestEpochSeed(t *testing.T) {
+	// genesis is in epoch 0, epoch 1 starts at 86400
+	bs := makeBlocksAt(t, []uint64{
+		86380,
+		86390,
+		86410,
+		86420,
+		86400*3 + 10,
+	})
+
+	v := &Visor{
+		Blockchain: &Blockchain{
+			store: hashChainStore{fakeChainStore{blocks: bs}},
+		},
+		pbft: pbft.NewPBFT(),
+	}
+	head := bs[5].HashHeader()
+
+	// the genesis epoch has no previous block
+	_, ok := v.epochSeed(head, 0)
+	require.False(t, ok)
+
+	seed, ok := v.epochSeed(head, 1)
+	require.True(t, ok)
+	require.Equal(t, bs[2].HashHeader(), seed)
+
+	// epoch 2 had no blocks, epoch 3 is seeded from the last block of epoch 1
+	seed, ok = v.epochSeed(head, 2)
+	require.True(t, ok)
+	require.Equal(t, bs[4].HashHeader(), seed)
+	seed, ok = v.epochSeed(head, 3)
+	require.True(t, ok)
+	require.Equal(t, bs[4].HashHeader(), seed)
+
+	// the parent is still in the previous epoch
+	seed, ok = v.epochSeed(head, 4)
+	require.True(t, ok)
+	require.Equal(t, bs[5].HashHeader(), seed)
+	require.NotContains(t, v.epochSeeds, int64(4))
+	require.Contains(t, v.epochSeeds, int64(1))
+
+	// a block extending an older block of the chain is seeded from its own branch
+	seed, ok = v.epochSeed(bs[1].HashHeader(), 1)
+	require.True(t, ok)
+	require.Equal(t, bs[1].HashHeader(), seed)
+
+	// the pending blocks of the branch are walked back to the chain
+	p1 := makeBlock(t, bs[5].Block, 86400*4-10)
+	p2 := makeBlock(t, *p1, 86400*4+10)
+	v.pbft.PendingBlocks[p1.HashHeader()] = coin.SignedBlock{Block: *p1}
+	v.pbft.PendingBlocks[p2.HashHeader()] = coin.SignedBlock{Block: *p2}
+	seed, ok = v.epochSeed(p2.HashHeader(), 4)
+	require.True(t, ok)
+	require.Equal(t, p1.HashHeader(), seed)
+	seed, ok = v.epochSeed(p2.HashHeader(), 3)
+	require.True(t, ok)
+	require.Equal(t, bs[4].HashHeader(), seed)
+	require.NotContains(t, v.epochSeeds, int64(4))
+
+	// an unknown parent is not seeded
+	_, ok = v.epochSeed(cipher.SHA256{1}, 4)
+	require.False(t, ok)
+
+	// cached seeds are used
+	v.epochSeeds[1] = cipher.SHA256{1}
+	seed, ok = v.epochSeed(head, 1)
+	require.True(t, ok)
+	require.Equal(t, cipher.SHA256{1}, seed)
+}
@@ -0,0 +1,64 @@
+package visor
+
+import (
+	"fmt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/signer"
+)
+
+// newSigner connects to the remote signer of the configuration, or signs with the keys
+// of the configuration and the sign state in Config.SignStatePath
+func newSigner(c Config, vs *Visor) (signer.Signer, error) {
+	if c.RemoteSigner == "" {
+		var guard *signer.Guard
+		if c.SignStatePath != "" {
+			var err error
+			if guard, err = signer.LoadGuard(c.SignStatePath); err != nil {
+				return nil, err
+			}
+		}
+		return signer.NewLocal(vs.TrustSeckey, c.BlockchainSeckey, guard), nil
+	}
+
+	client, err := signer.Dial(c.RemoteSigner, c.RemoteSignerAuthKey)
+	if err != nil {
+		return nil, fmt.Errorf("connect to signer %s failed: %v", c.RemoteSigner, err)
+	}
+	if c.IsMaster && client.PubKey() != c.BlockchainTrustPubkey {
+		client.Close()
+		return nil, fmt.Errorf("signer key %s is not the trust key %s", client.PubKey().Hex(), c.BlockchainTrustPubkey.Hex())
+	}
+	return client, nil
+}
+
+// SignTrustList signs the trust list with the master key of the genesis node
+func (vs *Visor) SignTrustList(trust []cipher.PubKey) (cipher.Sig, error) {
+	return vs.signer.Sign(signer.TrustListRequest(trust))
+}
+
+// SignAgreeNum signs the agree number with the master key of the genesis node
+func (vs *Visor) SignAgreeNum(num int) (cipher.Sig, error) {
+	return vs.signer.Sign(signer.AgreeNumRequest(num))
+}
+
+// SignIdentity proves the trust key to the peer of the session of an encrypted connection
+func (vs *Visor) SignIdentity(session cipher.SHA256) (cipher.PubKey, cipher.Sig, error) {
+	sig, err := vs.signer.Sign(signer.IdentityRequest(session))
+	if err != nil {
+		return cipher.PubKey{}, cipher.Sig{}, err
+	}
+	return vs.signer.PubKey(), sig, nil
+}
+
+// PrepareSig returns the prepare vote of this node for the pending block, ok is false if it did not vote
+func (vs *Visor) PrepareSig(hash cipher.SHA256) (sig cipher.Sig, ok bool) {
+	pubkey := vs.TrustPubkey()
+	for _, sig := range vs.pbft.GetPrepareSigs(hash) {
+		if pk, err := cipher.PubKeyFromSig(sig, pbft.PrepareHash(hash)); err == nil && pk == pubkey {
+			return sig, true
+		}
+	}
+	return cipher.Sig{}, false
+}
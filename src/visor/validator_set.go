@@ -0,0 +1,264 @@
+package visor
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/consensus/dpos"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+// validatorSet returns the validator set version active at the block height,
+// ok is false if no version is stored for the height
+func (vs *Visor) validatorSet(height uint64) (blockdb.ValidatorSet, bool) {
+	if vs.trustNode == nil {
+		return blockdb.ValidatorSet{}, false
+	}
+	set, ok, err := vs.trustNode.GetValidatorSet(height)
+	if err != nil {
+		logger.Errorf("Get validator set of height %d failed: %v", height, err)
+		return blockdb.ValidatorSet{}, false
+	}
+	return set, ok
+}
+
+// validatorSetAt returns the validators active at the block height,
+// ok is false if no version is stored for the height
+func (vs *Visor) validatorSetAt(height uint64) ([]cipher.PubKey, bool) {
+	set, ok := vs.validatorSet(height)
+	if !ok {
+		return nil, false
+	}
+	return set.Pubkeys, true
+}
+
+// addValidatorSet records the validators and the quorum active from the height on
+func (vs *Visor) addValidatorSet(height, epoch uint64, pubkeys []cipher.PubKey, quorum uint64) error {
+	return vs.db.Update(func(tx *bolt.Tx) error {
+		return vs.addValidatorSetWithTx(tx, height, epoch, pubkeys, quorum)
+	})
+}
+
+// addValidatorSetWithTx records the validators and the quorum active from the height on with
+// *bolt.Tx, nothing is recorded if they equal the version already active at the height
+func (vs *Visor) addValidatorSetWithTx(tx *bolt.Tx, height, epoch uint64, pubkeys []cipher.PubKey, quorum uint64) error {
+	current, ok, err := vs.trustNode.GetValidatorSetWithTx(tx, height)
+	if err != nil {
+		return err
+	}
+	if ok && equalPubkeys(current.Pubkeys, pubkeys) && current.Quorum == quorum {
+		return nil
+	}
+
+	logger.Infof("Validator set of %d validators active from height %d, epoch %d", len(pubkeys), height, epoch)
+	return vs.trustNode.AddValidatorSetWithTx(tx, blockdb.ValidatorSet{
+		Height:  height,
+		Epoch:   epoch,
+		Pubkeys: pubkeys,
+		Quorum:  quorum,
+	})
+}
+
+// initValidatorSets records the trust list of the chain parameters as the validator set of
+// the genesis block if no version is stored yet. The later versions are only recorded by the
+// blocks starting an epoch, so every node derives the same history from the chain.
+func (vs *Visor) initValidatorSets() error {
+	if vs.trustNode == nil || len(vs.Config.TrustPubkeyList) == 0 {
+		return nil
+	}
+
+	sets, err := vs.trustNode.GetValidatorSets()
+	if err != nil {
+		return err
+	}
+	if len(sets) != 0 {
+		return nil
+	}
+
+	genesisTime := vs.Config.GenesisTimestamp
+	if gb := vs.Blockchain.GetGenesisBlock(); gb != nil {
+		genesisTime = gb.Time()
+	}
+	epoch := uint64(dpos.Epoch(int64(genesisTime)))
+	return vs.addValidatorSet(0, epoch, vs.Config.TrustPubkeyList, 0)
+}
+
+// trustList returns the configured validators with the rotated keys replaced by their current keys
+func (vs *Visor) trustList() []cipher.PubKey {
+	return vs.rotatePubkeys(vs.configuredValidators())
+}
+
+// trustListWithTx returns the validators recorded in the chain with *bolt.Tx, the validator set in
+// effect by governance or the one of the genesis block, with the rotated keys replaced by their
+// current keys. Unlike trustList the configured trust list of this node is not used, the blocks
+// are only verified against the chain.
+func (vs *Visor) trustListWithTx(tx *bolt.Tx) ([]cipher.PubKey, error) {
+	validators, ok, err := vs.governedValidatorsWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		validators, err = vs.validatorsAtWithTx(tx, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rotations, err := vs.keyRotationsWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	return rotateAllWith(rotations, validators), nil
+}
+
+// configuredValidators returns the validator set in effect by governance, the validator set
+// of the genesis block without it
+func (vs *Visor) configuredValidators() []cipher.PubKey {
+	if validators, ok := vs.governedValidators(); ok {
+		return validators
+	}
+	if validators, ok := vs.validatorSetAt(0); ok {
+		return validators
+	}
+	return vs.Config.TrustPubkeyList
+}
+
+// configuredValidatorsWithTx is configuredValidators with *bolt.Tx
+func (vs *Visor) configuredValidatorsWithTx(tx *bolt.Tx) ([]cipher.PubKey, error) {
+	validators, ok, err := vs.governedValidatorsWithTx(tx)
+	if err != nil || ok {
+		return validators, err
+	}
+	if vs.trustNode != nil {
+		set, ok, err := vs.trustNode.GetValidatorSetWithTx(tx, 0)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return set.Pubkeys, nil
+		}
+	}
+	return vs.Config.TrustPubkeyList, nil
+}
+
+// baseValidatorsWithTx returns the validators of the epoch before jailed validators are removed,
+// the last elected validators with vote election, the trust list without it
+func (vs *Visor) baseValidatorsWithTx(tx *bolt.Tx) ([]cipher.PubKey, error) {
+	rotations, err := vs.keyRotationsWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	if vs.Config.VoteElection && vs.votes != nil {
+		_, validators, ok, err := vs.votes.GetElectedWithTx(tx)
+		if err != nil {
+			return nil, err
+		}
+		if ok && len(validators) > 0 {
+			return rotateAllWith(rotations, validators), nil
+		}
+	}
+	validators, err := vs.configuredValidatorsWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	return rotateAllWith(rotations, validators), nil
+}
+
+// startEpochWithTx updates the validators in the transaction of the block when the block is
+// the first one of an epoch: the pending governance changes and key rotations take effect,
+// they are elected if vote election is on, the jail is updated, and the validators not in
+// jail are active from the next block on. changed is false if the validators are unchanged.
+func (vs *Visor) startEpochWithTx(tx *bolt.Tx, b coin.Block) (active []cipher.PubKey, changed bool, err error) {
+	epoch := uint64(dpos.Epoch(int64(b.Time())))
+
+	governed, err := vs.updateGovernanceWithTx(tx, epoch)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rotated, err := vs.updateKeyRotationsWithTx(tx, epoch)
+	if err != nil {
+		return nil, false, err
+	}
+
+	validators, elected, err := vs.maybeElectValidatorsWithTx(tx, b)
+	if err != nil {
+		return nil, false, err
+	}
+
+	jailChanged, err := vs.updateJailWithTx(tx, epoch)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !governed && !rotated && !elected && !jailChanged {
+		return nil, false, nil
+	}
+
+	if !elected {
+		validators, err = vs.baseValidatorsWithTx(tx)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	active, err = vs.activeValidatorsWithTx(tx, validators)
+	if err != nil {
+		return nil, false, err
+	}
+
+	quorum, err := vs.governedQuorumWithTx(tx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := vs.addValidatorSetWithTx(tx, b.Seq()+1, epoch, active, quorum); err != nil {
+		return nil, false, err
+	}
+	return active, true, nil
+}
+
+// applyEpoch hands the validators and the signing key in effect to the consensus
+// once the block starting the epoch is committed
+func (vs *Visor) applyEpoch(active []cipher.PubKey) error {
+	vs.dpos.SetSigner(vs.TrustPubkey())
+	return vs.dpos.SetTrustNode(active)
+}
+
+// GetValidatorSets returns all validator set versions ordered by activation height
+func (vs *Visor) GetValidatorSets() ([]blockdb.ValidatorSet, error) {
+	return vs.trustNode.GetValidatorSets()
+}
+
+// equalPubkeys returns true if both lists have the same pubkeys in the same order,
+// the order decides the block producer schedule
+func equalPubkeys(a, b []cipher.PubKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// blockValidators returns the validators which sign the blocks of the height, the trust list
+// of the chain parameters if no validator set is recorded yet
+func (vs *Visor) blockValidators(height uint64) []cipher.PubKey {
+	if pubkeys, ok := vs.validatorSetAt(height); ok {
+		return pubkeys
+	}
+	return vs.Config.TrustPubkeyList
+}
+
+// VerifyHeader verifies the header is signed by a validator of its height. The validator sets
+// elected in the blocks after the head are not known yet, the last set known is used for them.
+func (vs *Visor) VerifyHeader(h coin.BlockHeader, sig cipher.Sig) error {
+	b := coin.SignedBlock{
+		Block: coin.Block{Head: h},
+		Sig:   sig,
+	}
+	return b.VerifySignature(vs.blockValidators(h.BkSeq))
+}
@@ -0,0 +1,149 @@
+package visor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/samoslab/samos/src/cipher"
+	"github.com/samoslab/samos/src/testutil"
+	"github.com/samoslab/samos/src/visor/blockdb"
+)
+
+type fakeValidatorSets []blockdb.ValidatorSet
+
+func (f fakeValidatorSets) GetValidatorSet(height uint64) (blockdb.ValidatorSet, bool, error) {
+	var set blockdb.ValidatorSet
+	ok := false
+	for _, s := range f {
+		if s.Height <= height {
+			set = s
+			ok = true
+		}
+	}
+	return set, ok, nil
+}
+
+func TestVerifyBlockSigValidatorSets(t *testing.T) {
+	pkA, skA := cipher.GenerateKeyPair()
+	pkB, skB := cipher.GenerateKeyPair()
+
+	bs := makeBlocks(t, 4)
+	for i := range bs {
+		sk := skA
+		if i >= 2 {
+			sk = skB
+		}
+		bs[i].Sig = cipher.SignHash(bs[i].HashHeader(), sk)
+	}
+
+	bc := &Blockchain{
+		pubkey: []cipher.PubKey{pkB},
+		store:  &fakeChainStore{blocks: bs},
+	}
+
+	// without versions every block is checked against the current list
+	require.Error(t, bc.verifyBlockSig(0))
+	require.NoError(t, bc.verifyBlockSig(2))
+
+	bc.sets = fakeValidatorSets{
+		{Height: 0, Pubkeys: []cipher.PubKey{pkA}},
+		{Height: 2, Epoch: 1, Pubkeys: []cipher.PubKey{pkB}},
+	}
+	for i := range bs {
+		require.NoError(t, bc.verifyBlockSig(uint64(i)))
+	}
+
+	// a removed validator can not sign blocks after its removal
+	bs[3].Sig = cipher.SignHash(bs[3].HashHeader(), skA)
+	require.Error(t, bc.verifyBlockSig(3))
+}
+
+func TestInitValidatorSets(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	pk3, _ := cipher.GenerateKeyPair()
+
+	tn, err := blockdb.NewTrustNode(db)
+	require.NoError(t, err)
+
+	bs := makeBlocks(t, 3)
+	cfg := NewVisorConfig()
+	cfg.TrustPubkeyList = []cipher.PubKey{pk1, pk2}
+	v := &Visor{
+		Config: cfg,
+		db:     db,
+		Blockchain: &Blockchain{
+			store: &fakeChainStore{blocks: bs},
+		},
+		trustNode: tn,
+	}
+
+	_, ok := v.validatorSetAt(0)
+	require.False(t, ok)
+
+	require.NoError(t, v.initValidatorSets())
+	pks, ok := v.validatorSetAt(0)
+	require.True(t, ok)
+	require.Equal(t, cfg.TrustPubkeyList, pks)
+
+	// restarting with the same list records nothing new
+	require.NoError(t, v.initValidatorSets())
+	sets, err := v.GetValidatorSets()
+	require.NoError(t, err)
+	require.Len(t, sets, 1)
+
+	// a node configured with another trust list keeps the history recorded by the chain
+	v.Config.TrustPubkeyList = []cipher.PubKey{pk2, pk3}
+	require.NoError(t, v.initValidatorSets())
+	pks, ok = v.validatorSetAt(3)
+	require.True(t, ok)
+	require.Equal(t, []cipher.PubKey{pk1, pk2}, pks)
+
+	sets, err = v.GetValidatorSets()
+	require.NoError(t, err)
+	require.Len(t, sets, 1)
+}
+
+func TestVerifyHeader(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	pkA, skA := cipher.GenerateKeyPair()
+	pkB, skB := cipher.GenerateKeyPair()
+
+	tn, err := blockdb.NewTrustNode(db)
+	require.NoError(t, err)
+
+	bs := makeBlocks(t, 4)
+	cfg := NewVisorConfig()
+	cfg.TrustPubkeyList = []cipher.PubKey{pkA}
+	v := &Visor{
+		Config: cfg,
+		db:     db,
+		Blockchain: &Blockchain{
+			store: &fakeChainStore{blocks: bs},
+		},
+		trustNode: tn,
+	}
+
+	// without validator sets the headers are checked against the trust list
+	h := bs[3].Head
+	require.NoError(t, v.VerifyHeader(h, cipher.SignHash(h.Hash(), skA)))
+	require.Error(t, v.VerifyHeader(h, cipher.SignHash(h.Hash(), skB)))
+
+	// the headers after the head are checked against the last set known
+	require.NoError(t, v.initValidatorSets())
+	require.NoError(t, v.addValidatorSet(4, 1, []cipher.PubKey{pkB}, 0))
+	h.BkSeq = 10
+	require.Error(t, v.VerifyHeader(h, cipher.SignHash(h.Hash(), skA)))
+	require.NoError(t, v.VerifyHeader(h, cipher.SignHash(h.Hash(), skB)))
+
+	// a header signed by a validator of a later set is refused
+	h = bs[3].Head
+	require.NoError(t, v.VerifyHeader(h, cipher.SignHash(h.Hash(), skA)))
+	require.Error(t, v.VerifyHeader(h, cipher.SignHash(h.Hash(), skB)))
+}
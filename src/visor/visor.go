@@ -4,7 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
-
+	"sync"
 	"time"
 
 	"github.com/boltdb/bolt"
@@ -13,8 +13,8 @@ import (
 
 	"github.com/samoslab/samos/src/cipher"
 	"github.com/samoslab/samos/src/coin"
+	"github.com/samoslab/samos/src/signer"
 	"github.com/samoslab/samos/src/util/droplet"
-	"github.com/samoslab/samos/src/util/utc"
 	"github.com/samoslab/samos/src/visor/blockdb"
 	"github.com/samoslab/samos/src/visor/historydb"
 	"github.com/samoslab/samos/src/wallet"
@@ -87,6 +87,9 @@ type Config struct {
 	// Is this the master blockchain
 	IsMaster bool
 
+	// Consensus engine of the chain, one of ConsensusDposPbft, ConsensusSingleMaster and ConsensusBlockStat
+	ConsensusEngine string
+
 	//Public key of blockchain authority
 	BlockchainPubkey cipher.PubKey
 
@@ -99,8 +102,15 @@ type Config struct {
 	//Secret key of blockchain authority (if master)
 	BlockchainTrustSeckey cipher.SecKey
 
+	//Secret key the trust node signs with once a key rotation replaced BlockchainTrustSeckey
+	BlockchainTrustNextSeckey cipher.SecKey
+
 	// How often new blocks are created by the master, in seconds
 	BlockCreationInterval uint64
+	// Create empty heartbeat blocks in the slots of this node while no transactions are pending
+	EmptyBlocks bool
+	// Minimum seconds from the head block to an empty block, 0 creates one in every slot
+	EmptyBlockInterval uint64
 	// How often broadcast message by the genesis master, in seconds
 	BroadcastInterval uint64
 	// How often an unconfirmed txn is checked against the blockchain
@@ -127,14 +137,46 @@ type Config struct {
 	TrustPubkeyList []cipher.PubKey
 	AgreeNum        int
 
+	// Elect the validators by stake weighted vote transactions at every epoch boundary
+	VoteElection bool
+	// Number of validators elected, 0 means the size of TrustPubkeyList
+	ElectedValidatorNum int
+	// Jail the validators which missed at least this percent of their slots in an epoch,
+	// 0 disables it. A slot without a block counts as missed, even if there was nothing to pack.
+	JailMissedPercent int
+	// Number of validator signatures a validator set or quorum transaction needs,
+	// 0 means more than two thirds of the validators
+	GovernanceThreshold int
+
 	// Genesis block sig
 	GenesisSignature cipher.Sig
 	// Genesis block timestamp
 	GenesisTimestamp uint64
 	// Number of coins in genesis block
 	GenesisCoinVolume uint64
+	// Droplets issued to the producer of every block from BlockRewardHeight on
+	BlockReward uint64
+	// Percent of the coin hours burned as fee of a block credited to its producer
+	FeeRewardPercent int
+	// Percent of the block reward shared equally by the validators which co-signed the previous block
+	CosignerRewardPercent int
+	// Height of the first block with a reward, blocks before it have no coinbase transaction
+	BlockRewardHeight uint64
+	// Height of the first block which must have a quorum certificate, 0 does not require them
+	QuorumCertHeight uint64
+	// Number of blocks which may be pending at once, the block after a pending block
+	// is proposed while it collects votes if it is more than 1
+	PendingBlockWindow int
 	// bolt db file path
 	DBPath string
+	// File of the last block this node signed, a block conflicting with it is not signed.
+	// Empty disables the check. A remote signer keeps its own file.
+	SignStatePath string
+	// Address of the signer process holding the keys, unix:/path or host:port.
+	// Empty signs with the keys of the configuration.
+	RemoteSigner string
+	// Key shared with the remote signer to authenticate the connection
+	RemoteSignerAuthKey []byte
 	// open bolt db read-only
 	DBReadOnly bool
 	// enable arbitrating mode
@@ -158,6 +200,8 @@ func NewVisorConfig() Config {
 	c := Config{
 		IsMaster: false,
 
+		ConsensusEngine: ConsensusDposPbft,
+
 		BlockchainPubkey: cipher.PubKey{},
 		BlockchainSeckey: cipher.SecKey{},
 
@@ -176,6 +220,8 @@ func NewVisorConfig() Config {
 		GenesisSignature:  cipher.Sig{},
 		GenesisTimestamp:  0,
 		GenesisCoinVolume: 0, //100e12, 100e6 * 10e6
+
+		PendingBlockWindow: 1,
 	}
 
 	return c
@@ -183,12 +229,42 @@ func NewVisorConfig() Config {
 
 // Verify verifies the configuration
 func (c Config) Verify() error {
-	if c.IsMaster {
+	if c.IsMaster && c.RemoteSigner == "" {
 		if c.BlockchainTrustPubkey != cipher.PubKeyFromSecKey(c.BlockchainTrustSeckey) {
 			return errors.New("Cannot run in master: invalid seckey for pubkey")
 		}
 	}
 
+	switch c.ConsensusEngine {
+	case ConsensusDposPbft, ConsensusSingleMaster, ConsensusBlockStat:
+	default:
+		return fmt.Errorf("unknown consensus engine %q", c.ConsensusEngine)
+	}
+
+	if c.JailMissedPercent < 0 || c.JailMissedPercent > 100 {
+		return errors.New("JailMissedPercent must be between 0 and 100")
+	}
+
+	if c.GovernanceThreshold < 0 {
+		return errors.New("GovernanceThreshold must not be negative")
+	}
+
+	if c.FeeRewardPercent < 0 || c.FeeRewardPercent > 100 {
+		return errors.New("FeeRewardPercent must be between 0 and 100")
+	}
+
+	if c.CosignerRewardPercent < 0 || c.CosignerRewardPercent > 100 {
+		return errors.New("CosignerRewardPercent must be between 0 and 100")
+	}
+
+	if err := DropletPrecisionCheck(c.BlockReward); err != nil {
+		return fmt.Errorf("BlockReward: %v", err)
+	}
+
+	if c.PendingBlockWindow < 1 {
+		return errors.New("PendingBlockWindow must be at least 1")
+	}
+
 	return nil
 }
 
@@ -217,6 +293,7 @@ type Blockchainer interface {
 	HeadSeq() uint64
 	Time() uint64
 	NewBlock(txns coin.Transactions, currentTime uint64) (*coin.Block, error)
+	NewEmptyBlock(currentTime uint64) (*coin.Block, error)
 	ExecuteBlockWithTx(tx *bolt.Tx, sb *coin.SignedBlock) error
 	VerifyBlockTxnConstraints(tx coin.Transaction) error
 	VerifySingleTxnHardConstraints(tx coin.Transaction) error
@@ -225,6 +302,7 @@ type Blockchainer interface {
 	Notify(b coin.Block)
 	BindListener(bl BlockListener)
 	UpdateDB(f func(tx *bolt.Tx) error) error
+	SyncCache() error
 }
 
 // UnconfirmedTxnPooler is the interface that provides methods for
@@ -260,12 +338,34 @@ type Visor struct {
 	Wallets     *wallet.Service
 	StartedAt   time.Time
 
-	history   historyer
-	bcParser  *BlockchainParser
-	db        *bolt.DB
-	dpos      *dpos.Dpos
-	pbft      *pbft.PBFT
-	trustNode *blockdb.TrustNode
+	history    historyer
+	bcParser   *BlockchainParser
+	db         *bolt.DB
+	engine     ConsensusEngine
+	dpos       *dpos.Dpos
+	pbft       *pbft.PBFT
+	trustNode  *blockdb.TrustNode
+	votes      *blockdb.Votes
+	liveness   *blockdb.Liveness
+	evidences  *blockdb.Evidences
+	jails       *blockdb.Jails
+	governance  *blockdb.Governance
+	keyRotation *blockdb.KeyRotations
+	quorumCerts *blockdb.QuorumCerts
+	signer      signer.Signer
+
+	// pending block headers recently signed by the validators, see DetectEquivocation
+	recentHeaders map[cipher.PubKey][]blockdb.SignedHeader
+	headersMutex  sync.Mutex
+
+	// validator shuffle seed of the epochs, see epochSeed
+	epochSeeds map[int64]cipher.SHA256
+	seedsMutex sync.Mutex
+
+	// validators which prepared the last executed block, see rewardCosigners
+	cosigners      []cipher.PubKey
+	cosignersHash  cipher.SHA256
+	cosignersMutex sync.Mutex
 }
 
 // NewVisor creates a Visor for managing the blockchain database
@@ -309,8 +409,43 @@ func NewVisor(c Config, db *bolt.DB) (*Visor, error) {
 	if err != nil {
 		return nil, err
 	}
+	votes, err := blockdb.NewVotes(db)
+	if err != nil {
+		return nil, err
+	}
+	liveness, err := blockdb.NewLiveness(db)
+	if err != nil {
+		return nil, err
+	}
+	evidences, err := blockdb.NewEvidences(db)
+	if err != nil {
+		return nil, err
+	}
+	jails, err := blockdb.NewJails(db)
+	if err != nil {
+		return nil, err
+	}
+	governance, err := blockdb.NewGovernance(db)
+	if err != nil {
+		return nil, err
+	}
+	keyRotation, err := blockdb.NewKeyRotations(db)
+	if err != nil {
+		return nil, err
+	}
+	quorumCerts, err := blockdb.NewQuorumCerts(db)
+	if err != nil {
+		return nil, err
+	}
 	dpos := dpos.NewDpos(c.BlockchainTrustPubkey)
 	dpos.SetTrustNode(c.TrustPubkeyList)
+	if c.VoteElection {
+		if _, validators, ok, err := votes.GetElected(); err != nil {
+			return nil, err
+		} else if ok && len(validators) > 0 {
+			dpos.SetTrustNode(validators)
+		}
+	}
 	v := &Visor{
 		Config:      c,
 		db:          db,
@@ -323,13 +458,47 @@ func NewVisor(c Config, db *bolt.DB) (*Visor, error) {
 		dpos:        dpos,
 		pbft:        pbft.NewPBFT(),
 		trustNode:   tn,
+		votes:       votes,
+		liveness:    liveness,
+		evidences:   evidences,
+		jails:       jails,
+		governance:  governance,
+		keyRotation: keyRotation,
+		quorumCerts: quorumCerts,
+	}
+	v.pbft.SetWindow(c.PendingBlockWindow)
+	if v.signer, err = newSigner(c, v); err != nil {
+		return nil, err
+	}
+	if v.engine, err = newConsensusEngine(c.ConsensusEngine, v); err != nil {
+		return nil, err
 	}
+	dpos.SetSigner(v.TrustPubkey())
+	dpos.SetEpochSeed(v.epochSeed)
+	dpos.SetValidatorSetSource(v.validatorSetAt)
 
 	return v, nil
 }
 
 // Run starts the visor
 func (vs *Visor) Run() error {
+	if err := vs.Init(); err != nil {
+		return err
+	}
+	return vs.ParseBlocks()
+}
+
+// Init loads the validator sets, creates the genesis block if necessary and stores the
+// trust nodes of the genesis node. Run calls it before parsing the blocks.
+func (vs *Visor) Init() error {
+	if err := vs.initConsensusEngine(); err != nil {
+		return err
+	}
+
+	if err := vs.initValidatorSets(); err != nil {
+		return err
+	}
+
 	if err := vs.maybeCreateGenesisBlock(); err != nil {
 		return err
 	}
@@ -342,27 +511,46 @@ func (vs *Visor) Run() error {
 
 	if vs.IsGenesisNode() {
 		// todo need check pubkey equal or not
-		if err := vs.InsertTrustPubkeyList(vs.Config.TrustPubkeyList); err != nil {
-			return err
+		if !vs.IsGoverned(coin.TxTypeValidatorSet) {
+			if err := vs.InsertTrustPubkeyList(vs.Config.TrustPubkeyList); err != nil {
+				return err
+			}
 		}
 		agreeNum := len(vs.Config.TrustPubkeyList)
 		if vs.Config.AgreeNum > 0 && vs.Config.AgreeNum <= len(vs.Config.TrustPubkeyList) {
 			agreeNum = vs.Config.AgreeNum
 		}
-		if err := vs.InsertAgreeNodeNum(agreeNum); err != nil {
-			return err
+		if !vs.IsGoverned(coin.TxTypeQuorum) {
+			if err := vs.InsertAgreeNodeNum(agreeNum); err != nil {
+				return err
+			}
 		}
 	}
 
+	return nil
+}
+
+// ParseBlocks feeds the executed blocks to the history db until the visor is shut down
+func (vs *Visor) ParseBlocks() error {
 	return vs.bcParser.Run()
 }
 
+// SetClock sets the function returning the unix time blocks are created and pending blocks
+// time out by, utc.UnixNow unless a simulation runs on a virtual clock
+func (vs *Visor) SetClock(now func() int64) {
+	vs.pbft.SetClock(now)
+}
+
 // Shutdown shuts down the visor
 func (vs *Visor) Shutdown() {
 	defer logger.Info("DB and BlockchainParser closed")
 
 	vs.bcParser.Shutdown()
 
+	if c, ok := vs.signer.(*signer.Client); ok {
+		c.Close()
+	}
+
 	if err := vs.db.Close(); err != nil {
 		logger.Errorf("db.Close() error: %v", err)
 	}
@@ -384,7 +572,10 @@ func (vs *Visor) maybeCreateGenesisBlock() error {
 	var sb coin.SignedBlock
 	// record the signature of genesis block
 	if vs.Config.IsMaster {
-		sb1 := vs.SignBlock(*b)
+		sb1, err := vs.SignBlock(*b)
+		if err != nil {
+			return err
+		}
 		sb = sb1.ToSignedBlock()
 		logger.Infof("Genesis block signature=%s", sb.Sig.Hex())
 	} else {
@@ -394,7 +585,7 @@ func (vs *Visor) maybeCreateGenesisBlock() error {
 		}
 	}
 
-	return vs.ExecuteSignedBlock(sb)
+	return vs.ExecuteSignedBlock(sb, nil)
 }
 
 // GenesisPreconditions panics if conditions for genesis block are not met
@@ -408,12 +599,8 @@ func (vs *Visor) GenesisPreconditions() {
 
 // IsGenesisNode genesis node return true
 func (vs *Visor) IsGenesisNode() bool {
-	if vs.Config.BlockchainSeckey != (cipher.SecKey{}) {
-		if vs.Config.BlockchainPubkey == cipher.PubKeyFromSecKey(vs.Config.BlockchainSeckey) {
-			return true
-		}
-	}
-	return false
+	master, ok := vs.signer.MasterPubKey()
+	return ok && master == vs.Config.BlockchainPubkey
 }
 
 // RefreshUnconfirmed checks unconfirmed txns against the blockchain and returns
@@ -429,13 +616,22 @@ func (vs *Visor) RemoveInvalidUnconfirmed() ([]cipher.SHA256, error) {
 	return vs.Unconfirmed.RemoveInvalid(vs.Blockchain)
 }
 
-// InsertTrustPubkeyList insert trust pubkey into bolt db
+// InsertTrustPubkeyList insert trust pubkey into bolt db, rotated keys are replaced by their
+// current keys. The list is relayed to the peers, the validators are only taken from the
+// validator sets recorded by the chain. Returns ErrGoverned once a validator set transaction took effect.
 func (vs *Visor) InsertTrustPubkeyList(pubkeys []cipher.PubKey) error {
-	return vs.trustNode.AddNodePubkey(pubkeys)
+	if vs.IsGoverned(coin.TxTypeValidatorSet) {
+		return ErrGoverned
+	}
+	return vs.trustNode.AddNodePubkey(vs.rotatePubkeys(pubkeys))
 }
 
-// InsertAgreeNodeNum set agress node number
+// InsertAgreeNodeNum set agress node number,
+// returns ErrGoverned once a quorum transaction took effect
 func (vs *Visor) InsertAgreeNodeNum(num int) error {
+	if vs.IsGoverned(coin.TxTypeQuorum) {
+		return ErrGoverned
+	}
 	return vs.trustNode.InsertAgreeNodeNum(num)
 }
 
@@ -449,14 +645,13 @@ func (vs *Visor) TrustNodes() []cipher.PubKey {
 	return vs.trustNode.GetPubkeys()
 }
 
-// IsTrustPubkey check the pubkey valid or not
+// IsTrustPubkey check the pubkey valid or not, the validators of the next block are trusted,
+// jailed validators and rotated keys are not
 func (vs *Visor) IsTrustPubkey(pubKey cipher.PubKey) bool {
-	for _, pkey := range vs.TrustNodes() {
-		if pkey == pubKey {
-			return true
-		}
+	if vs.isJailed(pubKey) || vs.isRetired(pubKey) {
+		return false
 	}
-	return false
+	return containsPubkey(vs.blockValidators(vs.HeadBkSeq()+1), pubKey)
 }
 
 // AddValidator add a validator for block
@@ -516,8 +711,13 @@ func (vs *Visor) StartExecuteSignedBlock(hash cipher.SHA256) error {
 	if err != nil {
 		return err
 	}
-	err = vs.ExecuteSignedBlock(block)
+	validators, err := vs.pbft.GetBlockValidators(hash)
+	if err != nil {
+		return err
+	}
+	err = vs.ExecuteSignedBlock(block, vs.quorumCert(hash))
 	if err == nil {
+		vs.recordCosigners(hash, validators)
 		vs.DeletePbftHash(hash)
 	}
 	return err
@@ -525,21 +725,26 @@ func (vs *Visor) StartExecuteSignedBlock(hash cipher.SHA256) error {
 
 // RemoveUnconfirmBlock remove pending block if it unconfirmed in 120 seconds
 func (vs *Visor) RemoveUnconfirmBlock() {
-	vs.pbft.RemoveUnconfirmBlock()
+	if err := vs.recordOrphaned(vs.pbft.RemoveUnconfirmBlock()); err != nil {
+		logger.Errorf("Record orphaned blocks failed: %v", err)
+	}
 }
 
 // InTurnTheNode it is time create block for this node
 func (vs *Visor) InTurnTheNode(when int64) (bool, error) {
-	if len(vs.GetPendingHash()) > 0 {
+	if vs.pbft.IsFull() {
 		return false, errors.New("pbft has unconfirmed block")
 	}
 
+	// the new block extends the highest pending block
 	lastBlock, err := vs.GetHeadBlock()
 	if err != nil {
 		return false, err
 	}
-	err = vs.dpos.CheckValidator(lastBlock, when)
-	if err != nil {
+	if tip, ok := vs.pbft.GetTip(); ok {
+		lastBlock = &tip
+	}
+	if err := vs.engine.InTurn(lastBlock, when); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -553,10 +758,19 @@ func (vs *Visor) CreateBlock(when uint64) (coin.PendingSignedBlock, error) {
 
 	var sb coin.PendingSignedBlock
 
+	// The block extends the highest pending block if any
+	tip, st, pending, err := vs.pendingTip()
+	if err != nil {
+		return sb, err
+	}
+
 	// Gather all unconfirmed transactions
 	txns := vs.Unconfirmed.RawTxns()
 
 	if len(txns) == 0 {
+		if vs.emptyBlockDue(when) {
+			return vs.createEmptyBlock(when)
+		}
 		return sb, errors.New("No transactions")
 	}
 
@@ -567,6 +781,8 @@ func (vs *Visor) CreateBlock(when uint64) (coin.PendingSignedBlock, error) {
 	for _, txn := range txns {
 		if err := vs.Blockchain.VerifySingleTxnAllConstraints(txn, vs.Config.MaxBlockSize); err != nil {
 			logger.Warningf("Transaction %s violates constraints: %v", txn.TxIDHex(), err)
+		} else if _, ok := st.spends(txn); pending && ok {
+			logger.Debugf("Transaction %s spends an output of a pending block", txn.TxIDHex())
 		} else {
 			filteredTxns = append(filteredTxns, txn)
 		}
@@ -580,6 +796,9 @@ func (vs *Visor) CreateBlock(when uint64) (coin.PendingSignedBlock, error) {
 	txns = filteredTxns
 
 	if len(txns) == 0 {
+		if vs.emptyBlockDue(when) {
+			return vs.createEmptyBlock(when)
+		}
 		logger.Info("No transactions after filtering for constraint violations")
 		return sb, errors.New("No transactions after filtering for constraint violations")
 	}
@@ -602,50 +821,69 @@ func (vs *Visor) CreateBlock(when uint64) (coin.PendingSignedBlock, error) {
 		return sb, err
 	}
 
-	return vs.SignBlock(*b), nil
+	if pending {
+		if b, err = vs.extendTip(b, tip, st, when); err != nil {
+			logger.Warningf("Extend pending block %d failed: %v", tip.Seq(), err)
+			return sb, err
+		}
+	}
+
+	if err := vs.addEvidences(b, st); err != nil {
+		logger.Warningf("Add evidence transactions failed: %v", err)
+		return sb, err
+	}
+
+	if err := vs.addCoinbase(b); err != nil {
+		logger.Warningf("Add coinbase transaction failed: %v", err)
+		return sb, err
+	}
+
+	return vs.SignBlock(*b)
 }
 
 // CreateAndExecuteBlock creates a SignedBlock from pending transactions and executes it
 func (vs *Visor) CreateAndExecuteBlock() (coin.PendingSignedBlock, error) {
-	sb, err := vs.CreateBlock(uint64(utc.UnixNow()))
+	sb, err := vs.CreateBlock(uint64(vs.pbft.Now()))
 	if err != nil {
 		return sb, err
 	}
 	return sb, vs.AddPendingBlock(sb.ToSignedBlock())
 }
 
-// CheckBlockMakerConstraint verify the block should made by the pubkey in the slot
+// CheckBlockMakerConstraint verify the block extends the head or a pending block and
+// the consensus engine accepts its producer
 func (vs *Visor) CheckBlockMakerConstraint(block coin.SignedBlock) error {
-	height := block.Seq()
-	if height <= vs.HeadBkSeq() {
-		errors.New("pending block seq less than head")
-	}
-	if err := vs.pbft.CheckBkSeq(height); err != nil {
-		return err
-	}
-	pubkeyRec, err := cipher.PubKeyFromSig(block.Sig, block.HashHeader()) //recovered pubkey
+	head, err := vs.Blockchain.Head()
 	if err != nil {
 		return err
 	}
-	validatorPubkey, err := vs.dpos.GetValidator(int64(block.Time()))
-	if err != nil {
+	if err := vs.pbft.CheckParent(block, head.Seq(), head.HashHeader()); err != nil {
 		return err
 	}
-	if pubkeyRec == validatorPubkey {
-		return nil
-	}
-	return errors.New("block create time is not satified")
+	return vs.engine.AcceptBlock(block)
 }
 
 // VerifyBlockTransactions check tansaction in block is confirmed or not
 func (vs *Visor) VerifyBlockTransactions(block coin.SignedBlock) error {
-	for _, tx := range block.Block.Body.Transactions {
+	txns := block.Block.Body.Transactions
+	for i, tx := range txns {
+		if tx.Type == coin.TxTypeCoinbase && i == len(txns)-1 {
+			// checked by verifyCoinbase
+			continue
+		}
+		if tx.Type == coin.TxTypeEvidence {
+			// checked by verifyEvidences
+			continue
+		}
 		if err := tx.Verify(); err != nil {
 			fmt.Printf("Transaction %s verify failed %v\n", tx.Hash().Hex(), err)
 			return err
 		}
 	}
-	return nil
+	if err := vs.verifyEvidences(block); err != nil {
+		return err
+	}
+	return vs.verifyCoinbase(block)
 }
 
 // AddPendingBlock hold pending block, store into blockchain if validator number reach threshold
@@ -656,25 +894,81 @@ func (vs *Visor) AddPendingBlock(block coin.SignedBlock) error {
 	if err := vs.VerifyBlockTransactions(block); err != nil {
 		return err
 	}
+	if err := vs.verifyPendingParent(block); err != nil {
+		return err
+	}
 	return vs.pbft.AddSignedBlock(block)
 }
 
 // ExecuteSignedBlock adds a block to the blockchain, or returns error.
-// Blocks must be executed in sequence, and be signed by the master server
-func (vs *Visor) ExecuteSignedBlock(b coin.SignedBlock) error {
-	trustPubkeys := vs.TrustNodes()
-	if len(vs.TrustNodes()) == 0 {
-		trustPubkeys = vs.Config.TrustPubkeyList
-	}
+// Blocks must be executed in sequence, and be signed by the master server.
+// The quorum certificate of the block is stored with it, qc is nil if it has none.
+func (vs *Visor) ExecuteSignedBlock(b coin.SignedBlock, qc *blockdb.QuorumCert) error {
+	trustPubkeys := vs.blockValidators(b.Seq())
 	if err := b.VerifySignature(trustPubkeys); err != nil {
 		return err
 	}
 
+	if err := vs.verifyQuorumCert(b, qc, trustPubkeys); err != nil {
+		return err
+	}
+
+	if err := vs.verifyCoinbase(b); err != nil {
+		return err
+	}
+
+	if err := vs.verifyEvidences(b); err != nil {
+		return err
+	}
+
+	slots, err := vs.livenessSlots(b)
+	if err != nil {
+		return err
+	}
+
+	var active []cipher.PubKey
+	var epochChanged bool
 	if err := vs.db.Update(func(tx *bolt.Tx) error {
 		if err := vs.Blockchain.ExecuteBlockWithTx(tx, &b); err != nil {
 			return err
 		}
 
+		if err := vs.applyVotesWithTx(tx, b.Block.Body.Transactions); err != nil {
+			return err
+		}
+
+		if err := vs.applyUnjailsWithTx(tx, b.Block); err != nil {
+			return err
+		}
+
+		if err := vs.applyEvidencesWithTx(tx, b.Block); err != nil {
+			return err
+		}
+
+		if err := vs.applyGovernanceWithTx(tx, b.Block); err != nil {
+			return err
+		}
+
+		if err := vs.applyKeyRotationsWithTx(tx, b.Block); err != nil {
+			return err
+		}
+
+		if err := vs.recordLivenessWithTx(tx, slots); err != nil {
+			return err
+		}
+
+		if qc != nil {
+			if err := vs.quorumCerts.AddWithTx(tx, *qc); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		active, epochChanged, err = vs.startEpochWithTx(tx, b.Block)
+		if err != nil {
+			return fmt.Errorf("start validator epoch failed: %v", err)
+		}
+
 		// Remove the transactions in the Block from the unconfirmed pool
 		txHashes := make([]cipher.SHA256, 0, len(b.Block.Body.Transactions))
 		for _, tx := range b.Block.Body.Transactions {
@@ -684,26 +978,46 @@ func (vs *Visor) ExecuteSignedBlock(b coin.SignedBlock) error {
 
 		return nil
 	}); err != nil {
+		// the rolled back writes may still be in the caches of the chain
+		if err := vs.Blockchain.SyncCache(); err != nil {
+			logger.Errorf("Sync blockchain cache failed: %v", err)
+		}
 		return err
 	}
 
 	vs.Blockchain.Notify(b.Block)
+
+	vs.pruneExecuted(b)
+
+	// the next height starts with the first view
+	if vs.pbft != nil {
+		vs.pbft.ResetView()
+	}
+
+	if epochChanged {
+		if err := vs.applyEpoch(active); err != nil {
+			logger.Errorf("Apply validators of epoch failed: %v", err)
+		}
+	}
 	return nil
 }
 
-// SignBlock signs a block for master.  Will panic if anything is invalid
-func (vs *Visor) SignBlock(b coin.Block) coin.PendingSignedBlock {
+// SignBlock signs a block for master.  Will panic if not running as a master chain
+func (vs *Visor) SignBlock(b coin.Block) (coin.PendingSignedBlock, error) {
 	if !vs.Config.IsMaster {
 		logger.Panic("Only master chain can sign blocks")
 	}
 
-	sig := cipher.SignHash(b.HashHeader(), vs.Config.BlockchainTrustSeckey)
+	sig, err := vs.signer.Sign(signer.BlockRequest(b.Head))
+	if err != nil {
+		return coin.PendingSignedBlock{}, err
+	}
 
 	return coin.PendingSignedBlock{
 		Block:   b,
 		Sig:     sig,
 		Pending: true,
-	}
+	}, nil
 }
 
 /*
@@ -1240,17 +1554,17 @@ func (vs *Visor) GetLastBlocks(num uint64) []coin.SignedBlock {
 }
 
 // GetHeadBlock gets head block.
-func (vs Visor) GetHeadBlock() (*coin.SignedBlock, error) {
+func (vs *Visor) GetHeadBlock() (*coin.SignedBlock, error) {
 	return vs.Blockchain.Head()
 }
 
 // GetUxOutByID gets UxOut by hash id.
-func (vs Visor) GetUxOutByID(id cipher.SHA256) (*historydb.UxOut, error) {
+func (vs *Visor) GetUxOutByID(id cipher.SHA256) (*historydb.UxOut, error) {
 	return vs.history.GetUxout(id)
 }
 
 // GetAddrUxOuts gets all the address affected UxOuts.
-func (vs Visor) GetAddrUxOuts(address cipher.Address) ([]*historydb.UxOut, error) {
+func (vs *Visor) GetAddrUxOuts(address cipher.Address) ([]*historydb.UxOut, error) {
 	return vs.history.GetAddrUxOuts(address)
 }
 
@@ -1260,7 +1574,7 @@ func (vs *Visor) CreateWallet(wltName string, opts wallet.Options) (*wallet.Wall
 }
 
 // GetBalanceOfAddrs returns balance pairs of given addreses
-func (vs Visor) GetBalanceOfAddrs(addrs []cipher.Address) ([]wallet.BalancePair, error) {
+func (vs *Visor) GetBalanceOfAddrs(addrs []cipher.Address) ([]wallet.BalancePair, error) {
 	var bps []wallet.BalancePair
 	auxs := vs.Blockchain.Unspent().GetUnspentsOfAddrs(addrs)
 	spendUxs, err := vs.Unconfirmed.SpendsOfAddresses(addrs, vs.Blockchain.Unspent())
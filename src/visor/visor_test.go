@@ -18,6 +18,7 @@ import (
 	"github.com/samoslab/samos/src/coin"
 	"github.com/samoslab/samos/src/consensus/dpos"
 	"github.com/samoslab/samos/src/consensus/pbft"
+	"github.com/samoslab/samos/src/signer"
 	"github.com/samoslab/samos/src/testutil"
 	_require "github.com/samoslab/samos/src/testutil/require"
 	"github.com/samoslab/samos/src/util/fee"
@@ -177,6 +178,8 @@ func TestVisorCreateBlock(t *testing.T) {
 		dpos:        dpos,
 		trustNode:   tn,
 	}
+	v.engine = dposPbftEngine{vs: v}
+	v.signer = signer.NewLocal(v.TrustSeckey, v.Config.BlockchainSeckey, nil)
 
 	// CreateBlock panics if called when not master
 	_require.PanicsWithLogMessage(t, "Only master chain can create blocks", func() {
@@ -340,6 +343,8 @@ func TestVisorInjectTransaction(t *testing.T) {
 		dpos:        dpos,
 		trustNode:   tn,
 	}
+	v.engine = dposPbftEngine{vs: v}
+	v.signer = signer.NewLocal(v.TrustSeckey, v.Config.BlockchainSeckey, nil)
 
 	// CreateBlock panics if called when not master
 	_require.PanicsWithLogMessage(t, "Only master chain can create blocks", func() {
@@ -1832,6 +1837,8 @@ func TestRemoveInvalidUnconfirmedDoubleSpendArbitrating(t *testing.T) {
 		dpos:        dpos,
 		trustNode:   tn,
 	}
+	v.engine = dposPbftEngine{vs: v}
+	v.signer = signer.NewLocal(v.TrustSeckey, v.Config.BlockchainSeckey, nil)
 
 	addGenesisBlock(t, v.Blockchain)
 	gb := v.Blockchain.GetGenesisBlock()